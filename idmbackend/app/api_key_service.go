@@ -0,0 +1,164 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// APIKeyRepository 除按摘要认证外，查询都限定在 scope 所在的组织内
+type APIKeyRepository interface {
+	Create(key *domain.APIKey) error
+	FindAll(scope domain.TenantScope) ([]*domain.APIKey, error)
+	FindByID(scope domain.TenantScope, id uint) (*domain.APIKey, error)
+	FindByHash(keyHash string) (*domain.APIKey, error)
+	Revoke(scope domain.TenantScope, id uint, at time.Time) error
+	RevokeByCreator(userID uint, at time.Time) error
+	TouchLastUsed(id uint, at time.Time, ip string) error
+}
+
+const (
+	apiKeyPrefix = "idm_"
+	// apiKeyTouchInterval 最近使用时间的最小更新间隔，避免每个请求都写数据库
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyInput 创建 API 密钥的参数
+type APIKeyInput struct {
+	Name        string
+	Permissions []domain.Permission
+	AreaIDs     []string
+	DeviceIDs   []string
+	ExpiresAt   *time.Time
+}
+
+type APIKeyService struct {
+	keyRepo     APIKeyRepository
+	roleService *RoleService
+}
+
+func NewAPIKeyService(keyRepo APIKeyRepository, roleService *RoleService) *APIKeyService {
+	return &APIKeyService{
+		keyRepo:     keyRepo,
+		roleService: roleService,
+	}
+}
+
+// CreateKey 在创建者当前所在的组织中创建 API 密钥并返回明文，明文不会被保存。
+// 密钥的权限不能超出创建者角色拥有的权限，也不能包含管理接口的权限。
+func (s *APIKeyService) CreateKey(creator *domain.Principal, input APIKeyInput) (string, *domain.APIKey, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return "", nil, fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	if len(input.Permissions) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one permission is required", domain.ErrInvalidInput)
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return "", nil, fmt.Errorf("%w: expires_at must be in the future", domain.ErrInvalidInput)
+	}
+	for _, p := range input.Permissions {
+		if !p.IsValid() {
+			return "", nil, fmt.Errorf("%w: unknown permission %q", domain.ErrInvalidInput, p)
+		}
+		if p.IsAdmin() {
+			return "", nil, fmt.Errorf("%w: permission %q cannot be granted to API keys", domain.ErrInvalidInput, p)
+		}
+		ok, err := s.roleService.HasPermission(creator.Role, p)
+		if err != nil {
+			return "", nil, err
+		}
+		if !ok {
+			return "", nil, fmt.Errorf("%w: cannot grant permission %q that you do not hold", domain.ErrForbidden, p)
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := apiKeyPrefix + secret
+
+	key := &domain.APIKey{
+		OrgID:       creator.OrgID,
+		Name:        input.Name,
+		Prefix:      plaintext[:len(apiKeyPrefix)+8],
+		KeyHash:     hashToken(plaintext),
+		Permissions: input.Permissions,
+		AreaIDs:     trimAll(input.AreaIDs),
+		DeviceIDs:   trimAll(input.DeviceIDs),
+		CreatedBy:   creator.UserID,
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.keyRepo.Create(key); err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+func (s *APIKeyService) ListKeys(scope domain.TenantScope) ([]*domain.APIKey, error) {
+	return s.keyRepo.FindAll(scope)
+}
+
+func (s *APIKeyService) GetKey(scope domain.TenantScope, id uint) (*domain.APIKey, error) {
+	key, err := s.keyRepo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// RevokeKey 吊销密钥，立即生效
+func (s *APIKeyService) RevokeKey(scope domain.TenantScope, id uint) error {
+	if _, err := s.GetKey(scope, id); err != nil {
+		return err
+	}
+	return s.keyRepo.Revoke(scope, id, time.Now())
+}
+
+// Authenticate 校验明文密钥并返回对应的请求主体
+func (s *APIKeyService) Authenticate(plaintext, clientIP string) (*domain.Principal, error) {
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	key, err := s.keyRepo.FindByHash(hashToken(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key == nil || !key.IsActive(now) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != clientIP {
+		if err := s.keyRepo.TouchLastUsed(key.ID, now, clientIP); err != nil {
+			log.Printf("更新 API 密钥使用时间失败: %v", err)
+		}
+	}
+
+	return &domain.Principal{
+		Kind:        domain.PrincipalAPIKey,
+		APIKeyID:    key.ID,
+		OrgID:       key.OrgID,
+		Name:        key.Name,
+		Permissions: key.Permissions,
+		AreaIDs:     key.AreaIDs,
+		DeviceIDs:   key.DeviceIDs,
+	}, nil
+}
+
+func trimAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memAPIKeyRepo struct {
+	mu   sync.Mutex
+	keys []*domain.APIKey
+}
+
+func (r *memAPIKeyRepo) Create(key *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key.ID = uint(len(r.keys) + 1)
+	copied := *key
+	r.keys = append(r.keys, &copied)
+	return nil
+}
+
+func (r *memAPIKeyRepo) FindAll(scope domain.TenantScope) ([]*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.APIKey
+	for _, k := range r.keys {
+		if k.OrgID == scope.OrgID {
+			copied := *k
+			found = append(found, &copied)
+		}
+	}
+	return found, nil
+}
+
+func (r *memAPIKeyRepo) find(match func(*domain.APIKey) bool) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if match(k) {
+			copied := *k
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAPIKeyRepo) FindByID(scope domain.TenantScope, id uint) (*domain.APIKey, error) {
+	return r.find(func(k *domain.APIKey) bool { return k.ID == id && k.OrgID == scope.OrgID })
+}
+
+func (r *memAPIKeyRepo) FindByHash(keyHash string) (*domain.APIKey, error) {
+	return r.find(func(k *domain.APIKey) bool { return k.KeyHash == keyHash })
+}
+
+func (r *memAPIKeyRepo) revoke(match func(*domain.APIKey) bool, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.RevokedAt == nil && match(k) {
+			k.RevokedAt = &at
+		}
+	}
+}
+
+func (r *memAPIKeyRepo) Revoke(scope domain.TenantScope, id uint, at time.Time) error {
+	r.revoke(func(k *domain.APIKey) bool { return k.ID == id && k.OrgID == scope.OrgID }, at)
+	return nil
+}
+
+func (r *memAPIKeyRepo) RevokeByCreator(userID uint, at time.Time) error {
+	r.revoke(func(k *domain.APIKey) bool { return k.CreatedBy == userID }, at)
+	return nil
+}
+
+func (r *memAPIKeyRepo) TouchLastUsed(id uint, at time.Time, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.ID == id {
+			k.LastUsedAt, k.LastUsedIP = &at, ip
+		}
+	}
+	return nil
+}
+
+func TestCreateKeyRejectsAdminPermissions(t *testing.T) {
+	env := newTestEnv()
+	service := NewAPIKeyService(env.keys, env.roles)
+	admin := &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: domain.RoleAdmin, OrgID: 1}
+
+	for _, p := range []domain.Permission{domain.PermAll, domain.PermUsersManage, domain.PermAPIKeysManage, "users:*", domain.PermAuditView} {
+		_, _, err := service.CreateKey(admin, APIKeyInput{Name: "sensor", Permissions: []domain.Permission{domain.PermWaterQualityWrite, p}})
+		if !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("CreateKey with %q: err = %v, want ErrInvalidInput", p, err)
+		}
+	}
+	if _, _, err := service.CreateKey(admin, APIKeyInput{Name: "sensor", Permissions: []domain.Permission{domain.PermWaterQualityWrite}}); err != nil {
+		t.Fatalf("CreateKey with data permission: %v", err)
+	}
+}
+
+func TestCreatorKeysRevokedOnDisableAndRoleChange(t *testing.T) {
+	env := newTestEnv()
+	keys := NewAPIKeyService(env.keys, env.roles)
+	users := NewUserService(env.users, NewPasswordPolicy(0, nil), env.orgSvc, env.auth, nil)
+	platformAdmin := &domain.Principal{Kind: domain.PrincipalUser, UserID: 100, Role: domain.RoleAdmin, PlatformAdmin: true, OrgID: 1}
+
+	newCreatorKey := func(username string) (*domain.User, string) {
+		user := &domain.User{Username: username, Role: domain.RoleOperator}
+		if err := env.users.Create(user); err != nil {
+			t.Fatal(err)
+		}
+		creator := &domain.Principal{Kind: domain.PrincipalUser, UserID: user.ID, Role: user.Role, OrgID: 1}
+		plaintext, _, err := keys.CreateKey(creator, APIKeyInput{Name: "probe", Permissions: []domain.Permission{domain.PermWaterQualityWrite}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.Authenticate(plaintext, "10.0.0.1"); err != nil {
+			t.Fatalf("fresh key rejected: %v", err)
+		}
+		return user, plaintext
+	}
+
+	disabled, disabledKey := newCreatorKey("olivia")
+	if err := users.DisableUser(platformAdmin, disabled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(disabledKey, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+		t.Errorf("key of disabled user: err = %v, want ErrInvalidAPIKey", err)
+	}
+
+	demoted, demotedKey := newCreatorKey("peggy")
+	if err := env.roles.AssignRole(demoted.ID, domain.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(demotedKey, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+		t.Errorf("key of demoted user: err = %v, want ErrInvalidAPIKey", err)
+	}
+
+	member, memberKey := newCreatorKey("rupert")
+	if err := env.orgs.SaveMembership(&domain.Membership{OrgID: 1, UserID: member.ID, Role: domain.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.orgSvc.SetMemberRole(platformAdmin, member.ID, domain.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(memberKey, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+		t.Errorf("key of member whose role changed: err = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestCreateKeyLimitedToCreatorPermissions(t *testing.T) {
+	env := newTestEnv()
+	service := NewAPIKeyService(env.keys, env.roles)
+	operator := &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: domain.RoleOperator, OrgID: 1}
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		input APIKeyInput
+		want  error
+	}{
+		{"permission the creator holds", APIKeyInput{Name: "probe", Permissions: []domain.Permission{domain.PermWaterQualityWrite}}, nil},
+		{"permission the creator lacks", APIKeyInput{Name: "probe", Permissions: []domain.Permission{domain.PermSpeciesAdmin}}, domain.ErrForbidden},
+		{"unknown permission", APIKeyInput{Name: "probe", Permissions: []domain.Permission{"fish:catch"}}, domain.ErrInvalidInput},
+		{"no permissions", APIKeyInput{Name: "probe"}, domain.ErrInvalidInput},
+		{"blank name", APIKeyInput{Name: "  ", Permissions: []domain.Permission{domain.PermWaterQualityWrite}}, domain.ErrInvalidInput},
+		{"already expired", APIKeyInput{Name: "probe", Permissions: []domain.Permission{domain.PermWaterQualityWrite}, ExpiresAt: &past}, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.CreateKey(operator, tt.input)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateKey = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	env := newTestEnv()
+	service := NewAPIKeyService(env.keys, env.roles)
+	creator := &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: domain.RoleOperator, OrgID: 2}
+	plaintext, key, err := service.CreateKey(creator, APIKeyInput{
+		Name:        "probe",
+		Permissions: []domain.Permission{domain.PermWaterQualityWrite},
+		AreaIDs:     []string{" pond-a ", ""},
+		DeviceIDs:   []string{"probe-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Prefix != plaintext[:len(key.Prefix)] || key.KeyHash == plaintext {
+		t.Fatalf("key stores prefix %q and hash %q", key.Prefix, key.KeyHash)
+	}
+
+	principal, err := service.Authenticate(plaintext, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Kind != domain.PrincipalAPIKey || principal.OrgID != 2 || principal.APIKeyID != key.ID {
+		t.Errorf("principal = %+v, want api key in org 2", principal)
+	}
+	if !principal.AllowsArea("pond-a") || principal.AllowsArea("pond-b") || !principal.AllowsDevice("probe-1") {
+		t.Errorf("principal scopes = %v/%v", principal.AreaIDs, principal.DeviceIDs)
+	}
+	stored, _ := env.keys.FindByID(domain.TenantScope{OrgID: 2}, key.ID)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "10.0.0.1" {
+		t.Errorf("last used = %v from %q", stored.LastUsedAt, stored.LastUsedIP)
+	}
+
+	for _, bad := range []string{"", "not-a-key", plaintext[:len(plaintext)-1], "idm_" + plaintext} {
+		if _, err := service.Authenticate(bad, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidAPIKey", bad, err)
+		}
+	}
+
+	// 其他组织无法吊销该密钥
+	if err := service.RevokeKey(domain.TenantScope{OrgID: 1}, key.ID); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		t.Errorf("revoke from other org: err = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := service.RevokeKey(domain.TenantScope{OrgID: 2}, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(plaintext, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+		t.Errorf("revoked key: err = %v, want ErrInvalidAPIKey", err)
+	}
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type AuditRepository interface {
+	Append(entry *domain.AuditEntry) error
+	Find(filter domain.AuditFilter) ([]*domain.AuditEntry, int64, error)
+	FindAfter(afterID uint, limit int) ([]*domain.AuditEntry, error)
+}
+
+const (
+	maxAuditExportRows = 10000
+	auditVerifyBatch   = 500
+	auditAppendRetries = 3
+	// auditQueueSize 等待后台写入的审计记录上限，队列满时由调用方同步写入
+	auditQueueSize = 1024
+)
+
+// AuditService 记录认证和管理操作的审计日志。写入失败只记录到运行日志，不影响业务请求
+type AuditService struct {
+	repo  AuditRepository
+	mu    sync.Mutex // 同一进程内串行追加，跨进程的并发由 prev_hash 唯一约束兜底
+	queue chan *domain.AuditEntry
+	// queueMu 保护 queue，后台写入停止时 queue 被置空，此后 Record 同步写入
+	queueMu sync.Mutex
+	stopped chan struct{} // 后台写入写完剩余记录退出后关闭
+}
+
+func NewAuditService(repo AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Start 启动后台写入，此后 Record 只把记录放入队列，不等待数据库。
+// ctx 取消后写完队列中剩余的记录再停止，之后的记录改为同步写入
+func (s *AuditService) Start(ctx context.Context) {
+	queue := make(chan *domain.AuditEntry, auditQueueSize)
+	stopped := make(chan struct{})
+	s.queueMu.Lock()
+	s.queue, s.stopped = queue, stopped
+	s.queueMu.Unlock()
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case entry := <-queue:
+				s.append(entry)
+			case <-ctx.Done():
+				s.queueMu.Lock()
+				s.queue = nil
+				s.queueMu.Unlock()
+				for {
+					select {
+					case entry := <-queue:
+						s.append(entry)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Record 追加一条审计记录，超长字段按列宽截断后再计算哈希。
+// 后台写入已启动时放入队列，否则同步写入
+func (s *AuditService) Record(entry *domain.AuditEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = domain.AuditSuccess
+	}
+	entry.ActorName = truncateRunes(entry.ActorName, 128)
+	entry.Action = truncateRunes(entry.Action, 128)
+	entry.TargetID = truncateRunes(entry.TargetID, 64)
+	entry.IP = truncateRunes(entry.IP, 64)
+	entry.UserAgent = truncateRunes(entry.UserAgent, 255)
+	entry.Detail = truncateRunes(entry.Detail, 512)
+
+	s.queueMu.Lock()
+	queued := false
+	if s.queue != nil {
+		select {
+		case s.queue <- entry:
+			queued = true
+		default:
+		}
+	}
+	s.queueMu.Unlock()
+	if !queued {
+		s.append(entry)
+	}
+}
+
+// append 写入一条记录。只有其他进程抢先追加导致链尾变化时才重试，其他错误直接放弃
+func (s *AuditService) append(entry *domain.AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		err = s.repo.Append(entry)
+		if !errors.Is(err, domain.ErrAuditChainConflict) {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("写入审计日志失败: action=%s actor=%d: %v", entry.Action, entry.ActorID, err)
+	}
+}
+
+// List 分页查询审计日志。平台管理员可查看全部组织，其他管理员只能查看当前组织的记录
+func (s *AuditService) List(principal *domain.Principal, filter domain.AuditFilter) ([]*domain.AuditEntry, int64, error) {
+	if !principal.PlatformAdmin {
+		orgID := principal.OrgID
+		filter.OrgID = &orgID
+	}
+	return s.repo.Find(filter)
+}
+
+// ExportCSV 按条件导出审计日志，最多导出 maxAuditExportRows 条
+func (s *AuditService) ExportCSV(principal *domain.Principal, filter domain.AuditFilter) ([]byte, error) {
+	filter.Offset = 0
+	filter.Limit = maxAuditExportRows
+	entries, _, err := s.List(principal, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"id", "created_at", "org_id", "actor_kind", "actor_id", "actor_name", "action",
+		"target_type", "target_id", "ip", "user_agent", "outcome", "detail", "prev_hash", "hash"})
+	for _, e := range entries {
+		_ = writer.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10),
+			e.CreatedAt.Format(time.RFC3339Nano),
+			strconv.FormatUint(uint64(e.OrgID), 10),
+			e.ActorKind,
+			strconv.FormatUint(uint64(e.ActorID), 10),
+			csvCell(e.ActorName),
+			e.Action,
+			e.TargetType,
+			csvCell(e.TargetID),
+			e.IP,
+			csvCell(e.UserAgent),
+			string(e.Outcome),
+			csvCell(e.Detail),
+			e.PrevHash,
+			e.Hash,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify 按写入顺序重新计算整条哈希链，返回第一条被修改、删除或插入的位置
+func (s *AuditService) Verify() (*domain.AuditVerification, error) {
+	result := &domain.AuditVerification{Valid: true}
+	prevHash := ""
+	var afterID uint
+	for {
+		entries, err := s.repo.FindAfter(afterID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			result.Checked++
+			if e.PrevHash != prevHash || e.ComputeHash() != e.Hash {
+				result.Valid = false
+				result.BrokenID = e.ID
+				return result, nil
+			}
+			prevHash = e.Hash
+			afterID = e.ID
+		}
+		if len(entries) < auditVerifyBatch {
+			return result, nil
+		}
+	}
+}
+
+func truncateRunes(value string, max int) string {
+	if utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	return string([]rune(value)[:max])
+}
+
+// csvCell 防止用户可控的内容在电子表格中被当作公式执行
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memAuditRepo 与数据库实现一样在追加时接到链尾并计算哈希
+type memAuditRepo struct {
+	mu      sync.Mutex
+	entries []*domain.AuditEntry
+}
+
+func (r *memAuditRepo) Append(entry *domain.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prevHash := ""
+	if n := len(r.entries); n > 0 {
+		prevHash = r.entries[n-1].Hash
+	}
+	entry.ID = uint(len(r.entries) + 1)
+	entry.Seal(prevHash)
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memAuditRepo) Find(filter domain.AuditFilter) ([]*domain.AuditEntry, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.AuditEntry
+	for _, e := range r.entries {
+		if filter.OrgID == nil || e.OrgID == *filter.OrgID {
+			found = append(found, e)
+		}
+	}
+	return found, int64(len(found)), nil
+}
+
+func (r *memAuditRepo) FindAfter(afterID uint, limit int) ([]*domain.AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.AuditEntry
+	for _, e := range r.entries {
+		if e.ID > afterID && len(found) < limit {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// scriptedAuditRepo 依次返回预设的错误，用完后写入成功
+type scriptedAuditRepo struct {
+	memAuditRepo
+	mu       sync.Mutex
+	errs     []error
+	attempts int
+}
+
+func (r *scriptedAuditRepo) Append(entry *domain.AuditEntry) error {
+	r.mu.Lock()
+	r.attempts++
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+	return r.memAuditRepo.Append(entry)
+}
+
+func TestAuditRecordRetriesOnlyChainConflicts(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantWritten  int
+	}{
+		{"first attempt succeeds", nil, 1, 1},
+		{"conflict then success", []error{domain.ErrAuditChainConflict}, 2, 1},
+		{"persistent conflict", []error{domain.ErrAuditChainConflict, domain.ErrAuditChainConflict, domain.ErrAuditChainConflict}, auditAppendRetries, 0},
+		{"database error is not retried", []error{errors.New("lock wait timeout")}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &scriptedAuditRepo{errs: tt.errs}
+			NewAuditService(repo).Record(&domain.AuditEntry{Action: "admin:POST /api/admin/users/:id/disable"})
+			if repo.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", repo.attempts, tt.wantAttempts)
+			}
+			if len(repo.entries) != tt.wantWritten {
+				t.Errorf("written = %d, want %d", len(repo.entries), tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestAuditStartWritesQueuedEntries(t *testing.T) {
+	repo := &memAuditRepo{}
+	service := NewAuditService(repo)
+	ctx, cancel := context.WithCancel(context.Background())
+	service.Start(ctx)
+
+	for i := 0; i < 10; i++ {
+		service.Record(&domain.AuditEntry{Action: "auth.login"})
+	}
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, total, _ := repo.Find(domain.AuditFilter{})
+		if total == 10 {
+			for _, e := range entries {
+				if e.Outcome != domain.AuditSuccess {
+					t.Errorf("outcome = %q, want success", e.Outcome)
+				}
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("written = %d, want 10", total)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAuditRecordWritesSynchronouslyAfterStop(t *testing.T) {
+	repo := &memAuditRepo{}
+	service := NewAuditService(repo)
+	ctx, cancel := context.WithCancel(context.Background())
+	service.Start(ctx)
+	service.Record(&domain.AuditEntry{Action: "auth.login"})
+	cancel()
+	<-service.stopped
+
+	// 后台写入已停止，记录不能再留在队列里
+	service.Record(&domain.AuditEntry{Action: "auth.logout"})
+	entries, total, _ := repo.Find(domain.AuditFilter{})
+	if total != 2 {
+		t.Fatalf("written = %d, want 2", total)
+	}
+	if entries[0].Action != "auth.logout" && entries[1].Action != "auth.logout" {
+		t.Errorf("entries = %v, want the entry recorded after stop", entries)
+	}
+}
+
+func TestAuditVerifyDetectsTampering(t *testing.T) {
+	// 超过一个校验批次，覆盖分批读取
+	const total = auditVerifyBatch + 20
+	newChain := func() (*AuditService, *memAuditRepo) {
+		repo := &memAuditRepo{}
+		service := NewAuditService(repo)
+		for i := 0; i < total; i++ {
+			service.Record(&domain.AuditEntry{Action: domain.AuditLogin, ActorID: uint(i)})
+		}
+		return service, repo
+	}
+
+	service, _ := newChain()
+	result, err := service.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Checked != total {
+		t.Fatalf("intact chain = %+v, want valid with %d checked", result, total)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(repo *memAuditRepo)
+		broken uint
+	}{
+		{"modified entry", func(repo *memAuditRepo) { repo.entries[509].Outcome = domain.AuditFailure }, 510},
+		{"deleted entry", func(repo *memAuditRepo) {
+			repo.entries = append(repo.entries[:10], repo.entries[11:]...)
+		}, 12},
+		{"rehashed entry", func(repo *memAuditRepo) {
+			e := repo.entries[3]
+			e.Detail = "covered up"
+			e.Hash = e.ComputeHash()
+		}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo := newChain()
+			tt.tamper(repo)
+			result, err := service.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.BrokenID != tt.broken {
+				t.Errorf("Verify = %+v, want broken at %d", result, tt.broken)
+			}
+		})
+	}
+}
+
+func TestAuditListScopedToOrg(t *testing.T) {
+	repo := &memAuditRepo{}
+	service := NewAuditService(repo)
+	service.Record(&domain.AuditEntry{OrgID: 1, Action: "admin:POST /api/admin/users", Detail: "=HYPERLINK(\"http://evil\")"})
+	service.Record(&domain.AuditEntry{OrgID: 2, Action: "admin:POST /api/admin/users"})
+
+	orgAdmin := &domain.Principal{Kind: domain.PrincipalUser, Role: domain.RoleAdmin, OrgID: 1}
+	entries, total, err := service.List(orgAdmin, domain.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || entries[0].OrgID != 1 {
+		t.Errorf("org admin sees %d entries, want only org 1", total)
+	}
+	if _, total, _ := service.List(&domain.Principal{Kind: domain.PrincipalUser, PlatformAdmin: true}, domain.AuditFilter{}); total != 2 {
+		t.Errorf("platform admin sees %d entries, want 2", total)
+	}
+
+	// 导出时以公式开头的内容被转义
+	data, err := service.ExportCSV(orgAdmin, domain.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `'=HYPERLINK`) {
+		t.Errorf("exported detail is not escaped: %s", data)
+	}
+}
@@ -1,6 +1,14 @@
 package app
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/MoyInGxing/idm/config"
@@ -11,48 +19,330 @@ import (
 
 type SessionRepository interface {
 	Create(session *domain.Session) error
-	FindByToken(token string) (*domain.Session, error)
-	Delete(session *domain.Session) error
+	FindByTokenHash(tokenHash string) (*domain.Session, error)
+	Rotate(id uint, at time.Time, next *domain.Session) (bool, error)
+	RevokeFamily(familyID string, at time.Time) error
+	RevokeUser(userID uint, at time.Time) error
+	FindActiveFamily(familyID string, now time.Time) (*domain.Session, error)
+	UpdateFamilyOrg(familyID string, orgID uint) error
+	DeleteExpired(before time.Time) error
+}
+
+// TokenPair 登录或刷新后签发的令牌。访问令牌为短期 JWT，刷新令牌为不透明随机串，仅以摘要形式保存
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresIn        int64     `json:"expires_in"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
 }
 
 type AuthService struct {
 	userRepo    UserRepository
 	sessionRepo SessionRepository
+	orgRepo     OrganizationRepository
+	keyRepo     APIKeyRepository
+	throttler   *LoginThrottler
+	audit       *AuditService
 	cfg         *config.Config
 }
 
-func NewAuthService(userRepo UserRepository, sessionRepo SessionRepository, cfg *config.Config) *AuthService {
-	return &AuthService{userRepo: userRepo, sessionRepo: sessionRepo, cfg: cfg}
+func NewAuthService(userRepo UserRepository, sessionRepo SessionRepository, orgRepo OrganizationRepository, keyRepo APIKeyRepository, throttler *LoginThrottler, audit *AuditService, cfg *config.Config) *AuthService {
+	return &AuthService{userRepo: userRepo, sessionRepo: sessionRepo, orgRepo: orgRepo, keyRepo: keyRepo, throttler: throttler, audit: audit, cfg: cfg}
 }
 
-func (s *AuthService) Login(username, password string) (string, *domain.User, error) {
-	user, err := s.userRepo.FindByUsername(username)
+var (
+	dummyHashOnce sync.Once
+	dummyUser     domain.User
+)
+
+// compareDummyPassword 用户不存在时同样执行一次 bcrypt 比较，使响应时间与用户存在时一致
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		if err := dummyUser.SetPassword("dummy-password-for-timing"); err != nil {
+			log.Printf("生成占位密码哈希失败: %v", err)
+		}
+	})
+	_ = dummyUser.ComparePassword(password)
+}
+
+// Authenticate 校验用户名和密码，不创建会话，是否需要两步验证由调用方决定。
+// 账号或 IP 处于退避、锁定期时返回 *ThrottledError；用户不存在与密码错误返回相同的错误，耗时也相同。
+func (s *AuthService) Authenticate(username, password, ip string) (*domain.User, error) {
+	wait, err := s.throttler.Check(username, ip)
 	if err != nil {
-		return "", nil, domain.ErrInvalidCredentials
+		return nil, err
+	}
+	if wait > 0 {
+		s.recordAuthEvent(domain.AuditLoginBlocked, 0, username, ip, domain.AuditDenied, fmt.Sprintf("retry_after=%s", wait.Round(time.Second)))
+		return nil, &ThrottledError{RetryAfter: wait}
 	}
 
+	user, err := s.userRepo.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		compareDummyPassword(password)
+		return nil, s.loginFailed(username, ip)
+	}
 	if err := user.ComparePassword(password); err != nil {
-		return "", nil, domain.ErrInvalidCredentials
+		return nil, s.loginFailed(username, ip)
+	}
+	if user.IsDisabled() {
+		s.recordAuthEvent(domain.AuditLoginDisabled, user.ID, username, ip, domain.AuditDenied, "")
+		return nil, domain.ErrAccountDisabled
 	}
 
-	// Generate JWT token
-	token, err := s.GenerateToken(user.ID, user.Role)
+	if err := s.throttler.RecordSuccess(username); err != nil {
+		log.Printf("清除登录失败计数失败: %v", err)
+	}
+	return user, nil
+}
+
+// loginFailed 记录失败并返回统一的凭据错误
+func (s *AuthService) loginFailed(username, ip string) error {
+	locked, err := s.throttler.RecordFailure(username, ip)
 	if err != nil {
-		return "", nil, err
+		return err
+	}
+	s.recordAuthEvent(domain.AuditLoginFailed, 0, username, ip, domain.AuditFailure, "")
+	if locked {
+		s.recordAuthEvent(domain.AuditAccountLocked, 0, username, ip, domain.AuditFailure, fmt.Sprintf("duration=%s", s.throttler.policy.LockoutDuration))
 	}
+	return domain.ErrInvalidCredentials
+}
 
-	// Store session (optional, depending on your SSO strategy)
-	session := &domain.Session{
-		UserID: user.ID,
-		Token:  token,
-		Expiry: time.Now().Add(s.cfg.SessionExpiry),
+// UnlockUser 管理员解除账号的登录锁定
+func (s *AuthService) UnlockUser(userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return domain.ErrUserNotFound
+	}
+	if err := s.throttler.Unlock(user.Username); err != nil {
+		return err
+	}
+	s.recordAuthEvent(domain.AuditAccountUnlock, user.ID, user.Username, "", domain.AuditSuccess, "")
+	return nil
+}
+
+// Login 为完成全部认证步骤的用户开始会话，并记录最近登录时间和来源地址
+func (s *AuthService) Login(user *domain.User, mfa bool, ip string) (*TokenPair, error) {
+	if user.IsDisabled() {
+		return nil, domain.ErrAccountDisabled
+	}
+	tokens, err := s.StartSession(user, mfa)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.TouchLastLogin(user.ID, time.Now(), ip); err != nil {
+		log.Printf("更新最近登录时间失败: %v", err)
+	}
+	s.recordAuthEvent(domain.AuditLogin, user.ID, user.Username, ip, domain.AuditSuccess, fmt.Sprintf("mfa=%t", mfa))
+	return tokens, nil
+}
+
+// recordAuthEvent 写入安全日志和审计日志。认证事件不属于任何组织，只有平台管理员可以查看
+func (s *AuthService) recordAuthEvent(action string, userID uint, username, ip string, outcome domain.AuditOutcome, detail string) {
+	logSecurityEvent(strings.TrimPrefix(action, "auth."), username, ip, detail)
+	entry := &domain.AuditEntry{
+		ActorName:  username,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   username,
+		IP:         ip,
+		Outcome:    outcome,
+		Detail:     detail,
+	}
+	if userID != 0 {
+		entry.ActorKind = string(domain.PrincipalUser)
+		entry.ActorID = userID
+	}
+	s.audit.Record(entry)
+}
+
+// StartSession 为已通过认证的用户创建新的会话族并签发令牌，mfa 表示本次登录通过了两步验证。
+// 新会话进入用户最早加入的组织。
+func (s *AuthService) StartSession(user *domain.User, mfa bool) (*TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	orgID, err := s.defaultOrgID(user)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(user, familyID, mfa, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 顺带清理过期会话，失败不影响登录
+	if err := s.sessionRepo.DeleteExpired(time.Now()); err != nil {
+		log.Printf("清理过期会话失败: %v", err)
+	}
+	return tokens, nil
+}
+
+// Refresh 使用刷新令牌换取新的令牌对，旧刷新令牌随即失效。
+// 已轮换的刷新令牌被再次使用时视为泄露，吊销整个会话族。
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, *domain.User, error) {
+	session, err := s.sessionRepo.FindByTokenHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil {
+		return nil, nil, domain.ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if session.RevokedAt != nil || !now.Before(session.Expiry) {
+		return nil, nil, domain.ErrSessionRevoked
+	}
+	if session.RotatedAt != nil {
+		return nil, nil, s.revokeReusedFamily(session, now)
+	}
+
+	// 只有确认用户已不存在或被停用时才吊销会话族，数据库暂时不可用时保留会话，由客户端重试
+	user, err := s.userRepo.FindByID(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.IsDisabled() {
+		if revokeErr := s.sessionRepo.RevokeFamily(session.FamilyID, now); revokeErr != nil {
+			log.Printf("吊销会话失败: %v", revokeErr)
+		}
+		return nil, nil, domain.ErrSessionRevoked
+	}
+
+	next, tokens, err := s.newSession(user, session.FamilyID, session.MFA, session.OrgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, err := s.sessionRepo.Rotate(session.ID, now, next)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		// 并发请求已抢先使用了该令牌
+		return nil, nil, s.revokeReusedFamily(session, now)
+	}
+	return tokens, user, nil
+}
+
+// Logout 吊销刷新令牌所属的会话族，返回会话所属的用户
+func (s *AuthService) Logout(refreshToken string) (uint, error) {
+	session, err := s.sessionRepo.FindByTokenHash(hashToken(refreshToken))
+	if err != nil {
+		return 0, err
+	}
+	if session == nil {
+		return 0, domain.ErrInvalidRefreshToken
+	}
+	return session.UserID, s.sessionRepo.RevokeFamily(session.FamilyID, time.Now())
+}
+
+// LogoutSession 吊销指定的会话族
+func (s *AuthService) LogoutSession(familyID string) error {
+	return s.sessionRepo.RevokeFamily(familyID, time.Now())
+}
+
+// LogoutAll 吊销用户在所有设备上的会话
+func (s *AuthService) LogoutAll(userID uint) error {
+	return s.sessionRepo.RevokeUser(userID, time.Now())
+}
+
+// RevokeAPIKeys 吊销用户创建的全部 API 密钥。密钥的权限以创建者创建时的角色为上限，账号停用或角色变化后一并失效
+func (s *AuthService) RevokeAPIKeys(userID uint) error {
+	return s.keyRepo.RevokeByCreator(userID, time.Now())
+}
+
+// CheckSession 确认访问令牌所属的会话族仍然有效，返回会话族当前的刷新令牌记录
+func (s *AuthService) CheckSession(familyID string) (*domain.Session, error) {
+	if familyID == "" {
+		return nil, domain.ErrSessionRevoked
+	}
+	session, err := s.sessionRepo.FindActiveFamily(familyID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, domain.ErrSessionRevoked
+	}
+	return session, nil
+}
+
+// SwitchOrg 切换会话族的组织上下文，调用方负责校验用户是否有权进入该组织
+func (s *AuthService) SwitchOrg(familyID string, orgID uint) error {
+	if _, err := s.CheckSession(familyID); err != nil {
+		return err
+	}
+	return s.sessionRepo.UpdateFamilyOrg(familyID, orgID)
+}
+
+// defaultOrgID 用户最早加入的组织。未加入任何组织的平台管理员进入默认组织，其他用户为 0
+func (s *AuthService) defaultOrgID(user *domain.User) (uint, error) {
+	memberships, err := s.orgRepo.FindMembershipsByUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if len(memberships) > 0 {
+		return memberships[0].OrgID, nil
+	}
+	if user.Role == domain.RoleAdmin {
+		org, err := s.orgRepo.FindBySlug(domain.DefaultOrgSlug)
+		if err != nil || org == nil {
+			return 0, err
+		}
+		return org.ID, nil
+	}
+	return 0, nil
+}
+
+func (s *AuthService) revokeReusedFamily(session *domain.Session, now time.Time) error {
+	log.Printf("检测到刷新令牌重复使用，吊销会话族 %s (用户 %d)", session.FamilyID, session.UserID)
+	if err := s.sessionRepo.RevokeFamily(session.FamilyID, now); err != nil {
+		return err
+	}
+	return domain.ErrRefreshTokenReused
+}
+
+// issueTokens 在会话族中保存新的刷新令牌并签发访问令牌
+func (s *AuthService) issueTokens(user *domain.User, familyID string, mfa bool, orgID uint) (*TokenPair, error) {
+	session, tokens, err := s.newSession(user, familyID, mfa, orgID)
+	if err != nil {
+		return nil, err
 	}
 	if err := s.sessionRepo.Create(session); err != nil {
-		// Log the error, but don't necessarily fail the login
-		println("Error creating session:", err.Error())
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// newSession 生成会话族中新的刷新令牌记录及对应的令牌对，记录由调用方保存
+func (s *AuthService) newSession(user *domain.User, familyID string, mfa bool, orgID uint) (*domain.Session, *TokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	session := &domain.Session{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		Expiry:    time.Now().Add(s.cfg.SessionExpiry),
+		MFA:       mfa,
+		OrgID:     orgID,
+	}
+	accessToken, err := s.GenerateToken(user.ID, user.Username, user.Role, familyID, mfa)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(s.cfg.TokenExpiry / time.Second),
+		RefreshExpiresAt: session.Expiry,
+	}, nil
 }
 
 func (s *AuthService) VerifyToken(tokenString string) (*jwt.Token, error) {
@@ -90,25 +380,61 @@ func (s *AuthService) GetUserRoleFromToken(token *jwt.Token) (domain.Role, error
 	return "", domain.ErrInvalidToken
 }
 
-// GenerateToken 生成JWT token
-func (s *AuthService) GenerateToken(userID uint, role domain.Role) (string, error) {
+// GetSessionIDFromToken 获取访问令牌所属的会话族ID
+func (s *AuthService) GetSessionIDFromToken(token *jwt.Token) (string, error) {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		sessionID, ok := claims["sid"].(string)
+		if !ok {
+			return "", domain.ErrInvalidTokenClaims
+		}
+		return sessionID, nil
+	}
+	return "", domain.ErrInvalidToken
+}
+
+// GetMFAFromToken 访问令牌所属的会话是否通过了两步验证
+func (s *AuthService) GetMFAFromToken(token *jwt.Token) bool {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		mfa, _ := claims["mfa"].(bool)
+		return mfa
+	}
+	return false
+}
+
+// GetUsernameFromToken 获取签发访问令牌时的用户名，旧令牌中没有该字段时返回空串
+func (s *AuthService) GetUsernameFromToken(token *jwt.Token) string {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		username, _ := claims["username"].(string)
+		return username
+	}
+	return ""
+}
+
+// GenerateToken 生成JWT访问令牌，sid 指向签发它的会话族，username 用于审计日志记录操作者
+func (s *AuthService) GenerateToken(userID uint, username string, role domain.Role, sessionID string, mfa bool) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"exp":     time.Now().Add(s.cfg.TokenExpiry).Unix(),
+		"user_id":  userID,
+		"username": username,
+		"role":     role,
+		"sid":      sessionID,
+		"mfa":      mfa,
+		"exp":      time.Now().Add(s.cfg.TokenExpiry).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err := token.SignedString([]byte(s.cfg.JWTSignatureKey))
 	return signedToken, err
 }
 
-// Single Sign-On (SSO) Verification (Illustrative - depends on your SSO implementation)
-func (s *AuthService) VerifySSOToken(ssoToken string) (uint, error) {
-	// In a real SSO scenario, you would interact with the SSO provider
-	// to validate the ssoToken and retrieve the user's identity.
-	// For this example, we'll just simulate it.
-	if ssoToken == "valid_sso_token_for_user_123" {
-		return 123, nil // Simulate successful SSO authentication for user ID 123
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return 0, domain.ErrInvalidSSOToken
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 刷新令牌只保存 SHA-256 摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
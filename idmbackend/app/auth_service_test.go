@@ -0,0 +1,428 @@
+package app
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/config"
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memUserRepo struct {
+	mu     sync.Mutex
+	nextID uint
+	users  map[uint]*domain.User
+	orgs   *memOrgRepo
+	// findErr 不为 nil 时按ID查找返回该错误，模拟数据库暂时不可用
+	findErr error
+}
+
+func newMemUserRepo() *memUserRepo {
+	return &memUserRepo{users: make(map[uint]*domain.User)}
+}
+
+func (r *memUserRepo) Create(user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Username == user.Username {
+			return domain.ErrUserAlreadyExists
+		}
+	}
+	r.nextID++
+	user.ID = r.nextID
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *memUserRepo) CreateWithMembership(user *domain.User, membership *domain.Membership) error {
+	if err := r.Create(user); err != nil {
+		return err
+	}
+	if membership == nil {
+		return nil
+	}
+	membership.UserID = user.ID
+	return r.orgs.SaveMembership(membership)
+}
+
+func (r *memUserRepo) find(match func(*domain.User) bool) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if match(u) {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memUserRepo) FindByUsername(username string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Username == username })
+}
+
+func (r *memUserRepo) FindByID(id uint) (*domain.User, error) {
+	r.mu.Lock()
+	err := r.findErr
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return r.find(func(u *domain.User) bool { return u.ID == id })
+}
+
+func (r *memUserRepo) FindByEmail(email string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Email == email })
+}
+
+func (r *memUserRepo) update(id uint, apply func(*domain.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	apply(u)
+	return nil
+}
+
+func (r *memUserRepo) UpdateRole(userID string, role domain.Role) error {
+	id, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return r.update(uint(id), func(u *domain.User) { u.Role = role })
+}
+
+func (r *memUserRepo) count(match func(*domain.User) bool) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, u := range r.users {
+		if match(u) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *memUserRepo) CountByRole(role domain.Role) (int64, error) {
+	return r.count(func(u *domain.User) bool { return u.Role == role }), nil
+}
+
+func (r *memUserRepo) CountActiveByRole(role domain.Role) (int64, error) {
+	return r.count(func(u *domain.User) bool { return u.Role == role && !u.IsDisabled() }), nil
+}
+
+func (r *memUserRepo) UpdatePassword(user *domain.User) error {
+	return r.update(user.ID, func(u *domain.User) { u.Password = user.Password })
+}
+
+func (r *memUserRepo) UpdateProfile(user *domain.User) error {
+	return r.update(user.ID, func(u *domain.User) { *u = *user })
+}
+
+func (r *memUserRepo) SetDisabled(id uint, at *time.Time) error {
+	return r.update(id, func(u *domain.User) { u.DisabledAt = at })
+}
+
+func (r *memUserRepo) TouchLastLogin(id uint, at time.Time, ip string) error {
+	return r.update(id, func(u *domain.User) { u.LastLoginAt, u.LastLoginIP = &at, ip })
+}
+
+type memSessionRepo struct {
+	mu       sync.Mutex
+	nextID   uint
+	sessions []*domain.Session
+}
+
+func (r *memSessionRepo) Create(session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	session.ID = r.nextID
+	copied := *session
+	r.sessions = append(r.sessions, &copied)
+	return nil
+}
+
+func (r *memSessionRepo) FindByTokenHash(tokenHash string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.TokenHash == tokenHash {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memSessionRepo) Rotate(id uint, at time.Time, next *domain.Session) (bool, error) {
+	r.mu.Lock()
+	for _, s := range r.sessions {
+		if s.ID == id && s.RotatedAt == nil && s.RevokedAt == nil {
+			s.RotatedAt = &at
+			r.mu.Unlock()
+			return true, r.Create(next)
+		}
+	}
+	r.mu.Unlock()
+	return false, nil
+}
+
+func (r *memSessionRepo) revoke(match func(*domain.Session) bool, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.RevokedAt == nil && match(s) {
+			s.RevokedAt = &at
+		}
+	}
+}
+
+func (r *memSessionRepo) RevokeFamily(familyID string, at time.Time) error {
+	r.revoke(func(s *domain.Session) bool { return s.FamilyID == familyID }, at)
+	return nil
+}
+
+func (r *memSessionRepo) RevokeUser(userID uint, at time.Time) error {
+	r.revoke(func(s *domain.Session) bool { return s.UserID == userID }, at)
+	return nil
+}
+
+func (r *memSessionRepo) FindActiveFamily(familyID string, now time.Time) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.FamilyID == familyID && s.IsUsable(now) {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memSessionRepo) UpdateFamilyOrg(familyID string, orgID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.FamilyID == familyID {
+			s.OrgID = orgID
+		}
+	}
+	return nil
+}
+
+func (r *memSessionRepo) DeleteExpired(before time.Time) error {
+	return nil
+}
+
+// active 用户未被吊销的会话数
+func (r *memSessionRepo) active(userID uint) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// testEnv 由内存仓储组装的认证相关服务
+type testEnv struct {
+	users    *memUserRepo
+	sessions *memSessionRepo
+	orgs     *memOrgRepo
+	keys     *memAPIKeyRepo
+	roleRepo *memRoleRepo
+	auth     *AuthService
+	roles    *RoleService
+	orgSvc   *OrgService
+	mfaRepo  *memMFARepo
+	mfa      *MFAService
+	clock    *fakeClock
+}
+
+func newTestEnv() *testEnv {
+	env := &testEnv{
+		users:    newMemUserRepo(),
+		sessions: &memSessionRepo{},
+		orgs:     newMemOrgRepo(),
+		keys:     &memAPIKeyRepo{},
+		roleRepo: newMemRoleRepo(),
+		mfaRepo:  newMemMFARepo(),
+		clock:    newFakeClock(),
+	}
+	env.users.orgs = env.orgs
+	env.orgs.users = env.users
+	cfg := &config.Config{
+		JWTSignatureKey: "test-signature-key",
+		TokenExpiry:     15 * time.Minute,
+		SessionExpiry:   24 * time.Hour,
+	}
+	throttler := NewLoginThrottler(newMemThrottleRepo(), SystemClock, LoginThrottlePolicy{})
+	env.auth = NewAuthService(env.users, env.sessions, env.orgs, env.keys, throttler, NewAuditService(&memAuditRepo{}), cfg)
+	env.roles = NewRoleService(env.roleRepo, env.users, env.orgs, env.auth)
+	env.orgSvc = NewOrgService(env.orgs, env.users, env.roles, env.auth)
+	env.mfa = NewMFAService(env.mfaRepo, env.users, env.auth, env.clock, "", nil)
+	return env
+}
+
+func TestRefreshKeepsFamilyOnLookupError(t *testing.T) {
+	env := newTestEnv()
+	user := &domain.User{Username: "quinn", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := env.auth.StartSession(user, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outage := errors.New("connection refused")
+	env.users.findErr = outage
+	if _, _, err := env.auth.Refresh(tokens.RefreshToken); !errors.Is(err, outage) {
+		t.Fatalf("Refresh during outage: err = %v, want %v", err, outage)
+	}
+	if n := env.sessions.active(user.ID); n != 1 {
+		t.Fatalf("active sessions after outage = %d, want 1", n)
+	}
+
+	env.users.findErr = nil
+	rotated, _, err := env.auth.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh after outage: %v", err)
+	}
+
+	// 确认用户已停用时才吊销会话族
+	disabledAt := time.Now()
+	if err := env.users.SetDisabled(user.ID, &disabledAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := env.auth.Refresh(rotated.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Fatalf("Refresh for disabled user: err = %v, want ErrSessionRevoked", err)
+	}
+	if n := env.sessions.active(user.ID); n != 0 {
+		t.Errorf("active sessions after disable = %d, want 0", n)
+	}
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	env := newTestEnv()
+	user := &domain.User{Username: "sam", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	first, err := env.auth.StartSession(user, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, refreshed, err := env.auth.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.ID != user.ID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("Refresh returned user %d and an unrotated token", refreshed.ID)
+	}
+	// 轮换后的会话保留同一个会话族和两步验证状态
+	token, err := env.auth.VerifyToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	familyID, _ := env.auth.GetSessionIDFromToken(token)
+	if !env.auth.GetMFAFromToken(token) {
+		t.Error("rotated access token lost the mfa claim")
+	}
+	if _, err := env.auth.CheckSession(familyID); err != nil {
+		t.Fatalf("CheckSession after rotation: %v", err)
+	}
+
+	// 旧令牌被重复使用时吊销整个会话族，包括刚签发的新令牌
+	if _, _, err := env.auth.Refresh(first.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := env.auth.Refresh(second.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("token issued before reuse: err = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := env.auth.CheckSession(familyID); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("CheckSession after reuse: err = %v, want ErrSessionRevoked", err)
+	}
+	if _, _, err := env.auth.Refresh("not-a-token"); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestConcurrentRefreshRevokesFamily(t *testing.T) {
+	env := newTestEnv()
+	user := &domain.User{Username: "tess", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := env.auth.StartSession(user, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = env.auth.Refresh(tokens.RefreshToken)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded > 1 {
+		t.Fatalf("%d concurrent refreshes succeeded, want at most 1", succeeded)
+	}
+	// 并发使用同一刷新令牌等同于重复使用，会话族被吊销
+	if n := env.sessions.active(user.ID); n != 0 {
+		t.Errorf("active sessions = %d, want 0", n)
+	}
+}
+
+func TestLogoutRevokesOnlyThatFamily(t *testing.T) {
+	env := newTestEnv()
+	user := &domain.User{Username: "uma", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	laptop, _ := env.auth.StartSession(user, false)
+	phone, _ := env.auth.StartSession(user, false)
+
+	userID, err := env.auth.Logout(laptop.RefreshToken)
+	if err != nil || userID != user.ID {
+		t.Fatalf("Logout = %d, %v", userID, err)
+	}
+	if _, _, err := env.auth.Refresh(laptop.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("logged out session: err = %v, want ErrSessionRevoked", err)
+	}
+	if _, _, err := env.auth.Refresh(phone.RefreshToken); err != nil {
+		t.Errorf("other device: %v", err)
+	}
+
+	if err := env.auth.LogoutAll(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.sessions.active(user.ID); n != 0 {
+		t.Errorf("active sessions after LogoutAll = %d, want 0", n)
+	}
+}
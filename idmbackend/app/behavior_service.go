@@ -0,0 +1,452 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// BehaviorRepository 所有查询都限定在 scope 所在的组织内
+type BehaviorRepository interface {
+	BatchCreate(scope domain.TenantScope, events []*domain.BehaviorEvent) error
+	Find(scope domain.TenantScope, filter domain.BehaviorFilter) ([]*domain.BehaviorEvent, int64, error)
+	Buckets(scope domain.TenantScope, filter domain.BehaviorFilter, interval time.Duration) ([]domain.BehaviorBucket, error)
+}
+
+// AlertRepository 所有查询都限定在 scope 所在的组织内
+type AlertRepository interface {
+	Create(scope domain.TenantScope, alert *domain.Alert) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Alert, error)
+	FindOpen(scope domain.TenantScope, areaID string, kind domain.AlertKind, since time.Time) (*domain.Alert, error)
+	Find(scope domain.TenantScope, filter domain.AlertFilter) ([]*domain.Alert, int64, error)
+	RecordEvent(scope domain.TenantScope, id uint, at time.Time) error
+	Acknowledge(scope domain.TenantScope, alert *domain.Alert) (bool, error)
+}
+
+const (
+	// maxBehaviorsPerRequest 单次上报的行为事件上限
+	maxBehaviorsPerRequest = 1000
+	// maxBehaviorBuckets 统计和关联分析最多返回的时间窗口数
+	maxBehaviorBuckets = 1000
+	// minBehaviorInterval 统计窗口的最小长度
+	minBehaviorInterval = time.Minute
+	// defaultBehaviorRange 未指定起止时间时统计最近一天
+	defaultBehaviorRange = 24 * time.Hour
+)
+
+// BehaviorAlertPolicy 缺氧告警的判定参数，零值字段使用默认值
+type BehaviorAlertPolicy struct {
+	DOThreshold   float64       // 溶解氧低于该值（mg/L）时视为缺氧，默认 3
+	MinConfidence float64       // 浮头事件的置信度不低于该值才参与判定，默认 0.6
+	Window        time.Duration // 只使用事件前后该时长内最近的水质记录，默认 2h
+	Cooldown      time.Duration // 同一区域未确认的告警在该时长内有新事件时累加到已有告警，默认 1h
+}
+
+// BehaviorInput 上报的一次行为，Type 同时接受英文标识和前端使用的中文名称
+type BehaviorInput struct {
+	AreaID     string     `json:"area_id"`
+	CameraID   string     `json:"camera_id"`
+	VideoID    *uint      `json:"video_id"`
+	Timestamp  *float64   `json:"timestamp"` // 距视频开始的秒数
+	Type       string     `json:"type"`
+	Confidence float64    `json:"confidence"`
+	FishCount  int        `json:"fish_count"`
+	OccurredAt *time.Time `json:"occurred_at"` // 为空时使用上报时间
+	Duration   float64    `json:"duration"`
+	Source     string     `json:"source"`
+}
+
+// BehaviorIngestResult 上报结果，Alerts 为本次上报新建或累加的告警
+type BehaviorIngestResult struct {
+	Events []*domain.BehaviorEvent `json:"events"`
+	Alerts []*domain.Alert         `json:"alerts"`
+}
+
+// BehaviorService 记录摄像头和视频分析得到的鱼类行为，按时间窗口统计并与同一区域的水质数据关联。
+// 浮头行为出现时若附近的水质记录溶解氧偏低，生成缺氧告警
+type BehaviorService struct {
+	repo             BehaviorRepository
+	alertRepo        AlertRepository
+	waterQualityRepo WaterQualityRepository
+	videoService     *VideoService
+	policy           BehaviorAlertPolicy
+}
+
+func NewBehaviorService(repo BehaviorRepository, alertRepo AlertRepository, waterQualityRepo WaterQualityRepository, videoService *VideoService, policy BehaviorAlertPolicy) *BehaviorService {
+	if policy.DOThreshold <= 0 {
+		policy.DOThreshold = 3
+	}
+	if policy.MinConfidence <= 0 {
+		policy.MinConfidence = 0.6
+	}
+	if policy.Window <= 0 {
+		policy.Window = 2 * time.Hour
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = time.Hour
+	}
+	return &BehaviorService{
+		repo:             repo,
+		alertRepo:        alertRepo,
+		waterQualityRepo: waterQualityRepo,
+		videoService:     videoService,
+		policy:           policy,
+	}
+}
+
+// Ingest 批量保存行为事件，随后检查其中的浮头事件是否需要告警
+func (s *BehaviorService) Ingest(scope domain.TenantScope, userID uint, inputs []BehaviorInput) (*BehaviorIngestResult, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: no events provided", domain.ErrInvalidInput)
+	}
+	if len(inputs) > maxBehaviorsPerRequest {
+		return nil, fmt.Errorf("%w: at most %d events per request", domain.ErrInvalidInput, maxBehaviorsPerRequest)
+	}
+
+	now := time.Now()
+	videos := make(map[uint]bool)
+	events := make([]*domain.BehaviorEvent, 0, len(inputs))
+	for i, input := range inputs {
+		event, err := newBehaviorEvent(input, userID, now)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		if event.VideoID != nil && !videos[*event.VideoID] {
+			if _, err := s.videoService.GetVideo(scope, *event.VideoID); err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			videos[*event.VideoID] = true
+		}
+		events = append(events, event)
+	}
+	if err := s.repo.BatchCreate(scope, events); err != nil {
+		return nil, err
+	}
+
+	alerts, err := s.checkHypoxia(scope, events)
+	if err != nil {
+		return nil, err
+	}
+	return &BehaviorIngestResult{Events: events, Alerts: alerts}, nil
+}
+
+// ListEvents 分页查询行为事件
+func (s *BehaviorService) ListEvents(scope domain.TenantScope, filter domain.BehaviorFilter) ([]*domain.BehaviorEvent, int64, error) {
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		return nil, 0, fmt.Errorf("%w: from must not be after to", domain.ErrInvalidInput)
+	}
+	return s.repo.Find(scope, filter)
+}
+
+// Summary 按 interval 分段统计每种行为的次数，未指定起止时间时统计最近一天
+func (s *BehaviorService) Summary(scope domain.TenantScope, filter domain.BehaviorFilter, interval time.Duration) ([]domain.BehaviorBucket, error) {
+	interval = interval.Truncate(time.Second)
+	from, to, err := behaviorRange(filter.From, filter.To, interval)
+	if err != nil {
+		return nil, err
+	}
+	filter.From, filter.To = &from, &to
+	return s.repo.Buckets(scope, filter, interval)
+}
+
+// Correlation 将区域内每个时间窗口的行为次数与该窗口内水质记录的均值对齐，窗口按 interval 对齐到整点
+func (s *BehaviorService) Correlation(scope domain.TenantScope, areaID string, from, to *time.Time, interval time.Duration) ([]domain.BehaviorCorrelationPoint, error) {
+	if areaID == "" {
+		return nil, fmt.Errorf("%w: area_id is required", domain.ErrInvalidInput)
+	}
+	interval = interval.Truncate(time.Second)
+	start, end, err := behaviorRange(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+	// 与数据库按 Unix 时间分段的方式保持一致
+	seconds := int64(interval / time.Second)
+	start = time.Unix(start.Unix()/seconds*seconds, 0).UTC()
+
+	buckets, err := s.repo.Buckets(scope, domain.BehaviorFilter{AreaID: areaID, From: &start, To: &end}, interval)
+	if err != nil {
+		return nil, err
+	}
+	readings, err := s.waterQualityRepo.FindByAreaIDBetween(scope, areaID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]domain.BehaviorCorrelationPoint, 0, int(end.Sub(start)/interval)+1)
+	for t := start; t.Before(end); t = t.Add(interval) {
+		points = append(points, domain.BehaviorCorrelationPoint{
+			Start:     t,
+			End:       t.Add(interval),
+			Behaviors: make(map[domain.BehaviorType]int64),
+		})
+	}
+	index := func(t time.Time) int {
+		i := int(t.Sub(start) / interval)
+		if t.Before(start) || i >= len(points) {
+			return -1
+		}
+		return i
+	}
+	for _, b := range buckets {
+		if i := index(b.Start); i >= 0 {
+			points[i].Behaviors[b.Type] += b.Count
+		}
+	}
+
+	type sums struct{ do, temp, ph mean }
+	totals := make([]sums, len(points))
+	for _, r := range readings {
+		if r.RecordTime == nil {
+			continue
+		}
+		i := index(*r.RecordTime)
+		if i < 0 {
+			continue
+		}
+		points[i].Readings++
+		totals[i].do.add(r.DissolvedOxygen)
+		totals[i].temp.add(r.Temperature)
+		totals[i].ph.add(r.PHValue)
+	}
+	for i := range points {
+		points[i].DissolvedOxygen = totals[i].do.value()
+		points[i].Temperature = totals[i].temp.value()
+		points[i].PHValue = totals[i].ph.value()
+	}
+	return points, nil
+}
+
+// ListAlerts 分页查询告警
+func (s *BehaviorService) ListAlerts(scope domain.TenantScope, filter domain.AlertFilter) ([]*domain.Alert, int64, error) {
+	return s.alertRepo.Find(scope, filter)
+}
+
+func (s *BehaviorService) GetAlert(scope domain.TenantScope, id uint) (*domain.Alert, error) {
+	alert, err := s.alertRepo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, domain.ErrAlertNotFound
+	}
+	return alert, nil
+}
+
+// AcknowledgeAlert 值守人员确认告警，之后同一区域的新事件会生成新的告警
+func (s *BehaviorService) AcknowledgeAlert(scope domain.TenantScope, userID, id uint, note string) (*domain.Alert, error) {
+	alert, err := s.GetAlert(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status != domain.AlertOpen {
+		return nil, domain.ErrAlertAcknowledged
+	}
+
+	now := time.Now()
+	alert.Status = domain.AlertAcknowledged
+	alert.AcknowledgedBy = userID
+	alert.AcknowledgedAt = &now
+	alert.Note = truncateRunes(strings.TrimSpace(note), 255)
+	ok, err := s.alertRepo.Acknowledge(scope, alert)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrAlertAcknowledged
+	}
+	return alert, nil
+}
+
+// checkHypoxia 按时间顺序检查置信度足够的浮头事件：事件前后窗口内最近一条带溶解氧的水质记录低于阈值时告警
+func (s *BehaviorService) checkHypoxia(scope domain.TenantScope, events []*domain.BehaviorEvent) ([]*domain.Alert, error) {
+	byArea := make(map[string][]*domain.BehaviorEvent)
+	for _, e := range events {
+		if e.Type == domain.BehaviorSurfaceGasping && e.AreaID != "" && e.Confidence >= s.policy.MinConfidence {
+			byArea[e.AreaID] = append(byArea[e.AreaID], e)
+		}
+	}
+
+	var alerts []*domain.Alert
+	touched := make(map[uint]int) // 告警ID -> 在 alerts 中的位置
+	for _, areaID := range sortedKeys(byArea) {
+		gasping := byArea[areaID]
+		sort.Slice(gasping, func(i, j int) bool { return gasping[i].OccurredAt.Before(gasping[j].OccurredAt) })
+
+		from := gasping[0].OccurredAt.Add(-s.policy.Window)
+		to := gasping[len(gasping)-1].OccurredAt.Add(s.policy.Window + time.Second)
+		readings, err := s.waterQualityRepo.FindByAreaIDBetween(scope, areaID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range gasping {
+			reading := nearestDissolvedOxygen(readings, event.OccurredAt, s.policy.Window)
+			if reading == nil || *reading.DissolvedOxygen >= s.policy.DOThreshold {
+				continue
+			}
+			alert, err := s.raiseHypoxia(scope, event, reading)
+			if err != nil {
+				return nil, err
+			}
+			// 累加时返回的是重新查询的告警，替换之前的副本以返回最新的事件计数
+			if i, ok := touched[alert.ID]; ok {
+				alerts[i] = alert
+				continue
+			}
+			touched[alert.ID] = len(alerts)
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// raiseHypoxia 区域内冷却时间内有未确认的缺氧告警时累加事件，否则新建告警
+func (s *BehaviorService) raiseHypoxia(scope domain.TenantScope, event *domain.BehaviorEvent, reading *domain.WaterQuality) (*domain.Alert, error) {
+	existing, err := s.alertRepo.FindOpen(scope, event.AreaID, domain.AlertHypoxia, event.OccurredAt.Add(-s.policy.Cooldown))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := s.alertRepo.RecordEvent(scope, existing.ID, event.OccurredAt); err != nil {
+			return nil, err
+		}
+		existing.EventCount++
+		if event.OccurredAt.After(existing.LastEventAt) {
+			existing.LastEventAt = event.OccurredAt
+		}
+		return existing, nil
+	}
+
+	do := *reading.DissolvedOxygen
+	alert := &domain.Alert{
+		AreaID:          event.AreaID,
+		CameraID:        event.CameraID,
+		Kind:            domain.AlertHypoxia,
+		Status:          domain.AlertOpen,
+		Message:         fmt.Sprintf("区域 %s 出现浮头，溶解氧 %.2f mg/L 低于 %.2f mg/L，疑似缺氧", event.AreaID, do, s.policy.DOThreshold),
+		EventID:         event.ID,
+		EventCount:      1,
+		LastEventAt:     event.OccurredAt,
+		WaterQualityID:  reading.RecordID,
+		DissolvedOxygen: &do,
+	}
+	if err := s.alertRepo.Create(scope, alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// nearestDissolvedOxygen 在 at 前后 window 内查找时间最近且有溶解氧数据的水质记录
+func nearestDissolvedOxygen(readings []*domain.WaterQuality, at time.Time, window time.Duration) *domain.WaterQuality {
+	var nearest *domain.WaterQuality
+	var best time.Duration
+	for _, r := range readings {
+		if r.RecordTime == nil || r.DissolvedOxygen == nil {
+			continue
+		}
+		d := r.RecordTime.Sub(at)
+		if d < 0 {
+			d = -d
+		}
+		if d <= window && (nearest == nil || d < best) {
+			nearest, best = r, d
+		}
+	}
+	return nearest
+}
+
+func newBehaviorEvent(input BehaviorInput, userID uint, now time.Time) (*domain.BehaviorEvent, error) {
+	behavior, ok := domain.ParseBehaviorType(input.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown behavior type %q", domain.ErrInvalidInput, input.Type)
+	}
+	areaID := strings.TrimSpace(input.AreaID)
+	cameraID := strings.TrimSpace(input.CameraID)
+	if areaID == "" && cameraID == "" {
+		return nil, fmt.Errorf("%w: area_id or camera_id is required", domain.ErrInvalidInput)
+	}
+	if len(areaID) > 64 || len(cameraID) > 64 {
+		return nil, fmt.Errorf("%w: area_id and camera_id must be at most 64 characters", domain.ErrInvalidInput)
+	}
+	if !validNonNegative(input.Confidence) || input.Confidence > 1 {
+		return nil, fmt.Errorf("%w: confidence must be between 0 and 1", domain.ErrInvalidInput)
+	}
+	if input.FishCount < 0 || !validNonNegative(input.Duration) {
+		return nil, fmt.Errorf("%w: fish_count and duration must not be negative", domain.ErrInvalidInput)
+	}
+	if input.Timestamp != nil && (input.VideoID == nil || !validNonNegative(*input.Timestamp)) {
+		return nil, fmt.Errorf("%w: timestamp requires video_id and must not be negative", domain.ErrInvalidInput)
+	}
+
+	occurredAt := now
+	if input.OccurredAt != nil {
+		occurredAt = *input.OccurredAt
+		if occurredAt.IsZero() || occurredAt.After(now.Add(time.Minute)) {
+			return nil, fmt.Errorf("%w: occurred_at must not be in the future", domain.ErrInvalidInput)
+		}
+	}
+	source := strings.TrimSpace(input.Source)
+	if source == "" {
+		source = "manual"
+	}
+
+	return &domain.BehaviorEvent{
+		AreaID:     areaID,
+		CameraID:   cameraID,
+		VideoID:    input.VideoID,
+		Timestamp:  input.Timestamp,
+		Type:       behavior,
+		Confidence: input.Confidence,
+		FishCount:  input.FishCount,
+		OccurredAt: occurredAt,
+		Duration:   input.Duration,
+		Source:     truncateRunes(source, 32),
+		ReportedBy: userID,
+	}, nil
+}
+
+// behaviorRange 校验统计区间和窗口长度，未指定时统计到当前时间为止的最近一天
+func behaviorRange(from, to *time.Time, interval time.Duration) (time.Time, time.Time, error) {
+	if interval < minBehaviorInterval {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: interval must be at least %s", domain.ErrInvalidInput, minBehaviorInterval)
+	}
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-defaultBehaviorRange)
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be before to", domain.ErrInvalidInput)
+	}
+	if end.Sub(start)/interval >= maxBehaviorBuckets {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: at most %d intervals per query", domain.ErrInvalidInput, maxBehaviorBuckets)
+	}
+	return start, end, nil
+}
+
+// mean 忽略缺失值的平均数
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v *float64) {
+	if v != nil {
+		m.sum += *v
+		m.n++
+	}
+}
+
+func (m *mean) value() *float64 {
+	if m.n == 0 {
+		return nil
+	}
+	v := m.sum / float64(m.n)
+	return &v
+}
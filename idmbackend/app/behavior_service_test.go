@@ -0,0 +1,476 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memBehaviorRepo 与数据库实现一样按 scope.OrgID 隔离行为事件，按 Unix 时间分段统计
+type memBehaviorRepo struct {
+	mu     sync.Mutex
+	events []*domain.BehaviorEvent
+}
+
+func (r *memBehaviorRepo) BatchCreate(scope domain.TenantScope, events []*domain.BehaviorEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range events {
+		e.ID = uint(len(r.events) + 1)
+		e.OrgID = scope.OrgID
+		copied := *e
+		r.events = append(r.events, &copied)
+	}
+	return nil
+}
+
+func (r *memBehaviorRepo) Find(scope domain.TenantScope, filter domain.BehaviorFilter) ([]*domain.BehaviorEvent, int64, error) {
+	found := r.filtered(scope, filter)
+	total := int64(len(found))
+	found = found[min(filter.Offset, len(found)):]
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, total, nil
+}
+
+func (r *memBehaviorRepo) Buckets(scope domain.TenantScope, filter domain.BehaviorFilter, interval time.Duration) ([]domain.BehaviorBucket, error) {
+	seconds := int64(interval / time.Second)
+	type key struct {
+		bucket int64
+		kind   domain.BehaviorType
+	}
+	stats := map[key]*domain.BehaviorBucket{}
+	var keys []key
+	for _, e := range r.filtered(scope, filter) {
+		k := key{e.OccurredAt.Unix() / seconds, e.Type}
+		b, ok := stats[k]
+		if !ok {
+			b = &domain.BehaviorBucket{Start: time.Unix(k.bucket*seconds, 0).UTC(), Type: e.Type}
+			stats[k] = b
+			keys = append(keys, k)
+		}
+		b.AvgConfidence = (b.AvgConfidence*float64(b.Count) + e.Confidence) / float64(b.Count+1)
+		b.Count++
+		b.MaxFishCount = max(b.MaxFishCount, e.FishCount)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		return keys[i].kind < keys[j].kind
+	})
+	buckets := make([]domain.BehaviorBucket, 0, len(keys))
+	for _, k := range keys {
+		buckets = append(buckets, *stats[k])
+	}
+	return buckets, nil
+}
+
+func (r *memBehaviorRepo) filtered(scope domain.TenantScope, filter domain.BehaviorFilter) []*domain.BehaviorEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.BehaviorEvent
+	for _, e := range r.events {
+		if e.OrgID != scope.OrgID || (filter.AreaID != "" && e.AreaID != filter.AreaID) ||
+			(len(filter.AreaIDs) > 0 && !containsString(filter.AreaIDs, e.AreaID)) ||
+			(filter.CameraID != "" && e.CameraID != filter.CameraID) || (filter.Type != "" && e.Type != filter.Type) ||
+			e.Confidence < filter.MinConfidence || (filter.From != nil && e.OccurredAt.Before(*filter.From)) ||
+			(filter.To != nil && !e.OccurredAt.Before(*filter.To)) {
+			continue
+		}
+		copied := *e
+		found = append(found, &copied)
+	}
+	return found
+}
+
+// memAlertRepo 与数据库实现一样按 scope.OrgID 隔离告警
+type memAlertRepo struct {
+	mu     sync.Mutex
+	alerts []*domain.Alert
+}
+
+func (r *memAlertRepo) Create(scope domain.TenantScope, alert *domain.Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alert.ID = uint(len(r.alerts) + 1)
+	alert.OrgID = scope.OrgID
+	copied := *alert
+	r.alerts = append(r.alerts, &copied)
+	return nil
+}
+
+func (r *memAlertRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.alerts {
+		if a.ID == id && a.OrgID == scope.OrgID {
+			copied := *a
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAlertRepo) FindOpen(scope domain.TenantScope, areaID string, kind domain.AlertKind, since time.Time) (*domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *domain.Alert
+	for _, a := range r.alerts {
+		if a.OrgID == scope.OrgID && a.AreaID == areaID && a.Kind == kind && a.Status == domain.AlertOpen &&
+			!a.LastEventAt.Before(since) && (latest == nil || a.LastEventAt.After(latest.LastEventAt)) {
+			latest = a
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	copied := *latest
+	return &copied, nil
+}
+
+func (r *memAlertRepo) Find(scope domain.TenantScope, filter domain.AlertFilter) ([]*domain.Alert, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Alert
+	for i := len(r.alerts) - 1; i >= 0; i-- {
+		a := r.alerts[i]
+		if a.OrgID != scope.OrgID || (filter.AreaID != "" && a.AreaID != filter.AreaID) ||
+			(len(filter.AreaIDs) > 0 && !containsString(filter.AreaIDs, a.AreaID)) ||
+			(filter.Kind != "" && a.Kind != filter.Kind) || (filter.Status != "" && a.Status != filter.Status) {
+			continue
+		}
+		copied := *a
+		found = append(found, &copied)
+	}
+	return found, int64(len(found)), nil
+}
+
+func (r *memAlertRepo) RecordEvent(scope domain.TenantScope, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.alerts {
+		if a.ID == id && a.OrgID == scope.OrgID {
+			a.EventCount++
+			if at.After(a.LastEventAt) {
+				a.LastEventAt = at
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memAlertRepo) Acknowledge(scope domain.TenantScope, alert *domain.Alert) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.alerts {
+		if a.ID == alert.ID && a.OrgID == scope.OrgID && a.Status == domain.AlertOpen {
+			a.Status, a.AcknowledgedBy, a.AcknowledgedAt, a.Note = alert.Status, alert.AcknowledgedBy, alert.AcknowledgedAt, alert.Note
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// memWaterQualityRepo 与数据库实现一样按 scope.OrgID 隔离水质记录
+type memWaterQualityRepo struct {
+	mu       sync.Mutex
+	readings []*domain.WaterQuality
+}
+
+func (r *memWaterQualityRepo) FindAll(scope domain.TenantScope, areaIDs []string) ([]*domain.WaterQuality, error) {
+	return r.filtered(scope, func(w *domain.WaterQuality) bool {
+		return len(areaIDs) == 0 || containsString(areaIDs, w.AreaID)
+	}), nil
+}
+
+func (r *memWaterQualityRepo) FindByRecordID(scope domain.TenantScope, recordID string) (*domain.WaterQuality, error) {
+	found := r.filtered(scope, func(w *domain.WaterQuality) bool { return w.RecordID == recordID })
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found[0], nil
+}
+
+func (r *memWaterQualityRepo) FindByAreaID(scope domain.TenantScope, areaID string) ([]*domain.WaterQuality, error) {
+	return r.filtered(scope, func(w *domain.WaterQuality) bool { return w.AreaID == areaID }), nil
+}
+
+func (r *memWaterQualityRepo) FindByAreaIDWithPagination(scope domain.TenantScope, areaID string, offset, limit int) ([]*domain.WaterQuality, error) {
+	found, _ := r.FindByAreaID(scope, areaID)
+	found = found[min(offset, len(found)):]
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (r *memWaterQualityRepo) Create(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	waterQuality.OrgID = scope.OrgID
+	copied := *waterQuality
+	r.readings = append(r.readings, &copied)
+	return nil
+}
+
+func (r *memWaterQualityRepo) Update(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, w := range r.readings {
+		if w.RecordID == waterQuality.RecordID && w.OrgID == scope.OrgID {
+			copied := *waterQuality
+			r.readings[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memWaterQualityRepo) Delete(scope domain.TenantScope, recordID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.readings[:0]
+	for _, w := range r.readings {
+		if w.RecordID != recordID || w.OrgID != scope.OrgID {
+			kept = append(kept, w)
+		}
+	}
+	r.readings = kept
+	return nil
+}
+
+func (r *memWaterQualityRepo) GetLatestByAreaID(scope domain.TenantScope, areaID string) (*domain.WaterQuality, error) {
+	var latest *domain.WaterQuality
+	for _, w := range r.filtered(scope, func(w *domain.WaterQuality) bool { return w.AreaID == areaID && w.RecordTime != nil }) {
+		if latest == nil || w.RecordTime.After(*latest.RecordTime) {
+			latest = w
+		}
+	}
+	return latest, nil
+}
+
+func (r *memWaterQualityRepo) FindByAreaIDBetween(scope domain.TenantScope, areaID string, from, to time.Time) ([]*domain.WaterQuality, error) {
+	found := r.filtered(scope, func(w *domain.WaterQuality) bool {
+		return w.AreaID == areaID && w.RecordTime != nil && !w.RecordTime.Before(from) && w.RecordTime.Before(to)
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].RecordTime.Before(*found[j].RecordTime) })
+	return found, nil
+}
+
+func (r *memWaterQualityRepo) filtered(scope domain.TenantScope, match func(*domain.WaterQuality) bool) []*domain.WaterQuality {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.WaterQuality
+	for _, w := range r.readings {
+		if w.OrgID == scope.OrgID && match(w) {
+			copied := *w
+			found = append(found, &copied)
+		}
+	}
+	return found
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type behaviorFixture struct {
+	service *BehaviorService
+	water   *memWaterQualityRepo
+	base    time.Time // 整点，位于当前时间之前足够远，事件不会被视为未来时间
+}
+
+func newBehaviorFixture() *behaviorFixture {
+	f := &behaviorFixture{water: &memWaterQualityRepo{}, base: time.Now().UTC().Add(-12 * time.Hour).Truncate(time.Hour)}
+	f.service = NewBehaviorService(&memBehaviorRepo{}, &memAlertRepo{}, f.water, nil, BehaviorAlertPolicy{})
+	return f
+}
+
+func (f *behaviorFixture) at(minutes int) *time.Time {
+	t := f.base.Add(time.Duration(minutes) * time.Minute)
+	return &t
+}
+
+func (f *behaviorFixture) addReading(t *testing.T, recordID, areaID string, minutes int, do float64) {
+	t.Helper()
+	if err := f.water.Create(domain.TenantScope{OrgID: 1}, &domain.WaterQuality{RecordID: recordID, AreaID: areaID, RecordTime: f.at(minutes), DissolvedOxygen: &do}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *behaviorFixture) gasping(areaID string, minutes int, confidence float64) BehaviorInput {
+	return BehaviorInput{AreaID: areaID, Type: "浮头", Confidence: confidence, OccurredAt: f.at(minutes)}
+}
+
+func TestIngestBehaviorValidation(t *testing.T) {
+	f := newBehaviorFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	offset := 12.5
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		input BehaviorInput
+	}{
+		{"unknown type", BehaviorInput{AreaID: "pond-a", Type: "跳跃"}},
+		{"missing area and camera", BehaviorInput{Type: "feeding"}},
+		{"confidence above 1", BehaviorInput{AreaID: "pond-a", Type: "feeding", Confidence: 1.5}},
+		{"negative fish count", BehaviorInput{AreaID: "pond-a", Type: "feeding", FishCount: -1}},
+		{"timestamp without video", BehaviorInput{AreaID: "pond-a", Type: "feeding", Timestamp: &offset}},
+		{"occurred in the future", BehaviorInput{AreaID: "pond-a", Type: "feeding", OccurredAt: &future}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := f.service.Ingest(scope, 5, []BehaviorInput{tt.input}); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("Ingest = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+	if _, err := f.service.Ingest(scope, 5, nil); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("no events: err = %v, want ErrInvalidInput", err)
+	}
+
+	result, err := f.service.Ingest(scope, 5, []BehaviorInput{{CameraID: " cam-1 ", Type: "觅食", Confidence: 0.8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := result.Events[0]
+	if event.Type != domain.BehaviorFeeding || event.CameraID != "cam-1" || event.Source != "manual" || event.ReportedBy != 5 || event.OccurredAt.IsZero() {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestHypoxiaAlert(t *testing.T) {
+	f := newBehaviorFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	f.addReading(t, "wq-1", "pond-a", -30, 2.1)
+	f.addReading(t, "wq-2", "pond-a", 200, 7.5)
+	f.addReading(t, "wq-3", "pond-b", 0, 6.8)
+
+	// 置信度不足的浮头和溶解氧正常区域的浮头不告警，同一区域的多次浮头累加到同一告警
+	result, err := f.service.Ingest(scope, 5, []BehaviorInput{
+		f.gasping("pond-a", 10, 0.9),
+		f.gasping("pond-a", 0, 0.8),
+		f.gasping("pond-a", 5, 0.3),
+		f.gasping("pond-b", 0, 0.9),
+		{AreaID: "pond-a", Type: "feeding", Confidence: 0.9, OccurredAt: f.at(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alerts) != 1 {
+		t.Fatalf("alerts = %+v, want one for pond-a", result.Alerts)
+	}
+	alert := result.Alerts[0]
+	if alert.AreaID != "pond-a" || alert.EventCount != 2 || alert.WaterQualityID != "wq-1" || *alert.DissolvedOxygen != 2.1 || !alert.LastEventAt.Equal(*f.at(10)) {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// 冷却时间内的新事件累加到未确认的告警
+	result, err = f.service.Ingest(scope, 5, []BehaviorInput{f.gasping("pond-a", 40, 0.9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alerts) != 1 || result.Alerts[0].ID != alert.ID || result.Alerts[0].EventCount != 3 {
+		t.Fatalf("alerts = %+v, want the existing alert with 3 events", result.Alerts)
+	}
+
+	acknowledged, err := f.service.AcknowledgeAlert(scope, 9, alert.ID, " 已开启增氧机 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acknowledged.Status != domain.AlertAcknowledged || acknowledged.AcknowledgedBy != 9 || acknowledged.Note != "已开启增氧机" {
+		t.Errorf("acknowledged = %+v", acknowledged)
+	}
+	if _, err := f.service.AcknowledgeAlert(scope, 9, alert.ID, ""); !errors.Is(err, domain.ErrAlertAcknowledged) {
+		t.Errorf("acknowledge twice: err = %v, want ErrAlertAcknowledged", err)
+	}
+	if _, err := f.service.AcknowledgeAlert(domain.TenantScope{OrgID: 2}, 9, alert.ID, ""); !errors.Is(err, domain.ErrAlertNotFound) {
+		t.Errorf("acknowledge from other org: err = %v, want ErrAlertNotFound", err)
+	}
+
+	// 确认后的新事件生成新的告警；附近只有溶解氧正常的记录时不告警
+	result, err = f.service.Ingest(scope, 5, []BehaviorInput{f.gasping("pond-a", 50, 0.9), f.gasping("pond-a", 190, 0.9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alerts) != 1 || result.Alerts[0].ID == alert.ID || result.Alerts[0].EventCount != 1 {
+		t.Errorf("alerts = %+v, want one new alert", result.Alerts)
+	}
+	if _, total, _ := f.service.ListAlerts(scope, domain.AlertFilter{Status: domain.AlertOpen}); total != 1 {
+		t.Errorf("open alerts = %d, want 1", total)
+	}
+}
+
+func TestBehaviorCorrelation(t *testing.T) {
+	f := newBehaviorFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	f.addReading(t, "wq-1", "pond-a", 10, 5)
+	f.addReading(t, "wq-2", "pond-a", 50, 7)
+	f.addReading(t, "wq-3", "pond-b", 20, 1)
+	_, err := f.service.Ingest(scope, 5, []BehaviorInput{
+		{AreaID: "pond-a", Type: "feeding", Confidence: 0.9, OccurredAt: f.at(5)},
+		{AreaID: "pond-a", Type: "feeding", Confidence: 0.7, OccurredAt: f.at(55)},
+		{AreaID: "pond-a", Type: "schooling", Confidence: 0.5, OccurredAt: f.at(130)},
+		{AreaID: "pond-b", Type: "feeding", Confidence: 0.5, OccurredAt: f.at(10)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := f.service.Correlation(scope, "pond-a", f.at(0), f.at(180), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("points = %d, want 3", len(points))
+	}
+	first := points[0]
+	if first.Behaviors[domain.BehaviorFeeding] != 2 || first.Readings != 2 || *first.DissolvedOxygen != 6 || first.Temperature != nil {
+		t.Errorf("first hour = %+v", first)
+	}
+	if points[1].Readings != 0 || points[1].DissolvedOxygen != nil || len(points[1].Behaviors) != 0 {
+		t.Errorf("second hour = %+v, want empty", points[1])
+	}
+	if points[2].Behaviors[domain.BehaviorSchooling] != 1 {
+		t.Errorf("third hour = %+v", points[2])
+	}
+
+	buckets, err := f.service.Summary(scope, domain.BehaviorFilter{AreaID: "pond-a", From: f.at(0), To: f.at(180)}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 || buckets[0].Count != 2 || buckets[0].MaxFishCount != 0 || buckets[0].AvgConfidence < 0.79 || buckets[0].AvgConfidence > 0.81 {
+		t.Errorf("buckets = %+v", buckets)
+	}
+
+	tests := []struct {
+		name     string
+		from, to *time.Time
+		interval time.Duration
+	}{
+		{"interval below a minute", f.at(0), f.at(60), time.Second},
+		{"from after to", f.at(60), f.at(0), time.Hour},
+		{"too many intervals", f.at(-2000), f.at(0), time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := f.service.Summary(scope, domain.BehaviorFilter{From: tt.from, To: tt.to}, tt.interval); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Errorf("Summary = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+	if _, err := f.service.Correlation(scope, "", nil, nil, time.Hour); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("correlation without area: err = %v, want ErrInvalidInput", err)
+	}
+}
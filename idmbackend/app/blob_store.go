@@ -0,0 +1,19 @@
+package app
+
+import "io"
+
+// BlobStore 二进制对象存储，键为以 / 分隔的相对路径
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// StreamBlobStore 支持流式读写的对象存储，用于视频等不适合整体读入内存的大文件
+type StreamBlobStore interface {
+	BlobStore
+	// PutStream 写入 r 的全部内容，返回写入的字节数
+	PutStream(key string, r io.Reader, contentType string) (int64, error)
+	// Open 打开对象用于随机读取，不存在时返回 domain.ErrBlobNotFound
+	Open(key string) (io.ReadSeekCloser, error)
+}
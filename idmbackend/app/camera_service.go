@@ -0,0 +1,414 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// CameraRepository 所有查询都限定在 scope 所在的组织内，清理过期快照使用的方法除外
+type CameraRepository interface {
+	Create(scope domain.TenantScope, camera *domain.Camera) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Camera, error)
+	Find(scope domain.TenantScope, filter domain.CameraFilter) ([]*domain.Camera, int64, error)
+	FindAll() ([]*domain.Camera, error)
+	Update(scope domain.TenantScope, camera *domain.Camera) error
+	Delete(scope domain.TenantScope, id uint) error
+	CreateSnapshot(scope domain.TenantScope, snapshot *domain.Snapshot) error
+	UpdateSnapshotJob(scope domain.TenantScope, snapshot *domain.Snapshot) error
+	FindSnapshot(scope domain.TenantScope, cameraID, id uint) (*domain.Snapshot, error)
+	FindLatestSnapshot(scope domain.TenantScope, cameraID uint) (*domain.Snapshot, error)
+	FindSnapshots(scope domain.TenantScope, cameraID uint, filter domain.SnapshotFilter) ([]*domain.Snapshot, int64, error)
+	FindSnapshotsBefore(cameraID uint, before time.Time, limit int) ([]*domain.Snapshot, error)
+	DeleteSnapshots(ids []uint) error
+}
+
+const (
+	// MaxSnapshotSize 单张快照的大小上限
+	MaxSnapshotSize = 8 << 20
+	// snapshotDeleteBatch 清理快照时每批删除的数量
+	snapshotDeleteBatch = 500
+	// maxRetentionDays 摄像头可配置的最长保留天数
+	maxRetentionDays = 3650
+)
+
+// streamSchemes 允许登记的视频流协议
+var streamSchemes = map[string]bool{"rtsp": true, "rtsps": true, "rtmp": true, "http": true, "https": true, "ws": true, "wss": true}
+
+// SnapshotPolicy 快照的保留和清理参数，零值字段使用默认值
+type SnapshotPolicy struct {
+	RetentionDays int           // 摄像头未单独配置时快照的保留天数，默认 7
+	SweepInterval time.Duration // 清理过期快照的间隔，默认 1h
+}
+
+// CameraInput 创建或修改摄像头的参数，未指定类型和状态时分别为水下摄像头和启用
+type CameraInput struct {
+	Name             string              `json:"name"`
+	AreaID           string              `json:"area_id"`
+	DeviceID         string              `json:"device_id"`
+	Type             domain.CameraType   `json:"type"`
+	StreamURL        string              `json:"stream_url"`
+	Latitude         *float64            `json:"latitude"`
+	Longitude        *float64            `json:"longitude"`
+	Depth            *float64            `json:"depth"`
+	Status           domain.CameraStatus `json:"status"`
+	SnapshotInterval int                 `json:"snapshot_interval"`
+	RetentionDays    int                 `json:"retention_days"`
+	AutoRecognize    bool                `json:"auto_recognize"`
+}
+
+// CameraService 管理监测摄像头及其定时上传的快照。快照保存在对象存储中，
+// 后台定期删除超过保留期的快照及其自动识别结果；摄像头开启自动识别时，每张快照作为一个批量识别任务提交
+type CameraService struct {
+	repo       CameraRepository
+	blobs      BlobStore
+	jobService *RecognitionJobService
+	policy     SnapshotPolicy
+}
+
+func NewCameraService(repo CameraRepository, blobs BlobStore, jobService *RecognitionJobService, policy SnapshotPolicy) *CameraService {
+	if policy.RetentionDays <= 0 {
+		policy.RetentionDays = 7
+	}
+	if policy.SweepInterval <= 0 {
+		policy.SweepInterval = time.Hour
+	}
+	return &CameraService{repo: repo, blobs: blobs, jobService: jobService, policy: policy}
+}
+
+func (s *CameraService) CreateCamera(scope domain.TenantScope, input CameraInput) (*domain.Camera, error) {
+	camera := &domain.Camera{}
+	if err := applyCameraInput(camera, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(scope, camera); err != nil {
+		return nil, err
+	}
+	return camera, nil
+}
+
+func (s *CameraService) GetCamera(scope domain.TenantScope, id uint) (*domain.Camera, error) {
+	camera, err := s.repo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if camera == nil {
+		return nil, domain.ErrCameraNotFound
+	}
+	return camera, nil
+}
+
+func (s *CameraService) ListCameras(scope domain.TenantScope, filter domain.CameraFilter) ([]*domain.Camera, int64, error) {
+	return s.repo.Find(scope, filter)
+}
+
+// UpdateCamera 用 input 替换摄像头的全部配置
+func (s *CameraService) UpdateCamera(scope domain.TenantScope, id uint, input CameraInput) (*domain.Camera, error) {
+	camera, err := s.GetCamera(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCameraInput(camera, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(scope, camera); err != nil {
+		return nil, err
+	}
+	return camera, nil
+}
+
+// DeleteCamera 删除摄像头及其全部快照
+func (s *CameraService) DeleteCamera(scope domain.TenantScope, id uint) error {
+	if _, err := s.GetCamera(scope, id); err != nil {
+		return err
+	}
+	// 先删除快照图片，删除中途失败时剩余的快照仍可由下次删除或过期清理处理
+	if err := s.purgeSnapshots(id, time.Now().Add(time.Minute)); err != nil {
+		return err
+	}
+	return s.repo.Delete(scope, id)
+}
+
+// PushSnapshot 保存摄像头上传的 JPEG 快照，capturedAt 为空时使用上传时间。
+// 自动识别任务提交失败时只记录日志，快照仍然保存成功
+func (s *CameraService) PushSnapshot(scope domain.TenantScope, userID, cameraID uint, data []byte, capturedAt *time.Time) (*domain.Snapshot, error) {
+	camera, err := s.GetCamera(scope, cameraID)
+	if err != nil {
+		return nil, err
+	}
+	if camera.Status == domain.CameraDisabled {
+		return nil, domain.ErrCameraDisabled
+	}
+	if len(data) > MaxSnapshotSize {
+		return nil, fmt.Errorf("%w: snapshot must be at most %d MB", domain.ErrInvalidInput, MaxSnapshotSize>>20)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		return nil, fmt.Errorf("%w: snapshot must be a JPEG image", domain.ErrUnsupportedMedia)
+	}
+	if !withinPixelLimit(config) {
+		return nil, fmt.Errorf("%w: snapshot must be at most %d pixels", domain.ErrInvalidInput, maxImagePixels)
+	}
+
+	now := time.Now()
+	at := now
+	if capturedAt != nil {
+		at = *capturedAt
+		if at.After(now.Add(time.Minute)) {
+			return nil, fmt.Errorf("%w: captured_at must not be in the future", domain.ErrInvalidInput)
+		}
+		if at.Before(now.AddDate(0, 0, -s.retentionDays(camera))) {
+			return nil, fmt.Errorf("%w: captured_at is older than the retention period", domain.ErrInvalidInput)
+		}
+	}
+
+	key, err := newSnapshotKey(camera.ID, at)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Put(key, data, "image/jpeg"); err != nil {
+		return nil, err
+	}
+	snapshot := &domain.Snapshot{
+		CameraID:   camera.ID,
+		CapturedAt: at,
+		ImageKey:   key,
+		Size:       len(data),
+		Width:      config.Width,
+		Height:     config.Height,
+	}
+	if err := s.repo.CreateSnapshot(scope, snapshot); err != nil {
+		s.removeBlob(key)
+		return nil, err
+	}
+
+	if camera.AutoRecognize && s.jobService != nil {
+		s.submitRecognition(scope, userID, camera, snapshot, data)
+	}
+	return snapshot, nil
+}
+
+// LatestSnapshot 摄像头最新的快照及其图片
+func (s *CameraService) LatestSnapshot(scope domain.TenantScope, cameraID uint) (*domain.Snapshot, []byte, error) {
+	if _, err := s.GetCamera(scope, cameraID); err != nil {
+		return nil, nil, err
+	}
+	snapshot, err := s.repo.FindLatestSnapshot(scope, cameraID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot == nil {
+		return nil, nil, domain.ErrSnapshotNotFound
+	}
+	data, err := s.blobs.Get(snapshot.ImageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, data, nil
+}
+
+// SnapshotImage 指定快照的图片
+func (s *CameraService) SnapshotImage(scope domain.TenantScope, cameraID, id uint) (*domain.Snapshot, []byte, error) {
+	snapshot, err := s.repo.FindSnapshot(scope, cameraID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot == nil {
+		return nil, nil, domain.ErrSnapshotNotFound
+	}
+	data, err := s.blobs.Get(snapshot.ImageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, data, nil
+}
+
+// ListSnapshots 按拍摄时间顺序列出快照，filter.Step 大于 0 时按时段抽取，用于延时播放
+func (s *CameraService) ListSnapshots(scope domain.TenantScope, cameraID uint, filter domain.SnapshotFilter) ([]*domain.Snapshot, int64, error) {
+	if _, err := s.GetCamera(scope, cameraID); err != nil {
+		return nil, 0, err
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, 0, fmt.Errorf("%w: from must be before to", domain.ErrInvalidInput)
+	}
+	if filter.Step < 0 || (filter.Step > 0 && filter.Step < time.Second) {
+		return nil, 0, fmt.Errorf("%w: step must be at least 1s", domain.ErrInvalidInput)
+	}
+	return s.repo.FindSnapshots(scope, cameraID, filter)
+}
+
+// Start 启动后台清理，按 SweepInterval 删除超过保留期的快照，ctx 取消后停止
+func (s *CameraService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.policy.SweepInterval)
+		defer ticker.Stop()
+		for {
+			s.sweep()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sweep 删除所有摄像头超过保留期的快照，单个摄像头失败不影响其余摄像头
+func (s *CameraService) sweep() {
+	cameras, err := s.repo.FindAll()
+	if err != nil {
+		log.Printf("快照清理 - 获取摄像头失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, camera := range cameras {
+		cutoff := now.AddDate(0, 0, -s.retentionDays(camera))
+		if err := s.purgeSnapshots(camera.ID, cutoff); err != nil {
+			log.Printf("快照清理 - 摄像头 %d: %v", camera.ID, err)
+		}
+	}
+}
+
+// purgeSnapshots 分批删除摄像头在 before 之前拍摄的快照及其图片，
+// 自动识别提交的任务、识别图片和用户尚未反馈的识别记录一并删除
+func (s *CameraService) purgeSnapshots(cameraID uint, before time.Time) error {
+	for {
+		snapshots, err := s.repo.FindSnapshotsBefore(cameraID, before, snapshotDeleteBatch)
+		if err != nil {
+			return err
+		}
+		var jobIDs []uint
+		for _, snapshot := range snapshots {
+			if snapshot.RecognitionJobID != nil {
+				jobIDs = append(jobIDs, *snapshot.RecognitionJobID)
+			}
+		}
+		if len(jobIDs) > 0 && s.jobService != nil {
+			if err := s.jobService.PurgeJobs(jobIDs); err != nil {
+				return err
+			}
+		}
+
+		ids := make([]uint, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			s.removeBlob(snapshot.ImageKey)
+			ids = append(ids, snapshot.ID)
+		}
+		if err := s.repo.DeleteSnapshots(ids); err != nil {
+			return err
+		}
+		if len(snapshots) < snapshotDeleteBatch {
+			return nil
+		}
+	}
+}
+
+func (s *CameraService) submitRecognition(scope domain.TenantScope, userID uint, camera *domain.Camera, snapshot *domain.Snapshot, data []byte) {
+	job, err := s.jobService.CreateJob(RecognitionJobRequest{
+		Scope:     scope,
+		UserID:    userID,
+		Images:    []JobImage{{Name: fmt.Sprintf("camera-%d-%s.jpg", camera.ID, snapshot.CapturedAt.Format("20060102-150405")), Data: data}},
+		AreaID:    camera.AreaID,
+		Latitude:  camera.Latitude,
+		Longitude: camera.Longitude,
+	})
+	if err != nil {
+		log.Printf("快照自动识别 - 摄像头 %d 快照 %d 提交失败: %v", camera.ID, snapshot.ID, err)
+		return
+	}
+	snapshot.RecognitionJobID = &job.ID
+	if err := s.repo.UpdateSnapshotJob(scope, snapshot); err != nil {
+		log.Printf("快照自动识别 - 摄像头 %d 快照 %d 记录任务失败: %v", camera.ID, snapshot.ID, err)
+	}
+}
+
+func (s *CameraService) retentionDays(camera *domain.Camera) int {
+	if camera.RetentionDays > 0 {
+		return camera.RetentionDays
+	}
+	return s.policy.RetentionDays
+}
+
+func (s *CameraService) removeBlob(key string) {
+	if err := s.blobs.Delete(key); err != nil {
+		log.Printf("删除快照图片失败 %s: %v", key, err)
+	}
+}
+
+func applyCameraInput(camera *domain.Camera, input CameraInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > 128 {
+		return fmt.Errorf("%w: name is required and must be at most 128 characters", domain.ErrInvalidInput)
+	}
+	areaID := strings.TrimSpace(input.AreaID)
+	deviceID := strings.TrimSpace(input.DeviceID)
+	if len(areaID) > 64 || len(deviceID) > 64 {
+		return fmt.Errorf("%w: area_id and device_id must be at most 64 characters", domain.ErrInvalidInput)
+	}
+	if input.Type == "" {
+		input.Type = domain.CameraUnderwater
+	}
+	if !input.Type.IsValid() {
+		return fmt.Errorf("%w: type must be underwater, surface or ptz", domain.ErrInvalidInput)
+	}
+	if input.Status == "" {
+		input.Status = domain.CameraActive
+	}
+	if !input.Status.IsValid() {
+		return fmt.Errorf("%w: status must be active, maintenance or disabled", domain.ErrInvalidInput)
+	}
+	stream := strings.TrimSpace(input.StreamURL)
+	if stream != "" && !validStreamURL(stream) {
+		return fmt.Errorf("%w: stream_url must be an rtsp, rtmp, http(s) or ws(s) URL", domain.ErrInvalidInput)
+	}
+	if err := validateCoordinates(input.Latitude, input.Longitude); err != nil {
+		return err
+	}
+	if input.Depth != nil && !validNonNegative(*input.Depth) {
+		return fmt.Errorf("%w: depth must not be negative", domain.ErrInvalidInput)
+	}
+	if input.SnapshotInterval < 0 || input.RetentionDays < 0 || input.RetentionDays > maxRetentionDays {
+		return fmt.Errorf("%w: snapshot_interval must not be negative and retention_days must be between 0 and %d", domain.ErrInvalidInput, maxRetentionDays)
+	}
+
+	camera.Name = name
+	camera.AreaID = areaID
+	camera.DeviceID = deviceID
+	camera.Type = input.Type
+	camera.StreamURL = stream
+	camera.Latitude = input.Latitude
+	camera.Longitude = input.Longitude
+	camera.Depth = input.Depth
+	camera.Status = input.Status
+	camera.SnapshotInterval = input.SnapshotInterval
+	camera.RetentionDays = input.RetentionDays
+	camera.AutoRecognize = input.AutoRecognize
+	return nil
+}
+
+func validStreamURL(stream string) bool {
+	if len(stream) > 512 {
+		return false
+	}
+	u, err := url.Parse(stream)
+	return err == nil && streamSchemes[strings.ToLower(u.Scheme)] && u.Host != ""
+}
+
+// newSnapshotKey 按摄像头和日期组织快照图片，便于在对象存储中按目录清理
+func newSnapshotKey(cameraID uint, at time.Time) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("snapshots/%d/%s/%s-%s.jpg", cameraID, at.Format("20060102"), at.Format("150405"), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,467 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memCameraRepo 与数据库实现一样按 scope.OrgID 隔离摄像头和快照
+type memCameraRepo struct {
+	mu        sync.Mutex
+	cameras   []*domain.Camera
+	snapshots []*domain.Snapshot
+	nextID    uint
+}
+
+func (r *memCameraRepo) Create(scope domain.TenantScope, camera *domain.Camera) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	camera.ID = uint(len(r.cameras) + 1)
+	camera.OrgID = scope.OrgID
+	copied := *camera
+	r.cameras = append(r.cameras, &copied)
+	return nil
+}
+
+func (r *memCameraRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Camera, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.cameras {
+		if c.ID == id && c.OrgID == scope.OrgID {
+			copied := *c
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memCameraRepo) Find(scope domain.TenantScope, filter domain.CameraFilter) ([]*domain.Camera, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Camera
+	for _, c := range r.cameras {
+		if c.OrgID == scope.OrgID && (filter.AreaID == "" || c.AreaID == filter.AreaID) &&
+			(len(filter.AreaIDs) == 0 || containsString(filter.AreaIDs, c.AreaID)) && (filter.Status == "" || c.Status == filter.Status) {
+			copied := *c
+			found = append(found, &copied)
+		}
+	}
+	return found, int64(len(found)), nil
+}
+
+func (r *memCameraRepo) FindAll() ([]*domain.Camera, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Camera
+	for _, c := range r.cameras {
+		copied := *c
+		found = append(found, &copied)
+	}
+	return found, nil
+}
+
+func (r *memCameraRepo) Update(scope domain.TenantScope, camera *domain.Camera) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.cameras {
+		if c.ID == camera.ID && c.OrgID == scope.OrgID {
+			copied := *camera
+			copied.LastSnapshotAt = c.LastSnapshotAt
+			r.cameras[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memCameraRepo) Delete(scope domain.TenantScope, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cameras := r.cameras[:0]
+	for _, c := range r.cameras {
+		if c.ID != id || c.OrgID != scope.OrgID {
+			cameras = append(cameras, c)
+		}
+	}
+	r.cameras = cameras
+	snapshots := r.snapshots[:0]
+	for _, s := range r.snapshots {
+		if s.CameraID != id || s.OrgID != scope.OrgID {
+			snapshots = append(snapshots, s)
+		}
+	}
+	r.snapshots = snapshots
+	return nil
+}
+
+func (r *memCameraRepo) CreateSnapshot(scope domain.TenantScope, snapshot *domain.Snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	snapshot.ID = r.nextID
+	snapshot.OrgID = scope.OrgID
+	copied := *snapshot
+	r.snapshots = append(r.snapshots, &copied)
+	for _, c := range r.cameras {
+		if c.ID == snapshot.CameraID && c.OrgID == scope.OrgID && (c.LastSnapshotAt == nil || c.LastSnapshotAt.Before(snapshot.CapturedAt)) {
+			at := snapshot.CapturedAt
+			c.LastSnapshotAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memCameraRepo) UpdateSnapshotJob(scope domain.TenantScope, snapshot *domain.Snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.snapshots {
+		if s.ID == snapshot.ID && s.OrgID == scope.OrgID {
+			s.RecognitionJobID = snapshot.RecognitionJobID
+		}
+	}
+	return nil
+}
+
+func (r *memCameraRepo) FindSnapshot(scope domain.TenantScope, cameraID, id uint) (*domain.Snapshot, error) {
+	for _, s := range r.cameraSnapshots(scope.OrgID, cameraID) {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memCameraRepo) FindLatestSnapshot(scope domain.TenantScope, cameraID uint) (*domain.Snapshot, error) {
+	snapshots := r.cameraSnapshots(scope.OrgID, cameraID)
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+func (r *memCameraRepo) FindSnapshots(scope domain.TenantScope, cameraID uint, filter domain.SnapshotFilter) ([]*domain.Snapshot, int64, error) {
+	seconds := int64(filter.Step / time.Second)
+	seen := map[int64]bool{}
+	var found []*domain.Snapshot
+	for _, s := range r.cameraSnapshots(scope.OrgID, cameraID) {
+		if (filter.From != nil && s.CapturedAt.Before(*filter.From)) || (filter.To != nil && !s.CapturedAt.Before(*filter.To)) {
+			continue
+		}
+		if seconds > 0 {
+			bucket := s.CapturedAt.Unix() / seconds
+			if seen[bucket] {
+				continue
+			}
+			seen[bucket] = true
+		}
+		found = append(found, s)
+	}
+	total := int64(len(found))
+	found = found[min(filter.Offset, len(found)):]
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, total, nil
+}
+
+func (r *memCameraRepo) FindSnapshotsBefore(cameraID uint, before time.Time, limit int) ([]*domain.Snapshot, error) {
+	var found []*domain.Snapshot
+	for _, s := range r.cameraSnapshots(0, cameraID) {
+		if s.CapturedAt.Before(before) && len(found) < limit {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
+func (r *memCameraRepo) DeleteSnapshots(ids []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshots := r.snapshots[:0]
+	for _, s := range r.snapshots {
+		deleted := false
+		for _, id := range ids {
+			deleted = deleted || s.ID == id
+		}
+		if !deleted {
+			snapshots = append(snapshots, s)
+		}
+	}
+	r.snapshots = snapshots
+	return nil
+}
+
+// cameraSnapshots 按拍摄时间排序的快照，orgID 为 0 时不区分组织
+func (r *memCameraRepo) cameraSnapshots(orgID, cameraID uint) []*domain.Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Snapshot
+	for _, s := range r.snapshots {
+		if s.CameraID == cameraID && (orgID == 0 || s.OrgID == orgID) {
+			copied := *s
+			found = append(found, &copied)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].CapturedAt.Before(found[j].CapturedAt) })
+	return found
+}
+
+// testJPEG 生成 64x64 的随机噪点 JPEG，大小超过图片校验的下限
+func testJPEG(t *testing.T, seed int64) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestCameraService(f *recognitionFixture) (*CameraService, *memCameraRepo, *RecognitionJobService) {
+	repo := &memCameraRepo{}
+	jobs, _ := newTestJobService(f)
+	return NewCameraService(repo, f.blobs, jobs, SnapshotPolicy{RetentionDays: 2}), repo, jobs
+}
+
+func TestCameraInputValidation(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, _, _ := newTestCameraService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	lat, depth := 95.0, -1.0
+
+	tests := []struct {
+		name  string
+		input CameraInput
+	}{
+		{"missing name", CameraInput{Name: "  "}},
+		{"unknown type", CameraInput{Name: "1号池", Type: "drone"}},
+		{"unknown status", CameraInput{Name: "1号池", Status: "broken"}},
+		{"unsupported stream scheme", CameraInput{Name: "1号池", StreamURL: "ftp://10.0.0.5/live"}},
+		{"stream without host", CameraInput{Name: "1号池", StreamURL: "rtsp:///live"}},
+		{"latitude without longitude", CameraInput{Name: "1号池", Latitude: &lat}},
+		{"negative depth", CameraInput{Name: "1号池", Depth: &depth}},
+		{"retention too long", CameraInput{Name: "1号池", RetentionDays: maxRetentionDays + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CreateCamera(scope, tt.input); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("CreateCamera = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+
+	camera, err := service.CreateCamera(scope, CameraInput{Name: " 1号池 ", AreaID: " pond-a ", StreamURL: "RTSP://10.0.0.5:554/live"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if camera.Name != "1号池" || camera.AreaID != "pond-a" || camera.Type != domain.CameraUnderwater || camera.Status != domain.CameraActive {
+		t.Errorf("camera = %+v", camera)
+	}
+	if _, err := service.GetCamera(domain.TenantScope{OrgID: 2}, camera.ID); !errors.Is(err, domain.ErrCameraNotFound) {
+		t.Errorf("camera from other org: err = %v, want ErrCameraNotFound", err)
+	}
+}
+
+func TestPushSnapshot(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, _, _ := newTestCameraService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	camera, err := service.CreateCamera(scope, CameraInput{Name: "1号池"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := service.CreateCamera(scope, CameraInput{Name: "2号池", Status: domain.CameraDisabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	future, expired := now.Add(time.Hour), now.AddDate(0, 0, -3)
+
+	tests := []struct {
+		name       string
+		scope      domain.TenantScope
+		cameraID   uint
+		data       []byte
+		capturedAt *time.Time
+		wantErr    error
+	}{
+		{"png image", scope, camera.ID, testPNG(t, 1), nil, domain.ErrUnsupportedMedia},
+		{"disabled camera", scope, disabled.ID, testJPEG(t, 1), nil, domain.ErrCameraDisabled},
+		{"captured in the future", scope, camera.ID, testJPEG(t, 1), &future, domain.ErrInvalidInput},
+		{"older than retention", scope, camera.ID, testJPEG(t, 1), &expired, domain.ErrInvalidInput},
+		{"camera from other org", domain.TenantScope{OrgID: 2}, camera.ID, testJPEG(t, 1), nil, domain.ErrCameraNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.PushSnapshot(tt.scope, 5, tt.cameraID, tt.data, tt.capturedAt); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PushSnapshot = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, _, err := service.LatestSnapshot(scope, camera.ID); !errors.Is(err, domain.ErrSnapshotNotFound) {
+		t.Errorf("no snapshots: err = %v, want ErrSnapshotNotFound", err)
+	}
+
+	older, newer := now.Add(-time.Hour), now.Add(-time.Minute)
+	latest := testJPEG(t, 2)
+	if _, err := service.PushSnapshot(scope, 5, camera.ID, latest, &newer); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := service.PushSnapshot(scope, 5, camera.ID, testJPEG(t, 3), &older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Width != 64 || snapshot.Height != 64 || snapshot.RecognitionJobID != nil {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+
+	// 补传的旧快照不改变最新快照
+	got, data, err := service.LatestSnapshot(scope, camera.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CapturedAt.Equal(newer) || !bytes.Equal(data, latest) {
+		t.Errorf("latest snapshot captured at %v, want %v", got.CapturedAt, newer)
+	}
+	if camera, _ := service.GetCamera(scope, camera.ID); camera.LastSnapshotAt == nil || !camera.LastSnapshotAt.Equal(newer) {
+		t.Errorf("last_snapshot_at = %v, want %v", camera.LastSnapshotAt, newer)
+	}
+}
+
+func TestListSnapshotsTimeLapse(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, _, _ := newTestCameraService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	camera, err := service.CreateCamera(scope, CameraInput{Name: "1号池"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-6 * time.Hour).Truncate(time.Hour)
+	// 每 20 分钟一张，共 3 小时
+	for i := 0; i < 9; i++ {
+		at := base.Add(time.Duration(i) * 20 * time.Minute)
+		if _, err := service.PushSnapshot(scope, 5, camera.ID, testJPEG(t, int64(i)), &at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to := base.Add(3 * time.Hour)
+	snapshots, total, err := service.ListSnapshots(scope, camera.ID, domain.SnapshotFilter{From: &base, To: &to, Step: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(snapshots) != 3 {
+		t.Fatalf("time-lapse = %d snapshots, want one per hour", total)
+	}
+	for i, snapshot := range snapshots {
+		if want := base.Add(time.Duration(i) * time.Hour); !snapshot.CapturedAt.Equal(want) {
+			t.Errorf("frame %d captured at %v, want %v", i, snapshot.CapturedAt, want)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.SnapshotFilter
+	}{
+		{"from after to", domain.SnapshotFilter{From: &to, To: &base}},
+		{"step below a second", domain.SnapshotFilter{Step: 500 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := service.ListSnapshots(scope, camera.ID, tt.filter); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Errorf("ListSnapshots = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestSweepPurgesExpiredSnapshots(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, _, jobs := newTestCameraService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	input := CameraInput{Name: "1号池", AutoRecognize: true}
+	camera, err := service.CreateCamera(scope, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, recent := time.Now().Add(-36*time.Hour), time.Now().Add(-time.Hour)
+	expired, err := service.PushSnapshot(scope, 5, camera.ID, testJPEG(t, 1), &old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := service.PushSnapshot(scope, 5, camera.ID, testJPEG(t, 2), &recent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.RecognitionJobID == nil {
+		t.Fatal("auto recognition job was not submitted")
+	}
+
+	// 摄像头的保留期缩短为 1 天后，36 小时前的快照及其识别任务被清理
+	input.RetentionDays = 1
+	if _, err := service.UpdateCamera(scope, camera.ID, input); err != nil {
+		t.Fatal(err)
+	}
+	service.sweep()
+
+	if _, _, err := service.SnapshotImage(scope, camera.ID, expired.ID); !errors.Is(err, domain.ErrSnapshotNotFound) {
+		t.Errorf("expired snapshot: err = %v, want ErrSnapshotNotFound", err)
+	}
+	if _, err := f.blobs.Get(expired.ImageKey); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("expired snapshot image: err = %v, want ErrBlobNotFound", err)
+	}
+	if _, err := jobs.GetJob(scope, *expired.RecognitionJobID); !errors.Is(err, domain.ErrJobNotFound) {
+		t.Errorf("expired snapshot job: err = %v, want ErrJobNotFound", err)
+	}
+	if _, data, err := service.SnapshotImage(scope, camera.ID, kept.ID); err != nil || len(data) == 0 {
+		t.Errorf("recent snapshot: err = %v", err)
+	}
+	if _, err := jobs.GetJob(scope, *kept.RecognitionJobID); err != nil {
+		t.Errorf("recent snapshot job: err = %v", err)
+	}
+}
+
+func TestDeleteCameraRemovesSnapshots(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, repo, _ := newTestCameraService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	camera, err := service.CreateCamera(scope, CameraInput{Name: "1号池"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := service.PushSnapshot(scope, 5, camera.ID, testJPEG(t, 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.DeleteCamera(domain.TenantScope{OrgID: 2}, camera.ID); !errors.Is(err, domain.ErrCameraNotFound) {
+		t.Errorf("delete from other org: err = %v, want ErrCameraNotFound", err)
+	}
+	if err := service.DeleteCamera(scope, camera.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GetCamera(scope, camera.ID); !errors.Is(err, domain.ErrCameraNotFound) {
+		t.Errorf("deleted camera: err = %v, want ErrCameraNotFound", err)
+	}
+	if len(repo.snapshots) != 0 {
+		t.Errorf("%d snapshots left after delete", len(repo.snapshots))
+	}
+	if _, err := f.blobs.Get(snapshot.ImageKey); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("snapshot image: err = %v, want ErrBlobNotFound", err)
+	}
+}
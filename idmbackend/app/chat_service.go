@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// maxPromptLength 单次提问的最大字符数
+const maxPromptLength = 4000
+
+// LLMMessage 对话中的一条消息，Role 为 system、user 或 assistant
+type LLMMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMRequest 一次对话补全请求，零值字段使用模型的默认设置
+type LLMRequest struct {
+	Messages    []LLMMessage
+	MaxTokens   int
+	Temperature *float64
+}
+
+// LLMUsage 一次调用消耗的 token 数
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LLMResponse 模型的回答
+type LLMResponse struct {
+	Content      string
+	Model        string
+	FinishReason string
+	Usage        LLMUsage
+}
+
+// LLMProvider 大模型对话接口。调用失败时返回包装了 domain.ErrLLMFailed 的错误
+type LLMProvider interface {
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+}
+
+// ChatReply 智能问答的回答及本次调用的 token 用量
+type ChatReply struct {
+	Reply string   `json:"reply"`
+	Model string   `json:"model"`
+	Usage LLMUsage `json:"usage"`
+}
+
+// ChatService 智能问答，provider 为空表示未配置大模型
+type ChatService struct {
+	provider     LLMProvider
+	systemPrompt string
+	limiter      *RateLimiter
+}
+
+// NewChatService systemPrompt 为空时不发送系统提示；limiter 按用户限制提问次数，为空表示不限制
+func NewChatService(provider LLMProvider, systemPrompt string, limiter *RateLimiter) *ChatService {
+	return &ChatService{provider: provider, systemPrompt: strings.TrimSpace(systemPrompt), limiter: limiter}
+}
+
+// Chat 调用大模型按次计费，超过用户的提问次数限制时返回 *ThrottledError
+func (s *ChatService) Chat(ctx context.Context, userID uint, prompt string) (*ChatReply, error) {
+	if s.provider == nil {
+		return nil, domain.ErrLLMNotConfigured
+	}
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" || utf8.RuneCountInString(prompt) > maxPromptLength {
+		return nil, fmt.Errorf("%w: prompt is required and must be at most %d characters", domain.ErrInvalidInput, maxPromptLength)
+	}
+	if err := s.limiter.Allow(fmt.Sprintf("user:%d", userID)); err != nil {
+		return nil, err
+	}
+
+	messages := make([]LLMMessage, 0, 2)
+	if s.systemPrompt != "" {
+		messages = append(messages, LLMMessage{Role: "system", Content: s.systemPrompt})
+	}
+	messages = append(messages, LLMMessage{Role: "user", Content: prompt})
+
+	resp, err := s.provider.Complete(ctx, LLMRequest{Messages: messages})
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(resp.Content) == "" {
+		return nil, fmt.Errorf("%w: empty reply", domain.ErrLLMFailed)
+	}
+	return &ChatReply{Reply: resp.Content, Model: resp.Model, Usage: resp.Usage}, nil
+}
@@ -0,0 +1,805 @@
+package app
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// DatasetFormat 检测数据集的交换格式
+type DatasetFormat string
+
+const (
+	DatasetCOCO DatasetFormat = "coco" // COCO JSON
+	DatasetYOLO DatasetFormat = "yolo" // YOLO txt，每张图片一个标注文件，坐标为归一化的中心点和宽高
+	DatasetVOC  DatasetFormat = "voc"  // Pascal VOC XML
+)
+
+const (
+	// maxAnnotationFileSize 压缩包中单个标注文件的大小上限
+	maxAnnotationFileSize = 64 << 20
+	// maxSkippedReported 导入结果中最多列出的跳过文件数
+	maxSkippedReported = 100
+)
+
+// ParseDatasetFormat 解析格式名称，不区分大小写
+func ParseDatasetFormat(raw string) (DatasetFormat, error) {
+	switch format := DatasetFormat(strings.ToLower(strings.TrimSpace(raw))); format {
+	case DatasetCOCO, DatasetYOLO, DatasetVOC:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: format must be coco, yolo or voc", domain.ErrInvalidInput)
+}
+
+// Import 从 ZIP 压缩包导入带标注的图片。压缩包结构：
+//   - coco: 图片和 COCO JSON 标注文件，file_name 按路径或文件名匹配图片
+//   - yolo: 图片、同名的 .txt 标注文件（images/ 与 labels/ 目录对应，或放在同一目录），以及 classes.txt 或 obj.names
+//   - voc: 图片和 VOC XML 标注文件，ImageSets/Main/{train,val,test}.txt 指定划分
+//
+// 路径或标注文件名中含 train、val、test 时据此确定划分，否则使用 split。
+// 找不到图片或图片无效的样本跳过并在结果中列出
+func (s *DatasetService) Import(scope domain.TenantScope, userID, datasetID uint, format DatasetFormat, archive []byte, split domain.DatasetSplit) (*DatasetImportResult, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	if !split.IsValid() {
+		return nil, fmt.Errorf("%w: split must be train, val, test or empty", domain.ErrInvalidInput)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid zip archive", domain.ErrInvalidInput)
+	}
+
+	index := indexDatasetArchive(zr)
+	var samples []importedFrame
+	var skipped []string
+	switch format {
+	case DatasetCOCO:
+		samples, skipped, err = parseCOCO(index)
+	case DatasetYOLO:
+		samples, skipped, err = parseYOLO(index)
+	case DatasetVOC:
+		samples, skipped, err = parseVOC(index)
+	default:
+		return nil, fmt.Errorf("%w: format must be coco, yolo or voc", domain.ErrInvalidInput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) > maxFramesPerImport {
+		return nil, fmt.Errorf("%w: at most %d images per import", domain.ErrInvalidInput, maxFramesPerImport)
+	}
+
+	result := &DatasetImportResult{}
+	frames := make([]*domain.DatasetFrame, 0, len(samples))
+	var boxes []domain.Detection
+	for _, sample := range samples {
+		frame, err := s.importFrame(sample, userID, datasetID, format, split)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", sample.name, err))
+			continue
+		}
+		frames = append(frames, frame)
+		boxes = append(boxes, frame.Boxes...)
+	}
+
+	if len(frames) > 0 {
+		if result.Categories, err = s.ensureCategories(scope, datasetID, boxes); err != nil {
+			return nil, err
+		}
+		if err := s.repo.CreateFrames(scope, frames); err != nil {
+			return nil, err
+		}
+	}
+	result.Frames, result.Boxes = len(frames), len(boxes)
+	result.Skipped = skipped
+	if len(skipped) > maxSkippedReported {
+		result.Skipped = append(skipped[:maxSkippedReported:maxSkippedReported], fmt.Sprintf("... 另有 %d 个文件被跳过", len(skipped)-maxSkippedReported))
+	}
+	return result, nil
+}
+
+func (s *DatasetService) importFrame(sample importedFrame, userID, datasetID uint, format DatasetFormat, split domain.DatasetSplit) (*domain.DatasetFrame, error) {
+	data, err := readDatasetFile(sample.image, MaxImageSize)
+	if err != nil {
+		return nil, err
+	}
+	frame := &domain.DatasetFrame{DatasetID: datasetID, CreatedBy: userID}
+	if err := s.attachImage(frame, data); err != nil {
+		return nil, err
+	}
+
+	boxes := sample.boxes
+	if sample.normalized {
+		w, h := float64(frame.Width), float64(frame.Height)
+		boxes = make([]domain.Detection, len(sample.boxes))
+		for i, b := range sample.boxes {
+			b.BBox = [4]float64{b.BBox[0] * w, b.BBox[1] * h, b.BBox[2] * w, b.BBox[3] * h}
+			boxes[i] = b
+		}
+	}
+	if sample.split != domain.SplitNone {
+		split = sample.split
+	}
+	input := FrameInput{FileName: sample.name, Split: split, Boxes: boxes, Source: "import:" + string(format)}
+	if err := applyFrameInput(frame, input); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Export 将数据集导出为 ZIP 压缩包，split 不为 nil 时只导出该划分。按划分分目录：
+//   - coco: images/<划分>/ 和 annotations/instances_<划分>.json
+//   - yolo: images/<划分>/、labels/<划分>/、classes.txt 和 data.yaml
+//   - voc: JPEGImages/、Annotations/ 和 ImageSets/Main/<划分>.txt
+//
+// 尚未划分的帧放在 unassigned 中。帧图片以帧 ID 命名；只关联视频的帧只导出标注，
+// COCO 标注中附带 video_id 和 timestamp，便于从视频截取对应画面
+func (s *DatasetService) Export(scope domain.TenantScope, datasetID uint, format DatasetFormat, split *domain.DatasetSplit, w io.Writer) error {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return err
+	}
+	categories, err := s.repo.FindCategories(scope, datasetID)
+	if err != nil {
+		return err
+	}
+
+	var exporter datasetExporter
+	switch format {
+	case DatasetCOCO:
+		exporter = newCOCOExporter(categories)
+	case DatasetYOLO:
+		exporter = newYOLOExporter(categories)
+	case DatasetVOC:
+		exporter = &vocExporter{splits: map[string][]string{}}
+	default:
+		return fmt.Errorf("%w: format must be coco, yolo or voc", domain.ErrInvalidInput)
+	}
+
+	archive := zip.NewWriter(w)
+	var afterID uint
+	for {
+		batch, err := s.repo.FindFramesAfter(scope, datasetID, split, afterID, frameExportBatch)
+		if err != nil {
+			return err
+		}
+		for _, frame := range batch {
+			afterID = frame.ID
+			var data []byte
+			if frame.HasImage() {
+				if data, err = s.blobs.Get(frame.ImageKey); err != nil {
+					log.Printf("导出检测数据集 - 读取帧 %d 的图片失败: %v", frame.ID, err)
+					data = nil
+				}
+			}
+			name := fmt.Sprintf("%06d%s", frame.ID, frameImageExt(frame))
+			if err := exporter.addFrame(archive, frame, splitDir(frame.Split), name, data); err != nil {
+				return err
+			}
+		}
+		if len(batch) < frameExportBatch {
+			break
+		}
+	}
+	if err := exporter.finish(archive); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// importedFrame 从压缩包中解析出的一个样本，normalized 为 true 时 BBox 为相对图片尺寸的比例
+type importedFrame struct {
+	name       string
+	image      *zip.File
+	split      domain.DatasetSplit
+	boxes      []domain.Detection
+	normalized bool
+}
+
+// datasetArchive 压缩包中的文件索引，忽略目录、隐藏文件和 macOS 元数据
+type datasetArchive struct {
+	files  []*zip.File
+	images []*zip.File
+	byPath map[string]*zip.File
+	byBase map[string][]*zip.File // 键为小写的文件名
+}
+
+func indexDatasetArchive(zr *zip.Reader) *datasetArchive {
+	index := &datasetArchive{byPath: map[string]*zip.File{}, byBase: map[string][]*zip.File{}}
+	for _, f := range zr.File {
+		base := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		index.files = append(index.files, f)
+		index.byPath[f.Name] = f
+		if isImageFile(base) {
+			index.images = append(index.images, f)
+			key := strings.ToLower(base)
+			index.byBase[key] = append(index.byBase[key], f)
+		}
+	}
+	sort.Slice(index.images, func(i, j int) bool { return index.images[i].Name < index.images[j].Name })
+	return index
+}
+
+// findImage 按路径查找标注文件引用的图片：先精确匹配，再匹配路径后缀，最后按文件名匹配，
+// 同名图片有多张时选择与标注文件 near 目录最接近的一张
+func (a *datasetArchive) findImage(name, near string) *zip.File {
+	name = strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+	if f, ok := a.byPath[name]; ok && isImageFile(name) {
+		return f
+	}
+	candidates := a.byBase[strings.ToLower(path.Base(name))]
+	for _, f := range candidates {
+		if strings.HasSuffix(f.Name, "/"+name) {
+			return f
+		}
+	}
+	var best *zip.File
+	bestScore := -1
+	for _, f := range candidates {
+		if score := commonPrefixLen(f.Name, near); score > bestScore {
+			best, bestScore = f, score
+		}
+	}
+	return best
+}
+
+// ---- COCO ----
+
+type cocoDataset struct {
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+type cocoImage struct {
+	ID        int64    `json:"id"`
+	FileName  string   `json:"file_name"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	VideoID   *uint    `json:"video_id,omitempty"`
+	Timestamp *float64 `json:"timestamp,omitempty"`
+}
+
+type cocoAnnotation struct {
+	ID         int64      `json:"id"`
+	ImageID    int64      `json:"image_id"`
+	CategoryID int64      `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"`
+	Area       float64    `json:"area"`
+	IsCrowd    int        `json:"iscrowd"`
+	Score      float64    `json:"score,omitempty"`
+}
+
+type cocoCategory struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Supercategory string `json:"supercategory,omitempty"`
+	SpeciesID     *uint  `json:"species_id,omitempty"`
+}
+
+func parseCOCO(index *datasetArchive) ([]importedFrame, []string, error) {
+	var samples []importedFrame
+	var skipped []string
+	found := false
+	for _, f := range index.files {
+		if strings.ToLower(path.Ext(f.Name)) != ".json" {
+			continue
+		}
+		data, err := readDatasetFile(f, maxAnnotationFileSize)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+		var ds cocoDataset
+		if err := json.Unmarshal(data, &ds); err != nil || len(ds.Images) == 0 {
+			continue
+		}
+		found = true
+
+		categories := make(map[int64]string, len(ds.Categories))
+		for _, c := range ds.Categories {
+			categories[c.ID] = c.Name
+		}
+		fileSplit := splitFromPath(f.Name)
+		byImage := make(map[int64]int, len(ds.Images))
+		for _, img := range ds.Images {
+			file := index.findImage(img.FileName, f.Name)
+			if file == nil {
+				skipped = append(skipped, fmt.Sprintf("%s: image not found in archive", img.FileName))
+				continue
+			}
+			split := splitFromPath(file.Name)
+			if split == domain.SplitNone {
+				split = fileSplit
+			}
+			byImage[img.ID] = len(samples)
+			samples = append(samples, importedFrame{name: img.FileName, image: file, split: split})
+		}
+		for _, ann := range ds.Annotations {
+			i, ok := byImage[ann.ImageID]
+			if !ok {
+				continue
+			}
+			name, ok := categories[ann.CategoryID]
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("%s: annotation %d has unknown category %d", f.Name, ann.ID, ann.CategoryID))
+				continue
+			}
+			samples[i].boxes = append(samples[i].boxes, domain.Detection{Class: name, Score: ann.Score, BBox: ann.BBox})
+		}
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("%w: no COCO annotation file found in archive", domain.ErrInvalidInput)
+	}
+	return samples, skipped, nil
+}
+
+type cocoExporter struct {
+	categories []cocoCategory
+	ids        map[string]int64
+	splits     map[string]*cocoDataset
+	nextAnnID  int64
+}
+
+func newCOCOExporter(categories []*domain.DatasetCategory) *cocoExporter {
+	e := &cocoExporter{ids: map[string]int64{}, splits: map[string]*cocoDataset{}, nextAnnID: 1}
+	for i, c := range categories {
+		id := int64(i + 1)
+		e.ids[c.Name] = id
+		e.categories = append(e.categories, cocoCategory{ID: id, Name: c.Name, Supercategory: "fish", SpeciesID: c.SpeciesID})
+	}
+	return e
+}
+
+func (e *cocoExporter) addFrame(archive *zip.Writer, frame *domain.DatasetFrame, dir, name string, image []byte) error {
+	if image != nil {
+		if err := writeZipFile(archive, "images/"+dir+"/"+name, image); err != nil {
+			return err
+		}
+	}
+	ds, ok := e.splits[dir]
+	if !ok {
+		ds = &cocoDataset{Images: []cocoImage{}, Annotations: []cocoAnnotation{}, Categories: e.categories}
+		e.splits[dir] = ds
+	}
+	imageID := int64(frame.ID)
+	ds.Images = append(ds.Images, cocoImage{
+		ID:        imageID,
+		FileName:  name,
+		Width:     frame.Width,
+		Height:    frame.Height,
+		VideoID:   frame.VideoID,
+		Timestamp: frame.Timestamp,
+	})
+	for _, box := range frame.Boxes {
+		categoryID, ok := e.ids[box.Class]
+		if !ok {
+			continue
+		}
+		ds.Annotations = append(ds.Annotations, cocoAnnotation{
+			ID:         e.nextAnnID,
+			ImageID:    imageID,
+			CategoryID: categoryID,
+			BBox:       box.BBox,
+			Area:       box.BBox[2] * box.BBox[3],
+			Score:      box.Score,
+		})
+		e.nextAnnID++
+	}
+	return nil
+}
+
+func (e *cocoExporter) finish(archive *zip.Writer) error {
+	for _, dir := range sortedKeys(e.splits) {
+		data, err := json.Marshal(e.splits[dir])
+		if err != nil {
+			return err
+		}
+		if err := writeZipFile(archive, "annotations/instances_"+dir+".json", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---- YOLO ----
+
+func parseYOLO(index *datasetArchive) ([]importedFrame, []string, error) {
+	var classes []string
+	labels := map[string]*zip.File{}
+	for _, f := range index.files {
+		base := strings.ToLower(path.Base(f.Name))
+		switch {
+		case base == "classes.txt" || base == "obj.names":
+			if classes != nil {
+				continue
+			}
+			data, err := readDatasetFile(f, maxAnnotationFileSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			classes = []string{}
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					classes = append(classes, line)
+				}
+			}
+		case path.Ext(base) == ".txt":
+			labels[strings.TrimSuffix(f.Name, path.Ext(f.Name))] = f
+		}
+	}
+	if len(classes) == 0 {
+		return nil, nil, fmt.Errorf("%w: classes.txt or obj.names is required for YOLO datasets", domain.ErrInvalidInput)
+	}
+
+	var samples []importedFrame
+	var skipped []string
+	for _, img := range index.images {
+		sample := importedFrame{name: img.Name, image: img, split: splitFromPath(img.Name), normalized: true}
+		if label := findYOLOLabel(labels, img.Name); label != nil {
+			boxes, err := parseYOLOLabel(label, classes)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", label.Name, err))
+				continue
+			}
+			sample.boxes = boxes
+		}
+		// 没有标注文件的图片作为不含目标的负样本导入
+		samples = append(samples, sample)
+	}
+	return samples, skipped, nil
+}
+
+// findYOLOLabel 查找图片对应的标注文件：images/ 目录对应的 labels/ 目录，或同一目录下的同名文件
+func findYOLOLabel(labels map[string]*zip.File, imageName string) *zip.File {
+	stem := strings.TrimSuffix(imageName, path.Ext(imageName))
+	candidates := []string{stem}
+	if strings.HasPrefix(stem, "images/") {
+		candidates = append([]string{"labels/" + strings.TrimPrefix(stem, "images/")}, candidates...)
+	} else if i := strings.LastIndex(stem, "/images/"); i >= 0 {
+		candidates = append([]string{stem[:i] + "/labels/" + stem[i+len("/images/"):]}, candidates...)
+	}
+	for _, key := range candidates {
+		if f, ok := labels[key]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// parseYOLOLabel 每行为 "类别序号 中心x 中心y 宽 高 [置信度]"，坐标和置信度都是 [0, 1] 内的比例
+func parseYOLOLabel(f *zip.File, classes []string) ([]domain.Detection, error) {
+	data, err := readDatasetFile(f, maxAnnotationFileSize)
+	if err != nil {
+		return nil, err
+	}
+	var boxes []domain.Detection
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 5 && len(fields) != 6 {
+			return nil, fmt.Errorf("line %d: expected 5 or 6 fields", line)
+		}
+		class, err := strconv.Atoi(fields[0])
+		if err != nil || class < 0 || class >= len(classes) {
+			return nil, fmt.Errorf("line %d: unknown class %s", line, fields[0])
+		}
+		var values [5]float64
+		for i, field := range fields[1:] {
+			if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %s", line, field)
+			}
+			if math.IsNaN(values[i]) || math.IsInf(values[i], 0) || values[i] < 0 || values[i] > 1 {
+				return nil, fmt.Errorf("line %d: value %s out of range [0, 1]", line, field)
+			}
+		}
+		cx, cy, w, h := values[0], values[1], values[2], values[3]
+		boxes = append(boxes, domain.Detection{
+			Class: classes[class],
+			Score: values[4],
+			BBox:  [4]float64{cx - w/2, cy - h/2, w, h},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return boxes, nil
+}
+
+type yoloExporter struct {
+	classes []string
+	index   map[string]int
+	dirs    map[string]bool
+}
+
+func newYOLOExporter(categories []*domain.DatasetCategory) *yoloExporter {
+	e := &yoloExporter{index: map[string]int{}, dirs: map[string]bool{}}
+	for i, c := range categories {
+		e.classes = append(e.classes, c.Name)
+		e.index[c.Name] = i
+	}
+	return e
+}
+
+func (e *yoloExporter) addFrame(archive *zip.Writer, frame *domain.DatasetFrame, dir, name string, image []byte) error {
+	e.dirs[dir] = true
+	if image != nil {
+		if err := writeZipFile(archive, "images/"+dir+"/"+name, image); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	w, h := float64(frame.Width), float64(frame.Height)
+	for _, box := range frame.Boxes {
+		class, ok := e.index[box.Class]
+		if !ok {
+			continue
+		}
+		b := box.BBox
+		fmt.Fprintf(&buf, "%d %.6f %.6f %.6f %.6f\n", class, (b[0]+b[2]/2)/w, (b[1]+b[3]/2)/h, b[2]/w, b[3]/h)
+	}
+	return writeZipFile(archive, "labels/"+dir+"/"+strings.TrimSuffix(name, path.Ext(name))+".txt", buf.Bytes())
+}
+
+func (e *yoloExporter) finish(archive *zip.Writer) error {
+	if err := writeZipFile(archive, "classes.txt", []byte(strings.Join(e.classes, "\n")+"\n")); err != nil {
+		return err
+	}
+	var yaml strings.Builder
+	yaml.WriteString("path: .\n")
+	for _, split := range []domain.DatasetSplit{domain.SplitTrain, domain.SplitVal, domain.SplitTest} {
+		if e.dirs[string(split)] {
+			fmt.Fprintf(&yaml, "%s: images/%s\n", split, split)
+		}
+	}
+	fmt.Fprintf(&yaml, "nc: %d\nnames:\n", len(e.classes))
+	for _, class := range e.classes {
+		fmt.Fprintf(&yaml, "  - %s\n", strconv.Quote(class))
+	}
+	return writeZipFile(archive, "data.yaml", []byte(yaml.String()))
+}
+
+// ---- Pascal VOC ----
+
+type vocAnnotation struct {
+	XMLName  xml.Name    `xml:"annotation"`
+	Folder   string      `xml:"folder"`
+	Filename string      `xml:"filename"`
+	Size     vocSize     `xml:"size"`
+	Objects  []vocObject `xml:"object"`
+}
+
+type vocSize struct {
+	Width  int `xml:"width"`
+	Height int `xml:"height"`
+	Depth  int `xml:"depth"`
+}
+
+type vocObject struct {
+	Name      string    `xml:"name"`
+	Truncated int       `xml:"truncated"`
+	Difficult int       `xml:"difficult"`
+	BndBox    vocBndBox `xml:"bndbox"`
+}
+
+type vocBndBox struct {
+	XMin float64 `xml:"xmin"`
+	YMin float64 `xml:"ymin"`
+	XMax float64 `xml:"xmax"`
+	YMax float64 `xml:"ymax"`
+}
+
+func parseVOC(index *datasetArchive) ([]importedFrame, []string, error) {
+	// ImageSets/Main/train.txt 等文件每行一个图片名（不含扩展名）
+	splits := map[string]domain.DatasetSplit{}
+	for _, f := range index.files {
+		if !strings.Contains(f.Name, "ImageSets/") {
+			continue
+		}
+		split := domain.DatasetSplit(strings.TrimSuffix(path.Base(f.Name), ".txt"))
+		if split == domain.SplitNone || !split.IsValid() {
+			continue
+		}
+		data, err := readDatasetFile(f, maxAnnotationFileSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, stem := range strings.Fields(string(data)) {
+			splits[stem] = split
+		}
+	}
+
+	var samples []importedFrame
+	var skipped []string
+	for _, f := range index.files {
+		if strings.ToLower(path.Ext(f.Name)) != ".xml" {
+			continue
+		}
+		var ann vocAnnotation
+		if err := decodeZipXML(f, &ann); err != nil || ann.Filename == "" {
+			skipped = append(skipped, fmt.Sprintf("%s: not a VOC annotation", f.Name))
+			continue
+		}
+		file := index.findImage(ann.Filename, f.Name)
+		if file == nil && path.Ext(ann.Filename) == "" {
+			if file = index.findImage(ann.Filename+".jpg", f.Name); file == nil {
+				file = index.findImage(ann.Filename+".png", f.Name)
+			}
+		}
+		if file == nil {
+			skipped = append(skipped, fmt.Sprintf("%s: image %s not found in archive", f.Name, ann.Filename))
+			continue
+		}
+
+		stem := strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name))
+		split, ok := splits[stem]
+		if !ok {
+			split = splitFromPath(file.Name)
+		}
+		sample := importedFrame{name: ann.Filename, image: file, split: split}
+		for _, obj := range ann.Objects {
+			b := obj.BndBox
+			sample.boxes = append(sample.boxes, domain.Detection{
+				Class: obj.Name,
+				BBox:  [4]float64{b.XMin, b.YMin, b.XMax - b.XMin, b.YMax - b.YMin},
+			})
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 && len(skipped) == 0 {
+		return nil, nil, fmt.Errorf("%w: no VOC annotation file found in archive", domain.ErrInvalidInput)
+	}
+	return samples, skipped, nil
+}
+
+type vocExporter struct {
+	splits map[string][]string
+}
+
+func (e *vocExporter) addFrame(archive *zip.Writer, frame *domain.DatasetFrame, dir, name string, image []byte) error {
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	e.splits[dir] = append(e.splits[dir], stem)
+	if image != nil {
+		if err := writeZipFile(archive, "JPEGImages/"+name, image); err != nil {
+			return err
+		}
+	}
+
+	ann := vocAnnotation{
+		Folder:   "JPEGImages",
+		Filename: name,
+		Size:     vocSize{Width: frame.Width, Height: frame.Height, Depth: 3},
+		Objects:  []vocObject{},
+	}
+	for _, box := range frame.Boxes {
+		b := box.BBox
+		ann.Objects = append(ann.Objects, vocObject{
+			Name:   box.Class,
+			BndBox: vocBndBox{XMin: roundPixel(b[0]), YMin: roundPixel(b[1]), XMax: roundPixel(b[0] + b[2]), YMax: roundPixel(b[1] + b[3])},
+		})
+	}
+	data, err := xml.MarshalIndent(ann, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeZipFile(archive, "Annotations/"+stem+".xml", append([]byte(xml.Header), data...))
+}
+
+func (e *vocExporter) finish(archive *zip.Writer) error {
+	for _, dir := range sortedKeys(e.splits) {
+		if err := writeZipFile(archive, "ImageSets/Main/"+dir+".txt", []byte(strings.Join(e.splits[dir], "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---- helpers ----
+
+// datasetExporter 逐帧写入压缩包，finish 写入汇总的标注或索引文件
+type datasetExporter interface {
+	addFrame(archive *zip.Writer, frame *domain.DatasetFrame, dir, name string, image []byte) error
+	finish(archive *zip.Writer) error
+}
+
+// splitFromPath 根据路径中的 train、val（valid、validation）、test 判断划分，例如 images/train2017/、instances_val.json。
+// 目录名优先于文件名，靠近文件的目录优先
+func splitFromPath(name string) domain.DatasetSplit {
+	name = strings.ToLower(name)
+	for _, part := range []string{path.Dir(name), path.Base(name)} {
+		tokens := strings.FieldsFunc(part, func(r rune) bool { return !unicode.IsLetter(r) })
+		for i := len(tokens) - 1; i >= 0; i-- {
+			switch tokens[i] {
+			case "train", "training":
+				return domain.SplitTrain
+			case "val", "valid", "validation":
+				return domain.SplitVal
+			case "test", "testing":
+				return domain.SplitTest
+			}
+		}
+	}
+	return domain.SplitNone
+}
+
+// splitDir 导出时划分对应的目录名
+func splitDir(split domain.DatasetSplit) string {
+	if split == domain.SplitNone {
+		return "unassigned"
+	}
+	return string(split)
+}
+
+func isImageFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// readDatasetFile 读取压缩包中的文件，超过 limit 字节时返回错误
+func readDatasetFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", domain.ErrInvalidInput, f.Name)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", domain.ErrInvalidInput, f.Name)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is too large", domain.ErrInvalidInput, f.Name)
+	}
+	return data, nil
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func roundPixel(v float64) float64 {
+	return float64(int64(v + 0.5))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,589 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// DatasetRepository 所有查询都限定在 scope 所在的组织内
+type DatasetRepository interface {
+	Create(scope domain.TenantScope, dataset *domain.Dataset) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Dataset, error)
+	Find(scope domain.TenantScope, offset, limit int) ([]*domain.Dataset, int64, error)
+	Update(scope domain.TenantScope, dataset *domain.Dataset) error
+	Delete(scope domain.TenantScope, id uint) error
+	FindCategories(scope domain.TenantScope, datasetID uint) ([]*domain.DatasetCategory, error)
+	FindCategory(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetCategory, error)
+	CreateCategories(scope domain.TenantScope, categories []*domain.DatasetCategory) error
+	UpdateCategory(scope domain.TenantScope, category *domain.DatasetCategory) error
+	CreateFrames(scope domain.TenantScope, frames []*domain.DatasetFrame) error
+	FindFrame(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetFrame, error)
+	FindFrames(scope domain.TenantScope, datasetID uint, filter domain.FrameFilter) ([]*domain.DatasetFrame, int64, error)
+	FindFramesAfter(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit, afterID uint, limit int) ([]*domain.DatasetFrame, error)
+	FindFrameIDs(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit) ([]uint, error)
+	FindVideoTimestamps(scope domain.TenantScope, datasetID, videoID uint) ([]float64, error)
+	UpdateFrame(scope domain.TenantScope, frame *domain.DatasetFrame) error
+	UpdateSplits(scope domain.TenantScope, datasetID uint, splits map[domain.DatasetSplit][]uint) error
+	DeleteFrame(scope domain.TenantScope, datasetID, id uint) error
+	CountSplits(scope domain.TenantScope, datasetID uint) ([]domain.SplitCount, error)
+}
+
+const (
+	maxFramesPerImport = 5000
+	frameExportBatch   = 100
+)
+
+// DatasetInput 数据集的名称和说明
+type DatasetInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// FrameInput 新增的一帧。Image 为空时必须关联视频及时间点，图片尺寸未提供时使用视频的分辨率
+type FrameInput struct {
+	FileName  string
+	Image     []byte
+	VideoID   *uint
+	Timestamp *float64
+	Width     int
+	Height    int
+	Split     domain.DatasetSplit
+	Boxes     []domain.Detection
+	Source    string
+}
+
+// FrameUpdate 修改帧的划分或标注框，为 nil 的字段不修改
+type FrameUpdate struct {
+	Split *domain.DatasetSplit `json:"split"`
+	Boxes *[]domain.Detection  `json:"boxes"`
+}
+
+// SplitRatio 自动划分的比例，三者之和不必为 1，按比例换算。
+// 相同的 Seed 和帧集合总是得到相同的划分，便于复现实验
+type SplitRatio struct {
+	Train    float64 `json:"train"`
+	Val      float64 `json:"val"`
+	Test     float64 `json:"test"`
+	Seed     int64   `json:"seed"`
+	Reassign bool    `json:"reassign"` // 为 true 时重新划分全部帧，否则只划分尚未划分的帧
+}
+
+// DatasetSummary 数据集及其类别和各划分的帧数
+type DatasetSummary struct {
+	*domain.Dataset
+	Categories []*domain.DatasetCategory `json:"categories"`
+	Splits     []domain.SplitCount       `json:"splits"`
+}
+
+// DatasetImportResult 导入结果，Skipped 为无法导入的文件及原因
+type DatasetImportResult struct {
+	Frames     int      `json:"frames"`
+	Boxes      int      `json:"boxes"`
+	Categories int      `json:"new_categories"`
+	Skipped    []string `json:"skipped"`
+}
+
+// DatasetService 管理目标检测数据集：帧级标注框、类别到物种的映射、数据集划分，以及 COCO、YOLO、VOC 格式的导入导出
+type DatasetService struct {
+	repo            DatasetRepository
+	blobs           BlobStore
+	taxonomyService *TaxonomyService
+	videoService    *VideoService
+}
+
+func NewDatasetService(repo DatasetRepository, blobs BlobStore, taxonomyService *TaxonomyService, videoService *VideoService) *DatasetService {
+	return &DatasetService{
+		repo:            repo,
+		blobs:           blobs,
+		taxonomyService: taxonomyService,
+		videoService:    videoService,
+	}
+}
+
+func (s *DatasetService) CreateDataset(scope domain.TenantScope, userID uint, input DatasetInput) (*domain.Dataset, error) {
+	dataset := &domain.Dataset{CreatedBy: userID}
+	if err := applyDatasetInput(dataset, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(scope, dataset); err != nil {
+		return nil, err
+	}
+	return dataset, nil
+}
+
+func (s *DatasetService) GetDataset(scope domain.TenantScope, id uint) (*domain.Dataset, error) {
+	dataset, err := s.repo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if dataset == nil {
+		return nil, domain.ErrDatasetNotFound
+	}
+	return dataset, nil
+}
+
+// GetSummary 数据集详情，包含类别映射和各划分的帧数
+func (s *DatasetService) GetSummary(scope domain.TenantScope, id uint) (*DatasetSummary, error) {
+	dataset, err := s.GetDataset(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.repo.FindCategories(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := s.repo.CountSplits(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	return &DatasetSummary{Dataset: dataset, Categories: categories, Splits: splits}, nil
+}
+
+func (s *DatasetService) ListDatasets(scope domain.TenantScope, offset, limit int) ([]*domain.Dataset, int64, error) {
+	return s.repo.Find(scope, offset, limit)
+}
+
+func (s *DatasetService) UpdateDataset(scope domain.TenantScope, id uint, input DatasetInput) (*domain.Dataset, error) {
+	dataset, err := s.GetDataset(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyDatasetInput(dataset, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(scope, dataset); err != nil {
+		return nil, err
+	}
+	return dataset, nil
+}
+
+// DeleteDataset 删除数据集及其帧和类别。帧图片按内容寻址，可能被其他数据集引用，因此保留
+func (s *DatasetService) DeleteDataset(scope domain.TenantScope, id uint) error {
+	if _, err := s.GetDataset(scope, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(scope, id)
+}
+
+func (s *DatasetService) ListCategories(scope domain.TenantScope, datasetID uint) ([]*domain.DatasetCategory, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindCategories(scope, datasetID)
+}
+
+// MapCategory 将类别映射到物种库中的物种，speciesID 为 nil 时取消映射
+func (s *DatasetService) MapCategory(scope domain.TenantScope, datasetID, categoryID uint, speciesID *uint) (*domain.DatasetCategory, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	category, err := s.repo.FindCategory(scope, datasetID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, domain.ErrCategoryNotFound
+	}
+	if speciesID != nil {
+		if _, err := s.taxonomyService.getSpecies(*speciesID); err != nil {
+			return nil, err
+		}
+	}
+
+	category.SpeciesID = speciesID
+	if err := s.repo.UpdateCategory(scope, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// AddFrame 新增一帧。标注框中出现的新类别会自动创建，并尽量映射到同名物种
+func (s *DatasetService) AddFrame(scope domain.TenantScope, userID, datasetID uint, input FrameInput) (*domain.DatasetFrame, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	if (input.VideoID == nil) != (input.Timestamp == nil) {
+		return nil, fmt.Errorf("%w: video_id and timestamp must be provided together", domain.ErrInvalidInput)
+	}
+	if input.Image == nil && input.VideoID == nil {
+		return nil, fmt.Errorf("%w: image or video_id with timestamp is required", domain.ErrInvalidInput)
+	}
+
+	frame := &domain.DatasetFrame{DatasetID: datasetID, CreatedBy: userID}
+	if input.VideoID != nil {
+		video, err := s.videoService.GetVideo(scope, *input.VideoID)
+		if err != nil {
+			return nil, err
+		}
+		timestamp := *input.Timestamp
+		if !validNonNegative(timestamp) || (video.Duration > 0 && timestamp > video.Duration) {
+			return nil, fmt.Errorf("%w: timestamp must be within the video", domain.ErrInvalidInput)
+		}
+		frame.VideoID, frame.Timestamp = &video.ID, &timestamp
+		frame.Width, frame.Height = video.Width, video.Height
+		if input.Width > 0 && input.Height > 0 {
+			frame.Width, frame.Height = input.Width, input.Height
+		}
+	}
+	if input.Image != nil {
+		if err := s.attachImage(frame, input.Image); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyFrameInput(frame, input); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.ensureCategories(scope, datasetID, frame.Boxes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateFrames(scope, []*domain.DatasetFrame{frame}); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// AddVideoFrames 将视频标注中带检测框的标注加入数据集，每条标注成为一帧。
+// 数据集中已有同一视频同一时刻的帧时跳过该标注，重复调用不会产生重复的帧
+func (s *DatasetService) AddVideoFrames(scope domain.TenantScope, userID, datasetID, videoID uint, from, to *float64) ([]*domain.DatasetFrame, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	video, err := s.videoService.GetVideo(scope, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return nil, fmt.Errorf("%w: video width and height must be set before adding its frames", domain.ErrInvalidInput)
+	}
+	timestamps, err := s.repo.FindVideoTimestamps(scope, datasetID, videoID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[float64]bool, len(timestamps))
+	for _, t := range timestamps {
+		existing[t] = true
+	}
+
+	var frames []*domain.DatasetFrame
+	filter := domain.AnnotationFilter{From: from, To: to, Limit: maxAnnotationsPerRequest}
+	for {
+		annotations, _, err := s.videoService.ListAnnotations(scope, videoID, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range annotations {
+			if len(a.Detections) == 0 || existing[a.Timestamp] {
+				continue
+			}
+			if len(frames) == maxFramesPerImport {
+				return nil, fmt.Errorf("%w: at most %d frames per request, narrow the time range", domain.ErrInvalidInput, maxFramesPerImport)
+			}
+			timestamp := a.Timestamp
+			frame := &domain.DatasetFrame{
+				DatasetID: datasetID,
+				Width:     video.Width,
+				Height:    video.Height,
+				VideoID:   &video.ID,
+				Timestamp: &timestamp,
+				CreatedBy: userID,
+			}
+			if err := applyFrameInput(frame, FrameInput{Boxes: a.Detections, Source: a.Source}); err != nil {
+				return nil, fmt.Errorf("annotation %d: %w", a.ID, err)
+			}
+			existing[a.Timestamp] = true
+			frames = append(frames, frame)
+		}
+		if len(annotations) < filter.Limit {
+			break
+		}
+		filter.Offset += filter.Limit
+	}
+	if len(frames) == 0 {
+		return frames, nil
+	}
+
+	var boxes []domain.Detection
+	for _, f := range frames {
+		boxes = append(boxes, f.Boxes...)
+	}
+	if _, err := s.ensureCategories(scope, datasetID, boxes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateFrames(scope, frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+func (s *DatasetService) GetFrame(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetFrame, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	frame, err := s.repo.FindFrame(scope, datasetID, id)
+	if err != nil {
+		return nil, err
+	}
+	if frame == nil {
+		return nil, domain.ErrFrameNotFound
+	}
+	return frame, nil
+}
+
+func (s *DatasetService) ListFrames(scope domain.TenantScope, datasetID uint, filter domain.FrameFilter) ([]*domain.DatasetFrame, int64, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.FindFrames(scope, datasetID, filter)
+}
+
+// GetFrameImage 读取帧图片，只关联视频的帧返回 domain.ErrImageNotFound
+func (s *DatasetService) GetFrameImage(scope domain.TenantScope, datasetID, id uint) ([]byte, string, error) {
+	frame, err := s.GetFrame(scope, datasetID, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !frame.HasImage() {
+		return nil, "", domain.ErrImageNotFound
+	}
+	data, err := s.blobs.Get(frame.ImageKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, frameContentType(frame.ImageKey), nil
+}
+
+// UpdateFrame 修改帧的划分或标注框，人工修改后的标注框来源记为 manual
+func (s *DatasetService) UpdateFrame(scope domain.TenantScope, datasetID, id uint, update FrameUpdate) (*domain.DatasetFrame, error) {
+	frame, err := s.GetFrame(scope, datasetID, id)
+	if err != nil {
+		return nil, err
+	}
+	input := FrameInput{Split: frame.Split, Boxes: frame.Boxes, Source: frame.Source}
+	if update.Split != nil {
+		input.Split = *update.Split
+	}
+	if update.Boxes != nil {
+		input.Boxes, input.Source = *update.Boxes, "manual"
+	}
+	if err := applyFrameInput(frame, input); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.ensureCategories(scope, datasetID, frame.Boxes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateFrame(scope, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (s *DatasetService) DeleteFrame(scope domain.TenantScope, datasetID, id uint) error {
+	if _, err := s.GetFrame(scope, datasetID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteFrame(scope, datasetID, id)
+}
+
+// AssignSplits 按比例随机划分训练集、验证集和测试集，返回划分后各划分的帧数
+func (s *DatasetService) AssignSplits(scope domain.TenantScope, datasetID uint, ratio SplitRatio) ([]domain.SplitCount, error) {
+	if _, err := s.GetDataset(scope, datasetID); err != nil {
+		return nil, err
+	}
+	if !validNonNegative(ratio.Train) || !validNonNegative(ratio.Val) || !validNonNegative(ratio.Test) {
+		return nil, fmt.Errorf("%w: split ratios must not be negative", domain.ErrInvalidInput)
+	}
+	sum := ratio.Train + ratio.Val + ratio.Test
+	if sum <= 0 {
+		return nil, fmt.Errorf("%w: at least one split ratio must be positive", domain.ErrInvalidInput)
+	}
+
+	var only *domain.DatasetSplit
+	if !ratio.Reassign {
+		unassigned := domain.SplitNone
+		only = &unassigned
+	}
+	ids, err := s.repo.FindFrameIDs(scope, datasetID, only)
+	if err != nil {
+		return nil, err
+	}
+
+	rand.New(rand.NewSource(ratio.Seed)).Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+	n := float64(len(ids))
+	train := int(math.Round(n * ratio.Train / sum))
+	val := min(int(math.Round(n*ratio.Val/sum)), len(ids)-train)
+	if ratio.Test == 0 {
+		// 舍入余下的帧归入训练集，避免产生未要求的测试集
+		train = len(ids) - val
+	}
+	splits := map[domain.DatasetSplit][]uint{
+		domain.SplitTrain: ids[:train],
+		domain.SplitVal:   ids[train : train+val],
+		domain.SplitTest:  ids[train+val:],
+	}
+	if err := s.repo.UpdateSplits(scope, datasetID, splits); err != nil {
+		return nil, err
+	}
+	return s.repo.CountSplits(scope, datasetID)
+}
+
+// ensureCategories 为标注框中尚未登记的类别创建记录，能解析到物种库时自动映射物种，返回新建的类别数
+func (s *DatasetService) ensureCategories(scope domain.TenantScope, datasetID uint, boxes []domain.Detection) (int, error) {
+	if len(boxes) == 0 {
+		return 0, nil
+	}
+	categories, err := s.repo.FindCategories(scope, datasetID)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		known[c.Name] = true
+	}
+
+	var created []*domain.DatasetCategory
+	for _, box := range boxes {
+		if known[box.Class] {
+			continue
+		}
+		known[box.Class] = true
+		category := &domain.DatasetCategory{DatasetID: datasetID, Name: box.Class}
+		species, err := s.taxonomyService.ResolveSpecies(box.Class)
+		if err == nil {
+			category.SpeciesID = &species.ID
+		} else if !errors.Is(err, domain.ErrSpeciesNotFound) {
+			return 0, err
+		}
+		created = append(created, category)
+	}
+	if len(created) == 0 {
+		return 0, nil
+	}
+	if err := s.repo.CreateCategories(scope, created); err != nil {
+		return 0, err
+	}
+	return len(created), nil
+}
+
+// attachImage 校验并保存帧图片，图片尺寸取自图片本身
+func (s *DatasetService) attachImage(frame *domain.DatasetFrame, data []byte) error {
+	format, err := ValidateImage(data)
+	if err != nil {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: invalid image", domain.ErrInvalidInput)
+	}
+
+	sum := sha256.Sum256(data)
+	ext := ".jpg"
+	if format == "png" {
+		ext = ".png"
+	}
+	key := "datasets/" + hex.EncodeToString(sum[:]) + ext
+	if err := s.blobs.Put(key, data, "image/"+format); err != nil {
+		return err
+	}
+	frame.ImageKey, frame.Width, frame.Height = key, config.Width, config.Height
+	return nil
+}
+
+func applyDatasetInput(dataset *domain.Dataset, input DatasetInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > 128 {
+		return fmt.Errorf("%w: name is required and must be at most 128 characters", domain.ErrInvalidInput)
+	}
+	dataset.Name = name
+	dataset.Description = strings.TrimSpace(input.Description)
+	return nil
+}
+
+// applyFrameInput 校验并设置帧的划分和标注框。超出图片的标注框裁剪到图片范围内，
+// 检测模型输出的框常常略微越界；裁剪后没有面积的框视为无效
+func applyFrameInput(frame *domain.DatasetFrame, input FrameInput) error {
+	if frame.Width <= 0 || frame.Height <= 0 {
+		return fmt.Errorf("%w: frame width and height are required", domain.ErrInvalidInput)
+	}
+	if !input.Split.IsValid() {
+		return fmt.Errorf("%w: split must be train, val, test or empty", domain.ErrInvalidInput)
+	}
+	if len(input.Boxes) > maxDetectionsPerFrame {
+		return fmt.Errorf("%w: at most %d boxes per frame", domain.ErrInvalidInput, maxDetectionsPerFrame)
+	}
+	source := strings.TrimSpace(input.Source)
+	if utf8.RuneCountInString(source) > 32 {
+		return fmt.Errorf("%w: source must be at most 32 characters", domain.ErrInvalidInput)
+	}
+	if source == "" {
+		source = "manual"
+	}
+
+	boxes := make([]domain.Detection, 0, len(input.Boxes))
+	for i, box := range input.Boxes {
+		box.Class = strings.TrimSpace(box.Class)
+		if box.Class == "" || utf8.RuneCountInString(box.Class) > 128 {
+			return fmt.Errorf("%w: box %d: class is required and must be at most 128 characters", domain.ErrInvalidInput, i)
+		}
+		if box.Score < 0 || box.Score > 1 {
+			return fmt.Errorf("%w: box %d: score must be between 0 and 1", domain.ErrInvalidInput, i)
+		}
+		clipped, ok := clipBox(box.BBox, float64(frame.Width), float64(frame.Height))
+		if !ok {
+			return fmt.Errorf("%w: box %d: bbox must overlap the image", domain.ErrInvalidInput, i)
+		}
+		box.BBox = clipped
+		boxes = append(boxes, box)
+	}
+
+	frame.Split = input.Split
+	frame.Boxes = boxes
+	frame.Source = source
+	if input.FileName != "" {
+		frame.FileName = truncateRunes(input.FileName, 255)
+	}
+	return nil
+}
+
+// clipBox 将 [x, y, 宽, 高] 裁剪到图片范围内，裁剪后没有面积时返回 false
+func clipBox(bbox [4]float64, width, height float64) ([4]float64, bool) {
+	for _, v := range bbox {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return bbox, false
+		}
+	}
+	x0, y0 := math.Max(bbox[0], 0), math.Max(bbox[1], 0)
+	x1, y1 := math.Min(bbox[0]+bbox[2], width), math.Min(bbox[1]+bbox[3], height)
+	if x1 <= x0 || y1 <= y0 {
+		return bbox, false
+	}
+	return [4]float64{x0, y0, x1 - x0, y1 - y0}, true
+}
+
+func frameContentType(key string) string {
+	if strings.HasSuffix(key, ".png") {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// frameImageExt 导出时帧图片的扩展名，没有图片的帧按 .jpg 命名，便于从视频截取后直接放入
+func frameImageExt(frame *domain.DatasetFrame) string {
+	if strings.HasSuffix(frame.ImageKey, ".png") {
+		return ".png"
+	}
+	return ".jpg"
+}
@@ -0,0 +1,621 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memDatasetRepo 与数据库实现一样按 scope.OrgID 隔离数据集、类别和帧
+type memDatasetRepo struct {
+	mu         sync.Mutex
+	datasets   []*domain.Dataset
+	categories []*domain.DatasetCategory
+	frames     []*domain.DatasetFrame
+}
+
+func (r *memDatasetRepo) Create(scope domain.TenantScope, dataset *domain.Dataset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dataset.ID = uint(len(r.datasets) + 1)
+	dataset.OrgID = scope.OrgID
+	copied := *dataset
+	r.datasets = append(r.datasets, &copied)
+	return nil
+}
+
+func (r *memDatasetRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Dataset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.datasets {
+		if d.ID == id && d.OrgID == scope.OrgID {
+			copied := *d
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memDatasetRepo) Find(scope domain.TenantScope, offset, limit int) ([]*domain.Dataset, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Dataset
+	for _, d := range r.datasets {
+		if d.OrgID == scope.OrgID {
+			copied := *d
+			found = append(found, &copied)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(offset, len(found)):]
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, total, nil
+}
+
+func (r *memDatasetRepo) Update(scope domain.TenantScope, dataset *domain.Dataset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.datasets {
+		if d.ID == dataset.ID && d.OrgID == scope.OrgID {
+			copied := *dataset
+			r.datasets[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) Delete(scope domain.TenantScope, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	datasets := r.datasets[:0]
+	for _, d := range r.datasets {
+		if d.ID != id || d.OrgID != scope.OrgID {
+			datasets = append(datasets, d)
+		}
+	}
+	r.datasets = datasets
+	frames := r.frames[:0]
+	for _, f := range r.frames {
+		if f.DatasetID != id || f.OrgID != scope.OrgID {
+			frames = append(frames, f)
+		}
+	}
+	r.frames = frames
+	return nil
+}
+
+func (r *memDatasetRepo) FindCategories(scope domain.TenantScope, datasetID uint) ([]*domain.DatasetCategory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.DatasetCategory
+	for _, c := range r.categories {
+		if c.DatasetID == datasetID && c.OrgID == scope.OrgID {
+			copied := *c
+			found = append(found, &copied)
+		}
+	}
+	return found, nil
+}
+
+func (r *memDatasetRepo) FindCategory(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetCategory, error) {
+	categories, _ := r.FindCategories(scope, datasetID)
+	for _, c := range categories {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memDatasetRepo) CreateCategories(scope domain.TenantScope, categories []*domain.DatasetCategory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range categories {
+		c.ID = uint(len(r.categories) + 1)
+		c.OrgID = scope.OrgID
+		copied := *c
+		r.categories = append(r.categories, &copied)
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) UpdateCategory(scope domain.TenantScope, category *domain.DatasetCategory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.categories {
+		if c.ID == category.ID && c.OrgID == scope.OrgID {
+			c.SpeciesID = category.SpeciesID
+		}
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) CreateFrames(scope domain.TenantScope, frames []*domain.DatasetFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range frames {
+		f.ID = uint(len(r.frames) + 1)
+		f.OrgID = scope.OrgID
+		copied := *f
+		r.frames = append(r.frames, &copied)
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) FindFrame(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetFrame, error) {
+	for _, f := range r.matchingFrames(scope, datasetID, nil) {
+		if f.ID == id {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memDatasetRepo) FindFrames(scope domain.TenantScope, datasetID uint, filter domain.FrameFilter) ([]*domain.DatasetFrame, int64, error) {
+	var found []*domain.DatasetFrame
+	for _, f := range r.matchingFrames(scope, datasetID, filter.Split) {
+		if filter.VideoID == 0 || (f.VideoID != nil && *f.VideoID == filter.VideoID) {
+			found = append(found, f)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(filter.Offset, len(found)):]
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, total, nil
+}
+
+func (r *memDatasetRepo) FindFramesAfter(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit, afterID uint, limit int) ([]*domain.DatasetFrame, error) {
+	var found []*domain.DatasetFrame
+	for _, f := range r.matchingFrames(scope, datasetID, split) {
+		if f.ID > afterID && len(found) < limit {
+			found = append(found, f)
+		}
+	}
+	return found, nil
+}
+
+func (r *memDatasetRepo) FindFrameIDs(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit) ([]uint, error) {
+	var ids []uint
+	for _, f := range r.matchingFrames(scope, datasetID, split) {
+		ids = append(ids, f.ID)
+	}
+	return ids, nil
+}
+
+func (r *memDatasetRepo) FindVideoTimestamps(scope domain.TenantScope, datasetID, videoID uint) ([]float64, error) {
+	var timestamps []float64
+	for _, f := range r.matchingFrames(scope, datasetID, nil) {
+		if f.VideoID != nil && *f.VideoID == videoID && f.Timestamp != nil {
+			timestamps = append(timestamps, *f.Timestamp)
+		}
+	}
+	return timestamps, nil
+}
+
+func (r *memDatasetRepo) UpdateFrame(scope domain.TenantScope, frame *domain.DatasetFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, f := range r.frames {
+		if f.ID == frame.ID && f.OrgID == scope.OrgID {
+			copied := *frame
+			r.frames[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) UpdateSplits(scope domain.TenantScope, datasetID uint, splits map[domain.DatasetSplit][]uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for split, ids := range splits {
+		for _, id := range ids {
+			for _, f := range r.frames {
+				if f.ID == id && f.DatasetID == datasetID && f.OrgID == scope.OrgID {
+					f.Split = split
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) DeleteFrame(scope domain.TenantScope, datasetID, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	frames := r.frames[:0]
+	for _, f := range r.frames {
+		if f.ID != id || f.DatasetID != datasetID || f.OrgID != scope.OrgID {
+			frames = append(frames, f)
+		}
+	}
+	r.frames = frames
+	return nil
+}
+
+func (r *memDatasetRepo) CountSplits(scope domain.TenantScope, datasetID uint) ([]domain.SplitCount, error) {
+	counts := map[domain.DatasetSplit]int64{}
+	for _, f := range r.matchingFrames(scope, datasetID, nil) {
+		counts[f.Split]++
+	}
+	var result []domain.SplitCount
+	for split, n := range counts {
+		result = append(result, domain.SplitCount{Split: split, Frames: n})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Split < result[j].Split })
+	return result, nil
+}
+
+func (r *memDatasetRepo) matchingFrames(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit) []*domain.DatasetFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.DatasetFrame
+	for _, f := range r.frames {
+		if f.DatasetID == datasetID && f.OrgID == scope.OrgID && (split == nil || f.Split == *split) {
+			copied := *f
+			copied.Boxes = append([]domain.Detection(nil), f.Boxes...)
+			found = append(found, &copied)
+		}
+	}
+	return found
+}
+
+type datasetFixture struct {
+	service *DatasetService
+	repo    *memDatasetRepo
+	carpID  uint
+}
+
+func newDatasetFixture() *datasetFixture {
+	species := &memSpeciesRepo{}
+	f := &datasetFixture{repo: &memDatasetRepo{}}
+	f.carpID = species.add("鲤鱼", "Cyprinus carpio")
+	f.service = NewDatasetService(f.repo, newMemBlobStore(), NewTaxonomyService(&memTaxonomyRepo{species: species}, species), nil)
+	return f
+}
+
+func (f *datasetFixture) create(t *testing.T, scope domain.TenantScope) uint {
+	t.Helper()
+	dataset, err := f.service.CreateDataset(scope, 5, DatasetInput{Name: "东湖监控"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dataset.ID
+}
+
+// frameSummaries 按划分和标注框描述数据集中的帧，坐标取整，便于比较导入导出前后的内容
+func (f *datasetFixture) frameSummaries(t *testing.T, scope domain.TenantScope, datasetID uint) []string {
+	t.Helper()
+	frames, _, err := f.service.ListFrames(scope, datasetID, domain.FrameFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summaries []string
+	for _, frame := range frames {
+		var boxes []string
+		for _, b := range frame.Boxes {
+			boxes = append(boxes, fmt.Sprintf("%s@%.0f,%.0f,%.0f,%.0f", b.Class, b.BBox[0], b.BBox[1], b.BBox[2], b.BBox[3]))
+		}
+		sort.Strings(boxes)
+		summaries = append(summaries, fmt.Sprintf("%s[%s]", splitDir(frame.Split), strings.Join(boxes, ";")))
+	}
+	sort.Strings(summaries)
+	return summaries
+}
+
+func TestAddFrameValidation(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	datasetID := f.create(t, scope)
+	videoID := uint(3)
+
+	tests := []struct {
+		name  string
+		input FrameInput
+	}{
+		{"no image or video", FrameInput{}},
+		{"video without timestamp", FrameInput{VideoID: &videoID}},
+		{"invalid image", FrameInput{Image: []byte("not an image")}},
+		{"invalid split", FrameInput{Image: testPNG(t, 1), Split: "holdout"}},
+		{"box outside the image", FrameInput{Image: testPNG(t, 1), Boxes: []domain.Detection{{Class: "鲤鱼", BBox: [4]float64{40, 40, 5, 5}}}}},
+		{"score above 1", FrameInput{Image: testPNG(t, 1), Boxes: []domain.Detection{{Class: "鲤鱼", Score: 1.5, BBox: [4]float64{0, 0, 5, 5}}}}},
+		{"missing class", FrameInput{Image: testPNG(t, 1), Boxes: []domain.Detection{{Class: " ", BBox: [4]float64{0, 0, 5, 5}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := f.service.AddFrame(scope, 5, datasetID, tt.input); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("AddFrame = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+	if _, err := f.service.AddFrame(domain.TenantScope{OrgID: 2}, 5, datasetID, FrameInput{Image: testPNG(t, 1)}); !errors.Is(err, domain.ErrDatasetNotFound) {
+		t.Errorf("other org: err = %v, want ErrDatasetNotFound", err)
+	}
+}
+
+func TestAddFrameClipsBoxesAndMapsCategories(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	datasetID := f.create(t, scope)
+
+	frame, err := f.service.AddFrame(scope, 5, datasetID, FrameInput{
+		Image: testPNG(t, 1),
+		Boxes: []domain.Detection{
+			{Class: " 鲤鱼 ", Score: 0.8, BBox: [4]float64{-4, 20, 16, 20}},
+			{Class: "未知鱼", BBox: [4]float64{2, 2, 4, 4}},
+		},
+		Source: "coco-ssd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 越界的框裁剪到 32x32 的图片范围内
+	if frame.Width != 32 || frame.Height != 32 || frame.Boxes[0].Class != "鲤鱼" || frame.Boxes[0].BBox != [4]float64{0, 20, 12, 12} {
+		t.Errorf("frame = %dx%d, boxes %+v", frame.Width, frame.Height, frame.Boxes)
+	}
+
+	categories, err := f.service.ListCategories(scope, datasetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 2 || categories[0].SpeciesID == nil || *categories[0].SpeciesID != f.carpID || categories[1].SpeciesID != nil {
+		t.Fatalf("categories = %+v, want 鲤鱼 mapped and 未知鱼 unmapped", categories)
+	}
+	mapped, err := f.service.MapCategory(scope, datasetID, categories[1].ID, &f.carpID)
+	if err != nil || *mapped.SpeciesID != f.carpID {
+		t.Errorf("MapCategory = %+v, %v", mapped, err)
+	}
+	unknown := uint(99)
+	if _, err := f.service.MapCategory(scope, datasetID, categories[1].ID, &unknown); !errors.Is(err, domain.ErrSpeciesNotFound) {
+		t.Errorf("unknown species: err = %v, want ErrSpeciesNotFound", err)
+	}
+
+	// 人工修改后的标注框来源记为 manual
+	boxes := []domain.Detection{{Class: "草鱼", BBox: [4]float64{1, 1, 8, 8}}}
+	updated, err := f.service.UpdateFrame(scope, datasetID, frame.ID, FrameUpdate{Boxes: &boxes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Source != "manual" || len(updated.Boxes) != 1 {
+		t.Errorf("updated frame source/boxes = %q/%d, want manual/1", updated.Source, len(updated.Boxes))
+	}
+	if categories, _ := f.service.ListCategories(scope, datasetID); len(categories) != 3 {
+		t.Errorf("categories after update = %d, want 3", len(categories))
+	}
+}
+
+func TestAssignSplitsIsReproducible(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	datasetID := f.create(t, scope)
+	for i := 0; i < 10; i++ {
+		if _, err := f.service.AddFrame(scope, 5, datasetID, FrameInput{Image: testPNG(t, int64(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assign := func(ratio SplitRatio) string {
+		t.Helper()
+		if _, err := f.service.AssignSplits(scope, datasetID, ratio); err != nil {
+			t.Fatal(err)
+		}
+		frames, _, _ := f.service.ListFrames(scope, datasetID, domain.FrameFilter{})
+		var splits []string
+		for _, frame := range frames {
+			splits = append(splits, string(frame.Split))
+		}
+		return strings.Join(splits, ",")
+	}
+
+	first := assign(SplitRatio{Train: 8, Val: 2, Seed: 42})
+	if strings.Count(first, "train") != 8 || strings.Count(first, "val") != 2 {
+		t.Fatalf("splits = %s, want 8 train and 2 val", first)
+	}
+	// 不重新划分时已划分的帧保持不变
+	if again := assign(SplitRatio{Test: 1, Seed: 7}); again != first {
+		t.Errorf("splits changed without reassign: %s -> %s", first, again)
+	}
+	if again := assign(SplitRatio{Train: 8, Val: 2, Seed: 42, Reassign: true}); again != first {
+		t.Errorf("same seed gave %s, want %s", again, first)
+	}
+	if all := assign(SplitRatio{Test: 1, Reassign: true}); strings.Count(all, "test") != 10 {
+		t.Errorf("reassign to test = %s", all)
+	}
+
+	if _, err := f.service.AssignSplits(scope, datasetID, SplitRatio{Train: -1, Val: 2}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("negative ratio: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := f.service.AssignSplits(scope, datasetID, SplitRatio{}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("zero ratios: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestDatasetExportImportRoundTrip(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	source := f.create(t, scope)
+	frames := []FrameInput{
+		{Image: testPNG(t, 1), Split: domain.SplitTrain, Boxes: []domain.Detection{{Class: "鲤鱼", BBox: [4]float64{4, 4, 10, 8}}}},
+		{Image: testPNG(t, 2), Split: domain.SplitVal, Boxes: []domain.Detection{
+			{Class: "草鱼", BBox: [4]float64{0, 0, 16, 16}},
+			{Class: "鲤鱼", BBox: [4]float64{16, 16, 16, 16}},
+		}},
+		{Image: testPNG(t, 3)},
+	}
+	for _, input := range frames {
+		if _, err := f.service.AddFrame(scope, 5, source, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := f.frameSummaries(t, scope, source)
+
+	for _, format := range []DatasetFormat{DatasetCOCO, DatasetYOLO, DatasetVOC} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.service.Export(scope, source, format, nil, &buf); err != nil {
+				t.Fatal(err)
+			}
+			target := f.create(t, scope)
+			result, err := f.service.Import(scope, 5, target, format, buf.Bytes(), domain.SplitNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Frames != 3 || result.Boxes != 3 || result.Categories != 2 || len(result.Skipped) != 0 {
+				t.Errorf("import result = %+v", result)
+			}
+			got := f.frameSummaries(t, scope, target)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("imported frames = %v, want %v", got, want)
+			}
+		})
+	}
+
+	// 只导出指定划分
+	var buf bytes.Buffer
+	val := domain.SplitVal
+	if err := f.service.Export(scope, source, DatasetCOCO, &val, &buf); err != nil {
+		t.Fatal(err)
+	}
+	target := f.create(t, scope)
+	if result, err := f.service.Import(scope, 5, target, DatasetCOCO, buf.Bytes(), domain.SplitNone); err != nil || result.Frames != 1 {
+		t.Errorf("import of val split = %+v, %v, want one frame", result, err)
+	}
+}
+
+func TestImportCOCOSkipsInvalidSamples(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	datasetID := f.create(t, scope)
+	archive := zipOf(t, map[string]string{
+		"train2017/a.png": string(testPNG(t, 1)),
+		"annotations/instances_train2017.json": `{
+			"images": [{"id": 1, "file_name": "a.png"}, {"id": 2, "file_name": "missing.png"}],
+			"annotations": [
+				{"id": 1, "image_id": 1, "category_id": 1, "bbox": [2, 2, 8, 8], "score": 0.7},
+				{"id": 2, "image_id": 1, "category_id": 9, "bbox": [2, 2, 8, 8]}
+			],
+			"categories": [{"id": 1, "name": "鲤鱼"}]
+		}`,
+	})
+
+	result, err := f.service.Import(scope, 5, datasetID, DatasetCOCO, archive, domain.SplitNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Frames != 1 || result.Boxes != 1 || len(result.Skipped) != 2 {
+		t.Errorf("import result = %+v, want 1 frame, 1 box and 2 skipped", result)
+	}
+	if got := f.frameSummaries(t, scope, datasetID); len(got) != 1 || got[0] != "train[鲤鱼@2,2,8,8]" {
+		t.Errorf("frames = %v", got)
+	}
+
+	if _, err := f.service.Import(scope, 5, datasetID, DatasetCOCO, zipOf(t, map[string]string{"a.png": string(testPNG(t, 1))}), domain.SplitNone); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("archive without annotations: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := f.service.Import(scope, 5, datasetID, DatasetCOCO, []byte("not a zip"), domain.SplitNone); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid archive: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestImportYOLOConvertsNormalizedBoxes(t *testing.T) {
+	f := newDatasetFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	datasetID := f.create(t, scope)
+	archive := zipOf(t, map[string]string{
+		"obj.names":       "鲤鱼\n草鱼\n",
+		"images/a.png":    string(testPNG(t, 1)),
+		"labels/a.txt":    "1 0.5 0.5 0.5 0.25\n",
+		"images/b.png":    string(testPNG(t, 2)),
+		"images/c.png":    string(testPNG(t, 3)),
+		"labels/c.txt":    "7 0.5 0.5 0.5 0.25\n",
+		"images/notes.md": "ignored",
+	})
+
+	// 没有标注文件的图片作为负样本导入，类别序号越界的标注文件跳过
+	result, err := f.service.Import(scope, 5, datasetID, DatasetYOLO, archive, domain.SplitTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Frames != 2 || len(result.Skipped) != 1 {
+		t.Errorf("import result = %+v, want 2 frames and 1 skipped", result)
+	}
+	got := f.frameSummaries(t, scope, datasetID)
+	if strings.Join(got, " ") != "test[] test[草鱼@8,12,16,8]" {
+		t.Errorf("frames = %v", got)
+	}
+
+	if _, err := f.service.Import(scope, 5, datasetID, DatasetYOLO, zipOf(t, map[string]string{"images/a.png": string(testPNG(t, 1))}), domain.SplitNone); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("archive without classes: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestParseYOLOLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", "0 0.5 0.5 0.5 0.25\n\n1 0.1 0.2 0.1 0.2 0.9\n", false},
+		{"wrong field count", "0 0.5 0.5 0.5\n", true},
+		{"unknown class", "2 0.5 0.5 0.5 0.25\n", true},
+		{"not a number", "0 0.5 x 0.5 0.25\n", true},
+		{"nan", "0 NaN 0.5 0.5 0.25\n", true},
+		{"inf", "0 0.5 0.5 +Inf 0.25\n", true},
+		{"negative", "0 -0.1 0.5 0.5 0.25\n", true},
+		{"above one", "0 0.5 0.5 1.5 0.25\n", true},
+		{"score above one", "0 0.5 0.5 0.5 0.25 2\n", true},
+		// 超过扫描缓冲区的行不能被静默截断
+		{"line too long", "0 0.5 0.5 0.5 0.25 " + strings.Repeat("0", 70000) + "\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := zipOf(t, map[string]string{"labels/a.txt": tt.content})
+			reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			boxes, err := parseYOLOLabel(reader.File[0], []string{"鲤鱼", "草鱼"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseYOLOLabel = %v, want error", boxes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(boxes) != 2 || boxes[1].Class != "草鱼" || boxes[1].Score != 0.9 || boxes[0].BBox != [4]float64{0.25, 0.375, 0.5, 0.25} {
+				t.Errorf("boxes = %+v", boxes)
+			}
+		})
+	}
+}
+
+func TestSplitFromPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want domain.DatasetSplit
+	}{
+		{"images/train2017/a.jpg", domain.SplitTrain},
+		{"annotations/instances_val.json", domain.SplitVal},
+		{"data/validation/images/a.jpg", domain.SplitVal},
+		{"test/train/a.jpg", domain.SplitTrain},
+		{"images/a_test.jpg", domain.SplitTest},
+		{"images/unassigned/a.jpg", domain.SplitNone},
+	}
+	for _, tt := range tests {
+		if got := splitFromPath(tt.name); got != tt.want {
+			t.Errorf("splitFromPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	minImageSize = 1024
+	// MaxImageSize 上传图片的大小上限
+	MaxImageSize = 4 * 1024 * 1024
+	// maxImagePixels 图片的像素数上限。压缩率很高的小文件也可能声明极大的尺寸，解码后占用数GB内存
+	maxImagePixels = 40_000_000
+)
+
+// ValidateImage 检查上传图片的大小、尺寸和格式，返回图片格式（jpeg 或 png）。
+// 先只读取文件头中的尺寸，超过像素上限的图片不会被解码
+func ValidateImage(data []byte) (string, error) {
+	if len(data) < minImageSize {
+		return "", fmt.Errorf("图片文件过小（至少需要1KB）")
+	}
+	if len(data) > MaxImageSize {
+		return "", fmt.Errorf("图片文件过大（最大支持4MB）")
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("无效的图片格式")
+	}
+	if format != "jpeg" && format != "png" {
+		return "", fmt.Errorf("只支持JPEG和PNG格式")
+	}
+	if !withinPixelLimit(config) {
+		return "", fmt.Errorf("图片尺寸过大（最多%d万像素）", maxImagePixels/10000)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("无效的图片格式")
+	}
+	return format, nil
+}
+
+// withinPixelLimit 图片尺寸有效且像素数不超过上限
+func withinPixelLimit(config image.Config) bool {
+	return config.Width > 0 && config.Height > 0 && int64(config.Width)*int64(config.Height) <= maxImagePixels
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// ImageEnhancer 图片预处理流水线，steps 为空时执行默认步骤，返回 JPEG 图片。
+// 包含未知步骤时返回包装了 domain.ErrInvalidInput 的错误
+type ImageEnhancer interface {
+	Enhance(data []byte, steps []string) ([]byte, error)
+}
+
+// 预处理选项的特殊取值，其余取值为逗号分隔的步骤列表
+const (
+	EnhanceNone    = "none"
+	EnhanceDefault = "default"
+)
+
+// ImageService 图片预处理
+type ImageService struct {
+	enhancer ImageEnhancer
+}
+
+func NewImageService(enhancer ImageEnhancer) *ImageService {
+	return &ImageService{enhancer: enhancer}
+}
+
+// Enhance 校验图片后执行预处理。spec 为 default 或逗号分隔的步骤列表，为空时等同 default
+func (s *ImageService) Enhance(data []byte, spec string) ([]byte, error) {
+	if _, err := ValidateImage(data); err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	spec = normalizeEnhanceSpec(spec)
+	if spec == EnhanceNone {
+		return nil, fmt.Errorf("%w: no preprocessing steps selected", domain.ErrInvalidInput)
+	}
+	return s.enhancer.Enhance(data, enhanceSteps(spec))
+}
+
+// normalizeEnhanceSpec 去掉多余空白、空项和重复项，空值视为 default
+func normalizeEnhanceSpec(spec string) string {
+	var parts []string
+	seen := map[string]bool{}
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" && !seen[p] {
+			seen[p] = true
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return EnhanceDefault
+	}
+	return strings.Join(parts, ",")
+}
+
+// enhanceSteps 将规范化后的选项转换为步骤列表，default 对应空列表
+func enhanceSteps(spec string) []string {
+	if spec == EnhanceDefault {
+		return nil
+	}
+	return strings.Split(spec, ",")
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// recordingEnhancer 记录收到的预处理步骤，返回固定的图片
+type recordingEnhancer struct {
+	calls [][]string
+}
+
+func (e *recordingEnhancer) Enhance(data []byte, steps []string) ([]byte, error) {
+	e.calls = append(e.calls, steps)
+	return []byte("enhanced"), nil
+}
+
+func TestImageServiceEnhanceSpec(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantSteps string
+		wantErr   error
+	}{
+		{"", "", nil},
+		{" Default ", "", nil},
+		{"clahe, WHITE_BALANCE,clahe,", "clahe,white_balance", nil},
+		{"none", "", domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			enhancer := &recordingEnhancer{}
+			_, err := NewImageService(enhancer).Enhance(testPNG(t, 1), tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enhance = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && strings.Join(enhancer.calls[0], ",") != tt.wantSteps {
+				t.Errorf("steps = %v, want %q", enhancer.calls[0], tt.wantSteps)
+			}
+		})
+	}
+
+	if _, err := NewImageService(&recordingEnhancer{}).Enhance([]byte("not an image"), ""); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid image: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+// 请求未指定预处理时使用服务的默认设置，指定时覆盖默认设置
+func TestRecognizeSelectsEnhancement(t *testing.T) {
+	var received []string
+	recognizer := recognizerFunc(func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		received = append(received, string(image[:min(len(image), 8)]))
+		return fixedRecognizer("鲤鱼")(ctx, image)
+	})
+	enhancer := &recordingEnhancer{}
+	service := NewRecognitionService(recognizer, NewTaxonomyService(&memTaxonomyRepo{species: &memSpeciesRepo{}}, &memSpeciesRepo{}),
+		&memRecognitionRepo{}, newMemBlobStore(), NewImageService(enhancer), "white_balance")
+
+	tests := []struct {
+		enhance      string
+		wantEnhance  string
+		wantEnhanced bool
+	}{
+		{"", "white_balance", true},
+		{"none", "none", false},
+		{"clahe", "clahe", true},
+	}
+	for _, tt := range tests {
+		received = nil
+		result, err := service.Recognize(context.Background(), RecognitionRequest{Scope: domain.TenantScope{OrgID: 1}, Image: testPNG(t, 1), Enhance: tt.enhance})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Enhance != tt.wantEnhance || (received[0] == "enhanced") != tt.wantEnhanced {
+			t.Errorf("enhance %q: result enhance = %q, recognizer got enhanced image %v", tt.enhance, result.Enhance, received[0] == "enhanced")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngWithSize 生成文件头声明为指定尺寸的 PNG，补齐到最小文件大小，实际像素数据只有一个像素
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 8 字节签名之后是 IHDR 块：长度、类型、宽、高……以及覆盖类型和数据的 CRC
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return append(data, make([]byte, minImageSize)...)
+}
+
+func TestValidateImageRejectsHugeDimensions(t *testing.T) {
+	_, err := ValidateImage(pngWithSize(t, 100000, 100000))
+	if err == nil || !strings.Contains(err.Error(), "尺寸过大") {
+		t.Fatalf("err = %v, want dimension error", err)
+	}
+}
+
+func TestValidateImageAcceptsPNG(t *testing.T) {
+	format, err := ValidateImage(pngWithSize(t, 1, 1))
+	if err != nil || format != "png" {
+		t.Fatalf("ValidateImage = %q, %v", format, err)
+	}
+}
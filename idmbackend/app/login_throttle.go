@@ -0,0 +1,220 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type LoginThrottleRepository interface {
+	Find(key string) (*domain.LoginThrottle, error)
+	Save(throttle *domain.LoginThrottle) error
+	Delete(key string) error
+	DeleteStale(before time.Time) error
+}
+
+// LoginThrottlePolicy 登录失败限制规则
+type LoginThrottlePolicy struct {
+	MaxAccountFailures int           // 账号连续失败达到该次数后临时锁定
+	LockoutDuration    time.Duration // 锁定时长，也是退避时间的上限
+	BackoffBase        time.Duration // 第二次失败起按 base*2^(n-2) 指数退避
+	MaxIPFailures      int           // 同一 IP 失败达到该次数后开始指数退避
+	FailureWindow      time.Duration // 超过该时间没有新的失败则计数清零
+}
+
+// ThrottledError 登录处于退避或锁定期
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", domain.ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return domain.ErrTooManyAttempts
+}
+
+// LoginThrottler 按账号和 IP 记录登录失败次数并计算退避时间。
+// 不存在的用户名与真实账号按同样的规则计数，避免通过锁定行为探测账号。
+type LoginThrottler struct {
+	repo   LoginThrottleRepository
+	clock  Clock
+	policy LoginThrottlePolicy
+
+	mu sync.Mutex // 串行化同一进程内的读改写，避免并发失败丢失计数
+}
+
+func NewLoginThrottler(repo LoginThrottleRepository, clock Clock, policy LoginThrottlePolicy) *LoginThrottler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	if policy.MaxAccountFailures <= 0 {
+		policy.MaxAccountFailures = 5
+	}
+	if policy.LockoutDuration <= 0 {
+		policy.LockoutDuration = 15 * time.Minute
+	}
+	if policy.BackoffBase <= 0 {
+		policy.BackoffBase = time.Second
+	}
+	if policy.MaxIPFailures <= 0 {
+		policy.MaxIPFailures = 20
+	}
+	if policy.FailureWindow <= 0 {
+		policy.FailureWindow = 15 * time.Minute
+	}
+	return &LoginThrottler{repo: repo, clock: clock, policy: policy}
+}
+
+// Check 返回账号或 IP 还需等待多久才能再次尝试登录，0 表示允许
+func (t *LoginThrottler) Check(username, ip string) (time.Duration, error) {
+	now := t.clock.Now()
+	var wait time.Duration
+	for _, key := range t.keys(username, ip) {
+		throttle, err := t.repo.Find(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := throttle.RetryAfter(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure 记录一次失败登录，返回本次失败是否导致账号被锁定
+func (t *LoginThrottler) RecordFailure(username, ip string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	account, err := t.increment(accountKey(username), now)
+	if err != nil {
+		return false, err
+	}
+	locked := false
+	switch {
+	case account.Failures >= t.policy.MaxAccountFailures:
+		until := now.Add(t.policy.LockoutDuration)
+		account.BlockedUntil = &until
+		locked = !account.Locked
+		account.Locked = true
+	case account.Failures >= 2:
+		until := now.Add(t.backoff(account.Failures - 2))
+		account.BlockedUntil = &until
+	}
+	if err := t.repo.Save(account); err != nil {
+		return false, err
+	}
+
+	if ip != "" {
+		byIP, err := t.increment(ipKey(ip), now)
+		if err != nil {
+			return locked, err
+		}
+		if byIP.Failures >= t.policy.MaxIPFailures {
+			until := now.Add(t.backoff(byIP.Failures - t.policy.MaxIPFailures))
+			byIP.BlockedUntil = &until
+			if byIP.Failures == t.policy.MaxIPFailures {
+				logSecurityEvent("ip_throttled", username, ip, fmt.Sprintf("failures=%d", byIP.Failures))
+			}
+		}
+		if err := t.repo.Save(byIP); err != nil {
+			return locked, err
+		}
+	}
+	return locked, nil
+}
+
+// RecordSuccess 登录成功后清除账号的失败计数。IP 计数不清除，
+// 否则攻击者可以用自己的账号穿插登录来重置计数。
+func (t *LoginThrottler) RecordSuccess(username string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.repo.Delete(accountKey(username)); err != nil {
+		return err
+	}
+	// 顺带清理过期记录，失败不影响登录
+	if err := t.repo.DeleteStale(t.clock.Now().Add(-t.policy.FailureWindow)); err != nil {
+		log.Printf("清理登录失败记录失败: %v", err)
+	}
+	return nil
+}
+
+// Unlock 解除账号锁定并清零失败计数
+func (t *LoginThrottler) Unlock(username string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.repo.Delete(accountKey(username))
+}
+
+// Status 返回账号当前的失败计数，没有记录时返回 nil
+func (t *LoginThrottler) Status(username string) (*domain.LoginThrottle, error) {
+	return t.repo.Find(accountKey(username))
+}
+
+// increment 读取计数并加一，超过统计窗口或锁定已到期的旧计数会被清零
+func (t *LoginThrottler) increment(key string, now time.Time) (*domain.LoginThrottle, error) {
+	throttle, err := t.repo.Find(key)
+	if err != nil {
+		return nil, err
+	}
+	expired := throttle != nil && throttle.RetryAfter(now) == 0 &&
+		(throttle.Locked || now.Sub(throttle.LastFailureAt) > t.policy.FailureWindow)
+	if throttle == nil || expired {
+		throttle = &domain.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	return throttle, nil
+}
+
+// backoff 第 n 次（从 0 开始）退避的时长，不超过锁定时长
+func (t *LoginThrottler) backoff(n int) time.Duration {
+	d := t.policy.BackoffBase
+	for i := 0; i < n && d < t.policy.LockoutDuration; i++ {
+		d *= 2
+	}
+	if d > t.policy.LockoutDuration {
+		d = t.policy.LockoutDuration
+	}
+	return d
+}
+
+func (t *LoginThrottler) keys(username, ip string) []string {
+	keys := []string{accountKey(username)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+func accountKey(username string) string {
+	return throttleKey("account:", strings.ToLower(strings.TrimSpace(username)))
+}
+
+func ipKey(ip string) string {
+	return throttleKey("ip:", ip)
+}
+
+// throttleKey 过长的值使用摘要，保证能放进主键列
+func throttleKey(prefix, value string) string {
+	if len(value) > 128 {
+		sum := sha256.Sum256([]byte(value))
+		value = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return prefix + value
+}
+
+// logSecurityEvent 以统一格式记录安全事件，便于日志检索和告警
+func logSecurityEvent(event, username, ip, detail string) {
+	log.Printf("[security] event=%s username=%q ip=%s %s", event, username, ip, detail)
+}
@@ -0,0 +1,293 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memThrottleRepo struct {
+	mu       sync.Mutex
+	throttle map[string]domain.LoginThrottle
+}
+
+func newMemThrottleRepo() *memThrottleRepo {
+	return &memThrottleRepo{throttle: make(map[string]domain.LoginThrottle)}
+}
+
+func (r *memThrottleRepo) Find(key string) (*domain.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.throttle[key]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (r *memThrottleRepo) Save(throttle *domain.LoginThrottle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.throttle[throttle.Key] = *throttle
+	return nil
+}
+
+func (r *memThrottleRepo) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttle, key)
+	return nil
+}
+
+func (r *memThrottleRepo) DeleteStale(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, t := range r.throttle {
+		if t.LastFailureAt.Before(before) && t.RetryAfter(before) == 0 {
+			delete(r.throttle, key)
+		}
+	}
+	return nil
+}
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var testThrottlePolicy = LoginThrottlePolicy{
+	MaxAccountFailures: 5,
+	LockoutDuration:    15 * time.Minute,
+	BackoffBase:        time.Second,
+	MaxIPFailures:      3,
+	FailureWindow:      15 * time.Minute,
+}
+
+func newTestThrottler() (*LoginThrottler, *fakeClock) {
+	clock := newFakeClock()
+	return NewLoginThrottler(newMemThrottleRepo(), clock, testThrottlePolicy), clock
+}
+
+func mustCheck(t *testing.T, throttler *LoginThrottler, username, ip string) time.Duration {
+	t.Helper()
+	wait, err := throttler.Check(username, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return wait
+}
+
+func mustFail(t *testing.T, throttler *LoginThrottler, username, ip string) bool {
+	t.Helper()
+	locked, err := throttler.RecordFailure(username, ip)
+	if err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	return locked
+}
+
+func TestLoginThrottleAccountBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		wait     time.Duration
+		locked   bool
+	}{
+		{1, 0, false},
+		{2, time.Second, false},
+		{3, 2 * time.Second, false},
+		{4, 4 * time.Second, false},
+		{5, 15 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		throttler, _ := newTestThrottler()
+		var locked bool
+		for i := 0; i < tt.failures; i++ {
+			locked = mustFail(t, throttler, "alice", "")
+		}
+		if got := mustCheck(t, throttler, "alice", ""); got != tt.wait {
+			t.Errorf("after %d failures: wait = %s, want %s", tt.failures, got, tt.wait)
+		}
+		if locked != tt.locked {
+			t.Errorf("after %d failures: locked = %t, want %t", tt.failures, locked, tt.locked)
+		}
+	}
+}
+
+func TestLoginThrottleBackoffIsCappedByLockout(t *testing.T) {
+	throttler, _ := newTestThrottler()
+	if got := throttler.backoff(30); got != testThrottlePolicy.LockoutDuration {
+		t.Errorf("backoff(30) = %s, want %s", got, testThrottlePolicy.LockoutDuration)
+	}
+}
+
+func TestLoginThrottleUsernameIsCaseInsensitive(t *testing.T) {
+	throttler, _ := newTestThrottler()
+	mustFail(t, throttler, "Alice", "")
+	mustFail(t, throttler, " alice ", "")
+	if got := mustCheck(t, throttler, "ALICE", ""); got != time.Second {
+		t.Errorf("wait = %s, want 1s", got)
+	}
+}
+
+func TestLoginThrottleLockoutExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		wait    time.Duration
+	}{
+		{"still locked", 14 * time.Minute, time.Minute},
+		{"lock expired", 15 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttler, clock := newTestThrottler()
+			for i := 0; i < testThrottlePolicy.MaxAccountFailures; i++ {
+				mustFail(t, throttler, "alice", "")
+			}
+			clock.Advance(tt.advance)
+			if got := mustCheck(t, throttler, "alice", ""); got != tt.wait {
+				t.Errorf("wait = %s, want %s", got, tt.wait)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleCountResetsAfterLockExpires(t *testing.T) {
+	throttler, clock := newTestThrottler()
+	for i := 0; i < testThrottlePolicy.MaxAccountFailures; i++ {
+		mustFail(t, throttler, "alice", "")
+	}
+	clock.Advance(testThrottlePolicy.LockoutDuration)
+
+	// 锁定到期后重新计数，第一次失败不再立即锁定
+	if locked := mustFail(t, throttler, "alice", ""); locked {
+		t.Error("first failure after lock expiry locked the account again")
+	}
+	if got := mustCheck(t, throttler, "alice", ""); got != 0 {
+		t.Errorf("wait = %s, want 0", got)
+	}
+}
+
+func TestLoginThrottleFailureWindow(t *testing.T) {
+	throttler, clock := newTestThrottler()
+	mustFail(t, throttler, "alice", "")
+	mustFail(t, throttler, "alice", "")
+	clock.Advance(testThrottlePolicy.FailureWindow + time.Second)
+
+	// 超过统计窗口的旧失败不再累计
+	mustFail(t, throttler, "alice", "")
+	status, err := throttler.Status("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures != 1 {
+		t.Errorf("failures = %d, want 1", status.Failures)
+	}
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	throttler, clock := newTestThrottler()
+	// 同一 IP 对不同账号的失败累计到 IP 上
+	users := []string{"u1", "u2", "u3", "u4"}
+	for _, u := range users[:testThrottlePolicy.MaxIPFailures] {
+		mustFail(t, throttler, u, "10.0.0.1")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		ip       string
+		wait     time.Duration
+	}{
+		{"fresh account from throttled ip", "u4", "10.0.0.1", time.Second},
+		{"same account from another ip", "u4", "10.0.0.2", 0},
+		{"no ip", "u4", "", 0},
+	}
+	for _, tt := range tests {
+		if got := mustCheck(t, throttler, tt.username, tt.ip); got != tt.wait {
+			t.Errorf("%s: wait = %s, want %s", tt.name, got, tt.wait)
+		}
+	}
+
+	// 继续失败时 IP 退避时间翻倍
+	clock.Advance(time.Second)
+	mustFail(t, throttler, "u4", "10.0.0.1")
+	if got := mustCheck(t, throttler, "u5", "10.0.0.1"); got != 2*time.Second {
+		t.Errorf("wait after another failure = %s, want 2s", got)
+	}
+}
+
+func TestLoginThrottleSuccessKeepsIPCount(t *testing.T) {
+	throttler, _ := newTestThrottler()
+	for i := 0; i < testThrottlePolicy.MaxIPFailures; i++ {
+		mustFail(t, throttler, "victim", "10.0.0.1")
+	}
+	if err := throttler.RecordSuccess("attacker"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCheck(t, throttler, "attacker", "10.0.0.1"); got == 0 {
+		t.Error("successful login from the same ip reset the ip throttle")
+	}
+}
+
+func TestLoginThrottleSuccessAndUnlock(t *testing.T) {
+	tests := []struct {
+		name  string
+		clear func(*LoginThrottler) error
+	}{
+		{"success", func(t *LoginThrottler) error { return t.RecordSuccess("alice") }},
+		{"unlock", func(t *LoginThrottler) error { return t.Unlock("alice") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttler, _ := newTestThrottler()
+			for i := 0; i < testThrottlePolicy.MaxAccountFailures; i++ {
+				mustFail(t, throttler, "alice", "")
+			}
+			if err := tt.clear(throttler); err != nil {
+				t.Fatal(err)
+			}
+			if got := mustCheck(t, throttler, "alice", ""); got != 0 {
+				t.Errorf("wait = %s, want 0", got)
+			}
+			status, err := throttler.Status("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != nil {
+				t.Errorf("status = %+v, want cleared", status)
+			}
+		})
+	}
+}
+
+func TestThrottledError(t *testing.T) {
+	err := error(&ThrottledError{RetryAfter: 90 * time.Second})
+	if !errors.Is(err, domain.ErrTooManyAttempts) {
+		t.Errorf("ThrottledError does not wrap ErrTooManyAttempts")
+	}
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter != 90*time.Second {
+		t.Errorf("errors.As = %+v", throttled)
+	}
+}
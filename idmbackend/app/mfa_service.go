@@ -0,0 +1,361 @@
+package app
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type MFARepository interface {
+	FindTOTP(userID uint) (*domain.TOTPEnrollment, error)
+	SaveTOTP(enrollment *domain.TOTPEnrollment) error
+	DeleteTOTP(userID uint) error
+	MarkStepUsed(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codes []*domain.RecoveryCode) error
+	UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error)
+	CountRecoveryCodes(userID uint) (int64, error)
+	SaveChallenge(challenge *domain.MFAChallenge) error
+	AttemptChallenge(tokenHash string, now time.Time, maxAttempts int) (*domain.MFAChallenge, error)
+	DeleteChallenge(tokenHash string) error
+	DeleteExpiredChallenges(before time.Time) error
+}
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	maxMFAChallengeAttempts = 5
+	recoveryCodeCount       = 10
+)
+
+// LoginResult 登录第一步的结果。启用两步验证的用户不会直接获得令牌，而是获得 MFAToken
+type LoginResult struct {
+	Tokens       *TokenPair
+	User         *domain.User
+	MFAToken     string
+	MFAExpiresIn int64
+}
+
+// MFAStatus 用户的两步验证状态
+type MFAStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"` // 用户角色是否被策略要求启用
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// MFAService TOTP 两步验证：绑定、登录第二步、恢复码，以及按角色强制启用的策略
+type MFAService struct {
+	mfaRepo       MFARepository
+	userRepo      UserRepository
+	authService   *AuthService
+	clock         Clock
+	issuer        string
+	requiredRoles map[domain.Role]bool
+}
+
+// NewMFAService issuer 显示在验证器应用中，requiredRoles 中的角色必须通过两步验证才能访问管理接口
+func NewMFAService(mfaRepo MFARepository, userRepo UserRepository, authService *AuthService, clock Clock, issuer string, requiredRoles []domain.Role) *MFAService {
+	if clock == nil {
+		clock = SystemClock
+	}
+	if issuer == "" {
+		issuer = "IDM"
+	}
+	required := make(map[domain.Role]bool, len(requiredRoles))
+	for _, role := range requiredRoles {
+		required[role] = true
+	}
+	return &MFAService{
+		mfaRepo:       mfaRepo,
+		userRepo:      userRepo,
+		authService:   authService,
+		clock:         clock,
+		issuer:        issuer,
+		requiredRoles: required,
+	}
+}
+
+// RequiresMFA 策略是否要求该角色使用通过两步验证的会话
+func (s *MFAService) RequiresMFA(role domain.Role) bool {
+	return s.requiredRoles[role]
+}
+
+// Login 校验密码，未启用两步验证时直接签发令牌，否则返回短期有效的 MFA 令牌
+func (s *MFAService) Login(username, password, ip string) (*LoginResult, error) {
+	user, err := s.authService.Authenticate(username, password, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.CompleteLogin(user, ip)
+}
+
+// CompleteLogin 第一步认证（密码或单点登录）通过后调用：未启用两步验证时直接签发令牌，
+// 否则保存登录挑战并返回短期有效的 MFA 令牌
+func (s *MFAService) CompleteLogin(user *domain.User, ip string) (*LoginResult, error) {
+	enrollment, err := s.mfaRepo.FindTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enrollment.Enabled() {
+		tokens, err := s.authService.Login(user, false, ip)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Tokens: tokens, User: user}, nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	if err := s.mfaRepo.SaveChallenge(&domain.MFAChallenge{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: now.Add(mfaChallengeTTL),
+	}); err != nil {
+		return nil, err
+	}
+	// 顺带清理过期的登录挑战，失败不影响登录
+	if err := s.mfaRepo.DeleteExpiredChallenges(now); err != nil {
+		log.Printf("清理过期登录挑战失败: %v", err)
+	}
+	return &LoginResult{User: user, MFAToken: token, MFAExpiresIn: int64(mfaChallengeTTL / time.Second)}, nil
+}
+
+// VerifyLogin 登录第二步：校验验证码或恢复码后签发通过两步验证的令牌。
+// 错误的验证码计入登录失败次数，同一 MFA 令牌最多尝试 5 次。
+func (s *MFAService) VerifyLogin(mfaToken, code, ip string) (*TokenPair, *domain.User, error) {
+	key := hashToken(mfaToken)
+	challenge, err := s.mfaRepo.AttemptChallenge(key, s.clock.Now(), maxMFAChallengeAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge == nil {
+		return nil, nil, domain.ErrInvalidMFAToken
+	}
+
+	ok, err := s.verifyCode(challenge.UserID, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		if err := s.authService.loginFailed(challenge.Username, ip); err != domain.ErrInvalidCredentials {
+			return nil, nil, err
+		}
+		logSecurityEvent("mfa_failed", challenge.Username, ip, "")
+		return nil, nil, domain.ErrInvalidMFACode
+	}
+	if err := s.mfaRepo.DeleteChallenge(key); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.userRepo.FindByID(challenge.UserID)
+	if err != nil || user == nil {
+		return nil, nil, domain.ErrInvalidMFAToken
+	}
+	tokens, err := s.authService.Login(user, true, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// BeginEnrollment 生成新的 TOTP 密钥，确认前不会生效。已启用时需先停用
+func (s *MFAService) BeginEnrollment(userID uint) (secret, uri string, err error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return "", "", domain.ErrUserNotFound
+	}
+	existing, err := s.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing.Enabled() {
+		return "", "", domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err = generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.mfaRepo.SaveTOTP(&domain.TOTPEnrollment{UserID: userID, Secret: secret}); err != nil {
+		return "", "", err
+	}
+	return secret, otpauthURI(s.issuer, user.Username, secret), nil
+}
+
+// ConfirmEnrollment 用验证码确认绑定并生成恢复码。当前会话被替换为通过两步验证的新会话
+func (s *MFAService) ConfirmEnrollment(userID uint, sessionID, code string) ([]string, *TokenPair, error) {
+	enrollment, err := s.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enrollment == nil {
+		return nil, nil, domain.ErrMFANotEnabled
+	}
+	if enrollment.Enabled() {
+		return nil, nil, domain.ErrMFAAlreadyEnabled
+	}
+	now := s.clock.Now()
+	step, ok := verifyTOTP(enrollment.Secret, normalizeCode(code), now)
+	if !ok {
+		return nil, nil, domain.ErrInvalidMFACode
+	}
+
+	enrollment.ConfirmedAt = &now
+	enrollment.LastUsedStep = step
+	if err := s.mfaRepo.SaveTOTP(enrollment); err != nil {
+		return nil, nil, err
+	}
+	codes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, nil, domain.ErrUserNotFound
+	}
+	if sessionID != "" {
+		if err := s.authService.LogoutSession(sessionID); err != nil {
+			log.Printf("吊销会话失败: %v", err)
+		}
+	}
+	tokens, err := s.authService.StartSession(user, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	logSecurityEvent("mfa_enabled", user.Username, "", "")
+	return codes, tokens, nil
+}
+
+// Disable 校验验证码或恢复码后停用两步验证，并吊销包括当前会话在内的全部会话。
+// 当前会话已通过两步验证，不能继续沿用，返回未通过两步验证的新令牌
+func (s *MFAService) Disable(userID uint, code string) (*TokenPair, error) {
+	if err := s.requireCode(userID, code); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if err := s.mfaRepo.DeleteTOTP(userID); err != nil {
+		return nil, err
+	}
+	if err := s.authService.LogoutAll(userID); err != nil {
+		return nil, err
+	}
+	tokens, err := s.authService.StartSession(user, false)
+	if err != nil {
+		return nil, err
+	}
+	logSecurityEvent("mfa_disabled", user.Username, "", "")
+	return tokens, nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后生成新的恢复码，旧恢复码全部失效
+func (s *MFAService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := s.requireCode(userID, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(userID)
+}
+
+// Status 查询用户的两步验证状态
+func (s *MFAService) Status(userID uint, role domain.Role) (*MFAStatus, error) {
+	enrollment, err := s.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Enabled: enrollment.Enabled(), Required: s.RequiresMFA(role)}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.mfaRepo.CountRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// AdminReset 管理员为丢失验证器的用户移除两步验证，并吊销其全部会话
+func (s *MFAService) AdminReset(userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return domain.ErrUserNotFound
+	}
+	if err := s.mfaRepo.DeleteTOTP(userID); err != nil {
+		return err
+	}
+	if err := s.authService.LogoutAll(userID); err != nil {
+		return err
+	}
+	logSecurityEvent("mfa_reset_by_admin", user.Username, "", "")
+	return nil
+}
+
+func (s *MFAService) requireCode(userID uint, code string) error {
+	enrollment, err := s.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !enrollment.Enabled() {
+		return domain.ErrMFANotEnabled
+	}
+	ok, err := s.verifyCode(userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// verifyCode 6 位数字按 TOTP 校验且每个时间步只能使用一次，其他输入按恢复码校验
+func (s *MFAService) verifyCode(userID uint, code string) (bool, error) {
+	code = normalizeCode(code)
+	enrollment, err := s.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	if !enrollment.Enabled() {
+		return false, nil
+	}
+
+	now := s.clock.Now()
+	if len(code) == totpDigits {
+		step, ok := verifyTOTP(enrollment.Secret, code, now)
+		if !ok {
+			return false, nil
+		}
+		return s.mfaRepo.MarkStepUsed(userID, step)
+	}
+	return s.mfaRepo.UseRecoveryCode(userID, hashToken(code), now)
+}
+
+// newRecoveryCodes 生成恢复码，明文只在此时返回一次
+func (s *MFAService) newRecoveryCodes(userID uint) ([]string, error) {
+	plain := make([]string, 0, recoveryCodeCount)
+	records := make([]*domain.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := generateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		plain = append(plain, code)
+		records = append(records, &domain.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeCode(code))})
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, records); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// normalizeCode 去掉空白和连字符并转为小写，方便用户输入
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,255 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memMFARepo struct {
+	mu         sync.Mutex
+	totp       map[uint]*domain.TOTPEnrollment
+	codes      []*domain.RecoveryCode
+	challenges map[string]*domain.MFAChallenge
+}
+
+func newMemMFARepo() *memMFARepo {
+	return &memMFARepo{totp: map[uint]*domain.TOTPEnrollment{}, challenges: map[string]*domain.MFAChallenge{}}
+}
+
+func (r *memMFARepo) FindTOTP(userID uint) (*domain.TOTPEnrollment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.totp[userID]; ok {
+		copied := *e
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *memMFARepo) SaveTOTP(enrollment *domain.TOTPEnrollment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *enrollment
+	r.totp[enrollment.UserID] = &copied
+	return nil
+}
+
+func (r *memMFARepo) DeleteTOTP(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.totp, userID)
+	return nil
+}
+
+func (r *memMFARepo) MarkStepUsed(userID uint, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.totp[userID]
+	if !ok || e.LastUsedStep >= step {
+		return false, nil
+	}
+	e.LastUsedStep = step
+	return true, nil
+}
+
+func (r *memMFARepo) ReplaceRecoveryCodes(userID uint, codes []*domain.RecoveryCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.codes[:0]
+	for _, c := range r.codes {
+		if c.UserID != userID {
+			kept = append(kept, c)
+		}
+	}
+	r.codes = append(kept, codes...)
+	return nil
+}
+
+func (r *memMFARepo) UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.codes {
+		if c.UserID == userID && c.CodeHash == codeHash && c.UsedAt == nil {
+			c.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memMFARepo) CountRecoveryCodes(userID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, c := range r.codes {
+		if c.UserID == userID && c.UsedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memMFARepo) SaveChallenge(challenge *domain.MFAChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *challenge
+	r.challenges[challenge.TokenHash] = &copied
+	return nil
+}
+
+func (r *memMFARepo) AttemptChallenge(tokenHash string, now time.Time, maxAttempts int) (*domain.MFAChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, ok := r.challenges[tokenHash]
+	if !ok || !ch.ExpiresAt.After(now) || ch.Attempts >= maxAttempts {
+		return nil, nil
+	}
+	ch.Attempts++
+	copied := *ch
+	return &copied, nil
+}
+
+func (r *memMFARepo) DeleteChallenge(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.challenges, tokenHash)
+	return nil
+}
+
+func (r *memMFARepo) DeleteExpiredChallenges(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, ch := range r.challenges {
+		if !ch.ExpiresAt.After(before) {
+			delete(r.challenges, k)
+		}
+	}
+	return nil
+}
+
+// enableTOTP 为用户直接写入已确认的 TOTP 密钥
+func enableTOTP(t *testing.T, env *testEnv, userID uint) string {
+	t.Helper()
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed := env.clock.Now()
+	if err := env.mfaRepo.SaveTOTP(&domain.TOTPEnrollment{UserID: userID, Secret: secret, ConfirmedAt: &confirmed}); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// totpAt 计算指定时刻的验证码
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, at.Unix()/int64(totpPeriod/time.Second))
+}
+
+func newMFAUser(t *testing.T, env *testEnv) (*domain.User, string) {
+	t.Helper()
+	user := &domain.User{Username: "erin", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user, enableTOTP(t, env, user.ID)
+}
+
+func TestMFAChallengeIsSingleUse(t *testing.T) {
+	env := newTestEnv()
+	user, secret := newMFAUser(t, env)
+	result, err := env.mfa.CompleteLogin(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MFAToken == "" || result.Tokens != nil {
+		t.Fatalf("CompleteLogin = %+v, want mfa challenge", result)
+	}
+	if len(env.mfaRepo.challenges) != 1 {
+		t.Fatalf("challenges = %d, want 1 persisted", len(env.mfaRepo.challenges))
+	}
+
+	if _, _, err := env.mfa.VerifyLogin(result.MFAToken, totpAt(t, secret, env.clock.Now()), ""); err != nil {
+		t.Fatalf("VerifyLogin: %v", err)
+	}
+	env.clock.Advance(totpPeriod)
+	if _, _, err := env.mfa.VerifyLogin(result.MFAToken, totpAt(t, secret, env.clock.Now()), ""); !errors.Is(err, domain.ErrInvalidMFAToken) {
+		t.Errorf("reused challenge: err = %v, want ErrInvalidMFAToken", err)
+	}
+}
+
+func TestMFAChallengeLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(env *testEnv, token string)
+	}{
+		{"expired", func(env *testEnv, token string) { env.clock.Advance(mfaChallengeTTL) }},
+		{"too many attempts", func(env *testEnv, token string) {
+			for i := 0; i < maxMFAChallengeAttempts; i++ {
+				env.mfa.VerifyLogin(token, "000000", "")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			user, secret := newMFAUser(t, env)
+			result, err := env.mfa.CompleteLogin(user, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(env, result.MFAToken)
+			if _, _, err := env.mfa.VerifyLogin(result.MFAToken, totpAt(t, secret, env.clock.Now()), ""); !errors.Is(err, domain.ErrInvalidMFAToken) {
+				t.Errorf("err = %v, want ErrInvalidMFAToken", err)
+			}
+		})
+	}
+}
+
+func TestMFADisableReplacesAllSessions(t *testing.T) {
+	env := newTestEnv()
+	user, secret := newMFAUser(t, env)
+	current, err := env.auth.StartSession(user, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.StartSession(user, true); err != nil {
+		t.Fatal(err)
+	}
+	token, err := env.auth.VerifyToken(current.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := env.auth.GetSessionIDFromToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := env.mfa.Disable(user.ID, totpAt(t, secret, env.clock.Now()))
+	if err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	// 已通过两步验证的当前会话不能继续用于要求两步验证的接口
+	if _, err := env.auth.CheckSession(sessionID); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("current session: err = %v, want ErrSessionRevoked", err)
+	}
+	if n := env.sessions.active(user.ID); n != 1 {
+		t.Errorf("active sessions = %d, want only the new one", n)
+	}
+	replaced, err := env.auth.VerifyToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.auth.GetMFAFromToken(replaced) {
+		t.Error("new session carries mfa=true after disabling TOTP")
+	}
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+// ObservationRepository 所有查询都限定在 scope 所在的组织内
+type ObservationRepository interface {
+	Create(scope domain.TenantScope, observation *domain.Observation) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Observation, error)
+	Find(scope domain.TenantScope, filter domain.ObservationFilter) ([]*domain.Observation, int64, error)
+	Update(scope domain.TenantScope, observation *domain.Observation) error
+	Delete(scope domain.TenantScope, id uint) error
+	CountBySpecies(scope domain.TenantScope, areaID string, from, to *time.Time) ([]domain.SpeciesCount, int64, error)
+	FindAreaIDs(scope domain.TenantScope) ([]string, error)
+}
+
+// RecognitionConfirmation 用户确认的一次识别结果，用于直接生成观测记录
+type RecognitionConfirmation struct {
+	Scope      domain.TenantScope
+	Name       string
+	SpeciesID  uint
+	Score      *float64
+	AreaID     string
+	ObservedAt time.Time
+	Count      int
+	Notes      string
+	Photo      []byte
+	ObserverID uint
+}
+
+type ObservationService struct {
+	observationRepo ObservationRepository
+	speciesRepo     SpeciesRepository
+	taxonomyService *TaxonomyService
+	blobs           BlobStore
+}
+
+func NewObservationService(observationRepo ObservationRepository, speciesRepo SpeciesRepository, taxonomyService *TaxonomyService, blobs BlobStore) *ObservationService {
+	return &ObservationService{
+		observationRepo: observationRepo,
+		speciesRepo:     speciesRepo,
+		taxonomyService: taxonomyService,
+		blobs:           blobs,
+	}
+}
+
+// CreateObservation 校验并保存观测记录，photo 可为空
+func (s *ObservationService) CreateObservation(scope domain.TenantScope, observation *domain.Observation, photo []byte) error {
+	if observation.ObservedAt.IsZero() {
+		observation.ObservedAt = time.Now()
+	}
+	if observation.Count == 0 {
+		observation.Count = 1
+	}
+	if err := s.validate(observation); err != nil {
+		return err
+	}
+
+	if len(photo) > 0 {
+		key, err := s.storePhoto(photo)
+		if err != nil {
+			return err
+		}
+		observation.PhotoKey = key
+	}
+
+	return s.observationRepo.Create(scope, observation)
+}
+
+func (s *ObservationService) GetObservation(scope domain.TenantScope, id uint) (*domain.Observation, error) {
+	observation, err := s.observationRepo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if observation == nil {
+		return nil, domain.ErrObservationNotFound
+	}
+	return observation, nil
+}
+
+func (s *ObservationService) ListObservations(scope domain.TenantScope, filter domain.ObservationFilter) ([]*domain.Observation, int64, error) {
+	return s.observationRepo.Find(scope, filter)
+}
+
+// UpdateObservation 更新观测记录，照片和记录人保持不变
+func (s *ObservationService) UpdateObservation(scope domain.TenantScope, observation *domain.Observation) error {
+	existing, err := s.GetObservation(scope, observation.ID)
+	if err != nil {
+		return err
+	}
+	if observation.ObservedAt.IsZero() {
+		observation.ObservedAt = existing.ObservedAt
+	}
+	if err := s.validate(observation); err != nil {
+		return err
+	}
+
+	observation.ObserverID = existing.ObserverID
+	observation.PhotoKey = existing.PhotoKey
+	observation.CreatedAt = existing.CreatedAt
+	observation.Species = nil
+	return s.observationRepo.Update(scope, observation)
+}
+
+// DeleteObservation 删除观测记录。照片按内容寻址，可能被其他记录引用，因此保留文件
+func (s *ObservationService) DeleteObservation(scope domain.TenantScope, id uint) error {
+	if _, err := s.GetObservation(scope, id); err != nil {
+		return err
+	}
+	return s.observationRepo.Delete(scope, id)
+}
+
+// SetPhoto 为已有观测记录上传或替换照片
+func (s *ObservationService) SetPhoto(scope domain.TenantScope, id uint, photo []byte) (*domain.Observation, error) {
+	observation, err := s.GetObservation(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.storePhoto(photo)
+	if err != nil {
+		return nil, err
+	}
+	observation.PhotoKey = key
+	observation.Species = nil
+	if err := s.observationRepo.Update(scope, observation); err != nil {
+		return nil, err
+	}
+	return observation, nil
+}
+
+func (s *ObservationService) GetPhoto(scope domain.TenantScope, id uint) ([]byte, error) {
+	observation, err := s.GetObservation(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if !observation.HasPhoto() {
+		return nil, domain.ErrImageNotFound
+	}
+	return s.blobs.Get(observation.PhotoKey)
+}
+
+// ConfirmRecognition 将用户确认的识别结果解析为规范物种并保存为观测记录
+func (s *ObservationService) ConfirmRecognition(input RecognitionConfirmation) (*domain.Observation, error) {
+	speciesID := input.SpeciesID
+	if speciesID == 0 {
+		species, err := s.taxonomyService.ResolveSpecies(input.Name)
+		if err != nil {
+			return nil, err
+		}
+		speciesID = species.ID
+	}
+
+	observation := &domain.Observation{
+		SpeciesID:        speciesID,
+		AreaID:           input.AreaID,
+		ObservedAt:       input.ObservedAt,
+		Count:            input.Count,
+		ObserverID:       input.ObserverID,
+		Method:           domain.MethodRecognition,
+		RecognitionScore: input.Score,
+		Notes:            input.Notes,
+	}
+	if err := s.CreateObservation(input.Scope, observation, input.Photo); err != nil {
+		return nil, err
+	}
+	return s.GetObservation(input.Scope, observation.ID)
+}
+
+// GetAreaDiversity 计算区域在时间范围内的物种丰富度和 Shannon 多样性指数
+func (s *ObservationService) GetAreaDiversity(scope domain.TenantScope, areaID string, from, to *time.Time) (*domain.AreaDiversity, error) {
+	counts, observations, err := s.observationRepo.CountBySpecies(scope, areaID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diversity := &domain.AreaDiversity{
+		AreaID:           areaID,
+		Observations:     observations,
+		SpeciesBreakdown: counts,
+	}
+	for _, c := range counts {
+		diversity.Individuals += c.Count
+	}
+	diversity.ShannonIndex, diversity.SpeciesRichness = shannonIndex(counts)
+	if diversity.SpeciesRichness > 1 {
+		diversity.ShannonEvenness = diversity.ShannonIndex / math.Log(float64(diversity.SpeciesRichness))
+	}
+	return diversity, nil
+}
+
+// GetAllAreaDiversity 计算每个有观测记录的区域的多样性指标
+func (s *ObservationService) GetAllAreaDiversity(scope domain.TenantScope, from, to *time.Time) ([]*domain.AreaDiversity, error) {
+	areaIDs, err := s.observationRepo.FindAreaIDs(scope)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*domain.AreaDiversity, 0, len(areaIDs))
+	for _, areaID := range areaIDs {
+		diversity, err := s.GetAreaDiversity(scope, areaID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, diversity)
+	}
+	return result, nil
+}
+
+// shannonIndex 计算 H' = -Σ p·ln(p)，同时返回个体数大于0的物种数
+func shannonIndex(counts []domain.SpeciesCount) (float64, int) {
+	var total int64
+	richness := 0
+	for _, c := range counts {
+		if c.Count > 0 {
+			total += c.Count
+			richness++
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+
+	h := 0.0
+	for _, c := range counts {
+		if c.Count <= 0 {
+			continue
+		}
+		p := float64(c.Count) / float64(total)
+		h -= p * math.Log(p)
+	}
+	return h, richness
+}
+
+func (s *ObservationService) validate(o *domain.Observation) error {
+	if o.SpeciesID == 0 {
+		return fmt.Errorf("%w: species_id is required", domain.ErrInvalidInput)
+	}
+	o.AreaID = strings.TrimSpace(o.AreaID)
+	if o.AreaID == "" {
+		return fmt.Errorf("%w: area_id is required", domain.ErrInvalidInput)
+	}
+	if o.Count < 1 {
+		return fmt.Errorf("%w: count must be at least 1", domain.ErrInvalidInput)
+	}
+	if o.Method == "" {
+		o.Method = domain.MethodVisual
+	}
+	if !o.Method.IsValid() {
+		return fmt.Errorf("%w: unknown method %q", domain.ErrInvalidInput, o.Method)
+	}
+	if (o.LengthCM != nil && *o.LengthCM <= 0) || (o.WeightG != nil && *o.WeightG <= 0) {
+		return fmt.Errorf("%w: length and weight must be positive", domain.ErrInvalidInput)
+	}
+	if o.ObservedAt.After(time.Now().Add(time.Hour)) {
+		return fmt.Errorf("%w: observed_at is in the future", domain.ErrInvalidInput)
+	}
+
+	species, err := s.speciesRepo.FindByID(o.SpeciesID)
+	if err != nil {
+		return err
+	}
+	if species == nil {
+		return domain.ErrSpeciesNotFound
+	}
+	return nil
+}
+
+// storePhoto 校验照片并按 EXIF 方向校正后以内容哈希为键保存
+func (s *ObservationService) storePhoto(photo []byte) (string, error) {
+	if _, err := ValidateImage(photo); err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	img, err := imaging.Decode(bytes.NewReader(photo), imaging.AutoOrientation(true))
+	if err != nil {
+		return "", fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(photo)
+	key := "observations/" + hex.EncodeToString(sum[:]) + ".jpg"
+	if err := s.blobs.Put(key, buf.Bytes(), "image/jpeg"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,326 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memObservationRepo 与数据库实现一样按 scope.OrgID 隔离记录
+type memObservationRepo struct {
+	mu           sync.Mutex
+	observations []*domain.Observation
+}
+
+func (r *memObservationRepo) Create(scope domain.TenantScope, observation *domain.Observation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	observation.OrgID = scope.OrgID
+	observation.ID = uint(len(r.observations) + 1)
+	copied := *observation
+	r.observations = append(r.observations, &copied)
+	return nil
+}
+
+func (r *memObservationRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Observation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.observations {
+		if o.ID == id && o.OrgID == scope.OrgID {
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memObservationRepo) Find(scope domain.TenantScope, filter domain.ObservationFilter) ([]*domain.Observation, int64, error) {
+	matched := r.filtered(scope, filter)
+	total := int64(len(matched))
+	if filter.Offset < len(matched) {
+		matched = matched[filter.Offset:]
+	} else {
+		matched = nil
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (r *memObservationRepo) Update(scope domain.TenantScope, observation *domain.Observation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, o := range r.observations {
+		if o.ID == observation.ID && o.OrgID == scope.OrgID {
+			observation.OrgID = scope.OrgID
+			copied := *observation
+			r.observations[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memObservationRepo) Delete(scope domain.TenantScope, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, o := range r.observations {
+		if o.ID == id && o.OrgID == scope.OrgID {
+			r.observations = append(r.observations[:i], r.observations[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memObservationRepo) CountBySpecies(scope domain.TenantScope, areaID string, from, to *time.Time) ([]domain.SpeciesCount, int64, error) {
+	matched := r.filtered(scope, domain.ObservationFilter{AreaID: areaID, From: from, To: to})
+	index := map[uint]int{}
+	var counts []domain.SpeciesCount
+	for _, o := range matched {
+		i, ok := index[o.SpeciesID]
+		if !ok {
+			i = len(counts)
+			index[o.SpeciesID] = i
+			counts = append(counts, domain.SpeciesCount{SpeciesID: o.SpeciesID})
+		}
+		counts[i].Count += int64(o.Count)
+	}
+	return counts, int64(len(matched)), nil
+}
+
+func (r *memObservationRepo) FindAreaIDs(scope domain.TenantScope) ([]string, error) {
+	seen := map[string]bool{}
+	var areaIDs []string
+	for _, o := range r.filtered(scope, domain.ObservationFilter{}) {
+		if !seen[o.AreaID] {
+			seen[o.AreaID] = true
+			areaIDs = append(areaIDs, o.AreaID)
+		}
+	}
+	sort.Strings(areaIDs)
+	return areaIDs, nil
+}
+
+func (r *memObservationRepo) filtered(scope domain.TenantScope, filter domain.ObservationFilter) []*domain.Observation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []*domain.Observation
+	for _, o := range r.observations {
+		switch {
+		case o.OrgID != scope.OrgID,
+			filter.SpeciesID != 0 && o.SpeciesID != filter.SpeciesID,
+			filter.AreaID != "" && o.AreaID != filter.AreaID,
+			len(filter.AreaIDs) > 0 && !containsFold(filter.AreaIDs, o.AreaID),
+			filter.From != nil && o.ObservedAt.Before(*filter.From),
+			filter.To != nil && o.ObservedAt.After(*filter.To):
+			continue
+		}
+		copied := *o
+		matched = append(matched, &copied)
+	}
+	return matched
+}
+
+type observationFixture struct {
+	service *ObservationService
+	repo    *memObservationRepo
+	blobs   *memBlobStore
+	carpID  uint
+	koiID   uint
+}
+
+func newObservationFixture() *observationFixture {
+	species := &memSpeciesRepo{}
+	f := &observationFixture{repo: &memObservationRepo{}, blobs: newMemBlobStore()}
+	f.carpID = species.add("鲤鱼", "Cyprinus carpio")
+	f.koiID = species.add("锦鲤", "Cyprinus rubrofuscus")
+	taxonomy := NewTaxonomyService(&memTaxonomyRepo{species: species}, species)
+	f.service = NewObservationService(f.repo, species, taxonomy, f.blobs)
+	return f
+}
+
+func TestCreateObservationValidation(t *testing.T) {
+	f := newObservationFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	negative := -1.0
+
+	tests := []struct {
+		name        string
+		observation domain.Observation
+		want        error
+	}{
+		{"defaults count and method", domain.Observation{SpeciesID: f.carpID, AreaID: " pond-a "}, nil},
+		{"missing species id", domain.Observation{AreaID: "pond-a"}, domain.ErrInvalidInput},
+		{"unknown species", domain.Observation{SpeciesID: 99, AreaID: "pond-a"}, domain.ErrSpeciesNotFound},
+		{"missing area", domain.Observation{SpeciesID: f.carpID, AreaID: "  "}, domain.ErrInvalidInput},
+		{"negative count", domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", Count: -2}, domain.ErrInvalidInput},
+		{"unknown method", domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", Method: "sonar"}, domain.ErrInvalidInput},
+		{"negative length", domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", LengthCM: &negative}, domain.ErrInvalidInput},
+		{"observed in the future", domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", ObservedAt: time.Now().Add(2 * time.Hour)}, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observation := tt.observation
+			err := f.service.CreateObservation(scope, &observation, nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateObservation = %v, want %v", err, tt.want)
+			}
+			if err == nil && (observation.Count != 1 || observation.Method != domain.MethodVisual || observation.AreaID != "pond-a") {
+				t.Errorf("count/method/area = %d/%q/%q, want 1/visual/pond-a", observation.Count, observation.Method, observation.AreaID)
+			}
+		})
+	}
+}
+
+func TestObservationsAreScopedToOrg(t *testing.T) {
+	f := newObservationFixture()
+	own, other := domain.TenantScope{OrgID: 1}, domain.TenantScope{OrgID: 2}
+	observation := &domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", ObserverID: 7}
+	if err := f.service.CreateObservation(own, observation, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.service.GetObservation(other, observation.ID); !errors.Is(err, domain.ErrObservationNotFound) {
+		t.Errorf("get from other org: err = %v, want ErrObservationNotFound", err)
+	}
+	if _, total, _ := f.service.ListObservations(other, domain.ObservationFilter{}); total != 0 {
+		t.Errorf("list from other org: total = %d, want 0", total)
+	}
+	update := &domain.Observation{ID: observation.ID, SpeciesID: f.koiID, AreaID: "pond-b"}
+	if err := f.service.UpdateObservation(other, update); !errors.Is(err, domain.ErrObservationNotFound) {
+		t.Errorf("update from other org: err = %v, want ErrObservationNotFound", err)
+	}
+	if err := f.service.DeleteObservation(other, observation.ID); !errors.Is(err, domain.ErrObservationNotFound) {
+		t.Errorf("delete from other org: err = %v, want ErrObservationNotFound", err)
+	}
+	if _, err := f.service.GetObservation(own, observation.ID); err != nil {
+		t.Errorf("observation gone after other org's delete: %v", err)
+	}
+}
+
+func TestUpdateObservationKeepsObserverAndPhoto(t *testing.T) {
+	f := newObservationFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	observation := &domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a", ObserverID: 7}
+	if err := f.service.CreateObservation(scope, observation, testPNG(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+	photoKey := observation.PhotoKey
+
+	update := &domain.Observation{ID: observation.ID, SpeciesID: f.koiID, AreaID: "pond-b", Count: 3, ObserverID: 99, PhotoKey: "elsewhere.jpg"}
+	if err := f.service.UpdateObservation(scope, update); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := f.service.GetObservation(scope, observation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SpeciesID != f.koiID || stored.Count != 3 {
+		t.Errorf("species/count = %d/%d, want %d/3", stored.SpeciesID, stored.Count, f.koiID)
+	}
+	if stored.ObserverID != 7 || stored.PhotoKey != photoKey {
+		t.Errorf("observer/photo = %d/%q, want 7/%q", stored.ObserverID, stored.PhotoKey, photoKey)
+	}
+	if !stored.ObservedAt.Equal(observation.ObservedAt) {
+		t.Errorf("observed_at = %v, want %v", stored.ObservedAt, observation.ObservedAt)
+	}
+}
+
+func TestObservationPhoto(t *testing.T) {
+	f := newObservationFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	observation := &domain.Observation{SpeciesID: f.carpID, AreaID: "pond-a"}
+	if err := f.service.CreateObservation(scope, observation, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.service.GetPhoto(scope, observation.ID); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("photo before upload: err = %v, want ErrImageNotFound", err)
+	}
+	if _, err := f.service.SetPhoto(scope, observation.ID, []byte("not an image")); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid photo: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := f.service.SetPhoto(scope, observation.ID, testPNG(t, 2)); err != nil {
+		t.Fatal(err)
+	}
+	photo, err := f.service.GetPhoto(scope, observation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 照片统一转存为 JPEG
+	if len(photo) < 3 || photo[0] != 0xFF || photo[1] != 0xD8 {
+		t.Errorf("stored photo is not a JPEG")
+	}
+	if _, err := f.service.GetPhoto(domain.TenantScope{OrgID: 2}, observation.ID); !errors.Is(err, domain.ErrObservationNotFound) {
+		t.Errorf("photo from other org: err = %v, want ErrObservationNotFound", err)
+	}
+}
+
+func TestConfirmRecognitionResolvesSpeciesName(t *testing.T) {
+	f := newObservationFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	score := 0.92
+
+	observation, err := f.service.ConfirmRecognition(RecognitionConfirmation{Scope: scope, Name: "锦鲤", Score: &score, AreaID: "pond-a", ObserverID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if observation.SpeciesID != f.koiID || observation.Method != domain.MethodRecognition || observation.Count != 1 {
+		t.Errorf("species/method/count = %d/%q/%d, want %d/recognition/1", observation.SpeciesID, observation.Method, observation.Count, f.koiID)
+	}
+	if observation.RecognitionScore == nil || *observation.RecognitionScore != score {
+		t.Errorf("recognition score = %v, want %v", observation.RecognitionScore, score)
+	}
+
+	if _, err := f.service.ConfirmRecognition(RecognitionConfirmation{Scope: scope, Name: "草鱼", AreaID: "pond-a"}); !errors.Is(err, domain.ErrSpeciesNotFound) {
+		t.Errorf("unknown name: err = %v, want ErrSpeciesNotFound", err)
+	}
+}
+
+func TestAreaDiversity(t *testing.T) {
+	f := newObservationFixture()
+	scope := domain.TenantScope{OrgID: 1}
+	for _, o := range []domain.Observation{
+		{SpeciesID: f.carpID, AreaID: "pond-a", Count: 3},
+		{SpeciesID: f.koiID, AreaID: "pond-a", Count: 1},
+		{SpeciesID: f.koiID, AreaID: "pond-a", Count: 2},
+		{SpeciesID: f.carpID, AreaID: "pond-b", Count: 5},
+	} {
+		if err := f.service.CreateObservation(scope, &o, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 其他组织的记录不参与统计
+	if err := f.service.CreateObservation(domain.TenantScope{OrgID: 2}, &domain.Observation{SpeciesID: f.koiID, AreaID: "pond-a", Count: 10}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := f.service.GetAllAreaDiversity(scope, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].AreaID != "pond-a" || all[1].AreaID != "pond-b" {
+		t.Fatalf("areas = %+v, want pond-a and pond-b", all)
+	}
+
+	// pond-a 两个物种各3个个体：H' = ln 2，均匀度为1
+	a := all[0]
+	if a.Observations != 3 || a.Individuals != 6 || a.SpeciesRichness != 2 {
+		t.Errorf("pond-a observations/individuals/richness = %d/%d/%d, want 3/6/2", a.Observations, a.Individuals, a.SpeciesRichness)
+	}
+	if math.Abs(a.ShannonIndex-math.Ln2) > 1e-9 || math.Abs(a.ShannonEvenness-1) > 1e-9 {
+		t.Errorf("pond-a shannon/evenness = %v/%v, want ln2/1", a.ShannonIndex, a.ShannonEvenness)
+	}
+
+	// 只有一个物种时多样性为0，均匀度无定义保持为0
+	b := all[1]
+	if b.SpeciesRichness != 1 || b.ShannonIndex != 0 || b.ShannonEvenness != 0 {
+		t.Errorf("pond-b richness/shannon/evenness = %d/%v/%v, want 1/0/0", b.SpeciesRichness, b.ShannonIndex, b.ShannonEvenness)
+	}
+}
@@ -0,0 +1,326 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type OrganizationRepository interface {
+	FindAll() ([]*domain.Organization, error)
+	FindByID(id uint) (*domain.Organization, error)
+	FindBySlug(slug string) (*domain.Organization, error)
+	Create(org *domain.Organization) error
+	FindMembership(orgID, userID uint) (*domain.Membership, error)
+	FindMembershipsByUser(userID uint) ([]*domain.Membership, error)
+	FindMembers(orgID uint, filter domain.UserFilter) ([]*domain.Membership, int64, error)
+	SaveMembership(membership *domain.Membership) error
+	DeleteMembership(orgID, userID uint) error
+	CountByRole(role domain.Role) (int64, error)
+	CountActiveMembersByRole(orgID uint, role domain.Role) (int64, error)
+}
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,63}$`)
+
+// OrgService 管理组织和成员。全局角色为 admin 的用户是平台管理员，可以进入任意组织并拥有管理员权限；
+// 其他用户在每个组织中的权限由成员身份上的角色决定。
+type OrgService struct {
+	orgRepo     OrganizationRepository
+	userRepo    UserRepository
+	roleService *RoleService
+	authService *AuthService
+}
+
+func NewOrgService(orgRepo OrganizationRepository, userRepo UserRepository, roleService *RoleService, authService *AuthService) *OrgService {
+	return &OrgService{
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+		roleService: roleService,
+		authService: authService,
+	}
+}
+
+// ListOrganizations 平台管理员返回全部组织，其他用户返回已加入的组织
+func (s *OrgService) ListOrganizations(principal *domain.Principal) ([]*domain.Organization, error) {
+	if principal.PlatformAdmin {
+		return s.orgRepo.FindAll()
+	}
+	memberships, err := s.orgRepo.FindMembershipsByUser(principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]*domain.Organization, 0, len(memberships))
+	for _, m := range memberships {
+		if m.Organization != nil {
+			orgs = append(orgs, m.Organization)
+		}
+	}
+	return orgs, nil
+}
+
+// CreateOrganization 创建组织，仅平台管理员可用
+func (s *OrgService) CreateOrganization(principal *domain.Principal, org *domain.Organization) error {
+	if !principal.PlatformAdmin {
+		return domain.ErrForbidden
+	}
+	org.Slug = strings.ToLower(strings.TrimSpace(org.Slug))
+	org.Name = strings.TrimSpace(org.Name)
+	if !orgSlugPattern.MatchString(org.Slug) {
+		return fmt.Errorf("%w: slug must be 2-64 lowercase letters, digits or '-'", domain.ErrInvalidInput)
+	}
+	if org.Name == "" {
+		return fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	if org.Kind == "" {
+		org.Kind = domain.OrgCompany
+	}
+	if !org.Kind.IsValid() {
+		return fmt.Errorf("%w: unknown organization kind %q", domain.ErrInvalidInput, org.Kind)
+	}
+
+	existing, err := s.orgRepo.FindBySlug(org.Slug)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: organization %q already exists", domain.ErrInvalidInput, org.Slug)
+	}
+	org.ID = 0
+	return s.orgRepo.Create(org)
+}
+
+// Switch 将当前会话切换到指定组织，非平台管理员只能切换到已加入的组织
+func (s *OrgService) Switch(principal *domain.Principal, orgID uint) (*domain.Organization, error) {
+	if principal.Kind != domain.PrincipalUser {
+		return nil, domain.ErrForbidden
+	}
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, domain.ErrOrgNotFound
+	}
+	if !principal.PlatformAdmin {
+		membership, err := s.orgRepo.FindMembership(orgID, principal.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if membership == nil {
+			return nil, domain.ErrNotOrgMember
+		}
+	}
+	if err := s.authService.SwitchOrg(principal.SessionID, orgID); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Resolve 确定用户在组织中的实际角色。非成员返回空角色和组织 0，看不到任何组织的数据
+func (s *OrgService) Resolve(userID uint, globalRole domain.Role, orgID uint) (domain.Role, uint, error) {
+	if globalRole == domain.RoleAdmin {
+		return domain.RoleAdmin, orgID, nil
+	}
+	if orgID == 0 {
+		return "", 0, nil
+	}
+	membership, err := s.orgRepo.FindMembership(orgID, userID)
+	if err != nil {
+		return "", 0, err
+	}
+	if membership == nil {
+		return "", 0, nil
+	}
+	return membership.Role, orgID, nil
+}
+
+// ListMembers 按条件分页查询组织成员
+func (s *OrgService) ListMembers(scope domain.TenantScope, filter domain.UserFilter) ([]*domain.Membership, int64, error) {
+	if scope.OrgID == 0 {
+		return nil, 0, domain.ErrOrgNotFound
+	}
+	filter.Query = strings.TrimSpace(filter.Query)
+	return s.orgRepo.FindMembers(scope.OrgID, filter)
+}
+
+// GetMember 获取组织成员身份及对应的用户
+func (s *OrgService) GetMember(scope domain.TenantScope, userID uint) (*domain.Membership, *domain.User, error) {
+	membership, err := s.orgRepo.FindMembership(scope.OrgID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if membership == nil {
+		return nil, nil, domain.ErrNotOrgMember
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, nil, domain.ErrUserNotFound
+	}
+	return membership, user, nil
+}
+
+// AddMember 将已有用户加入组织
+func (s *OrgService) AddMember(scope domain.TenantScope, userID uint, role domain.Role) (*domain.Membership, error) {
+	if scope.OrgID == 0 {
+		return nil, domain.ErrOrgNotFound
+	}
+	if _, err := s.roleService.GetRole(role); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	existing, err := s.orgRepo.FindMembership(scope.OrgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: user is already a member", domain.ErrInvalidInput)
+	}
+
+	membership := &domain.Membership{OrgID: scope.OrgID, UserID: userID, Role: role}
+	if err := s.orgRepo.SaveMembership(membership); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// SetMemberRole 修改成员在组织中的角色，成员创建的 API 密钥随之吊销。
+// 不能修改自己的角色；成员原来的角色和新角色的权限都不能超出操作者自己的权限
+func (s *OrgService) SetMemberRole(actor *domain.Principal, userID uint, role domain.Role) error {
+	if userID == actor.UserID {
+		return fmt.Errorf("%w: cannot change your own role", domain.ErrInvalidInput)
+	}
+	if err := s.ensureCanGrant(actor, role); err != nil {
+		return err
+	}
+	scope := actor.Scope()
+	membership, err := s.orgRepo.FindMembership(scope.OrgID, userID)
+	if err != nil {
+		return err
+	}
+	if membership == nil {
+		return domain.ErrNotOrgMember
+	}
+	if membership.Role == role {
+		return nil
+	}
+	if err := s.ensureCanGrant(actor, membership.Role); err != nil {
+		return err
+	}
+	if membership.Role == domain.RoleAdmin && role != domain.RoleAdmin {
+		if err := s.ensureOtherOrgAdmin(scope.OrgID); err != nil {
+			return err
+		}
+	}
+	membership.Role = role
+	if err := s.orgRepo.SaveMembership(membership); err != nil {
+		return err
+	}
+	return s.authService.RevokeAPIKeys(userID)
+}
+
+// RemoveMember 将用户移出组织，用户账号保留。不能移除组织中最后一位管理员
+func (s *OrgService) RemoveMember(scope domain.TenantScope, userID uint) error {
+	membership, err := s.orgRepo.FindMembership(scope.OrgID, userID)
+	if err != nil {
+		return err
+	}
+	if membership == nil {
+		return domain.ErrNotOrgMember
+	}
+	if membership.Role == domain.RoleAdmin {
+		if err := s.ensureOtherOrgAdmin(scope.OrgID); err != nil {
+			return err
+		}
+	}
+	return s.orgRepo.DeleteMembership(scope.OrgID, userID)
+}
+
+// EnsureMember 校验目标用户属于请求主体当前的组织，平台管理员不受限制
+func (s *OrgService) EnsureMember(principal *domain.Principal, userID uint) error {
+	if principal.PlatformAdmin {
+		return nil
+	}
+	return s.requireMember(principal.Scope(), userID)
+}
+
+// DefaultMembership 返回新用户以其全局角色加入默认组织的成员身份，默认组织不存在时返回 nil。
+// 成员身份需要与用户在同一事务中创建，避免留下不属于任何组织的账号
+func (s *OrgService) DefaultMembership(user *domain.User) (*domain.Membership, error) {
+	org, err := s.orgRepo.FindBySlug(domain.DefaultOrgSlug)
+	if err != nil || org == nil {
+		return nil, err
+	}
+	return &domain.Membership{OrgID: org.ID, Role: user.Role}, nil
+}
+
+// ensureCanGrant 角色的每项权限都被操作者当前的角色覆盖
+func (s *OrgService) ensureCanGrant(actor *domain.Principal, name domain.Role) error {
+	role, err := s.roleService.GetRole(name)
+	if err != nil {
+		return err
+	}
+	for _, p := range role.Permissions {
+		ok, err := s.roleService.HasPermission(actor.Role, p)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: role %q grants permission %q that you do not hold", domain.ErrForbidden, name, p)
+		}
+	}
+	return nil
+}
+
+func (s *OrgService) requireMember(scope domain.TenantScope, userID uint) error {
+	membership, err := s.orgRepo.FindMembership(scope.OrgID, userID)
+	if err != nil {
+		return err
+	}
+	if membership == nil {
+		return domain.ErrNotOrgMember
+	}
+	return nil
+}
+
+// ensureNotLastAdmin 停用用户前确认其不是最后一位平台管理员，也不是任一组织中最后一位管理员
+func (s *OrgService) ensureNotLastAdmin(user *domain.User) error {
+	if user.Role == domain.RoleAdmin {
+		count, err := s.userRepo.CountActiveByRole(domain.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return domain.ErrLastAdmin
+		}
+	}
+	memberships, err := s.orgRepo.FindMembershipsByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range memberships {
+		if m.Role != domain.RoleAdmin {
+			continue
+		}
+		if err := s.ensureOtherOrgAdmin(m.OrgID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureOtherOrgAdmin 组织中除即将移除的管理员外还有其他未停用的管理员
+func (s *OrgService) ensureOtherOrgAdmin(orgID uint) error {
+	count, err := s.orgRepo.CountActiveMembersByRole(orgID, domain.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return domain.ErrLastAdmin
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memOrgRepo struct {
+	mu          sync.Mutex
+	orgs        []*domain.Organization
+	memberships []*domain.Membership
+	// users 与数据库实现中的 users 表联接，按用户信息过滤成员
+	users *memUserRepo
+}
+
+// newMemOrgRepo 预置迁移创建的默认组织
+func newMemOrgRepo() *memOrgRepo {
+	return &memOrgRepo{orgs: []*domain.Organization{{ID: 1, Slug: domain.DefaultOrgSlug, Name: "默认组织", Kind: domain.OrgAgency}}}
+}
+
+func (r *memOrgRepo) FindAll() ([]*domain.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.Organization(nil), r.orgs...), nil
+}
+
+func (r *memOrgRepo) FindByID(id uint) (*domain.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.orgs {
+		if o.ID == id {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memOrgRepo) FindBySlug(slug string) (*domain.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.orgs {
+		if o.Slug == slug {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memOrgRepo) Create(org *domain.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	org.ID = uint(len(r.orgs) + 1)
+	r.orgs = append(r.orgs, org)
+	return nil
+}
+
+func (r *memOrgRepo) FindMembership(orgID, userID uint) (*domain.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.memberships {
+		if m.OrgID == orgID && m.UserID == userID {
+			copied := *m
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memOrgRepo) FindMembershipsByUser(userID uint) ([]*domain.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Membership
+	for _, m := range r.memberships {
+		if m.UserID == userID {
+			// 与数据库实现一样预加载成员所属的组织
+			copied := *m
+			for _, o := range r.orgs {
+				if o.ID == m.OrgID {
+					copied.Organization = o
+				}
+			}
+			found = append(found, &copied)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found, nil
+}
+
+// FindMembers 与数据库实现一样按用户名、显示名称或邮箱匹配关键字，按用户ID排序后分页并预加载用户
+func (r *memOrgRepo) FindMembers(orgID uint, filter domain.UserFilter) ([]*domain.Membership, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Membership
+	for _, m := range r.memberships {
+		if m.OrgID != orgID || (filter.Role != "" && m.Role != filter.Role) {
+			continue
+		}
+		user, _ := r.users.FindByID(m.UserID)
+		if user == nil {
+			continue
+		}
+		if filter.Query != "" && !strings.Contains(user.Username, filter.Query) && !strings.Contains(user.DisplayName, filter.Query) && !strings.Contains(user.Email, filter.Query) {
+			continue
+		}
+		if (filter.Status == domain.UserStatusActive && user.IsDisabled()) || (filter.Status == domain.UserStatusDisabled && !user.IsDisabled()) {
+			continue
+		}
+		copied := *m
+		copied.User = user
+		found = append(found, &copied)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].UserID < found[j].UserID })
+	total := int64(len(found))
+	found = found[min(filter.Offset, len(found)):]
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, total, nil
+}
+
+func (r *memOrgRepo) SaveMembership(membership *domain.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.memberships {
+		if m.OrgID == membership.OrgID && m.UserID == membership.UserID {
+			m.Role = membership.Role
+			return nil
+		}
+	}
+	membership.ID = uint(len(r.memberships) + 1)
+	r.memberships = append(r.memberships, membership)
+	return nil
+}
+
+func (r *memOrgRepo) DeleteMembership(orgID, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, m := range r.memberships {
+		if m.OrgID == orgID && m.UserID == userID {
+			r.memberships = append(r.memberships[:i], r.memberships[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memOrgRepo) CountByRole(role domain.Role) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, m := range r.memberships {
+		if m.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memOrgRepo) CountActiveMembersByRole(orgID uint, role domain.Role) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, m := range r.memberships {
+		if m.OrgID != orgID || m.Role != role {
+			continue
+		}
+		if user, _ := r.users.FindByID(m.UserID); user != nil && !user.IsDisabled() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestSetMemberRoleLimitedToActorPermissions(t *testing.T) {
+	env := newTestEnv()
+	for _, username := range []string{"manager", "staff", "lead"} {
+		if err := env.users.Create(&domain.User{Username: username, Role: domain.RoleUser}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// manager 在普通用户的权限之外持有 users:manage，lead 是组织管理员
+	manager := &domain.RoleDefinition{Name: "manager", Permissions: append([]domain.Permission{domain.PermUsersManage}, domain.FindBuiltInRole(domain.RoleUser).Permissions...)}
+	if err := env.roles.CreateRole(manager); err != nil {
+		t.Fatal(err)
+	}
+	for userID, role := range map[uint]domain.Role{1: "manager", 2: domain.RoleUser, 3: domain.RoleAdmin} {
+		if err := env.orgs.SaveMembership(&domain.Membership{OrgID: 1, UserID: userID, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actor := &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: "manager", OrgID: 1}
+
+	tests := []struct {
+		name   string
+		userID uint
+		role   domain.Role
+		want   error
+	}{
+		{"promote to admin", 2, domain.RoleAdmin, domain.ErrForbidden},
+		{"role with permissions the actor lacks", 2, domain.RoleResearcher, domain.ErrForbidden},
+		{"own membership", 1, domain.RoleAdmin, domain.ErrInvalidInput},
+		{"demote an admin", 3, domain.RoleUser, domain.ErrForbidden},
+		{"unknown role", 2, "ghost", domain.ErrRoleNotFound},
+		{"role within the actor's permissions", 2, "manager", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := env.orgSvc.SetMemberRole(actor, tt.userID, tt.role)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("SetMemberRole = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	membership, _ := env.orgs.FindMembership(1, 2)
+	if membership.Role != "manager" {
+		t.Errorf("member role = %q, want manager", membership.Role)
+	}
+	membership, _ = env.orgs.FindMembership(1, 3)
+	if membership.Role != domain.RoleAdmin {
+		t.Errorf("admin role = %q, want admin", membership.Role)
+	}
+}
+
+func TestCreateOrganization(t *testing.T) {
+	env := newTestEnv()
+	platformAdmin := &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: domain.RoleAdmin, PlatformAdmin: true}
+	orgAdmin := &domain.Principal{Kind: domain.PrincipalUser, UserID: 2, Role: domain.RoleAdmin, OrgID: 1}
+
+	tests := []struct {
+		name  string
+		actor *domain.Principal
+		org   domain.Organization
+		want  error
+	}{
+		{"platform admin", platformAdmin, domain.Organization{Slug: " East-Lake ", Name: "东湖研究站"}, nil},
+		{"org admin", orgAdmin, domain.Organization{Slug: "west-lake", Name: "西湖"}, domain.ErrForbidden},
+		{"duplicate slug", platformAdmin, domain.Organization{Slug: "east-lake", Name: "东湖"}, domain.ErrInvalidInput},
+		{"invalid slug", platformAdmin, domain.Organization{Slug: "东湖", Name: "东湖"}, domain.ErrInvalidInput},
+		{"missing name", platformAdmin, domain.Organization{Slug: "south-lake"}, domain.ErrInvalidInput},
+		{"unknown kind", platformAdmin, domain.Organization{Slug: "north-lake", Name: "北湖", Kind: "club"}, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := tt.org
+			err := env.orgSvc.CreateOrganization(tt.actor, &org)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateOrganization = %v, want %v", err, tt.want)
+			}
+			if err == nil && (org.Slug != "east-lake" || org.Kind != domain.OrgCompany) {
+				t.Errorf("slug/kind = %q/%q, want east-lake/company", org.Slug, org.Kind)
+			}
+		})
+	}
+}
+
+func TestSwitchOrgRequiresMembership(t *testing.T) {
+	env := newTestEnv()
+	lab := &domain.Organization{Slug: "lab", Name: "实验室", Kind: domain.OrgFarm}
+	if err := env.orgs.Create(lab); err != nil {
+		t.Fatal(err)
+	}
+	user := &domain.User{Username: "yara", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := env.auth.StartSession(user, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := env.auth.VerifyToken(tokens.AccessToken)
+	familyID, _ := env.auth.GetSessionIDFromToken(token)
+	principal := &domain.Principal{Kind: domain.PrincipalUser, UserID: user.ID, Role: domain.RoleUser, SessionID: familyID, OrgID: 1}
+
+	if _, err := env.orgSvc.Switch(principal, lab.ID); !errors.Is(err, domain.ErrNotOrgMember) {
+		t.Fatalf("switch to foreign org: err = %v, want ErrNotOrgMember", err)
+	}
+	if _, err := env.orgSvc.Switch(principal, 99); !errors.Is(err, domain.ErrOrgNotFound) {
+		t.Errorf("switch to missing org: err = %v, want ErrOrgNotFound", err)
+	}
+	apiKey := &domain.Principal{Kind: domain.PrincipalAPIKey, APIKeyID: 1, OrgID: 1}
+	if _, err := env.orgSvc.Switch(apiKey, 1); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("switch with api key: err = %v, want ErrForbidden", err)
+	}
+
+	if _, err := env.orgSvc.AddMember(domain.TenantScope{OrgID: lab.ID}, user.ID, domain.RoleResearcher); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.orgSvc.Switch(principal, lab.ID); err != nil {
+		t.Fatal(err)
+	}
+	session, err := env.auth.CheckSession(familyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.OrgID != lab.ID {
+		t.Errorf("session org = %d, want %d", session.OrgID, lab.ID)
+	}
+
+	orgs, err := env.orgSvc.ListOrganizations(principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].ID != lab.ID {
+		t.Errorf("organizations = %v, want only lab", orgs)
+	}
+}
+
+func TestResolveOrgRole(t *testing.T) {
+	env := newTestEnv()
+	if err := env.orgs.SaveMembership(&domain.Membership{OrgID: 1, UserID: 5, Role: domain.RoleResearcher}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		userID     uint
+		globalRole domain.Role
+		orgID      uint
+		wantRole   domain.Role
+		wantOrg    uint
+	}{
+		{"member uses membership role", 5, domain.RoleUser, 1, domain.RoleResearcher, 1},
+		{"non-member sees no org", 6, domain.RoleResearcher, 1, "", 0},
+		{"no org selected", 5, domain.RoleUser, 0, "", 0},
+		{"platform admin in any org", 7, domain.RoleAdmin, 3, domain.RoleAdmin, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, orgID, err := env.orgSvc.Resolve(tt.userID, tt.globalRole, tt.orgID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role != tt.wantRole || orgID != tt.wantOrg {
+				t.Errorf("Resolve = %q/%d, want %q/%d", role, orgID, tt.wantRole, tt.wantOrg)
+			}
+		})
+	}
+}
+
+func TestMembersAreScopedToOrg(t *testing.T) {
+	env := newTestEnv()
+	for _, username := range []string{"zoe", "abel"} {
+		if err := env.users.Create(&domain.User{Username: username, Role: domain.RoleUser}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.orgs.Create(&domain.Organization{Slug: "lab", Name: "实验室"}); err != nil {
+		t.Fatal(err)
+	}
+	own, other := domain.TenantScope{OrgID: 1}, domain.TenantScope{OrgID: 2}
+	if _, err := env.orgSvc.AddMember(own, 1, domain.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.orgSvc.AddMember(own, 2, domain.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.orgSvc.AddMember(own, 2, domain.RoleUser); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("add existing member: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := env.orgSvc.AddMember(own, 99, domain.RoleUser); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("add missing user: err = %v, want ErrUserNotFound", err)
+	}
+	if _, _, err := env.orgSvc.GetMember(other, 2); !errors.Is(err, domain.ErrNotOrgMember) {
+		t.Errorf("get member from other org: err = %v, want ErrNotOrgMember", err)
+	}
+	orgAdmin := &domain.Principal{Kind: domain.PrincipalUser, UserID: 3, Role: domain.RoleAdmin, OrgID: 2}
+	if err := env.orgSvc.EnsureMember(orgAdmin, 2); !errors.Is(err, domain.ErrNotOrgMember) {
+		t.Errorf("other org admin reaches member: err = %v, want ErrNotOrgMember", err)
+	}
+	if err := env.orgSvc.EnsureMember(&domain.Principal{Kind: domain.PrincipalUser, PlatformAdmin: true, OrgID: 2}, 2); err != nil {
+		t.Errorf("platform admin: %v", err)
+	}
+
+	// 组织中最后一位管理员不能被移除
+	if err := env.orgSvc.RemoveMember(own, 1); !errors.Is(err, domain.ErrLastAdmin) {
+		t.Errorf("remove last admin: err = %v, want ErrLastAdmin", err)
+	}
+	if err := env.orgSvc.RemoveMember(other, 2); !errors.Is(err, domain.ErrNotOrgMember) {
+		t.Errorf("remove from other org: err = %v, want ErrNotOrgMember", err)
+	}
+	if err := env.orgSvc.RemoveMember(own, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := env.orgSvc.ListMembers(own, domain.UserFilter{}); total != 1 {
+		t.Errorf("members = %d, want 1", total)
+	}
+}
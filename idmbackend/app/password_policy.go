@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	// bcrypt 只使用前 72 字节，更长的密码会被静默截断
+	passwordMaxBytes = 72
+)
+
+// PasswordPolicy 注册、修改和重置密码时使用的密码规则
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy breached 为泄露密码列表（小写），minLength 不大于 0 时使用默认值
+func NewPasswordPolicy(minLength int, breached map[string]struct{}) *PasswordPolicy {
+	if minLength <= 0 {
+		minLength = defaultPasswordMinLength
+	}
+	return &PasswordPolicy{MinLength: minLength, breached: breached}
+}
+
+// Validate 校验密码长度，并拒绝泄露列表中的密码和与用户名相同的密码
+func (p *PasswordPolicy) Validate(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: password must be at least %d characters", domain.ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > passwordMaxBytes {
+		return fmt.Errorf("%w: password must be at most %d bytes", domain.ErrWeakPassword, passwordMaxBytes)
+	}
+	lower := strings.ToLower(password)
+	if username != "" && lower == strings.ToLower(username) {
+		return fmt.Errorf("%w: password must not match the username", domain.ErrWeakPassword)
+	}
+	if _, found := p.breached[lower]; found {
+		return fmt.Errorf("%w: password appears in a list of breached passwords", domain.ErrWeakPassword)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type PasswordResetRepository interface {
+	Create(token *domain.PasswordResetToken) error
+	FindByHash(tokenHash string) (*domain.PasswordResetToken, error)
+	MarkUsed(id uint, at time.Time) (bool, error)
+	InvalidateForUser(userID uint, at time.Time) error
+}
+
+// Notifier 向用户发送通知的渠道，例如邮件；开发环境写入本地文件
+type Notifier interface {
+	Send(msg domain.Notification) error
+}
+
+const defaultPasswordResetTTL = 30 * time.Minute
+
+// PasswordService 修改密码、自助重置和管理员强制重置。
+// 密码变更后吊销用户的全部会话，并使尚未使用的重置令牌失效。
+type PasswordService struct {
+	userRepo    UserRepository
+	resetRepo   PasswordResetRepository
+	authService *AuthService
+	notifier    Notifier
+	policy      *PasswordPolicy
+	resetTTL    time.Duration
+	resetURL    string
+
+	accountLimiter *RateLimiter // 按用户名或邮箱限制自助重置请求
+	ipLimiter      *RateLimiter // 按客户端 IP 限制自助重置请求
+}
+
+// NewPasswordService resetURL 为前端重置密码页面地址，令牌以 token 查询参数附加在后面；
+// accountLimiter 和 ipLimiter 限制自助重置的请求次数，为空表示不限制
+func NewPasswordService(userRepo UserRepository, resetRepo PasswordResetRepository, authService *AuthService, notifier Notifier, policy *PasswordPolicy, resetTTL time.Duration, resetURL string, accountLimiter, ipLimiter *RateLimiter) *PasswordService {
+	if resetTTL <= 0 {
+		resetTTL = defaultPasswordResetTTL
+	}
+	return &PasswordService{
+		userRepo:    userRepo,
+		resetRepo:   resetRepo,
+		authService: authService,
+		notifier:    notifier,
+		policy:      policy,
+		resetTTL:    resetTTL,
+		resetURL:    resetURL,
+
+		accountLimiter: accountLimiter,
+		ipLimiter:      ipLimiter,
+	}
+}
+
+// ChangePassword 校验当前密码后修改密码，吊销所有会话并为当前客户端签发新令牌，
+// mfa 为当前会话的两步验证状态，新会话沿用该状态
+func (s *PasswordService) ChangePassword(userID uint, mfa bool, currentPassword, newPassword string) (*TokenPair, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if err := user.ComparePassword(currentPassword); err != nil {
+		return nil, domain.ErrIncorrectPassword
+	}
+	if err := s.policy.Validate(newPassword, user.Username); err != nil {
+		return nil, err
+	}
+	if currentPassword == newPassword {
+		return nil, fmt.Errorf("%w: new password must differ from the current one", domain.ErrWeakPassword)
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	log.Printf("用户 %s 修改了密码，已吊销全部会话", user.Username)
+	return s.authService.StartSession(user, mfa)
+}
+
+// RequestReset 按用户名或邮箱发送重置令牌。
+// 找不到用户或请求过于频繁时同样返回成功，避免通过该接口探测账号是否存在；
+// 频繁请求被忽略，已发送的令牌不会被新令牌顶替
+func (s *PasswordService) RequestReset(identifier, ip string) error {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return fmt.Errorf("%w: username or email is required", domain.ErrInvalidInput)
+	}
+	if err := s.ipLimiter.Allow(ip); err != nil {
+		return s.throttledReset(err, identifier, ip)
+	}
+	if err := s.accountLimiter.Allow(strings.ToLower(identifier)); err != nil {
+		return s.throttledReset(err, identifier, ip)
+	}
+
+	user, err := s.userRepo.FindByUsername(identifier)
+	if err != nil {
+		return err
+	}
+	if user == nil && strings.Contains(identifier, "@") {
+		if user, err = s.userRepo.FindByEmail(identifier); err != nil {
+			return err
+		}
+	}
+	if user == nil {
+		log.Printf("密码重置请求未匹配到用户")
+		return nil
+	}
+	return s.sendResetToken(user, domain.ResetSelfService)
+}
+
+// throttledReset 被限流的重置请求只记录安全事件，不发送通知
+func (s *PasswordService) throttledReset(err error, identifier, ip string) error {
+	if !errors.Is(err, domain.ErrTooManyAttempts) {
+		return err
+	}
+	logSecurityEvent("password_reset_throttled", identifier, ip, "")
+	return nil
+}
+
+// ConfirmReset 使用重置令牌设置新密码，令牌只能使用一次
+func (s *PasswordService) ConfirmReset(token, newPassword string) error {
+	reset, err := s.resetRepo.FindByHash(hashToken(token))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if reset == nil || !reset.IsUsable(now) {
+		return domain.ErrInvalidResetToken
+	}
+	user, err := s.userRepo.FindByID(reset.UserID)
+	if err != nil || user == nil {
+		return domain.ErrInvalidResetToken
+	}
+	// 先校验密码再消耗令牌，密码不符合规则时用户可以用同一令牌重试
+	if err := s.policy.Validate(newPassword, user.Username); err != nil {
+		return err
+	}
+
+	marked, err := s.resetRepo.MarkUsed(reset.ID, now)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return domain.ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	// 能收到重置令牌即证明账号归属，同时解除登录锁定
+	if err := s.authService.UnlockUser(user.ID); err != nil {
+		log.Printf("解除用户锁定失败: %v", err)
+	}
+	log.Printf("用户 %s 通过重置令牌修改了密码", user.Username)
+	return nil
+}
+
+// AdminResetPassword 管理员强制重置：原密码立即失效，吊销全部会话并向用户发送重置令牌
+func (s *PasswordService) AdminResetPassword(userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return domain.ErrUserNotFound
+	}
+
+	// 设置一个不告知任何人的随机密码，用户只能通过重置令牌设置新密码
+	placeholder, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(user, placeholder); err != nil {
+		return err
+	}
+	log.Printf("管理员强制重置了用户 %s 的密码", user.Username)
+	return s.sendResetToken(user, domain.ResetByAdmin)
+}
+
+// setPassword 保存新密码，使旧的重置令牌失效并吊销全部会话
+func (s *PasswordService) setPassword(user *domain.User, password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(user); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.resetRepo.InvalidateForUser(user.ID, now); err != nil {
+		return err
+	}
+	return s.authService.LogoutAll(user.ID)
+}
+
+// sendResetToken 生成新的重置令牌并通过通知渠道发送，同一用户之前未使用的令牌随之失效
+func (s *PasswordService) sendResetToken(user *domain.User, reason domain.ResetReason) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.resetRepo.InvalidateForUser(user.ID, now); err != nil {
+		return err
+	}
+	reset := &domain.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		Reason:    reason,
+		ExpiresAt: now.Add(s.resetTTL),
+	}
+	if err := s.resetRepo.Create(reset); err != nil {
+		return err
+	}
+
+	to := user.Email
+	if to == "" {
+		to = user.Username
+	}
+	subject := "重置密码"
+	intro := "我们收到了重置您账号密码的请求。如果不是您本人操作，请忽略此消息。"
+	if reason == domain.ResetByAdmin {
+		subject = "管理员已重置您的密码"
+		intro = "管理员已重置您的账号密码，原密码已失效，请使用下面的链接设置新密码。"
+	}
+	body := fmt.Sprintf("%s，您好：\n\n%s\n\n%s\n\n链接将在 %s 后失效，且只能使用一次。",
+		user.Username, intro, s.resetLink(token), s.resetTTL)
+	return s.notifier.Send(domain.Notification{To: to, Subject: subject, Body: body})
+}
+
+func (s *PasswordService) resetLink(token string) string {
+	if s.resetURL == "" {
+		return "重置令牌: " + token
+	}
+	separator := "?"
+	if strings.Contains(s.resetURL, "?") {
+		separator = "&"
+	}
+	return s.resetURL + separator + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memResetRepo struct {
+	mu     sync.Mutex
+	tokens []*domain.PasswordResetToken
+}
+
+func (r *memResetRepo) Create(token *domain.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token.ID = uint(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memResetRepo) FindByHash(tokenHash string) (*domain.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memResetRepo) MarkUsed(id uint, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.ID == id && t.UsedAt == nil {
+			t.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memResetRepo) InvalidateForUser(userID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.UsedAt == nil {
+			t.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+// usable 尚未使用的令牌数
+func (r *memResetRepo) usable() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, t := range r.tokens {
+		if t.UsedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+type recordingNotifier struct {
+	sent []domain.Notification
+}
+
+func (n *recordingNotifier) Send(msg domain.Notification) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestRequestResetThrottling(t *testing.T) {
+	env := newTestEnv()
+	user := &domain.User{Username: "frank", Email: "frank@example.com", Role: domain.RoleUser}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	throttles := newMemThrottleRepo()
+	policy := func(limit int) RateLimitPolicy { return RateLimitPolicy{Limit: limit, Window: time.Hour} }
+	resets := &memResetRepo{}
+	notifier := &recordingNotifier{}
+	service := NewPasswordService(env.users, resets, env.auth, notifier, nil, 0, "",
+		NewRateLimiter(throttles, env.clock, "reset:account:", policy(2)),
+		NewRateLimiter(throttles, env.clock, "reset:ip:", policy(3)))
+
+	for i := 0; i < 3; i++ {
+		if err := service.RequestReset("frank", "10.0.0.1"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if len(notifier.sent) != 2 {
+		t.Errorf("notifications = %d, want 2", len(notifier.sent))
+	}
+	// 被限流的请求不会使已发送的令牌失效
+	if n := resets.usable(); n != 1 {
+		t.Errorf("usable tokens = %d, want 1", n)
+	}
+
+	// 同一 IP 换用其他标识同样受限
+	if err := service.RequestReset("frank@example.com", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 2 {
+		t.Errorf("notifications after IP limit = %d, want 2", len(notifier.sent))
+	}
+
+	env.clock.Advance(time.Hour)
+	if err := service.RequestReset("frank", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 3 {
+		t.Errorf("notifications after window = %d, want 3", len(notifier.sent))
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// RateLimitPolicy 每个键在 Window 内最多允许 Limit 次请求，Limit 不大于 0 表示不限制
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimiter 按键限制固定时间窗口内的请求次数，用于会产生费用或发送通知的接口。
+// 计数与登录失败计数共用 login_throttles 表，多实例部署时共享：
+// Failures 为窗口内的请求数，LastFailureAt 为窗口开始时间，BlockedUntil 为窗口结束时间
+type RateLimiter struct {
+	repo   LoginThrottleRepository
+	clock  Clock
+	prefix string
+	policy RateLimitPolicy
+
+	mu sync.Mutex
+}
+
+// NewRateLimiter prefix 区分不同接口的计数，如 "chat:"
+func NewRateLimiter(repo LoginThrottleRepository, clock Clock, prefix string, policy RateLimitPolicy) *RateLimiter {
+	if clock == nil {
+		clock = SystemClock
+	}
+	if policy.Window <= 0 {
+		policy.Window = time.Hour
+	}
+	return &RateLimiter{repo: repo, clock: clock, prefix: prefix, policy: policy}
+}
+
+// Allow 为每个键记录一次请求。任一键超过限制时不计数并返回 *ThrottledError
+func (l *RateLimiter) Allow(keys ...string) error {
+	if l == nil || l.policy.Limit <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	counters := make([]*domain.LoginThrottle, 0, len(keys))
+	var wait time.Duration
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		counter, err := l.repo.Find(throttleKey(l.prefix, key))
+		if err != nil {
+			return err
+		}
+		if counter == nil || counter.RetryAfter(now) == 0 {
+			end := now.Add(l.policy.Window)
+			counter = &domain.LoginThrottle{Key: throttleKey(l.prefix, key), LastFailureAt: now, BlockedUntil: &end}
+		}
+		if counter.Failures >= l.policy.Limit {
+			if d := counter.RetryAfter(now); d > wait {
+				wait = d
+			}
+		}
+		counters = append(counters, counter)
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+
+	for _, counter := range counters {
+		counter.Failures++
+		if err := l.repo.Save(counter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+func TestRateLimiterWindow(t *testing.T) {
+	clock := newFakeClock()
+	limiter := NewRateLimiter(newMemThrottleRepo(), clock, "test:", RateLimitPolicy{Limit: 2, Window: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	clock.Advance(40 * time.Minute)
+	var throttled *ThrottledError
+	if err := limiter.Allow("alice"); !errors.As(err, &throttled) || throttled.RetryAfter != 20*time.Minute {
+		t.Fatalf("over limit: err = %v, want retry after 20m", err)
+	}
+	if err := limiter.Allow("bob"); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+
+	clock.Advance(20 * time.Minute)
+	if err := limiter.Allow("alice"); err != nil {
+		t.Errorf("next window: %v", err)
+	}
+}
+
+func TestRateLimiterSkipsCountingWhenAnyKeyIsThrottled(t *testing.T) {
+	repo := newMemThrottleRepo()
+	limiter := NewRateLimiter(repo, newFakeClock(), "test:", RateLimitPolicy{Limit: 1, Window: time.Hour})
+
+	if err := limiter.Allow("ip:1.2.3.4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Allow("alice", "ip:1.2.3.4"); !errors.Is(err, domain.ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+	// 被拒绝的请求不计入其他键
+	if err := limiter.Allow("alice"); err != nil {
+		t.Errorf("alice: %v", err)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(newMemThrottleRepo(), newFakeClock(), "test:", RateLimitPolicy{})
+	for i := 0; i < 100; i++ {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Allow("alice"); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+}
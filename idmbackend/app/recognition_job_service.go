@@ -0,0 +1,556 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// RecognitionJobRepository 任务按组织隔离；图片和调度相关的方法只由后台任务或已校验过任务归属的调用方使用
+type RecognitionJobRepository interface {
+	CreateJob(scope domain.TenantScope, job *domain.RecognitionJob, items []*domain.RecognitionJobItem) error
+	FindJob(scope domain.TenantScope, id uint) (*domain.RecognitionJob, error)
+	FindJobs(scope domain.TenantScope, userID uint, offset, limit int) ([]*domain.RecognitionJob, int64, error)
+	FindItems(jobID uint, status domain.JobItemStatus, offset, limit int) ([]*domain.RecognitionJobItem, int64, error)
+	CountLabels(jobID uint) ([]domain.LabelCount, error)
+	NextJobs() ([]*domain.RecognitionJob, error)
+	StartJob(jobID uint, at time.Time) error
+	UpdateItem(item *domain.RecognitionJobItem) error
+	CompleteItem(item *domain.RecognitionJobItem) error
+	FinishJob(jobID uint, at time.Time) error
+	ResetRunningItems() (int64, error)
+	FindItemsByJobs(jobIDs []uint) ([]*domain.RecognitionJobItem, error)
+	DeleteJobs(jobIDs []uint) error
+	CountItemsByImageKey(key string) (int64, error)
+}
+
+const (
+	maxJobImages       = 500
+	recognizeTimeout   = 30 * time.Second
+	jobPollInterval    = 30 * time.Second
+	maxJobItemErrorLen = 255
+
+	// maxJobImageBytes 一个任务中全部图片的总大小上限
+	maxJobImageBytes = 256 << 20
+	// jobSliceSize 调度每次从一个任务中取出的图片数，处理完一批后轮到下一个组织
+	jobSliceSize = 20
+)
+
+// RecognitionJobPolicy 批量识别的并发、限流和重试参数，零值字段使用默认值
+type RecognitionJobPolicy struct {
+	Workers       int           // 同时处理的图片数，默认 4
+	RatePerSecond float64       // 每秒最多调用识别后端的次数，默认 2
+	MaxAttempts   int           // 识别后端调用失败时每张图片的最多尝试次数，默认 3
+	RetryDelay    time.Duration // 第 n 次重试前等待 n 倍的该时长，默认 2s
+}
+
+// JobImage 批量任务中上传的一张图片
+type JobImage struct {
+	Name string
+	Data []byte
+}
+
+// RecognitionJobRequest 创建批量识别任务的参数，所有图片共用拍摄信息
+type RecognitionJobRequest struct {
+	Scope     domain.TenantScope
+	UserID    uint
+	Images    []JobImage
+	AreaID    string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// RecognitionJobService 管理异步批量识别任务。任务和图片状态保存在数据库中，
+// 后台调度在各组织之间轮转，每次从组织最早提交的未完成任务中取一批图片交给工作池并发识别，
+// 大任务不会让其他组织的任务一直排队；服务重启后未完成的任务会继续处理
+type RecognitionJobService struct {
+	repo               RecognitionJobRepository
+	recognitionService *RecognitionService
+	policy             RecognitionJobPolicy
+	limiter            *rateLimiter
+	wake               chan struct{}
+}
+
+func NewRecognitionJobService(repo RecognitionJobRepository, recognitionService *RecognitionService, policy RecognitionJobPolicy) *RecognitionJobService {
+	if policy.Workers <= 0 {
+		policy.Workers = 4
+	}
+	if policy.RatePerSecond <= 0 {
+		policy.RatePerSecond = 2
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.RetryDelay <= 0 {
+		policy.RetryDelay = 2 * time.Second
+	}
+	return &RecognitionJobService{
+		repo:               repo,
+		recognitionService: recognitionService,
+		policy:             policy,
+		limiter:            newRateLimiter(policy.RatePerSecond),
+		wake:               make(chan struct{}, 1),
+	}
+}
+
+// CreateJob 校验并保存上传的图片，创建排队中的任务。格式或大小不合格的图片直接记为失败，不影响其余图片
+func (s *RecognitionJobService) CreateJob(req RecognitionJobRequest) (*domain.RecognitionJob, error) {
+	if len(req.Images) == 0 {
+		return nil, fmt.Errorf("%w: no images provided", domain.ErrInvalidInput)
+	}
+	if len(req.Images) > maxJobImages {
+		return nil, fmt.Errorf("%w: at most %d images per job", domain.ErrInvalidInput, maxJobImages)
+	}
+	var size int64
+	for _, img := range req.Images {
+		size += int64(len(img.Data))
+	}
+	if size > maxJobImageBytes {
+		return nil, fmt.Errorf("%w: images exceed %d MB in total", domain.ErrInvalidInput, maxJobImageBytes>>20)
+	}
+	if err := validateCoordinates(req.Latitude, req.Longitude); err != nil {
+		return nil, err
+	}
+
+	job := &domain.RecognitionJob{
+		UserID:    req.UserID,
+		Status:    domain.JobQueued,
+		Total:     len(req.Images),
+		AreaID:    req.AreaID,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+	}
+	items := make([]*domain.RecognitionJobItem, 0, len(req.Images))
+	for _, img := range req.Images {
+		item := &domain.RecognitionJobItem{
+			FileName: truncateRunes(img.Name, 255),
+			Status:   domain.JobItemPending,
+		}
+		format, err := ValidateImage(img.Data)
+		if err == nil {
+			_, item.ImageKey, err = s.recognitionService.storeImage(img.Data, format)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			item.Status = domain.JobItemFailed
+			item.Error = truncateRunes(err.Error(), maxJobItemErrorLen)
+			job.Failed++
+		}
+		items = append(items, item)
+	}
+	if job.Failed == job.Total {
+		now := time.Now()
+		job.Status = domain.JobCompleted
+		job.FinishedAt = &now
+	}
+
+	if err := s.repo.CreateJob(req.Scope, job, items); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return job, nil
+}
+
+func (s *RecognitionJobService) GetJob(scope domain.TenantScope, id uint) (*domain.RecognitionJob, error) {
+	job, err := s.repo.FindJob(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, domain.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// ListJobs 分页查询组织内的任务，userID 为 0 时返回全部提交人的任务
+func (s *RecognitionJobService) ListJobs(scope domain.TenantScope, userID uint, offset, limit int) ([]*domain.RecognitionJob, int64, error) {
+	return s.repo.FindJobs(scope, userID, offset, limit)
+}
+
+// ListItems 分页查询任务中每张图片的处理状态和识别结果
+func (s *RecognitionJobService) ListItems(scope domain.TenantScope, id uint, status domain.JobItemStatus, offset, limit int) ([]*domain.RecognitionJobItem, int64, error) {
+	if _, err := s.GetJob(scope, id); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.FindItems(id, status, offset, limit)
+}
+
+// CountLabels 统计任务中各物种的识别数量，任务未完成时为当前进度下的统计
+func (s *RecognitionJobService) CountLabels(scope domain.TenantScope, id uint) ([]domain.LabelCount, error) {
+	if _, err := s.GetJob(scope, id); err != nil {
+		return nil, err
+	}
+	return s.repo.CountLabels(id)
+}
+
+// WriteSummaryCSV 将任务的物种数量统计写为 CSV
+func (s *RecognitionJobService) WriteSummaryCSV(scope domain.TenantScope, id uint, w io.Writer) error {
+	counts, err := s.CountLabels(scope, id)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"species", "species_id", "count"})
+	for _, c := range counts {
+		speciesID := ""
+		if c.SpeciesID != nil {
+			speciesID = strconv.FormatUint(uint64(*c.SpeciesID), 10)
+		}
+		_ = writer.Write([]string{csvCell(c.Label), speciesID, strconv.Itoa(c.Count)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// PurgeJobs 删除任务及其图片，以及由任务生成且用户尚未反馈的识别记录，用于快照过期清理。
+// 识别图片按内容寻址，可能被其他识别记录或任务共用，只在没有其他引用时删除
+func (s *RecognitionJobService) PurgeJobs(jobIDs []uint) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	items, err := s.repo.FindItemsByJobs(jobIDs)
+	if err != nil {
+		return err
+	}
+	var recognitionIDs []uint
+	keys := make(map[string]bool)
+	for _, item := range items {
+		if item.RecognitionID != nil {
+			recognitionIDs = append(recognitionIDs, *item.RecognitionID)
+		}
+		if item.ImageKey != "" {
+			keys[item.ImageKey] = true
+		}
+	}
+
+	if err := s.recognitionService.repo.DeletePending(recognitionIDs); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteJobs(jobIDs); err != nil {
+		return err
+	}
+	for key := range keys {
+		s.removeUnusedImage(key)
+	}
+	return nil
+}
+
+// removeUnusedImage 没有识别记录或任务图片引用时删除识别图片，失败只记录日志
+func (s *RecognitionJobService) removeUnusedImage(key string) {
+	recognitions, err := s.recognitionService.repo.CountByImageKey(key)
+	if err != nil {
+		log.Printf("批量识别 - 统计图片 %s 的引用失败: %v", key, err)
+		return
+	}
+	items, err := s.repo.CountItemsByImageKey(key)
+	if err != nil {
+		log.Printf("批量识别 - 统计图片 %s 的引用失败: %v", key, err)
+		return
+	}
+	if recognitions+items > 0 {
+		return
+	}
+	if err := s.recognitionService.blobs.Delete(key); err != nil {
+		log.Printf("批量识别 - 删除图片 %s 失败: %v", key, err)
+	}
+}
+
+// Start 启动后台调度和工作池，ctx 取消后停止领取新的图片
+func (s *RecognitionJobService) Start(ctx context.Context) {
+	if n, err := s.repo.ResetRunningItems(); err != nil {
+		log.Printf("批量识别 - 恢复未完成的图片失败: %v", err)
+	} else if n > 0 {
+		log.Printf("批量识别 - 恢复了 %d 张上次未处理完的图片", n)
+	}
+
+	items := make(chan jobTask)
+	for i := 0; i < s.policy.Workers; i++ {
+		go s.work(ctx, items)
+	}
+	go s.dispatch(ctx, items)
+}
+
+type jobTask struct {
+	job  *domain.RecognitionJob
+	item *domain.RecognitionJobItem
+	done *sync.WaitGroup
+}
+
+// notify 唤醒调度，已有未处理的唤醒信号时忽略
+func (s *RecognitionJobService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 轮流处理各组织最早提交的未完成任务，每个任务每轮只分发一批图片，
+// 没有任务时等待新任务提交或定期重新检查
+func (s *RecognitionJobService) dispatch(ctx context.Context, items chan<- jobTask) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		jobs, err := s.repo.NextJobs()
+		if err != nil {
+			log.Printf("批量识别 - 获取待处理任务失败: %v", err)
+		}
+		if err != nil || len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+		for _, job := range jobs {
+			if err := s.runSlice(ctx, job, items); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("批量识别 - 处理任务 %d 失败: %v", job.ID, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}
+	}
+}
+
+// runSlice 处理任务中的一批待处理图片，没有剩余的待处理图片时完成任务
+func (s *RecognitionJobService) runSlice(ctx context.Context, job *domain.RecognitionJob, items chan<- jobTask) error {
+	if err := s.repo.StartJob(job.ID, time.Now()); err != nil {
+		return err
+	}
+	pending, remaining, err := s.repo.FindItems(job.ID, domain.JobItemPending, 0, jobSliceSize)
+	if err != nil {
+		return err
+	}
+
+	var done sync.WaitGroup
+	for _, item := range pending {
+		done.Add(1)
+		select {
+		case items <- jobTask{job: job, item: item, done: &done}:
+		case <-ctx.Done():
+			done.Done()
+			done.Wait()
+			return ctx.Err()
+		}
+	}
+	done.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if remaining > int64(len(pending)) {
+		return nil
+	}
+	// 更新状态失败的图片会留在待处理状态，留到下一轮重新分发
+	if _, remaining, err = s.repo.FindItems(job.ID, domain.JobItemPending, 0, 1); err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return nil
+	}
+	return s.repo.FinishJob(job.ID, time.Now())
+}
+
+func (s *RecognitionJobService) work(ctx context.Context, items <-chan jobTask) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-items:
+			s.processItem(ctx, task.job, task.item)
+			task.done.Done()
+		}
+	}
+}
+
+// processItem 识别一张图片。识别后端调用失败时按策略重试，其余错误直接记为失败；
+// 服务停止导致的中断不记录结果，重启后重新处理
+func (s *RecognitionJobService) processItem(ctx context.Context, job *domain.RecognitionJob, item *domain.RecognitionJobItem) {
+	item.Status = domain.JobItemRunning
+	if err := s.repo.UpdateItem(item); err != nil {
+		log.Printf("批量识别 - 更新图片 %d 状态失败: %v", item.ID, err)
+		return
+	}
+
+	image, err := s.recognitionService.blobs.Get(item.ImageKey)
+	var result *domain.RecognitionResult
+	for err == nil {
+		item.Attempts++
+		if err = s.limiter.Wait(ctx); err != nil {
+			break
+		}
+		result, err = s.recognizeOnce(ctx, job, image)
+		if err == nil || !errors.Is(err, domain.ErrRecognitionFailed) || item.Attempts >= s.policy.MaxAttempts {
+			break
+		}
+		log.Printf("批量识别 - 图片 %d 第 %d 次识别失败，稍后重试: %v", item.ID, item.Attempts, err)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(time.Duration(item.Attempts) * s.policy.RetryDelay):
+			err = nil
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		item.Status = domain.JobItemFailed
+		item.Error = jobItemError(err)
+	} else {
+		item.Status = domain.JobItemSucceeded
+		item.Error = ""
+		item.RecognitionID = &result.RecognitionID
+		item.Label = truncateRunes(result.Name, 128)
+		item.Score = result.Score
+		if result.Species != nil {
+			item.Label = result.CanonicalName
+			item.SpeciesID = &result.Species.ID
+		}
+	}
+	if err := s.repo.CompleteItem(item); err != nil {
+		log.Printf("批量识别 - 保存图片 %d 的结果失败: %v", item.ID, err)
+	}
+}
+
+func (s *RecognitionJobService) recognizeOnce(ctx context.Context, job *domain.RecognitionJob, image []byte) (*domain.RecognitionResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, recognizeTimeout)
+	defer cancel()
+	return s.recognitionService.Recognize(ctx, RecognitionRequest{
+		Scope:     domain.TenantScope{OrgID: job.OrgID},
+		UserID:    job.UserID,
+		Image:     image,
+		AreaID:    job.AreaID,
+		Latitude:  job.Latitude,
+		Longitude: job.Longitude,
+	})
+}
+
+// jobItemError 转换为展示给用户的错误信息，不暴露后端细节
+func jobItemError(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrNothingRecognized):
+		return "未识别到鱼类"
+	case errors.Is(err, domain.ErrRecognitionFailed):
+		return "识别服务调用失败"
+	case errors.Is(err, domain.ErrBlobNotFound):
+		return "图片文件丢失"
+	case errors.Is(err, domain.ErrInvalidInput):
+		return truncateRunes(err.Error(), maxJobItemErrorLen)
+	default:
+		log.Printf("批量识别 - 处理失败: %v", err)
+		return "处理失败"
+	}
+}
+
+// ExtractJobImages 从 ZIP 压缩包中读取 JPEG 和 PNG 图片追加到 images 之后，忽略目录、隐藏文件和其他类型的文件。
+// 读取前先按目录检查图片数量和声明的总大小，超出任务上限时不解压；
+// 超出大小限制的图片只读取限制内的部分，由后续校验记为失败
+func ExtractJobImages(data []byte, images []JobImage) ([]JobImage, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid zip archive", domain.ErrInvalidInput)
+	}
+
+	var size int64
+	for _, img := range images {
+		size += int64(len(img.Data))
+	}
+	var files []*zip.File
+	declared := size
+	for _, f := range archive.File {
+		name := f.Name
+		base := path.Base(name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		switch strings.ToLower(path.Ext(base)) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			continue
+		}
+		files = append(files, f)
+		declared += int64(min(f.UncompressedSize64, MaxImageSize+1))
+	}
+	if len(images)+len(files) > maxJobImages {
+		return nil, fmt.Errorf("%w: at most %d images per job", domain.ErrInvalidInput, maxJobImages)
+	}
+	if declared > maxJobImageBytes {
+		return nil, fmt.Errorf("%w: images exceed %d MB in total", domain.ErrInvalidInput, maxJobImageBytes>>20)
+	}
+
+	for _, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot read %s", domain.ErrInvalidInput, f.Name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, MaxImageSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot read %s", domain.ErrInvalidInput, f.Name)
+		}
+		// 目录中声明的大小可能与实际内容不符，按实际读取的大小再检查一次
+		if size += int64(len(content)); size > maxJobImageBytes {
+			return nil, fmt.Errorf("%w: images exceed %d MB in total", domain.ErrInvalidInput, maxJobImageBytes>>20)
+		}
+		images = append(images, JobImage{Name: f.Name, Data: content})
+	}
+	return images, nil
+}
+
+// rateLimiter 按固定间隔放行请求，多个工作协程共用
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait 等待到下一个可用的时间点，ctx 取消时提前返回
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
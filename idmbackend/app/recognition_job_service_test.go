@@ -0,0 +1,547 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memRecognitionJobRepo 与数据库实现一样按 scope.OrgID 隔离任务，图片相关的方法不区分组织
+type memRecognitionJobRepo struct {
+	mu    sync.Mutex
+	jobs  []*domain.RecognitionJob
+	items []*domain.RecognitionJobItem
+	// failUpdates 为剩余需要失败的 UpdateItem 调用次数，模拟数据库写入失败
+	failUpdates int
+	// finishCalls 记录 FinishJob 的调用次数
+	finishCalls int
+}
+
+func (r *memRecognitionJobRepo) CreateJob(scope domain.TenantScope, job *domain.RecognitionJob, items []*domain.RecognitionJobItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = uint(len(r.jobs) + 1)
+	job.OrgID = scope.OrgID
+	copiedJob := *job
+	r.jobs = append(r.jobs, &copiedJob)
+	for _, item := range items {
+		item.ID = uint(len(r.items) + 1)
+		item.JobID = job.ID
+		copied := *item
+		r.items = append(r.items, &copied)
+	}
+	return nil
+}
+
+func (r *memRecognitionJobRepo) FindJob(scope domain.TenantScope, id uint) (*domain.RecognitionJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id && job.OrgID == scope.OrgID {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memRecognitionJobRepo) FindJobs(scope domain.TenantScope, userID uint, offset, limit int) ([]*domain.RecognitionJob, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.RecognitionJob
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		job := r.jobs[i]
+		if job.OrgID == scope.OrgID && (userID == 0 || job.UserID == userID) {
+			copied := *job
+			found = append(found, &copied)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(offset, len(found)):]
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, total, nil
+}
+
+func (r *memRecognitionJobRepo) FindItems(jobID uint, status domain.JobItemStatus, offset, limit int) ([]*domain.RecognitionJobItem, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.RecognitionJobItem
+	for _, item := range r.items {
+		if item.JobID == jobID && (status == "" || item.Status == status) {
+			copied := *item
+			found = append(found, &copied)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(offset, len(found)):]
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	return found, total, nil
+}
+
+func (r *memRecognitionJobRepo) CountLabels(jobID uint) ([]domain.LabelCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var counts []domain.LabelCount
+	for _, item := range r.items {
+		if item.JobID != jobID || item.Status != domain.JobItemSucceeded {
+			continue
+		}
+		found := false
+		for i := range counts {
+			if counts[i].Label == item.Label {
+				counts[i].Count++
+				found = true
+			}
+		}
+		if !found {
+			counts = append(counts, domain.LabelCount{Label: item.Label, SpeciesID: item.SpeciesID, Count: 1})
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Label < counts[j].Label
+	})
+	return counts, nil
+}
+
+func (r *memRecognitionJobRepo) NextJobs() ([]*domain.RecognitionJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[uint]bool)
+	var jobs []*domain.RecognitionJob
+	for _, job := range r.jobs {
+		if seen[job.OrgID] || job.Status == domain.JobCompleted {
+			continue
+		}
+		seen[job.OrgID] = true
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+	return jobs, nil
+}
+
+func (r *memRecognitionJobRepo) StartJob(jobID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == jobID && job.Status == domain.JobQueued {
+			job.Status = domain.JobRunning
+			job.StartedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memRecognitionJobRepo) UpdateItem(item *domain.RecognitionJobItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failUpdates > 0 {
+		r.failUpdates--
+		return errors.New("database unavailable")
+	}
+	for _, stored := range r.items {
+		if stored.ID == item.ID {
+			stored.Status, stored.Attempts, stored.Error = item.Status, item.Attempts, item.Error
+		}
+	}
+	return nil
+}
+
+func (r *memRecognitionJobRepo) CompleteItem(item *domain.RecognitionJobItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, stored := range r.items {
+		if stored.ID == item.ID {
+			copied := *item
+			r.items[i] = &copied
+		}
+	}
+	for _, job := range r.jobs {
+		if job.ID == item.JobID && item.Status == domain.JobItemSucceeded {
+			job.Succeeded++
+		} else if job.ID == item.JobID {
+			job.Failed++
+		}
+	}
+	return nil
+}
+
+func (r *memRecognitionJobRepo) FinishJob(jobID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finishCalls++
+	succeeded, failed, finished := 0, 0, true
+	for _, item := range r.items {
+		if item.JobID != jobID {
+			continue
+		}
+		switch item.Status {
+		case domain.JobItemSucceeded:
+			succeeded++
+		case domain.JobItemFailed:
+			failed++
+		default:
+			finished = false
+		}
+	}
+	for _, job := range r.jobs {
+		if job.ID == jobID {
+			job.Succeeded, job.Failed = succeeded, failed
+			if finished {
+				job.Status = domain.JobCompleted
+				job.FinishedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memRecognitionJobRepo) ResetRunningItems() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, item := range r.items {
+		if item.Status == domain.JobItemRunning {
+			item.Status = domain.JobItemPending
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memRecognitionJobRepo) FindItemsByJobs(jobIDs []uint) ([]*domain.RecognitionJobItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.RecognitionJobItem
+	for _, item := range r.items {
+		for _, id := range jobIDs {
+			if item.JobID == id {
+				copied := *item
+				found = append(found, &copied)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (r *memRecognitionJobRepo) DeleteJobs(jobIDs []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deleted := make(map[uint]bool)
+	for _, id := range jobIDs {
+		deleted[id] = true
+	}
+	jobs := r.jobs[:0]
+	for _, job := range r.jobs {
+		if !deleted[job.ID] {
+			jobs = append(jobs, job)
+		}
+	}
+	r.jobs = jobs
+	items := r.items[:0]
+	for _, item := range r.items {
+		if !deleted[item.JobID] {
+			items = append(items, item)
+		}
+	}
+	r.items = items
+	return nil
+}
+
+func (r *memRecognitionJobRepo) CountItemsByImageKey(key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, item := range r.items {
+		if item.ImageKey == key {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func newTestJobService(f *recognitionFixture) (*RecognitionJobService, *memRecognitionJobRepo) {
+	repo := &memRecognitionJobRepo{}
+	policy := RecognitionJobPolicy{Workers: 2, RatePerSecond: 1000, RetryDelay: time.Millisecond}
+	return NewRecognitionJobService(repo, f.service, policy), repo
+}
+
+// waitForJob 等待后台调度处理完任务
+func waitForJob(t *testing.T, service *RecognitionJobService, scope domain.TenantScope, id uint) *domain.RecognitionJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := service.GetJob(scope, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == domain.JobCompleted {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d still %s after 5s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCreateJobValidation(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, _ := newTestJobService(f)
+	scope := domain.TenantScope{OrgID: 1}
+	lat := 30.5
+
+	tests := []struct {
+		name string
+		req  RecognitionJobRequest
+	}{
+		{"no images", RecognitionJobRequest{Scope: scope}},
+		{"too many images", RecognitionJobRequest{Scope: scope, Images: make([]JobImage, maxJobImages+1)}},
+		{"latitude without longitude", RecognitionJobRequest{Scope: scope, Images: []JobImage{{Name: "a.png", Data: testPNG(t, 1)}}, Latitude: &lat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CreateJob(tt.req); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("CreateJob = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+
+	// 不合格的图片直接记为失败，不影响其余图片
+	job, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{
+		{Name: "a.png", Data: testPNG(t, 1)},
+		{Name: "notes.png", Data: []byte("not an image")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != domain.JobQueued || job.Total != 2 || job.Failed != 1 {
+		t.Errorf("status/total/failed = %s/%d/%d, want queued/2/1", job.Status, job.Total, job.Failed)
+	}
+
+	// 全部图片都不合格时任务直接完成
+	job, err = service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{{Name: "notes.png", Data: []byte("not an image")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != domain.JobCompleted || job.FinishedAt == nil {
+		t.Errorf("status = %s, want completed", job.Status)
+	}
+	if _, err := service.GetJob(domain.TenantScope{OrgID: 2}, job.ID); !errors.Is(err, domain.ErrJobNotFound) {
+		t.Errorf("job from other org: err = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestExtractJobImages(t *testing.T) {
+	archive := zipOf(t, map[string]string{
+		"a.png":              string(testPNG(t, 1)),
+		"dir/":               "",
+		"dir/b.JPG":          "jpeg",
+		"dir/.hidden.png":    "hidden",
+		"__MACOSX/dir/b.JPG": "resource fork",
+		"notes.txt":          "notes",
+	})
+	images, err := ExtractJobImages(archive, []JobImage{{Name: "upload.png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, img := range images {
+		names[img.Name] = true
+	}
+	if len(images) != 3 || !names["upload.png"] || !names["a.png"] || !names["dir/b.JPG"] {
+		t.Errorf("images = %v, want upload.png, a.png and dir/b.JPG", names)
+	}
+
+	if _, err := ExtractJobImages([]byte("not a zip"), nil); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid archive: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := ExtractJobImages(archive, make([]JobImage, maxJobImages-1)); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("too many images: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestJobProcessesImagesWithRetry(t *testing.T) {
+	// 每张图片的第一次识别调用失败，重试后成功
+	var calls atomic.Int32
+	recognizer := fixedRecognizer("鲤拐子")
+	f := newRecognitionFixture(recognizerFunc(func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		if calls.Add(1)%2 == 1 {
+			return nil, fmt.Errorf("%w: backend unavailable", domain.ErrRecognitionFailed)
+		}
+		return recognizer(ctx, image)
+	}))
+	repo := &memRecognitionJobRepo{}
+	service := NewRecognitionJobService(repo, f.service, RecognitionJobPolicy{Workers: 1, RatePerSecond: 1000, RetryDelay: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.Start(ctx)
+
+	scope := domain.TenantScope{OrgID: 1}
+	job, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, AreaID: "pond-a", Images: []JobImage{
+		{Name: "a.png", Data: testPNG(t, 1)},
+		{Name: "b.png", Data: testPNG(t, 2)},
+		{Name: "c.png", Data: []byte("not an image")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitForJob(t, service, scope, job.ID)
+	if job.Succeeded != 2 || job.Failed != 1 {
+		t.Errorf("succeeded/failed = %d/%d, want 2/1", job.Succeeded, job.Failed)
+	}
+
+	items, _, err := service.ListItems(scope, job.ID, domain.JobItemSucceeded, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.Attempts != 2 || item.Label != "鲤鱼" || item.SpeciesID == nil || *item.SpeciesID != f.carpID || item.RecognitionID == nil {
+			t.Errorf("item %s = attempts %d, label %q, species %v", item.FileName, item.Attempts, item.Label, item.SpeciesID)
+		}
+	}
+	if _, _, err := service.ListItems(domain.TenantScope{OrgID: 2}, job.ID, "", 0, 10); !errors.Is(err, domain.ErrJobNotFound) {
+		t.Errorf("items from other org: err = %v, want ErrJobNotFound", err)
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteSummaryCSV(scope, job.ID, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "鲤鱼" || rows[1][1] != fmt.Sprint(f.carpID) || rows[1][2] != "2" {
+		t.Errorf("summary = %v", rows)
+	}
+}
+
+func TestJobItemFailsAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	f := newRecognitionFixture(recognizerFunc(func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		calls.Add(1)
+		return nil, fmt.Errorf("%w: backend unavailable", domain.ErrRecognitionFailed)
+	}))
+	service, _ := newTestJobService(f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.Start(ctx)
+
+	scope := domain.TenantScope{OrgID: 1}
+	job, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{{Name: "a.png", Data: testPNG(t, 1)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitForJob(t, service, scope, job.ID)
+	items, _, _ := service.ListItems(scope, job.ID, "", 0, 10)
+	if job.Failed != 1 || calls.Load() != 3 || items[0].Error != "识别服务调用失败" {
+		t.Errorf("failed/calls/error = %d/%d/%q, want 1/3/识别服务调用失败", job.Failed, calls.Load(), items[0].Error)
+	}
+}
+
+func TestRunSliceKeepsJobWhileItemsArePending(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, repo := newTestJobService(f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := make(chan jobTask)
+	go service.work(ctx, items)
+
+	scope := domain.TenantScope{OrgID: 1}
+	job, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{{Name: "a.png", Data: testPNG(t, 1)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次更新图片状态失败，图片仍待处理，任务不能结束
+	repo.failUpdates = 1
+	if err := service.runSlice(ctx, job, items); err != nil {
+		t.Fatal(err)
+	}
+	if repo.finishCalls != 0 {
+		t.Errorf("FinishJob called %d times with an item still pending, want 0", repo.finishCalls)
+	}
+
+	// 下一轮重新处理该图片后完成任务
+	if err := service.runSlice(ctx, job, items); err != nil {
+		t.Fatal(err)
+	}
+	job, err = service.GetJob(scope, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.finishCalls != 1 || job.Status != domain.JobCompleted || job.Succeeded != 1 {
+		t.Errorf("finish calls/status/succeeded = %d/%s/%d, want 1/completed/1", repo.finishCalls, job.Status, job.Succeeded)
+	}
+}
+
+func TestPurgeJobsKeepsSharedImagesAndFeedback(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	service, repo := newTestJobService(f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.Start(ctx)
+
+	scope := domain.TenantScope{OrgID: 1}
+	shared, own := testPNG(t, 1), testPNG(t, 2)
+	purged, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{
+		{Name: "shared.png", Data: shared},
+		{Name: "own.png", Data: own},
+		{Name: "feedback.png", Data: testPNG(t, 3)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, service, scope, purged.ID)
+	kept, err := service.CreateJob(RecognitionJobRequest{Scope: scope, UserID: 5, Images: []JobImage{{Name: "shared.png", Data: shared}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, service, scope, kept.ID)
+
+	// 用户反馈过的识别记录不随任务删除
+	items, _, _ := service.ListItems(scope, purged.ID, "", 0, 10)
+	feedback := items[2]
+	if _, err := f.service.SubmitFeedback(scope, 5, *feedback.RecognitionID, "草鱼"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.PurgeJobs([]uint{purged.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GetJob(scope, purged.ID); !errors.Is(err, domain.ErrJobNotFound) {
+		t.Errorf("purged job: err = %v, want ErrJobNotFound", err)
+	}
+	if remaining, _ := repo.FindItemsByJobs([]uint{purged.ID}); len(remaining) != 0 {
+		t.Errorf("purged job still has %d items", len(remaining))
+	}
+	if _, total, _ := f.service.ListRecognitions(scope, domain.RecognitionFilter{}); total != 2 {
+		t.Errorf("recognitions after purge = %d, want the feedback and the other job's", total)
+	}
+
+	if _, err := f.blobs.Get(items[0].ImageKey); err != nil {
+		t.Errorf("image shared with another job was deleted: %v", err)
+	}
+	if _, err := f.blobs.Get(items[1].ImageKey); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("unused image: err = %v, want ErrBlobNotFound", err)
+	}
+	if _, err := f.blobs.Get(feedback.ImageKey); err != nil {
+		t.Errorf("image of the feedback recognition was deleted: %v", err)
+	}
+}
@@ -0,0 +1,381 @@
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// Recognizer 图像识别后端，按置信度从高到低返回候选结果。
+// 后端调用失败时返回包装了 domain.ErrRecognitionFailed 的错误
+type Recognizer interface {
+	Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error)
+}
+
+// RecognitionRepository 所有查询都限定在 scope 所在的组织内，清理快照使用的方法除外
+type RecognitionRepository interface {
+	Create(scope domain.TenantScope, recognition *domain.Recognition) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Recognition, error)
+	Find(scope domain.TenantScope, filter domain.RecognitionFilter) ([]*domain.Recognition, int64, error)
+	FindAfter(scope domain.TenantScope, filter domain.RecognitionFilter, afterID uint, limit int) ([]*domain.Recognition, error)
+	Update(scope domain.TenantScope, recognition *domain.Recognition) error
+	DeletePending(ids []uint) error
+	CountByImageKey(key string) (int64, error)
+}
+
+const datasetExportBatch = 100
+
+// ReviewQueueStatuses 等待专家审核的状态：用户已确认或更正标签
+var ReviewQueueStatuses = []domain.RecognitionStatus{domain.RecognitionConfirmed, domain.RecognitionCorrected}
+
+// RecognitionRequest 一次识别请求及其拍摄信息
+type RecognitionRequest struct {
+	Scope     domain.TenantScope
+	UserID    uint
+	Image     []byte
+	AreaID    string
+	Latitude  *float64
+	Longitude *float64
+	Enhance   string // 识别前的预处理：none、default 或逗号分隔的步骤，为空时使用服务的默认设置
+}
+
+// RecognitionService 调用识别后端，保存每次识别的图片和候选结果，并管理用户反馈和专家审核
+type RecognitionService struct {
+	recognizer      Recognizer
+	taxonomyService *TaxonomyService
+	repo            RecognitionRepository
+	blobs           BlobStore
+	imageService    *ImageService
+	defaultEnhance  string
+}
+
+// NewRecognitionService defaultEnhance 为请求未指定预处理时的设置，为空表示不预处理
+func NewRecognitionService(recognizer Recognizer, taxonomyService *TaxonomyService, repo RecognitionRepository, blobs BlobStore, imageService *ImageService, defaultEnhance string) *RecognitionService {
+	if strings.TrimSpace(defaultEnhance) == "" {
+		defaultEnhance = EnhanceNone
+	}
+	return &RecognitionService{
+		recognizer:      recognizer,
+		taxonomyService: taxonomyService,
+		repo:            repo,
+		blobs:           blobs,
+		imageService:    imageService,
+		defaultEnhance:  normalizeEnhanceSpec(defaultEnhance),
+	}
+}
+
+// Recognize 识别图片中的鱼类并保存识别记录。优先选择名称中含“鱼”的候选，否则取置信度最高的候选。
+// 选择了预处理时识别预处理后的图片，识别记录中保存的仍是原始图片
+func (s *RecognitionService) Recognize(ctx context.Context, req RecognitionRequest) (*domain.RecognitionResult, error) {
+	format, err := ValidateImage(req.Image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	if err := validateCoordinates(req.Latitude, req.Longitude); err != nil {
+		return nil, err
+	}
+
+	enhance := s.defaultEnhance
+	if strings.TrimSpace(req.Enhance) != "" {
+		enhance = normalizeEnhanceSpec(req.Enhance)
+	}
+	image := req.Image
+	if enhance != EnhanceNone {
+		if image, err = s.imageService.Enhance(req.Image, enhance); err != nil {
+			return nil, err
+		}
+	}
+
+	candidates, err := s.recognizer.Recognize(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, domain.ErrNothingRecognized
+	}
+
+	best := candidates[0]
+	for _, c := range candidates {
+		if strings.Contains(c.Name, "鱼") {
+			best = c
+			break
+		}
+	}
+
+	result := &domain.RecognitionResult{
+		Name:        best.Name,
+		Score:       best.Score,
+		Description: best.Description,
+		Candidates:  candidates,
+		Enhance:     enhance,
+	}
+	if result.Description == "" {
+		result.Description = "暂无详细描述信息。"
+	}
+
+	// 物种库未收录时仅返回原始结果
+	species, err := s.taxonomyService.ResolveSpecies(best.Name)
+	if err == nil {
+		result.Species = species
+		result.CanonicalName = species.SpeciesName
+	} else if !errors.Is(err, domain.ErrSpeciesNotFound) {
+		log.Printf("鱼类识别 - 解析物种名称失败: %v", err)
+	}
+
+	hash, key, err := s.storeImage(req.Image, format)
+	if err != nil {
+		return nil, err
+	}
+
+	recognition := &domain.Recognition{
+		UserID:     req.UserID,
+		ImageHash:  hash,
+		ImageKey:   key,
+		Candidates: candidates,
+		TopName:    truncateRunes(best.Name, 128),
+		TopScore:   best.Score,
+		Label:      truncateRunes(best.Name, 128),
+		Status:     domain.RecognitionPending,
+		AreaID:     req.AreaID,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		Enhance:    enhance,
+	}
+	if result.Species != nil {
+		recognition.SpeciesID = &result.Species.ID
+	}
+	if err := s.repo.Create(req.Scope, recognition); err != nil {
+		return nil, err
+	}
+	result.RecognitionID = recognition.ID
+	return result, nil
+}
+
+func (s *RecognitionService) GetRecognition(scope domain.TenantScope, id uint) (*domain.Recognition, error) {
+	recognition, err := s.repo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if recognition == nil {
+		return nil, domain.ErrRecognitionNotFound
+	}
+	return recognition, nil
+}
+
+func (s *RecognitionService) ListRecognitions(scope domain.TenantScope, filter domain.RecognitionFilter) ([]*domain.Recognition, int64, error) {
+	return s.repo.Find(scope, filter)
+}
+
+// GetImage 获取识别时上传的原始图片及其 MIME 类型
+func (s *RecognitionService) GetImage(scope domain.TenantScope, id uint) ([]byte, string, error) {
+	recognition, err := s.GetRecognition(scope, id)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := s.blobs.Get(recognition.ImageKey)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := "image/jpeg"
+	if strings.HasSuffix(recognition.ImageKey, ".png") {
+		contentType = "image/png"
+	}
+	return data, contentType, nil
+}
+
+// SubmitFeedback 识别请求者确认或更正标签。与首选结果相同视为确认，否则视为更正；专家审核后不能再修改
+func (s *RecognitionService) SubmitFeedback(scope domain.TenantScope, userID, id uint, label string) (*domain.Recognition, error) {
+	recognition, err := s.GetRecognition(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if recognition.UserID != userID {
+		return nil, domain.ErrForbidden
+	}
+	if recognition.Status.IsReviewed() {
+		return nil, domain.ErrAlreadyReviewed
+	}
+	if err := s.applyLabel(recognition, label); err != nil {
+		return nil, err
+	}
+
+	recognition.Status = domain.RecognitionCorrected
+	if s.matchesPrediction(recognition) {
+		recognition.Status = domain.RecognitionConfirmed
+	}
+	now := time.Now()
+	recognition.FeedbackAt = &now
+	if err := s.repo.Update(scope, recognition); err != nil {
+		return nil, err
+	}
+	return recognition, nil
+}
+
+// Review 专家审核标注。通过时可同时修正标签，驳回的记录不会进入训练数据集
+func (s *RecognitionService) Review(scope domain.TenantScope, reviewerID, id uint, approve bool, label, note string) (*domain.Recognition, error) {
+	recognition, err := s.GetRecognition(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(label) != "" {
+		if err := s.applyLabel(recognition, label); err != nil {
+			return nil, err
+		}
+	}
+
+	recognition.Status = domain.RecognitionRejected
+	if approve {
+		recognition.Status = domain.RecognitionApproved
+	}
+	now := time.Now()
+	recognition.ReviewerID = reviewerID
+	recognition.ReviewedAt = &now
+	recognition.ReviewNote = truncateRunes(strings.TrimSpace(note), 255)
+	if err := s.repo.Update(scope, recognition); err != nil {
+		return nil, err
+	}
+	return recognition, nil
+}
+
+// ExportDataset 将审核通过的记录导出为按标签分目录的训练数据集 ZIP：
+// images/<标签>/<记录ID>.<扩展名>，以及包含全部样本的 labels.csv
+func (s *RecognitionService) ExportDataset(scope domain.TenantScope, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	var rows [][]string
+
+	filter := domain.RecognitionFilter{Statuses: []domain.RecognitionStatus{domain.RecognitionApproved}}
+	var afterID uint
+	for {
+		batch, err := s.repo.FindAfter(scope, filter, afterID, datasetExportBatch)
+		if err != nil {
+			return err
+		}
+		for _, r := range batch {
+			afterID = r.ID
+			data, err := s.blobs.Get(r.ImageKey)
+			if err != nil {
+				log.Printf("导出训练数据集 - 读取识别图片 %d 失败: %v", r.ID, err)
+				continue
+			}
+			ext := ".jpg"
+			if strings.HasSuffix(r.ImageKey, ".png") {
+				ext = ".png"
+			}
+			name := fmt.Sprintf("images/%s/%d%s", datasetDirName(r.Label), r.ID, ext)
+			f, err := archive.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+
+			speciesID := ""
+			if r.SpeciesID != nil {
+				speciesID = strconv.FormatUint(uint64(*r.SpeciesID), 10)
+			}
+			rows = append(rows, []string{name, r.Label, speciesID, strconv.FormatUint(uint64(r.ID), 10), r.ImageHash, r.TopName})
+		}
+		if len(batch) < datasetExportBatch {
+			break
+		}
+	}
+
+	f, err := archive.Create("labels.csv")
+	if err != nil {
+		return err
+	}
+	index := csv.NewWriter(f)
+	_ = index.Write([]string{"file", "label", "species_id", "recognition_id", "image_hash", "predicted"})
+	_ = index.WriteAll(rows)
+	if err := index.Error(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// storeImage 按内容寻址保存原始图片，同一图片多次识别共用一份文件
+func (s *RecognitionService) storeImage(data []byte, format string) (hash, key string, err error) {
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	ext := ".jpg"
+	if format == "png" {
+		ext = ".png"
+	}
+	key = "recognitions/" + hash + ext
+	if err := s.blobs.Put(key, data, "image/"+format); err != nil {
+		return "", "", err
+	}
+	return hash, key, nil
+}
+
+// applyLabel 设置标签，能解析到物种库时使用规范名称并关联物种
+func (s *RecognitionService) applyLabel(recognition *domain.Recognition, label string) error {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return fmt.Errorf("%w: label is required", domain.ErrInvalidInput)
+	}
+	if utf8.RuneCountInString(label) > 128 {
+		return fmt.Errorf("%w: label must be at most 128 characters", domain.ErrInvalidInput)
+	}
+
+	recognition.Label = label
+	recognition.SpeciesID = nil
+	species, err := s.taxonomyService.ResolveSpecies(label)
+	if err == nil {
+		recognition.Label = species.SpeciesName
+		recognition.SpeciesID = &species.ID
+	} else if !errors.Is(err, domain.ErrSpeciesNotFound) {
+		return err
+	}
+	return nil
+}
+
+// matchesPrediction 标签与识别首选结果相同，或两者解析到同一物种
+func (s *RecognitionService) matchesPrediction(recognition *domain.Recognition) bool {
+	if recognition.Label == recognition.TopName {
+		return true
+	}
+	if recognition.SpeciesID == nil {
+		return false
+	}
+	predicted, err := s.taxonomyService.ResolveSpecies(recognition.TopName)
+	return err == nil && predicted.ID == *recognition.SpeciesID
+}
+
+func validateCoordinates(lat, lng *float64) error {
+	if (lat == nil) != (lng == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be provided together", domain.ErrInvalidInput)
+	}
+	if lat != nil && (*lat < -90 || *lat > 90 || *lng < -180 || *lng > 180) {
+		return fmt.Errorf("%w: coordinates out of range", domain.ErrInvalidInput)
+	}
+	return nil
+}
+
+// datasetDirName 将标签转换为可用作目录名的字符串
+func datasetDirName(label string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(label))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,311 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memRecognitionRepo 与数据库实现一样按 scope.OrgID 隔离识别记录
+type memRecognitionRepo struct {
+	mu           sync.Mutex
+	recognitions []*domain.Recognition
+}
+
+func (r *memRecognitionRepo) Create(scope domain.TenantScope, recognition *domain.Recognition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recognition.ID = uint(len(r.recognitions) + 1)
+	recognition.OrgID = scope.OrgID
+	copied := *recognition
+	r.recognitions = append(r.recognitions, &copied)
+	return nil
+}
+
+func (r *memRecognitionRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Recognition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range r.recognitions {
+		if rec.ID == id && rec.OrgID == scope.OrgID {
+			copied := *rec
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memRecognitionRepo) Find(scope domain.TenantScope, filter domain.RecognitionFilter) ([]*domain.Recognition, int64, error) {
+	found := r.filtered(scope, filter, 0)
+	return found, int64(len(found)), nil
+}
+
+func (r *memRecognitionRepo) FindAfter(scope domain.TenantScope, filter domain.RecognitionFilter, afterID uint, limit int) ([]*domain.Recognition, error) {
+	found := r.filtered(scope, filter, afterID)
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (r *memRecognitionRepo) filtered(scope domain.TenantScope, filter domain.RecognitionFilter, afterID uint) []*domain.Recognition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Recognition
+	for _, rec := range r.recognitions {
+		if rec.OrgID != scope.OrgID || rec.ID <= afterID || (filter.UserID != 0 && rec.UserID != filter.UserID) {
+			continue
+		}
+		if len(filter.Statuses) > 0 {
+			matched := false
+			for _, status := range filter.Statuses {
+				matched = matched || rec.Status == status
+			}
+			if !matched {
+				continue
+			}
+		}
+		copied := *rec
+		found = append(found, &copied)
+	}
+	return found
+}
+
+func (r *memRecognitionRepo) Update(scope domain.TenantScope, recognition *domain.Recognition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rec := range r.recognitions {
+		if rec.ID == recognition.ID && rec.OrgID == scope.OrgID {
+			copied := *recognition
+			r.recognitions[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memRecognitionRepo) DeletePending(ids []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.recognitions[:0]
+	for _, rec := range r.recognitions {
+		deleted := false
+		for _, id := range ids {
+			deleted = deleted || (rec.ID == id && rec.Status == domain.RecognitionPending)
+		}
+		if !deleted {
+			kept = append(kept, rec)
+		}
+	}
+	r.recognitions = kept
+	return nil
+}
+
+func (r *memRecognitionRepo) CountByImageKey(key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, rec := range r.recognitions {
+		if rec.ImageKey == key {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// recognizerFunc 以函数实现识别后端
+type recognizerFunc func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error)
+
+func (f recognizerFunc) Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+	return f(ctx, image)
+}
+
+// fixedRecognizer 总是按给定顺序返回这些名称
+func fixedRecognizer(names ...string) recognizerFunc {
+	return func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		candidates := make([]domain.RecognitionCandidate, len(names))
+		for i, name := range names {
+			candidates[i] = domain.RecognitionCandidate{Name: name, Score: 0.9 - float64(i)*0.1}
+		}
+		return candidates, nil
+	}
+}
+
+type recognitionFixture struct {
+	service *RecognitionService
+	repo    *memRecognitionRepo
+	blobs   *memBlobStore
+	carpID  uint
+}
+
+func newRecognitionFixture(recognizer Recognizer) *recognitionFixture {
+	species := &memSpeciesRepo{}
+	taxonomyRepo := &memTaxonomyRepo{species: species}
+	f := &recognitionFixture{repo: &memRecognitionRepo{}, blobs: newMemBlobStore()}
+	f.carpID = species.add("鲤鱼", "Cyprinus carpio")
+	taxonomyRepo.AddSpeciesName(&domain.SpeciesName{SpeciesID: f.carpID, Name: "鲤拐子"})
+	species.add("草鱼", "Ctenopharyngodon idella")
+	f.service = NewRecognitionService(recognizer, NewTaxonomyService(taxonomyRepo, species), f.repo, f.blobs, NewImageService(nil), "")
+	return f
+}
+
+// recognize 以用户 5 在组织 1 中识别一张图片，返回识别记录ID
+func (f *recognitionFixture) recognize(t *testing.T, seed int64) uint {
+	t.Helper()
+	result, err := f.service.Recognize(context.Background(), RecognitionRequest{Scope: domain.TenantScope{OrgID: 1}, UserID: 5, Image: testPNG(t, seed)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.RecognitionID
+}
+
+func TestRecognizePrefersFishCandidates(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("水草", "鲤拐子", "草鱼"))
+	result, err := f.service.Recognize(context.Background(), RecognitionRequest{Scope: domain.TenantScope{OrgID: 1}, UserID: 5, Image: testPNG(t, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 名称中含“鱼”的候选优先于置信度更高的其他候选
+	if result.Name != "草鱼" || result.CanonicalName != "草鱼" || len(result.Candidates) != 3 {
+		t.Errorf("result = %+v, want 草鱼", result)
+	}
+
+	lat := 30.5
+	if _, err := f.service.Recognize(context.Background(), RecognitionRequest{Scope: domain.TenantScope{OrgID: 1}, Image: testPNG(t, 1), Latitude: &lat}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("latitude without longitude: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestSubmitFeedbackStatus(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	scope := domain.TenantScope{OrgID: 1}
+
+	tests := []struct {
+		name       string
+		label      string
+		wantStatus domain.RecognitionStatus
+		wantLabel  string
+	}{
+		{"same as prediction", "鲤鱼", domain.RecognitionConfirmed, "鲤鱼"},
+		{"common name of the predicted species", " 鲤拐子 ", domain.RecognitionConfirmed, "鲤鱼"},
+		{"different species", "草鱼", domain.RecognitionCorrected, "草鱼"},
+		{"species not in the catalog", "鳜鱼", domain.RecognitionCorrected, "鳜鱼"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := f.recognize(t, int64(i))
+			recognition, err := f.service.SubmitFeedback(scope, 5, id, tt.label)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recognition.Status != tt.wantStatus || recognition.Label != tt.wantLabel || recognition.FeedbackAt == nil {
+				t.Errorf("status/label = %s/%s, want %s/%s", recognition.Status, recognition.Label, tt.wantStatus, tt.wantLabel)
+			}
+		})
+	}
+
+	id := f.recognize(t, 10)
+	if _, err := f.service.SubmitFeedback(scope, 6, id, "草鱼"); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("other user: err = %v, want ErrForbidden", err)
+	}
+	if _, err := f.service.SubmitFeedback(domain.TenantScope{OrgID: 2}, 5, id, "草鱼"); !errors.Is(err, domain.ErrRecognitionNotFound) {
+		t.Errorf("other org: err = %v, want ErrRecognitionNotFound", err)
+	}
+	if _, err := f.service.SubmitFeedback(scope, 5, id, "  "); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("empty label: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestReviewLocksFeedback(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	scope := domain.TenantScope{OrgID: 1}
+	id := f.recognize(t, 1)
+	if _, err := f.service.SubmitFeedback(scope, 5, id, "草鱼"); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, total, err := f.service.ListRecognitions(scope, domain.RecognitionFilter{Statuses: ReviewQueueStatuses})
+	if err != nil || total != 1 || queue[0].ID != id {
+		t.Fatalf("review queue = %d entries, %v", total, err)
+	}
+
+	recognition, err := f.service.Review(scope, 9, id, true, "鲤拐子", "鳞片特征明显")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recognition.Status != domain.RecognitionApproved || recognition.Label != "鲤鱼" || recognition.ReviewerID != 9 {
+		t.Errorf("reviewed = %s/%s by %d, want approved/鲤鱼 by 9", recognition.Status, recognition.Label, recognition.ReviewerID)
+	}
+	if _, err := f.service.SubmitFeedback(scope, 5, id, "草鱼"); !errors.Is(err, domain.ErrAlreadyReviewed) {
+		t.Errorf("feedback after review: err = %v, want ErrAlreadyReviewed", err)
+	}
+	if _, total, _ := f.service.ListRecognitions(scope, domain.RecognitionFilter{Statuses: ReviewQueueStatuses}); total != 0 {
+		t.Errorf("review queue after review = %d, want 0", total)
+	}
+}
+
+func TestExportDatasetOnlyApproved(t *testing.T) {
+	f := newRecognitionFixture(fixedRecognizer("鲤鱼"))
+	scope := domain.TenantScope{OrgID: 1}
+	approved := f.recognize(t, 1)
+	slashed := f.recognize(t, 2)
+	rejected := f.recognize(t, 3)
+	f.recognize(t, 4) // 未审核
+	if _, err := f.service.Review(scope, 9, approved, true, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.Review(scope, 9, slashed, true, "鲫鱼/银鲫", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.Review(scope, 9, rejected, false, "", "图片模糊"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.service.ExportDataset(scope, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, file := range archive.File {
+		names[file.Name] = true
+	}
+	for _, want := range []string{"images/鲤鱼/1.png", "images/鲫鱼_银鲫/2.png", "labels.csv"} {
+		if !names[want] {
+			t.Errorf("archive is missing %s, has %v", want, names)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("archive has %d files, want 3", len(names))
+	}
+
+	labels, err := archive.Open("labels.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer labels.Close()
+	rows, err := csv.NewReader(labels).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][1] != "鲤鱼" || rows[1][2] == "" || rows[2][2] != "" {
+		t.Errorf("labels.csv = %v", rows)
+	}
+
+	// 其他组织的数据集为空
+	buf.Reset()
+	if err := f.service.ExportDataset(domain.TenantScope{OrgID: 2}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if len(other.File) != 1 {
+		t.Errorf("other org archive has %d files, want only labels.csv", len(other.File))
+	}
+}
@@ -0,0 +1,243 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type RoleRepository interface {
+	FindAll() ([]*domain.RoleDefinition, error)
+	FindByName(name domain.Role) (*domain.RoleDefinition, error)
+	Save(role *domain.RoleDefinition) error
+	Delete(name domain.Role) error
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// RoleService 管理角色与权限。内置角色来自代码，自定义角色保存在数据库中并缓存在内存里
+type RoleService struct {
+	roleRepo    RoleRepository
+	userRepo    UserRepository
+	orgRepo     OrganizationRepository
+	authService *AuthService
+
+	mu    sync.RWMutex
+	cache map[domain.Role]*domain.RoleDefinition
+}
+
+func NewRoleService(roleRepo RoleRepository, userRepo UserRepository, orgRepo OrganizationRepository, authService *AuthService) *RoleService {
+	return &RoleService{
+		roleRepo:    roleRepo,
+		userRepo:    userRepo,
+		orgRepo:     orgRepo,
+		authService: authService,
+	}
+}
+
+// ListRoles 返回内置角色和自定义角色
+func (s *RoleService) ListRoles() ([]*domain.RoleDefinition, error) {
+	custom, err := s.roleRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]*domain.RoleDefinition, 0, len(domain.BuiltInRoles)+len(custom))
+	for _, r := range domain.BuiltInRoles {
+		roles = append(roles, domain.FindBuiltInRole(r.Name))
+	}
+	return append(roles, custom...), nil
+}
+
+// GetRole 获取角色定义
+func (s *RoleService) GetRole(name domain.Role) (*domain.RoleDefinition, error) {
+	if role := domain.FindBuiltInRole(name); role != nil {
+		return role, nil
+	}
+
+	s.mu.RLock()
+	role, ok := s.cache[name]
+	s.mu.RUnlock()
+	if ok {
+		return role, nil
+	}
+
+	role, err := s.roleRepo.FindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, domain.ErrRoleNotFound
+	}
+
+	s.mu.Lock()
+	if s.cache == nil {
+		s.cache = make(map[domain.Role]*domain.RoleDefinition)
+	}
+	s.cache[name] = role
+	s.mu.Unlock()
+	return role, nil
+}
+
+// HasPermission 判断角色是否拥有权限，未知角色不拥有任何权限
+func (s *RoleService) HasPermission(name domain.Role, want domain.Permission) (bool, error) {
+	role, err := s.GetRole(name)
+	if err == domain.ErrRoleNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role.HasPermission(want), nil
+}
+
+// EffectivePermissions 展开角色实际拥有的全部已定义权限
+func (s *RoleService) EffectivePermissions(name domain.Role) ([]domain.Permission, error) {
+	role, err := s.GetRole(name)
+	if err != nil {
+		return nil, err
+	}
+	var result []domain.Permission
+	for p := range domain.Permissions {
+		if role.HasPermission(p) {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// CreateRole 创建自定义角色
+func (s *RoleService) CreateRole(role *domain.RoleDefinition) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	if domain.FindBuiltInRole(role.Name) != nil {
+		return domain.ErrBuiltInRole
+	}
+	existing, err := s.roleRepo.FindByName(role.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: role %q already exists", domain.ErrInvalidInput, role.Name)
+	}
+	if err := s.roleRepo.Save(role); err != nil {
+		return err
+	}
+	s.invalidate(role.Name)
+	return nil
+}
+
+// UpdateRole 更新自定义角色的说明和权限
+func (s *RoleService) UpdateRole(role *domain.RoleDefinition) error {
+	if domain.FindBuiltInRole(role.Name) != nil {
+		return domain.ErrBuiltInRole
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	existing, err := s.roleRepo.FindByName(role.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return domain.ErrRoleNotFound
+	}
+	if err := s.roleRepo.Save(role); err != nil {
+		return err
+	}
+	s.invalidate(role.Name)
+	return nil
+}
+
+// DeleteRole 删除未被任何用户或组织成员使用的自定义角色
+func (s *RoleService) DeleteRole(name domain.Role) error {
+	if domain.FindBuiltInRole(name) != nil {
+		return domain.ErrBuiltInRole
+	}
+	if _, err := s.GetRole(name); err != nil {
+		return err
+	}
+	count, err := s.userRepo.CountByRole(name)
+	if err != nil {
+		return err
+	}
+	members, err := s.orgRepo.CountByRole(name)
+	if err != nil {
+		return err
+	}
+	if count+members > 0 {
+		return domain.ErrRoleInUse
+	}
+	if err := s.roleRepo.Delete(name); err != nil {
+		return err
+	}
+	s.invalidate(name)
+	return nil
+}
+
+// AssignRole 为用户分配全局角色，全局角色为 admin 的用户是平台管理员。不能降级最后一位平台管理员。
+// 访问令牌中带有全局角色，角色变化后吊销用户的全部会话和其创建的 API 密钥，使其重新登录后按新角色授权
+func (s *RoleService) AssignRole(userID uint, name domain.Role) error {
+	if _, err := s.GetRole(name); err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return domain.ErrUserNotFound
+	}
+	if user.Role == name {
+		return nil
+	}
+	if user.Role == domain.RoleAdmin && name != domain.RoleAdmin && !user.IsDisabled() {
+		count, err := s.userRepo.CountActiveByRole(domain.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return domain.ErrLastAdmin
+		}
+	}
+	if err := s.userRepo.UpdateRole(strconv.FormatUint(uint64(userID), 10), name); err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAPIKeys(userID); err != nil {
+		return err
+	}
+	return s.authService.LogoutAll(userID)
+}
+
+func (s *RoleService) invalidate(name domain.Role) {
+	s.mu.Lock()
+	delete(s.cache, name)
+	s.mu.Unlock()
+}
+
+func validateRole(role *domain.RoleDefinition) error {
+	role.Name = domain.Role(strings.ToLower(strings.TrimSpace(string(role.Name))))
+	if !roleNamePattern.MatchString(string(role.Name)) {
+		return fmt.Errorf("%w: role name must be 2-32 lowercase letters, digits, '-' or '_'", domain.ErrInvalidInput)
+	}
+	if len(role.Permissions) == 0 {
+		return fmt.Errorf("%w: role must grant at least one permission", domain.ErrInvalidInput)
+	}
+	seen := make(map[domain.Permission]bool, len(role.Permissions))
+	permissions := role.Permissions[:0]
+	for _, p := range role.Permissions {
+		if !p.IsValid() {
+			return fmt.Errorf("%w: unknown permission %q", domain.ErrInvalidInput, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			permissions = append(permissions, p)
+		}
+	}
+	role.Permissions = permissions
+	role.BuiltIn = false
+	return nil
+}
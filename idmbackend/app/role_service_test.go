@@ -0,0 +1,202 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memRoleRepo struct {
+	mu    sync.Mutex
+	roles map[domain.Role]*domain.RoleDefinition
+}
+
+func newMemRoleRepo() *memRoleRepo {
+	return &memRoleRepo{roles: make(map[domain.Role]*domain.RoleDefinition)}
+}
+
+func (r *memRoleRepo) FindAll() ([]*domain.RoleDefinition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.RoleDefinition
+	for _, role := range r.roles {
+		copied := *role
+		found = append(found, &copied)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found, nil
+}
+
+func (r *memRoleRepo) FindByName(name domain.Role) (*domain.RoleDefinition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, nil
+	}
+	copied := *role
+	return &copied, nil
+}
+
+func (r *memRoleRepo) Save(role *domain.RoleDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *role
+	r.roles[role.Name] = &copied
+	return nil
+}
+
+func (r *memRoleRepo) Delete(name domain.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.roles, name)
+	return nil
+}
+
+func TestCreateRoleValidation(t *testing.T) {
+	env := newTestEnv()
+	if err := env.roles.CreateRole(&domain.RoleDefinition{Name: "curator", Permissions: []domain.Permission{domain.PermSpeciesWrite}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		role domain.RoleDefinition
+		want error
+	}{
+		{"normalizes name and dedupes permissions", domain.RoleDefinition{Name: " Surveyor ", Permissions: []domain.Permission{domain.PermObservationsWrite, domain.PermObservationsWrite}}, nil},
+		{"built-in name", domain.RoleDefinition{Name: domain.RoleResearcher, Permissions: []domain.Permission{domain.PermSpeciesWrite}}, domain.ErrBuiltInRole},
+		{"existing name", domain.RoleDefinition{Name: "curator", Permissions: []domain.Permission{domain.PermSpeciesWrite}}, domain.ErrInvalidInput},
+		{"invalid name", domain.RoleDefinition{Name: "x", Permissions: []domain.Permission{domain.PermSpeciesWrite}}, domain.ErrInvalidInput},
+		{"no permissions", domain.RoleDefinition{Name: "empty"}, domain.ErrInvalidInput},
+		{"unknown permission", domain.RoleDefinition{Name: "fisher", Permissions: []domain.Permission{"fish:catch"}}, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := tt.role
+			err := env.roles.CreateRole(&role)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateRole = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	surveyor, err := env.roles.GetRole("surveyor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(surveyor.Permissions) != 1 || surveyor.BuiltIn {
+		t.Errorf("surveyor = %+v, want one permission and not built in", surveyor)
+	}
+}
+
+func TestRolePermissionsFollowUpdates(t *testing.T) {
+	env := newTestEnv()
+	role := &domain.RoleDefinition{Name: "curator", Permissions: []domain.Permission{"species:*"}}
+	if err := env.roles.CreateRole(role); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := env.roles.HasPermission("curator", domain.PermSpeciesAdmin)
+	if err != nil || !ok {
+		t.Fatalf("curator species:admin = %v, %v, want true", ok, err)
+	}
+	effective, err := env.roles.EffectivePermissions("curator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(effective) != 2 || effective[0] != domain.PermSpeciesAdmin || effective[1] != domain.PermSpeciesWrite {
+		t.Errorf("effective permissions = %v, want species:admin and species:write", effective)
+	}
+
+	// 更新后缓存失效，立即按新权限判断
+	if err := env.roles.UpdateRole(&domain.RoleDefinition{Name: "curator", Permissions: []domain.Permission{domain.PermSpeciesWrite}}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := env.roles.HasPermission("curator", domain.PermSpeciesAdmin); ok {
+		t.Error("curator keeps species:admin after update")
+	}
+	if ok, err := env.roles.HasPermission("ghost", domain.PermSpeciesWrite); ok || err != nil {
+		t.Errorf("unknown role = %v, %v, want false without error", ok, err)
+	}
+	if err := env.roles.UpdateRole(&domain.RoleDefinition{Name: domain.RoleUser, Permissions: []domain.Permission{domain.PermAll}}); !errors.Is(err, domain.ErrBuiltInRole) {
+		t.Errorf("update built-in role: err = %v, want ErrBuiltInRole", err)
+	}
+}
+
+func TestDeleteRoleInUse(t *testing.T) {
+	env := newTestEnv()
+	for _, name := range []domain.Role{"curator", "surveyor"} {
+		if err := env.roles.CreateRole(&domain.RoleDefinition{Name: name, Permissions: []domain.Permission{domain.PermSpeciesWrite}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := &domain.User{Username: "vera", Role: "curator"}
+	if err := env.users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.orgs.SaveMembership(&domain.Membership{OrgID: 1, UserID: 42, Role: "surveyor"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name domain.Role
+		want error
+	}{
+		{"curator", domain.ErrRoleInUse},
+		{"surveyor", domain.ErrRoleInUse},
+		{domain.RoleUser, domain.ErrBuiltInRole},
+		{"ghost", domain.ErrRoleNotFound},
+	}
+	for _, tt := range tests {
+		if err := env.roles.DeleteRole(tt.name); !errors.Is(err, tt.want) {
+			t.Errorf("DeleteRole(%s) = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := env.roles.AssignRole(user.ID, domain.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.roles.DeleteRole("curator"); err != nil {
+		t.Fatalf("DeleteRole after reassign: %v", err)
+	}
+	if _, err := env.roles.GetRole("curator"); !errors.Is(err, domain.ErrRoleNotFound) {
+		t.Errorf("deleted role: err = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestAssignRoleKeepsLastAdmin(t *testing.T) {
+	env := newTestEnv()
+	admin := &domain.User{Username: "wanda", Role: domain.RoleAdmin}
+	if err := env.users.Create(admin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.StartSession(admin, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.roles.AssignRole(admin.ID, domain.RoleUser); !errors.Is(err, domain.ErrLastAdmin) {
+		t.Fatalf("demote last admin: err = %v, want ErrLastAdmin", err)
+	}
+	if err := env.roles.AssignRole(admin.ID, "ghost"); !errors.Is(err, domain.ErrRoleNotFound) {
+		t.Errorf("unknown role: err = %v, want ErrRoleNotFound", err)
+	}
+	if err := env.roles.AssignRole(99, domain.RoleUser); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+
+	second := &domain.User{Username: "xavier", Role: domain.RoleAdmin}
+	if err := env.users.Create(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.roles.AssignRole(admin.ID, domain.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	// 角色变化后旧访问令牌中的角色失效，必须重新登录
+	if n := env.sessions.active(admin.ID); n != 0 {
+		t.Errorf("active sessions after role change = %d, want 0", n)
+	}
+}
@@ -0,0 +1,602 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// speciesTable 从文件中读出的表格数据，values 的键已映射为统一字段名
+type speciesTable struct {
+	rows    []tableRow
+	ignored int // 非种级分类单元或重复的出现记录等被忽略的行
+}
+
+type tableRow struct {
+	line   int
+	values map[string]string
+	names  []domain.SpeciesName
+}
+
+// exportColumns 本系统 CSV/XLSX 导出的列，可直接重新导入
+var exportColumns = []string{
+	"species_name", "scientific_name", "category", "weight", "length1", "length2", "length3",
+	"height", "width", "optimal_temp_range", "kingdom", "phylum", "class", "order", "family",
+	"genus", "vernacular_names",
+}
+
+// buildTable 按表头把记录转换为表格行，未知列被忽略
+func buildTable(header []string, records [][]string) *speciesTable {
+	fields := make([]string, len(header))
+	for i, h := range header {
+		fields[i] = columnAliases[normalizeHeader(h)]
+	}
+
+	table := &speciesTable{}
+	for i, record := range records {
+		values := map[string]string{}
+		empty := true
+		for j, value := range record {
+			if j >= len(fields) || fields[j] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				empty = false
+			}
+			values[fields[j]] = value
+		}
+		if empty {
+			continue
+		}
+		if !isSpeciesRank(values["taxon_rank"]) {
+			table.ignored++
+			continue
+		}
+		table.rows = append(table.rows, tableRow{line: i + 1, values: values})
+	}
+	return table
+}
+
+func isSpeciesRank(rank string) bool {
+	switch strings.ToLower(strings.TrimSpace(rank)) {
+	case "", "species", "subspecies", "variety", "form":
+		return true
+	}
+	return false
+}
+
+func readCSVTable(data []byte) (*speciesTable, error) {
+	records, err := readDelimited(data, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	return buildTable(records[0], records[1:]), nil
+}
+
+// readDelimited 读取 CSV/TSV 文本；comma 为0时根据首行自动判断分隔符
+func readDelimited(data []byte, comma rune, quoted bool) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if comma == 0 {
+		firstLine, _, _ := strings.Cut(string(data), "\n")
+		comma = ','
+		if strings.Count(firstLine, "\t") > strings.Count(firstLine, ",") {
+			comma = '\t'
+		}
+	}
+
+	if !quoted {
+		// Darwin Core 文本文件可以不使用引号，此时引号是普通字符
+		var records [][]string
+		for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			records = append(records, strings.Split(line, string(comma)))
+		}
+		return records, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+func writeCSVTable(records []*domain.SpeciesRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf") // 带 BOM，Excel 打开时中文不乱码
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := writer.Write(exportRow(record)); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func exportRow(record *domain.SpeciesRecord) []string {
+	s := record.Species
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		s.SpeciesName, s.ScientificName, s.Category, number(s.Weight), number(s.Length1),
+		number(s.Length2), number(s.Length3), number(s.Height), number(s.Width), s.OptimalTempRange,
+		record.Classification(domain.RankKingdom), record.Classification(domain.RankPhylum),
+		record.Classification(domain.RankClass), record.Classification(domain.RankOrder),
+		record.Classification(domain.RankFamily), record.Classification(domain.RankGenus),
+		formatVernacularNames(s.Names),
+	}
+}
+
+// ---- XLSX ----
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				Text string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXTable 读取工作簿中的第一张工作表
+func readXLSXTable(data []byte) (*speciesTable, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %v", err)
+	}
+
+	var shared xlsxSharedStrings
+	var sheetNames []string
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+		if strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml") {
+			sheetNames = append(sheetNames, f.Name)
+		}
+	}
+	if len(sheetNames) == 0 {
+		return nil, fmt.Errorf("xlsx file has no worksheets")
+	}
+	sort.Strings(sheetNames)
+
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxSheet
+	if err := decodeZipXML(files[sheetNames[0]], &sheet); err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	for _, row := range sheet.Rows {
+		var record []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = xlsxColumnIndex(cell.Ref)
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err == nil && idx >= 0 && idx < len(shared.Items) {
+					item := shared.Items[idx]
+					text := item.Text
+					for _, run := range item.Runs {
+						text += run.Text
+					}
+					record[col] = text
+				}
+			case "inlineStr":
+				record[col] = cell.Inline.Text
+			default:
+				record[col] = cell.Value
+			}
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty worksheet")
+	}
+	return buildTable(records[0], records[1:]), nil
+}
+
+// xlsxColumnIndex 将 "AB12" 形式的单元格引用转换为从0开始的列号
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
+
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	content, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(content, v)
+}
+
+// writeXLSXTable 生成只包含一张工作表的最小 XLSX 文件
+func writeXLSXTable(records []*domain.SpeciesRecord) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeRow := func(rowNum int, values []string, numeric func(int) bool) {
+		fmt.Fprintf(&sheet, `<row r="%d">`, rowNum)
+		for col, value := range values {
+			ref := fmt.Sprintf("%s%d", xlsxColumnName(col), rowNum)
+			if numeric(col) {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, value)
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t>`, ref)
+			xml.EscapeText(&sheet, []byte(value))
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+
+	writeRow(1, exportColumns, func(int) bool { return false })
+	for i, record := range records {
+		writeRow(i+2, exportRow(record), func(col int) bool { return col >= 3 && col <= 8 })
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	return writeZip([]zipEntry{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="species" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	})
+}
+
+type zipEntry struct {
+	name    string
+	content string
+}
+
+func writeZip(entries []zipEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := archive.Create(entry.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, entry.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ---- Darwin Core Archive ----
+
+const (
+	dwcTerms = "http://rs.tdwg.org/dwc/terms/"
+	dcTerms  = "http://purl.org/dc/terms/"
+	gbifRow  = "http://rs.gbif.org/terms/1.0/VernacularName"
+)
+
+type dwcaMeta struct {
+	Core       dwcaFile   `xml:"core"`
+	Extensions []dwcaFile `xml:"extension"`
+}
+
+type dwcaFile struct {
+	RowType            string      `xml:"rowType,attr"`
+	FieldsTerminatedBy string      `xml:"fieldsTerminatedBy,attr"`
+	FieldsEnclosedBy   string      `xml:"fieldsEnclosedBy,attr"`
+	IgnoreHeaderLines  int         `xml:"ignoreHeaderLines,attr"`
+	Location           string      `xml:"files>location"`
+	ID                 *dwcaIndex  `xml:"id"`
+	CoreID             *dwcaIndex  `xml:"coreid"`
+	Fields             []dwcaField `xml:"field"`
+}
+
+type dwcaIndex struct {
+	Index int `xml:"index,attr"`
+}
+
+type dwcaField struct {
+	Index   *int   `xml:"index,attr"`
+	Term    string `xml:"term,attr"`
+	Default string `xml:"default,attr"`
+}
+
+// readDwCATable 读取 Darwin Core Archive 的 Taxon 或 Occurrence 核心文件，
+// 并合并 VernacularName 扩展中的俗名。出现记录按学名去重。
+func readDwCATable(data []byte) (*speciesTable, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Darwin Core Archive: %v", err)
+	}
+
+	files := map[string]*zip.File{}
+	var dataFiles []*zip.File
+	for _, f := range archive.File {
+		files[path.Base(f.Name)] = f
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext == ".txt" || ext == ".csv" || ext == ".tsv" {
+			dataFiles = append(dataFiles, f)
+		}
+	}
+
+	metaFile, ok := files["meta.xml"]
+	if !ok {
+		// 没有 meta.xml 时，归档中只能有一个带表头的数据文件
+		if len(dataFiles) != 1 {
+			return nil, fmt.Errorf("archive has no meta.xml and %d data files", len(dataFiles))
+		}
+		content, err := readZipFile(dataFiles[0])
+		if err != nil {
+			return nil, err
+		}
+		return readCSVTable(content)
+	}
+
+	var meta dwcaMeta
+	if err := decodeZipXML(metaFile, &meta); err != nil {
+		return nil, fmt.Errorf("invalid meta.xml: %v", err)
+	}
+
+	names := map[string][]domain.SpeciesName{}
+	for _, ext := range meta.Extensions {
+		if !strings.HasSuffix(ext.RowType, "VernacularName") || ext.CoreID == nil {
+			continue
+		}
+		rows, err := readDwCAFile(files, ext)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if ext.CoreID.Index >= len(row.raw) {
+				continue
+			}
+			coreID := strings.TrimSpace(row.raw[ext.CoreID.Index])
+			if name := row.terms["vernacularname"]; name != "" && coreID != "" {
+				names[coreID] = append(names[coreID], domain.SpeciesName{Name: name, Language: row.terms["language"]})
+			}
+		}
+	}
+
+	rows, err := readDwCAFile(files, meta.Core)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := strings.HasSuffix(meta.Core.RowType, "Occurrence")
+	seen := map[string]bool{}
+	table := &speciesTable{}
+	for _, row := range rows {
+		values := map[string]string{}
+		for term, value := range row.terms {
+			if field := columnAliases[term]; field != "" {
+				values[field] = value
+			}
+		}
+		if !isSpeciesRank(values["taxon_rank"]) {
+			table.ignored++
+			continue
+		}
+		if occurrences {
+			key := scientificKey(values["scientific_name"])
+			if seen[key] {
+				table.ignored++
+				continue
+			}
+			seen[key] = true
+		}
+
+		var rowNames []domain.SpeciesName
+		if meta.Core.ID != nil && meta.Core.ID.Index < len(row.raw) {
+			rowNames = names[strings.TrimSpace(row.raw[meta.Core.ID.Index])]
+		}
+		table.rows = append(table.rows, tableRow{line: row.line, values: values, names: rowNames})
+	}
+	return table, nil
+}
+
+type dwcaRow struct {
+	line  int
+	raw   []string
+	terms map[string]string // 键为规范化后的术语名，如 scientificname
+}
+
+func readDwCAFile(files map[string]*zip.File, desc dwcaFile) ([]dwcaRow, error) {
+	f, ok := files[path.Base(desc.Location)]
+	if !ok {
+		return nil, fmt.Errorf("archive is missing %s", desc.Location)
+	}
+	content, err := readZipFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	comma := ','
+	if sep := unescapeDelimiter(desc.FieldsTerminatedBy); sep != "" {
+		comma = []rune(sep)[0]
+	}
+	records, err := readDelimited(content, comma, desc.FieldsEnclosedBy != "")
+	if err != nil {
+		return nil, err
+	}
+	if desc.IgnoreHeaderLines > len(records) {
+		return nil, nil
+	}
+	records = records[desc.IgnoreHeaderLines:]
+
+	rows := make([]dwcaRow, 0, len(records))
+	for i, record := range records {
+		row := dwcaRow{line: i + 1, raw: record, terms: map[string]string{}}
+		for _, field := range desc.Fields {
+			value := field.Default
+			if field.Index != nil && *field.Index < len(record) && strings.TrimSpace(record[*field.Index]) != "" {
+				value = strings.TrimSpace(record[*field.Index])
+			}
+			row.terms[normalizeHeader(field.Term)] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func unescapeDelimiter(s string) string {
+	return strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\r`, "\r").Replace(s)
+}
+
+// maxZipEntrySize 导入文件中单个压缩条目解压后的大小上限，防止压缩炸弹耗尽内存
+const maxZipEntrySize = 64 << 20
+
+// readZipFile 读取压缩条目。目录中声明的大小超过上限时直接拒绝，读取时最多读到上限多一个字节
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxZipEntrySize {
+		return nil, fmt.Errorf("%s exceeds %d MB when uncompressed", f.Name, maxZipEntrySize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, maxZipEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	// 目录中声明的大小可能与实际内容不符，按实际读取的大小再检查一次
+	if len(content) > maxZipEntrySize {
+		return nil, fmt.Errorf("%s exceeds %d MB when uncompressed", f.Name, maxZipEntrySize>>20)
+	}
+	return content, nil
+}
+
+// writeDwCA 导出以 Taxon 为核心、带 VernacularName 扩展的 Darwin Core Archive
+func writeDwCA(records []*domain.SpeciesRecord) ([]byte, error) {
+	taxonTerms := []string{
+		dwcTerms + "scientificName", dwcTerms + "taxonRank", dwcTerms + "kingdom", dwcTerms + "phylum",
+		dwcTerms + "class", dwcTerms + "order", dwcTerms + "family", dwcTerms + "genus",
+		dwcTerms + "vernacularName",
+	}
+
+	var taxa, vernacular strings.Builder
+	taxa.WriteString("taxonID\tscientificName\ttaxonRank\tkingdom\tphylum\tclass\torder\tfamily\tgenus\tvernacularName\n")
+	vernacular.WriteString("taxonID\tvernacularName\tlanguage\n")
+	for _, record := range records {
+		s := record.Species
+		id := strconv.FormatUint(uint64(s.ID), 10)
+		fields := []string{
+			id, s.ScientificName, string(domain.RankSpecies),
+			record.Classification(domain.RankKingdom), record.Classification(domain.RankPhylum),
+			record.Classification(domain.RankClass), record.Classification(domain.RankOrder),
+			record.Classification(domain.RankFamily), record.Classification(domain.RankGenus),
+			s.SpeciesName,
+		}
+		taxa.WriteString(tsvLine(fields))
+
+		vernacular.WriteString(tsvLine([]string{id, s.SpeciesName, "zh"}))
+		for _, name := range s.Names {
+			if name.Kind == domain.NameKindCommon {
+				vernacular.WriteString(tsvLine([]string{id, name.Name, name.Language}))
+			}
+		}
+	}
+
+	var meta strings.Builder
+	meta.WriteString(xml.Header)
+	meta.WriteString(`<archive xmlns="http://rs.tdwg.org/dwc/text/" metadata="eml.xml">` + "\n")
+	meta.WriteString(`  <core encoding="UTF-8" fieldsTerminatedBy="\t" linesTerminatedBy="\n" fieldsEnclosedBy="" ignoreHeaderLines="1" rowType="` + dwcTerms + `Taxon">` + "\n")
+	meta.WriteString("    <files><location>taxon.txt</location></files>\n    <id index=\"0\"/>\n")
+	for i, term := range taxonTerms {
+		fmt.Fprintf(&meta, "    <field index=\"%d\" term=\"%s\"/>\n", i+1, term)
+	}
+	meta.WriteString("  </core>\n")
+	meta.WriteString(`  <extension encoding="UTF-8" fieldsTerminatedBy="\t" linesTerminatedBy="\n" fieldsEnclosedBy="" ignoreHeaderLines="1" rowType="` + gbifRow + `">` + "\n")
+	meta.WriteString("    <files><location>vernacularname.txt</location></files>\n    <coreid index=\"0\"/>\n")
+	fmt.Fprintf(&meta, "    <field index=\"1\" term=\"%svernacularName\"/>\n", dwcTerms)
+	fmt.Fprintf(&meta, "    <field index=\"2\" term=\"%slanguage\"/>\n", dcTerms)
+	meta.WriteString("  </extension>\n</archive>\n")
+
+	eml := xml.Header + `<eml:eml xmlns:eml="eml://ecoinformatics.org/eml-2.1.1" packageId="ocean-vision-species" system="ocean-vision">` +
+		`<dataset><title>海洋视觉系统物种名录</title>` +
+		`<pubDate>` + time.Now().Format("2006-01-02") + `</pubDate>` +
+		`<language>zh</language></dataset></eml:eml>` + "\n"
+
+	return writeZip([]zipEntry{
+		{"meta.xml", meta.String()},
+		{"eml.xml", eml},
+		{"taxon.txt", taxa.String()},
+		{"vernacularname.txt", vernacular.String()},
+	})
+}
+
+// tsvLine 生成一行不带引号的制表符分隔文本，值中的制表符和换行替换为空格
+func tsvLine(fields []string) string {
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	for i, f := range fields {
+		fields[i] = clean.Replace(f)
+	}
+	return strings.Join(fields, "\t") + "\n"
+}
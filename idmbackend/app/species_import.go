@@ -0,0 +1,456 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// ImportFormat 物种数据文件格式
+type ImportFormat string
+
+const (
+	FormatCSV  ImportFormat = "csv"
+	FormatXLSX ImportFormat = "xlsx"
+	FormatDwCA ImportFormat = "dwca" // Darwin Core Archive（zip）
+)
+
+// ImportMode 存在无效行时的处理方式
+type ImportMode string
+
+const (
+	ImportAllOrNothing ImportMode = "all_or_nothing"
+	ImportSkipInvalid  ImportMode = "skip_invalid"
+)
+
+type ImportOptions struct {
+	Format ImportFormat
+	Mode   ImportMode
+	DryRun bool
+}
+
+// RowError 某一行数据的校验错误，Row 从1开始计数（不含表头）
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport 导入结果，DryRun 时只校验不写入
+type ImportReport struct {
+	Mode     ImportMode `json:"mode"`
+	DryRun   bool       `json:"dry_run"`
+	Total    int        `json:"total"`
+	Valid    int        `json:"valid"`
+	Imported int        `json:"imported"`
+	Skipped  int        `json:"skipped"`
+	Ignored  int        `json:"ignored"`
+	Errors   []RowError `json:"errors"`
+}
+
+// SpeciesInput 一条待导入的物种数据
+type SpeciesInput struct {
+	SpeciesName      string                      `json:"species_name"`
+	ScientificName   string                      `json:"scientific_name"`
+	Category         string                      `json:"category"`
+	Weight           float64                     `json:"weight"`
+	Length1          float64                     `json:"length1"`
+	Length2          float64                     `json:"length2"`
+	Length3          float64                     `json:"length3"`
+	Height           float64                     `json:"height"`
+	Width            float64                     `json:"width"`
+	OptimalTempRange string                      `json:"optimal_temp_range"`
+	Classification   map[domain.TaxonRank]string `json:"classification,omitempty"`
+	VernacularNames  []domain.SpeciesName        `json:"vernacular_names,omitempty"`
+}
+
+// CreateSpeciesBatch 批量创建物种数据，任意一条无效时全部不写入
+func (s *SpeciesService) CreateSpeciesBatch(inputs []SpeciesInput) (*ImportReport, error) {
+	rows := make([]importRow, len(inputs))
+	for i := range inputs {
+		rows[i] = importRow{line: i + 1, input: inputs[i]}
+	}
+	return s.importRows(rows, ImportOptions{Mode: ImportAllOrNothing}, 0, nil)
+}
+
+// ImportSpecies 解析 CSV、XLSX 或 Darwin Core Archive 文件并导入物种。
+// 所有写入在同一个事务中完成；学名已存在或文件内重复的行视为无效行。
+func (s *SpeciesService) ImportSpecies(data []byte, opts ImportOptions) (*ImportReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportAllOrNothing
+	}
+	if opts.Mode != ImportAllOrNothing && opts.Mode != ImportSkipInvalid {
+		return nil, fmt.Errorf("%w: unknown import mode %q", domain.ErrInvalidInput, opts.Mode)
+	}
+
+	var table *speciesTable
+	var err error
+	switch opts.Format {
+	case FormatCSV:
+		table, err = readCSVTable(data)
+	case FormatXLSX:
+		table, err = readXLSXTable(data)
+	case FormatDwCA:
+		table, err = readDwCATable(data)
+	default:
+		return nil, fmt.Errorf("%w: unknown import format %q", domain.ErrInvalidInput, opts.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+	}
+
+	var rows []importRow
+	var parseErrors []RowError
+	for _, r := range table.rows {
+		input, errs := rowToInput(r.values, r.names)
+		parseErrors = append(parseErrors, withRow(errs, r.line)...)
+		if len(errs) == 0 {
+			rows = append(rows, importRow{line: r.line, input: input})
+		}
+	}
+
+	return s.importRows(rows, opts, table.ignored, parseErrors)
+}
+
+// ExportSpecies 按指定格式导出全部物种及其分类路径和俗名
+func (s *SpeciesService) ExportSpecies(format ImportFormat) ([]byte, error) {
+	records, err := s.speciesRepo.FindAllRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSVTable(records)
+	case FormatXLSX:
+		return writeXLSXTable(records)
+	case FormatDwCA:
+		return writeDwCA(records)
+	default:
+		return nil, fmt.Errorf("%w: unknown export format %q", domain.ErrInvalidInput, format)
+	}
+}
+
+type importRow struct {
+	line  int
+	input SpeciesInput
+}
+
+// importRows 校验、查重并写入已解析的行，parseErrors 为解析阶段已被剔除的行的错误
+func (s *SpeciesService) importRows(rows []importRow, opts ImportOptions, ignored int, parseErrors []RowError) (*ImportReport, error) {
+	report := &ImportReport{
+		Mode:    opts.Mode,
+		DryRun:  opts.DryRun,
+		Total:   len(rows) + countRows(parseErrors),
+		Ignored: ignored,
+		Errors:  append([]RowError{}, parseErrors...),
+	}
+	if opts.Mode == "" {
+		report.Mode = ImportAllOrNothing
+	}
+
+	var names, vernaculars []string
+	for _, row := range rows {
+		if name := strings.TrimSpace(row.input.ScientificName); name != "" {
+			names = append(names, name)
+		}
+		for _, name := range row.input.VernacularNames {
+			if name := normalizeName(name.Name); name != "" {
+				vernaculars = append(vernaculars, name)
+			}
+		}
+	}
+	existing := map[string]bool{}
+	if len(names) > 0 {
+		found, err := s.speciesRepo.FindExistingScientificNames(names)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range found {
+			existing[scientificKey(name)] = true
+		}
+	}
+	// 俗名/异名已指向库中其他物种时，按名称解析物种会产生歧义
+	taken := map[string]bool{}
+	if len(vernaculars) > 0 {
+		found, err := s.speciesRepo.FindExistingNames(vernaculars)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range found {
+			taken[scientificKey(name)] = true
+		}
+	}
+
+	seen := map[string]int{}
+	seenVernacular := map[string]int{}
+	var valid []*domain.SpeciesRecord
+	for _, row := range rows {
+		record, errs := validateInput(row.input)
+		if len(errs) == 0 {
+			key := scientificKey(record.Species.ScientificName)
+			if existing[key] {
+				errs = append(errs, RowError{Field: "scientific_name", Message: "学名已存在: " + record.Species.ScientificName})
+			} else if first, ok := seen[key]; ok {
+				errs = append(errs, RowError{Field: "scientific_name", Message: fmt.Sprintf("与第%d行学名重复", first)})
+			}
+			for _, name := range record.Species.Names {
+				nameKey := scientificKey(name.Name)
+				if taken[nameKey] {
+					errs = append(errs, RowError{Field: "vernacular_names", Message: "俗名已被其他物种使用: " + name.Name})
+				} else if first, ok := seenVernacular[nameKey]; ok && first != row.line {
+					errs = append(errs, RowError{Field: "vernacular_names", Message: fmt.Sprintf("俗名%s与第%d行重复", name.Name, first)})
+				}
+			}
+			if len(errs) == 0 {
+				seen[key] = row.line
+				for _, name := range record.Species.Names {
+					seenVernacular[scientificKey(name.Name)] = row.line
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			report.Errors = append(report.Errors, withRow(errs, row.line)...)
+			continue
+		}
+		valid = append(valid, record)
+	}
+
+	report.Valid = len(valid)
+	report.Skipped = report.Total - report.Valid
+	if opts.DryRun || len(valid) == 0 {
+		return report, nil
+	}
+	if opts.Mode != ImportSkipInvalid && len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	if err := s.speciesRepo.ImportRecords(valid); err != nil {
+		return nil, err
+	}
+	report.Imported = len(valid)
+	return report, nil
+}
+
+// validateInput 检查必填字段和数值范围，并构造带分类路径的物种记录
+func validateInput(in SpeciesInput) (*domain.SpeciesRecord, []RowError) {
+	var errs []RowError
+
+	in.ScientificName = normalizeName(in.ScientificName)
+	in.SpeciesName = normalizeName(in.SpeciesName)
+	if in.ScientificName == "" {
+		errs = append(errs, RowError{Field: "scientific_name", Message: "学名不能为空"})
+	}
+	if in.SpeciesName == "" {
+		// Darwin Core 数据常常没有中文名，退化为使用学名
+		in.SpeciesName = in.ScientificName
+	}
+
+	numbers := []struct {
+		field string
+		value float64
+	}{
+		{"weight", in.Weight}, {"length1", in.Length1}, {"length2", in.Length2},
+		{"length3", in.Length3}, {"height", in.Height}, {"width", in.Width},
+	}
+	for _, n := range numbers {
+		if n.value < 0 {
+			errs = append(errs, RowError{Field: n.field, Message: "不能为负数"})
+		}
+	}
+
+	for rank := range in.Classification {
+		if rank.Level() < 0 || rank == domain.RankSpecies {
+			errs = append(errs, RowError{Field: string(rank), Message: "未知的分类阶元"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	category := normalizeName(in.Category)
+	if category == "" {
+		category = normalizeName(in.Classification[domain.RankClass])
+	}
+
+	species := &domain.Species{
+		SpeciesName:      in.SpeciesName,
+		ScientificName:   in.ScientificName,
+		Category:         category,
+		Weight:           in.Weight,
+		Length1:          in.Length1,
+		Length2:          in.Length2,
+		Length3:          in.Length3,
+		Height:           in.Height,
+		Width:            in.Width,
+		OptimalTempRange: in.OptimalTempRange,
+	}
+	seenNames := map[string]bool{in.SpeciesName: true, in.ScientificName: true}
+	for _, name := range in.VernacularNames {
+		name.Name = normalizeName(name.Name)
+		if name.Name == "" || seenNames[name.Name] {
+			continue
+		}
+		seenNames[name.Name] = true
+		if name.Language == "" {
+			name.Language = "zh"
+		}
+		if name.Kind == "" {
+			name.Kind = domain.NameKindCommon
+		}
+		name.ID, name.SpeciesID = 0, 0
+		species.Names = append(species.Names, name)
+	}
+
+	record := &domain.SpeciesRecord{Species: species}
+	for _, rank := range domain.TaxonRanks[:len(domain.TaxonRanks)-1] {
+		if name := normalizeName(in.Classification[rank]); name != "" {
+			record.Lineage = append(record.Lineage, domain.Taxon{Rank: rank, ScientificName: name})
+		}
+	}
+	if len(record.Lineage) > 0 {
+		record.Lineage = append(record.Lineage, domain.Taxon{Rank: domain.RankSpecies, ScientificName: in.ScientificName})
+	}
+	return record, nil
+}
+
+// columnAliases 将规范化后的表头映射为字段名，同时支持本系统列名和 Darwin Core 术语
+var columnAliases = map[string]string{
+	"speciesname":       "species_name",
+	"chinesename":       "species_name",
+	"scientificname":    "scientific_name",
+	"category":          "category",
+	"weight":            "weight",
+	"length1":           "length1",
+	"length2":           "length2",
+	"length3":           "length3",
+	"height":            "height",
+	"width":             "width",
+	"optimaltemprange":  "optimal_temp_range",
+	"vernacularname":    "vernacular_name",
+	"vernacularnames":   "vernacular_names",
+	"kingdom":           "kingdom",
+	"phylum":            "phylum",
+	"class":             "class",
+	"order":             "order",
+	"family":            "family",
+	"genus":             "genus",
+	"taxonrank":         "taxon_rank",
+	"scientificnameid":  "",
+	"taxonid":           "",
+	"occurrenceid":      "",
+	"id":                "",
+	"language":          "",
+	"individualcount":   "",
+	"eventdate":         "",
+	"basisofrecord":     "",
+	"decimallatitude":   "",
+	"decimallongitude":  "",
+	"acceptednameusage": "",
+}
+
+// normalizeHeader 去掉下划线、空格和大小写差异，便于匹配不同来源的列名
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	if i := strings.LastIndexAny(header, "/#"); i >= 0 {
+		header = header[i+1:]
+	}
+	return strings.NewReplacer("_", "", " ", "", "-", "").Replace(header)
+}
+
+// rowToInput 将一行文本值转换为 SpeciesInput，数值列解析失败时返回错误
+func rowToInput(values map[string]string, names []domain.SpeciesName) (SpeciesInput, []RowError) {
+	in := SpeciesInput{Classification: map[domain.TaxonRank]string{}, VernacularNames: names}
+	var errs []RowError
+
+	number := func(field string, dst *float64) {
+		raw := strings.TrimSpace(values[field])
+		if raw == "" {
+			return
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			errs = append(errs, RowError{Field: field, Message: "必须是数字: " + raw})
+			return
+		}
+		*dst = v
+	}
+
+	in.SpeciesName = values["species_name"]
+	in.ScientificName = values["scientific_name"]
+	in.Category = values["category"]
+	in.OptimalTempRange = values["optimal_temp_range"]
+	number("weight", &in.Weight)
+	number("length1", &in.Length1)
+	number("length2", &in.Length2)
+	number("length3", &in.Length3)
+	number("height", &in.Height)
+	number("width", &in.Width)
+
+	if vernacular := normalizeName(values["vernacular_name"]); vernacular != "" {
+		if in.SpeciesName == "" {
+			in.SpeciesName = vernacular
+		} else {
+			in.VernacularNames = append(in.VernacularNames, domain.SpeciesName{Name: vernacular})
+		}
+	}
+	in.VernacularNames = append(in.VernacularNames, parseVernacularNames(values["vernacular_names"])...)
+
+	for _, rank := range domain.TaxonRanks[:len(domain.TaxonRanks)-1] {
+		if v := values[string(rank)]; v != "" {
+			in.Classification[rank] = v
+		}
+	}
+	return in, errs
+}
+
+// parseVernacularNames 解析 "鲤@zh; common carp@en" 形式的俗名列表
+func parseVernacularNames(raw string) []domain.SpeciesName {
+	var names []domain.SpeciesName
+	for _, part := range strings.Split(raw, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name := domain.SpeciesName{Name: part}
+		if i := strings.LastIndex(part, "@"); i > 0 {
+			name.Name, name.Language = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func formatVernacularNames(names []domain.SpeciesName) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name.Kind == domain.NameKindSynonym {
+			continue
+		}
+		parts = append(parts, name.Name+"@"+name.Language)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func scientificKey(name string) string {
+	return strings.ToLower(normalizeName(name))
+}
+
+func withRow(errs []RowError, line int) []RowError {
+	for i := range errs {
+		errs[i].Row = line
+	}
+	return errs
+}
+
+// countRows 统计错误涉及的不同行数
+func countRows(errs []RowError) int {
+	rows := map[int]bool{}
+	for _, e := range errs {
+		rows[e.Row] = true
+	}
+	return len(rows)
+}
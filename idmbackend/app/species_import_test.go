@@ -0,0 +1,204 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+const importCSV = `species_name,scientific_name,category,weight,genus,family,vernacular_names
+鲤鱼,Cyprinus carpio,鲤形目,2.5,Cyprinus,Cyprinidae,common carp@en
+金鱼,Carassius auratus,鲤形目,0.2,Carassius,Cyprinidae,
+鲫鱼,carassius  AURATUS,鲤形目,0.3,,,
+草鱼,Ctenopharyngodon idella,鲤形目,abc,,,
+青鱼,Mylopharyngodon piceus,鲤形目,-1,,,
+鳙鱼,Hypophthalmichthys nobilis,鲤形目,3,,,common carp@en
+`
+
+func TestImportSpeciesCSVModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         ImportOptions
+		wantImported int
+		wantStored   int
+	}{
+		{"all or nothing rejects the file", ImportOptions{Format: FormatCSV}, 0, 1},
+		{"skip invalid imports valid rows", ImportOptions{Format: FormatCSV, Mode: ImportSkipInvalid}, 2, 3},
+		{"dry run writes nothing", ImportOptions{Format: FormatCSV, Mode: ImportSkipInvalid, DryRun: true}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memSpeciesRepo{}
+			repo.add("鲈鱼", "Lateolabrax japonicus")
+			report, err := NewSpeciesService(repo).ImportSpecies([]byte(importCSV), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 鲫鱼学名与第2行重复，草鱼重量不是数字，青鱼重量为负，鳙鱼俗名与第1行重复
+			if report.Total != 6 || report.Valid != 2 || report.Skipped != 4 {
+				t.Errorf("total/valid/skipped = %d/%d/%d, want 6/2/4", report.Total, report.Valid, report.Skipped)
+			}
+			rows := map[int]bool{}
+			for _, e := range report.Errors {
+				rows[e.Row] = true
+			}
+			for _, row := range []int{3, 4, 5, 6} {
+				if !rows[row] {
+					t.Errorf("row %d has no error, errors = %+v", row, report.Errors)
+				}
+			}
+			if report.Imported != tt.wantImported {
+				t.Errorf("imported = %d, want %d", report.Imported, tt.wantImported)
+			}
+			if len(repo.species) != tt.wantStored {
+				t.Errorf("stored species = %d, want %d", len(repo.species), tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestImportSpeciesRejectsExistingNames(t *testing.T) {
+	repo := &memSpeciesRepo{}
+	repo.add("鲤鱼", "Cyprinus carpio")
+	data := "scientific_name,vernacular_names\nCYPRINUS CARPIO,\nCarassius auratus,鲤鱼@zh\nCtenopharyngodon idella,grass carp@en\n"
+
+	report, err := NewSpeciesService(repo).ImportSpecies([]byte(data), ImportOptions{Format: FormatCSV, Mode: ImportSkipInvalid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || len(report.Errors) != 2 {
+		t.Fatalf("imported = %d, errors = %+v, want 1 imported and 2 errors", report.Imported, report.Errors)
+	}
+	if report.Errors[0].Field != "scientific_name" || report.Errors[1].Field != "vernacular_names" {
+		t.Errorf("error fields = %q/%q, want scientific_name/vernacular_names", report.Errors[0].Field, report.Errors[1].Field)
+	}
+	// 学名缺失时中文名退化为学名
+	if got := repo.species[1].SpeciesName; got != "Ctenopharyngodon idella" {
+		t.Errorf("species_name = %q, want scientific name", got)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []ImportFormat{FormatCSV, FormatXLSX, FormatDwCA} {
+		t.Run(string(format), func(t *testing.T) {
+			source := &memSpeciesRepo{}
+			report, err := NewSpeciesService(source).ImportSpecies([]byte(importCSV), ImportOptions{Format: FormatCSV, Mode: ImportSkipInvalid})
+			if err != nil || report.Imported != 2 {
+				t.Fatalf("seed import: report = %+v, err = %v", report, err)
+			}
+			data, err := NewSpeciesService(source).ExportSpecies(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target := &memSpeciesRepo{}
+			report, err = NewSpeciesService(target).ImportSpecies(data, ImportOptions{Format: format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Imported != 2 || len(report.Errors) != 0 {
+				t.Fatalf("re-import: imported = %d, errors = %+v", report.Imported, report.Errors)
+			}
+
+			record := target.records[0]
+			if record.Species.ScientificName != "Cyprinus carpio" {
+				t.Errorf("scientific_name = %q, want Cyprinus carpio", record.Species.ScientificName)
+			}
+			if got := record.Classification(domain.RankFamily); got != "Cyprinidae" {
+				t.Errorf("family = %q, want Cyprinidae", got)
+			}
+			if len(record.Species.Names) != 1 || record.Species.Names[0].Name != "common carp" || record.Species.Names[0].Language != "en" {
+				t.Errorf("names = %+v, want common carp@en", record.Species.Names)
+			}
+		})
+	}
+}
+
+func TestImportSpeciesInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		opts ImportOptions
+	}{
+		{"unknown format", []byte("a,b"), ImportOptions{Format: "json"}},
+		{"unknown mode", []byte("a,b"), ImportOptions{Format: FormatCSV, Mode: "best_effort"}},
+		{"empty csv", nil, ImportOptions{Format: FormatCSV}},
+		{"xlsx that is not a zip", []byte("not a zip"), ImportOptions{Format: FormatXLSX}},
+		{"dwca with several data files and no meta.xml", zipOf(t, map[string]string{"taxon.txt": "scientificName\n", "vernacular.txt": "vernacularName\n"}), ImportOptions{Format: FormatDwCA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSpeciesService(&memSpeciesRepo{}).ImportSpecies(tt.data, tt.opts)
+			if !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("ImportSpecies = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestReadZipFileLimitsUncompressedSize(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	// 目录中声明解压后超过上限的条目，内容本身无需真的那么大
+	bomb, err := writer.CreateRaw(&zip.FileHeader{Name: "bomb.txt", Method: zip.Store, UncompressedSize64: maxZipEntrySize + 1, CompressedSize64: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb.Write([]byte("x"))
+	small, err := writer.Create("small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	small.Write([]byte("scientificName"))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readZipFile(reader.File[0]); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("oversized entry: err = %v, want size error", err)
+	}
+	content, err := readZipFile(reader.File[1])
+	if err != nil || string(content) != "scientificName" {
+		t.Errorf("small entry = %q, %v", content, err)
+	}
+}
+
+func TestImportDwCAWithoutMetaUsesSingleDataFile(t *testing.T) {
+	data := zipOf(t, map[string]string{"occurrence.txt": "scientificName\ttaxonRank\tvernacularName\nCyprinus carpio\tspecies\t鲤鱼\nCyprinidae\tfamily\t\n"})
+	repo := &memSpeciesRepo{}
+	report, err := NewSpeciesService(repo).ImportSpecies(data, ImportOptions{Format: FormatDwCA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || report.Ignored != 1 {
+		t.Fatalf("imported/ignored = %d/%d, want 1/1", report.Imported, report.Ignored)
+	}
+	if repo.species[0].SpeciesName != "鲤鱼" {
+		t.Errorf("species_name = %q, want vernacular name", repo.species[0].SpeciesName)
+	}
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,273 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+type SpeciesImageRepository interface {
+	FindBySpeciesID(speciesID uint) ([]*domain.SpeciesImage, error)
+	FindAll() ([]*domain.SpeciesImage, error)
+	FindByID(speciesID, imageID uint) (*domain.SpeciesImage, error)
+	FindByHash(speciesID uint, hash string) (*domain.SpeciesImage, error)
+	Create(image *domain.SpeciesImage) error
+	SetPrimary(speciesID, imageID uint) error
+	Delete(image *domain.SpeciesImage) error
+}
+
+// thumbnailSizes 缩略图名称及其最长边像素
+var thumbnailSizes = []struct {
+	Name string
+	Max  int
+}{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1024},
+}
+
+type SpeciesMediaService struct {
+	imageRepo   SpeciesImageRepository
+	speciesRepo SpeciesRepository
+	blobs       BlobStore
+}
+
+func NewSpeciesMediaService(imageRepo SpeciesImageRepository, speciesRepo SpeciesRepository, blobs BlobStore) *SpeciesMediaService {
+	return &SpeciesMediaService{imageRepo: imageRepo, speciesRepo: speciesRepo, blobs: blobs}
+}
+
+func (s *SpeciesMediaService) ListImages(speciesID uint) ([]*domain.SpeciesImage, error) {
+	if err := s.ensureSpecies(speciesID); err != nil {
+		return nil, err
+	}
+	return s.imageRepo.FindBySpeciesID(speciesID)
+}
+
+// UploadImage 校验并保存物种图片，按 EXIF 方向校正后生成缩略图。
+// 相同内容的图片只保存一次，重复上传时返回已有记录且 created 为 false。
+func (s *SpeciesMediaService) UploadImage(speciesID uint, data []byte, caption string) (image *domain.SpeciesImage, created bool, err error) {
+	if err := s.ensureSpecies(speciesID); err != nil {
+		return nil, false, err
+	}
+
+	format, err := ValidateImage(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	existing, err := s.imageRepo.FindByHash(speciesID, hash)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, false, nil
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+
+	encodeFormat, mimeType, ext := imaging.JPEG, "image/jpeg", "jpg"
+	if format == "png" {
+		encodeFormat, mimeType, ext = imaging.PNG, "image/png", "png"
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, encodeFormat, imaging.JPEGQuality(90)); err != nil {
+		return nil, false, err
+	}
+
+	prefix := fmt.Sprintf("species/%d/%s", speciesID, hash)
+	image = &domain.SpeciesImage{
+		SpeciesID:   speciesID,
+		ContentHash: hash,
+		StorageKey:  prefix + "." + ext,
+		MimeType:    mimeType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        int64(buf.Len()),
+		Caption:     caption,
+	}
+
+	written := []string{image.StorageKey}
+	if err := s.blobs.Put(image.StorageKey, buf.Bytes(), mimeType); err != nil {
+		return nil, false, err
+	}
+
+	for _, size := range thumbnailSizes {
+		thumb := imaging.Fit(img, size.Max, size.Max, imaging.Lanczos)
+		var tbuf bytes.Buffer
+		if err := imaging.Encode(&tbuf, thumb, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+			s.removeBlobs(written)
+			return nil, false, err
+		}
+		key := fmt.Sprintf("%s_%s.jpg", prefix, size.Name)
+		if err := s.blobs.Put(key, tbuf.Bytes(), "image/jpeg"); err != nil {
+			s.removeBlobs(written)
+			return nil, false, err
+		}
+		written = append(written, key)
+		image.Thumbnails = append(image.Thumbnails, domain.SpeciesImageThumbnail{
+			Size:       size.Name,
+			Width:      thumb.Bounds().Dx(),
+			Height:     thumb.Bounds().Dy(),
+			StorageKey: key,
+		})
+	}
+
+	if err := s.imageRepo.Create(image); err != nil {
+		// 并发上传同一张图片时另一请求先写入了记录；对象键由哈希决定，
+		// 已写入的对象同样属于那条记录，不能删除
+		if errors.Is(err, domain.ErrDuplicateImage) {
+			existing, findErr := s.imageRepo.FindByHash(speciesID, hash)
+			if findErr != nil {
+				return nil, false, findErr
+			}
+			if existing != nil {
+				return existing, false, nil
+			}
+		}
+		s.removeBlobs(written)
+		return nil, false, err
+	}
+	return image, true, nil
+}
+
+// GetImageContent 返回原图或指定尺寸缩略图的内容及 MIME 类型
+func (s *SpeciesMediaService) GetImageContent(speciesID, imageID uint, size string) ([]byte, string, error) {
+	image, err := s.getImage(speciesID, imageID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, mimeType := image.StorageKey, image.MimeType
+	if size != "" && size != "original" {
+		key = ""
+		for _, thumb := range image.Thumbnails {
+			if thumb.Size == size {
+				key, mimeType = thumb.StorageKey, "image/jpeg"
+				break
+			}
+		}
+		if key == "" {
+			return nil, "", fmt.Errorf("%w: unknown thumbnail size %q", domain.ErrInvalidInput, size)
+		}
+	}
+
+	data, err := s.blobs.Get(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, mimeType, nil
+}
+
+// ReferenceImage 用于离线图库比对的物种图片
+type ReferenceImage struct {
+	SpeciesID uint
+	Label     string
+	Data      []byte
+}
+
+// ReferenceImages 获取图库中所有物种图片，标签为物种的规范名称。
+// 优先使用小尺寸缩略图以减少解码开销，读取失败的图片跳过
+func (s *SpeciesMediaService) ReferenceImages() ([]ReferenceImage, error) {
+	images, err := s.imageRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	species, err := s.speciesRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(species))
+	for _, sp := range species {
+		names[sp.ID] = sp.SpeciesName
+	}
+
+	refs := make([]ReferenceImage, 0, len(images))
+	for _, image := range images {
+		label, ok := names[image.SpeciesID]
+		if !ok {
+			continue
+		}
+		key := image.StorageKey
+		for _, thumb := range image.Thumbnails {
+			if thumb.Size == thumbnailSizes[0].Name {
+				key = thumb.StorageKey
+				break
+			}
+		}
+		data, err := s.blobs.Get(key)
+		if err != nil {
+			log.Printf("读取参考图片失败 %s: %v", key, err)
+			continue
+		}
+		refs = append(refs, ReferenceImage{SpeciesID: image.SpeciesID, Label: label, Data: data})
+	}
+	return refs, nil
+}
+
+func (s *SpeciesMediaService) SetPrimaryImage(speciesID, imageID uint) error {
+	if _, err := s.getImage(speciesID, imageID); err != nil {
+		return err
+	}
+	return s.imageRepo.SetPrimary(speciesID, imageID)
+}
+
+// DeleteImage 删除图片记录及其在对象存储中的所有文件
+func (s *SpeciesMediaService) DeleteImage(speciesID, imageID uint) error {
+	image, err := s.getImage(speciesID, imageID)
+	if err != nil {
+		return err
+	}
+	if err := s.imageRepo.Delete(image); err != nil {
+		return err
+	}
+
+	keys := []string{image.StorageKey}
+	for _, thumb := range image.Thumbnails {
+		keys = append(keys, thumb.StorageKey)
+	}
+	s.removeBlobs(keys)
+	return nil
+}
+
+func (s *SpeciesMediaService) getImage(speciesID, imageID uint) (*domain.SpeciesImage, error) {
+	image, err := s.imageRepo.FindByID(speciesID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, domain.ErrImageNotFound
+	}
+	return image, nil
+}
+
+func (s *SpeciesMediaService) ensureSpecies(speciesID uint) error {
+	species, err := s.speciesRepo.FindByID(speciesID)
+	if err != nil {
+		return err
+	}
+	if species == nil {
+		return domain.ErrSpeciesNotFound
+	}
+	return nil
+}
+
+// removeBlobs 尽力清理对象存储中的文件，失败只记录日志
+func (s *SpeciesMediaService) removeBlobs(keys []string) {
+	for _, key := range keys {
+		if err := s.blobs.Delete(key); err != nil {
+			log.Printf("删除图片文件失败 %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{blobs: map[string][]byte{}}
+}
+
+func (s *memBlobStore) Put(key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memBlobStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrBlobNotFound
+	}
+	return data, nil
+}
+
+func (s *memBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+// testPNG 生成不易压缩的 PNG 图片，保证超过图片校验要求的最小文件大小
+func testPNG(t *testing.T, seed int64) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// memSpeciesImageRepo 与数据库实现一样在物种还没有主图时把新图片设为主图
+type memSpeciesImageRepo struct {
+	mu     sync.Mutex
+	images []*domain.SpeciesImage
+	// createErr 不为 nil 时保存图片返回该错误，模拟数据库写入失败
+	createErr error
+	// concurrent 不为 nil 时在保存前先插入该记录，模拟并发上传抢先写入同一张图片
+	concurrent *domain.SpeciesImage
+}
+
+func (r *memSpeciesImageRepo) FindBySpeciesID(speciesID uint) ([]*domain.SpeciesImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.SpeciesImage
+	for _, image := range r.images {
+		if image.SpeciesID == speciesID {
+			copied := *image
+			found = append(found, &copied)
+		}
+	}
+	return found, nil
+}
+
+func (r *memSpeciesImageRepo) FindAll() ([]*domain.SpeciesImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.SpeciesImage
+	for _, image := range r.images {
+		copied := *image
+		found = append(found, &copied)
+	}
+	return found, nil
+}
+
+func (r *memSpeciesImageRepo) find(match func(*domain.SpeciesImage) bool) (*domain.SpeciesImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, image := range r.images {
+		if match(image) {
+			copied := *image
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memSpeciesImageRepo) FindByID(speciesID, imageID uint) (*domain.SpeciesImage, error) {
+	return r.find(func(image *domain.SpeciesImage) bool { return image.SpeciesID == speciesID && image.ID == imageID })
+}
+
+func (r *memSpeciesImageRepo) FindByHash(speciesID uint, hash string) (*domain.SpeciesImage, error) {
+	return r.find(func(image *domain.SpeciesImage) bool {
+		return image.SpeciesID == speciesID && image.ContentHash == hash
+	})
+}
+
+func (r *memSpeciesImageRepo) Create(image *domain.SpeciesImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return r.createErr
+	}
+	if r.concurrent != nil {
+		r.concurrent.ID = uint(len(r.images) + 1)
+		r.images = append(r.images, r.concurrent)
+		r.concurrent = nil
+	}
+	for _, existing := range r.images {
+		if existing.SpeciesID == image.SpeciesID && existing.ContentHash == image.ContentHash {
+			return domain.ErrDuplicateImage
+		}
+	}
+	image.ID = uint(len(r.images) + 1)
+	image.IsPrimary = true
+	for _, existing := range r.images {
+		if existing.SpeciesID == image.SpeciesID && existing.IsPrimary {
+			image.IsPrimary = false
+		}
+	}
+	copied := *image
+	r.images = append(r.images, &copied)
+	return nil
+}
+
+func (r *memSpeciesImageRepo) SetPrimary(speciesID, imageID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, image := range r.images {
+		if image.SpeciesID == speciesID {
+			image.IsPrimary = image.ID == imageID
+		}
+	}
+	return nil
+}
+
+func (r *memSpeciesImageRepo) Delete(image *domain.SpeciesImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.images {
+		if existing.ID == image.ID {
+			r.images = append(r.images[:i], r.images[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// gradientJPEG 生成指定尺寸的渐变 JPEG
+func gradientJPEG(t *testing.T, w, h int, shade uint8) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), shade, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type mediaFixture struct {
+	service   *SpeciesMediaService
+	images    *memSpeciesImageRepo
+	blobs     *memBlobStore
+	speciesID uint
+}
+
+func newMediaFixture() *mediaFixture {
+	species := &memSpeciesRepo{}
+	f := &mediaFixture{images: &memSpeciesImageRepo{}, blobs: newMemBlobStore(), speciesID: species.add("鲤鱼", "Cyprinus carpio")}
+	f.service = NewSpeciesMediaService(f.images, species, f.blobs)
+	return f
+}
+
+func TestUploadImageGeneratesThumbnails(t *testing.T) {
+	f := newMediaFixture()
+	uploaded, created, err := f.service.UploadImage(f.speciesID, gradientJPEG(t, 1200, 900, 80), "侧面")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || !uploaded.IsPrimary || uploaded.MimeType != "image/jpeg" || uploaded.Width != 1200 || uploaded.Height != 900 {
+		t.Errorf("image = %+v", uploaded)
+	}
+
+	want := map[string][2]int{"small": {160, 120}, "medium": {480, 360}, "large": {1024, 768}}
+	if len(uploaded.Thumbnails) != len(want) {
+		t.Fatalf("thumbnails = %+v", uploaded.Thumbnails)
+	}
+	for _, thumb := range uploaded.Thumbnails {
+		if size := want[thumb.Size]; thumb.Width != size[0] || thumb.Height != size[1] {
+			t.Errorf("%s thumbnail = %dx%d, want %dx%d", thumb.Size, thumb.Width, thumb.Height, size[0], size[1])
+		}
+		data, mimeType, err := f.service.GetImageContent(f.speciesID, uploaded.ID, thumb.Size)
+		if err != nil || mimeType != "image/jpeg" {
+			t.Fatalf("%s thumbnail content: %v, %s", thumb.Size, err, mimeType)
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width != thumb.Width {
+			t.Errorf("%s thumbnail decodes to %+v, %v", thumb.Size, config, err)
+		}
+	}
+	if _, _, err := f.service.GetImageContent(f.speciesID, uploaded.ID, "huge"); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("unknown size: err = %v, want ErrInvalidInput", err)
+	}
+	if len(f.blobs.blobs) != 4 {
+		t.Errorf("stored %d blobs, want the original and 3 thumbnails", len(f.blobs.blobs))
+	}
+}
+
+func TestUploadImageErrors(t *testing.T) {
+	f := newMediaFixture()
+	tests := []struct {
+		name      string
+		speciesID uint
+		data      []byte
+		wantErr   error
+	}{
+		{"unknown species", 99, testPNG(t, 1), domain.ErrSpeciesNotFound},
+		{"not an image", f.speciesID, bytes.Repeat([]byte("x"), 2048), domain.ErrInvalidInput},
+		{"too small", f.speciesID, []byte("tiny"), domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := f.service.UploadImage(tt.speciesID, tt.data, ""); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UploadImage = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadImageReturnsExistingForDuplicate(t *testing.T) {
+	f := newMediaFixture()
+	data := testPNG(t, 1)
+	first, _, err := f.service.UploadImage(f.speciesID, data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, created, err := f.service.UploadImage(f.speciesID, data, "再次上传")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || second.ID != first.ID || second.Caption != "" {
+		t.Errorf("duplicate upload = %+v, created %v, want the existing image", second, created)
+	}
+	if images, _ := f.service.ListImages(f.speciesID); len(images) != 1 {
+		t.Errorf("images = %d, want 1", len(images))
+	}
+	if !strings.HasSuffix(first.StorageKey, ".png") {
+		t.Errorf("original stored as %s, want PNG", first.StorageKey)
+	}
+}
+
+func TestSetPrimaryImage(t *testing.T) {
+	f := newMediaFixture()
+	first, _, err := f.service.UploadImage(f.speciesID, testPNG(t, 1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := f.service.UploadImage(f.speciesID, testPNG(t, 2), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsPrimary || second.IsPrimary {
+		t.Fatalf("primary = %v/%v, want only the first image", first.IsPrimary, second.IsPrimary)
+	}
+
+	if err := f.service.SetPrimaryImage(f.speciesID, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	images, _ := f.service.ListImages(f.speciesID)
+	for _, image := range images {
+		if image.IsPrimary != (image.ID == second.ID) {
+			t.Errorf("image %d primary = %v", image.ID, image.IsPrimary)
+		}
+	}
+	other := f.service.speciesRepo.(*memSpeciesRepo).add("草鱼", "Ctenopharyngodon idella")
+	if err := f.service.SetPrimaryImage(other, second.ID); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("image of another species: err = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestUploadImageCleansUpBlobsWhenRepoFails(t *testing.T) {
+	f := newMediaFixture()
+	f.images.createErr = errors.New("database unavailable")
+	if _, _, err := f.service.UploadImage(f.speciesID, gradientJPEG(t, 600, 400, 40), ""); err == nil {
+		t.Fatal("UploadImage succeeded, want the repository error")
+	}
+	if len(f.blobs.blobs) != 0 {
+		t.Errorf("%d blobs left after a failed upload", len(f.blobs.blobs))
+	}
+}
+
+func TestUploadImageReturnsExistingWhenConcurrentUploadWins(t *testing.T) {
+	f := newMediaFixture()
+	data := gradientJPEG(t, 600, 400, 40)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	prefix := fmt.Sprintf("species/%d/%s", f.speciesID, hash)
+	f.images.concurrent = &domain.SpeciesImage{
+		SpeciesID:   f.speciesID,
+		ContentHash: hash,
+		StorageKey:  prefix + ".jpg",
+		MimeType:    "image/jpeg",
+		IsPrimary:   true,
+	}
+
+	image, created, err := f.service.UploadImage(f.speciesID, data, "")
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	if created {
+		t.Error("created = true, want false when another upload inserted the hash first")
+	}
+	if image.ID != 1 || image.StorageKey != prefix+".jpg" {
+		t.Errorf("image = %+v, want the concurrently inserted record", image)
+	}
+	// 对象键由哈希决定，胜出的记录仍在引用这些对象，不能被删除
+	for _, key := range []string{prefix + ".jpg", prefix + "_small.jpg", prefix + "_medium.jpg", prefix + "_large.jpg"} {
+		if _, ok := f.blobs.blobs[key]; !ok {
+			t.Errorf("blob %s removed, want it kept for the existing record", key)
+		}
+	}
+}
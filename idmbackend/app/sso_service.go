@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// SSOProvider OIDC 授权码流程（PKCE）的身份提供方
+type SSOProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*domain.ExternalIdentity, error)
+}
+
+type IdentityRepository interface {
+	FindByIssuerSubject(issuer, subject string) (*domain.UserIdentity, error)
+	CreateWithUser(user *domain.User, identity *domain.UserIdentity, membership *domain.Membership) error
+	TouchLogin(id uint, email string, at time.Time) error
+}
+
+// GroupRoleMapping 身份提供方中的组到本地角色的映射，按配置顺序取第一个匹配项
+type GroupRoleMapping struct {
+	Group string
+	Role  domain.Role
+}
+
+// ParseGroupRoleMapping 解析 "组=角色,组=角色" 格式的映射配置
+func ParseGroupRoleMapping(s string) ([]GroupRoleMapping, error) {
+	var mappings []GroupRoleMapping
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+			return nil, fmt.Errorf("invalid group role mapping %q", pair)
+		}
+		mappings = append(mappings, GroupRoleMapping{
+			Group: strings.TrimSpace(group),
+			Role:  domain.Role(strings.TrimSpace(role)),
+		})
+	}
+	return mappings, nil
+}
+
+const (
+	ssoStateTTL        = 10 * time.Minute
+	maxPendingSSOLogin = 10000
+)
+
+// pendingLogin 已发起但尚未回调的登录请求
+type pendingLogin struct {
+	codeVerifier string
+	nonce        string
+	expiresAt    time.Time
+}
+
+// SSOService 通过 OIDC 登录，首次登录时按声明自动创建本地用户并映射角色
+type SSOService struct {
+	provider     SSOProvider
+	identityRepo IdentityRepository
+	userRepo     UserRepository
+	authService  *AuthService
+	mfaService   *MFAService
+	roleService  *RoleService
+	orgService   *OrgService
+	mappings     []GroupRoleMapping
+	defaultRole  domain.Role
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+// NewSSOService provider 为 nil 时单点登录处于未启用状态
+func NewSSOService(provider SSOProvider, identityRepo IdentityRepository, userRepo UserRepository, authService *AuthService, mfaService *MFAService, roleService *RoleService, orgService *OrgService, mappings []GroupRoleMapping, defaultRole domain.Role) *SSOService {
+	if defaultRole == "" {
+		defaultRole = domain.RoleUser
+	}
+	return &SSOService{
+		provider:     provider,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		authService:  authService,
+		mfaService:   mfaService,
+		roleService:  roleService,
+		orgService:   orgService,
+		mappings:     mappings,
+		defaultRole:  defaultRole,
+		pending:      make(map[string]pendingLogin),
+	}
+}
+
+func (s *SSOService) Enabled() bool {
+	return s.provider != nil
+}
+
+// Begin 生成 state、nonce 和 PKCE 校验码，返回身份提供方的授权地址
+func (s *SSOService) Begin(ctx context.Context) (string, error) {
+	if !s.Enabled() {
+		return "", domain.ErrSSODisabled
+	}
+
+	state, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken(48)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.savePending(state, pendingLogin{
+		codeVerifier: verifier,
+		nonce:        nonce,
+		expiresAt:    time.Now().Add(ssoStateTTL),
+	}); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// Callback 校验 state，用授权码换取并验证 ID Token，然后完成本地用户的登录。
+// 启用了两步验证的用户与密码登录一样，需要再提交验证码
+func (s *SSOService) Callback(ctx context.Context, state, code, ip string) (*LoginResult, error) {
+	if !s.Enabled() {
+		return nil, domain.ErrSSODisabled
+	}
+	login, ok := s.takePending(state)
+	if !ok {
+		return nil, domain.ErrInvalidSSOState
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, login.codeVerifier, login.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.provisionUser(identity)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, domain.ErrAccountDisabled
+	}
+	return s.mfaService.CompleteLogin(user, ip)
+}
+
+// provisionUser 按 issuer + subject 查找绑定的本地用户，不存在时即时创建。
+// 不会按用户名关联已有的本地账号，避免外部身份接管本地用户。
+func (s *SSOService) provisionUser(identity *domain.ExternalIdentity) (*domain.User, error) {
+	mappedRole, mapped := s.mapRole(identity.Groups)
+
+	link, err := s.identityRepo.FindByIssuerSubject(identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		user, err := s.userRepo.FindByID(link.UserID)
+		if err != nil || user == nil {
+			return nil, domain.ErrUserNotFound
+		}
+		if mapped && user.Role != mappedRole {
+			if err := s.userRepo.UpdateRole(fmt.Sprint(user.ID), mappedRole); err != nil {
+				return nil, err
+			}
+			// 旧会话的访问令牌仍带有原来的全局角色
+			if err := s.authService.LogoutAll(user.ID); err != nil {
+				return nil, err
+			}
+			if err := s.authService.RevokeAPIKeys(user.ID); err != nil {
+				return nil, err
+			}
+			user.Role = mappedRole
+		}
+		if err := s.identityRepo.TouchLogin(link.ID, identity.Email, time.Now()); err != nil {
+			log.Printf("更新身份登录时间失败: %v", err)
+		}
+		return user, nil
+	}
+
+	username, err := s.uniqueUsername(identity.Username)
+	if err != nil {
+		return nil, err
+	}
+	role := s.defaultRole
+	if mapped {
+		role = mappedRole
+	}
+	// 邮箱已被其他账号使用时不写入，外部身份不会因邮箱相同而关联到已有账号
+	email := identity.Email
+	if email != "" {
+		existing, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			email = ""
+		}
+	}
+	user := &domain.User{Username: username, Role: role, Email: email}
+	// 外部身份用户不能使用密码登录，设置一个不会被告知任何人的随机密码
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	link = &domain.UserIdentity{
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: now,
+	}
+	membership, err := s.orgService.DefaultMembership(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.identityRepo.CreateWithUser(user, link, membership); err != nil {
+		return nil, err
+	}
+	log.Printf("单点登录创建用户: %s (issuer=%s, sub=%s, role=%s)", user.Username, identity.Issuer, identity.Subject, user.Role)
+	return user, nil
+}
+
+// mapRole 返回第一个匹配且存在的角色
+func (s *SSOService) mapRole(groups []string) (domain.Role, bool) {
+	for _, m := range s.mappings {
+		for _, g := range groups {
+			if g != m.Group {
+				continue
+			}
+			if _, err := s.roleService.GetRole(m.Role); err != nil {
+				log.Printf("单点登录组 %s 映射的角色 %s 不可用: %v", m.Group, m.Role, err)
+				continue
+			}
+			return m.Role, true
+		}
+	}
+	return "", false
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// uniqueUsername 由声明生成合法且未被占用的用户名，冲突时追加序号
+func (s *SSOService) uniqueUsername(preferred string) (string, error) {
+	base := strings.Trim(usernameUnsafe.ReplaceAllString(preferred, "-"), "-")
+	if base == "" {
+		base = "sso-user"
+	}
+	if r := []rune(base); len(r) > 48 {
+		base = string(r[:48])
+	}
+
+	candidate := base
+	for i := 2; i <= 100; i++ {
+		existing, err := s.userRepo.FindByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+	suffix, err := randomToken(6)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + suffix, nil
+}
+
+func (s *SSOService) savePending(state string, login pendingLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range s.pending {
+		if now.After(v.expiresAt) {
+			delete(s.pending, k)
+		}
+	}
+	if len(s.pending) >= maxPendingSSOLogin {
+		return fmt.Errorf("too many pending sso logins")
+	}
+	s.pending[state] = login
+	return nil
+}
+
+// takePending 取出并删除登录请求，state 只能使用一次
+func (s *SSOService) takePending(state string) (pendingLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.pending[state]
+	if !ok {
+		return pendingLogin{}, false
+	}
+	delete(s.pending, state)
+	if time.Now().After(login.expiresAt) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/MoyInGxing/idm/infra/oidc"
+	"github.com/MoyInGxing/idm/infra/oidc/oidctest"
+)
+
+type memIdentityRepo struct {
+	users      *memUserRepo
+	identities []*domain.UserIdentity
+}
+
+func (r *memIdentityRepo) FindByIssuerSubject(issuer, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memIdentityRepo) CreateWithUser(user *domain.User, identity *domain.UserIdentity, membership *domain.Membership) error {
+	if err := r.users.CreateWithMembership(user, membership); err != nil {
+		return err
+	}
+	identity.ID = uint(len(r.identities) + 1)
+	identity.UserID = user.ID
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memIdentityRepo) TouchLogin(id uint, email string, at time.Time) error {
+	return nil
+}
+
+type ssoFixture struct {
+	*testEnv
+	idp        *oidctest.Server
+	identities *memIdentityRepo
+	sso        *SSOService
+}
+
+func newSSOFixture(t *testing.T, mappings []GroupRoleMapping) *ssoFixture {
+	t.Helper()
+	idp := oidctest.NewServer("idm", "secret")
+	t.Cleanup(idp.Close)
+
+	env := newTestEnv()
+	identities := &memIdentityRepo{users: env.users}
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://idm.test/api/auth/sso/callback",
+	})
+	sso := NewSSOService(provider, identities, env.users, env.auth, env.mfa, env.roles, env.orgSvc, mappings, "")
+	return &ssoFixture{testEnv: env, idp: idp, identities: identities, sso: sso}
+}
+
+// login 走完一次授权码流程
+func (f *ssoFixture) login(t *testing.T) (*LoginResult, error) {
+	t.Helper()
+	authURL, err := f.sso.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state, err := f.idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return f.sso.Callback(context.Background(), state, code, "127.0.0.1")
+}
+
+func TestSSOBeginUsesPKCEAndNonce(t *testing.T) {
+	f := newSSOFixture(t, nil)
+
+	authURL, err := f.sso.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	query := parsed.Query()
+	for _, key := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(key) == "" {
+			t.Errorf("auth url has no %s: %s", key, authURL)
+		}
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+}
+
+func TestSSOFirstLoginProvisionsUser(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	f.idp.SetUser(map[string]interface{}{
+		"sub":                "alice-sub",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+	})
+
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if result.Tokens == nil || result.Tokens.AccessToken == "" || result.Tokens.RefreshToken == "" {
+		t.Fatalf("tokens not issued: %+v", result)
+	}
+	user := result.User
+	if user.Username != "alice" || user.Role != domain.RoleUser || user.Email != "alice@example.com" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+	if membership, _ := f.orgs.FindMembership(1, user.ID); membership == nil || membership.Role != domain.RoleUser {
+		t.Errorf("user did not join the default organization: %+v", membership)
+	}
+
+	// 再次登录复用同一个本地用户
+	again, err := f.login(t)
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+	if again.User.ID != user.ID || len(f.identities.identities) != 1 {
+		t.Errorf("second login created another user: %d vs %d", again.User.ID, user.ID)
+	}
+}
+
+func TestSSODoesNotLinkExistingLocalUsername(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	local := &domain.User{Username: "alice", Role: domain.RoleAdmin}
+	if err := f.users.Create(local); err != nil {
+		t.Fatal(err)
+	}
+	f.idp.SetUser(map[string]interface{}{"sub": "alice-sub", "preferred_username": "alice"})
+
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if user := result.User; user.ID == local.ID || user.Username != "alice-2" || user.Role != domain.RoleUser {
+		t.Errorf("external identity took over local user: %+v", user)
+	}
+}
+
+func TestSSOGroupRoleMapping(t *testing.T) {
+	mappings, err := ParseGroupRoleMapping("fish-admins=admin, lab=researcher, ghost=missing-role")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		groups []interface{}
+		want   domain.Role
+	}{
+		{"first matching mapping wins", []interface{}{"lab", "fish-admins"}, domain.RoleAdmin},
+		{"mapped group", []interface{}{"lab"}, domain.RoleResearcher},
+		{"unknown role is skipped", []interface{}{"ghost"}, domain.RoleUser},
+		{"no groups uses default role", nil, domain.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSSOFixture(t, mappings)
+			claims := map[string]interface{}{"sub": "bob-sub", "preferred_username": "bob"}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			f.idp.SetUser(claims)
+
+			result, err := f.login(t)
+			if err != nil {
+				t.Fatalf("Callback: %v", err)
+			}
+			if result.User.Role != tt.want {
+				t.Errorf("role = %s, want %s", result.User.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSORemapRevokesSessions(t *testing.T) {
+	mappings := []GroupRoleMapping{{Group: "fish-admins", Role: domain.RoleAdmin}, {Group: "staff", Role: domain.RoleUser}}
+	f := newSSOFixture(t, mappings)
+	f.idp.SetUser(map[string]interface{}{"sub": "carol-sub", "groups": []interface{}{"fish-admins"}})
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	user := result.User
+	if user.Role != domain.RoleAdmin {
+		t.Fatalf("role = %s, want admin", user.Role)
+	}
+
+	// 身份提供方中被移出管理员组，下次登录时降级并吊销带有旧角色的会话
+	f.idp.SetUser(map[string]interface{}{"sub": "carol-sub", "groups": []interface{}{"staff"}})
+	demoted, err := f.login(t)
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+	if demoted.User.Role != domain.RoleUser {
+		t.Errorf("role = %s, want user", demoted.User.Role)
+	}
+	if n := f.sessions.active(user.ID); n != 1 {
+		t.Errorf("active sessions = %d, want only the new one", n)
+	}
+}
+
+func TestSSOLoginRequiresTOTP(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	f.idp.SetUser(map[string]interface{}{"sub": "dave-sub", "preferred_username": "dave"})
+	first, err := f.login(t)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	secret := enableTOTP(t, f.testEnv, first.User.ID)
+	before := f.sessions.active(first.User.ID)
+
+	// 启用两步验证后，单点登录只返回 MFA 令牌，提交验证码后才签发令牌
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if result.Tokens != nil || result.MFAToken == "" {
+		t.Fatalf("sso login skipped mfa: %+v", result)
+	}
+	if n := f.sessions.active(first.User.ID); n != before {
+		t.Errorf("active sessions = %d, want %d before the code is verified", n, before)
+	}
+	tokens, user, err := f.mfa.VerifyLogin(result.MFAToken, totpAt(t, secret, f.clock.Now()), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("VerifyLogin: %v", err)
+	}
+	if tokens.AccessToken == "" || user.ID != first.User.ID {
+		t.Errorf("VerifyLogin = %+v, %+v", tokens, user)
+	}
+}
+
+func TestSSOCallbackState(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	authURL, err := f.sso.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state, err := f.idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	if _, err := f.sso.Callback(context.Background(), "forged-state", code, ""); !errors.Is(err, domain.ErrInvalidSSOState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidSSOState", err)
+	}
+	if _, err := f.sso.Callback(context.Background(), state, code, ""); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	// state 只能使用一次
+	if _, err := f.sso.Callback(context.Background(), state, code, ""); !errors.Is(err, domain.ErrInvalidSSOState) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidSSOState", err)
+	}
+}
+
+func TestSSOCallbackRejectsCodeFromAnotherLogin(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	first, err := f.sso.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	second, err := f.sso.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, _, err := f.idp.Authorize(first)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	_, state, err := f.idp.Authorize(second)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	// 授权码与另一次登录的 state 搭配时 PKCE 校验码不匹配
+	if _, err := f.sso.Callback(context.Background(), state, code, ""); !errors.Is(err, domain.ErrInvalidSSOToken) {
+		t.Errorf("err = %v, want ErrInvalidSSOToken", err)
+	}
+}
+
+func TestSSODisabled(t *testing.T) {
+	env := newTestEnv()
+	sso := NewSSOService(nil, &memIdentityRepo{users: env.users}, env.users, env.auth, env.mfa, env.roles, env.orgSvc, nil, "")
+	if _, err := sso.Begin(context.Background()); !errors.Is(err, domain.ErrSSODisabled) {
+		t.Errorf("Begin: err = %v, want ErrSSODisabled", err)
+	}
+	if _, err := sso.Callback(context.Background(), "state", "code", ""); !errors.Is(err, domain.ErrSSODisabled) {
+		t.Errorf("Callback: err = %v, want ErrSSODisabled", err)
+	}
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type TaxonomyRepository interface {
+	CreateTaxon(taxon *domain.Taxon) error
+	FindTaxonByID(id uint) (*domain.Taxon, error)
+	FindChildTaxa(parentID uint) ([]*domain.Taxon, error)
+	FindSpeciesByName(name string) (*domain.Species, error)
+	FindSpeciesNames(speciesID uint) ([]*domain.SpeciesName, error)
+	AddSpeciesName(name *domain.SpeciesName) error
+	DeleteSpeciesName(speciesID, nameID uint) (bool, error)
+}
+
+// maxLineageDepth 防止父链出现环时无限循环
+const maxLineageDepth = 32
+
+type TaxonomyService struct {
+	taxonomyRepo TaxonomyRepository
+	speciesRepo  SpeciesRepository
+}
+
+func NewTaxonomyService(taxonomyRepo TaxonomyRepository, speciesRepo SpeciesRepository) *TaxonomyService {
+	return &TaxonomyService{taxonomyRepo: taxonomyRepo, speciesRepo: speciesRepo}
+}
+
+// CreateTaxon 创建分类单元，父节点的阶元必须高于子节点
+func (s *TaxonomyService) CreateTaxon(taxon *domain.Taxon) error {
+	taxon.ScientificName = strings.TrimSpace(taxon.ScientificName)
+	if taxon.ScientificName == "" {
+		return fmt.Errorf("%w: scientific_name is required", domain.ErrInvalidInput)
+	}
+	if taxon.Rank.Level() < 0 {
+		return domain.ErrInvalidTaxonRank
+	}
+
+	if taxon.ParentID != nil {
+		parent, err := s.taxonomyRepo.FindTaxonByID(*taxon.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent == nil {
+			return domain.ErrTaxonNotFound
+		}
+		if parent.Rank.Level() >= taxon.Rank.Level() {
+			return fmt.Errorf("%w: %s cannot be a child of %s", domain.ErrInvalidTaxonRank, taxon.Rank, parent.Rank)
+		}
+	}
+
+	return s.taxonomyRepo.CreateTaxon(taxon)
+}
+
+func (s *TaxonomyService) GetTaxon(id uint) (*domain.Taxon, error) {
+	taxon, err := s.taxonomyRepo.FindTaxonByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if taxon == nil {
+		return nil, domain.ErrTaxonNotFound
+	}
+	return taxon, nil
+}
+
+func (s *TaxonomyService) GetChildTaxa(id uint) ([]*domain.Taxon, error) {
+	if _, err := s.GetTaxon(id); err != nil {
+		return nil, err
+	}
+	return s.taxonomyRepo.FindChildTaxa(id)
+}
+
+// GetLineage 返回从界到指定分类单元的完整路径
+func (s *TaxonomyService) GetLineage(id uint) ([]*domain.Taxon, error) {
+	var lineage []*domain.Taxon
+	next := &id
+	for depth := 0; next != nil; depth++ {
+		if depth >= maxLineageDepth {
+			return nil, fmt.Errorf("taxon %d has a cyclic parent chain", id)
+		}
+		taxon, err := s.GetTaxon(*next)
+		if err != nil {
+			return nil, err
+		}
+		lineage = append([]*domain.Taxon{taxon}, lineage...)
+		next = taxon.ParentID
+	}
+	return lineage, nil
+}
+
+// LinkSpeciesTaxon 将物种关联到种级分类单元
+func (s *TaxonomyService) LinkSpeciesTaxon(speciesID, taxonID uint) (*domain.Species, error) {
+	species, err := s.getSpecies(speciesID)
+	if err != nil {
+		return nil, err
+	}
+	taxon, err := s.GetTaxon(taxonID)
+	if err != nil {
+		return nil, err
+	}
+	if taxon.Rank != domain.RankSpecies {
+		return nil, fmt.Errorf("%w: species must link to a %s taxon", domain.ErrInvalidTaxonRank, domain.RankSpecies)
+	}
+
+	species.TaxonID = &taxon.ID
+	if err := s.speciesRepo.Update(species); err != nil {
+		return nil, err
+	}
+	return species, nil
+}
+
+// ResolveSpecies 将中文名、俗名、异名或学名解析为规范的物种记录
+func (s *TaxonomyService) ResolveSpecies(name string) (*domain.Species, error) {
+	name = normalizeName(name)
+	if name == "" {
+		return nil, domain.ErrSpeciesNotFound
+	}
+
+	species, err := s.taxonomyRepo.FindSpeciesByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if species == nil {
+		return nil, domain.ErrSpeciesNotFound
+	}
+	return species, nil
+}
+
+func (s *TaxonomyService) GetSpeciesNames(speciesID uint) ([]*domain.SpeciesName, error) {
+	if _, err := s.getSpecies(speciesID); err != nil {
+		return nil, err
+	}
+	return s.taxonomyRepo.FindSpeciesNames(speciesID)
+}
+
+// AddSpeciesName 为物种添加俗名或异名
+func (s *TaxonomyService) AddSpeciesName(name *domain.SpeciesName) error {
+	if _, err := s.getSpecies(name.SpeciesID); err != nil {
+		return err
+	}
+
+	name.Name = normalizeName(name.Name)
+	if name.Name == "" {
+		return fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	if name.Language == "" {
+		name.Language = "zh"
+	}
+	if name.Kind == "" {
+		name.Kind = domain.NameKindCommon
+	}
+	if name.Kind != domain.NameKindCommon && name.Kind != domain.NameKindSynonym {
+		return fmt.Errorf("%w: unknown name kind %s", domain.ErrInvalidInput, name.Kind)
+	}
+
+	// 同一个名称只能指向一个规范物种，否则解析会产生歧义
+	existing, err := s.taxonomyRepo.FindSpeciesByName(name.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != name.SpeciesID {
+		return fmt.Errorf("%w: name %q already refers to species %d", domain.ErrInvalidInput, name.Name, existing.ID)
+	}
+
+	return s.taxonomyRepo.AddSpeciesName(name)
+}
+
+// DeleteSpeciesName 删除物种的一个名称，名称不存在或属于其他物种时返回 ErrSpeciesNameNotFound
+func (s *TaxonomyService) DeleteSpeciesName(speciesID, nameID uint) error {
+	deleted, err := s.taxonomyRepo.DeleteSpeciesName(speciesID, nameID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return domain.ErrSpeciesNameNotFound
+	}
+	return nil
+}
+
+func (s *TaxonomyService) getSpecies(id uint) (*domain.Species, error) {
+	species, err := s.speciesRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if species == nil {
+		return nil, domain.ErrSpeciesNotFound
+	}
+	return species, nil
+}
+
+// normalizeName 去掉首尾空白并合并中间的连续空白
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,436 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type memSpeciesRepo struct {
+	mu      sync.Mutex
+	species []*domain.Species
+	names   []*domain.SpeciesName
+	records []*domain.SpeciesRecord
+}
+
+func (r *memSpeciesRepo) FindAll() ([]*domain.Species, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.Species(nil), r.species...), nil
+}
+
+func (r *memSpeciesRepo) FindByID(id uint) (*domain.Species, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.species {
+		if s.ID == id {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memSpeciesRepo) Create(species *domain.Species) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	species.ID = uint(len(r.species) + 1)
+	copied := *species
+	r.species = append(r.species, &copied)
+	for i := range species.Names {
+		name := species.Names[i]
+		name.ID = uint(len(r.names) + 1)
+		name.SpeciesID = species.ID
+		r.names = append(r.names, &name)
+	}
+	return nil
+}
+
+func (r *memSpeciesRepo) Update(species *domain.Species) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.species {
+		if s.ID == species.ID {
+			copied := *species
+			r.species[i] = &copied
+			return nil
+		}
+	}
+	return domain.ErrSpeciesNotFound
+}
+
+func (r *memSpeciesRepo) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.species {
+		if s.ID == id {
+			r.species = append(r.species[:i], r.species[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memSpeciesRepo) FindExistingScientificNames(names []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var existing []string
+	for _, s := range r.species {
+		if containsFold(names, s.ScientificName) {
+			existing = append(existing, s.ScientificName)
+		}
+	}
+	return existing, nil
+}
+
+func (r *memSpeciesRepo) FindExistingNames(names []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var existing []string
+	for _, s := range r.species {
+		for _, name := range []string{s.SpeciesName, s.ScientificName} {
+			if containsFold(names, name) {
+				existing = append(existing, name)
+			}
+		}
+	}
+	for _, n := range r.names {
+		if containsFold(names, n.Name) {
+			existing = append(existing, n.Name)
+		}
+	}
+	return existing, nil
+}
+
+// ImportRecords 保存物种及其名称，分类路径只记录在 records 中
+func (r *memSpeciesRepo) ImportRecords(records []*domain.SpeciesRecord) error {
+	for _, record := range records {
+		if err := r.Create(record.Species); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, records...)
+	return nil
+}
+
+func (r *memSpeciesRepo) FindAllRecords() ([]*domain.SpeciesRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.SpeciesRecord(nil), r.records...), nil
+}
+
+// add 预置一个物种，返回其ID
+func (r *memSpeciesRepo) add(speciesName, scientificName string) uint {
+	species := &domain.Species{SpeciesName: speciesName, ScientificName: scientificName}
+	_ = r.Create(species)
+	return species.ID
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type memTaxonomyRepo struct {
+	mu      sync.Mutex
+	taxa    []*domain.Taxon
+	species *memSpeciesRepo
+}
+
+func (r *memTaxonomyRepo) CreateTaxon(taxon *domain.Taxon) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	taxon.ID = uint(len(r.taxa) + 1)
+	copied := *taxon
+	r.taxa = append(r.taxa, &copied)
+	return nil
+}
+
+func (r *memTaxonomyRepo) FindTaxonByID(id uint) (*domain.Taxon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.taxa {
+		if t.ID == id {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memTaxonomyRepo) FindChildTaxa(parentID uint) ([]*domain.Taxon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var children []*domain.Taxon
+	for _, t := range r.taxa {
+		if t.ParentID != nil && *t.ParentID == parentID {
+			children = append(children, t)
+		}
+	}
+	return children, nil
+}
+
+// FindSpeciesByName 与数据库实现相同，依次按物种名、学名、俗名/异名、种级分类单元学名查找
+func (r *memTaxonomyRepo) FindSpeciesByName(name string) (*domain.Species, error) {
+	repo := r.species
+	repo.mu.Lock()
+	var found *domain.Species
+	for _, s := range repo.species {
+		if s.SpeciesName == name || s.ScientificName == name {
+			found = s
+			break
+		}
+	}
+	for _, n := range repo.names {
+		if found == nil && n.Name == name {
+			for _, s := range repo.species {
+				if s.ID == n.SpeciesID {
+					found = s
+				}
+			}
+		}
+	}
+	repo.mu.Unlock()
+	if found != nil {
+		return repo.FindByID(found.ID)
+	}
+
+	r.mu.Lock()
+	var taxonID uint
+	for _, t := range r.taxa {
+		if t.Rank == domain.RankSpecies && t.ScientificName == name {
+			taxonID = t.ID
+		}
+	}
+	r.mu.Unlock()
+	if taxonID == 0 {
+		return nil, nil
+	}
+	species, _ := repo.FindAll()
+	for _, s := range species {
+		if s.TaxonID != nil && *s.TaxonID == taxonID {
+			return repo.FindByID(s.ID)
+		}
+	}
+	return nil, nil
+}
+
+func (r *memTaxonomyRepo) FindSpeciesNames(speciesID uint) ([]*domain.SpeciesName, error) {
+	r.species.mu.Lock()
+	defer r.species.mu.Unlock()
+	var names []*domain.SpeciesName
+	for _, n := range r.species.names {
+		if n.SpeciesID == speciesID {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+func (r *memTaxonomyRepo) AddSpeciesName(name *domain.SpeciesName) error {
+	r.species.mu.Lock()
+	defer r.species.mu.Unlock()
+	name.ID = uint(len(r.species.names) + 1)
+	copied := *name
+	r.species.names = append(r.species.names, &copied)
+	return nil
+}
+
+func (r *memTaxonomyRepo) DeleteSpeciesName(speciesID, nameID uint) (bool, error) {
+	r.species.mu.Lock()
+	defer r.species.mu.Unlock()
+	for i, n := range r.species.names {
+		if n.ID == nameID && n.SpeciesID == speciesID {
+			r.species.names = append(r.species.names[:i], r.species.names[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newTestTaxonomy() (*TaxonomyService, *memSpeciesRepo) {
+	species := &memSpeciesRepo{}
+	return NewTaxonomyService(&memTaxonomyRepo{species: species}, species), species
+}
+
+func TestCreateTaxonValidatesRankOrder(t *testing.T) {
+	service, _ := newTestTaxonomy()
+	genus := &domain.Taxon{Rank: domain.RankGenus, ScientificName: "Cyprinus"}
+	if err := service.CreateTaxon(genus); err != nil {
+		t.Fatal(err)
+	}
+	missing := uint(99)
+
+	tests := []struct {
+		name  string
+		taxon *domain.Taxon
+		want  error
+	}{
+		{"species under genus", &domain.Taxon{ParentID: &genus.ID, Rank: domain.RankSpecies, ScientificName: " Cyprinus carpio "}, nil},
+		{"family under genus", &domain.Taxon{ParentID: &genus.ID, Rank: domain.RankFamily, ScientificName: "Cyprinidae"}, domain.ErrInvalidTaxonRank},
+		{"genus under genus", &domain.Taxon{ParentID: &genus.ID, Rank: domain.RankGenus, ScientificName: "Carassius"}, domain.ErrInvalidTaxonRank},
+		{"unknown rank", &domain.Taxon{Rank: "tribe", ScientificName: "Cyprinini"}, domain.ErrInvalidTaxonRank},
+		{"missing parent", &domain.Taxon{ParentID: &missing, Rank: domain.RankSpecies, ScientificName: "Carassius auratus"}, domain.ErrTaxonNotFound},
+		{"empty name", &domain.Taxon{Rank: domain.RankKingdom, ScientificName: "  "}, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.CreateTaxon(tt.taxon)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateTaxon = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLineageAndLinkSpecies(t *testing.T) {
+	service, speciesRepo := newTestTaxonomy()
+	var parentID *uint
+	var taxa []*domain.Taxon
+	for _, taxon := range []*domain.Taxon{
+		{Rank: domain.RankKingdom, ScientificName: "Animalia"},
+		{Rank: domain.RankClass, ScientificName: "Actinopterygii"},
+		{Rank: domain.RankGenus, ScientificName: "Cyprinus"},
+		{Rank: domain.RankSpecies, ScientificName: "Cyprinus carpio"},
+	} {
+		taxon.ParentID = parentID
+		if err := service.CreateTaxon(taxon); err != nil {
+			t.Fatal(err)
+		}
+		parentID = &taxon.ID
+		taxa = append(taxa, taxon)
+	}
+
+	lineage, err := service.GetLineage(taxa[3].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lineage) != 4 || lineage[0].Rank != domain.RankKingdom || lineage[3].Rank != domain.RankSpecies {
+		t.Fatalf("lineage = %v, want kingdom..species", lineage)
+	}
+
+	carpID := speciesRepo.add("鲤鱼", "Cyprinus carpio L.")
+	// 只能关联到种级分类单元
+	if _, err := service.LinkSpeciesTaxon(carpID, taxa[2].ID); !errors.Is(err, domain.ErrInvalidTaxonRank) {
+		t.Errorf("link to genus: err = %v, want ErrInvalidTaxonRank", err)
+	}
+	if _, err := service.LinkSpeciesTaxon(99, taxa[3].ID); !errors.Is(err, domain.ErrSpeciesNotFound) {
+		t.Errorf("link missing species: err = %v, want ErrSpeciesNotFound", err)
+	}
+	if _, err := service.LinkSpeciesTaxon(carpID, taxa[3].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 链接后可以通过种级分类单元的学名解析物种
+	species, err := service.ResolveSpecies("Cyprinus  carpio")
+	if err != nil {
+		t.Fatalf("ResolveSpecies by taxon name: %v", err)
+	}
+	if species.ID != carpID {
+		t.Errorf("resolved species = %d, want %d", species.ID, carpID)
+	}
+}
+
+func TestResolveSpeciesByAlternativeNames(t *testing.T) {
+	service, speciesRepo := newTestTaxonomy()
+	carpID := speciesRepo.add("鲤鱼", "Cyprinus carpio")
+	goldfishID := speciesRepo.add("金鱼", "Carassius auratus")
+
+	if err := service.AddSpeciesName(&domain.SpeciesName{SpeciesID: carpID, Name: "common  carp", Language: "en"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddSpeciesName(&domain.SpeciesName{SpeciesID: carpID, Name: "Cyprinus nordmanni", Kind: domain.NameKindSynonym}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want uint
+		err  error
+	}{
+		{"鲤鱼", carpID, nil},
+		{"Carassius auratus", goldfishID, nil},
+		{" common carp ", carpID, nil},
+		{"Cyprinus nordmanni", carpID, nil},
+		{"koi", 0, domain.ErrSpeciesNotFound},
+		{"   ", 0, domain.ErrSpeciesNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			species, err := service.ResolveSpecies(tt.name)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ResolveSpecies = %v, want %v", err, tt.err)
+			}
+			if err == nil && species.ID != tt.want {
+				t.Errorf("resolved species = %d, want %d", species.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSpeciesNameRejectsAmbiguousNames(t *testing.T) {
+	service, speciesRepo := newTestTaxonomy()
+	carpID := speciesRepo.add("鲤鱼", "Cyprinus carpio")
+	goldfishID := speciesRepo.add("金鱼", "Carassius auratus")
+	if err := service.AddSpeciesName(&domain.SpeciesName{SpeciesID: carpID, Name: "鲤拐子"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    domain.SpeciesName
+		want     error
+		wantKind domain.NameKind
+	}{
+		{"common name of another species", domain.SpeciesName{SpeciesID: goldfishID, Name: "鲤拐子"}, domain.ErrInvalidInput, ""},
+		{"primary name of another species", domain.SpeciesName{SpeciesID: goldfishID, Name: "鲤鱼"}, domain.ErrInvalidInput, ""},
+		{"unknown kind", domain.SpeciesName{SpeciesID: goldfishID, Name: "goldfish", Kind: "nickname"}, domain.ErrInvalidInput, ""},
+		{"missing species", domain.SpeciesName{SpeciesID: 99, Name: "goldfish"}, domain.ErrSpeciesNotFound, ""},
+		{"defaults to common name", domain.SpeciesName{SpeciesID: goldfishID, Name: "goldfish"}, nil, domain.NameKindCommon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.input
+			err := service.AddSpeciesName(&name)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AddSpeciesName = %v, want %v", err, tt.want)
+			}
+			if err == nil && (name.Kind != tt.wantKind || name.Language != "zh") {
+				t.Errorf("kind/language = %q/%q, want %q/zh", name.Kind, name.Language, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestDeleteSpeciesName(t *testing.T) {
+	service, speciesRepo := newTestTaxonomy()
+	carpID := speciesRepo.add("鲤鱼", "Cyprinus carpio")
+	goldfishID := speciesRepo.add("金鱼", "Carassius auratus")
+	name := &domain.SpeciesName{SpeciesID: carpID, Name: "common carp"}
+	if err := service.AddSpeciesName(name); err != nil {
+		t.Fatal(err)
+	}
+
+	// 名称属于其他物种时不能删除
+	if err := service.DeleteSpeciesName(goldfishID, name.ID); !errors.Is(err, domain.ErrSpeciesNameNotFound) {
+		t.Fatalf("delete via other species: err = %v, want ErrSpeciesNameNotFound", err)
+	}
+	if err := service.DeleteSpeciesName(carpID, name.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteSpeciesName(carpID, name.ID); !errors.Is(err, domain.ErrSpeciesNameNotFound) {
+		t.Errorf("second delete: err = %v, want ErrSpeciesNameNotFound", err)
+	}
+	if _, err := service.ResolveSpecies("common carp"); !errors.Is(err, domain.ErrSpeciesNotFound) {
+		t.Errorf("resolve deleted name: err = %v, want ErrSpeciesNotFound", err)
+	}
+}
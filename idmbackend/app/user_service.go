@@ -1,31 +1,92 @@
 package app
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
 )
 
 type UserRepository interface {
-	Create(user *domain.User) error
+	CreateWithMembership(user *domain.User, membership *domain.Membership) error
 	FindByUsername(username string) (*domain.User, error)
 	FindByID(id uint) (*domain.User, error)
-	FindAll() ([]*domain.User, error)
-	Delete(userID string) error
 	UpdateRole(userID string, role domain.Role) error
+	CountByRole(role domain.Role) (int64, error)
+	CountActiveByRole(role domain.Role) (int64, error)
+	FindByEmail(email string) (*domain.User, error)
+	UpdatePassword(user *domain.User) error
+	UpdateProfile(user *domain.User) error
+	SetDisabled(id uint, at *time.Time) error
+	TouchLastLogin(id uint, at time.Time, ip string) error
 }
 
+const avatarSize = 256
+
+var (
+	phonePattern  = regexp.MustCompile(`^\+?[0-9][0-9 -]{4,30}$`)
+	localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
 type UserService struct {
-	userRepo UserRepository
+	userRepo    UserRepository
+	policy      *PasswordPolicy
+	orgService  *OrgService
+	authService *AuthService
+	blobs       BlobStore
+}
+
+func NewUserService(repo UserRepository, policy *PasswordPolicy, orgService *OrgService, authService *AuthService, blobs BlobStore) *UserService {
+	return &UserService{
+		userRepo:    repo,
+		policy:      policy,
+		orgService:  orgService,
+		authService: authService,
+		blobs:       blobs,
+	}
 }
 
-func NewUserService(repo UserRepository) *UserService {
-	return &UserService{userRepo: repo}
+// ProfileInput 用户可自行修改的资料字段
+type ProfileInput struct {
+	DisplayName string
+	Email       string
+	Phone       string
+	Locale      string
+	Timezone    string
 }
 
-func (s *UserService) RegisterUser(username, password string) (*domain.User, error) {
+func (s *UserService) RegisterUser(username, password, email, phone string) (*domain.User, error) {
 	log.Printf("开始注册用户: %s", username)
 
+	if err := s.policy.Validate(password, username); err != nil {
+		return nil, err
+	}
+	email = strings.TrimSpace(email)
+	if email != "" {
+		if !strings.Contains(email, "@") || len(email) > 255 {
+			return nil, fmt.Errorf("%w: invalid email", domain.ErrInvalidInput)
+		}
+		existing, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("%w: email is already in use", domain.ErrInvalidInput)
+		}
+	}
+	phone = strings.TrimSpace(phone)
+	if phone != "" && !phonePattern.MatchString(phone) {
+		return nil, fmt.Errorf("%w: invalid phone number", domain.ErrInvalidInput)
+	}
+
 	existingUser, err := s.userRepo.FindByUsername(username)
 	if err != nil {
 		log.Printf("检查用户名是否存在时出错: %v", err)
@@ -39,13 +100,19 @@ func (s *UserService) RegisterUser(username, password string) (*domain.User, err
 	user := &domain.User{
 		Username: username,
 		Role:     domain.RoleUser,
+		Email:    email,
+		Phone:    phone,
 	}
 	if err := user.SetPassword(password); err != nil {
 		log.Printf("设置密码时出错: %v", err)
 		return nil, err
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	membership, err := s.orgService.DefaultMembership(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.CreateWithMembership(user, membership); err != nil {
 		log.Printf("创建用户时出错: %v", err)
 		return nil, err
 	}
@@ -58,34 +125,158 @@ func (s *UserService) GetUserByID(id uint) (*domain.User, error) {
 	return s.userRepo.FindByID(id)
 }
 
-// GetAllUsers 获取所有用户
-func (s *UserService) GetAllUsers() ([]*domain.User, error) {
-	return s.userRepo.FindAll()
+// UpdateProfile 用户修改自己的资料，空字段表示清除
+func (s *UserService) UpdateProfile(userID uint, input ProfileInput) (*domain.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	input.DisplayName = strings.TrimSpace(input.DisplayName)
+	input.Email = strings.TrimSpace(input.Email)
+	input.Phone = strings.TrimSpace(input.Phone)
+	input.Locale = strings.TrimSpace(input.Locale)
+	input.Timezone = strings.TrimSpace(input.Timezone)
+
+	if utf8.RuneCountInString(input.DisplayName) > 64 {
+		return nil, fmt.Errorf("%w: display name must be at most 64 characters", domain.ErrInvalidInput)
+	}
+	if input.Email != "" && input.Email != user.Email {
+		if !strings.Contains(input.Email, "@") || len(input.Email) > 255 {
+			return nil, fmt.Errorf("%w: invalid email", domain.ErrInvalidInput)
+		}
+		existing, err := s.userRepo.FindByEmail(input.Email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.ID != user.ID {
+			return nil, fmt.Errorf("%w: email is already in use", domain.ErrInvalidInput)
+		}
+	}
+	if input.Phone != "" && !phonePattern.MatchString(input.Phone) {
+		return nil, fmt.Errorf("%w: invalid phone number", domain.ErrInvalidInput)
+	}
+	if input.Locale != "" && !localePattern.MatchString(input.Locale) {
+		return nil, fmt.Errorf("%w: invalid locale %q", domain.ErrInvalidInput, input.Locale)
+	}
+	if input.Timezone != "" {
+		if _, err := time.LoadLocation(input.Timezone); err != nil || len(input.Timezone) > 64 {
+			return nil, fmt.Errorf("%w: unknown timezone %q", domain.ErrInvalidInput, input.Timezone)
+		}
+	}
+
+	user.DisplayName = input.DisplayName
+	user.Email = input.Email
+	user.Phone = input.Phone
+	user.Locale = input.Locale
+	user.Timezone = input.Timezone
+	if err := s.userRepo.UpdateProfile(user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-// DeleteUser 删除用户
-func (s *UserService) DeleteUser(userID string) error {
-	return s.userRepo.Delete(userID)
+// SetAvatar 将头像裁剪为正方形缩略图后保存
+func (s *UserService) SetAvatar(userID uint, data []byte) (*domain.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if _, err := ValidateImage(data); err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+
+	var buf bytes.Buffer
+	thumb := imaging.Fill(img, avatarSize, avatarSize, imaging.Center, imaging.Lanczos)
+	if err := imaging.Encode(&buf, thumb, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	key := "avatars/" + hex.EncodeToString(sum[:]) + ".jpg"
+	if err := s.blobs.Put(key, buf.Bytes(), "image/jpeg"); err != nil {
+		return nil, err
+	}
+
+	user.AvatarKey = key
+	if err := s.userRepo.UpdateProfile(user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-// UpdateUserRole 更新用户角色
-func (s *UserService) UpdateUserRole(userID string, role domain.Role) error {
-	return s.userRepo.UpdateRole(userID, role)
+// GetAvatar 获取用户头像，未设置时返回 ErrImageNotFound
+func (s *UserService) GetAvatar(userID uint) ([]byte, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if user.AvatarKey == "" {
+		return nil, domain.ErrImageNotFound
+	}
+	return s.blobs.Get(user.AvatarKey)
 }
 
-// ValidateUser 验证用户登录
-func (s *UserService) ValidateUser(username, password string) (*domain.User, error) {
-	user, err := s.userRepo.FindByUsername(username)
+// DisableUser 停用账号并吊销其全部会话和创建的 API 密钥，账号数据保留。不能停用自己或最后一位管理员
+func (s *UserService) DisableUser(actor *domain.Principal, userID uint) error {
+	user, err := s.managedUser(actor, userID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if user.ID == actor.UserID {
+		return fmt.Errorf("%w: cannot disable your own account", domain.ErrInvalidInput)
 	}
-	if user == nil {
-		return nil, domain.ErrInvalidCredentials
+	if user.IsDisabled() {
+		return nil
+	}
+	if err := s.orgService.ensureNotLastAdmin(user); err != nil {
+		return err
 	}
 
-	if err := user.ComparePassword(password); err != nil {
-		return nil, domain.ErrInvalidCredentials
+	now := time.Now()
+	if err := s.userRepo.SetDisabled(user.ID, &now); err != nil {
+		return err
+	}
+	if err := s.authService.LogoutAll(user.ID); err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAPIKeys(user.ID); err != nil {
+		return err
+	}
+	logSecurityEvent("user_disabled", user.Username, "", fmt.Sprintf("by=%d", actor.UserID))
+	return nil
+}
+
+// EnableUser 恢复已停用的账号
+func (s *UserService) EnableUser(actor *domain.Principal, userID uint) error {
+	user, err := s.managedUser(actor, userID)
+	if err != nil {
+		return err
 	}
+	if !user.IsDisabled() {
+		return nil
+	}
+	if err := s.userRepo.SetDisabled(user.ID, nil); err != nil {
+		return err
+	}
+	logSecurityEvent("user_enabled", user.Username, "", fmt.Sprintf("by=%d", actor.UserID))
+	return nil
+}
 
+// managedUser 获取请求主体有权管理的用户，组织管理员不能管理平台管理员
+func (s *UserService) managedUser(actor *domain.Principal, userID uint) (*domain.User, error) {
+	if err := s.orgService.EnsureMember(actor, userID); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if user.Role == domain.RoleAdmin && !actor.PlatformAdmin {
+		return nil, domain.ErrForbidden
+	}
 	return user, nil
 }
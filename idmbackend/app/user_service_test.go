@@ -0,0 +1,248 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+func TestRegisterUserRejectsDuplicateEmail(t *testing.T) {
+	env := newTestEnv()
+	service := NewUserService(env.users, NewPasswordPolicy(0, nil), env.orgSvc, env.auth, nil)
+
+	if _, err := service.RegisterUser("grace", "Correct-Horse-42", "grace@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RegisterUser("mallory", "Correct-Horse-42", " grace@example.com ", ""); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Fatalf("duplicate email: err = %v, want ErrInvalidInput", err)
+	}
+	// 未填写邮箱的用户之间不冲突
+	for _, username := range []string{"heidi", "ivan"} {
+		if _, err := service.RegisterUser(username, "Correct-Horse-42", "", ""); err != nil {
+			t.Errorf("RegisterUser(%s) without email: %v", username, err)
+		}
+	}
+}
+
+func TestRegisterUserValidatesPhone(t *testing.T) {
+	env := newTestEnv()
+	service := NewUserService(env.users, NewPasswordPolicy(0, nil), env.orgSvc, env.auth, nil)
+
+	user, err := service.RegisterUser("kate", "Correct-Horse-42", "", " +86 138-0000-0000 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Phone != "+86 138-0000-0000" {
+		t.Errorf("phone = %q, want the trimmed number", user.Phone)
+	}
+	for _, phone := range []string{"12", "call me", "138<script>"} {
+		if _, err := service.RegisterUser("leo", "Correct-Horse-42", "", phone); !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("phone %q: err = %v, want ErrInvalidInput", phone, err)
+		}
+	}
+}
+
+func TestRegisterUserJoinsDefaultOrg(t *testing.T) {
+	env := newTestEnv()
+	service := NewUserService(env.users, NewPasswordPolicy(0, nil), env.orgSvc, env.auth, nil)
+
+	user, err := service.RegisterUser("judy", "Correct-Horse-42", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	membership, err := env.orgs.FindMembership(1, user.ID)
+	if err != nil || membership == nil {
+		t.Fatalf("default org membership = %v, %v", membership, err)
+	}
+	if membership.Role != domain.RoleUser {
+		t.Errorf("membership role = %q, want user", membership.Role)
+	}
+}
+
+// userFixture 默认组织中的一位平台管理员、一位组织管理员和两位普通成员，另有一个只有一位管理员的组织
+type userFixture struct {
+	env     *testEnv
+	service *UserService
+	root    *domain.User // 平台管理员
+	owner   *domain.User // 默认组织管理员
+	alice   *domain.User
+	bob     *domain.User
+	farm    *domain.User // 第二个组织唯一的管理员
+}
+
+func newUserFixture(t *testing.T) *userFixture {
+	t.Helper()
+	env := newTestEnv()
+	f := &userFixture{env: env, service: NewUserService(env.users, NewPasswordPolicy(0, nil), env.orgSvc, env.auth, nil)}
+	if err := env.orgs.Create(&domain.Organization{Slug: "farm", Name: "养殖场", Kind: domain.OrgAgency}); err != nil {
+		t.Fatal(err)
+	}
+	add := func(user *domain.User, orgID uint, role domain.Role) *domain.User {
+		if err := env.users.Create(user); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.orgs.SaveMembership(&domain.Membership{OrgID: orgID, UserID: user.ID, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	f.root = add(&domain.User{Username: "root", Role: domain.RoleAdmin}, 1, domain.RoleAdmin)
+	f.owner = add(&domain.User{Username: "owner", Role: domain.RoleUser, DisplayName: "站长"}, 1, domain.RoleAdmin)
+	f.alice = add(&domain.User{Username: "alice", Role: domain.RoleUser, Email: "alice@example.com"}, 1, domain.RoleUser)
+	f.bob = add(&domain.User{Username: "bob", Role: domain.RoleUser, Email: "bob@lake.org"}, 1, domain.RoleUser)
+	f.farm = add(&domain.User{Username: "farmer", Role: domain.RoleUser}, 2, domain.RoleAdmin)
+	return f
+}
+
+func (f *userFixture) principal(user *domain.User, orgID uint) *domain.Principal {
+	role := user.Role
+	if m, _ := f.env.orgs.FindMembership(orgID, user.ID); m != nil {
+		role = m.Role
+	}
+	return &domain.Principal{Kind: domain.PrincipalUser, UserID: user.ID, Role: role, PlatformAdmin: user.Role == domain.RoleAdmin, OrgID: orgID}
+}
+
+func TestDisableUserRules(t *testing.T) {
+	f := newUserFixture(t)
+	rootActor := f.principal(f.root, 1)
+
+	tests := []struct {
+		name    string
+		actor   *domain.Principal
+		userID  uint
+		wantErr error
+	}{
+		{"disable yourself", f.principal(f.owner, 1), f.owner.ID, domain.ErrInvalidInput},
+		{"last platform admin", &domain.Principal{Kind: domain.PrincipalUser, UserID: 999, Role: domain.RoleAdmin, PlatformAdmin: true, OrgID: 1}, f.root.ID, domain.ErrLastAdmin},
+		{"last admin of an organization", rootActor, f.farm.ID, domain.ErrLastAdmin},
+		{"org admin disabling a platform admin", f.principal(f.owner, 1), f.root.ID, domain.ErrForbidden},
+		{"user outside the actor's organization", f.principal(f.owner, 1), f.farm.ID, domain.ErrNotOrgMember},
+		{"unknown user", rootActor, 999, domain.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.service.DisableUser(tt.actor, tt.userID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DisableUser = %v, want %v", err, tt.wantErr)
+			}
+			if user, _ := f.env.users.FindByID(tt.userID); user != nil && user.IsDisabled() {
+				t.Errorf("user %d was disabled", tt.userID)
+			}
+		})
+	}
+}
+
+func TestDisableUserRevokesSessionsAndKeys(t *testing.T) {
+	f := newUserFixture(t)
+	owner := f.principal(f.owner, 1)
+	if _, err := f.env.auth.StartSession(f.alice, false); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewAPIKeyService(f.env.keys, f.env.roles)
+	plaintext, _, err := keys.CreateKey(f.principal(f.alice, 1), APIKeyInput{Name: "probe", Permissions: []domain.Permission{domain.PermWaterQualityRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.service.DisableUser(owner, f.alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := f.env.users.FindByID(f.alice.ID); !user.IsDisabled() {
+		t.Error("user is not disabled")
+	}
+	if n := f.env.sessions.active(f.alice.ID); n != 0 {
+		t.Errorf("active sessions after disable = %d, want 0", n)
+	}
+	if _, err := keys.Authenticate(plaintext, "10.0.0.1"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+		t.Errorf("key of disabled user: err = %v, want ErrInvalidAPIKey", err)
+	}
+	// 重复停用不报错
+	if err := f.service.DisableUser(owner, f.alice.ID); err != nil {
+		t.Errorf("disable twice: %v", err)
+	}
+
+	if err := f.service.EnableUser(owner, f.alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := f.env.users.FindByID(f.alice.ID); user.IsDisabled() {
+		t.Error("user is still disabled after enable")
+	}
+}
+
+func TestDisabledAdminsDoNotCountAsOtherAdmins(t *testing.T) {
+	f := newUserFixture(t)
+	rootActor := f.principal(f.root, 1)
+
+	// 第二个组织的另一位管理员已停用，唯一可用的管理员仍不能被停用或降级
+	second := &domain.User{Username: "helper", Role: domain.RoleUser}
+	if err := f.env.users.Create(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.env.orgs.SaveMembership(&domain.Membership{OrgID: 2, UserID: second.ID, Role: domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.DisableUser(rootActor, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.DisableUser(rootActor, f.farm.ID); !errors.Is(err, domain.ErrLastAdmin) {
+		t.Errorf("disable the last active org admin: err = %v, want ErrLastAdmin", err)
+	}
+	farmActor := &domain.Principal{Kind: domain.PrincipalUser, UserID: f.root.ID, Role: domain.RoleAdmin, PlatformAdmin: true, OrgID: 2}
+	if err := f.env.orgSvc.SetMemberRole(farmActor, f.farm.ID, domain.RoleUser); !errors.Is(err, domain.ErrLastAdmin) {
+		t.Errorf("demote the last active org admin: err = %v, want ErrLastAdmin", err)
+	}
+
+	// 另一位平台管理员停用后，剩下的平台管理员不能被降级
+	other := &domain.User{Username: "root2", Role: domain.RoleAdmin}
+	if err := f.env.users.Create(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.service.DisableUser(rootActor, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.env.roles.AssignRole(f.root.ID, domain.RoleUser); !errors.Is(err, domain.ErrLastAdmin) {
+		t.Errorf("demote the last active platform admin: err = %v, want ErrLastAdmin", err)
+	}
+}
+
+func TestListMembersSearchAndPaging(t *testing.T) {
+	f := newUserFixture(t)
+	scope := domain.TenantScope{OrgID: 1}
+	if err := f.service.DisableUser(f.principal(f.root, 1), f.bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    domain.UserFilter
+		wantTotal int64
+		want      []string
+	}{
+		{"all members", domain.UserFilter{}, 4, []string{"root", "owner", "alice", "bob"}},
+		{"keyword matches email", domain.UserFilter{Query: " example.com "}, 1, []string{"alice"}},
+		{"keyword matches display name", domain.UserFilter{Query: "站长"}, 1, []string{"owner"}},
+		{"role", domain.UserFilter{Role: domain.RoleAdmin}, 2, []string{"root", "owner"}},
+		{"disabled", domain.UserFilter{Status: domain.UserStatusDisabled}, 1, []string{"bob"}},
+		{"second page", domain.UserFilter{Offset: 2, Limit: 2}, 4, []string{"alice", "bob"}},
+		{"past the last page", domain.UserFilter{Offset: 10, Limit: 2}, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, total, err := f.env.orgSvc.ListMembers(scope, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range members {
+				got = append(got, m.User.Username)
+			}
+			if total != tt.wantTotal || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("members = %v (total %d), want %v (total %d)", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+	if _, _, err := f.env.orgSvc.ListMembers(domain.TenantScope{}, domain.UserFilter{}); !errors.Is(err, domain.ErrOrgNotFound) {
+		t.Errorf("no organization: err = %v, want ErrOrgNotFound", err)
+	}
+}
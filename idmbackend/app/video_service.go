@@ -0,0 +1,364 @@
+package app
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+type VideoRepository interface {
+	Create(scope domain.TenantScope, video *domain.Video) error
+	FindByID(scope domain.TenantScope, id uint) (*domain.Video, error)
+	Find(scope domain.TenantScope, keyword string, offset, limit int) ([]*domain.Video, int64, error)
+	Update(scope domain.TenantScope, video *domain.Video) error
+	Delete(scope domain.TenantScope, id uint) error
+	CreateAnnotations(scope domain.TenantScope, annotations []*domain.Annotation) error
+	FindAnnotation(scope domain.TenantScope, videoID, id uint) (*domain.Annotation, error)
+	FindAnnotations(scope domain.TenantScope, videoID uint, filter domain.AnnotationFilter) ([]*domain.Annotation, int64, error)
+	UpdateAnnotation(scope domain.TenantScope, annotation *domain.Annotation) error
+	DeleteAnnotation(scope domain.TenantScope, videoID, id uint) error
+	FishCountSeries(scope domain.TenantScope, videoID uint, from, to *float64, interval float64) ([]domain.FishCountPoint, error)
+}
+
+const (
+	maxAnnotationsPerRequest = 1000
+	maxDetectionsPerFrame    = 200
+	// minSeriesInterval 时间序列的最小分段，避免请求过细的分段
+	minSeriesInterval = 0.1
+)
+
+// videoTypes 允许上传的视频格式及其扩展名，只接受浏览器可以直接播放的格式
+var videoTypes = map[string]string{
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// VideoInput 视频的描述信息
+type VideoInput struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	SourceURL   string  `json:"source_url"`
+	Duration    float64 `json:"duration"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	FrameRate   float64 `json:"frame_rate"`
+}
+
+// AnnotationInput 一条标注，Timestamp 为距视频开始的秒数
+type AnnotationInput struct {
+	Timestamp  float64            `json:"timestamp"`
+	FishCount  int                `json:"fish_count"`
+	Behavior   string             `json:"behavior"`
+	Confidence float64            `json:"confidence"`
+	Detections []domain.Detection `json:"detections"`
+	Source     string             `json:"source"`
+}
+
+// VideoService 管理视频数据集及其标注
+type VideoService struct {
+	repo  VideoRepository
+	blobs StreamBlobStore
+}
+
+func NewVideoService(repo VideoRepository, blobs StreamBlobStore) *VideoService {
+	return &VideoService{repo: repo, blobs: blobs}
+}
+
+// CreateVideo 创建视频记录。content 不为空时上传视频文件，格式按文件内容判断；
+// 为空时只登记外部地址，此时 SourceURL 必填
+func (s *VideoService) CreateVideo(scope domain.TenantScope, userID uint, input VideoInput, content io.Reader) (*domain.Video, error) {
+	video := &domain.Video{UploadedBy: userID}
+	if err := applyVideoInput(video, input); err != nil {
+		return nil, err
+	}
+	if content == nil {
+		if video.SourceURL == "" {
+			return nil, fmt.Errorf("%w: video file or source_url is required", domain.ErrInvalidInput)
+		}
+		if err := s.repo.Create(scope, video); err != nil {
+			return nil, err
+		}
+		return video, nil
+	}
+
+	reader := bufio.NewReaderSize(content, 512)
+	head, _ := reader.Peek(512)
+	mimeType := http.DetectContentType(head)
+	ext, ok := videoTypes[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: only MP4 and WebM videos are supported", domain.ErrUnsupportedMedia)
+	}
+
+	key, err := newVideoKey(ext)
+	if err != nil {
+		return nil, err
+	}
+	size, err := s.blobs.PutStream(key, reader, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	video.StorageKey, video.MimeType, video.Size = key, mimeType, size
+	if err := s.repo.Create(scope, video); err != nil {
+		s.removeBlob(key)
+		return nil, err
+	}
+	return video, nil
+}
+
+func (s *VideoService) GetVideo(scope domain.TenantScope, id uint) (*domain.Video, error) {
+	video, err := s.repo.FindByID(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if video == nil {
+		return nil, domain.ErrVideoNotFound
+	}
+	return video, nil
+}
+
+func (s *VideoService) ListVideos(scope domain.TenantScope, keyword string, offset, limit int) ([]*domain.Video, int64, error) {
+	return s.repo.Find(scope, strings.TrimSpace(keyword), offset, limit)
+}
+
+// UpdateVideo 更新视频的描述信息，已上传的视频文件不变
+func (s *VideoService) UpdateVideo(scope domain.TenantScope, id uint, input VideoInput) (*domain.Video, error) {
+	video, err := s.GetVideo(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyVideoInput(video, input); err != nil {
+		return nil, err
+	}
+	if !video.Stored() && video.SourceURL == "" {
+		return nil, fmt.Errorf("%w: source_url is required for videos without uploaded file", domain.ErrInvalidInput)
+	}
+	if err := s.repo.Update(scope, video); err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// DeleteVideo 删除视频、标注及已上传的视频文件
+func (s *VideoService) DeleteVideo(scope domain.TenantScope, id uint) error {
+	video, err := s.GetVideo(scope, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(scope, id); err != nil {
+		return err
+	}
+	if video.Stored() {
+		s.removeBlob(video.StorageKey)
+	}
+	return nil
+}
+
+// OpenVideo 打开已上传的视频文件用于随机读取，只登记了外部地址的视频返回 domain.ErrBlobNotFound
+func (s *VideoService) OpenVideo(scope domain.TenantScope, id uint) (*domain.Video, io.ReadSeekCloser, error) {
+	video, err := s.GetVideo(scope, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !video.Stored() {
+		return video, nil, domain.ErrBlobNotFound
+	}
+	f, err := s.blobs.Open(video.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return video, f, nil
+}
+
+// CreateAnnotations 批量保存视频标注，浏览器端的检测结果可以一次提交
+func (s *VideoService) CreateAnnotations(scope domain.TenantScope, userID, videoID uint, inputs []AnnotationInput) ([]*domain.Annotation, error) {
+	video, err := s.GetVideo(scope, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: no annotations provided", domain.ErrInvalidInput)
+	}
+	if len(inputs) > maxAnnotationsPerRequest {
+		return nil, fmt.Errorf("%w: at most %d annotations per request", domain.ErrInvalidInput, maxAnnotationsPerRequest)
+	}
+
+	annotations := make([]*domain.Annotation, 0, len(inputs))
+	for i, input := range inputs {
+		annotation := &domain.Annotation{VideoID: videoID, CreatedBy: userID}
+		if err := applyAnnotationInput(annotation, video, input); err != nil {
+			return nil, fmt.Errorf("annotation %d: %w", i, err)
+		}
+		annotations = append(annotations, annotation)
+	}
+	if err := s.repo.CreateAnnotations(scope, annotations); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+// ListAnnotations 按时间范围查询视频标注
+func (s *VideoService) ListAnnotations(scope domain.TenantScope, videoID uint, filter domain.AnnotationFilter) ([]*domain.Annotation, int64, error) {
+	if _, err := s.GetVideo(scope, videoID); err != nil {
+		return nil, 0, err
+	}
+	if filter.From != nil && filter.To != nil && *filter.From > *filter.To {
+		return nil, 0, fmt.Errorf("%w: from must not be after to", domain.ErrInvalidInput)
+	}
+	return s.repo.FindAnnotations(scope, videoID, filter)
+}
+
+func (s *VideoService) UpdateAnnotation(scope domain.TenantScope, videoID, id uint, input AnnotationInput) (*domain.Annotation, error) {
+	video, err := s.GetVideo(scope, videoID)
+	if err != nil {
+		return nil, err
+	}
+	annotation, err := s.getAnnotation(scope, videoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyAnnotationInput(annotation, video, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateAnnotation(scope, annotation); err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+func (s *VideoService) DeleteAnnotation(scope domain.TenantScope, videoID, id uint) error {
+	if _, err := s.getAnnotation(scope, videoID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteAnnotation(scope, videoID, id)
+}
+
+// FishCountSeries 按 interval 秒分段统计视频中的鱼群数量
+func (s *VideoService) FishCountSeries(scope domain.TenantScope, videoID uint, from, to *float64, interval float64) ([]domain.FishCountPoint, error) {
+	if _, err := s.GetVideo(scope, videoID); err != nil {
+		return nil, err
+	}
+	if interval < minSeriesInterval || math.IsInf(interval, 0) || math.IsNaN(interval) {
+		return nil, fmt.Errorf("%w: interval must be at least %.1f seconds", domain.ErrInvalidInput, minSeriesInterval)
+	}
+	if from != nil && to != nil && *from > *to {
+		return nil, fmt.Errorf("%w: from must not be after to", domain.ErrInvalidInput)
+	}
+	return s.repo.FishCountSeries(scope, videoID, from, to, interval)
+}
+
+func (s *VideoService) getAnnotation(scope domain.TenantScope, videoID, id uint) (*domain.Annotation, error) {
+	annotation, err := s.repo.FindAnnotation(scope, videoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if annotation == nil {
+		return nil, domain.ErrAnnotationNotFound
+	}
+	return annotation, nil
+}
+
+// removeBlob 尽力清理视频文件，失败只记录日志
+func (s *VideoService) removeBlob(key string) {
+	if err := s.blobs.Delete(key); err != nil {
+		log.Printf("删除视频文件失败 %s: %v", key, err)
+	}
+}
+
+func applyVideoInput(video *domain.Video, input VideoInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > 128 {
+		return fmt.Errorf("%w: name is required and must be at most 128 characters", domain.ErrInvalidInput)
+	}
+	source := strings.TrimSpace(input.SourceURL)
+	if source != "" && !validSourceURL(source) {
+		return fmt.Errorf("%w: source_url must be an http(s) URL or an absolute path", domain.ErrInvalidInput)
+	}
+	if !validNonNegative(input.Duration) || !validNonNegative(input.FrameRate) || input.Width < 0 || input.Height < 0 {
+		return fmt.Errorf("%w: duration, size and frame rate must not be negative", domain.ErrInvalidInput)
+	}
+
+	video.Name = name
+	video.Description = strings.TrimSpace(input.Description)
+	video.SourceURL = source
+	video.Duration = input.Duration
+	video.Width = input.Width
+	video.Height = input.Height
+	video.FrameRate = input.FrameRate
+	return nil
+}
+
+// applyAnnotationInput 校验并设置标注内容，视频时长已知时标注时间不能超出视频
+func applyAnnotationInput(annotation *domain.Annotation, video *domain.Video, input AnnotationInput) error {
+	if !validNonNegative(input.Timestamp) || (video.Duration > 0 && input.Timestamp > video.Duration) {
+		return fmt.Errorf("%w: timestamp must be within the video", domain.ErrInvalidInput)
+	}
+	if input.FishCount < 0 {
+		return fmt.Errorf("%w: fish_count must not be negative", domain.ErrInvalidInput)
+	}
+	if input.Confidence < 0 || input.Confidence > 1 {
+		return fmt.Errorf("%w: confidence must be between 0 and 1", domain.ErrInvalidInput)
+	}
+	behavior := strings.TrimSpace(input.Behavior)
+	source := strings.TrimSpace(input.Source)
+	if utf8.RuneCountInString(behavior) > 32 || utf8.RuneCountInString(source) > 32 {
+		return fmt.Errorf("%w: behavior and source must be at most 32 characters", domain.ErrInvalidInput)
+	}
+	if len(input.Detections) > maxDetectionsPerFrame {
+		return fmt.Errorf("%w: at most %d detections per annotation", domain.ErrInvalidInput, maxDetectionsPerFrame)
+	}
+	for _, d := range input.Detections {
+		if d.Score < 0 || d.Score > 1 || d.BBox[2] < 0 || d.BBox[3] < 0 {
+			return fmt.Errorf("%w: invalid detection", domain.ErrInvalidInput)
+		}
+	}
+
+	if source == "" {
+		source = "manual"
+	}
+	annotation.Timestamp = input.Timestamp
+	annotation.FishCount = input.FishCount
+	annotation.Behavior = behavior
+	annotation.Confidence = input.Confidence
+	annotation.Detections = input.Detections
+	annotation.Source = source
+	return nil
+}
+
+func validNonNegative(v float64) bool {
+	return v >= 0 && !math.IsInf(v, 0) && !math.IsNaN(v)
+}
+
+// validSourceURL 外部地址可以是 http(s) 地址，或前端站点下的绝对路径（如 /videos/a.mp4）。
+// 浏览器把反斜杠当作斜杠，"/\evil.com" 会被当作协议相对地址，跳转到其他站点
+func validSourceURL(source string) bool {
+	if len(source) > 512 {
+		return false
+	}
+	if strings.HasPrefix(source, "/") {
+		if strings.HasPrefix(source, "//") || strings.Contains(source, "\\") {
+			return false
+		}
+		u, err := url.Parse(source)
+		return err == nil && u.Scheme == "" && u.Host == ""
+	}
+	u, err := url.Parse(source)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func newVideoKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "videos/" + hex.EncodeToString(b) + ext, nil
+}
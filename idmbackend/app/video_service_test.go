@@ -0,0 +1,415 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// memVideoRepo 与数据库实现一样按 scope.OrgID 隔离视频和标注
+type memVideoRepo struct {
+	mu          sync.Mutex
+	videos      []*domain.Video
+	annotations []*domain.Annotation
+	// createErr 不为 nil 时创建视频返回该错误，模拟数据库写入失败
+	createErr error
+}
+
+func (r *memVideoRepo) Create(scope domain.TenantScope, video *domain.Video) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return r.createErr
+	}
+	video.ID = uint(len(r.videos) + 1)
+	video.OrgID = scope.OrgID
+	copied := *video
+	r.videos = append(r.videos, &copied)
+	return nil
+}
+
+func (r *memVideoRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Video, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.videos {
+		if v.ID == id && v.OrgID == scope.OrgID {
+			copied := *v
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memVideoRepo) Find(scope domain.TenantScope, keyword string, offset, limit int) ([]*domain.Video, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Video
+	for _, v := range r.videos {
+		if v.OrgID == scope.OrgID && strings.Contains(v.Name, keyword) {
+			copied := *v
+			found = append(found, &copied)
+		}
+	}
+	return found, int64(len(found)), nil
+}
+
+func (r *memVideoRepo) Update(scope domain.TenantScope, video *domain.Video) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.videos {
+		if v.ID == video.ID && v.OrgID == scope.OrgID {
+			copied := *video
+			r.videos[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memVideoRepo) Delete(scope domain.TenantScope, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.videos {
+		if v.ID == id && v.OrgID == scope.OrgID {
+			r.videos = append(r.videos[:i], r.videos[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memVideoRepo) CreateAnnotations(scope domain.TenantScope, annotations []*domain.Annotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range annotations {
+		a.ID = uint(len(r.annotations) + 1)
+		a.OrgID = scope.OrgID
+		copied := *a
+		r.annotations = append(r.annotations, &copied)
+	}
+	return nil
+}
+
+func (r *memVideoRepo) FindAnnotation(scope domain.TenantScope, videoID, id uint) (*domain.Annotation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.annotations {
+		if a.ID == id && a.VideoID == videoID && a.OrgID == scope.OrgID {
+			copied := *a
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// matching 与数据库实现一样包含 from 和 to 两端，按时间排序
+func (r *memVideoRepo) matching(scope domain.TenantScope, videoID uint, from, to *float64) []*domain.Annotation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Annotation
+	for _, a := range r.annotations {
+		if a.OrgID == scope.OrgID && a.VideoID == videoID && (from == nil || a.Timestamp >= *from) && (to == nil || a.Timestamp <= *to) {
+			copied := *a
+			found = append(found, &copied)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Timestamp < found[j].Timestamp })
+	return found
+}
+
+func (r *memVideoRepo) FindAnnotations(scope domain.TenantScope, videoID uint, filter domain.AnnotationFilter) ([]*domain.Annotation, int64, error) {
+	var found []*domain.Annotation
+	for _, a := range r.matching(scope, videoID, filter.From, filter.To) {
+		if filter.Behavior == "" || a.Behavior == filter.Behavior {
+			found = append(found, a)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(filter.Offset, len(found)):]
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+	return found, total, nil
+}
+
+func (r *memVideoRepo) UpdateAnnotation(scope domain.TenantScope, annotation *domain.Annotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.annotations {
+		if a.ID == annotation.ID && a.OrgID == scope.OrgID {
+			copied := *annotation
+			r.annotations[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memVideoRepo) DeleteAnnotation(scope domain.TenantScope, videoID, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.annotations {
+		if a.ID == id && a.VideoID == videoID && a.OrgID == scope.OrgID {
+			r.annotations = append(r.annotations[:i], r.annotations[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memVideoRepo) FishCountSeries(scope domain.TenantScope, videoID uint, from, to *float64, interval float64) ([]domain.FishCountPoint, error) {
+	var points []domain.FishCountPoint
+	for _, a := range r.matching(scope, videoID, from, to) {
+		start := math.Floor(a.Timestamp/interval) * interval
+		if len(points) == 0 || points[len(points)-1].Start != start {
+			points = append(points, domain.FishCountPoint{Start: start, End: start + interval, Min: a.FishCount, Max: a.FishCount})
+		}
+		p := &points[len(points)-1]
+		p.Mean = (p.Mean*float64(p.Samples) + float64(a.FishCount)) / float64(p.Samples+1)
+		p.Samples++
+		p.Min, p.Max = min(p.Min, a.FishCount), max(p.Max, a.FishCount)
+	}
+	return points, nil
+}
+
+// memStreamBlobStore 在内存对象存储上实现流式读写
+type memStreamBlobStore struct {
+	*memBlobStore
+}
+
+func (s memStreamBlobStore) PutStream(key string, r io.Reader, contentType string) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), s.Put(key, data, contentType)
+}
+
+func (s memStreamBlobStore) Open(key string) (io.ReadSeekCloser, error) {
+	data, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// testMP4 以 ftyp 头开始的 MP4 内容，足以通过格式判断
+var testMP4 = append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), bytes.Repeat([]byte{0x42}, 4096)...)
+
+func newTestVideoService() (*VideoService, *memVideoRepo, *memBlobStore) {
+	repo, blobs := &memVideoRepo{}, newMemBlobStore()
+	return NewVideoService(repo, memStreamBlobStore{blobs}), repo, blobs
+}
+
+func TestValidSourceURL(t *testing.T) {
+	tests := []struct {
+		source string
+		valid  bool
+	}{
+		{"/videos/a.mp4", true},
+		{"/videos/a.mp4?t=10#start", true},
+		{"https://cdn.example.com/a.mp4", true},
+		{"http://cdn.example.com/a.mp4", true},
+		{"//evil.com/a.mp4", false},
+		{"/\\evil.com", false},
+		{"/videos\\..\\a.mp4", false},
+		{"/\t/evil.com", false},
+		{"javascript:alert(1)", false},
+		{"https:///a.mp4", false},
+		{"videos/a.mp4", false},
+	}
+	for _, tt := range tests {
+		if got := validSourceURL(tt.source); got != tt.valid {
+			t.Errorf("validSourceURL(%q) = %v, want %v", tt.source, got, tt.valid)
+		}
+	}
+}
+
+func TestCreateVideoSniffsContent(t *testing.T) {
+	service, repo, blobs := newTestVideoService()
+	scope := domain.TenantScope{OrgID: 1}
+
+	tests := []struct {
+		name    string
+		input   VideoInput
+		content []byte
+		wantErr error
+	}{
+		{"missing name", VideoInput{Name: " "}, testMP4, domain.ErrInvalidInput},
+		{"negative duration", VideoInput{Name: "1号池", Duration: -1}, testMP4, domain.ErrInvalidInput},
+		{"no file and no source url", VideoInput{Name: "1号池"}, nil, domain.ErrInvalidInput},
+		{"mp4 extension but avi content", VideoInput{Name: "1号池.mp4"}, append([]byte("RIFF\x00\x00\x00\x00AVI LIST"), testMP4...), domain.ErrUnsupportedMedia},
+		{"plain text", VideoInput{Name: "notes"}, []byte("not a video"), domain.ErrUnsupportedMedia},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content io.Reader
+			if tt.content != nil {
+				content = bytes.NewReader(tt.content)
+			}
+			if _, err := service.CreateVideo(scope, 5, tt.input, content); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateVideo = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if len(blobs.blobs) != 0 {
+		t.Errorf("%d blobs stored for rejected videos", len(blobs.blobs))
+	}
+
+	video, err := service.CreateVideo(scope, 5, VideoInput{Name: " 1号池 "}, bytes.NewReader(testMP4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.MimeType != "video/mp4" || video.Size != int64(len(testMP4)) || !strings.HasSuffix(video.StorageKey, ".mp4") || video.Name != "1号池" {
+		t.Errorf("video = %+v", video)
+	}
+	linked, err := service.CreateVideo(scope, 5, VideoInput{Name: "外部", SourceURL: "https://cdn.example.com/a.mp4"}, nil)
+	if err != nil || linked.Stored() {
+		t.Fatalf("linked video = %+v, %v", linked, err)
+	}
+	if _, _, err := service.OpenVideo(scope, linked.ID); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("open linked video: err = %v, want ErrBlobNotFound", err)
+	}
+
+	// 保存记录失败时删除已上传的文件
+	repo.createErr = errors.New("database unavailable")
+	if _, err := service.CreateVideo(scope, 5, VideoInput{Name: "2号池"}, bytes.NewReader(testMP4)); err == nil {
+		t.Fatal("CreateVideo succeeded, want the repository error")
+	}
+	if len(blobs.blobs) != 1 {
+		t.Errorf("blobs = %d, want only the first video", len(blobs.blobs))
+	}
+}
+
+func TestAnnotationValidation(t *testing.T) {
+	service, _, _ := newTestVideoService()
+	scope := domain.TenantScope{OrgID: 1}
+	video, err := service.CreateVideo(scope, 5, VideoInput{Name: "1号池", Duration: 60}, bytes.NewReader(testMP4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input AnnotationInput
+	}{
+		{"negative timestamp", AnnotationInput{Timestamp: -1}},
+		{"after the end of the video", AnnotationInput{Timestamp: 60.5}},
+		{"not a number", AnnotationInput{Timestamp: math.NaN()}},
+		{"negative fish count", AnnotationInput{Timestamp: 1, FishCount: -1}},
+		{"confidence above 1", AnnotationInput{Timestamp: 1, Confidence: 1.2}},
+		{"detection with negative size", AnnotationInput{Timestamp: 1, Detections: []domain.Detection{{Class: "fish", Score: 0.5, BBox: [4]float64{1, 1, -2, 3}}}}},
+		{"too many detections", AnnotationInput{Timestamp: 1, Detections: make([]domain.Detection, maxDetectionsPerFrame+1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CreateAnnotations(scope, 5, video.ID, []AnnotationInput{{Timestamp: 1}, tt.input}); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("CreateAnnotations = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+	if _, err := service.CreateAnnotations(scope, 5, video.ID, nil); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("no annotations: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := service.CreateAnnotations(domain.TenantScope{OrgID: 2}, 5, video.ID, []AnnotationInput{{Timestamp: 1}}); !errors.Is(err, domain.ErrVideoNotFound) {
+		t.Errorf("video from other org: err = %v, want ErrVideoNotFound", err)
+	}
+
+	created, err := service.CreateAnnotations(scope, 5, video.ID, []AnnotationInput{{Timestamp: 60, FishCount: 3, Behavior: " feeding "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotation := created[0]
+	if annotation.Source != "manual" || annotation.Behavior != "feeding" || annotation.CreatedBy != 5 {
+		t.Errorf("annotation = %+v", annotation)
+	}
+
+	// 修改标注时同样校验时间，不能超出视频时长
+	if _, err := service.UpdateAnnotation(scope, video.ID, annotation.ID, AnnotationInput{Timestamp: 61}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("update past the end: err = %v, want ErrInvalidInput", err)
+	}
+	updated, err := service.UpdateAnnotation(scope, video.ID, annotation.ID, AnnotationInput{Timestamp: 30, FishCount: 5, Source: "coco-ssd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Timestamp != 30 || updated.FishCount != 5 || updated.Source != "coco-ssd" || updated.CreatedBy != 5 {
+		t.Errorf("updated = %+v", updated)
+	}
+	if _, err := service.UpdateAnnotation(scope, video.ID, 99, AnnotationInput{Timestamp: 1}); !errors.Is(err, domain.ErrAnnotationNotFound) {
+		t.Errorf("unknown annotation: err = %v, want ErrAnnotationNotFound", err)
+	}
+
+	// 时长未知的视频不限制标注时间
+	unknown, err := service.CreateVideo(scope, 5, VideoInput{Name: "2号池", SourceURL: "/videos/b.mp4"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateAnnotations(scope, 5, unknown.ID, []AnnotationInput{{Timestamp: 7200}}); err != nil {
+		t.Errorf("annotation on a video without duration: %v", err)
+	}
+}
+
+func TestListAnnotationsAndFishCountSeries(t *testing.T) {
+	service, _, _ := newTestVideoService()
+	scope := domain.TenantScope{OrgID: 1}
+	video, err := service.CreateVideo(scope, 5, VideoInput{Name: "1号池", SourceURL: "/videos/a.mp4"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []AnnotationInput
+	for i, count := range []int{2, 4, 3, 7, 1} {
+		inputs = append(inputs, AnnotationInput{Timestamp: float64(i) * 2.5, FishCount: count})
+	}
+	if _, err := service.CreateAnnotations(scope, 5, video.ID, inputs); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := 2.5, 7.5
+	annotations, total, err := service.ListAnnotations(scope, video.ID, domain.AnnotationFilter{From: &from, To: &to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || annotations[0].Timestamp != 2.5 || annotations[2].Timestamp != 7.5 {
+		t.Errorf("annotations in [2.5, 7.5] = %d, want 3 including both ends", total)
+	}
+	if _, _, err := service.ListAnnotations(scope, video.ID, domain.AnnotationFilter{From: &to, To: &from}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("from after to: err = %v, want ErrInvalidInput", err)
+	}
+
+	points, err := service.FishCountSeries(scope, video.ID, nil, nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || points[0].Samples != 2 || points[0].Mean != 3 || points[1].Min != 3 || points[1].Max != 7 || points[2].Start != 10 {
+		t.Errorf("points = %+v", points)
+	}
+
+	tests := []struct {
+		name     string
+		from, to *float64
+		interval float64
+	}{
+		{"interval below the minimum", nil, nil, 0.05},
+		{"infinite interval", nil, nil, math.Inf(1)},
+		{"not a number", nil, nil, math.NaN()},
+		{"from after to", &to, &from, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.FishCountSeries(scope, video.ID, tt.from, tt.to, tt.interval); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Errorf("FishCountSeries = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
@@ -1,18 +1,22 @@
 package app
 
 import (
+	"time"
+
 	"github.com/MoyInGxing/idm/domain"
 )
 
+// WaterQualityRepository 所有查询都限定在 scope 所在的组织内
 type WaterQualityRepository interface {
-	FindAll() ([]*domain.WaterQuality, error)
-	FindByRecordID(recordID string) (*domain.WaterQuality, error)
-	FindByAreaID(areaID string) ([]*domain.WaterQuality, error)
-	FindByAreaIDWithPagination(areaID string, offset, limit int) ([]*domain.WaterQuality, error)
-	Create(waterQuality *domain.WaterQuality) error
-	Update(waterQuality *domain.WaterQuality) error
-	Delete(recordID string) error
-	GetLatestByAreaID(areaID string) (*domain.WaterQuality, error)
+	FindAll(scope domain.TenantScope, areaIDs []string) ([]*domain.WaterQuality, error)
+	FindByRecordID(scope domain.TenantScope, recordID string) (*domain.WaterQuality, error)
+	FindByAreaID(scope domain.TenantScope, areaID string) ([]*domain.WaterQuality, error)
+	FindByAreaIDWithPagination(scope domain.TenantScope, areaID string, offset, limit int) ([]*domain.WaterQuality, error)
+	Create(scope domain.TenantScope, waterQuality *domain.WaterQuality) error
+	Update(scope domain.TenantScope, waterQuality *domain.WaterQuality) error
+	Delete(scope domain.TenantScope, recordID string) error
+	GetLatestByAreaID(scope domain.TenantScope, areaID string) (*domain.WaterQuality, error)
+	FindByAreaIDBetween(scope domain.TenantScope, areaID string, from, to time.Time) ([]*domain.WaterQuality, error)
 }
 
 type WaterQualityService struct {
@@ -23,34 +27,35 @@ func NewWaterQualityService(repo WaterQualityRepository) *WaterQualityService {
 	return &WaterQualityService{waterQualityRepo: repo}
 }
 
-func (s *WaterQualityService) GetAllWaterQuality() ([]*domain.WaterQuality, error) {
-	return s.waterQualityRepo.FindAll()
+// GetAllWaterQuality areaIDs 不为空时只返回这些区域的数据
+func (s *WaterQualityService) GetAllWaterQuality(scope domain.TenantScope, areaIDs []string) ([]*domain.WaterQuality, error) {
+	return s.waterQualityRepo.FindAll(scope, areaIDs)
 }
 
-func (s *WaterQualityService) GetWaterQualityByRecordID(recordID string) (*domain.WaterQuality, error) {
-	return s.waterQualityRepo.FindByRecordID(recordID)
+func (s *WaterQualityService) GetWaterQualityByRecordID(scope domain.TenantScope, recordID string) (*domain.WaterQuality, error) {
+	return s.waterQualityRepo.FindByRecordID(scope, recordID)
 }
 
-func (s *WaterQualityService) GetWaterQualityByAreaID(areaID string) ([]*domain.WaterQuality, error) {
-	return s.waterQualityRepo.FindByAreaID(areaID)
+func (s *WaterQualityService) GetWaterQualityByAreaID(scope domain.TenantScope, areaID string) ([]*domain.WaterQuality, error) {
+	return s.waterQualityRepo.FindByAreaID(scope, areaID)
 }
 
-func (s *WaterQualityService) GetWaterQualityByAreaIDWithPagination(areaID string, offset, limit int) ([]*domain.WaterQuality, error) {
-	return s.waterQualityRepo.FindByAreaIDWithPagination(areaID, offset, limit)
+func (s *WaterQualityService) GetWaterQualityByAreaIDWithPagination(scope domain.TenantScope, areaID string, offset, limit int) ([]*domain.WaterQuality, error) {
+	return s.waterQualityRepo.FindByAreaIDWithPagination(scope, areaID, offset, limit)
 }
 
-func (s *WaterQualityService) CreateWaterQuality(waterQuality *domain.WaterQuality) error {
-	return s.waterQualityRepo.Create(waterQuality)
+func (s *WaterQualityService) CreateWaterQuality(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	return s.waterQualityRepo.Create(scope, waterQuality)
 }
 
-func (s *WaterQualityService) UpdateWaterQuality(waterQuality *domain.WaterQuality) error {
-	return s.waterQualityRepo.Update(waterQuality)
+func (s *WaterQualityService) UpdateWaterQuality(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	return s.waterQualityRepo.Update(scope, waterQuality)
 }
 
-func (s *WaterQualityService) DeleteWaterQuality(recordID string) error {
-	return s.waterQualityRepo.Delete(recordID)
+func (s *WaterQualityService) DeleteWaterQuality(scope domain.TenantScope, recordID string) error {
+	return s.waterQualityRepo.Delete(scope, recordID)
 }
 
-func (s *WaterQualityService) GetLatestWaterQualityByAreaID(areaID string) (*domain.WaterQuality, error) {
-	return s.waterQualityRepo.GetLatestByAreaID(areaID)
-}
\ No newline at end of file
+func (s *WaterQualityService) GetLatestWaterQualityByAreaID(scope domain.TenantScope, areaID string) (*domain.WaterQuality, error) {
+	return s.waterQualityRepo.GetLatestByAreaID(scope, areaID)
+}
@@ -11,6 +11,87 @@ type Config struct {
 	JWTSignatureKey string        `mapstructure:"signature_key"`
 	TokenExpiry     time.Duration `mapstructure:"token_expiry"`
 	SessionExpiry   time.Duration `mapstructure:"expiry"`
+	BlobDir         string        `mapstructure:"blob_dir"`
+
+	// OIDC 单点登录，oidc_issuer 为空时不启用
+	OIDCIssuer        string `mapstructure:"oidc_issuer"`
+	OIDCClientID      string `mapstructure:"oidc_client_id"`
+	OIDCClientSecret  string `mapstructure:"oidc_client_secret"`
+	OIDCRedirectURL   string `mapstructure:"oidc_redirect_url"`
+	OIDCScopes        string `mapstructure:"oidc_scopes"`
+	OIDCUsernameClaim string `mapstructure:"oidc_username_claim"`
+	OIDCGroupsClaim   string `mapstructure:"oidc_groups_claim"`
+	OIDCRoleMapping   string `mapstructure:"oidc_role_mapping"` // 例如 "idm-admins=admin,idm-researchers=researcher"
+	OIDCDefaultRole   string `mapstructure:"oidc_default_role"`
+
+	// 密码策略与重置
+	PasswordMinLength    int           `mapstructure:"password_min_length"`
+	BreachedPasswordFile string        `mapstructure:"breached_password_file"` // 为空时使用内置列表
+	PasswordResetTTL     time.Duration `mapstructure:"password_reset_ttl"`
+	PasswordResetURL     string        `mapstructure:"password_reset_url"`
+	// 每个用户名或邮箱、每个 IP 在 password_reset_window 内最多的自助重置请求次数，0 表示不限制
+	PasswordResetLimit   int           `mapstructure:"password_reset_limit"`
+	PasswordResetIPLimit int           `mapstructure:"password_reset_ip_limit"`
+	PasswordResetWindow  time.Duration `mapstructure:"password_reset_window"`
+	NotifyFile           string        `mapstructure:"notify_file"` // 开发环境下通知写入该文件
+
+	// 登录失败限制
+	LoginMaxFailures   int           `mapstructure:"login_max_failures"`
+	LoginLockout       time.Duration `mapstructure:"login_lockout"`
+	LoginBackoffBase   time.Duration `mapstructure:"login_backoff_base"`
+	LoginIPMaxFailures int           `mapstructure:"login_ip_max_failures"`
+	LoginFailureWindow time.Duration `mapstructure:"login_failure_window"`
+
+	// 两步验证
+	MFAIssuer        string `mapstructure:"mfa_issuer"`
+	MFARequiredRoles string `mapstructure:"mfa_required_roles"` // 逗号分隔，为空表示不强制
+
+	// 图像识别，recognition_backend 为 baidu（默认）、gallery 或 mock
+	RecognitionBackend string `mapstructure:"recognition_backend"`
+	// 在线识别不可用时改用的后端，目前只支持 gallery，为空表示不降级
+	RecognitionFallback string `mapstructure:"recognition_fallback"`
+	RecognitionLabels   string `mapstructure:"recognition_labels"` // mock 后端使用的标签，逗号分隔，为空时使用内置列表
+	BaiduAPIKey         string `mapstructure:"baidu_api_key"`
+	BaiduSecretKey      string `mapstructure:"baidu_secret_key"`
+
+	// 离线图库比对，参考图片来自物种图库
+	GalleryRefresh  time.Duration `mapstructure:"gallery_refresh"`
+	GalleryMinScore float64       `mapstructure:"gallery_min_score"`
+
+	// 图片预处理
+	ImageEnhanceSteps  string  `mapstructure:"image_enhance_steps"` // 默认执行的步骤，逗号分隔，为空时执行全部步骤
+	ImageClipLimit     float64 `mapstructure:"image_clip_limit"`
+	ImageMaxSize       int     `mapstructure:"image_max_size"`
+	RecognitionEnhance string  `mapstructure:"recognition_enhance"` // 识别请求未指定时的预处理：none、default 或步骤列表
+
+	// 批量识别，未配置时使用默认值
+	RecognitionWorkers     int           `mapstructure:"recognition_workers"`
+	RecognitionRateLimit   float64       `mapstructure:"recognition_rate_limit"` // 每秒最多调用识别后端的次数
+	RecognitionMaxAttempts int           `mapstructure:"recognition_max_attempts"`
+	RecognitionRetryDelay  time.Duration `mapstructure:"recognition_retry_delay"`
+
+	// 鱼类行为：浮头事件附近的水质记录溶解氧低于阈值时生成缺氧告警
+	BehaviorDOThreshold       float64       `mapstructure:"behavior_do_threshold"` // mg/L
+	BehaviorAlertConfidence   float64       `mapstructure:"behavior_alert_confidence"`
+	BehaviorCorrelationWindow time.Duration `mapstructure:"behavior_correlation_window"`
+	BehaviorAlertCooldown     time.Duration `mapstructure:"behavior_alert_cooldown"`
+
+	// 摄像头快照，摄像头未单独配置保留天数时使用 snapshot_retention_days
+	SnapshotRetentionDays int           `mapstructure:"snapshot_retention_days"`
+	SnapshotSweepInterval time.Duration `mapstructure:"snapshot_sweep_interval"`
+
+	// 智能问答，llm_provider 为 openai（OpenAI 兼容接口）或 mock；
+	// llm_api_key、llm_base_url、llm_model 也可以通过环境变量 LLM_API_KEY、LLM_BASE_URL、LLM_MODEL 设置
+	LLMProvider     string        `mapstructure:"llm_provider"`
+	LLMBaseURL      string        `mapstructure:"llm_base_url"`
+	LLMModel        string        `mapstructure:"llm_model"`
+	LLMAPIKey       string        `mapstructure:"llm_api_key"`
+	LLMTimeout      time.Duration `mapstructure:"llm_timeout"`
+	LLMMaxAttempts  int           `mapstructure:"llm_max_attempts"`
+	LLMRetryDelay   time.Duration `mapstructure:"llm_retry_delay"`
+	LLMSystemPrompt string        `mapstructure:"llm_system_prompt"`
+	LLMRateLimit    int           `mapstructure:"llm_rate_limit"` // 每个用户在 llm_rate_window 内的最多提问次数，0 表示不限制
+	LLMRateWindow   time.Duration `mapstructure:"llm_rate_window"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -23,8 +104,48 @@ func LoadConfig() (*Config, error) {
 			// Config file not found; set defaults or return an error
 			viper.SetDefault("url", "lmyx:1@tcp(127.0.0.1:3306)/idm?charset=utf8mb4&parseTime=True&loc=Local")
 			viper.SetDefault("signature_key", "secret-key")
-			viper.SetDefault("token_expiry", "24h")
+			viper.SetDefault("token_expiry", "15m")
 			viper.SetDefault("expiry", "72h")
+			viper.SetDefault("blob_dir", "./data/blobs")
+			viper.SetDefault("oidc_scopes", "openid profile email groups")
+			viper.SetDefault("oidc_default_role", "user")
+			viper.SetDefault("password_min_length", 8)
+			viper.SetDefault("password_reset_ttl", "30m")
+			viper.SetDefault("password_reset_url", "http://localhost:3000/reset-password")
+			viper.SetDefault("password_reset_limit", 3)
+			viper.SetDefault("password_reset_ip_limit", 20)
+			viper.SetDefault("password_reset_window", "1h")
+			viper.SetDefault("notify_file", "./data/notifications.log")
+			viper.SetDefault("login_max_failures", 5)
+			viper.SetDefault("login_lockout", "15m")
+			viper.SetDefault("login_backoff_base", "1s")
+			viper.SetDefault("login_ip_max_failures", 20)
+			viper.SetDefault("login_failure_window", "15m")
+			viper.SetDefault("mfa_issuer", "IDM")
+			viper.SetDefault("mfa_required_roles", "admin")
+			viper.SetDefault("recognition_backend", "baidu")
+			viper.SetDefault("recognition_fallback", "gallery")
+			viper.SetDefault("gallery_refresh", "1h")
+			viper.SetDefault("gallery_min_score", 0.5)
+			viper.SetDefault("image_clip_limit", 2.0)
+			viper.SetDefault("image_max_size", 1024)
+			viper.SetDefault("recognition_enhance", "none")
+			viper.SetDefault("recognition_workers", 4)
+			viper.SetDefault("recognition_rate_limit", 2)
+			viper.SetDefault("recognition_max_attempts", 3)
+			viper.SetDefault("recognition_retry_delay", "2s")
+			viper.SetDefault("behavior_do_threshold", 3.0)
+			viper.SetDefault("behavior_alert_confidence", 0.6)
+			viper.SetDefault("behavior_correlation_window", "2h")
+			viper.SetDefault("behavior_alert_cooldown", "1h")
+			viper.SetDefault("snapshot_retention_days", 7)
+			viper.SetDefault("snapshot_sweep_interval", "1h")
+			viper.SetDefault("llm_provider", "openai")
+			viper.SetDefault("llm_timeout", "60s")
+			viper.SetDefault("llm_max_attempts", 3)
+			viper.SetDefault("llm_retry_delay", "1s")
+			viper.SetDefault("llm_rate_limit", 30)
+			viper.SetDefault("llm_rate_window", "1h")
 			// You might want to log this and continue with defaults,
 			// or return the error if a config file is strictly required.
 			println("Config file not found, using default values.")
@@ -33,6 +154,11 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	// 密钥不应写入配置文件，环境变量优先于配置文件
+	_ = viper.BindEnv("llm_api_key", "LLM_API_KEY", "DEEPSEEK_API_KEY")
+	_ = viper.BindEnv("llm_base_url", "LLM_BASE_URL")
+	_ = viper.BindEnv("llm_model", "LLM_MODEL")
+
 	var config Config
 	err := viper.Unmarshal(&config)
 	if err != nil {
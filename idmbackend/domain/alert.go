@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// AlertKind 告警类型
+type AlertKind string
+
+const (
+	// AlertHypoxia 浮头行为与低溶解氧同时出现，疑似缺氧
+	AlertHypoxia AlertKind = "hypoxia"
+)
+
+// AlertStatus 告警状态
+type AlertStatus string
+
+const (
+	AlertOpen         AlertStatus = "open"
+	AlertAcknowledged AlertStatus = "acknowledged"
+)
+
+// Alert 需要值守人员处理的告警。同一区域同类告警未确认时，新的触发事件累加到已有告警上
+type Alert struct {
+	ID              uint        `gorm:"primaryKey" json:"id"`
+	OrgID           uint        `gorm:"index" json:"org_id"`
+	AreaID          string      `gorm:"type:varchar(64);index" json:"area_id"`
+	CameraID        string      `gorm:"type:varchar(64)" json:"camera_id,omitempty"`
+	Kind            AlertKind   `gorm:"type:varchar(32);index" json:"kind"`
+	Status          AlertStatus `gorm:"type:varchar(16);index" json:"status"`
+	Message         string      `gorm:"type:varchar(255)" json:"message"`
+	EventID         uint        `json:"event_id"` // 首次触发告警的行为事件
+	EventCount      int         `json:"event_count"`
+	LastEventAt     time.Time   `json:"last_event_at"`
+	WaterQualityID  string      `gorm:"type:varchar(64)" json:"water_quality_record_id,omitempty"`
+	DissolvedOxygen *float64    `json:"dissolved_oxygen,omitempty"`
+	AcknowledgedBy  uint        `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt  *time.Time  `json:"acknowledged_at,omitempty"`
+	Note            string      `gorm:"type:varchar(255)" json:"note,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// AlertFilter 告警查询条件，零值字段不参与过滤
+type AlertFilter struct {
+	AreaID  string
+	AreaIDs []string // API 密钥限定的区域，为空表示不限
+	Kind    AlertKind
+	Status  AlertStatus
+	Offset  int
+	Limit   int
+}
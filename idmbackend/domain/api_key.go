@@ -0,0 +1,88 @@
+package domain
+
+import "time"
+
+// APIKey 设备和脚本使用的访问密钥。明文只在创建时返回一次，数据库中仅保存 SHA-256 摘要
+type APIKey struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	OrgID       uint         `gorm:"index" json:"org_id"`
+	Name        string       `gorm:"not null" json:"name"`
+	Prefix      string       `gorm:"type:varchar(16);index;not null" json:"prefix"` // 明文前缀，便于识别密钥
+	KeyHash     string       `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Permissions []Permission `gorm:"type:text;serializer:json" json:"permissions"`
+	AreaIDs     []string     `gorm:"type:text;serializer:json" json:"area_ids"`   // 为空表示不限区域
+	DeviceIDs   []string     `gorm:"type:text;serializer:json" json:"device_ids"` // 为空表示不限设备
+	CreatedBy   uint         `gorm:"index" json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ExpiresAt   *time.Time   `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at"`
+	LastUsedIP  string       `gorm:"type:varchar(64)" json:"last_used_ip"`
+	RevokedAt   *time.Time   `json:"revoked_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsActive 未吊销且未过期
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// PrincipalKind 请求主体的类型
+type PrincipalKind string
+
+const (
+	PrincipalUser   PrincipalKind = "user"
+	PrincipalAPIKey PrincipalKind = "api_key"
+)
+
+// Principal 认证中间件写入上下文的请求主体。用户通过角色获得权限，API 密钥使用自身的权限和范围
+type Principal struct {
+	Kind          PrincipalKind `json:"kind"`
+	UserID        uint          `json:"user_id,omitempty"`
+	Role          Role          `json:"role,omitempty"`
+	SessionID     string        `json:"-"`
+	OrgID         uint          `json:"org_id"`
+	PlatformAdmin bool          `json:"platform_admin,omitempty"` // 全局管理员，可以切换到任意组织
+	MFA           bool          `json:"mfa,omitempty"`            // 用户会话已通过两步验证
+	APIKeyID      uint          `json:"api_key_id,omitempty"`
+	Name          string        `json:"name,omitempty"` // API 密钥名称或用户名
+	Permissions   []Permission  `json:"permissions,omitempty"`
+	AreaIDs       []string      `json:"area_ids,omitempty"`
+	DeviceIDs     []string      `json:"device_ids,omitempty"`
+}
+
+// Scope 请求主体当前所在组织的查询范围
+func (p *Principal) Scope() TenantScope {
+	return TenantScope{OrgID: p.OrgID}
+}
+
+// HasScopedPermission API 密钥主体是否拥有权限，用户主体的权限由角色决定
+func (p *Principal) HasScopedPermission(want Permission) bool {
+	for _, held := range p.Permissions {
+		if held.Grants(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsArea 主体是否可以访问该区域，用户不受区域范围限制
+func (p *Principal) AllowsArea(areaID string) bool {
+	return p.Kind != PrincipalAPIKey || len(p.AreaIDs) == 0 || contains(p.AreaIDs, areaID)
+}
+
+// AllowsDevice 主体是否可以代表该设备提交数据
+func (p *Principal) AllowsDevice(deviceID string) bool {
+	return p.Kind != PrincipalAPIKey || len(p.DeviceIDs) == 0 || contains(p.DeviceIDs, deviceID)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "testing"
+
+func TestPrincipalScopes(t *testing.T) {
+	key := &Principal{Kind: PrincipalAPIKey, AreaIDs: []string{"pond-a"}, DeviceIDs: []string{"probe-1"}}
+	unscoped := &Principal{Kind: PrincipalAPIKey}
+	user := &Principal{Kind: PrincipalUser}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		area      string
+		device    string
+		ok        bool
+	}{
+		{"key within scope", key, "pond-a", "probe-1", true},
+		{"key outside area", key, "pond-b", "probe-1", false},
+		{"key outside device", key, "pond-a", "probe-2", false},
+		{"key without scope", unscoped, "pond-b", "probe-2", true},
+		{"user is not limited", user, "pond-b", "probe-2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.AllowsArea(tt.area) && tt.principal.AllowsDevice(tt.device); got != tt.ok {
+				t.Errorf("allowed = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
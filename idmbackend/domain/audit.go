@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditOutcome 审计事件的结果
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+	AuditDenied  AuditOutcome = "denied" // 未认证或权限不足
+)
+
+// 审计动作，管理接口的请求以 "admin:<方法> <路由>" 记录
+const (
+	AuditLogin         = "auth.login"
+	AuditLoginFailed   = "auth.login_failed"
+	AuditLoginBlocked  = "auth.login_blocked"
+	AuditLoginDisabled = "auth.login_disabled"
+	AuditAccountLocked = "auth.account_locked"
+	AuditAccountUnlock = "auth.account_unlocked"
+	AuditLogout        = "auth.logout"
+	AuditLogoutAll     = "auth.logout_all"
+	AuditRegister      = "user.register"
+	AuditProfileUpdate = "user.profile_update"
+	AuditAvatarUpdate  = "user.avatar_update"
+)
+
+// AuditEntry 只追加的审计记录。每条记录的 Hash 覆盖自身内容和上一条记录的 Hash，
+// 修改或删除任一记录都会使其后的链校验失败。
+type AuditEntry struct {
+	ID         uint         `gorm:"primaryKey" json:"id"`
+	OrgID      uint         `gorm:"index" json:"org_id"`
+	ActorKind  string       `gorm:"type:varchar(16)" json:"actor_kind"` // user、api_key 或空（匿名）
+	ActorID    uint         `gorm:"index" json:"actor_id"`
+	ActorName  string       `gorm:"type:varchar(128)" json:"actor_name"`
+	Action     string       `gorm:"type:varchar(128);index" json:"action"`
+	TargetType string       `gorm:"type:varchar(32)" json:"target_type"`
+	TargetID   string       `gorm:"type:varchar(64);index" json:"target_id"`
+	IP         string       `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string       `gorm:"type:varchar(255)" json:"user_agent"`
+	Outcome    AuditOutcome `gorm:"type:varchar(16);index" json:"outcome"`
+	Detail     string       `gorm:"type:varchar(512)" json:"detail"`
+	CreatedAt  time.Time    `gorm:"index" json:"created_at"`
+	PrevHash   string       `gorm:"type:varchar(64);uniqueIndex" json:"prev_hash"` // 唯一约束防止并发写入使链分叉
+	Hash       string       `gorm:"type:varchar(64);uniqueIndex" json:"hash"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// Seal 接在 prevHash 之后并计算本条记录的 Hash，时间精确到毫秒以与数据库保存的值一致
+func (e *AuditEntry) Seal(prevHash string) {
+	e.CreatedAt = e.CreatedAt.Truncate(time.Millisecond)
+	e.PrevHash = prevHash
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash 按固定字段顺序计算记录摘要
+func (e *AuditEntry) ComputeHash() string {
+	fields := []string{
+		e.PrevHash,
+		strconv.FormatUint(uint64(e.OrgID), 10),
+		e.ActorKind,
+		strconv.FormatUint(uint64(e.ActorID), 10),
+		e.ActorName,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.IP,
+		e.UserAgent,
+		string(e.Outcome),
+		e.Detail,
+		strconv.FormatInt(e.CreatedAt.UnixMilli(), 10),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter 审计日志查询条件，零值字段不参与过滤
+type AuditFilter struct {
+	OrgID      *uint
+	ActorID    uint
+	Action     string // 以该前缀匹配
+	TargetType string
+	TargetID   string
+	Outcome    AuditOutcome
+	From       *time.Time
+	To         *time.Time
+	Offset     int
+	Limit      int
+}
+
+// AuditVerification 哈希链校验结果，BrokenID 为第一条校验失败的记录
+type AuditVerification struct {
+	Valid    bool `json:"valid"`
+	Checked  int  `json:"checked"`
+	BrokenID uint `json:"broken_id,omitempty"`
+}
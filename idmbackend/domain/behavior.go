@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// BehaviorType 鱼类行为类型
+type BehaviorType string
+
+const (
+	BehaviorFeeding          BehaviorType = "feeding"           // 觅食
+	BehaviorSchooling        BehaviorType = "schooling"         // 群游
+	BehaviorSurfaceGasping   BehaviorType = "surface_gasping"   // 浮头，常见于缺氧
+	BehaviorAbnormalSwimming BehaviorType = "abnormal_swimming" // 异常游动
+	BehaviorNormalSwimming   BehaviorType = "normal_swimming"   // 正常游动
+	BehaviorResting          BehaviorType = "resting"           // 休息
+)
+
+// behaviorAliases 前端视频分析使用的中文行为名称
+var behaviorAliases = map[string]BehaviorType{
+	"觅食":   BehaviorFeeding,
+	"摄食":   BehaviorFeeding,
+	"群游":   BehaviorSchooling,
+	"浮头":   BehaviorSurfaceGasping,
+	"异常游动": BehaviorAbnormalSwimming,
+	"正常游动": BehaviorNormalSwimming,
+	"休息":   BehaviorResting,
+}
+
+// ParseBehaviorType 解析行为类型，同时接受英文标识和中文名称
+func ParseBehaviorType(raw string) (BehaviorType, bool) {
+	raw = strings.TrimSpace(raw)
+	if t, ok := behaviorAliases[raw]; ok {
+		return t, true
+	}
+	switch t := BehaviorType(strings.ToLower(raw)); t {
+	case BehaviorFeeding, BehaviorSchooling, BehaviorSurfaceGasping, BehaviorAbnormalSwimming, BehaviorNormalSwimming, BehaviorResting:
+		return t, true
+	}
+	return "", false
+}
+
+// BehaviorEvent 摄像头或视频分析检测到的一次鱼类行为，AreaID 与水质数据的 area_id 对应
+type BehaviorEvent struct {
+	ID         uint         `gorm:"primaryKey" json:"id"`
+	OrgID      uint         `gorm:"index" json:"org_id"`
+	AreaID     string       `gorm:"type:varchar(64);index:idx_behavior_area_time,priority:1" json:"area_id"`
+	CameraID   string       `gorm:"type:varchar(64);index" json:"camera_id,omitempty"`
+	VideoID    *uint        `gorm:"index" json:"video_id,omitempty"`
+	Timestamp  *float64     `gorm:"column:time_offset" json:"timestamp,omitempty"` // 距视频开始的秒数
+	Type       BehaviorType `gorm:"type:varchar(32);index" json:"type"`
+	Confidence float64      `json:"confidence"`
+	FishCount  int          `json:"fish_count"`
+	OccurredAt time.Time    `gorm:"index:idx_behavior_area_time,priority:2" json:"occurred_at"`
+	Duration   float64      `json:"duration"` // 持续秒数，未知时为 0
+	Source     string       `gorm:"type:varchar(32)" json:"source"`
+	ReportedBy uint         `json:"reported_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// BehaviorFilter 行为事件查询条件，零值字段不参与过滤
+type BehaviorFilter struct {
+	AreaID        string
+	AreaIDs       []string // API 密钥限定的区域，为空表示不限
+	CameraID      string
+	Type          BehaviorType
+	MinConfidence float64
+	From          *time.Time
+	To            *time.Time
+	Offset        int
+	Limit         int
+}
+
+// BehaviorBucket 时间窗口内某种行为的统计
+type BehaviorBucket struct {
+	Start         time.Time    `json:"start"`
+	Type          BehaviorType `json:"type"`
+	Count         int64        `json:"count"`
+	AvgConfidence float64      `json:"avg_confidence"`
+	MaxFishCount  int          `json:"max_fish_count"`
+}
+
+// BehaviorCorrelationPoint 同一区域在一个时间窗口内的行为次数与水质均值，窗口内没有水质数据时水质字段为空
+type BehaviorCorrelationPoint struct {
+	Start           time.Time              `json:"start"`
+	End             time.Time              `json:"end"`
+	Behaviors       map[BehaviorType]int64 `json:"behaviors"`
+	Readings        int                    `json:"readings"`
+	DissolvedOxygen *float64               `json:"dissolved_oxygen"`
+	Temperature     *float64               `json:"temperature"`
+	PHValue         *float64               `json:"ph_value"`
+}
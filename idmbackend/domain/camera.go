@@ -0,0 +1,90 @@
+package domain
+
+import "time"
+
+// CameraType 摄像头类型
+type CameraType string
+
+const (
+	CameraUnderwater CameraType = "underwater" // 水下固定摄像头
+	CameraSurface    CameraType = "surface"    // 水面固定摄像头
+	CameraPTZ        CameraType = "ptz"        // 云台摄像头
+)
+
+func (t CameraType) IsValid() bool {
+	switch t {
+	case CameraUnderwater, CameraSurface, CameraPTZ:
+		return true
+	}
+	return false
+}
+
+// CameraStatus 摄像头的管理状态，停用的摄像头不再接收快照
+type CameraStatus string
+
+const (
+	CameraActive      CameraStatus = "active"
+	CameraMaintenance CameraStatus = "maintenance"
+	CameraDisabled    CameraStatus = "disabled"
+)
+
+func (s CameraStatus) IsValid() bool {
+	switch s {
+	case CameraActive, CameraMaintenance, CameraDisabled:
+		return true
+	}
+	return false
+}
+
+// Camera 监测摄像头。AreaID 与水质数据的 area_id 对应，DeviceID 为设备自身的编号，用于 API 密钥的设备范围校验
+type Camera struct {
+	ID               uint         `gorm:"primaryKey" json:"id"`
+	OrgID            uint         `gorm:"index" json:"org_id"`
+	Name             string       `gorm:"type:varchar(128);not null" json:"name"`
+	AreaID           string       `gorm:"type:varchar(64);index" json:"area_id"`
+	DeviceID         string       `gorm:"type:varchar(64);index" json:"device_id,omitempty"`
+	Type             CameraType   `gorm:"type:varchar(16)" json:"type"`
+	StreamURL        string       `gorm:"type:varchar(512)" json:"stream_url,omitempty"`
+	Latitude         *float64     `json:"latitude"`
+	Longitude        *float64     `json:"longitude"`
+	Depth            *float64     `json:"depth"` // 安装水深，米
+	Status           CameraStatus `gorm:"type:varchar(16);index" json:"status"`
+	SnapshotInterval int          `json:"snapshot_interval"` // 设备上传快照的间隔秒数
+	RetentionDays    int          `json:"retention_days"`    // 快照保留天数，0 表示使用系统默认值
+	AutoRecognize    bool         `json:"auto_recognize"`    // 是否将快照自动提交识别
+	LastSnapshotAt   *time.Time   `json:"last_snapshot_at"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// CameraFilter 摄像头查询条件，零值字段不参与过滤
+type CameraFilter struct {
+	AreaID  string
+	AreaIDs []string // API 密钥限定的区域，为空表示不限
+	Status  CameraStatus
+	Offset  int
+	Limit   int
+}
+
+// Snapshot 摄像头定时上传的一张 JPEG 快照，超过保留期后连同图片一起删除
+type Snapshot struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	OrgID            uint      `gorm:"index" json:"org_id"`
+	CameraID         uint      `gorm:"index:idx_snapshot_camera_time,priority:1" json:"camera_id"`
+	CapturedAt       time.Time `gorm:"index:idx_snapshot_camera_time,priority:2" json:"captured_at"`
+	ImageKey         string    `gorm:"type:varchar(128)" json:"-"`
+	Size             int       `json:"size"`
+	Width            int       `json:"width"`
+	Height           int       `json:"height"`
+	RecognitionJobID *uint     `json:"recognition_job_id,omitempty"` // 自动识别时提交的批量识别任务
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// SnapshotFilter 快照查询条件。Step 大于 0 时每个 Step 时段只取最早的一张，用于生成延时画面
+type SnapshotFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Step   time.Duration
+	Offset int
+	Limit  int
+}
@@ -0,0 +1,83 @@
+package domain
+
+import "time"
+
+// DatasetSplit 数据集划分
+type DatasetSplit string
+
+const (
+	SplitNone  DatasetSplit = "" // 尚未划分
+	SplitTrain DatasetSplit = "train"
+	SplitVal   DatasetSplit = "val"
+	SplitTest  DatasetSplit = "test"
+)
+
+// IsValid 是否为合法的划分，未划分也是合法值
+func (s DatasetSplit) IsValid() bool {
+	switch s {
+	case SplitNone, SplitTrain, SplitVal, SplitTest:
+		return true
+	}
+	return false
+}
+
+// Dataset 目标检测数据集，由带标注框的帧组成，用于训练水下鱼类检测模型
+type Dataset struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"`
+	Name        string    `gorm:"type:varchar(128);not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DatasetCategory 数据集中的目标类别，名称来自标注框的 class，可以映射到物种库中的物种
+type DatasetCategory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"index" json:"org_id"`
+	DatasetID uint      `gorm:"uniqueIndex:idx_dataset_category,priority:1" json:"dataset_id"`
+	Name      string    `gorm:"type:varchar(128);uniqueIndex:idx_dataset_category,priority:2" json:"name"`
+	SpeciesID *uint     `gorm:"index" json:"species_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DatasetFrame 数据集中的一帧：一张上传的图片，或视频某一时刻的画面。
+// 只关联视频而没有图片的帧在导出时只有标注文件，图片需要按时间从视频中截取
+type DatasetFrame struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	OrgID     uint         `gorm:"index" json:"org_id"`
+	DatasetID uint         `gorm:"index:idx_frame_dataset_split,priority:1" json:"dataset_id"`
+	Split     DatasetSplit `gorm:"type:varchar(8);index:idx_frame_dataset_split,priority:2" json:"split"`
+	FileName  string       `gorm:"type:varchar(255)" json:"file_name"` // 上传或导入时的原始文件名
+	ImageKey  string       `gorm:"type:varchar(128)" json:"-"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	VideoID   *uint        `gorm:"index" json:"video_id,omitempty"`
+	Timestamp *float64     `gorm:"column:time_offset" json:"timestamp,omitempty"` // 距视频开始的秒数
+	Boxes     []Detection  `gorm:"type:text;serializer:json" json:"boxes"`
+	Source    string       `gorm:"type:varchar(32)" json:"source"` // 例如 manual、coco-ssd、import:yolo
+	CreatedBy uint         `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// HasImage 帧是否保存了图片
+func (f *DatasetFrame) HasImage() bool {
+	return f.ImageKey != ""
+}
+
+// FrameFilter 帧查询条件，零值字段不参与过滤
+type FrameFilter struct {
+	Split   *DatasetSplit // 指向 SplitNone 时只查询尚未划分的帧
+	VideoID uint
+	Offset  int
+	Limit   int
+}
+
+// SplitCount 数据集每个划分中的帧数
+type SplitCount struct {
+	Split  DatasetSplit `json:"split"`
+	Frames int64        `json:"frames"`
+}
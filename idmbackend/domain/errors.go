@@ -3,13 +3,64 @@ package domain
 import "errors"
 
 var (
-	ErrUserAlreadyExists  = errors.New("user with this username already exists")
-	ErrInvalidCredentials = errors.New("invalid username or password")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidToken       = errors.New("invalid token")
-	ErrInvalidTokenClaims = errors.New("invalid token claims")
-	ErrUnauthorized       = errors.New("unauthorized")
-	ErrForbidden          = errors.New("forbidden")
-	ErrInvalidSSOToken    = errors.New("invalid SSO token")
+	ErrUserAlreadyExists   = errors.New("user with this username already exists")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrInvalidTokenClaims  = errors.New("invalid token claims")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrForbidden           = errors.New("forbidden")
+	ErrInvalidSSOToken     = errors.New("invalid SSO token")
+	ErrSSODisabled         = errors.New("single sign-on is not configured")
+	ErrInvalidSSOState     = errors.New("invalid or expired SSO state")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrSpeciesNotFound     = errors.New("species not found")
+	ErrTaxonNotFound       = errors.New("taxon not found")
+	ErrSpeciesNameNotFound = errors.New("species name not found")
+	ErrInvalidTaxonRank    = errors.New("invalid taxon rank")
+	ErrImageNotFound       = errors.New("image not found")
+	ErrDuplicateImage      = errors.New("image already exists")
+	ErrBlobNotFound        = errors.New("blob not found")
+	ErrObservationNotFound = errors.New("observation not found")
+	ErrSessionRevoked      = errors.New("session revoked or expired")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrRoleInUse           = errors.New("role is assigned to users")
+	ErrBuiltInRole         = errors.New("built-in roles cannot be modified")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("invalid, expired or revoked api key")
+	ErrWeakPassword        = errors.New("password does not meet policy")
+	ErrIncorrectPassword   = errors.New("current password is incorrect")
+	ErrInvalidResetToken   = errors.New("invalid, expired or used password reset token")
+	ErrTooManyAttempts     = errors.New("too many failed login attempts")
+	ErrMFARequired         = errors.New("multi-factor authentication required")
+	ErrInvalidMFACode      = errors.New("invalid verification code")
+	ErrInvalidMFAToken     = errors.New("invalid or expired mfa token")
+	ErrMFAAlreadyEnabled   = errors.New("mfa already enabled")
+	ErrMFANotEnabled       = errors.New("mfa not enabled")
+	ErrOrgNotFound         = errors.New("organization not found")
+	ErrNotOrgMember        = errors.New("user is not a member of the organization")
+	ErrAccountDisabled     = errors.New("account disabled")
+	ErrLastAdmin           = errors.New("cannot remove the last admin")
+	ErrRecognitionFailed   = errors.New("recognition backend failed")
+	ErrNothingRecognized   = errors.New("nothing recognized in image")
+	ErrRecognitionNotFound = errors.New("recognition not found")
+	ErrAlreadyReviewed     = errors.New("recognition already reviewed")
+	ErrJobNotFound         = errors.New("recognition job not found")
+	ErrVideoNotFound       = errors.New("video not found")
+	ErrAnnotationNotFound  = errors.New("annotation not found")
+	ErrUnsupportedMedia    = errors.New("unsupported media type")
+	ErrDatasetNotFound     = errors.New("dataset not found")
+	ErrFrameNotFound       = errors.New("dataset frame not found")
+	ErrCategoryNotFound    = errors.New("dataset category not found")
+	ErrAlertNotFound       = errors.New("alert not found")
+	ErrAlertAcknowledged   = errors.New("alert already acknowledged")
+	ErrCameraNotFound      = errors.New("camera not found")
+	ErrCameraDisabled      = errors.New("camera disabled")
+	ErrSnapshotNotFound    = errors.New("snapshot not found")
+	ErrLLMNotConfigured    = errors.New("language model not configured")
+	ErrLLMFailed           = errors.New("language model backend failed")
+	ErrAuditChainConflict  = errors.New("audit chain head changed concurrently")
 	// Add more domain-specific errors as needed
 )
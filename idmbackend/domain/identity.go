@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// ExternalIdentity 外部身份提供方（OIDC）验证后的用户信息
+type ExternalIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+}
+
+// UserIdentity 外部身份与本地用户的绑定，按 Issuer + Subject 唯一
+type UserIdentity struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index;not null" json:"user_id"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identity" json:"issuer"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identity" json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// LoginThrottle 登录失败计数，Key 为 "account:<用户名>" 或 "ip:<地址>"
+type LoginThrottle struct {
+	Key           string `gorm:"type:varchar(191);primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  *time.Time
+	Locked        bool // 达到失败上限后的临时锁定，区别于指数退避
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// RetryAfter 距离允许再次尝试的时间，未被阻止时返回 0
+func (t *LoginThrottle) RetryAfter(now time.Time) time.Duration {
+	if t == nil || t.BlockedUntil == nil || !now.Before(*t.BlockedUntil) {
+		return 0
+	}
+	return t.BlockedUntil.Sub(now)
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// TOTPEnrollment 用户的 TOTP (RFC 6238) 密钥。ConfirmedAt 为空表示已生成密钥但尚未用验证码确认
+type TOTPEnrollment struct {
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Secret       string `gorm:"type:varchar(64);not null" json:"-"` // Base32 编码
+	ConfirmedAt  *time.Time
+	LastUsedStep int64 // 最近一次通过验证的时间步，同一验证码不能重复使用
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (TOTPEnrollment) TableName() string {
+	return "user_totp"
+}
+
+// Enabled 密钥已确认，登录时需要验证码
+func (t *TOTPEnrollment) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// RecoveryCode 一次性恢复码，丢失验证器时代替验证码使用，仅保存 SHA-256 摘要
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"type:varchar(64);uniqueIndex;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge 已通过第一步认证（密码或单点登录）、等待提交验证码的登录，仅保存 MFA 令牌的摘要。
+// 保存在数据库中，服务重启或多实例部署时仍然有效
+type MFAChallenge struct {
+	TokenHash string    `gorm:"type:varchar(64);primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	Username  string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
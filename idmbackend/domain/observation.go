@@ -0,0 +1,78 @@
+package domain
+
+import "time"
+
+// ObservationMethod 观测记录的获取方式
+type ObservationMethod string
+
+const (
+	MethodVisual      ObservationMethod = "visual"      // 目视观察
+	MethodNet         ObservationMethod = "net"         // 网捕
+	MethodTrap        ObservationMethod = "trap"        // 笼捕
+	MethodAngling     ObservationMethod = "angling"     // 垂钓
+	MethodCamera      ObservationMethod = "camera"      // 水下摄像
+	MethodRecognition ObservationMethod = "recognition" // 图像识别确认
+)
+
+// IsValid 判断是否为支持的观测方式
+func (m ObservationMethod) IsValid() bool {
+	switch m {
+	case MethodVisual, MethodNet, MethodTrap, MethodAngling, MethodCamera, MethodRecognition:
+		return true
+	}
+	return false
+}
+
+// Observation 野外观测或调查捕获记录
+type Observation struct {
+	ID               uint              `gorm:"column:id;primaryKey;autoIncrement" json:"observation_id"`
+	SpeciesID        uint              `gorm:"column:species_id;not null;index" json:"species_id"`
+	AreaID           string            `gorm:"column:area_id;type:varchar(64);not null;index" json:"area_id"`
+	OrgID            uint              `gorm:"column:org_id;index" json:"org_id"`
+	ObservedAt       time.Time         `gorm:"column:observed_at;not null;index" json:"observed_at"`
+	Count            int               `gorm:"column:count;not null;default:1" json:"count"`
+	LengthCM         *float64          `gorm:"column:length_cm" json:"length_cm"`
+	WeightG          *float64          `gorm:"column:weight_g" json:"weight_g"`
+	ObserverID       uint              `gorm:"column:observer_id;index" json:"observer_id"`
+	PhotoKey         string            `gorm:"column:photo_key" json:"-"`
+	Method           ObservationMethod `gorm:"column:method;type:varchar(16);not null" json:"method"`
+	RecognitionScore *float64          `gorm:"column:recognition_score" json:"recognition_score,omitempty"`
+	Notes            string            `gorm:"column:notes;type:text" json:"notes"`
+	CreatedAt        time.Time         `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt        time.Time         `gorm:"column:updated_at" json:"updated_at"`
+
+	Species *Species `gorm:"foreignKey:SpeciesID" json:"species,omitempty"`
+}
+
+// HasPhoto 是否附带照片
+func (o *Observation) HasPhoto() bool {
+	return o.PhotoKey != ""
+}
+
+// ObservationFilter 观测记录查询条件，零值字段不参与过滤
+type ObservationFilter struct {
+	SpeciesID uint
+	AreaID    string
+	AreaIDs   []string // API 密钥限定的区域，为空表示不限
+	From      *time.Time
+	To        *time.Time
+	Offset    int
+	Limit     int
+}
+
+// SpeciesCount 某区域内某物种的累计个体数
+type SpeciesCount struct {
+	SpeciesID uint  `json:"species_id"`
+	Count     int64 `json:"count"`
+}
+
+// AreaDiversity 区域物种多样性指标
+type AreaDiversity struct {
+	AreaID           string         `json:"area_id"`
+	Observations     int64          `json:"observations"`
+	Individuals      int64          `json:"individuals"`
+	SpeciesRichness  int            `json:"species_richness"`
+	ShannonIndex     float64        `json:"shannon_index"`
+	ShannonEvenness  float64        `json:"shannon_evenness"`
+	SpeciesBreakdown []SpeciesCount `json:"species"`
+}
@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+// DefaultOrgSlug 升级前的数据和新注册用户归属的默认组织
+const DefaultOrgSlug = "default"
+
+// OrgKind 组织类型
+type OrgKind string
+
+const (
+	OrgCompany OrgKind = "company"
+	OrgFarm    OrgKind = "farm"
+	OrgAgency  OrgKind = "agency"
+)
+
+// IsValid 判断是否为支持的组织类型
+func (k OrgKind) IsValid() bool {
+	switch k {
+	case OrgCompany, OrgFarm, OrgAgency:
+		return true
+	}
+	return false
+}
+
+// Organization 租户。站点、水质数据、观测记录、设备密钥等按组织隔离，物种和分类目录全局共享
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Slug      string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"slug"`
+	Name      string    `gorm:"not null" json:"name"`
+	Kind      OrgKind   `gorm:"type:varchar(16);not null" json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// Membership 用户在组织中的成员身份，Role 为该用户在此组织内的角色
+type Membership struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"uniqueIndex:idx_membership;not null" json:"org_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_membership;index;not null" json:"user_id"`
+	Role      Role      `gorm:"type:varchar(32);not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Organization *Organization `gorm:"foreignKey:OrgID" json:"organization,omitempty"`
+	User         *User         `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TenantScope 仓储查询的租户范围，所有按组织隔离的查询都必须带上
+type TenantScope struct {
+	OrgID uint
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// ResetReason 密码重置令牌的来源
+type ResetReason string
+
+const (
+	ResetSelfService ResetReason = "self_service"
+	ResetByAdmin     ResetReason = "admin"
+)
+
+// PasswordResetToken 一次性密码重置令牌，仅保存 SHA-256 摘要
+type PasswordResetToken struct {
+	ID        uint        `gorm:"primaryKey"`
+	UserID    uint        `gorm:"index;not null"`
+	TokenHash string      `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Reason    ResetReason `gorm:"type:varchar(16)"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// IsUsable 未使用且未过期
+func (t *PasswordResetToken) IsUsable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// Notification 通过通知渠道发送给用户的消息
+type Notification struct {
+	To      string // 邮箱，未设置邮箱时为用户名
+	Subject string
+	Body    string
+}
@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Permission 形如 "资源:操作" 的权限标识
+type Permission string
+
+const (
+	PermAll Permission = "*"
+
+	PermSpeciesWrite      Permission = "species:write"
+	PermSpeciesAdmin      Permission = "species:admin"
+	PermTaxonomyWrite     Permission = "taxonomy:write"
+	PermWaterQualityRead  Permission = "water_quality:read"
+	PermWaterQualityWrite Permission = "water_quality:write"
+	PermObservationsWrite Permission = "observations:write"
+	PermAlertsAck         Permission = "alerts:ack"
+	PermDevicesManage     Permission = "devices:manage"
+	PermDatabaseSchema    Permission = "database:schema"
+	PermDashboardView     Permission = "dashboard:view"
+	PermUsersManage       Permission = "users:manage"
+	PermRolesManage       Permission = "roles:manage"
+	PermAPIKeysManage     Permission = "api_keys:manage"
+	PermAuditView         Permission = "audit:view"
+	PermRecognitionReview Permission = "recognitions:review"
+	PermVideosWrite       Permission = "videos:write"
+	PermDatasetsWrite     Permission = "datasets:write"
+	PermBehaviorsWrite    Permission = "behaviors:write"
+	PermSnapshotsWrite    Permission = "snapshots:write"
+
+	PermObservationsRead  Permission = "observations:read"
+	PermRecognitionsRead  Permission = "recognitions:read"
+	PermRecognitionsWrite Permission = "recognitions:write"
+	PermVideosRead        Permission = "videos:read"
+	PermDatasetsRead      Permission = "datasets:read"
+	PermBehaviorsRead     Permission = "behaviors:read"
+	PermAlertsRead        Permission = "alerts:read"
+	PermCamerasRead       Permission = "cameras:read"
+)
+
+// Permissions 系统定义的全部权限及说明
+var Permissions = map[Permission]string{
+	PermSpeciesWrite:      "创建和编辑物种、别名和图片",
+	PermSpeciesAdmin:      "批量导入物种，删除物种别名和图片",
+	PermTaxonomyWrite:     "维护分类学层级",
+	PermWaterQualityRead:  "查询水质数据",
+	PermWaterQualityWrite: "录入、修改和删除水质数据",
+	PermObservationsWrite: "提交和维护野外观测记录",
+	PermAlertsAck:         "确认告警",
+	PermDevicesManage:     "管理监测设备",
+	PermDatabaseSchema:    "查看数据库结构",
+	PermDashboardView:     "访问管理员仪表板",
+	PermUsersManage:       "管理用户",
+	PermRolesManage:       "管理角色与权限",
+	PermAPIKeysManage:     "管理设备和脚本使用的 API 密钥",
+	PermAuditView:         "查看和导出审计日志",
+	PermRecognitionReview: "审核识别标注并导出训练数据集",
+	PermVideosWrite:       "上传和维护视频，保存视频标注",
+	PermDatasetsWrite:     "维护检测数据集的标注框、类别映射和数据集划分",
+	PermBehaviorsWrite:    "上报摄像头和视频分析得到的鱼类行为事件",
+	PermSnapshotsWrite:    "摄像头上传定时快照",
+	PermObservationsRead:  "查询野外观测记录和照片",
+	PermRecognitionsRead:  "查询识别历史、识别图片和批量识别任务",
+	PermRecognitionsWrite: "提交鱼类识别、批量识别任务和图片预处理，反馈识别结果",
+	PermVideosRead:        "查询和播放视频及其标注",
+	PermDatasetsRead:      "查询和导出检测数据集",
+	PermBehaviorsRead:     "查询鱼类行为事件及统计分析",
+	PermAlertsRead:        "查询告警",
+	PermCamerasRead:       "查询摄像头及其快照",
+}
+
+// OrgReadPermissions 组织内数据的查询权限。
+// 这些权限引入之前登录用户即可使用对应接口，因此内置角色和已有的自定义角色都默认拥有
+var OrgReadPermissions = []Permission{
+	PermObservationsRead,
+	PermRecognitionsRead,
+	PermVideosRead,
+	PermDatasetsRead,
+	PermBehaviorsRead,
+	PermAlertsRead,
+	PermCamerasRead,
+}
+
+// AdminPermissions 管理接口使用的权限。管理接口要求用户会话通过两步验证，因此 API 密钥不能持有这些权限
+var AdminPermissions = []Permission{
+	PermDashboardView,
+	PermUsersManage,
+	PermRolesManage,
+	PermAPIKeysManage,
+	PermAuditView,
+}
+
+var permissionPattern = regexp.MustCompile(`^[a-z_]+:([a-z_]+|\*)$`)
+
+// IsValid 权限为 "*"、"资源:*" 或已定义的权限
+func (p Permission) IsValid() bool {
+	if p == PermAll {
+		return true
+	}
+	if !permissionPattern.MatchString(string(p)) {
+		return false
+	}
+	if strings.HasSuffix(string(p), ":*") {
+		resource := strings.TrimSuffix(string(p), "*")
+		for defined := range Permissions {
+			if strings.HasPrefix(string(defined), resource) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := Permissions[p]
+	return ok
+}
+
+// Grants 判断已持有的权限是否覆盖 want。
+// "*" 覆盖全部，"资源:*" 覆盖该资源的全部操作，"资源:admin" 同时覆盖 "资源:write"，
+// "资源:admin" 和 "资源:write" 同时覆盖 "资源:read"。
+func (p Permission) Grants(want Permission) bool {
+	if p == PermAll || p == want {
+		return true
+	}
+	resource, action, ok := strings.Cut(string(p), ":")
+	if !ok {
+		return false
+	}
+	wantResource, wantAction, ok := strings.Cut(string(want), ":")
+	if !ok || resource != wantResource {
+		return false
+	}
+	switch action {
+	case "*":
+		return true
+	case "admin":
+		return wantAction == "write" || wantAction == "read"
+	case "write":
+		return wantAction == "read"
+	}
+	return false
+}
+
+// IsAdmin 权限是否覆盖任一管理接口权限，"*" 和 "users:*" 等通配权限同样算作管理权限
+func (p Permission) IsAdmin() bool {
+	for _, admin := range AdminPermissions {
+		if p.Grants(admin) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleDefinition 角色即一组权限。内置角色在代码中定义，自定义角色保存在数据库中
+type RoleDefinition struct {
+	Name        Role         `gorm:"column:name;type:varchar(32);primaryKey" json:"name"`
+	Description string       `gorm:"column:description" json:"description"`
+	Permissions []Permission `gorm:"column:permissions;type:text;serializer:json" json:"permissions"`
+	BuiltIn     bool         `gorm:"-" json:"built_in"`
+}
+
+func (RoleDefinition) TableName() string {
+	return "roles"
+}
+
+// HasPermission 角色是否拥有指定权限
+func (r *RoleDefinition) HasPermission(want Permission) bool {
+	for _, p := range r.Permissions {
+		if p.Grants(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuiltInRoles 内置角色，不可修改或删除
+var BuiltInRoles = []RoleDefinition{
+	{
+		Name:        RoleAdmin,
+		Description: "系统管理员，拥有全部权限",
+		Permissions: []Permission{PermAll},
+	},
+	{
+		Name:        RoleUser,
+		Description: "普通用户，可查询水质数据并提交观测记录",
+		Permissions: append([]Permission{PermWaterQualityRead, PermObservationsWrite, PermRecognitionsWrite}, OrgReadPermissions...),
+	},
+	{
+		Name:        RoleResearcher,
+		Description: "研究人员，维护物种目录、分类学、观测数据、视频标注、行为事件和检测数据集，审核识别标注",
+		Permissions: append([]Permission{PermSpeciesAdmin, PermTaxonomyWrite, PermObservationsWrite, PermWaterQualityWrite, PermRecognitionReview, PermVideosWrite, PermDatasetsWrite, PermBehaviorsWrite, PermRecognitionsWrite}, OrgReadPermissions...),
+	},
+	{
+		Name:        RoleOperator,
+		Description: "运维人员，负责监测设备、告警、水质数据和行为事件",
+		Permissions: append([]Permission{PermWaterQualityWrite, PermAlertsAck, PermDevicesManage, PermObservationsWrite, PermBehaviorsWrite, PermSnapshotsWrite, PermRecognitionsWrite}, OrgReadPermissions...),
+	},
+}
+
+// FindBuiltInRole 查找内置角色
+func FindBuiltInRole(name Role) *RoleDefinition {
+	for i := range BuiltInRoles {
+		if BuiltInRoles[i].Name == name {
+			role := BuiltInRoles[i]
+			role.BuiltIn = true
+			return &role
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package domain
+
+import "testing"
+
+func TestPermissionGrants(t *testing.T) {
+	tests := []struct {
+		held Permission
+		want Permission
+		ok   bool
+	}{
+		{PermAll, PermUsersManage, true},
+		{PermSpeciesWrite, PermSpeciesWrite, true},
+		{"species:*", PermSpeciesAdmin, true},
+		{PermSpeciesAdmin, PermSpeciesWrite, true},
+		{PermSpeciesAdmin, "species:read", true},
+		{PermWaterQualityWrite, PermWaterQualityRead, true},
+		{PermWaterQualityRead, PermWaterQualityWrite, false},
+		{PermSpeciesWrite, PermSpeciesAdmin, false},
+		{"species:*", PermTaxonomyWrite, false},
+		{PermObservationsWrite, PermRecognitionsRead, false},
+		{PermDevicesManage, "devices:read", false},
+	}
+	for _, tt := range tests {
+		if got := tt.held.Grants(tt.want); got != tt.ok {
+			t.Errorf("%s grants %s = %v, want %v", tt.held, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestPermissionIsValid(t *testing.T) {
+	tests := []struct {
+		p  Permission
+		ok bool
+	}{
+		{PermAll, true},
+		{PermAuditView, true},
+		{"species:*", true},
+		{"fish:*", false},
+		{"species:delete", false},
+		{"Species:write", false},
+		{"species", false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.IsValid(); got != tt.ok {
+			t.Errorf("%q valid = %v, want %v", tt.p, got, tt.ok)
+		}
+	}
+}
+
+func TestPermissionIsAdmin(t *testing.T) {
+	for _, p := range []Permission{PermAll, PermUsersManage, "roles:*", PermAPIKeysManage, PermAuditView} {
+		if !p.IsAdmin() {
+			t.Errorf("%s is not an admin permission", p)
+		}
+	}
+	for _, p := range []Permission{PermSpeciesAdmin, PermWaterQualityWrite, PermDevicesManage, PermRecognitionReview} {
+		if p.IsAdmin() {
+			t.Errorf("%s is an admin permission", p)
+		}
+	}
+}
+
+// 内置的非管理员角色不能持有任何管理接口权限
+func TestBuiltInRolesWithoutAdminPermissions(t *testing.T) {
+	for _, role := range BuiltInRoles {
+		for _, p := range role.Permissions {
+			if !p.IsValid() {
+				t.Errorf("%s has invalid permission %q", role.Name, p)
+			}
+			if role.Name != RoleAdmin && p.IsAdmin() {
+				t.Errorf("%s has admin permission %q", role.Name, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package domain
+
+import "time"
+
+// RecognitionCandidate 识别后端返回的一个候选结果
+type RecognitionCandidate struct {
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description,omitempty"`
+	BaikeURL    string  `json:"baike_url,omitempty"`
+	ImageURL    string  `json:"image_url,omitempty"`
+}
+
+// RecognitionResult 鱼类识别结果。Species 为识别名称对应的规范物种记录，物种库未收录时为空
+type RecognitionResult struct {
+	RecognitionID uint                   `json:"recognition_id"`
+	Name          string                 `json:"name"`
+	Score         float64                `json:"score"`
+	Description   string                 `json:"description"`
+	Species       *Species               `json:"species,omitempty"`
+	CanonicalName string                 `json:"canonical_name,omitempty"`
+	Candidates    []RecognitionCandidate `json:"candidates"`
+	Enhance       string                 `json:"enhance"` // 识别前执行的预处理
+}
+
+// RecognitionStatus 识别记录的标注状态
+type RecognitionStatus string
+
+const (
+	RecognitionPending   RecognitionStatus = "pending"   // 用户尚未反馈
+	RecognitionConfirmed RecognitionStatus = "confirmed" // 用户确认了首选结果
+	RecognitionCorrected RecognitionStatus = "corrected" // 用户更正了标签
+	RecognitionApproved  RecognitionStatus = "approved"  // 专家审核通过，可用于训练
+	RecognitionRejected  RecognitionStatus = "rejected"  // 专家判定图片或标签不可用
+)
+
+// IsReviewed 专家已审核，用户不能再修改标签
+func (s RecognitionStatus) IsReviewed() bool {
+	return s == RecognitionApproved || s == RecognitionRejected
+}
+
+// Recognition 一次识别请求的记录。Label 初始为识别首选结果，随用户反馈和专家审核更新
+type Recognition struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	OrgID      uint                   `gorm:"index" json:"org_id"`
+	UserID     uint                   `gorm:"index" json:"user_id"`
+	ImageHash  string                 `gorm:"type:varchar(64);index" json:"image_hash"` // 原始图片的 SHA-256
+	ImageKey   string                 `gorm:"type:varchar(128)" json:"-"`
+	Candidates []RecognitionCandidate `gorm:"type:text;serializer:json" json:"candidates"`
+	TopName    string                 `gorm:"type:varchar(128)" json:"top_name"`
+	TopScore   float64                `json:"top_score"`
+	Label      string                 `gorm:"type:varchar(128);index" json:"label"`
+	SpeciesID  *uint                  `gorm:"index" json:"species_id"` // 标签对应的规范物种，未收录时为空
+	Status     RecognitionStatus      `gorm:"type:varchar(16);index" json:"status"`
+	AreaID     string                 `gorm:"type:varchar(64)" json:"area_id"`
+	Latitude   *float64               `json:"latitude"`
+	Longitude  *float64               `json:"longitude"`
+	Enhance    string                 `gorm:"type:varchar(128);default:none" json:"enhance"` // 识别前执行的预处理，none 表示未预处理
+	FeedbackAt *time.Time             `json:"feedback_at"`
+	ReviewerID uint                   `json:"reviewer_id,omitempty"`
+	ReviewedAt *time.Time             `json:"reviewed_at"`
+	ReviewNote string                 `gorm:"type:varchar(255)" json:"review_note,omitempty"`
+	CreatedAt  time.Time              `gorm:"index" json:"created_at"`
+}
+
+// RecognitionFilter 识别记录查询条件，零值字段不参与过滤
+type RecognitionFilter struct {
+	UserID   uint
+	Statuses []RecognitionStatus
+	Label    string
+	From     *time.Time
+	To       *time.Time
+	Offset   int
+	Limit    int
+}
@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+// RecognitionJobStatus 批量识别任务状态
+type RecognitionJobStatus string
+
+const (
+	JobQueued    RecognitionJobStatus = "queued"
+	JobRunning   RecognitionJobStatus = "running"
+	JobCompleted RecognitionJobStatus = "completed" // 所有图片均已处理，其中可能有失败项
+)
+
+// JobItemStatus 批量任务中单张图片的处理状态
+type JobItemStatus string
+
+const (
+	JobItemPending   JobItemStatus = "pending"
+	JobItemRunning   JobItemStatus = "running"
+	JobItemSucceeded JobItemStatus = "succeeded"
+	JobItemFailed    JobItemStatus = "failed"
+)
+
+// RecognitionJob 异步批量识别任务，每张图片对应一个 RecognitionJobItem。
+// 同一任务的图片共用拍摄区域和坐标
+type RecognitionJob struct {
+	ID         uint                 `gorm:"primaryKey" json:"id"`
+	OrgID      uint                 `gorm:"index" json:"org_id"`
+	UserID     uint                 `gorm:"index" json:"user_id"`
+	Status     RecognitionJobStatus `gorm:"type:varchar(16);index" json:"status"`
+	Total      int                  `json:"total"`
+	Succeeded  int                  `json:"succeeded"`
+	Failed     int                  `json:"failed"`
+	AreaID     string               `gorm:"type:varchar(64)" json:"area_id"`
+	Latitude   *float64             `json:"latitude"`
+	Longitude  *float64             `json:"longitude"`
+	CreatedAt  time.Time            `gorm:"index" json:"created_at"`
+	StartedAt  *time.Time           `json:"started_at"`
+	FinishedAt *time.Time           `json:"finished_at"`
+}
+
+// RecognitionJobItem 批量任务中的一张图片。识别成功后关联生成的识别记录
+type RecognitionJobItem struct {
+	ID            uint          `gorm:"primaryKey" json:"id"`
+	JobID         uint          `gorm:"index" json:"job_id"`
+	FileName      string        `gorm:"type:varchar(255)" json:"file_name"`
+	ImageKey      string        `gorm:"type:varchar(128)" json:"-"`
+	Status        JobItemStatus `gorm:"type:varchar(16);index" json:"status"`
+	Attempts      int           `json:"attempts"`
+	Error         string        `gorm:"type:varchar(255)" json:"error,omitempty"`
+	RecognitionID *uint         `json:"recognition_id"`
+	Label         string        `gorm:"type:varchar(128)" json:"label,omitempty"` // 规范物种名，物种库未收录时为识别名称
+	SpeciesID     *uint         `json:"species_id"`
+	Score         float64       `json:"score"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// LabelCount 批量任务中某一标签的识别数量
+type LabelCount struct {
+	Label     string `json:"label"`
+	SpeciesID *uint  `json:"species_id"`
+	Count     int    `json:"count"`
+}
@@ -2,9 +2,22 @@ package domain
 
 import "time"
 
+// Session 一条刷新令牌记录。每次刷新都会在同一 FamilyID 下生成新记录并标记旧记录为已轮换，
+// 已轮换的令牌再次出现即视为泄露，整个会话族会被吊销。
 type Session struct {
-	ID     uint      `gorm:"primaryKey"`
-	UserID uint      `gorm:"index"`
-	Token  string    `gorm:"unique;not null"`
-	Expiry time.Time `gorm:"index"`
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	FamilyID  string    `gorm:"type:varchar(64);index"`
+	TokenHash string    `gorm:"column:token;type:varchar(64);unique;not null"` // 刷新令牌的 SHA-256 摘要
+	Expiry    time.Time `gorm:"index"`
+	CreatedAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+	MFA       bool `gorm:"column:mfa_verified"` // 会话族在登录时通过了两步验证，刷新时保持
+	OrgID     uint // 当前组织上下文，切换组织时更新整个会话族
+}
+
+// IsUsable 刷新令牌未被轮换、未被吊销且未过期
+func (s *Session) IsUsable(now time.Time) bool {
+	return s.RotatedAt == nil && s.RevokedAt == nil && now.Before(s.Expiry)
 }
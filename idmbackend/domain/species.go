@@ -12,4 +12,7 @@ type Species struct {
 	Height           float64 `gorm:"column:height;not null" json:"height"`
 	Width            float64 `gorm:"column:width;not null" json:"width"`
 	OptimalTempRange string  `gorm:"column:optimal_temp_range;not null" json:"optimal_temp_range"`
+	TaxonID          *uint   `gorm:"column:taxon_id;index" json:"taxon_id"`
+
+	Names []SpeciesName `gorm:"foreignKey:SpeciesID" json:"names,omitempty"`
 }
@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// SpeciesImage 物种图库中的一张图片，原图与缩略图保存在对象存储中
+type SpeciesImage struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement" json:"image_id"`
+	SpeciesID   uint      `gorm:"column:species_id;not null;uniqueIndex:idx_species_image_hash" json:"species_id"`
+	ContentHash string    `gorm:"column:content_hash;type:varchar(64);not null;uniqueIndex:idx_species_image_hash" json:"content_hash"`
+	StorageKey  string    `gorm:"column:storage_key;not null" json:"-"`
+	MimeType    string    `gorm:"column:mime_type;type:varchar(32);not null" json:"mime_type"`
+	Width       int       `gorm:"column:width" json:"width"`
+	Height      int       `gorm:"column:height" json:"height"`
+	Size        int64     `gorm:"column:size" json:"size"`
+	IsPrimary   bool      `gorm:"column:is_primary" json:"is_primary"`
+	Caption     string    `gorm:"column:caption" json:"caption"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+
+	Thumbnails []SpeciesImageThumbnail `gorm:"foreignKey:ImageID;constraint:OnDelete:CASCADE" json:"thumbnails"`
+}
+
+// SpeciesImageThumbnail 图片按固定尺寸生成的缩略图
+type SpeciesImageThumbnail struct {
+	ID         uint   `gorm:"column:id;primaryKey;autoIncrement" json:"-"`
+	ImageID    uint   `gorm:"column:image_id;not null;index" json:"-"`
+	Size       string `gorm:"column:size;type:varchar(16);not null" json:"size"`
+	Width      int    `gorm:"column:width" json:"width"`
+	Height     int    `gorm:"column:height" json:"height"`
+	StorageKey string `gorm:"column:storage_key;not null" json:"-"`
+}
@@ -0,0 +1,17 @@
+package domain
+
+// SpeciesRecord 一条物种记录及其从界到属的分类路径，用于批量导入导出
+type SpeciesRecord struct {
+	Species *Species
+	Lineage []Taxon
+}
+
+// Classification 返回指定阶元的学名，没有时返回空字符串
+func (r *SpeciesRecord) Classification(rank TaxonRank) string {
+	for _, taxon := range r.Lineage {
+		if taxon.Rank == rank {
+			return taxon.ScientificName
+		}
+	}
+	return ""
+}
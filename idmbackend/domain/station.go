@@ -0,0 +1,31 @@
+package domain
+
+import "strings"
+
+// Station 水质监测站点，AreaID 与 water_quality、observations 中的 area_id 对应
+type Station struct {
+	AreaID    string   `gorm:"column:area_id;type:varchar(64);primaryKey" json:"area_id"`
+	OrgID     uint     `gorm:"column:org_id;index" json:"org_id"`
+	Name      string   `gorm:"column:name;not null" json:"name"`
+	Province  string   `gorm:"column:province;index" json:"province"`
+	Basin     string   `gorm:"column:basin;index" json:"basin"`
+	Latitude  *float64 `gorm:"column:latitude" json:"latitude"`
+	Longitude *float64 `gorm:"column:longitude" json:"longitude"`
+}
+
+func (Station) TableName() string {
+	return "stations"
+}
+
+// ParseStationLocation 解析 "省份-流域-站点" 格式的站点名称
+func ParseStationLocation(location string) (province, basin, name string) {
+	parts := strings.SplitN(strings.TrimSpace(location), "-", 3)
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], parts[2]
+	case 2:
+		return parts[0], "", parts[1]
+	default:
+		return "", "", parts[0]
+	}
+}
@@ -0,0 +1,62 @@
+package domain
+
+// TaxonRank 分类阶元
+type TaxonRank string
+
+const (
+	RankKingdom TaxonRank = "kingdom"
+	RankPhylum  TaxonRank = "phylum"
+	RankClass   TaxonRank = "class"
+	RankOrder   TaxonRank = "order"
+	RankFamily  TaxonRank = "family"
+	RankGenus   TaxonRank = "genus"
+	RankSpecies TaxonRank = "species"
+)
+
+// TaxonRanks 按从高到低的顺序列出所有分类阶元
+var TaxonRanks = []TaxonRank{RankKingdom, RankPhylum, RankClass, RankOrder, RankFamily, RankGenus, RankSpecies}
+
+// Level 返回阶元的层级（界为0），未知阶元返回-1
+func (r TaxonRank) Level() int {
+	for i, rank := range TaxonRanks {
+		if rank == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Taxon 分类单元，通过 ParentID 组成从界到种的层级树
+type Taxon struct {
+	ID             uint      `gorm:"column:id;primaryKey;autoIncrement" json:"taxon_id"`
+	ParentID       *uint     `gorm:"column:parent_id;index" json:"parent_id"`
+	Rank           TaxonRank `gorm:"column:rank;type:varchar(16);not null;index" json:"rank"`
+	ScientificName string    `gorm:"column:scientific_name;not null;index" json:"scientific_name"`
+	Authorship     string    `gorm:"column:authorship" json:"authorship"`
+}
+
+func (Taxon) TableName() string {
+	return "taxa"
+}
+
+// NameKind 物种名称的类型
+type NameKind string
+
+const (
+	NameKindCommon  NameKind = "common"  // 俗名（任意语言）
+	NameKindSynonym NameKind = "synonym" // 学名异名
+)
+
+// SpeciesName 物种的俗名或异名，同一物种可以有多个语言的多个名称
+type SpeciesName struct {
+	ID        uint     `gorm:"column:id;primaryKey;autoIncrement" json:"name_id"`
+	SpeciesID uint     `gorm:"column:species_id;not null;index" json:"species_id"`
+	Name      string   `gorm:"column:name;not null;index" json:"name"`
+	Language  string   `gorm:"column:language;type:varchar(16);default:'zh'" json:"language"`
+	Kind      NameKind `gorm:"column:kind;type:varchar(16);default:'common'" json:"kind"`
+	Preferred bool     `gorm:"column:preferred" json:"preferred"`
+}
+
+func (SpeciesName) TableName() string {
+	return "species_names"
+}
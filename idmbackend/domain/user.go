@@ -1,19 +1,93 @@
 package domain
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 type Role string
 
 const (
-	RoleAdmin Role = "admin"
-	RoleUser  Role = "user"
+	RoleAdmin      Role = "admin"
+	RoleUser       Role = "user"
+	RoleResearcher Role = "researcher"
+	RoleOperator   Role = "operator"
 )
 
 type User struct {
-	ID       uint   `gorm:"primaryKey"`
-	Username string `gorm:"unique;not null"`
-	Password string `gorm:"not null"`
-	Role     Role   `gorm:"type:varchar(10);default:'user'"`
+	ID          uint   `gorm:"primaryKey"`
+	Username    string `gorm:"unique;not null"`
+	Password    string `gorm:"not null"`
+	Role        Role   `gorm:"type:varchar(32);default:'user'"`
+	Email       string `gorm:"type:varchar(255);uniqueIndex;serializer:empty_null"` // 未设置时保存为 NULL，不占用唯一索引
+	DisplayName string `gorm:"type:varchar(64)"`
+	Phone       string `gorm:"type:varchar(32)"`
+	Locale      string `gorm:"type:varchar(16)"` // BCP 47 语言标记，如 zh-CN
+	Timezone    string `gorm:"type:varchar(64)"` // IANA 时区，如 Asia/Shanghai
+	AvatarKey   string `gorm:"type:varchar(128)"`
+
+	PasswordChangedAt *time.Time
+	LastLoginAt       *time.Time
+	LastLoginIP       string     `gorm:"type:varchar(64)"`
+	DisabledAt        *time.Time `gorm:"index"` // 停用的账号不能登录，数据保留
+}
+
+// IsDisabled 账号是否已被管理员停用
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// UserProfile 对外返回的用户资料，不含密码哈希等敏感字段
+type UserProfile struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Role        Role       `json:"role"`
+	DisplayName string     `json:"display_name"`
+	Email       string     `json:"email"`
+	Phone       string     `json:"phone"`
+	Locale      string     `json:"locale"`
+	Timezone    string     `json:"timezone"`
+	HasAvatar   bool       `json:"has_avatar"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	LastLoginIP string     `json:"last_login_ip,omitempty"`
+	Disabled    bool       `json:"disabled"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+}
+
+func (u *User) Profile() *UserProfile {
+	return &UserProfile{
+		ID:          u.ID,
+		Username:    u.Username,
+		Role:        u.Role,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Phone:       u.Phone,
+		Locale:      u.Locale,
+		Timezone:    u.Timezone,
+		HasAvatar:   u.AvatarKey != "",
+		LastLoginAt: u.LastLoginAt,
+		LastLoginIP: u.LastLoginIP,
+		Disabled:    u.IsDisabled(),
+		DisabledAt:  u.DisabledAt,
+	}
+}
+
+// UserStatus 用户列表按账号状态过滤
+type UserStatus string
+
+const (
+	UserStatusActive   UserStatus = "active"
+	UserStatusDisabled UserStatus = "disabled"
+)
+
+// UserFilter 用户列表查询条件，零值字段不参与过滤
+type UserFilter struct {
+	Query  string // 匹配用户名、显示名称或邮箱
+	Role   Role   // 用户在组织中的角色
+	Status UserStatus
+	Offset int
+	Limit  int
 }
 
 func (u *User) SetPassword(password string) error {
@@ -22,6 +96,8 @@ func (u *User) SetPassword(password string) error {
 		return err
 	}
 	u.Password = string(hashedPassword)
+	now := time.Now()
+	u.PasswordChangedAt = &now
 	return nil
 }
 
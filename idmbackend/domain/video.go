@@ -0,0 +1,69 @@
+package domain
+
+import "time"
+
+// Video 水下视频。视频文件上传到对象存储，也可以只登记外部地址（SourceURL）
+type Video struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"`
+	Name        string    `gorm:"type:varchar(128);not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	SourceURL   string    `gorm:"type:varchar(512)" json:"source_url,omitempty"`
+	StorageKey  string    `gorm:"type:varchar(128)" json:"-"`
+	MimeType    string    `gorm:"type:varchar(32)" json:"mime_type,omitempty"`
+	Size        int64     `json:"size"`
+	Duration    float64   `json:"duration"` // 秒，未知时为 0
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	FrameRate   float64   `json:"frame_rate"`
+	UploadedBy  uint      `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Stored 视频文件是否保存在对象存储中
+func (v *Video) Stored() bool {
+	return v.StorageKey != ""
+}
+
+// Detection 一帧中检测到的一个目标，BBox 为 COCO 格式的 [x, y, 宽, 高]，单位为像素
+type Detection struct {
+	Class string     `json:"class"`
+	Score float64    `json:"score"`
+	BBox  [4]float64 `json:"bbox"`
+}
+
+// Annotation 视频某一时刻的标注，可以来自浏览器端的自动检测或人工标注
+type Annotation struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	OrgID      uint        `gorm:"index" json:"org_id"`
+	VideoID    uint        `gorm:"index:idx_annotation_video_time,priority:1" json:"video_id"`
+	Timestamp  float64     `gorm:"column:time_offset;index:idx_annotation_video_time,priority:2" json:"timestamp"` // 距视频开始的秒数
+	FishCount  int         `json:"fish_count"`
+	Behavior   string      `gorm:"type:varchar(32);index" json:"behavior"`
+	Confidence float64     `json:"confidence"`
+	Detections []Detection `gorm:"type:text;serializer:json" json:"detections"`
+	Source     string      `gorm:"type:varchar(32)" json:"source"` // 例如 coco-ssd、manual
+	CreatedBy  uint        `json:"created_by"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// AnnotationFilter 标注查询条件，零值字段不参与过滤
+type AnnotationFilter struct {
+	From     *float64 // 秒，包含
+	To       *float64 // 秒，包含
+	Behavior string
+	Offset   int
+	Limit    int
+}
+
+// FishCountPoint 鱼群数量时间序列中的一个区间
+type FishCountPoint struct {
+	Start   float64 `json:"start"` // 区间起点，秒
+	End     float64 `json:"end"`
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+}
@@ -5,6 +5,7 @@ import "time"
 type WaterQuality struct {
 	RecordID             string     `gorm:"column:record_id;primaryKey" json:"record_id"`
 	AreaID               string     `gorm:"column:area_id;not null" json:"area_id"`
+	OrgID                uint       `gorm:"column:org_id;index" json:"org_id"`
 	RecordTime           *time.Time `gorm:"column:record_time" json:"record_time"`
 	WaterQualityCategory *string    `gorm:"column:water_quality_category" json:"water_quality_category"`
 	Temperature          *float64   `gorm:"column:temperature" json:"temperature"`
@@ -24,4 +25,4 @@ type WaterQuality struct {
 
 func (WaterQuality) TableName() string {
 	return "water_quality"
-}
\ No newline at end of file
+}
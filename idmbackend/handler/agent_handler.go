@@ -1,12 +1,15 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
-	"io/ioutil"
+	"context"
+	"errors"
+	"log"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,126 +19,54 @@ type ChatRequest struct {
 	Prompt string `json:"prompt" binding:"required"`
 }
 
-// DeepseekRequest 结构体用于构建发送给 DeepSeek API 的请求体
-type DeepseekRequest struct {
-	Model    string            `json:"model"`
-	Messages []DeepseekMessage `json:"messages"`
+type ChatHandler struct {
+	chatService *app.ChatService
 }
 
-// DeepseekMessage 结构体表示对话中的一条消息
-type DeepseekMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+func NewChatHandler(chatService *app.ChatService) *ChatHandler {
+	return &ChatHandler{chatService: chatService}
 }
 
-// DeepseekResponse 结构体用于解析 DeepSeek API 返回的响应
-type DeepseekResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-	// 如果需要，可以添加其他字段，如 Usage 等
-}
-
-// Chat 函数处理与大模型的聊天逻辑
-func Chat(c *gin.Context) {
-	// =================================================================
-	// 1. 设置 API key，解析 request 等等
-	// =================================================================
-
-	// 从环境变量中获取 DeepSeek API Key
-	apiKey := "sk-f8801025fdbc4e339d8c8837a8ea09ce"
-	if apiKey == "" {
-		// 如果环境变量未设置，返回服务器内部错误
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "DEEPSEEK_API_KEY 未配置"})
+// Chat 将问题转发给大模型，返回回答和本次调用的 token 用量。
+// 大模型按调用计费，只对登录用户开放并按用户限制提问次数
+func (h *ChatHandler) Chat(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
 		return
 	}
 
-	// 解析前端发送的 JSON 请求
 	var chatRequest ChatRequest
 	if err := c.ShouldBindJSON(&chatRequest); err != nil {
-		// 如果请求体不符合格式，返回客户端错误
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误，需要 'prompt' 字段"})
 		return
 	}
 
-	// =================================================================
-	// 2. 调用远程的 deepseek api
-	// =================================================================
-
-	// DeepSeek API 的端点和模型配置
-	apiURL := "https://api.deepseek.com/chat/completions"
-	modelName := "deepseek-chat" // 或者使用 "deepseek-coder"
-
-	// 构建发送给 DeepSeek 的请求体
-	deepseekReq := DeepseekRequest{
-		Model: modelName,
-		Messages: []DeepseekMessage{
-			{Role: "user", Content: chatRequest.Prompt},
-		},
-	}
-
-	// 将请求体转换为 JSON 字节流
-	reqBodyBytes, err := json.Marshal(deepseekReq)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法序列化请求体"})
-		return
-	}
-
-	// 创建一个 HTTP POST 请求
-	httpRequest, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqBodyBytes))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法创建 HTTP 请求"})
-		return
-	}
-
-	// 设置请求头
-	httpRequest.Header.Set("Content-Type", "application/json")
-	httpRequest.Header.Set("Authorization", "Bearer "+apiKey)
-	httpRequest.Header.Set("Accept", "application/json")
-
-	// 创建 HTTP 客户端并发送请求 (设置30秒超时)
-	client := &http.Client{Timeout: 30 * time.Second}
-	httpResponse, err := client.Do(httpRequest)
+	reply, err := h.chatService.Chat(c.Request.Context(), principal.UserID, chatRequest.Prompt)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用 DeepSeek API 失败: " + err.Error()})
-		return
-	}
-	defer httpResponse.Body.Close()
-
-	// 检查 DeepSeek API 的响应状态码
-	if httpResponse.StatusCode != http.StatusOK {
-		// 读取错误响应体
-		errorBody, _ := ioutil.ReadAll(httpResponse.Body)
-		errorMsg := "DeepSeek API 返回错误: " + httpResponse.Status
-		if len(errorBody) > 0 {
-			errorMsg += " - " + string(errorBody)
-		}
-		c.JSON(httpResponse.StatusCode, gin.H{"error": errorMsg})
-		return
-	}
-
-	// =================================================================
-	// 3. 封装解答，形成 resp
-	// =================================================================
-
-	// 解析 DeepSeek API 的成功响应体
-	var deepseekResp DeepseekResponse
-	if err := json.NewDecoder(httpResponse.Body).Decode(&deepseekResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法解析 DeepSeek API 响应"})
+		respondChatError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, reply)
+}
 
-	// 检查响应中是否包含有效的回答
-	if len(deepseekResp.Choices) == 0 || deepseekResp.Choices[0].Message.Content == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "DeepSeek API 返回了空的回答"})
-		return
+func respondChatError(c *gin.Context, err error) {
+	var throttled *app.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "提问次数过多，请稍后再试", "retry_after": seconds})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrLLMNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "智能问答未配置大模型"})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "大模型响应超时"})
+	case errors.Is(err, domain.ErrLLMFailed):
+		log.Printf("智能问答 - 调用大模型失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "调用大模型失败，请稍后重试"})
+	default:
+		log.Printf("智能问答失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "智能问答失败"})
 	}
-
-	// 提取回答并以约定的格式返回给前端
-	reply := deepseekResp.Choices[0].Message.Content
-	c.JSON(http.StatusOK, gin.H{
-		"reply": reply,
-	})
 }
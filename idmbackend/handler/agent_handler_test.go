@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/MoyInGxing/idm/infra/llm"
+	"github.com/gin-gonic/gin"
+)
+
+// memThrottleRepo 内存中的计数存储，供限流测试使用
+type memThrottleRepo struct {
+	mu       sync.Mutex
+	throttle map[string]domain.LoginThrottle
+}
+
+func (r *memThrottleRepo) Find(key string) (*domain.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.throttle[key]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (r *memThrottleRepo) Save(throttle *domain.LoginThrottle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.throttle[throttle.Key] = *throttle
+	return nil
+}
+
+func (r *memThrottleRepo) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttle, key)
+	return nil
+}
+
+func (r *memThrottleRepo) DeleteStale(before time.Time) error {
+	return nil
+}
+
+// chatRouter 请求头 X-Test-User 指定登录用户，未提供时视为未认证
+func chatRouter(provider app.LLMProvider, systemPrompt string, limiter *app.RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var userID uint
+		if _, err := fmt.Sscan(c.GetHeader("X-Test-User"), &userID); err == nil {
+			c.Set("principal", &domain.Principal{Kind: domain.PrincipalUser, UserID: userID, Role: domain.RoleUser, OrgID: 1})
+			c.Set("userID", userID)
+		}
+	})
+	r.POST("/api/chat", NewChatHandler(app.NewChatService(provider, systemPrompt, limiter)).Chat)
+	return r
+}
+
+func chatAs(r *gin.Engine, userID uint, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set("X-Test-User", fmt.Sprint(userID))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func chat(t *testing.T, provider app.LLMProvider, systemPrompt, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return chatAs(chatRouter(provider, systemPrompt, nil), 1, body)
+}
+
+func TestChatReturnsReplyAndUsage(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptStep{
+		Reply: "草鱼以水草为食",
+		Usage: app.LLMUsage{PromptTokens: 20, CompletionTokens: 7, TotalTokens: 27},
+	})
+
+	w := chat(t, provider, "你是渔业助手", `{"prompt":"  草鱼吃什么  "}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var reply app.ChatReply
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	want := app.ChatReply{Reply: "草鱼以水草为食", Model: "scripted", Usage: app.LLMUsage{PromptTokens: 20, CompletionTokens: 7, TotalTokens: 27}}
+	if reply != want {
+		t.Errorf("reply = %+v, want %+v", reply, want)
+	}
+
+	requests := provider.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(requests))
+	}
+	messages := requests[0].Messages
+	if len(messages) != 2 || messages[0] != (app.LLMMessage{Role: "system", Content: "你是渔业助手"}) || messages[1] != (app.LLMMessage{Role: "user", Content: "草鱼吃什么"}) {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestChatWithoutSystemPrompt(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.Reply("好的"))
+	if w := chat(t, provider, "  ", `{"prompt":"你好"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	if messages := provider.Requests()[0].Messages; len(messages) != 1 || messages[0].Role != "user" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestChatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider app.LLMProvider
+		body     string
+		status   int
+		message  string
+	}{
+		{"not configured", nil, `{"prompt":"你好"}`, http.StatusServiceUnavailable, "智能问答未配置大模型"},
+		{"missing prompt", llm.NewScriptedProvider(llm.Reply("好的")), `{}`, http.StatusBadRequest, "prompt"},
+		{"blank prompt", llm.NewScriptedProvider(llm.Reply("好的")), `{"prompt":"   "}`, http.StatusBadRequest, "prompt is required"},
+		{"prompt too long", llm.NewScriptedProvider(llm.Reply("好的")), fmt.Sprintf(`{"prompt":%q}`, strings.Repeat("鱼", 4001)), http.StatusBadRequest, "at most 4000"},
+		{"provider failure", llm.NewScriptedProvider(llm.Fail(fmt.Errorf("%w: 503 Service Unavailable", domain.ErrLLMFailed))), `{"prompt":"你好"}`, http.StatusBadGateway, "调用大模型失败"},
+		{"timeout", llm.NewScriptedProvider(llm.Fail(context.DeadlineExceeded)), `{"prompt":"你好"}`, http.StatusGatewayTimeout, "大模型响应超时"},
+		{"empty reply", llm.NewScriptedProvider(llm.Reply(" ")), `{"prompt":"你好"}`, http.StatusBadGateway, "调用大模型失败"},
+		{"unexpected error", llm.NewScriptedProvider(llm.Fail(fmt.Errorf("boom"))), `{"prompt":"你好"}`, http.StatusInternalServerError, "智能问答失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := chat(t, tt.provider, "", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.message) {
+				t.Errorf("body = %s, want %q", w.Body, tt.message)
+			}
+		})
+	}
+}
+
+func TestChatRequiresUser(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.Reply("好的"))
+	if w := chatAs(chatRouter(provider, "", nil), 0, `{"prompt":"你好"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if n := len(provider.Requests()); n != 0 {
+		t.Errorf("requests = %d, want provider not called", n)
+	}
+}
+
+func TestChatRateLimitPerUser(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.Reply("一"), llm.Reply("二"), llm.Reply("三"))
+	limiter := app.NewRateLimiter(&memThrottleRepo{throttle: map[string]domain.LoginThrottle{}}, nil, "chat:", app.RateLimitPolicy{Limit: 2, Window: time.Hour})
+	r := chatRouter(provider, "", limiter)
+
+	for i := 0; i < 2; i++ {
+		if w := chatAs(r, 1, `{"prompt":"你好"}`); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body = %s", i+1, w.Code, w.Body)
+		}
+	}
+	w := chatAs(r, 1, `{"prompt":"你好"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("over limit: status = %d, Retry-After = %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// 无效请求不消耗次数，其他用户不受影响
+	if w := chatAs(r, 2, `{"prompt":" "}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("blank prompt: status = %d", w.Code)
+	}
+	if w := chatAs(r, 2, `{"prompt":"你好"}`); w.Code != http.StatusOK {
+		t.Errorf("other user: status = %d, body = %s", w.Code, w.Body)
+	}
+	if n := len(provider.Requests()); n != 3 {
+		t.Errorf("provider requests = %d, want 3", n)
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *app.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *app.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// ListKeys 获取当前组织的全部 API 密钥（不含明文）
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyService.ListKeys(scope)
+	if err != nil {
+		respondAPIKeyError(c, err, "获取API密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  keys,
+		"total": len(keys),
+	})
+}
+
+// GetKey 获取单个 API 密钥
+func (h *APIKeyHandler) GetKey(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.GetKey(scope, id)
+	if err != nil {
+		respondAPIKeyError(c, err, "获取API密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// CreateKey 创建 API 密钥，明文仅在本次响应中返回
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var request struct {
+		Name        string              `json:"name" binding:"required"`
+		Permissions []domain.Permission `json:"permissions" binding:"required"`
+		AreaIDs     []string            `json:"area_ids"`
+		DeviceIDs   []string            `json:"device_ids"`
+		ExpiresAt   *time.Time          `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	creator, ok := currentPrincipal(c)
+	if !ok || creator.Kind != domain.PrincipalUser {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有登录用户可以创建API密钥"})
+		return
+	}
+
+	plaintext, key, err := h.apiKeyService.CreateKey(creator, app.APIKeyInput{
+		Name:        request.Name,
+		Permissions: request.Permissions,
+		AreaIDs:     request.AreaIDs,
+		DeviceIDs:   request.DeviceIDs,
+		ExpiresAt:   request.ExpiresAt,
+	})
+	if err != nil {
+		respondAPIKeyError(c, err, "创建API密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API密钥创建成功，请妥善保存，密钥明文不会再次显示",
+		"key":     plaintext,
+		"data":    key,
+	})
+}
+
+// RevokeKey 吊销 API 密钥
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.apiKeyService.RevokeKey(scope, id); err != nil {
+		respondAPIKeyError(c, err, "吊销API密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API密钥已吊销"})
+}
+
+func respondAPIKeyError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的API密钥"})
+	case errors.Is(err, domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
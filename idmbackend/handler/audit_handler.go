@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditService *app.AuditService
+}
+
+func NewAuditHandler(auditService *app.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// ListEntries 分页查询审计日志，支持按操作者、动作前缀、目标、结果、组织和时间范围过滤
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	filter.Offset = (page - 1) * limit
+	filter.Limit = limit
+
+	entries, total, err := h.auditService.List(principal, filter)
+	if err != nil {
+		log.Printf("获取审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// ExportEntries 按与列表相同的过滤条件导出 CSV
+func (h *AuditHandler) ExportEntries(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	data, err := h.auditService.ExportCSV(principal, filter)
+	if err != nil {
+		log.Printf("导出审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出审计日志失败"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_%s.csv", time.Now().Format("20060102_150405")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// VerifyChain 校验审计日志哈希链是否完整，仅平台管理员可用
+func (h *AuditHandler) VerifyChain(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+	if !principal.PlatformAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+		return
+	}
+
+	result, err := h.auditService.Verify()
+	if err != nil {
+		log.Printf("校验审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验审计日志失败"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func parseAuditFilter(c *gin.Context) (domain.AuditFilter, bool) {
+	filter := domain.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Outcome:    domain.AuditOutcome(c.Query("outcome")),
+	}
+	if raw := c.Query("actor_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的操作者ID"})
+			return filter, false
+		}
+		filter.ActorID = uint(id)
+	}
+	if raw := c.Query("org_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
+			return filter, false
+		}
+		orgID := uint(id)
+		filter.OrgID = &orgID
+	}
+	var ok bool
+	if filter.From, ok = parseTimeQuery(c, "from"); !ok {
+		return filter, false
+	}
+	if filter.To, ok = parseTimeQuery(c, "to"); !ok {
+		return filter, false
+	}
+	return filter, true
+}
+
+// recordAudit 以当前请求的主体、来源地址和 User-Agent 写入审计记录
+func recordAudit(c *gin.Context, auditService *app.AuditService, entry *domain.AuditEntry) {
+	if principal, ok := currentPrincipal(c); ok {
+		entry.OrgID = principal.OrgID
+		entry.ActorKind = string(principal.Kind)
+		entry.ActorID = principal.UserID
+	}
+	entry.IP = c.ClientIP()
+	entry.UserAgent = c.Request.UserAgent()
+	auditService.Record(entry)
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBehaviorInterval 统计和关联分析未指定 interval 时的窗口长度
+const defaultBehaviorInterval = time.Hour
+
+type BehaviorHandler struct {
+	behaviorService *app.BehaviorService
+}
+
+func NewBehaviorHandler(behaviorService *app.BehaviorService) *BehaviorHandler {
+	return &BehaviorHandler{behaviorService: behaviorService}
+}
+
+// IngestEvents 批量上报行为事件，请求体为 {"events": [...]}
+func (h *BehaviorHandler) IngestEvents(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Events []app.BehaviorInput `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	for _, event := range request.Events {
+		var cameraID *string
+		if event.CameraID != "" {
+			cameraID = &event.CameraID
+		}
+		if !authorizeScope(c, event.AreaID, cameraID) {
+			return
+		}
+	}
+
+	userID, _ := currentUserID(c)
+	result, err := h.behaviorService.Ingest(scope, userID, request.Events)
+	if err != nil {
+		respondBehaviorError(c, err, "保存行为事件失败")
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *BehaviorHandler) ListEvents(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	filter, ok := behaviorFilter(c)
+	if !ok {
+		return
+	}
+	filter.Offset = (page - 1) * limit
+	filter.Limit = limit
+
+	events, total, err := h.behaviorService.ListEvents(scope, filter)
+	if err != nil {
+		respondBehaviorError(c, err, "获取行为事件失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// Summary 按时间窗口统计每种行为的次数
+func (h *BehaviorHandler) Summary(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	filter, ok := behaviorFilter(c)
+	if !ok {
+		return
+	}
+	interval, ok := parseIntervalQuery(c)
+	if !ok {
+		return
+	}
+
+	buckets, err := h.behaviorService.Summary(scope, filter, interval)
+	if err != nil {
+		respondBehaviorError(c, err, "统计行为事件失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"interval": interval.String(), "data": buckets})
+}
+
+// Correlation 同一区域每个时间窗口的行为次数与水质均值
+func (h *BehaviorHandler) Correlation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
+	}
+	interval, ok := parseIntervalQuery(c)
+	if !ok {
+		return
+	}
+
+	areaID := c.Query("area_id")
+	if !authorizeArea(c, areaID) {
+		return
+	}
+	points, err := h.behaviorService.Correlation(scope, areaID, from, to, interval)
+	if err != nil {
+		respondBehaviorError(c, err, "关联分析失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"area_id": areaID, "interval": interval.String(), "data": points})
+}
+
+func (h *BehaviorHandler) ListAlerts(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	filter := domain.AlertFilter{
+		AreaID: c.Query("area_id"),
+		Kind:   domain.AlertKind(c.Query("kind")),
+		Status: domain.AlertStatus(c.Query("status")),
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if filter.AreaIDs, ok = areaFilter(c, filter.AreaID); !ok {
+		return
+	}
+	alerts, total, err := h.behaviorService.ListAlerts(scope, filter)
+	if err != nil {
+		respondBehaviorError(c, err, "获取告警失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  alerts,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *BehaviorHandler) GetAlert(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	alert, err := h.behaviorService.GetAlert(scope, id)
+	if err != nil {
+		respondBehaviorError(c, err, "获取告警失败")
+		return
+	}
+	if !authorizeArea(c, alert.AreaID) {
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// AcknowledgeAlert 确认告警，可以附带处理说明
+func (h *BehaviorHandler) AcknowledgeAlert(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+	}
+
+	userID, _ := currentUserID(c)
+	alert, err := h.behaviorService.AcknowledgeAlert(scope, userID, id, request.Note)
+	if err != nil {
+		respondBehaviorError(c, err, "确认告警失败")
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// behaviorFilter 解析行为事件的查询条件
+func behaviorFilter(c *gin.Context) (domain.BehaviorFilter, bool) {
+	filter := domain.BehaviorFilter{
+		AreaID:   c.Query("area_id"),
+		CameraID: c.Query("camera_id"),
+	}
+	if raw := c.Query("type"); raw != "" {
+		behavior, ok := domain.ParseBehaviorType(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的行为类型: " + raw})
+			return filter, false
+		}
+		filter.Type = behavior
+	}
+	minConfidence, ok := parseFloatQuery(c, "min_confidence")
+	if !ok {
+		return filter, false
+	}
+	if minConfidence != nil {
+		filter.MinConfidence = *minConfidence
+	}
+	if filter.From, ok = parseTimeQuery(c, "from"); !ok {
+		return filter, false
+	}
+	if filter.To, ok = parseTimeQuery(c, "to"); !ok {
+		return filter, false
+	}
+	if filter.AreaIDs, ok = areaFilter(c, filter.AreaID); !ok {
+		return filter, false
+	}
+	return filter, true
+}
+
+// parseIntervalQuery 解析 interval 参数，格式如 15m、1h
+func parseIntervalQuery(c *gin.Context) (time.Duration, bool) {
+	raw := c.Query("interval")
+	if raw == "" {
+		return defaultBehaviorInterval, true
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间间隔: " + raw})
+		return 0, false
+	}
+	return interval, true
+}
+
+func respondBehaviorError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrAlertNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的告警"})
+	case errors.Is(err, domain.ErrAlertAcknowledged):
+		c.JSON(http.StatusConflict, gin.H{"error": "告警已被确认"})
+	case errors.Is(err, domain.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的视频"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
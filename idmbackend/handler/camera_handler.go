@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type CameraHandler struct {
+	cameraService *app.CameraService
+}
+
+func NewCameraHandler(cameraService *app.CameraService) *CameraHandler {
+	return &CameraHandler{cameraService: cameraService}
+}
+
+func (h *CameraHandler) CreateCamera(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	var input app.CameraInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	camera, err := h.cameraService.CreateCamera(scope, input)
+	if err != nil {
+		respondCameraError(c, err, "创建摄像头失败")
+		return
+	}
+	c.JSON(http.StatusCreated, camera)
+}
+
+func (h *CameraHandler) ListCameras(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	filter := domain.CameraFilter{
+		AreaID: c.Query("area_id"),
+		Status: domain.CameraStatus(c.Query("status")),
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if filter.AreaIDs, ok = areaFilter(c, filter.AreaID); !ok {
+		return
+	}
+	cameras, total, err := h.cameraService.ListCameras(scope, filter)
+	if err != nil {
+		respondCameraError(c, err, "获取摄像头失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  cameras,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *CameraHandler) GetCamera(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	camera, err := h.cameraService.GetCamera(scope, id)
+	if err != nil {
+		respondCameraError(c, err, "获取摄像头失败")
+		return
+	}
+	if !authorizeArea(c, camera.AreaID) {
+		return
+	}
+	c.JSON(http.StatusOK, camera)
+}
+
+// UpdateCamera 替换摄像头的全部配置
+func (h *CameraHandler) UpdateCamera(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var input app.CameraInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	camera, err := h.cameraService.UpdateCamera(scope, id, input)
+	if err != nil {
+		respondCameraError(c, err, "更新摄像头失败")
+		return
+	}
+	c.JSON(http.StatusOK, camera)
+}
+
+// DeleteCamera 删除摄像头及其全部快照
+func (h *CameraHandler) DeleteCamera(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.cameraService.DeleteCamera(scope, id); err != nil {
+		respondCameraError(c, err, "删除摄像头失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "摄像头已删除"})
+}
+
+// PushSnapshot 摄像头上传快照。请求体为 JPEG 图片本身，或 multipart 表单的 file 字段；
+// captured_at 查询参数为拍摄时间，未提供时使用上传时间
+func (h *CameraHandler) PushSnapshot(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	capturedAt, ok := parseTimeQuery(c, "captured_at")
+	if !ok {
+		return
+	}
+
+	camera, err := h.cameraService.GetCamera(scope, id)
+	if err != nil {
+		respondCameraError(c, err, "上传快照失败")
+		return
+	}
+	var deviceID *string
+	if camera.DeviceID != "" {
+		deviceID = &camera.DeviceID
+	}
+	if !authorizeScope(c, camera.AreaID, deviceID) {
+		return
+	}
+
+	data, ok := readSnapshot(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+	snapshot, err := h.cameraService.PushSnapshot(scope, userID, id, data, capturedAt)
+	if err != nil {
+		respondCameraError(c, err, "上传快照失败")
+		return
+	}
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// ListSnapshots 按拍摄时间顺序列出快照。step 参数（如 10m）按时段抽取，用于延时播放
+func (h *CameraHandler) ListSnapshots(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
+	}
+	var step time.Duration
+	if raw := c.Query("step"); raw != "" {
+		var err error
+		if step, err = time.ParseDuration(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间间隔: " + raw})
+			return
+		}
+	}
+
+	filter := domain.SnapshotFilter{
+		From:   from,
+		To:     to,
+		Step:   step,
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if !h.authorizeCameraArea(c, scope, id, "获取快照失败") {
+		return
+	}
+	snapshots, total, err := h.cameraService.ListSnapshots(scope, id, filter)
+	if err != nil {
+		respondCameraError(c, err, "获取快照失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  snapshots,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// LatestSnapshot 返回摄像头最新快照的图片，快照 ID 和拍摄时间在响应头中
+func (h *CameraHandler) LatestSnapshot(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if !h.authorizeCameraArea(c, scope, id, "获取最新快照失败") {
+		return
+	}
+	snapshot, data, err := h.cameraService.LatestSnapshot(scope, id)
+	if err != nil {
+		respondCameraError(c, err, "获取最新快照失败")
+		return
+	}
+	writeSnapshot(c, snapshot, data)
+}
+
+func (h *CameraHandler) GetSnapshotImage(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	snapshotID, ok := parseUintParam(c, "snapshotId")
+	if !ok {
+		return
+	}
+
+	if !h.authorizeCameraArea(c, scope, id, "获取快照失败") {
+		return
+	}
+	snapshot, data, err := h.cameraService.SnapshotImage(scope, id, snapshotID)
+	if err != nil {
+		respondCameraError(c, err, "获取快照失败")
+		return
+	}
+	writeSnapshot(c, snapshot, data)
+}
+
+// authorizeCameraArea 校验摄像头属于当前组织，且 API 密钥可以读取其所在区域的数据
+func (h *CameraHandler) authorizeCameraArea(c *gin.Context, scope domain.TenantScope, id uint, message string) bool {
+	camera, err := h.cameraService.GetCamera(scope, id)
+	if err != nil {
+		respondCameraError(c, err, message)
+		return false
+	}
+	return authorizeArea(c, camera.AreaID)
+}
+
+// readSnapshot 读取请求中的快照图片，超过大小上限时写入413响应
+func readSnapshot(c *gin.Context) ([]byte, bool) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, formErr := c.FormFile("file")
+		if formErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未提供快照图片"})
+			return nil, false
+		}
+		data, err = readMultipartFile(header, app.MaxSnapshotSize+1)
+	} else {
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, app.MaxSnapshotSize+1))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取快照图片失败"})
+		return nil, false
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供快照图片"})
+		return nil, false
+	}
+	if len(data) > app.MaxSnapshotSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "快照图片过大（最大支持8MB）"})
+		return nil, false
+	}
+	return data, true
+}
+
+func writeSnapshot(c *gin.Context, snapshot *domain.Snapshot, data []byte) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Last-Modified", snapshot.CapturedAt.UTC().Format(http.TimeFormat))
+	c.Header("X-Snapshot-ID", strconv.FormatUint(uint64(snapshot.ID), 10))
+	c.Header("X-Captured-At", snapshot.CapturedAt.Format(time.RFC3339))
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
+
+func respondCameraError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrCameraNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的摄像头"})
+	case errors.Is(err, domain.ErrSnapshotNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到快照"})
+	case errors.Is(err, domain.ErrCameraDisabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "摄像头已停用"})
+	case errors.Is(err, domain.ErrUnsupportedMedia):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "快照只支持JPEG格式"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,566 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// maxDatasetArchiveSize 导入数据集时上传的 ZIP 压缩包大小上限
+const maxDatasetArchiveSize = 512 << 20
+
+type DatasetHandler struct {
+	datasetService *app.DatasetService
+}
+
+func NewDatasetHandler(datasetService *app.DatasetService) *DatasetHandler {
+	return &DatasetHandler{datasetService: datasetService}
+}
+
+func (h *DatasetHandler) CreateDataset(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+	var input app.DatasetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	dataset, err := h.datasetService.CreateDataset(scope, userID, input)
+	if err != nil {
+		respondDatasetError(c, err, "创建数据集失败")
+		return
+	}
+	c.JSON(http.StatusCreated, dataset)
+}
+
+func (h *DatasetHandler) ListDatasets(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	datasets, total, err := h.datasetService.ListDatasets(scope, (page-1)*limit, limit)
+	if err != nil {
+		respondDatasetError(c, err, "获取数据集列表失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  datasets,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// GetDataset 获取数据集详情，包含类别映射和各划分的帧数
+func (h *DatasetHandler) GetDataset(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	summary, err := h.datasetService.GetSummary(scope, id)
+	if err != nil {
+		respondDatasetError(c, err, "获取数据集失败")
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func (h *DatasetHandler) UpdateDataset(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var input app.DatasetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	dataset, err := h.datasetService.UpdateDataset(scope, id, input)
+	if err != nil {
+		respondDatasetError(c, err, "更新数据集失败")
+		return
+	}
+	c.JSON(http.StatusOK, dataset)
+}
+
+func (h *DatasetHandler) DeleteDataset(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.datasetService.DeleteDataset(scope, id); err != nil {
+		respondDatasetError(c, err, "删除数据集失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "数据集已删除"})
+}
+
+func (h *DatasetHandler) ListCategories(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	categories, err := h.datasetService.ListCategories(scope, id)
+	if err != nil {
+		respondDatasetError(c, err, "获取类别失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": categories})
+}
+
+// MapCategory 将类别映射到物种，species_id 为 null 时取消映射
+func (h *DatasetHandler) MapCategory(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	categoryID, ok := parseUintParam(c, "categoryId")
+	if !ok {
+		return
+	}
+	var request struct {
+		SpeciesID *uint `json:"species_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	category, err := h.datasetService.MapCategory(scope, id, categoryID, request.SpeciesID)
+	if err != nil {
+		respondDatasetError(c, err, "更新类别映射失败")
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// frameRequest 新增帧的请求。multipart 上传图片时其余字段以同名表单字段提交，boxes 为 JSON 字符串
+type frameRequest struct {
+	VideoID   *uint              `json:"video_id"`
+	Timestamp *float64           `json:"timestamp"`
+	Width     int                `json:"width"`
+	Height    int                `json:"height"`
+	Split     string             `json:"split"`
+	Boxes     []domain.Detection `json:"boxes"`
+	Source    string             `json:"source"`
+}
+
+// CreateFrame 新增一帧：上传图片（multipart，字段 image），或只关联视频的某一时刻（JSON）。
+// boxes 为 COCO-SSD 格式的检测结果 [{"class", "score", "bbox": [x, y, 宽, 高]}]
+func (h *DatasetHandler) CreateFrame(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	var request frameRequest
+	input := app.FrameInput{}
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		limitImageRequest(c)
+		if request, ok = frameFormRequest(c); !ok {
+			return
+		}
+		if input.Image, ok = readFormImage(c, "image", false); !ok {
+			return
+		}
+		if _, header, err := c.Request.FormFile("image"); err == nil {
+			input.FileName = header.Filename
+		}
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	input.VideoID, input.Timestamp = request.VideoID, request.Timestamp
+	input.Width, input.Height = request.Width, request.Height
+	input.Split, input.Boxes, input.Source = domain.DatasetSplit(request.Split), request.Boxes, request.Source
+
+	frame, err := h.datasetService.AddFrame(scope, userID, id, input)
+	if err != nil {
+		respondDatasetError(c, err, "保存帧失败")
+		return
+	}
+	c.JSON(http.StatusCreated, frame)
+}
+
+// AddVideoFrames 将视频中带检测框的标注加入数据集，from、to 为可选的时间范围（秒）
+func (h *DatasetHandler) AddVideoFrames(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+	var request struct {
+		VideoID uint     `json:"video_id" binding:"required"`
+		From    *float64 `json:"from"`
+		To      *float64 `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	frames, err := h.datasetService.AddVideoFrames(scope, userID, id, request.VideoID, request.From, request.To)
+	if err != nil {
+		respondDatasetError(c, err, "从视频标注添加帧失败")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("已添加 %d 帧", len(frames)),
+		"data":    frames,
+	})
+}
+
+// ListFrames 分页查询数据集中的帧，split 为 train、val、test 或 none（尚未划分），可按 video_id 过滤
+func (h *DatasetHandler) ListFrames(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	split, ok := parseSplitQuery(c)
+	if !ok {
+		return
+	}
+
+	filter := domain.FrameFilter{Split: split, Offset: (page - 1) * limit, Limit: limit}
+	if raw := c.Query("video_id"); raw != "" {
+		videoID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的视频ID"})
+			return
+		}
+		filter.VideoID = uint(videoID)
+	}
+
+	frames, total, err := h.datasetService.ListFrames(scope, id, filter)
+	if err != nil {
+		respondDatasetError(c, err, "获取帧列表失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  frames,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *DatasetHandler) GetFrame(c *gin.Context) {
+	scope, datasetID, frameID, ok := frameParams(c)
+	if !ok {
+		return
+	}
+
+	frame, err := h.datasetService.GetFrame(scope, datasetID, frameID)
+	if err != nil {
+		respondDatasetError(c, err, "获取帧失败")
+		return
+	}
+	c.JSON(http.StatusOK, frame)
+}
+
+func (h *DatasetHandler) GetFrameImage(c *gin.Context) {
+	scope, datasetID, frameID, ok := frameParams(c)
+	if !ok {
+		return
+	}
+
+	data, contentType, err := h.datasetService.GetFrameImage(scope, datasetID, frameID)
+	if err != nil {
+		respondDatasetError(c, err, "获取帧图片失败")
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// UpdateFrame 修改帧的划分（split）或标注框（boxes），未提供的字段不变
+func (h *DatasetHandler) UpdateFrame(c *gin.Context) {
+	scope, datasetID, frameID, ok := frameParams(c)
+	if !ok {
+		return
+	}
+	var update app.FrameUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	frame, err := h.datasetService.UpdateFrame(scope, datasetID, frameID, update)
+	if err != nil {
+		respondDatasetError(c, err, "更新帧失败")
+		return
+	}
+	c.JSON(http.StatusOK, frame)
+}
+
+func (h *DatasetHandler) DeleteFrame(c *gin.Context) {
+	scope, datasetID, frameID, ok := frameParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.datasetService.DeleteFrame(scope, datasetID, frameID); err != nil {
+		respondDatasetError(c, err, "删除帧失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "帧已删除"})
+}
+
+// AssignSplits 按比例随机划分训练集、验证集和测试集，例如 {"train": 0.8, "val": 0.1, "test": 0.1, "seed": 42}
+func (h *DatasetHandler) AssignSplits(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var ratio app.SplitRatio
+	if err := c.ShouldBindJSON(&ratio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	counts, err := h.datasetService.AssignSplits(scope, id, ratio)
+	if err != nil {
+		respondDatasetError(c, err, "划分数据集失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "数据集已划分",
+		"splits":  counts,
+	})
+}
+
+// Import 从 ZIP 压缩包导入带标注的图片
+// 表单字段: archive，format（coco、yolo 或 voc），可选 split（路径中没有划分信息的图片归入该划分）
+func (h *DatasetHandler) Import(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	format, err := app.ParseDatasetFormat(c.PostForm("format"))
+	if err != nil {
+		respondDatasetError(c, err, "导入数据集失败")
+		return
+	}
+	header, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供压缩包"})
+		return
+	}
+	if header.Size > maxDatasetArchiveSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "压缩包过大（最大支持512MB）"})
+		return
+	}
+	data, err := readMultipartFile(header, maxDatasetArchiveSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取压缩包失败"})
+		return
+	}
+
+	result, err := h.datasetService.Import(scope, userID, id, format, data, domain.DatasetSplit(c.PostForm("split")))
+	if err != nil {
+		respondDatasetError(c, err, "导入数据集失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已导入 %d 张图片", result.Frames),
+		"data":    result,
+	})
+}
+
+// Export 导出数据集 ZIP，format 为 coco、yolo 或 voc，可选 split 只导出一个划分
+func (h *DatasetHandler) Export(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	format, err := app.ParseDatasetFormat(c.Query("format"))
+	if err != nil {
+		respondDatasetError(c, err, "导出数据集失败")
+		return
+	}
+	split, ok := parseSplitQuery(c)
+	if !ok {
+		return
+	}
+	if _, err := h.datasetService.GetDataset(scope, id); err != nil {
+		respondDatasetError(c, err, "导出数据集失败")
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=dataset_%d_%s_%s.zip", id, format, time.Now().Format("20060102_150405")))
+	c.Status(http.StatusOK)
+	// 数据集边生成边写出，响应头发出后出错只能中断连接
+	if err := h.datasetService.Export(scope, id, format, split, c.Writer); err != nil {
+		log.Printf("导出检测数据集失败: %v", err)
+		c.Abort()
+	}
+}
+
+// frameFormRequest 读取 multipart 表单中的帧字段
+func frameFormRequest(c *gin.Context) (frameRequest, bool) {
+	request := frameRequest{Split: c.PostForm("split"), Source: c.PostForm("source")}
+	if raw := c.PostForm("video_id"); raw != "" {
+		videoID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的视频ID"})
+			return request, false
+		}
+		id := uint(videoID)
+		request.VideoID = &id
+	}
+	var ok bool
+	if request.Timestamp, ok = parseFloatForm(c, "timestamp"); !ok {
+		return request, false
+	}
+	for _, field := range []struct {
+		name string
+		dst  *int
+	}{{"width", &request.Width}, {"height", &request.Height}} {
+		if raw := c.PostForm(field.name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数值: " + field.name})
+				return request, false
+			}
+			*field.dst = v
+		}
+	}
+	if raw := c.PostForm("boxes"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &request.Boxes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的标注框数据"})
+			return request, false
+		}
+	}
+	return request, true
+}
+
+// parseSplitQuery 解析 split 查询参数，none 表示尚未划分，未提供时返回 nil
+func parseSplitQuery(c *gin.Context) (*domain.DatasetSplit, bool) {
+	raw := c.Query("split")
+	if raw == "" {
+		return nil, true
+	}
+	split := domain.DatasetSplit(raw)
+	if raw == "none" {
+		split = domain.SplitNone
+	} else if !split.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "split 只能是 train、val、test 或 none"})
+		return nil, false
+	}
+	return &split, true
+}
+
+func frameParams(c *gin.Context) (domain.TenantScope, uint, uint, bool) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return scope, 0, 0, false
+	}
+	datasetID, ok := parseUintParam(c, "id")
+	if !ok {
+		return scope, 0, 0, false
+	}
+	frameID, ok := parseUintParam(c, "frameId")
+	if !ok {
+		return scope, 0, 0, false
+	}
+	return scope, datasetID, frameID, true
+}
+
+func respondDatasetError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrDatasetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的数据集"})
+	case errors.Is(err, domain.ErrFrameNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的帧"})
+	case errors.Is(err, domain.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的类别"})
+	case errors.Is(err, domain.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的视频"})
+	case errors.Is(err, domain.ErrSpeciesNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到对应的物种"})
+	case errors.Is(err, domain.ErrImageNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "该帧没有图片"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,207 +1,276 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"image"
-	_ "image/jpeg"
-	_ "image/png"
-	"io"
+	"log"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/disintegration/imaging"
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/gin-gonic/gin"
 )
 
-type BaiduAccessTokenResponse struct {
-	AccessToken      string `json:"access_token"`
-	ExpiresIn        int    `json:"expires_in"`
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
+type FishRecognitionHandler struct {
+	recognitionService *app.RecognitionService
 }
 
-type BaiduRecognitionResult struct {
-	LogID  int64 `json:"log_id"`
-	Result []struct {
-		Name      string `json:"name"`
-		Score     string `json:"score"`
-		BaikeInfo struct {
-			BaikeURL    string `json:"baike_url"`
-			ImageURL    string `json:"image_url"`
-			Description string `json:"description"`
-		} `json:"baike_info"`
-	} `json:"result"`
-	ErrorCode int    `json:"error_code"`
-	ErrorMsg  string `json:"error_msg"`
+func NewFishRecognitionHandler(recognitionService *app.RecognitionService) *FishRecognitionHandler {
+	return &FishRecognitionHandler{recognitionService: recognitionService}
 }
 
-func FishRecognitionHandler(c *gin.Context) {
-	file, _, err := c.Request.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供图片"})
+// Recognize 识别上传图片中的鱼类，识别结果会映射到规范物种记录并保存到识别历史
+// 表单字段: image，可选 area_id、latitude、longitude，以及 enhance（none、default 或逗号分隔的预处理步骤）
+func (h *FishRecognitionHandler) Recognize(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
 		return
 	}
-	defer file.Close()
+	limitImageRequest(c)
 
-	imageData, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取图片失败"})
+	req := app.RecognitionRequest{Scope: scope, AreaID: c.PostForm("area_id"), Enhance: c.PostForm("enhance")}
+	req.UserID, _ = currentUserID(c)
+	if req.Latitude, ok = parseFloatForm(c, "latitude"); !ok {
 		return
 	}
-
-	if err := validateImage(imageData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if req.Longitude, ok = parseFloatForm(c, "longitude"); !ok {
 		return
 	}
-
-	token, err := getBaiduAccessToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取访问令牌失败: " + err.Error()})
+	if req.Image, ok = readFormImage(c, "image", true); !ok {
 		return
 	}
 
-	result, err := callBaiduAnimalAPI(token, imageData)
+	result, err := h.recognitionService.Recognize(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "识别服务调用失败: " + err.Error()})
+		respondRecognitionError(c, err, "识别失败")
 		return
 	}
 
-	if result.ErrorCode != 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("识别失败: %s (错误码: %d)", result.ErrorMsg, result.ErrorCode)})
+	c.JSON(http.StatusOK, result)
+}
+
+// ListRecognitions 分页查询当前组织的识别历史，支持按用户、状态、标签和时间范围过滤
+func (h *FishRecognitionHandler) ListRecognitions(c *gin.Context) {
+	h.listRecognitions(c, nil)
+}
+
+// ReviewQueue 等待专家审核的识别记录，即用户已确认或更正标签的记录
+func (h *FishRecognitionHandler) ReviewQueue(c *gin.Context) {
+	h.listRecognitions(c, app.ReviewQueueStatuses)
+}
+
+func (h *FishRecognitionHandler) listRecognitions(c *gin.Context, statuses []domain.RecognitionStatus) {
+	scope, ok := tenantScope(c)
+	if !ok {
 		return
 	}
-
-	if len(result.Result) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "未识别到鱼类"})
+	page, limit, ok := parsePagination(c)
+	if !ok {
 		return
 	}
-
-	var fishName, description string
-	var score float64
-
-	for _, item := range result.Result {
-		if strings.Contains(item.Name, "鱼") || isFish(item.Name) {
-			fishName = item.Name
-			score, _ = strconv.ParseFloat(item.Score, 64)
-			if item.BaikeInfo.Description != "" {
-				description = item.BaikeInfo.Description
-			}
-			break
-		}
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
 	}
 
-	if fishName == "" {
-		fishName = result.Result[0].Name
-		score, _ = strconv.ParseFloat(result.Result[0].Score, 64)
-		description = result.Result[0].BaikeInfo.Description
+	filter := domain.RecognitionFilter{
+		Statuses: statuses,
+		Label:    c.Query("label"),
+		From:     from,
+		To:       to,
+		Offset:   (page - 1) * limit,
+		Limit:    limit,
+	}
+	if raw := c.Query("status"); raw != "" && statuses == nil {
+		filter.Statuses = []domain.RecognitionStatus{domain.RecognitionStatus(raw)}
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+			return
+		}
+		filter.UserID = uint(id)
 	}
 
-	if description == "" {
-		description = "暂无详细描述信息。"
+	recognitions, total, err := h.recognitionService.ListRecognitions(scope, filter)
+	if err != nil {
+		respondRecognitionError(c, err, "获取识别记录失败")
+		return
 	}
 
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, gin.H{
-		"name":        fishName,
-		"score":       score,
-		"description": description,
+		"data":  recognitions,
+		"page":  page,
+		"limit": limit,
+		"total": total,
 	})
 }
 
-func validateImage(data []byte) error {
-	if len(data) < 1024 {
-		return fmt.Errorf("图片文件过小（至少需要1KB）")
+// GetRecognition 获取单条识别记录，包含全部候选结果
+func (h *FishRecognitionHandler) GetRecognition(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
 	}
-	if len(data) > 4*1024*1024 {
-		return fmt.Errorf("图片文件过大（最大支持4MB）")
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
 	}
-	_, format, err := image.Decode(bytes.NewReader(data))
+
+	recognition, err := h.recognitionService.GetRecognition(scope, id)
 	if err != nil {
-		return fmt.Errorf("无效的图片格式")
-	}
-	if format != "jpeg" && format != "png" {
-		return fmt.Errorf("只支持JPEG和PNG格式")
+		respondRecognitionError(c, err, "获取识别记录失败")
+		return
 	}
-	return nil
+	c.JSON(http.StatusOK, recognition)
 }
 
-func getBaiduAccessToken() (string, error) {
-	apiKey := "5aeM3caTfZUjFRbkKQ73qgDv"
-	secretKey := "hN3wIsK79UaCy6OvfPjMLNXh5B6Z44HB"
-	url := "https://aip.baidubce.com/oauth/2.0/token"
-	postData := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s", apiKey, secretKey)
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Post(url, "application/x-www-form-urlencoded", strings.NewReader(postData))
-	if err != nil {
-		return "", err
+// GetImage 获取识别时上传的原始图片
+func (h *FishRecognitionHandler) GetImage(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	data, contentType, err := h.recognitionService.GetImage(scope, id)
 	if err != nil {
-		return "", err
+		respondRecognitionError(c, err, "获取识别图片失败")
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// SubmitFeedback 识别请求者确认或更正识别标签
+func (h *FishRecognitionHandler) SubmitFeedback(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
 	}
-	var tokenResp BaiduAccessTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", err
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
 	}
-	if tokenResp.Error != "" {
-		return "", fmt.Errorf("%s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
 	}
-	return tokenResp.AccessToken, nil
-}
 
-func callBaiduAnimalAPI(token string, imageData []byte) (*BaiduRecognitionResult, error) {
-	urlStr := fmt.Sprintf("https://aip.baidubce.com/rest/2.0/image-classify/v1/animal?access_token=%s", token)
+	var request struct {
+		Label string `json:"label" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
 
-	img, _, err := image.Decode(bytes.NewReader(imageData))
+	recognition, err := h.recognitionService.SubmitFeedback(scope, principal.UserID, id, request.Label)
 	if err != nil {
-		return nil, err
+		respondRecognitionError(c, err, "提交识别反馈失败")
+		return
 	}
-	var buf bytes.Buffer
-	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
-		return nil, err
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "识别反馈已提交",
+		"data":    recognition,
+	})
+}
+
+// Review 专家审核识别标注，通过时可同时修正标签
+func (h *FishRecognitionHandler) Review(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	reviewerID, _ := currentUserID(c)
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
-	form := url.Values{}
-	form.Set("image", encoded)
-	form.Set("top_num", "6")
-	form.Set("baike_num", "1")
+	var request struct {
+		Approve *bool  `json:"approve" binding:"required"`
+		Label   string `json:"label"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("POST", urlStr, strings.NewReader(form.Encode()))
+	recognition, err := h.recognitionService.Review(scope, reviewerID, id, *request.Approve, request.Label, request.Note)
 	if err != nil {
-		return nil, err
+		respondRecognitionError(c, err, "审核识别记录失败")
+		return
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "审核完成",
+		"data":    recognition,
+	})
+}
+
+// ExportDataset 将审核通过的识别记录导出为训练数据集 ZIP
+func (h *FishRecognitionHandler) ExportDataset(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
 	}
-	defer resp.Body.Close()
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=recognition_dataset_%s.zip", time.Now().Format("20060102_150405")))
+	c.Status(http.StatusOK)
+	// 数据集边生成边写出，响应头发出后出错只能中断连接
+	if err := h.recognitionService.ExportDataset(scope, c.Writer); err != nil {
+		log.Printf("导出训练数据集失败: %v", err)
+		c.Abort()
 	}
+}
 
-	var result BaiduRecognitionResult
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, err
+// parseFloatForm 解析可选的浮点数表单字段，格式错误时写入400响应
+func parseFloatForm(c *gin.Context, name string) (*float64, bool) {
+	raw := c.PostForm(name)
+	if raw == "" {
+		return nil, true
 	}
-	return &result, nil
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数值: " + name})
+		return nil, false
+	}
+	return &v, true
 }
 
-func isFish(name string) bool {
-	keywords := []string{"鲤鱼", "草鱼", "鲈鱼", "罗非鱼", "鲫鱼", "金鱼", "鲑鱼", "鲶鱼", "鳟鱼", "石斑鱼"}
-	for _, k := range keywords {
-		if strings.Contains(name, k) {
-			return true
-		}
+func respondRecognitionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrNothingRecognized):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未识别到鱼类"})
+	case errors.Is(err, domain.ErrRecognitionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的识别记录"})
+	case errors.Is(err, domain.ErrImageNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "识别图片不存在"})
+	case errors.Is(err, domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能反馈自己的识别记录"})
+	case errors.Is(err, domain.ErrAlreadyReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": "该识别记录已审核，不能再修改"})
+	case errors.Is(err, domain.ErrRecognitionFailed):
+		log.Printf("鱼类识别 - 识别服务调用失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "识别服务调用失败，请稍后重试"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
 	}
-	return false
 }
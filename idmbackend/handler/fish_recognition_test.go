@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/MoyInGxing/idm/infra/recognition"
+	"github.com/gin-gonic/gin"
+)
+
+type memRecognitionRepo struct {
+	mu           sync.Mutex
+	recognitions []*domain.Recognition
+}
+
+func (r *memRecognitionRepo) Create(scope domain.TenantScope, rec *domain.Recognition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec.ID = uint(len(r.recognitions) + 1)
+	rec.OrgID = scope.OrgID
+	copied := *rec
+	r.recognitions = append(r.recognitions, &copied)
+	return nil
+}
+
+func (r *memRecognitionRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Recognition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range r.recognitions {
+		if rec.ID == id && rec.OrgID == scope.OrgID {
+			copied := *rec
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memRecognitionRepo) Find(scope domain.TenantScope, filter domain.RecognitionFilter) ([]*domain.Recognition, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.Recognition
+	for _, rec := range r.recognitions {
+		if rec.OrgID == scope.OrgID {
+			found = append(found, rec)
+		}
+	}
+	return found, int64(len(found)), nil
+}
+
+func (r *memRecognitionRepo) FindAfter(scope domain.TenantScope, filter domain.RecognitionFilter, afterID uint, limit int) ([]*domain.Recognition, error) {
+	return nil, nil
+}
+
+func (r *memRecognitionRepo) Update(scope domain.TenantScope, rec *domain.Recognition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.recognitions {
+		if existing.ID == rec.ID && existing.OrgID == scope.OrgID {
+			copied := *rec
+			r.recognitions[i] = &copied
+			return nil
+		}
+	}
+	return domain.ErrRecognitionNotFound
+}
+
+func (r *memRecognitionRepo) DeletePending(ids []uint) error {
+	return nil
+}
+
+func (r *memRecognitionRepo) CountByImageKey(key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, rec := range r.recognitions {
+		if rec.ImageKey == key {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (s *memBlobStore) Put(key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memBlobStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrBlobNotFound
+	}
+	return data, nil
+}
+
+func (s *memBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+// stubTaxonomyRepo 只实现识别时解析物种名称用到的查询
+type stubTaxonomyRepo struct {
+	app.TaxonomyRepository
+	species map[string]*domain.Species
+}
+
+func (r stubTaxonomyRepo) FindSpeciesByName(name string) (*domain.Species, error) {
+	return r.species[name], nil
+}
+
+type recognizerFunc func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error)
+
+func (f recognizerFunc) Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+	return f(ctx, image)
+}
+
+// testPNG 生成不易压缩的 PNG 图片，保证超过识别接口要求的最小文件大小
+func testPNG(t *testing.T, seed int64) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type recognitionFixture struct {
+	repo   *memRecognitionRepo
+	blobs  *memBlobStore
+	router *gin.Engine
+}
+
+// newRecognitionFixture 请求头 X-Test-User 和 X-Test-Org 指定请求主体，未提供时视为未认证
+func newRecognitionFixture(recognizer app.Recognizer) *recognitionFixture {
+	gin.SetMode(gin.TestMode)
+	f := &recognitionFixture{repo: &memRecognitionRepo{}, blobs: &memBlobStore{blobs: map[string][]byte{}}}
+	taxonomy := app.NewTaxonomyService(stubTaxonomyRepo{species: map[string]*domain.Species{
+		"鲤鱼": {ID: 7, SpeciesName: "鲤"},
+	}}, nil)
+	service := app.NewRecognitionService(recognizer, taxonomy, f.repo, f.blobs, app.NewImageService(nil), "")
+	h := NewFishRecognitionHandler(service)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var userID, orgID uint
+		if _, err := fmt.Sscan(c.GetHeader("X-Test-User"), &userID); err == nil {
+			fmt.Sscan(c.GetHeader("X-Test-Org"), &orgID)
+			c.Set("principal", &domain.Principal{Kind: domain.PrincipalUser, UserID: userID, Role: domain.RoleUser, OrgID: orgID})
+			c.Set("userID", userID)
+		}
+	})
+	r.POST("/api/fish-recognition", h.Recognize)
+	r.GET("/api/recognitions/:id", h.GetRecognition)
+	r.GET("/api/recognitions/:id/image", h.GetImage)
+	r.PUT("/api/recognitions/:id/label", h.SubmitFeedback)
+	f.router = r
+	return f
+}
+
+func (f *recognitionFixture) do(t *testing.T, req *http.Request, userID, orgID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	if userID != 0 {
+		req.Header.Set("X-Test-User", fmt.Sprint(userID))
+		req.Header.Set("X-Test-Org", fmt.Sprint(orgID))
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func recognizeRequest(t *testing.T, image []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if image != nil {
+		part, err := mw.CreateFormFile("image", "fish.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(image)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/fish-recognition", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestRecognizeWithMockRecognizer(t *testing.T) {
+	f := newRecognitionFixture(recognition.NewMockRecognizer([]string{"鲤鱼"}))
+	img := testPNG(t, 1)
+
+	w := f.do(t, recognizeRequest(t, img, map[string]string{"area_id": "A1", "latitude": "30.5", "longitude": "114.3"}), 5, 1)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var result domain.RecognitionResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "鲤鱼" || result.CanonicalName != "鲤" || result.RecognitionID == 0 {
+		t.Errorf("result = %+v", result)
+	}
+
+	saved := f.repo.recognitions[0]
+	if saved.UserID != 5 || saved.OrgID != 1 || saved.AreaID != "A1" || saved.SpeciesID == nil || *saved.SpeciesID != 7 {
+		t.Errorf("saved recognition = %+v", saved)
+	}
+	if saved.Status != domain.RecognitionPending {
+		t.Errorf("status = %s, want pending", saved.Status)
+	}
+
+	// 识别记录和原始图片只对本组织可见
+	path := fmt.Sprintf("/api/recognitions/%d", result.RecognitionID)
+	if w := f.do(t, httptest.NewRequest(http.MethodGet, path, nil), 5, 1); w.Code != http.StatusOK {
+		t.Errorf("get: status = %d", w.Code)
+	}
+	w = f.do(t, httptest.NewRequest(http.MethodGet, path+"/image", nil), 5, 1)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), img) {
+		t.Errorf("image: status = %d, content-type = %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := f.do(t, httptest.NewRequest(http.MethodGet, path, nil), 9, 2); w.Code != http.StatusNotFound {
+		t.Errorf("other org: status = %d, want 404", w.Code)
+	}
+}
+
+func TestRecognizeIsDeterministic(t *testing.T) {
+	f := newRecognitionFixture(recognition.NewMockRecognizer(nil))
+	img := testPNG(t, 2)
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		w := f.do(t, recognizeRequest(t, img, nil), 5, 1)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+		}
+		var result domain.RecognitionResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		names = append(names, result.Name)
+	}
+	if names[0] != names[1] {
+		t.Errorf("same image recognized as %q and %q", names[0], names[1])
+	}
+	// 同一图片按内容寻址只保存一份
+	if len(f.blobs.blobs) != 1 {
+		t.Errorf("stored blobs = %d, want 1", len(f.blobs.blobs))
+	}
+}
+
+func TestRecognizeErrors(t *testing.T) {
+	failing := recognizerFunc(func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		return nil, fmt.Errorf("%w: quota exceeded", domain.ErrRecognitionFailed)
+	})
+	empty := recognizerFunc(func(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+		return nil, nil
+	})
+	mock := recognition.NewMockRecognizer(nil)
+
+	tests := []struct {
+		name       string
+		recognizer app.Recognizer
+		image      []byte
+		fields     map[string]string
+		userID     uint
+		status     int
+		message    string
+	}{
+		{"unauthenticated", mock, testPNG(t, 3), nil, 0, http.StatusUnauthorized, "未认证"},
+		{"missing image", mock, nil, nil, 5, http.StatusBadRequest, "未提供图片"},
+		{"not an image", mock, bytes.Repeat([]byte("x"), 2048), nil, 5, http.StatusBadRequest, "无效的图片格式"},
+		{"too small", mock, []byte("tiny"), nil, 5, http.StatusBadRequest, "图片文件过小"},
+		{"too large", mock, bytes.Repeat([]byte("x"), app.MaxImageSize+1), nil, 5, http.StatusRequestEntityTooLarge, "图片文件过大"},
+		{"request too large", mock, bytes.Repeat([]byte("x"), 2*app.MaxImageSize), nil, 5, http.StatusRequestEntityTooLarge, "图片文件过大"},
+		{"invalid latitude", mock, testPNG(t, 3), map[string]string{"latitude": "north"}, 5, http.StatusBadRequest, ""},
+		{"nothing recognized", empty, testPNG(t, 3), nil, 5, http.StatusBadRequest, "未识别到鱼类"},
+		{"backend failure", failing, testPNG(t, 3), nil, 5, http.StatusBadGateway, "识别服务调用失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRecognitionFixture(tt.recognizer)
+			w := f.do(t, recognizeRequest(t, tt.image, tt.fields), tt.userID, 1)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.message) {
+				t.Errorf("body = %s, want %q", w.Body, tt.message)
+			}
+			if len(f.repo.recognitions) != 0 {
+				t.Errorf("failed request saved a recognition")
+			}
+		})
+	}
+}
+
+func TestSubmitFeedbackOnlyByRequester(t *testing.T) {
+	f := newRecognitionFixture(recognition.NewMockRecognizer([]string{"鲤鱼", "草鱼"}))
+	if w := f.do(t, recognizeRequest(t, testPNG(t, 4), nil), 5, 1); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+
+	feedback := func(userID uint) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/recognitions/1/label", strings.NewReader(`{"label":"草鱼"}`))
+		req.Header.Set("Content-Type", "application/json")
+		return f.do(t, req, userID, 1)
+	}
+	if w := feedback(6); w.Code != http.StatusForbidden {
+		t.Errorf("other user: status = %d, want 403", w.Code)
+	}
+	if w := feedback(5); w.Code != http.StatusOK {
+		t.Errorf("requester: status = %d, body = %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type ImageHandler struct {
+	imageService *app.ImageService
+}
+
+func NewImageHandler(imageService *app.ImageService) *ImageHandler {
+	return &ImageHandler{imageService: imageService}
+}
+
+// Enhance 对上传的水下照片执行预处理，返回处理后的 JPEG 图片
+// 表单字段: image，可选 steps（逗号分隔的 white_balance、clahe、dehaze、crop、resize，默认全部）
+func (h *ImageHandler) Enhance(c *gin.Context) {
+	data, ok := readFormImage(c, "image", true)
+	if !ok {
+		return
+	}
+	steps := c.PostForm("steps")
+	if steps == "" {
+		steps = c.Query("steps")
+	}
+
+	enhanced, err := h.imageService.Enhance(data, steps)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("图片预处理失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "图片预处理失败"})
+		}
+		return
+	}
+	c.Data(http.StatusOK, "image/jpeg", enhanced)
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type MFAHandler struct {
+	mfaService *app.MFAService
+}
+
+func NewMFAHandler(ms *app.MFAService) *MFAHandler {
+	return &MFAHandler{mfaService: ms}
+}
+
+// VerifyLogin 登录第二步，提交 MFA 令牌和验证码（或恢复码）换取访问令牌
+func (h *MFAHandler) VerifyLogin(c *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	tokens, user, err := h.mfaService.VerifyLogin(request.MFAToken, request.Code, c.ClientIP())
+	if err != nil {
+		respondMFAError(c, err, "两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(tokens, user))
+}
+
+// GetStatus 获取当前用户的两步验证状态
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.mfaService.Status(principal.UserID, principal.Role)
+	if err != nil {
+		respondMFAError(c, err, "获取两步验证状态失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// BeginEnrollment 生成 TOTP 密钥，返回用于生成二维码的 otpauth 地址
+func (h *MFAHandler) BeginEnrollment(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.mfaService.BeginEnrollment(principal.UserID)
+	if err != nil {
+		respondMFAError(c, err, "生成两步验证密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"message":     "请使用验证器应用扫描二维码，然后提交验证码完成绑定",
+	})
+}
+
+// ConfirmEnrollment 提交验证码完成绑定，返回只显示一次的恢复码和通过两步验证的新令牌
+func (h *MFAHandler) ConfirmEnrollment(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	codes, tokens, err := h.mfaService.ConfirmEnrollment(principal.UserID, principal.SessionID, request.Code)
+	if err != nil {
+		respondMFAError(c, err, "启用两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "两步验证已启用，请妥善保存恢复码，它们只会显示这一次",
+		"recovery_codes":     codes,
+		"token":              tokens.AccessToken,
+		"access_token":       tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	})
+}
+
+// Disable 提交验证码或恢复码后停用两步验证，全部会话随之失效，当前设备使用返回的新令牌
+func (h *MFAHandler) Disable(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	tokens, err := h.mfaService.Disable(principal.UserID, request.Code)
+	if err != nil {
+		respondMFAError(c, err, "停用两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "两步验证已停用，其他设备需要重新登录",
+		"token":              tokens.AccessToken,
+		"access_token":       tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(principal.UserID, request.Code)
+	if err != nil {
+		respondMFAError(c, err, "生成恢复码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// AdminReset 管理员移除用户的两步验证
+func (h *MFAHandler) AdminReset(c *gin.Context) {
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.AdminReset(userID); err != nil {
+		respondMFAError(c, err, "重置两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已移除该用户的两步验证并吊销其全部会话"})
+}
+
+// currentUserPrincipal 两步验证只适用于用户会话，API 密钥请求返回401
+func currentUserPrincipal(c *gin.Context) (*domain.Principal, bool) {
+	principal, ok := currentPrincipal(c)
+	if !ok || principal.Kind != domain.PrincipalUser {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "需要用户登录"})
+		return nil, false
+	}
+	return principal, true
+}
+
+func respondMFAError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+	case errors.Is(err, domain.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "两步验证已过期，请重新登录"})
+	case errors.Is(err, domain.ErrTooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "失败次数过多，请稍后再试"})
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "已启用两步验证"})
+	case errors.Is(err, domain.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用两步验证"})
+	case errors.Is(err, domain.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+	case errors.Is(err, domain.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已停用，请联系管理员"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
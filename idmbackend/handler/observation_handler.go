@@ -0,0 +1,426 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type ObservationHandler struct {
+	observationService *app.ObservationService
+}
+
+func NewObservationHandler(observationService *app.ObservationService) *ObservationHandler {
+	return &ObservationHandler{
+		observationService: observationService,
+	}
+}
+
+// observationRequest 创建和更新观测记录的请求体
+type observationRequest struct {
+	SpeciesID  uint                     `json:"species_id" binding:"required"`
+	AreaID     string                   `json:"area_id" binding:"required"`
+	ObservedAt *time.Time               `json:"observed_at"`
+	Count      int                      `json:"count"`
+	LengthCM   *float64                 `json:"length_cm"`
+	WeightG    *float64                 `json:"weight_g"`
+	Method     domain.ObservationMethod `json:"method"`
+	Notes      string                   `json:"notes"`
+}
+
+func (r *observationRequest) toObservation() *domain.Observation {
+	observation := &domain.Observation{
+		SpeciesID: r.SpeciesID,
+		AreaID:    r.AreaID,
+		Count:     r.Count,
+		LengthCM:  r.LengthCM,
+		WeightG:   r.WeightG,
+		Method:    r.Method,
+		Notes:     r.Notes,
+	}
+	if r.ObservedAt != nil {
+		observation.ObservedAt = *r.ObservedAt
+	}
+	return observation
+}
+
+// ListObservations 按物种、区域和时间范围分页查询观测记录
+func (h *ObservationHandler) ListObservations(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	filter := domain.ObservationFilter{
+		AreaID: c.Query("area_id"),
+		From:   from,
+		To:     to,
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if raw := c.Query("species_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的物种ID"})
+			return
+		}
+		filter.SpeciesID = uint(id)
+	}
+	if filter.AreaIDs, ok = areaFilter(c, filter.AreaID); !ok {
+		return
+	}
+
+	observations, total, err := h.observationService.ListObservations(scope, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取观测记录失败"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  observations,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// GetObservation 获取单条观测记录
+func (h *ObservationHandler) GetObservation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	observation, err := h.observationService.GetObservation(scope, id)
+	if err != nil {
+		respondObservationError(c, err, "获取观测记录失败")
+		return
+	}
+	if !authorizeArea(c, observation.AreaID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, observation)
+}
+
+// CreateObservation 创建观测记录，记录人为当前登录用户
+func (h *ObservationHandler) CreateObservation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	var request observationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误: " + err.Error()})
+		return
+	}
+
+	observation := request.toObservation()
+	observation.ObserverID, _ = currentUserID(c)
+	if !authorizeScope(c, observation.AreaID, nil) {
+		return
+	}
+
+	if err := h.observationService.CreateObservation(scope, observation, nil); err != nil {
+		respondObservationError(c, err, "创建观测记录失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "观测记录创建成功",
+		"data":    observation,
+	})
+}
+
+// UpdateObservation 更新观测记录
+func (h *ObservationHandler) UpdateObservation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var request observationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误: " + err.Error()})
+		return
+	}
+
+	if !h.authorizeObservationScope(c, scope, id) || !authorizeScope(c, request.AreaID, nil) {
+		return
+	}
+
+	observation := request.toObservation()
+	observation.ID = id
+	if err := h.observationService.UpdateObservation(scope, observation); err != nil {
+		respondObservationError(c, err, "更新观测记录失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "观测记录更新成功",
+		"data":    observation,
+	})
+}
+
+// DeleteObservation 删除观测记录
+func (h *ObservationHandler) DeleteObservation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if !h.authorizeObservationScope(c, scope, id) {
+		return
+	}
+
+	if err := h.observationService.DeleteObservation(scope, id); err != nil {
+		respondObservationError(c, err, "删除观测记录失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "观测记录删除成功"})
+}
+
+// UploadPhoto 为观测记录上传照片
+func (h *ObservationHandler) UploadPhoto(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if !h.authorizeObservationScope(c, scope, id) {
+		return
+	}
+
+	photo, ok := readFormImage(c, "image", true)
+	if !ok {
+		return
+	}
+
+	observation, err := h.observationService.SetPhoto(scope, id, photo)
+	if err != nil {
+		respondObservationError(c, err, "上传照片失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "照片上传成功",
+		"data":    observation,
+	})
+}
+
+// GetPhoto 获取观测记录的照片
+func (h *ObservationHandler) GetPhoto(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	observation, err := h.observationService.GetObservation(scope, id)
+	if err != nil {
+		respondObservationError(c, err, "获取照片失败")
+		return
+	}
+	if !authorizeArea(c, observation.AreaID) {
+		return
+	}
+	data, err := h.observationService.GetPhoto(scope, id)
+	if err != nil {
+		respondObservationError(c, err, "获取照片失败")
+		return
+	}
+
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
+
+// GetDiversity 计算区域的物种丰富度和 Shannon 多样性指数，未指定 area_id 时返回所有区域
+func (h *ObservationHandler) GetDiversity(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	if areaID := c.Query("area_id"); areaID != "" {
+		if !authorizeArea(c, areaID) {
+			return
+		}
+		diversity, err := h.observationService.GetAreaDiversity(scope, areaID, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "计算物种多样性失败"})
+			return
+		}
+		c.JSON(http.StatusOK, diversity)
+		return
+	}
+
+	all, err := h.observationService.GetAllAreaDiversity(scope, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算物种多样性失败"})
+		return
+	}
+	// 限定区域的 API 密钥只能看到这些区域的统计
+	principal, _ := currentPrincipal(c)
+	diversity := all[:0]
+	for _, d := range all {
+		if principal == nil || principal.AllowsArea(d.AreaID) {
+			diversity = append(diversity, d)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  diversity,
+		"total": len(diversity),
+	})
+}
+
+// ConfirmRecognition 将确认后的鱼类识别结果一步保存为观测记录
+// 表单字段: name 或 species_id、area_id、score、observed_at、count、notes，可选 image
+func (h *ObservationHandler) ConfirmRecognition(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	limitImageRequest(c)
+
+	input := app.RecognitionConfirmation{
+		Scope:  scope,
+		Name:   c.PostForm("name"),
+		AreaID: c.PostForm("area_id"),
+		Notes:  c.PostForm("notes"),
+		Count:  1,
+	}
+	input.ObserverID, _ = currentUserID(c)
+	if !authorizeScope(c, input.AreaID, nil) {
+		return
+	}
+
+	if raw := c.PostForm("species_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的物种ID"})
+			return
+		}
+		input.SpeciesID = uint(id)
+	}
+	if input.SpeciesID == 0 && input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要提供识别名称或物种ID"})
+		return
+	}
+	if raw := c.PostForm("score"); raw != "" {
+		score, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的识别置信度"})
+			return
+		}
+		input.Score = &score
+	}
+	if raw := c.PostForm("count"); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数量"})
+			return
+		}
+		input.Count = count
+	}
+	if raw := c.PostForm("observed_at"); raw != "" {
+		t, ok := parseTime(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间格式: observed_at"})
+			return
+		}
+		input.ObservedAt = t
+	}
+
+	photo, ok := readFormImage(c, "image", false)
+	if !ok {
+		return
+	}
+	input.Photo = photo
+
+	observation, err := h.observationService.ConfirmRecognition(input)
+	if err != nil {
+		respondObservationError(c, err, "保存观测记录失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "观测记录创建成功",
+		"data":    observation,
+	})
+}
+
+// authorizeObservationScope 校验记录属于当前组织，且 API 密钥有权修改该记录
+func (h *ObservationHandler) authorizeObservationScope(c *gin.Context, scope domain.TenantScope, id uint) bool {
+	observation, err := h.observationService.GetObservation(scope, id)
+	if err != nil {
+		respondObservationError(c, err, "获取观测记录失败")
+		return false
+	}
+	return authorizeScope(c, observation.AreaID, nil)
+}
+
+func respondObservationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrObservationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的观测记录"})
+	case errors.Is(err, domain.ErrSpeciesNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到对应的物种"})
+	case errors.Is(err, domain.ErrImageNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "该观测记录没有照片"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type OrgHandler struct {
+	orgService *app.OrgService
+}
+
+func NewOrgHandler(orgService *app.OrgService) *OrgHandler {
+	return &OrgHandler{orgService: orgService}
+}
+
+// ListOrganizations 获取当前用户可以进入的组织
+func (h *OrgHandler) ListOrganizations(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.orgService.ListOrganizations(principal)
+	if err != nil {
+		respondOrgError(c, err, "获取组织列表失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":           orgs,
+		"total":          len(orgs),
+		"current_org_id": principal.OrgID,
+	})
+}
+
+// SwitchOrganization 切换当前会话的组织上下文，已签发的访问令牌随即使用新组织
+func (h *OrgHandler) SwitchOrganization(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		OrgID uint `json:"org_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	org, err := h.orgService.Switch(principal, request.OrgID)
+	if err != nil {
+		respondOrgError(c, err, "切换组织失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已切换组织",
+		"data":    org,
+	})
+}
+
+// CreateOrganization 创建组织，仅平台管理员可用
+func (h *OrgHandler) CreateOrganization(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Slug string         `json:"slug" binding:"required"`
+		Name string         `json:"name" binding:"required"`
+		Kind domain.OrgKind `json:"kind"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	org := &domain.Organization{Slug: request.Slug, Name: request.Name, Kind: request.Kind}
+	if err := h.orgService.CreateOrganization(principal, org); err != nil {
+		respondOrgError(c, err, "创建组织失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "组织创建成功",
+		"data":    org,
+	})
+}
+
+// AddMember 将已有用户加入当前组织。用户可能属于其他组织，仅平台管理员可用，
+// 组织管理员应在本组织中创建新用户
+func (h *OrgHandler) AddMember(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role domain.Role `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	membership, err := h.orgService.AddMember(scope, userID, request.Role)
+	if err != nil {
+		respondOrgError(c, err, "添加组织成员失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "已加入组织",
+		"data":    membership,
+	})
+}
+
+// SetMemberRole 修改用户在当前组织中的角色
+func (h *OrgHandler) SetMemberRole(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role domain.Role `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.orgService.SetMemberRole(principal, userID, request.Role); err != nil {
+		respondOrgError(c, err, "更新用户角色失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户角色更新成功"})
+}
+
+// RemoveMember 将用户移出当前组织，不删除账号
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.orgService.RemoveMember(scope, userID); err != nil {
+		respondOrgError(c, err, "移出组织成员失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已移出组织"})
+}
+
+func respondOrgError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrOrgNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的组织"})
+	case errors.Is(err, domain.ErrNotOrgMember), errors.Is(err, domain.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+	case errors.Is(err, domain.ErrRoleNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在"})
+	case errors.Is(err, domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+	case errors.Is(err, domain.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "不能移除最后一位管理员"})
+	case errors.Is(err, domain.ErrSessionRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
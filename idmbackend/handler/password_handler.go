@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordHandler struct {
+	passwordService *app.PasswordService
+}
+
+func NewPasswordHandler(ps *app.PasswordService) *PasswordHandler {
+	return &PasswordHandler{passwordService: ps}
+}
+
+// ChangePassword 修改当前用户的密码，成功后其他设备上的会话全部失效，返回新的令牌
+func (h *PasswordHandler) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	principal, _ := currentPrincipal(c)
+	if !ok || principal == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	tokens, err := h.passwordService.ChangePassword(userID, principal.MFA, request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		respondPasswordError(c, err, "修改密码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "密码修改成功，其他设备上的登录已失效",
+		"token":              tokens.AccessToken,
+		"access_token":       tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	})
+}
+
+// ForgotPassword 按用户名或邮箱发送重置令牌，无论账号是否存在、请求是否被限流都返回相同的响应
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var request struct {
+		Identifier string `json:"identifier" binding:"required"` // 用户名或邮箱
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.passwordService.RequestReset(request.Identifier, c.ClientIP()); err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 内部错误只记录日志，响应保持一致
+		log.Printf("发送密码重置令牌失败: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果账号存在，重置密码的说明已发送"})
+}
+
+// ResetPassword 使用重置令牌设置新密码
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.passwordService.ConfirmReset(request.Token, request.NewPassword); err != nil {
+		respondPasswordError(c, err, "重置密码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// AdminResetPassword 管理员强制重置用户密码
+func (h *PasswordHandler) AdminResetPassword(c *gin.Context) {
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.passwordService.AdminResetPassword(userID); err != nil {
+		respondPasswordError(c, err, "重置用户密码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户密码已重置，重置链接已发送给该用户"})
+}
+
+func respondPasswordError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrIncorrectPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "当前密码错误"})
+	case errors.Is(err, domain.ErrInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重置令牌无效、已过期或已被使用"})
+	case errors.Is(err, domain.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxJobRequestSize 批量识别请求的大小上限，包括全部图片和压缩包
+	maxJobRequestSize = 256 << 20
+	// maxJobImageRead 单张图片最多读取的字节数，比图片大小上限多 1 字节，超限的图片由校验记为失败
+	maxJobImageRead = 4<<20 + 1
+)
+
+type RecognitionJobHandler struct {
+	jobService *app.RecognitionJobService
+}
+
+func NewRecognitionJobHandler(jobService *app.RecognitionJobService) *RecognitionJobHandler {
+	return &RecognitionJobHandler{jobService: jobService}
+}
+
+// CreateJob 提交批量识别任务，立即返回任务ID，识别在后台进行
+// 表单字段: images（可多个）和/或 archive（ZIP 压缩包），可选 area_id、latitude、longitude
+func (h *RecognitionJobHandler) CreateJob(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxJobRequestSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "上传内容过大（最大支持256MB）"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请使用 multipart/form-data 上传图片"})
+		return
+	}
+
+	req := app.RecognitionJobRequest{Scope: scope, AreaID: c.PostForm("area_id")}
+	req.UserID, _ = currentUserID(c)
+	if req.Latitude, ok = parseFloatForm(c, "latitude"); !ok {
+		return
+	}
+	if req.Longitude, ok = parseFloatForm(c, "longitude"); !ok {
+		return
+	}
+
+	for _, header := range form.File["images"] {
+		data, err := readMultipartFile(header, maxJobImageRead)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取图片失败"})
+			return
+		}
+		req.Images = append(req.Images, app.JobImage{Name: header.Filename, Data: data})
+	}
+	for _, header := range form.File["archive"] {
+		data, err := readMultipartFile(header, maxJobRequestSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取压缩包失败"})
+			return
+		}
+		if req.Images, err = app.ExtractJobImages(data, req.Images); err != nil {
+			respondRecognitionJobError(c, err, "读取压缩包失败")
+			return
+		}
+	}
+
+	job, err := h.jobService.CreateJob(req)
+	if err != nil {
+		respondRecognitionJobError(c, err, "创建批量识别任务失败")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "批量识别任务已提交",
+		"data":    job,
+	})
+}
+
+// ListJobs 分页查询当前组织的批量识别任务，可按提交人过滤
+func (h *RecognitionJobHandler) ListJobs(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	var userID uint
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+			return
+		}
+		userID = uint(id)
+	}
+
+	jobs, total, err := h.jobService.ListJobs(scope, userID, (page-1)*limit, limit)
+	if err != nil {
+		respondRecognitionJobError(c, err, "获取批量识别任务失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  jobs,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// GetJob 获取任务进度及当前的物种数量统计
+func (h *RecognitionJobHandler) GetJob(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.jobService.GetJob(scope, id)
+	if err != nil {
+		respondRecognitionJobError(c, err, "获取批量识别任务失败")
+		return
+	}
+	counts, err := h.jobService.CountLabels(scope, id)
+	if err != nil {
+		respondRecognitionJobError(c, err, "获取批量识别任务失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":     job,
+		"species": counts,
+	})
+}
+
+// GetResults 分页查询任务中每张图片的处理状态和识别结果，可按状态过滤
+func (h *RecognitionJobHandler) GetResults(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	status := domain.JobItemStatus(c.Query("status"))
+	items, total, err := h.jobService.ListItems(scope, id, status, (page-1)*limit, limit)
+	if err != nil {
+		respondRecognitionJobError(c, err, "获取识别结果失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  items,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// ExportSummary 导出任务的物种数量统计 CSV
+func (h *RecognitionJobHandler) ExportSummary(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := h.jobService.GetJob(scope, id); err != nil {
+		respondRecognitionJobError(c, err, "导出统计失败")
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=recognition_job_%d_summary.csv", id))
+	c.Status(http.StatusOK)
+	if err := h.jobService.WriteSummaryCSV(scope, id, c.Writer); err != nil {
+		log.Printf("导出批量识别统计失败: %v", err)
+		c.Abort()
+	}
+}
+
+// readMultipartFile 读取上传的文件，最多读取 limit 字节
+func readMultipartFile(header *multipart.FileHeader, limit int64) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, limit))
+}
+
+func respondRecognitionJobError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的批量识别任务"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// currentUserID 返回认证中间件写入上下文的用户ID
+func currentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("userID")
+	if !exists {
+		return 0, false
+	}
+	userID, ok := value.(uint)
+	return userID, ok
+}
+
+// currentPrincipal 返回认证中间件写入上下文的请求主体
+func currentPrincipal(c *gin.Context) (*domain.Principal, bool) {
+	value, exists := c.Get("principal")
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*domain.Principal)
+	return principal, ok && principal != nil
+}
+
+// tenantScope 返回当前请求主体所在组织的查询范围，未认证时写入401响应
+func tenantScope(c *gin.Context) (domain.TenantScope, bool) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return domain.TenantScope{}, false
+	}
+	return principal.Scope(), true
+}
+
+// authorizeScope 校验 API 密钥的区域和设备范围，超出范围时写入403响应
+func authorizeScope(c *gin.Context, areaID string, deviceID *string) bool {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return true
+	}
+	if !principal.AllowsArea(areaID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API密钥无权访问该区域"})
+		return false
+	}
+	if deviceID != nil && !principal.AllowsDevice(*deviceID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API密钥无权代表该设备提交数据"})
+		return false
+	}
+	if deviceID == nil && len(principal.DeviceIDs) > 0 && principal.Kind == domain.PrincipalAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该API密钥只能提交指定设备的数据"})
+		return false
+	}
+	return true
+}
+
+// authorizeArea 校验 API 密钥可以读取该区域的数据，超出范围时写入403响应
+func authorizeArea(c *gin.Context, areaID string) bool {
+	principal, ok := currentPrincipal(c)
+	if !ok || principal.AllowsArea(areaID) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "API密钥无权访问该区域"})
+	return false
+}
+
+// allowedAreas 返回 API 密钥限定的区域，为空表示不限区域
+func allowedAreas(c *gin.Context) []string {
+	principal, ok := currentPrincipal(c)
+	if !ok || principal.Kind != domain.PrincipalAPIKey {
+		return nil
+	}
+	return principal.AreaIDs
+}
+
+// areaFilter 校验查询的区域在 API 密钥范围内。未指定区域时返回密钥限定的区域，为空表示不限区域
+func areaFilter(c *gin.Context, areaID string) ([]string, bool) {
+	if areaID != "" {
+		return nil, authorizeArea(c, areaID)
+	}
+	return allowedAreas(c), true
+}
+
+// parseUintParam 解析路径中的数字ID，失败时直接写入400响应
+func parseUintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID: " + c.Param(name)})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parsePagination 解析 page 和 limit 查询参数，失败时直接写入400响应
+func parsePagination(c *gin.Context) (page, limit int, ok bool) {
+	page, limit = 1, defaultPageSize
+	if raw := c.Query("page"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "页码必须是大于0的整数"})
+			return 0, 0, false
+		}
+		page = v
+	}
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "每页数量必须是大于0的整数"})
+			return 0, 0, false
+		}
+		limit = v
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return page, limit, true
+}
+
+// timeLayouts 查询参数和表单中接受的时间格式
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+func parseTime(raw string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseTimeQuery 解析可选的时间查询参数，失败时直接写入400响应
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, true
+	}
+	t, ok := parseTime(raw)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间格式: " + name})
+		return nil, false
+	}
+	return &t, true
+}
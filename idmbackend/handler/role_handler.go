@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	roleService *app.RoleService
+}
+
+func NewRoleHandler(roleService *app.RoleService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+	}
+}
+
+type roleRequest struct {
+	Name        domain.Role         `json:"name"`
+	Description string              `json:"description"`
+	Permissions []domain.Permission `json:"permissions" binding:"required"`
+}
+
+// ListPermissions 获取系统定义的全部权限
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	type permissionDTO struct {
+		Name        domain.Permission `json:"name"`
+		Description string            `json:"description"`
+	}
+	permissions := make([]permissionDTO, 0, len(domain.Permissions))
+	for p, description := range domain.Permissions {
+		permissions = append(permissions, permissionDTO{Name: p, Description: description})
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{"data": permissions})
+}
+
+// ListRoles 获取全部角色
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.ListRoles()
+	if err != nil {
+		respondRoleError(c, err, "获取角色列表失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  roles,
+		"total": len(roles),
+	})
+}
+
+// CreateRole 创建自定义角色。角色对所有组织生效，仅平台管理员可用
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var request roleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	role := &domain.RoleDefinition{
+		Name:        request.Name,
+		Description: request.Description,
+		Permissions: request.Permissions,
+	}
+	if err := h.roleService.CreateRole(role); err != nil {
+		respondRoleError(c, err, "创建角色失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "角色创建成功",
+		"data":    role,
+	})
+}
+
+// UpdateRole 更新自定义角色，仅平台管理员可用
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var request roleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	role := &domain.RoleDefinition{
+		Name:        domain.Role(c.Param("name")),
+		Description: request.Description,
+		Permissions: request.Permissions,
+	}
+	if err := h.roleService.UpdateRole(role); err != nil {
+		respondRoleError(c, err, "更新角色失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "角色更新成功",
+		"data":    role,
+	})
+}
+
+// DeleteRole 删除自定义角色，仅平台管理员可用
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if err := h.roleService.DeleteRole(domain.Role(c.Param("name"))); err != nil {
+		respondRoleError(c, err, "删除角色失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色删除成功"})
+}
+
+// AssignUserRole 更新用户的全局角色，仅平台管理员可用。组织内的角色通过成员管理修改
+func (h *RoleHandler) AssignUserRole(c *gin.Context) {
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Role domain.Role `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.roleService.AssignRole(userID, request.Role); err != nil {
+		respondRoleError(c, err, "更新用户角色失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户角色更新成功"})
+}
+
+// GetMyPermissions 获取当前用户的角色和实际拥有的权限，API 密钥返回密钥自身的权限和范围
+func (h *RoleHandler) GetMyPermissions(c *gin.Context) {
+	if principal, ok := currentPrincipal(c); ok && principal.Kind == domain.PrincipalAPIKey {
+		c.JSON(http.StatusOK, gin.H{
+			"api_key":     principal.Name,
+			"permissions": principal.Permissions,
+			"area_ids":    principal.AreaIDs,
+			"device_ids":  principal.DeviceIDs,
+		})
+		return
+	}
+
+	value, _ := c.Get("userRole")
+	role, _ := value.(domain.Role)
+
+	permissions, err := h.roleService.EffectivePermissions(role)
+	if err != nil && !errors.Is(err, domain.ErrRoleNotFound) {
+		respondRoleError(c, err, "获取权限失败")
+		return
+	}
+	if permissions == nil {
+		permissions = []domain.Permission{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":        role,
+		"permissions": permissions,
+	})
+}
+
+func respondRoleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的角色"})
+	case errors.Is(err, domain.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+	case errors.Is(err, domain.ErrBuiltInRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "内置角色不可修改"})
+	case errors.Is(err, domain.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "仍有用户使用该角色，无法删除"})
+	case errors.Is(err, domain.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "不能移除最后一位管理员"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/gin-gonic/gin"
 )
 
@@ -30,9 +34,9 @@ func (h *SpeciesHandler) GetAllSpecies(c *gin.Context) {
 	c.JSON(http.StatusOK, species)
 }
 
-// CreateSpecies 批量创建物种数据
+// CreateSpecies 批量创建物种数据，任意一条无效时全部不写入
 func (h *SpeciesHandler) CreateSpecies(c *gin.Context) {
-	var speciesData []map[string]interface{}
+	var speciesData []app.SpeciesInput
 	if err := c.ShouldBindJSON(&speciesData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误"})
 		return
@@ -43,27 +47,126 @@ func (h *SpeciesHandler) CreateSpecies(c *gin.Context) {
 		return
 	}
 
-	createdCount, err := h.speciesService.CreateSpeciesBatch(speciesData)
+	report, err := h.speciesService.CreateSpeciesBatch(speciesData)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建物种数据失败: " + err.Error()})
 		return
 	}
 
+	if len(report.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "物种数据校验失败，未写入任何数据",
+			"report": report,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "物种数据创建成功",
-		"created_count": createdCount,
+		"message":       "物种数据创建成功",
+		"created_count": report.Imported,
+		"report":        report,
 	})
 }
 
+// maxImportRequestSize 物种导入请求的大小上限
+const maxImportRequestSize = 32 << 20
+
+// ImportSpecies 从 CSV、XLSX 或 Darwin Core Archive 文件导入物种
+// 查询参数: format（默认按文件扩展名判断）、mode（all_or_nothing/skip_invalid）、dry_run
+func (h *SpeciesHandler) ImportSpecies(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportRequestSize)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "导入文件过大（最大支持32MB）"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供导入文件"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取导入文件失败"})
+		return
+	}
+
+	format := app.ImportFormat(strings.ToLower(c.Query("format")))
+	if format == "" {
+		format = formatFromFilename(header.Filename)
+	}
+
+	opts := app.ImportOptions{
+		Format: format,
+		Mode:   app.ImportMode(c.DefaultQuery("mode", string(app.ImportAllOrNothing))),
+		DryRun: c.Query("dry_run") == "true" || c.Query("dry_run") == "1",
+	}
+
+	report, err := h.speciesService.ImportSpecies(data, opts)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入物种数据失败: " + err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if !opts.DryRun && report.Imported == 0 && len(report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// ExportSpecies 导出物种数据，format 可选 csv（默认）、xlsx、dwca
+func (h *SpeciesHandler) ExportSpecies(c *gin.Context) {
+	format := app.ImportFormat(strings.ToLower(c.DefaultQuery("format", string(app.FormatCSV))))
+
+	data, err := h.speciesService.ExportSpecies(format)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出物种数据失败"})
+		return
+	}
+
+	contentType, ext := "text/csv; charset=utf-8", "csv"
+	switch format {
+	case app.FormatXLSX:
+		contentType, ext = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"
+	case app.FormatDwCA:
+		contentType, ext = "application/zip", "zip"
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=species_%s.%s", time.Now().Format("20060102_150405"), ext))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func formatFromFilename(filename string) app.ImportFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return app.FormatXLSX
+	case ".zip":
+		return app.FormatDwCA
+	default:
+		return app.FormatCSV
+	}
+}
+
 // ExportDatabaseSchema 导出数据库表结构信息为Markdown格式
 func (h *SpeciesHandler) ExportDatabaseSchema(c *gin.Context) {
 	// 生成数据库表结构的Markdown文档
 	markdown := generateDatabaseSchemaMarkdown()
-	
+
 	// 设置响应头
 	c.Header("Content-Type", "text/markdown; charset=utf-8")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=database_schema_%s.md", time.Now().Format("20060102_150405")))
-	
+
 	// 返回Markdown内容
 	c.String(http.StatusOK, markdown)
 }
@@ -71,21 +174,21 @@ func (h *SpeciesHandler) ExportDatabaseSchema(c *gin.Context) {
 // generateDatabaseSchemaMarkdown 生成数据库表结构的Markdown文档
 func generateDatabaseSchemaMarkdown() string {
 	var builder strings.Builder
-	
+
 	// 文档标题和说明
 	builder.WriteString("# 海洋视觉系统数据库表结构文档\n\n")
 	builder.WriteString(fmt.Sprintf("**生成时间**: %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
 	builder.WriteString("**数据库名称**: idm\n\n")
 	builder.WriteString("**字符集**: utf8mb4\n\n")
 	builder.WriteString("---\n\n")
-	
+
 	// 目录
 	builder.WriteString("## 目录\n\n")
 	builder.WriteString("- [1. 用户表 (users)](#1-用户表-users)\n")
 	builder.WriteString("- [2. 会话表 (sessions)](#2-会话表-sessions)\n")
 	builder.WriteString("- [3. 物种表 (species)](#3-物种表-species)\n\n")
 	builder.WriteString("---\n\n")
-	
+
 	// 用户表
 	builder.WriteString("## 1. 用户表 (users)\n\n")
 	builder.WriteString("**表名**: `users`\n\n")
@@ -97,18 +200,18 @@ func generateDatabaseSchemaMarkdown() string {
 	builder.WriteString("| username | string | UNIQUE, NOT NULL | - | 用户名，必须唯一 |\n")
 	builder.WriteString("| password | string | NOT NULL | - | 加密后的密码 |\n")
 	builder.WriteString("| role | varchar(10) | - | 'user' | 用户角色：admin(管理员) 或 user(普通用户) |\n\n")
-	
+
 	builder.WriteString("**索引**:\n")
 	builder.WriteString("- PRIMARY KEY: `id`\n")
 	builder.WriteString("- UNIQUE INDEX: `username`\n\n")
-	
+
 	builder.WriteString("**示例数据**:\n")
 	builder.WriteString("```sql\n")
 	builder.WriteString("INSERT INTO users (username, password, role) VALUES\n")
 	builder.WriteString("('admin', '$2a$10$...', 'admin'),\n")
 	builder.WriteString("('user1', '$2a$10$...', 'user');\n")
 	builder.WriteString("```\n\n")
-	
+
 	// 会话表
 	builder.WriteString("## 2. 会话表 (sessions)\n\n")
 	builder.WriteString("**表名**: `sessions`\n\n")
@@ -120,16 +223,16 @@ func generateDatabaseSchemaMarkdown() string {
 	builder.WriteString("| user_id | uint | INDEX | - | 关联的用户ID |\n")
 	builder.WriteString("| token | string | UNIQUE, NOT NULL | - | 会话令牌 |\n")
 	builder.WriteString("| expiry | time.Time | INDEX | - | 会话过期时间 |\n\n")
-	
+
 	builder.WriteString("**索引**:\n")
 	builder.WriteString("- PRIMARY KEY: `id`\n")
 	builder.WriteString("- UNIQUE INDEX: `token`\n")
 	builder.WriteString("- INDEX: `user_id`\n")
 	builder.WriteString("- INDEX: `expiry`\n\n")
-	
+
 	builder.WriteString("**外键关系**:\n")
 	builder.WriteString("- `user_id` → `users.id`\n\n")
-	
+
 	// 物种表
 	builder.WriteString("## 3. 物种表 (species)\n\n")
 	builder.WriteString("**表名**: `species`\n\n")
@@ -148,17 +251,17 @@ func generateDatabaseSchemaMarkdown() string {
 	builder.WriteString("| height | float64 | NOT NULL | - | 高度（厘米） |\n")
 	builder.WriteString("| width | float64 | NOT NULL | - | 宽度（厘米） |\n")
 	builder.WriteString("| optimal_temp_range | string | NOT NULL | - | 适宜温度范围 |\n\n")
-	
+
 	builder.WriteString("**索引**:\n")
 	builder.WriteString("- PRIMARY KEY: `id`\n\n")
-	
+
 	builder.WriteString("**示例数据**:\n")
 	builder.WriteString("```sql\n")
 	builder.WriteString("INSERT INTO species (species_name, scientific_name, category, weight, length1, length2, length3, height, width, optimal_temp_range) VALUES\n")
 	builder.WriteString("('带鱼', 'Trichiurus lepturus', '鱼类', 500.0, 35.0, 32.0, 30.0, 8.0, 3.0, '15-25°C'),\n")
 	builder.WriteString("('黄花鱼', 'Larimichthys crocea', '鱼类', 300.0, 25.0, 23.0, 21.0, 6.0, 4.0, '18-28°C');\n")
 	builder.WriteString("```\n\n")
-	
+
 	// 数据库关系图
 	builder.WriteString("## 数据库关系图\n\n")
 	builder.WriteString("```\n")
@@ -185,7 +288,7 @@ func generateDatabaseSchemaMarkdown() string {
 	builder.WriteString("│ optimal_temp_range  │\n")
 	builder.WriteString("└─────────────────────┘\n")
 	builder.WriteString("```\n\n")
-	
+
 	// 使用说明
 	builder.WriteString("## 使用说明\n\n")
 	builder.WriteString("### 数据库连接\n")
@@ -194,43 +297,43 @@ func generateDatabaseSchemaMarkdown() string {
 	builder.WriteString("dsn := \"lmyx:1@tcp(localhost:3306)/idm?charset=utf8mb4&parseTime=True&loc=Local\"\n")
 	builder.WriteString("db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})\n")
 	builder.WriteString("```\n\n")
-	
+
 	builder.WriteString("### 自动迁移\n")
 	builder.WriteString("```go\n")
 	builder.WriteString("// 自动创建表结构\n")
 	builder.WriteString("db.AutoMigrate(&domain.User{}, &domain.Session{}, &domain.Species{})\n")
 	builder.WriteString("```\n\n")
-	
+
 	builder.WriteString("### API接口\n")
 	builder.WriteString("- `GET /api/species` - 获取所有物种数据\n")
 	builder.WriteString("- `GET /api/database/schema` - 导出数据库表结构文档\n")
 	builder.WriteString("- `POST /api/auth/login` - 用户登录\n")
 	builder.WriteString("- `POST /api/auth/register` - 用户注册\n")
 	builder.WriteString("- `POST /api/auth/logout` - 用户登出\n\n")
-	
+
 	// 维护说明
 	builder.WriteString("## 维护说明\n\n")
 	builder.WriteString("### 备份数据库\n")
 	builder.WriteString("```bash\n")
 	builder.WriteString("mysqldump -u lmyx -p1 idm > backup_$(date +%Y%m%d_%H%M%S).sql\n")
 	builder.WriteString("```\n\n")
-	
+
 	builder.WriteString("### 查看表结构\n")
 	builder.WriteString("```sql\n")
 	builder.WriteString("DESCRIBE users;\n")
 	builder.WriteString("DESCRIBE sessions;\n")
 	builder.WriteString("DESCRIBE species;\n")
 	builder.WriteString("```\n\n")
-	
+
 	builder.WriteString("### 查看表数据\n")
 	builder.WriteString("```sql\n")
 	builder.WriteString("SELECT COUNT(*) FROM users;\n")
 	builder.WriteString("SELECT COUNT(*) FROM sessions;\n")
 	builder.WriteString("SELECT COUNT(*) FROM species;\n")
 	builder.WriteString("```\n\n")
-	
+
 	builder.WriteString("---\n\n")
 	builder.WriteString("*本文档由系统自动生成，如有疑问请联系开发团队。*\n")
-	
+
 	return builder.String()
 }
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/gin-gonic/gin"
+)
+
+func TestImportSpeciesRejectsOversizedRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// 请求体在读取时即被拒绝，不会调用到物种服务
+	r.POST("/species/import", NewSpeciesHandler(app.NewSpeciesService(nil)).ImportSpecies)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "species.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("a"), maxImportRequestSize+1))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/species/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413: %s", w.Code, w.Body.String())
+	}
+}
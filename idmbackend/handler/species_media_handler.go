@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type SpeciesMediaHandler struct {
+	mediaService *app.SpeciesMediaService
+}
+
+func NewSpeciesMediaHandler(mediaService *app.SpeciesMediaService) *SpeciesMediaHandler {
+	return &SpeciesMediaHandler{
+		mediaService: mediaService,
+	}
+}
+
+// ListImages 获取物种图库
+func (h *SpeciesMediaHandler) ListImages(c *gin.Context) {
+	speciesID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	images, err := h.mediaService.ListImages(speciesID)
+	if err != nil {
+		respondMediaError(c, err, "获取物种图片失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  images,
+		"total": len(images),
+	})
+}
+
+// UploadImage 上传物种图片
+func (h *SpeciesMediaHandler) UploadImage(c *gin.Context) {
+	speciesID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	data, ok := readFormImage(c, "image", true)
+	if !ok {
+		return
+	}
+
+	image, created, err := h.mediaService.UploadImage(speciesID, data, c.PostForm("caption"))
+	if err != nil {
+		respondMediaError(c, err, "上传物种图片失败")
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "图片已存在",
+			"data":    image,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "图片上传成功",
+		"data":    image,
+	})
+}
+
+// GetImageContent 获取图片内容，size 参数可选 small/medium/large
+func (h *SpeciesMediaHandler) GetImageContent(c *gin.Context) {
+	speciesID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := parseUintParam(c, "image_id")
+	if !ok {
+		return
+	}
+
+	data, mimeType, err := h.mediaService.GetImageContent(speciesID, imageID, c.Query("size"))
+	if err != nil {
+		respondMediaError(c, err, "获取图片失败")
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, mimeType, data)
+}
+
+// SetPrimaryImage 设置物种主图
+func (h *SpeciesMediaHandler) SetPrimaryImage(c *gin.Context) {
+	speciesID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := parseUintParam(c, "image_id")
+	if !ok {
+		return
+	}
+
+	if err := h.mediaService.SetPrimaryImage(speciesID, imageID); err != nil {
+		respondMediaError(c, err, "设置主图失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "主图设置成功"})
+}
+
+// DeleteImage 删除物种图片
+func (h *SpeciesMediaHandler) DeleteImage(c *gin.Context) {
+	speciesID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := parseUintParam(c, "image_id")
+	if !ok {
+		return
+	}
+
+	if err := h.mediaService.DeleteImage(speciesID, imageID); err != nil {
+		respondMediaError(c, err, "删除图片失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "图片删除成功"})
+}
+
+func respondMediaError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrSpeciesNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的物种"})
+	case errors.Is(err, domain.ErrImageNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的图片"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
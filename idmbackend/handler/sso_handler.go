@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type SSOHandler struct {
+	ssoService *app.SSOService
+}
+
+func NewSSOHandler(ssoService *app.SSOService) *SSOHandler {
+	return &SSOHandler{
+		ssoService: ssoService,
+	}
+}
+
+// Login 跳转到身份提供方登录，?redirect=false 时以 JSON 返回授权地址
+func (h *SSOHandler) Login(c *gin.Context) {
+	authURL, err := h.ssoService.Begin(c.Request.Context())
+	if err != nil {
+		respondSSOError(c, err)
+		return
+	}
+
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, gin.H{"auth_url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 身份提供方回调，校验授权结果并签发本地令牌，启用两步验证的用户返回 MFA 令牌
+func (h *SSOHandler) Callback(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":       "单点登录失败",
+			"provider":    e,
+			"description": c.Query("error_description"),
+		})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 code 或 state 参数"})
+		return
+	}
+
+	result, err := h.ssoService.Callback(c.Request.Context(), state, code, c.ClientIP())
+	if err != nil {
+		respondSSOError(c, err)
+		return
+	}
+
+	// 启用了两步验证的用户需要再提交验证码到 /api/login/mfa
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"expires_in":   result.MFAExpiresIn,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(result.Tokens, result.User))
+}
+
+func respondSSOError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrSSODisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+	case errors.Is(err, domain.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已停用"})
+	case errors.Is(err, domain.ErrInvalidSSOState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "登录请求无效或已过期，请重新登录"})
+	case errors.Is(err, domain.ErrInvalidSSOToken):
+		log.Printf("单点登录令牌校验失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "单点登录验证失败"})
+	default:
+		log.Printf("单点登录失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "单点登录失败，请稍后重试"})
+	}
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type TaxonomyHandler struct {
+	taxonomyService *app.TaxonomyService
+}
+
+func NewTaxonomyHandler(taxonomyService *app.TaxonomyService) *TaxonomyHandler {
+	return &TaxonomyHandler{
+		taxonomyService: taxonomyService,
+	}
+}
+
+// CreateTaxon 创建分类单元
+func (h *TaxonomyHandler) CreateTaxon(c *gin.Context) {
+	var taxon domain.Taxon
+	if err := c.ShouldBindJSON(&taxon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误: " + err.Error()})
+		return
+	}
+	taxon.ID = 0
+
+	if err := h.taxonomyService.CreateTaxon(&taxon); err != nil {
+		respondTaxonomyError(c, err, "创建分类单元失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "分类单元创建成功",
+		"data":    taxon,
+	})
+}
+
+// GetTaxon 获取分类单元及其从界开始的完整分类路径
+func (h *TaxonomyHandler) GetTaxon(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	lineage, err := h.taxonomyService.GetLineage(id)
+	if err != nil {
+		respondTaxonomyError(c, err, "获取分类单元失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    lineage[len(lineage)-1],
+		"lineage": lineage,
+	})
+}
+
+// GetChildTaxa 获取分类单元的直接下级
+func (h *TaxonomyHandler) GetChildTaxa(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	children, err := h.taxonomyService.GetChildTaxa(id)
+	if err != nil {
+		respondTaxonomyError(c, err, "获取下级分类单元失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  children,
+		"total": len(children),
+	})
+}
+
+// ResolveSpecies 将任意俗名、异名或学名解析为规范物种
+func (h *TaxonomyHandler) ResolveSpecies(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名称不能为空"})
+		return
+	}
+
+	species, err := h.taxonomyService.ResolveSpecies(name)
+	if err != nil {
+		respondTaxonomyError(c, err, "解析物种名称失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query": name,
+		"data":  species,
+	})
+}
+
+// GetSpeciesNames 获取物种的所有名称
+func (h *TaxonomyHandler) GetSpeciesNames(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	names, err := h.taxonomyService.GetSpeciesNames(id)
+	if err != nil {
+		respondTaxonomyError(c, err, "获取物种名称失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  names,
+		"total": len(names),
+	})
+}
+
+// AddSpeciesName 为物种添加俗名或异名
+func (h *TaxonomyHandler) AddSpeciesName(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var name domain.SpeciesName
+	if err := c.ShouldBindJSON(&name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误: " + err.Error()})
+		return
+	}
+	name.ID = 0
+	name.SpeciesID = id
+
+	if err := h.taxonomyService.AddSpeciesName(&name); err != nil {
+		respondTaxonomyError(c, err, "添加物种名称失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "物种名称添加成功",
+		"data":    name,
+	})
+}
+
+// DeleteSpeciesName 删除物种名称
+func (h *TaxonomyHandler) DeleteSpeciesName(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	nameID, ok := parseUintParam(c, "name_id")
+	if !ok {
+		return
+	}
+
+	if err := h.taxonomyService.DeleteSpeciesName(id, nameID); err != nil {
+		respondTaxonomyError(c, err, "删除物种名称失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "物种名称删除成功"})
+}
+
+// LinkSpeciesTaxon 将物种关联到种级分类单元
+func (h *TaxonomyHandler) LinkSpeciesTaxon(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		TaxonID uint `json:"taxon_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	species, err := h.taxonomyService.LinkSpeciesTaxon(id, request.TaxonID)
+	if err != nil {
+		respondTaxonomyError(c, err, "关联分类单元失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "分类单元关联成功",
+		"data":    species,
+	})
+}
+
+func respondTaxonomyError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrSpeciesNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的物种"})
+	case errors.Is(err, domain.ErrTaxonNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的分类单元"})
+	case errors.Is(err, domain.ErrSpeciesNameNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的物种名称"})
+	case errors.Is(err, domain.ErrInvalidTaxonRank), errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImageRequestSize 上传单张图片的请求体上限，为其他表单字段留出余量
+const maxImageRequestSize = app.MaxImageSize + 1<<20
+
+// limitImageRequest 限制只上传一张图片的请求体大小，需要在读取任何表单字段之前调用
+func limitImageRequest(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageRequestSize)
+}
+
+// readFormImage 读取表单中的图片文件，required 为 false 时允许缺省。
+// 表单尚未解析时先限制请求体大小，读取时最多读到图片上限多一个字节，超过上限时写入413响应
+func readFormImage(c *gin.Context, field string, required bool) ([]byte, bool) {
+	if c.Request.MultipartForm == nil {
+		limitImageRequest(c)
+	}
+	file, _, err := c.Request.FormFile(field)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "图片文件过大（最大支持4MB）"})
+			return nil, false
+		case !required && (errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart)):
+			return nil, true
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供图片"})
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, app.MaxImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取图片失败"})
+		return nil, false
+	}
+	if len(data) > app.MaxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "图片文件过大（最大支持4MB）"})
+		return nil, false
+	}
+	return data, true
+}
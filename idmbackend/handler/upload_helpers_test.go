@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadFormImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/required", func(c *gin.Context) {
+		if data, ok := readFormImage(c, "image", true); ok {
+			c.JSON(http.StatusOK, gin.H{"size": len(data)})
+		}
+	})
+	r.POST("/optional", func(c *gin.Context) {
+		if data, ok := readFormImage(c, "image", false); ok {
+			c.JSON(http.StatusOK, gin.H{"size": len(data)})
+		}
+	})
+
+	tests := []struct {
+		name  string
+		path  string
+		image []byte
+		want  int
+	}{
+		{"image within limit", "/required", make([]byte, 2048), http.StatusOK},
+		{"image over the limit", "/required", make([]byte, app.MaxImageSize+1), http.StatusRequestEntityTooLarge},
+		{"body over the request limit", "/required", make([]byte, maxImageRequestSize+1), http.StatusRequestEntityTooLarge},
+		{"missing required image", "/required", nil, http.StatusBadRequest},
+		{"missing optional image", "/optional", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			form.WriteField("area_id", "pond-a")
+			if tt.image != nil {
+				part, err := form.CreateFormFile("image", "fish.jpg")
+				if err != nil {
+					t.Fatal(err)
+				}
+				part.Write(tt.image)
+			}
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/MoyInGxing/idm/app"
 	"github.com/MoyInGxing/idm/domain"
@@ -10,12 +13,15 @@ import (
 )
 
 type UserHandler struct {
-	userService *app.UserService
-	authService *app.AuthService
+	userService  *app.UserService
+	authService  *app.AuthService
+	mfaService   *app.MFAService
+	orgService   *app.OrgService
+	auditService *app.AuditService
 }
 
-func NewUserHandler(us *app.UserService, as *app.AuthService) *UserHandler {
-	return &UserHandler{userService: us, authService: as}
+func NewUserHandler(us *app.UserService, as *app.AuthService, ms *app.MFAService, os *app.OrgService, audit *app.AuditService) *UserHandler {
+	return &UserHandler{userService: us, authService: as, mfaService: ms, orgService: os, auditService: audit}
 }
 
 type RegistrationRequest struct {
@@ -53,16 +59,28 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	// 使用UserService创建新用户
-	user, err := h.userService.RegisterUser(request.Username, request.Password)
+	user, err := h.userService.RegisterUser(request.Username, request.Password, request.Email, request.Phone)
 	if err != nil {
 		if err == domain.ErrUserAlreadyExists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在"})
 			return
 		}
+		if errors.Is(err, domain.ErrWeakPassword) || errors.Is(err, domain.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("注册失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败，请稍后重试"})
 		return
 	}
+	recordAudit(c, h.auditService, &domain.AuditEntry{
+		ActorKind:  string(domain.PrincipalUser),
+		ActorID:    user.ID,
+		ActorName:  user.Username,
+		Action:     domain.AuditRegister,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "注册成功",
@@ -85,76 +103,250 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 从数据库验证用户
-	user, err := h.userService.ValidateUser(request.Username, request.Password)
+	result, err := h.mfaService.Login(request.Username, request.Password, c.ClientIP())
 	if err != nil {
 		if err == domain.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 			return
 		}
+		if err == domain.ErrAccountDisabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账号已停用，请联系管理员"})
+			return
+		}
+		var throttled *app.ThrottledError
+		if errors.As(err, &throttled) {
+			seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "登录失败次数过多，请稍后再试", "retry_after": seconds})
+			return
+		}
+		log.Printf("登录失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败，请稍后重试"})
 		return
 	}
 
-	// 生成JWT token
-	token, err := h.authService.GenerateToken(user.ID, user.Role)
+	// 启用了两步验证的用户需要再提交验证码到 /api/login/mfa
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"expires_in":   result.MFAExpiresIn,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(result.Tokens, result.User))
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌和刷新令牌
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	tokens, user, err := h.authService.Refresh(request.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		respondSessionError(c, err, "刷新token失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+	c.JSON(http.StatusOK, tokenResponse(tokens, user))
+}
+
+// Logout 吊销刷新令牌所属的会话，访问令牌过期后也可调用
+func (h *UserHandler) Logout(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	userID, err := h.authService.Logout(request.RefreshToken)
+	if err != nil && err != domain.ErrInvalidRefreshToken {
+		log.Printf("登出失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败，请稍后重试"})
+		return
+	}
+	if userID != 0 {
+		recordAudit(c, h.auditService, &domain.AuditEntry{
+			ActorKind:  string(domain.PrincipalUser),
+			ActorID:    userID,
+			Action:     domain.AuditLogout,
+			TargetType: "user",
+			TargetID:   strconv.FormatUint(uint64(userID), 10),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已登出"})
+}
+
+// LogoutAll 吊销当前用户在所有设备上的会话
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	if err := h.authService.LogoutAll(userID); err != nil {
+		log.Printf("登出所有设备失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败，请稍后重试"})
+		return
+	}
+	h.recordSelf(c, domain.AuditLogoutAll, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已在所有设备上登出"})
+}
+
+func tokenResponse(tokens *app.TokenPair, user *domain.User) gin.H {
+	return gin.H{
+		"token":              tokens.AccessToken,
+		"access_token":       tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"role":     user.Role,
 		},
-	})
+	}
 }
 
+func respondSessionError(c *gin.Context, err error, message string) {
+	switch err {
+	case domain.ErrInvalidRefreshToken, domain.ErrSessionRevoked:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新token无效或已过期，请重新登录"})
+	case domain.ErrRefreshTokenReused:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "检测到刷新token被重复使用，该会话已被吊销，请重新登录"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// GetProfile 获取当前用户的资料，role 为用户在当前组织中的角色
 func (h *UserHandler) GetProfile(c *gin.Context) {
-	// 从上下文中获取用户信息
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
 		return
 	}
 
-	// 获取用户角色和用户名
-	userRole, _ := c.Get("userRole")
-	username, _ := c.Get("username")
+	user, err := h.userService.GetUserByID(principal.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+		return
+	}
 
-	// 返回用户信息
 	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":       userID,
-			"username": username,
-			"role":     userRole,
-		},
+		"user":           user.Profile(),
+		"org_id":         principal.OrgID,
+		"role":           principal.Role,
+		"platform_admin": principal.PlatformAdmin,
 	})
 }
 
-func (h *UserHandler) GetAdminDashboard(c *gin.Context) {
-	// 从上下文中获取用户角色
-	userRole, exists := c.Get("userRole")
-	if !exists {
-		log.Printf("管理员仪表板 - 未找到用户角色")
-		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+// UpdateProfile 修改当前用户的显示名称、联系方式、语言和时区
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
 		return
 	}
 
-	log.Printf("管理员仪表板 - 当前用户角色: %v", userRole)
+	var request struct {
+		DisplayName string `json:"display_name"`
+		Email       string `json:"email"`
+		Phone       string `json:"phone"`
+		Locale      string `json:"locale"`
+		Timezone    string `json:"timezone"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
 
-	// 检查是否是管理员
-	if userRole != "admin" {
-		log.Printf("管理员仪表板 - 用户角色不是管理员: %v", userRole)
-		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+	user, err := h.userService.UpdateProfile(principal.UserID, app.ProfileInput{
+		DisplayName: request.DisplayName,
+		Email:       request.Email,
+		Phone:       request.Phone,
+		Locale:      request.Locale,
+		Timezone:    request.Timezone,
+	})
+	if err != nil {
+		respondUserError(c, err, "更新用户资料失败")
 		return
 	}
+	h.recordSelf(c, domain.AuditProfileUpdate, principal.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "用户资料更新成功",
+		"data":    user.Profile(),
+	})
+}
 
-	log.Printf("管理员仪表板 - 访问成功")
+// UploadAvatar 上传当前用户的头像
+func (h *UserHandler) UploadAvatar(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
 
+	data, ok := readFormImage(c, "image", true)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.SetAvatar(principal.UserID, data)
+	if err != nil {
+		respondUserError(c, err, "上传头像失败")
+		return
+	}
+	h.recordSelf(c, domain.AuditAvatarUpdate, principal.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "头像上传成功",
+		"data":    user.Profile(),
+	})
+}
+
+// GetAvatar 获取用户头像，只能查看自己或同一组织成员的头像
+func (h *UserHandler) GetAvatar(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if userID != principal.UserID || principal.Kind != domain.PrincipalUser {
+		if err := h.orgService.EnsureMember(principal, userID); err != nil {
+			respondUserError(c, err, "获取头像失败")
+			return
+		}
+	}
+
+	data, err := h.userService.GetAvatar(userID)
+	if err != nil {
+		respondUserError(c, err, "获取头像失败")
+		return
+	}
+
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
+
+// GetAdminDashboard 管理员仪表板，访问权限由路由上的 dashboard:view 控制
+func (h *UserHandler) GetAdminDashboard(c *gin.Context) {
 	// TODO: 实现实际的管理员仪表板数据获取逻辑
 	c.JSON(http.StatusOK, gin.H{
 		"message": "管理员仪表板数据",
@@ -165,70 +357,162 @@ func (h *UserHandler) GetAdminDashboard(c *gin.Context) {
 	})
 }
 
-// GetAllUsers 获取所有用户
+// GetAllUsers 分页查询当前组织的成员，支持按关键字、角色和账号状态过滤，角色为成员在本组织中的角色
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	log.Printf("开始获取用户列表")
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
 
-	users, err := h.userService.GetAllUsers()
-	if err != nil {
-		log.Printf("获取用户列表失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+	filter := domain.UserFilter{
+		Query:  c.Query("q"),
+		Role:   domain.Role(c.Query("role")),
+		Status: domain.UserStatus(c.Query("status")),
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	switch filter.Status {
+	case "", domain.UserStatusActive, domain.UserStatusDisabled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的账号状态，可选值为 active 或 disabled"})
 		return
 	}
 
-	log.Printf("成功获取到 %d 个用户", len(users))
+	members, total, err := h.orgService.ListMembers(scope, filter)
+	if err != nil {
+		respondOrgError(c, err, "获取用户列表失败")
+		return
+	}
 
-	userDTOs := make([]UserDTO, len(users))
-	for i, user := range users {
-		userDTOs[i] = UserDTO{
-			ID:       user.ID,
-			Username: user.Username,
-			Role:     user.Role,
+	users := make([]*domain.UserProfile, 0, len(members))
+	for _, m := range members {
+		if m.User == nil {
+			continue
 		}
+		users = append(users, memberProfile(m, m.User))
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": userDTOs})
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  users,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
 }
 
-// DeleteUser 删除用户
-func (h *UserHandler) DeleteUser(c *gin.Context) {
-	userID := c.Param("id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户ID不能为空"})
+// GetUser 获取当前组织中指定用户的资料
+func (h *UserHandler) GetUser(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
 		return
 	}
 
-	err := h.userService.DeleteUser(userID)
+	membership, user, err := h.orgService.GetMember(scope, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
+		respondOrgError(c, err, "获取用户信息失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "用户删除成功"})
+	c.JSON(http.StatusOK, memberProfile(membership, user))
 }
 
-// UpdateUserRole 更新用户角色
-func (h *UserHandler) UpdateUserRole(c *gin.Context) {
-	userID := c.Param("id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户ID不能为空"})
+// UnlockUser 解除用户因多次登录失败导致的锁定
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
 		return
 	}
 
-	var request struct {
-		Role domain.Role `json:"role" binding:"required"`
+	if err := h.authService.UnlockUser(userID); err != nil {
+		if err == domain.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+			return
+		}
+		log.Printf("解除用户锁定失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除用户锁定失败"})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+	c.JSON(http.StatusOK, gin.H{"message": "用户已解除锁定"})
+}
+
+// DisableUser 停用用户账号并使其所有会话失效，账号数据保留
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
 		return
 	}
 
-	err := h.userService.UpdateUserRole(userID, request.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户角色失败"})
+	if err := h.userService.DisableUser(principal, userID); err != nil {
+		respondUserError(c, err, "停用用户失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "用户角色更新成功"})
+	c.JSON(http.StatusOK, gin.H{"message": "用户已停用"})
+}
+
+// EnableUser 恢复已停用的用户账号
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	principal, ok := currentUserPrincipal(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.userService.EnableUser(principal, userID); err != nil {
+		respondUserError(c, err, "启用用户失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户已启用"})
+}
+
+// recordSelf 记录用户对自己账号的操作
+func (h *UserHandler) recordSelf(c *gin.Context, action string, userID uint) {
+	recordAudit(c, h.auditService, &domain.AuditEntry{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(userID), 10),
+	})
+}
+
+// memberProfile 返回用户资料，角色替换为成员在组织中的角色
+func memberProfile(membership *domain.Membership, user *domain.User) *domain.UserProfile {
+	profile := user.Profile()
+	profile.Role = membership.Role
+	return profile
+}
+
+func respondUserError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrNotOrgMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+	case errors.Is(err, domain.ErrImageNotFound), errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "该用户没有头像"})
+	case errors.Is(err, domain.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+	case errors.Is(err, domain.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "不能停用最后一位管理员"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
 }
@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxVideoSize 上传视频的大小上限
+	maxVideoSize = 1 << 30
+	// maxVideoRequestSize 上传视频的请求体上限，为其他表单字段留出余量
+	maxVideoRequestSize = maxVideoSize + 1<<20
+)
+
+type VideoHandler struct {
+	videoService *app.VideoService
+}
+
+func NewVideoHandler(videoService *app.VideoService) *VideoHandler {
+	return &VideoHandler{videoService: videoService}
+}
+
+// CreateVideo 上传视频或登记外部视频地址
+// multipart/form-data: file，以及 name、description、duration、width、height、frame_rate；
+// application/json: VideoInput，source_url 必填
+func (h *VideoHandler) CreateVideo(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		var input app.VideoInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		video, err := h.videoService.CreateVideo(scope, userID, input, nil)
+		if err != nil {
+			respondVideoError(c, err, "登记视频失败")
+			return
+		}
+		c.JSON(http.StatusCreated, video)
+		return
+	}
+
+	// 解析表单时文件会先写入临时目录，需要在解析之前限制请求体大小
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVideoRequestSize)
+	if _, err := c.MultipartForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "视频文件过大（最大支持1GB）"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的上传表单"})
+		return
+	}
+	input, ok := videoFormInput(c)
+	if !ok {
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供视频文件"})
+		return
+	}
+	if header.Size > maxVideoSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "视频文件过大（最大支持1GB）"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取视频文件失败"})
+		return
+	}
+	defer file.Close()
+	if input.Name == "" {
+		input.Name = header.Filename
+	}
+
+	video, err := h.videoService.CreateVideo(scope, userID, input, file)
+	if err != nil {
+		respondVideoError(c, err, "上传视频失败")
+		return
+	}
+	c.JSON(http.StatusCreated, video)
+}
+
+// ListVideos 分页查询当前组织的视频，q 按名称过滤
+func (h *VideoHandler) ListVideos(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	videos, total, err := h.videoService.ListVideos(scope, c.Query("q"), (page-1)*limit, limit)
+	if err != nil {
+		respondVideoError(c, err, "获取视频列表失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  videos,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *VideoHandler) GetVideo(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	video, err := h.videoService.GetVideo(scope, id)
+	if err != nil {
+		respondVideoError(c, err, "获取视频失败")
+		return
+	}
+	c.JSON(http.StatusOK, video)
+}
+
+// UpdateVideo 更新视频的描述信息
+func (h *VideoHandler) UpdateVideo(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var input app.VideoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	video, err := h.videoService.UpdateVideo(scope, id, input)
+	if err != nil {
+		respondVideoError(c, err, "更新视频失败")
+		return
+	}
+	c.JSON(http.StatusOK, video)
+}
+
+func (h *VideoHandler) DeleteVideo(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.videoService.DeleteVideo(scope, id); err != nil {
+		respondVideoError(c, err, "删除视频失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "视频已删除"})
+}
+
+// GetContent 播放视频，支持 Range 请求以便拖动进度条；只登记了外部地址的视频重定向到该地址
+func (h *VideoHandler) GetContent(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	video, content, err := h.videoService.OpenVideo(scope, id)
+	if errors.Is(err, domain.ErrBlobNotFound) && video != nil && video.SourceURL != "" {
+		c.Redirect(http.StatusFound, video.SourceURL)
+		return
+	}
+	if err != nil {
+		respondVideoError(c, err, "读取视频失败")
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", video.MimeType)
+	http.ServeContent(c.Writer, c.Request, "", video.UpdatedAt, content)
+}
+
+// CreateAnnotations 批量保存视频标注，请求体为 {"annotations": [...]}
+func (h *VideoHandler) CreateAnnotations(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	var request struct {
+		Annotations []app.AnnotationInput `json:"annotations" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	annotations, err := h.videoService.CreateAnnotations(scope, userID, id, request.Annotations)
+	if err != nil {
+		respondVideoError(c, err, "保存标注失败")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "标注已保存",
+		"data":    annotations,
+	})
+}
+
+// ListAnnotations 按视频时间范围查询标注，from、to 为距视频开始的秒数
+func (h *VideoHandler) ListAnnotations(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	from, ok := parseFloatQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseFloatQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	filter := domain.AnnotationFilter{
+		From:     from,
+		To:       to,
+		Behavior: c.Query("behavior"),
+		Offset:   (page - 1) * limit,
+		Limit:    limit,
+	}
+	annotations, total, err := h.videoService.ListAnnotations(scope, id, filter)
+	if err != nil {
+		respondVideoError(c, err, "获取标注失败")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"data":  annotations,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *VideoHandler) UpdateAnnotation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	videoID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	annotationID, ok := parseUintParam(c, "annotationId")
+	if !ok {
+		return
+	}
+	var input app.AnnotationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	annotation, err := h.videoService.UpdateAnnotation(scope, videoID, annotationID, input)
+	if err != nil {
+		respondVideoError(c, err, "更新标注失败")
+		return
+	}
+	c.JSON(http.StatusOK, annotation)
+}
+
+func (h *VideoHandler) DeleteAnnotation(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	videoID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	annotationID, ok := parseUintParam(c, "annotationId")
+	if !ok {
+		return
+	}
+
+	if err := h.videoService.DeleteAnnotation(scope, videoID, annotationID); err != nil {
+		respondVideoError(c, err, "删除标注失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "标注已删除"})
+}
+
+// FishCountSeries 鱼群数量时间序列，interval 为分段秒数，默认 1 秒
+func (h *VideoHandler) FishCountSeries(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	from, ok := parseFloatQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseFloatQuery(c, "to")
+	if !ok {
+		return
+	}
+	interval := 1.0
+	if v, ok := parseFloatQuery(c, "interval"); !ok {
+		return
+	} else if v != nil {
+		interval = *v
+	}
+
+	points, err := h.videoService.FishCountSeries(scope, id, from, to, interval)
+	if err != nil {
+		respondVideoError(c, err, "获取鱼群数量统计失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"video_id": id,
+		"interval": interval,
+		"data":     points,
+	})
+}
+
+// videoFormInput 读取上传表单中的视频描述信息
+func videoFormInput(c *gin.Context) (app.VideoInput, bool) {
+	input := app.VideoInput{
+		Name:        c.PostForm("name"),
+		Description: c.PostForm("description"),
+	}
+	for _, field := range []struct {
+		name string
+		dst  *float64
+	}{{"duration", &input.Duration}, {"frame_rate", &input.FrameRate}} {
+		v, ok := parseFloatForm(c, field.name)
+		if !ok {
+			return input, false
+		}
+		if v != nil {
+			*field.dst = *v
+		}
+	}
+	for _, field := range []struct {
+		name string
+		dst  *int
+	}{{"width", &input.Width}, {"height", &input.Height}} {
+		if raw := c.PostForm(field.name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数值: " + field.name})
+				return input, false
+			}
+			*field.dst = v
+		}
+	}
+	return input, true
+}
+
+// parseFloatQuery 解析可选的浮点数查询参数，格式错误时写入400响应
+func parseFloatQuery(c *gin.Context, name string) (*float64, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, true
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数值: " + name})
+		return nil, false
+	}
+	return &v, true
+}
+
+func respondVideoError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的视频"})
+	case errors.Is(err, domain.ErrAnnotationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的标注"})
+	case errors.Is(err, domain.ErrBlobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "视频文件不存在"})
+	case errors.Is(err, domain.ErrUnsupportedMedia):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "只支持 MP4 和 WebM 格式的视频"})
+	case errors.Is(err, domain.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/MoyInGxing/idm/infra/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// memVideoRepo 只实现上传和读取视频内容用到的方法
+type memVideoRepo struct {
+	app.VideoRepository
+	mu     sync.Mutex
+	videos []*domain.Video
+}
+
+func (r *memVideoRepo) Create(scope domain.TenantScope, video *domain.Video) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	video.ID = uint(len(r.videos) + 1)
+	video.OrgID = scope.OrgID
+	video.UpdatedAt = time.Now()
+	copied := *video
+	r.videos = append(r.videos, &copied)
+	return nil
+}
+
+func (r *memVideoRepo) FindByID(scope domain.TenantScope, id uint) (*domain.Video, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.videos {
+		if v.ID == id && v.OrgID == scope.OrgID {
+			copied := *v
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// testMP4 以 ftyp 头开始的 MP4 内容，其后的字节按位置递增，便于核对分段读取的内容
+func testMP4() []byte {
+	data := []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+	for i := 0; len(data) < 8192; i++ {
+		data = append(data, byte(i))
+	}
+	return data
+}
+
+// newVideoRouter 与识别接口的测试一样通过 X-Test-User 和 X-Test-Org 请求头指定请求主体
+func newVideoRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	blobs, err := storage.NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewVideoHandler(app.NewVideoService(&memVideoRepo{}, blobs))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var userID, orgID uint
+		if _, err := fmt.Sscan(c.GetHeader("X-Test-User"), &userID); err == nil {
+			fmt.Sscan(c.GetHeader("X-Test-Org"), &orgID)
+			c.Set("principal", &domain.Principal{Kind: domain.PrincipalUser, UserID: userID, Role: domain.RoleUser, OrgID: orgID})
+			c.Set("userID", userID)
+		}
+	})
+	r.POST("/api/videos", h.CreateVideo)
+	r.GET("/api/videos/:id/content", h.GetContent)
+	return r
+}
+
+func serveVideo(r *gin.Engine, req *http.Request, orgID uint) *httptest.ResponseRecorder {
+	req.Header.Set("X-Test-User", "5")
+	req.Header.Set("X-Test-Org", fmt.Sprint(orgID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func uploadVideo(t *testing.T, r *gin.Engine, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "pond.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/videos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return serveVideo(r, req, 1)
+}
+
+func TestGetVideoContentRanges(t *testing.T) {
+	r := newVideoRouter(t)
+	content := testMP4()
+	w := uploadVideo(t, r, content)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d: %s", w.Code, w.Body)
+	}
+	var video domain.Video
+	if err := json.Unmarshal(w.Body.Bytes(), &video); err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("/api/videos/%d/content", video.ID)
+	size := len(content)
+
+	tests := []struct {
+		name         string
+		rangeHeader  string
+		wantStatus   int
+		wantRange    string
+		wantFrom, to int
+	}{
+		{"whole file", "", http.StatusOK, "", 0, size},
+		{"first bytes", "bytes=0-99", http.StatusPartialContent, fmt.Sprintf("bytes 0-99/%d", size), 0, 100},
+		{"middle", "bytes=4096-5119", http.StatusPartialContent, fmt.Sprintf("bytes 4096-5119/%d", size), 4096, 5120},
+		{"open ended", "bytes=8000-", http.StatusPartialContent, fmt.Sprintf("bytes 8000-%d/%d", size-1, size), 8000, size},
+		{"suffix", "bytes=-10", http.StatusPartialContent, fmt.Sprintf("bytes %d-%d/%d", size-10, size-1, size), size - 10, size},
+		{"past the end", fmt.Sprintf("bytes=%d-", size), http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", size), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := serveVideo(r, req, 1)
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Range") != tt.wantRange {
+				t.Fatalf("status = %d, Content-Range = %q, want %d, %q", w.Code, w.Header().Get("Content-Range"), tt.wantStatus, tt.wantRange)
+			}
+			if tt.wantStatus == http.StatusRequestedRangeNotSatisfiable {
+				return
+			}
+			if w.Header().Get("Content-Type") != "video/mp4" || w.Header().Get("Accept-Ranges") != "bytes" {
+				t.Errorf("headers = %v", w.Header())
+			}
+			if !bytes.Equal(w.Body.Bytes(), content[tt.wantFrom:tt.to]) {
+				t.Errorf("body = %d bytes, want bytes %d-%d", w.Body.Len(), tt.wantFrom, tt.to-1)
+			}
+		})
+	}
+
+	if w := serveVideo(r, httptest.NewRequest(http.MethodGet, url, nil), 2); w.Code != http.StatusNotFound {
+		t.Errorf("video from other org: status = %d, want 404", w.Code)
+	}
+}
+
+func TestGetVideoContentRedirectsToSource(t *testing.T) {
+	r := newVideoRouter(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/videos", strings.NewReader(`{"name": "外部", "source_url": "/videos/a.mp4"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := serveVideo(r, req, 1)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body)
+	}
+
+	w = serveVideo(r, httptest.NewRequest(http.MethodGet, "/api/videos/1/content", nil), 1)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/videos/a.mp4" {
+		t.Errorf("status = %d, Location = %q, want a redirect to the source", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestUploadVideoRejectsUnsupportedContent(t *testing.T) {
+	r := newVideoRouter(t)
+	if w := uploadVideo(t, r, append([]byte("RIFF\x00\x00\x00\x00AVI LIST"), testMP4()...)); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("AVI named .mp4: status = %d, want 415", w.Code)
+	}
+}
@@ -21,27 +21,38 @@ func NewWaterQualityHandler(waterQualityService *app.WaterQualityService) *Water
 
 // GetAllWaterQuality 获取所有水质数据
 func (h *WaterQualityHandler) GetAllWaterQuality(c *gin.Context) {
-	waterQuality, err := h.waterQualityService.GetAllWaterQuality()
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
+	// 限定区域的 API 密钥只能看到这些区域的数据
+	waterQuality, err := h.waterQualityService.GetAllWaterQuality(scope, allowedAreas(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": waterQuality,
+		"data":  waterQuality,
 		"total": len(waterQuality),
 	})
 }
 
 // GetWaterQualityByRecordID 根据记录ID获取水质数据
 func (h *WaterQualityHandler) GetWaterQualityByRecordID(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	recordID := c.Param("record_id")
 	if recordID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "记录ID不能为空"})
 		return
 	}
 
-	waterQuality, err := h.waterQualityService.GetWaterQualityByRecordID(recordID)
+	waterQuality, err := h.waterQualityService.GetWaterQualityByRecordID(scope, recordID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
 		return
@@ -52,17 +63,30 @@ func (h *WaterQualityHandler) GetWaterQualityByRecordID(c *gin.Context) {
 		return
 	}
 
+	if !authorizeArea(c, waterQuality.AreaID) {
+		return
+	}
+
 	c.JSON(http.StatusOK, waterQuality)
 }
 
 // GetWaterQualityByAreaID 根据区域ID获取水质数据
 func (h *WaterQualityHandler) GetWaterQualityByAreaID(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	areaID := c.Param("area_id")
 	if areaID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "区域ID不能为空"})
 		return
 	}
 
+	if !authorizeArea(c, areaID) {
+		return
+	}
+
 	// 检查是否需要分页
 	pageStr := c.Query("page")
 	limitStr := c.Query("limit")
@@ -81,28 +105,28 @@ func (h *WaterQualityHandler) GetWaterQualityByAreaID(c *gin.Context) {
 		}
 
 		offset := (page - 1) * limit
-		waterQuality, err := h.waterQualityService.GetWaterQualityByAreaIDWithPagination(areaID, offset, limit)
+		waterQuality, err := h.waterQualityService.GetWaterQualityByAreaIDWithPagination(scope, areaID, offset, limit)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": waterQuality,
-			"page": page,
+			"data":  waterQuality,
+			"page":  page,
 			"limit": limit,
 			"total": len(waterQuality),
 		})
 	} else {
 		// 不分页，返回所有数据
-		waterQuality, err := h.waterQualityService.GetWaterQualityByAreaID(areaID)
+		waterQuality, err := h.waterQualityService.GetWaterQualityByAreaID(scope, areaID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": waterQuality,
+			"data":  waterQuality,
 			"total": len(waterQuality),
 		})
 	}
@@ -110,13 +134,22 @@ func (h *WaterQualityHandler) GetWaterQualityByAreaID(c *gin.Context) {
 
 // GetLatestWaterQualityByAreaID 获取指定区域的最新水质数据
 func (h *WaterQualityHandler) GetLatestWaterQualityByAreaID(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	areaID := c.Param("area_id")
 	if areaID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "区域ID不能为空"})
 		return
 	}
 
-	waterQuality, err := h.waterQualityService.GetLatestWaterQualityByAreaID(areaID)
+	if !authorizeArea(c, areaID) {
+		return
+	}
+
+	waterQuality, err := h.waterQualityService.GetLatestWaterQualityByAreaID(scope, areaID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取最新水质数据失败"})
 		return
@@ -132,25 +165,39 @@ func (h *WaterQualityHandler) GetLatestWaterQualityByAreaID(c *gin.Context) {
 
 // CreateWaterQuality 创建新的水质记录
 func (h *WaterQualityHandler) CreateWaterQuality(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	var waterQuality domain.WaterQuality
 	if err := c.ShouldBindJSON(&waterQuality); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误: " + err.Error()})
 		return
 	}
 
-	if err := h.waterQualityService.CreateWaterQuality(&waterQuality); err != nil {
+	if !authorizeScope(c, waterQuality.AreaID, waterQuality.DeviceID) {
+		return
+	}
+
+	if err := h.waterQualityService.CreateWaterQuality(scope, &waterQuality); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建水质记录失败"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "水质记录创建成功",
-		"data": waterQuality,
+		"data":    waterQuality,
 	})
 }
 
 // UpdateWaterQuality 更新水质记录
 func (h *WaterQualityHandler) UpdateWaterQuality(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	recordID := c.Param("record_id")
 	if recordID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "记录ID不能为空"})
@@ -166,26 +213,39 @@ func (h *WaterQualityHandler) UpdateWaterQuality(c *gin.Context) {
 	// 确保记录ID匹配
 	waterQuality.RecordID = recordID
 
-	if err := h.waterQualityService.UpdateWaterQuality(&waterQuality); err != nil {
+	if !h.authorizeRecordScope(c, scope, recordID) || !authorizeScope(c, waterQuality.AreaID, waterQuality.DeviceID) {
+		return
+	}
+
+	if err := h.waterQualityService.UpdateWaterQuality(scope, &waterQuality); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新水质记录失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "水质记录更新成功",
-		"data": waterQuality,
+		"data":    waterQuality,
 	})
 }
 
 // DeleteWaterQuality 删除水质记录
 func (h *WaterQualityHandler) DeleteWaterQuality(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	recordID := c.Param("record_id")
 	if recordID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "记录ID不能为空"})
 		return
 	}
 
-	if err := h.waterQualityService.DeleteWaterQuality(recordID); err != nil {
+	if !h.authorizeRecordScope(c, scope, recordID) {
+		return
+	}
+
+	if err := h.waterQualityService.DeleteWaterQuality(scope, recordID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除水质记录失败"})
 		return
 	}
@@ -193,15 +253,38 @@ func (h *WaterQualityHandler) DeleteWaterQuality(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "水质记录删除成功"})
 }
 
+// authorizeRecordScope 校验记录属于当前组织，且 API 密钥有权修改该记录
+func (h *WaterQualityHandler) authorizeRecordScope(c *gin.Context, scope domain.TenantScope, recordID string) bool {
+	existing, err := h.waterQualityService.GetWaterQualityByRecordID(scope, recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
+		return false
+	}
+	if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的水质记录"})
+		return false
+	}
+	return authorizeScope(c, existing.AreaID, existing.DeviceID)
+}
+
 // GetTemperatureAndPHByAreaID 根据区域ID获取温度和pH值数据
 func (h *WaterQualityHandler) GetTemperatureAndPHByAreaID(c *gin.Context) {
+	scope, ok := tenantScope(c)
+	if !ok {
+		return
+	}
+
 	areaID := c.Param("area_id")
 	if areaID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "区域ID不能为空"})
 		return
 	}
 
-	waterQuality, err := h.waterQualityService.GetWaterQualityByAreaID(areaID)
+	if !authorizeArea(c, areaID) {
+		return
+	}
+
+	waterQuality, err := h.waterQualityService.GetWaterQualityByAreaID(scope, areaID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取水质数据失败"})
 		return
@@ -223,7 +306,7 @@ func (h *WaterQualityHandler) GetTemperatureAndPHByAreaID(c *gin.Context) {
 			timeStr := wq.RecordTime.Format("2006-01-02 15:04:05")
 			recordTime = &timeStr
 		}
-		
+
 		result = append(result, TemperaturePHData{
 			RecordID:    wq.RecordID,
 			AreaID:      wq.AreaID,
@@ -237,4 +320,4 @@ func (h *WaterQualityHandler) GetTemperatureAndPHByAreaID(c *gin.Context) {
 		"data":  result,
 		"total": len(result),
 	})
-}
\ No newline at end of file
+}
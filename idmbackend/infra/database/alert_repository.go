@@ -0,0 +1,96 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMAlertRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMAlertRepository(db *gorm.DB) *GORMAlertRepository {
+	return &GORMAlertRepository{db: db}
+}
+
+// Create 保存告警，告警归属 scope 所在的组织
+func (r *GORMAlertRepository) Create(scope domain.TenantScope, alert *domain.Alert) error {
+	alert.OrgID = scope.OrgID
+	return r.db.Create(alert).Error
+}
+
+// FindByID 查找组织内的告警，不存在时返回 nil
+func (r *GORMAlertRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Alert, error) {
+	var alert domain.Alert
+	err := scoped(r.db, scope).First(&alert, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// FindOpen 区域内最近一条 since 之后仍有事件的未确认告警，不存在时返回 nil
+func (r *GORMAlertRepository) FindOpen(scope domain.TenantScope, areaID string, kind domain.AlertKind, since time.Time) (*domain.Alert, error) {
+	var alert domain.Alert
+	err := scoped(r.db, scope).
+		Where("area_id = ? AND kind = ? AND status = ? AND last_event_at >= ?", areaID, kind, domain.AlertOpen, since).
+		Order("last_event_at DESC").
+		First(&alert).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// Find 分页查询告警，按创建时间倒序
+func (r *GORMAlertRepository) Find(scope domain.TenantScope, filter domain.AlertFilter) ([]*domain.Alert, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.Alert{})
+	if filter.AreaID != "" {
+		query = query.Where("area_id = ?", filter.AreaID)
+	}
+	if len(filter.AreaIDs) > 0 {
+		query = query.Where("area_id IN ?", filter.AreaIDs)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var alerts []*domain.Alert
+	if err := query.Order("id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&alerts).Error; err != nil {
+		return nil, 0, err
+	}
+	return alerts, total, nil
+}
+
+// RecordEvent 将新的触发事件累加到已有告警上
+func (r *GORMAlertRepository) RecordEvent(scope domain.TenantScope, id uint, at time.Time) error {
+	return scoped(r.db, scope).Model(&domain.Alert{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"event_count":   gorm.Expr("event_count + 1"),
+			"last_event_at": gorm.Expr("GREATEST(last_event_at, ?)", at),
+		}).Error
+}
+
+// Acknowledge 确认告警，只修改仍未确认的告警，返回是否修改成功
+func (r *GORMAlertRepository) Acknowledge(scope domain.TenantScope, alert *domain.Alert) (bool, error) {
+	result := scoped(r.db, scope).Model(&domain.Alert{}).
+		Where("id = ? AND status = ?", alert.ID, domain.AlertOpen).
+		Select("status", "acknowledged_by", "acknowledged_at", "note").
+		Updates(alert)
+	return result.RowsAffected > 0, result.Error
+}
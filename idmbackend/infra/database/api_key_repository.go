@@ -0,0 +1,70 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMAPIKeyRepository(db *gorm.DB) *GORMAPIKeyRepository {
+	return &GORMAPIKeyRepository{db: db}
+}
+
+func (r *GORMAPIKeyRepository) Create(key *domain.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// FindAll 获取组织内的全部 API 密钥，按创建时间倒序
+func (r *GORMAPIKeyRepository) FindAll(scope domain.TenantScope) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	if err := scoped(r.db, scope).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// FindByID 按ID查找组织内的密钥，不存在时返回 nil
+func (r *GORMAPIKeyRepository) FindByID(scope domain.TenantScope, id uint) (*domain.APIKey, error) {
+	var key domain.APIKey
+	err := scoped(r.db, scope).First(&key, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindByHash 按密钥摘要查找，不存在时返回 nil
+func (r *GORMAPIKeyRepository) FindByHash(keyHash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.db.Where("key_hash = ?", keyHash).First(&key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *GORMAPIKeyRepository) Revoke(scope domain.TenantScope, id uint, at time.Time) error {
+	return scoped(r.db, scope).Model(&domain.APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at).Error
+}
+
+// RevokeByCreator 吊销用户在所有组织中创建的密钥
+func (r *GORMAPIKeyRepository) RevokeByCreator(userID uint, at time.Time) error {
+	return r.db.Model(&domain.APIKey{}).Where("created_by = ? AND revoked_at IS NULL", userID).Update("revoked_at", at).Error
+}
+
+// TouchLastUsed 记录最近一次使用的时间和来源地址
+func (r *GORMAPIKeyRepository) TouchLastUsed(id uint, at time.Time, ip string) error {
+	return r.db.Model(&domain.APIKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
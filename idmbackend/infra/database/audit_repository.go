@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+// GORMAuditRepository 审计日志只提供追加和查询，不提供修改和删除
+type GORMAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMAuditRepository(db *gorm.DB) *GORMAuditRepository {
+	return &GORMAuditRepository{db: db}
+}
+
+// Append 在事务中读取链尾并接续写入记录。其他进程抢先接在同一链尾之后时，
+// prev_hash 唯一约束使写入失败，返回 domain.ErrAuditChainConflict
+func (r *GORMAuditRepository) Append(entry *domain.AuditEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var last domain.AuditEntry
+		err := tx.Select("hash").Order("id DESC").Limit(1).Take(&last).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		entry.ID = 0
+		entry.Seal(last.Hash)
+		err = tx.Create(entry).Error
+		if translator, ok := tx.Dialector.(gorm.ErrorTranslator); ok {
+			err = translator.Translate(err)
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrAuditChainConflict
+		}
+		return err
+	})
+}
+
+// Find 按条件分页查询审计记录，按时间倒序，返回当前页数据和满足条件的总数
+func (r *GORMAuditRepository) Find(filter domain.AuditFilter) ([]*domain.AuditEntry, int64, error) {
+	query := r.db.Model(&domain.AuditEntry{})
+	if filter.OrgID != nil {
+		query = query.Where("org_id = ?", *filter.OrgID)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action LIKE ?", filter.Action+"%")
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []*domain.AuditEntry
+	query = query.Order("id DESC").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// FindAfter 按写入顺序获取 ID 大于 afterID 的记录，用于校验哈希链
+func (r *GORMAuditRepository) FindAfter(afterID uint, limit int) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	if err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
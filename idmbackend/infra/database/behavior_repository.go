@@ -0,0 +1,96 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMBehaviorRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMBehaviorRepository(db *gorm.DB) *GORMBehaviorRepository {
+	return &GORMBehaviorRepository{db: db}
+}
+
+// BatchCreate 批量保存行为事件，事件归属 scope 所在的组织
+func (r *GORMBehaviorRepository) BatchCreate(scope domain.TenantScope, events []*domain.BehaviorEvent) error {
+	for _, e := range events {
+		e.OrgID = scope.OrgID
+	}
+	return r.db.CreateInBatches(events, 200).Error
+}
+
+// Find 分页查询行为事件，按发生时间倒序
+func (r *GORMBehaviorRepository) Find(scope domain.TenantScope, filter domain.BehaviorFilter) ([]*domain.BehaviorEvent, int64, error) {
+	query := r.events(scope, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []*domain.BehaviorEvent
+	if err := query.Order("occurred_at DESC, id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Buckets 按 interval 分段统计每种行为的次数，只返回有事件的分段
+func (r *GORMBehaviorRepository) Buckets(scope domain.TenantScope, filter domain.BehaviorFilter, interval time.Duration) ([]domain.BehaviorBucket, error) {
+	seconds := int64(interval / time.Second)
+	var rows []struct {
+		Bucket        int64
+		Type          domain.BehaviorType
+		Count         int64
+		AvgConfidence float64
+		MaxFishCount  int
+	}
+	err := r.events(scope, filter).
+		Select("FLOOR(UNIX_TIMESTAMP(occurred_at) / ?) AS bucket, type, COUNT(*) AS count, AVG(confidence) AS avg_confidence, MAX(fish_count) AS max_fish_count", seconds).
+		Group("bucket, type").Order("bucket, type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]domain.BehaviorBucket, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, domain.BehaviorBucket{
+			Start:         time.Unix(row.Bucket*seconds, 0).UTC(),
+			Type:          row.Type,
+			Count:         row.Count,
+			AvgConfidence: row.AvgConfidence,
+			MaxFishCount:  row.MaxFishCount,
+		})
+	}
+	return buckets, nil
+}
+
+func (r *GORMBehaviorRepository) events(scope domain.TenantScope, filter domain.BehaviorFilter) *gorm.DB {
+	query := scoped(r.db, scope).Model(&domain.BehaviorEvent{})
+	if filter.AreaID != "" {
+		query = query.Where("area_id = ?", filter.AreaID)
+	}
+	if len(filter.AreaIDs) > 0 {
+		query = query.Where("area_id IN ?", filter.AreaIDs)
+	}
+	if filter.CameraID != "" {
+		query = query.Where("camera_id = ?", filter.CameraID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.MinConfidence > 0 {
+		query = query.Where("confidence >= ?", filter.MinConfidence)
+	}
+	if filter.From != nil {
+		query = query.Where("occurred_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("occurred_at < ?", *filter.To)
+	}
+	return query
+}
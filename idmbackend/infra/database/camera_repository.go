@@ -0,0 +1,174 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMCameraRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMCameraRepository(db *gorm.DB) *GORMCameraRepository {
+	return &GORMCameraRepository{db: db}
+}
+
+// Create 保存摄像头，摄像头归属 scope 所在的组织
+func (r *GORMCameraRepository) Create(scope domain.TenantScope, camera *domain.Camera) error {
+	camera.OrgID = scope.OrgID
+	return r.db.Create(camera).Error
+}
+
+// FindByID 查找组织内的摄像头，不存在时返回 nil
+func (r *GORMCameraRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Camera, error) {
+	var camera domain.Camera
+	err := scoped(r.db, scope).First(&camera, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &camera, nil
+}
+
+// Find 分页查询组织内的摄像头，按 ID 排序
+func (r *GORMCameraRepository) Find(scope domain.TenantScope, filter domain.CameraFilter) ([]*domain.Camera, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.Camera{})
+	if filter.AreaID != "" {
+		query = query.Where("area_id = ?", filter.AreaID)
+	}
+	if len(filter.AreaIDs) > 0 {
+		query = query.Where("area_id IN ?", filter.AreaIDs)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var cameras []*domain.Camera
+	if err := query.Order("id").Offset(filter.Offset).Limit(filter.Limit).Find(&cameras).Error; err != nil {
+		return nil, 0, err
+	}
+	return cameras, total, nil
+}
+
+// FindAll 全部组织的摄像头，用于清理过期快照
+func (r *GORMCameraRepository) FindAll() ([]*domain.Camera, error) {
+	var cameras []*domain.Camera
+	err := r.db.Order("id").Find(&cameras).Error
+	return cameras, err
+}
+
+// Update 更新摄像头的配置，不修改最近快照时间
+func (r *GORMCameraRepository) Update(scope domain.TenantScope, camera *domain.Camera) error {
+	return scoped(r.db, scope).Model(&domain.Camera{}).Where("id = ?", camera.ID).
+		Select("name", "area_id", "device_id", "type", "stream_url", "latitude", "longitude", "depth",
+			"status", "snapshot_interval", "retention_days", "auto_recognize").
+		Updates(camera).Error
+}
+
+// Delete 在同一事务中删除摄像头及其快照记录，快照图片由调用方删除
+func (r *GORMCameraRepository) Delete(scope domain.TenantScope, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := scoped(tx, scope).Where("camera_id = ?", id).Delete(&domain.Snapshot{}).Error; err != nil {
+			return err
+		}
+		return scoped(tx, scope).Delete(&domain.Camera{}, id).Error
+	})
+}
+
+// CreateSnapshot 保存快照，并将摄像头的最近快照时间推进到快照的拍摄时间
+func (r *GORMCameraRepository) CreateSnapshot(scope domain.TenantScope, snapshot *domain.Snapshot) error {
+	snapshot.OrgID = scope.OrgID
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		return scoped(tx, scope).Model(&domain.Camera{}).
+			Where("id = ? AND (last_snapshot_at IS NULL OR last_snapshot_at < ?)", snapshot.CameraID, snapshot.CapturedAt).
+			Update("last_snapshot_at", snapshot.CapturedAt).Error
+	})
+}
+
+// UpdateSnapshotJob 记录快照自动识别提交的任务
+func (r *GORMCameraRepository) UpdateSnapshotJob(scope domain.TenantScope, snapshot *domain.Snapshot) error {
+	return scoped(r.db, scope).Model(&domain.Snapshot{}).Where("id = ?", snapshot.ID).
+		Update("recognition_job_id", snapshot.RecognitionJobID).Error
+}
+
+// FindSnapshot 查找摄像头的快照，不存在时返回 nil
+func (r *GORMCameraRepository) FindSnapshot(scope domain.TenantScope, cameraID, id uint) (*domain.Snapshot, error) {
+	var snapshot domain.Snapshot
+	err := scoped(r.db, scope).Where("camera_id = ?", cameraID).First(&snapshot, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// FindLatestSnapshot 摄像头拍摄时间最晚的快照，没有快照时返回 nil
+func (r *GORMCameraRepository) FindLatestSnapshot(scope domain.TenantScope, cameraID uint) (*domain.Snapshot, error) {
+	var snapshot domain.Snapshot
+	err := scoped(r.db, scope).Where("camera_id = ?", cameraID).
+		Order("captured_at DESC, id DESC").
+		First(&snapshot).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// FindSnapshots 按拍摄时间顺序分页查询快照。filter.Step 大于 0 时每个时段只返回最早的一张
+func (r *GORMCameraRepository) FindSnapshots(scope domain.TenantScope, cameraID uint, filter domain.SnapshotFilter) ([]*domain.Snapshot, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.Snapshot{}).Where("camera_id = ?", cameraID)
+	if filter.From != nil {
+		query = query.Where("captured_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("captured_at < ?", *filter.To)
+	}
+	if seconds := int64(filter.Step / time.Second); seconds > 0 {
+		firsts := query.Select("MIN(id)").Group(fmt.Sprintf("FLOOR(UNIX_TIMESTAMP(captured_at) / %d)", seconds))
+		query = r.db.Model(&domain.Snapshot{}).Where("id IN (?)", firsts)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var snapshots []*domain.Snapshot
+	if err := query.Order("captured_at, id").Offset(filter.Offset).Limit(filter.Limit).Find(&snapshots).Error; err != nil {
+		return nil, 0, err
+	}
+	return snapshots, total, nil
+}
+
+// FindSnapshotsBefore 摄像头在 before 之前拍摄的一批快照，用于清理过期快照和删除摄像头
+func (r *GORMCameraRepository) FindSnapshotsBefore(cameraID uint, before time.Time, limit int) ([]*domain.Snapshot, error) {
+	var snapshots []*domain.Snapshot
+	err := r.db.Where("camera_id = ? AND captured_at < ?", cameraID, before).
+		Order("captured_at, id").Limit(limit).
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+// DeleteSnapshots 按 ID 删除快照记录
+func (r *GORMCameraRepository) DeleteSnapshots(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Where("id IN ?", ids).Delete(&domain.Snapshot{}).Error
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+// splitUpdateBatch 批量修改划分时每条 SQL 包含的帧数
+const splitUpdateBatch = 500
+
+type GORMDatasetRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMDatasetRepository(db *gorm.DB) *GORMDatasetRepository {
+	return &GORMDatasetRepository{db: db}
+}
+
+// Create 保存数据集，数据集归属 scope 所在的组织
+func (r *GORMDatasetRepository) Create(scope domain.TenantScope, dataset *domain.Dataset) error {
+	dataset.OrgID = scope.OrgID
+	return r.db.Create(dataset).Error
+}
+
+// FindByID 查找组织内的数据集，不存在时返回 nil
+func (r *GORMDatasetRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Dataset, error) {
+	var dataset domain.Dataset
+	err := scoped(r.db, scope).First(&dataset, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &dataset, nil
+}
+
+// Find 分页查询组织内的数据集，按创建时间倒序
+func (r *GORMDatasetRepository) Find(scope domain.TenantScope, offset, limit int) ([]*domain.Dataset, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.Dataset{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var datasets []*domain.Dataset
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&datasets).Error; err != nil {
+		return nil, 0, err
+	}
+	return datasets, total, nil
+}
+
+// Update 更新数据集的名称和说明
+func (r *GORMDatasetRepository) Update(scope domain.TenantScope, dataset *domain.Dataset) error {
+	return scoped(r.db, scope).Model(&domain.Dataset{}).Where("id = ?", dataset.ID).
+		Select("name", "description").
+		Updates(dataset).Error
+}
+
+// Delete 在同一事务中删除数据集及其全部帧和类别
+func (r *GORMDatasetRepository) Delete(scope domain.TenantScope, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := scoped(tx, scope).Where("dataset_id = ?", id).Delete(&domain.DatasetFrame{}).Error; err != nil {
+			return err
+		}
+		if err := scoped(tx, scope).Where("dataset_id = ?", id).Delete(&domain.DatasetCategory{}).Error; err != nil {
+			return err
+		}
+		return scoped(tx, scope).Delete(&domain.Dataset{}, id).Error
+	})
+}
+
+// FindCategories 数据集的全部类别，按创建顺序排列，导出时以此顺序编号
+func (r *GORMDatasetRepository) FindCategories(scope domain.TenantScope, datasetID uint) ([]*domain.DatasetCategory, error) {
+	var categories []*domain.DatasetCategory
+	err := scoped(r.db, scope).Where("dataset_id = ?", datasetID).Order("id").Find(&categories).Error
+	return categories, err
+}
+
+// FindCategory 查找数据集中的类别，不存在时返回 nil
+func (r *GORMDatasetRepository) FindCategory(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetCategory, error) {
+	var category domain.DatasetCategory
+	err := scoped(r.db, scope).Where("dataset_id = ?", datasetID).First(&category, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// CreateCategories 批量创建类别
+func (r *GORMDatasetRepository) CreateCategories(scope domain.TenantScope, categories []*domain.DatasetCategory) error {
+	for _, c := range categories {
+		c.OrgID = scope.OrgID
+	}
+	return r.db.Create(categories).Error
+}
+
+// UpdateCategory 更新类别映射的物种
+func (r *GORMDatasetRepository) UpdateCategory(scope domain.TenantScope, category *domain.DatasetCategory) error {
+	return scoped(r.db, scope).Model(&domain.DatasetCategory{}).
+		Where("id = ? AND dataset_id = ?", category.ID, category.DatasetID).
+		Select("species_id").
+		Updates(category).Error
+}
+
+// CreateFrames 批量保存同一数据集的帧
+func (r *GORMDatasetRepository) CreateFrames(scope domain.TenantScope, frames []*domain.DatasetFrame) error {
+	for _, f := range frames {
+		f.OrgID = scope.OrgID
+	}
+	return r.db.CreateInBatches(frames, 200).Error
+}
+
+// FindFrame 查找数据集中的帧，不存在时返回 nil
+func (r *GORMDatasetRepository) FindFrame(scope domain.TenantScope, datasetID, id uint) (*domain.DatasetFrame, error) {
+	var frame domain.DatasetFrame
+	err := scoped(r.db, scope).Where("dataset_id = ?", datasetID).First(&frame, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// FindFrames 按划分和视频分页查询数据集中的帧
+func (r *GORMDatasetRepository) FindFrames(scope domain.TenantScope, datasetID uint, filter domain.FrameFilter) ([]*domain.DatasetFrame, int64, error) {
+	query := r.frames(scope, datasetID, filter.Split)
+	if filter.VideoID != 0 {
+		query = query.Where("video_id = ?", filter.VideoID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var frames []*domain.DatasetFrame
+	if err := query.Order("id").Offset(filter.Offset).Limit(filter.Limit).Find(&frames).Error; err != nil {
+		return nil, 0, err
+	}
+	return frames, total, nil
+}
+
+// FindFramesAfter 按 ID 顺序读取 afterID 之后的一批帧，用于导出时分批遍历
+func (r *GORMDatasetRepository) FindFramesAfter(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit, afterID uint, limit int) ([]*domain.DatasetFrame, error) {
+	var frames []*domain.DatasetFrame
+	err := r.frames(scope, datasetID, split).Where("id > ?", afterID).Order("id").Limit(limit).Find(&frames).Error
+	return frames, err
+}
+
+// FindFrameIDs 数据集中帧的 ID，split 不为空时只返回该划分中的帧
+func (r *GORMDatasetRepository) FindFrameIDs(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit) ([]uint, error) {
+	var ids []uint
+	err := r.frames(scope, datasetID, split).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// FindVideoTimestamps 数据集中已有的来自指定视频的帧的时间点
+func (r *GORMDatasetRepository) FindVideoTimestamps(scope domain.TenantScope, datasetID, videoID uint) ([]float64, error) {
+	var timestamps []float64
+	err := r.frames(scope, datasetID, nil).Where("video_id = ?", videoID).Pluck("time_offset", &timestamps).Error
+	return timestamps, err
+}
+
+// UpdateFrame 更新帧的划分和标注框
+func (r *GORMDatasetRepository) UpdateFrame(scope domain.TenantScope, frame *domain.DatasetFrame) error {
+	return scoped(r.db, scope).Model(&domain.DatasetFrame{}).
+		Where("id = ? AND dataset_id = ?", frame.ID, frame.DatasetID).
+		Select("split", "boxes", "source").
+		Updates(frame).Error
+}
+
+// UpdateSplits 在同一事务中修改一组帧的划分
+func (r *GORMDatasetRepository) UpdateSplits(scope domain.TenantScope, datasetID uint, splits map[domain.DatasetSplit][]uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for split, ids := range splits {
+			for start := 0; start < len(ids); start += splitUpdateBatch {
+				end := min(start+splitUpdateBatch, len(ids))
+				err := scoped(tx, scope).Model(&domain.DatasetFrame{}).
+					Where("dataset_id = ? AND id IN ?", datasetID, ids[start:end]).
+					Update("split", split).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GORMDatasetRepository) DeleteFrame(scope domain.TenantScope, datasetID, id uint) error {
+	return scoped(r.db, scope).Where("dataset_id = ?", datasetID).Delete(&domain.DatasetFrame{}, id).Error
+}
+
+// CountSplits 统计每个划分中的帧数，没有帧的划分不返回
+func (r *GORMDatasetRepository) CountSplits(scope domain.TenantScope, datasetID uint) ([]domain.SplitCount, error) {
+	var counts []domain.SplitCount
+	err := r.frames(scope, datasetID, nil).
+		Select("split, COUNT(*) AS frames").
+		Group("split").Order("split").
+		Scan(&counts).Error
+	return counts, err
+}
+
+func (r *GORMDatasetRepository) frames(scope domain.TenantScope, datasetID uint, split *domain.DatasetSplit) *gorm.DB {
+	query := scoped(r.db, scope).Model(&domain.DatasetFrame{}).Where("dataset_id = ?", datasetID)
+	if split != nil {
+		query = query.Where("split = ?", *split)
+	}
+	return query
+}
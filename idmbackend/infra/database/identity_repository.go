@@ -0,0 +1,46 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMIdentityRepository(db *gorm.DB) *GORMIdentityRepository {
+	return &GORMIdentityRepository{db: db}
+}
+
+// FindByIssuerSubject 查找外部身份绑定，不存在时返回 nil
+func (r *GORMIdentityRepository) FindByIssuerSubject(issuer, subject string) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// TouchLogin 更新最近一次通过该身份登录的时间和邮箱
+func (r *GORMIdentityRepository) TouchLogin(id uint, email string, at time.Time) error {
+	return r.db.Model(&domain.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": at}).Error
+}
+
+// CreateWithUser 在同一事务中创建本地用户、外部身份绑定和组织成员身份，membership 可以为 nil
+func (r *GORMIdentityRepository) CreateWithUser(user *domain.User, identity *domain.UserIdentity, membership *domain.Membership) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := createUserWithMembership(tx, user, membership); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMLoginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMLoginThrottleRepository(db *gorm.DB) *GORMLoginThrottleRepository {
+	return &GORMLoginThrottleRepository{db: db}
+}
+
+// Find 按键查找失败计数，不存在时返回 nil
+func (r *GORMLoginThrottleRepository) Find(key string) (*domain.LoginThrottle, error) {
+	var throttle domain.LoginThrottle
+	err := r.db.Where("`key` = ?", key).First(&throttle).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *GORMLoginThrottleRepository) Save(throttle *domain.LoginThrottle) error {
+	return r.db.Save(throttle).Error
+}
+
+func (r *GORMLoginThrottleRepository) Delete(key string) error {
+	return r.db.Where("`key` = ?", key).Delete(&domain.LoginThrottle{}).Error
+}
+
+// DeleteStale 清理最后一次失败早于 before 且已不再阻止登录的记录
+func (r *GORMLoginThrottleRepository) DeleteStale(before time.Time) error {
+	return r.db.Where("last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", before, before).
+		Delete(&domain.LoginThrottle{}).Error
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMMFARepository struct {
+	db *gorm.DB
+}
+
+func NewGORMMFARepository(db *gorm.DB) *GORMMFARepository {
+	return &GORMMFARepository{db: db}
+}
+
+// FindTOTP 获取用户的 TOTP 密钥，不存在时返回 nil
+func (r *GORMMFARepository) FindTOTP(userID uint) (*domain.TOTPEnrollment, error) {
+	var enrollment domain.TOTPEnrollment
+	err := r.db.Where("user_id = ?", userID).First(&enrollment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+func (r *GORMMFARepository) SaveTOTP(enrollment *domain.TOTPEnrollment) error {
+	return r.db.Save(enrollment).Error
+}
+
+// DeleteTOTP 删除用户的 TOTP 密钥和全部恢复码
+func (r *GORMMFARepository) DeleteTOTP(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&domain.TOTPEnrollment{}).Error
+	})
+}
+
+// MarkStepUsed 记录已使用的时间步，仅当其晚于上一次使用的时间步时成功，防止验证码重放
+func (r *GORMMFARepository) MarkStepUsed(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&domain.TOTPEnrollment{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes 在同一事务中删除旧的恢复码并保存新的恢复码
+func (r *GORMMFARepository) ReplaceRecoveryCodes(userID uint, codes []*domain.RecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode 将恢复码标记为已使用，恢复码不存在或已使用时返回 false
+func (r *GORMMFARepository) UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error) {
+	result := r.db.Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountRecoveryCodes 统计用户剩余可用的恢复码
+func (r *GORMMFARepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *GORMMFARepository) SaveChallenge(challenge *domain.MFAChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+// AttemptChallenge 为未过期且未用尽尝试次数的登录挑战计数一次并返回，否则返回 nil。
+// 计数通过条件更新完成，多个实例并发提交时也不会超过次数上限
+func (r *GORMMFARepository) AttemptChallenge(tokenHash string, now time.Time, maxAttempts int) (*domain.MFAChallenge, error) {
+	result := r.db.Model(&domain.MFAChallenge{}).
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", tokenHash, now, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	var challenge domain.MFAChallenge
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&challenge).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *GORMMFARepository) DeleteChallenge(tokenHash string) error {
+	return r.db.Where("token_hash = ?", tokenHash).Delete(&domain.MFAChallenge{}).Error
+}
+
+// DeleteExpiredChallenges 清理已过期的登录挑战
+func (r *GORMMFARepository) DeleteExpiredChallenges(before time.Time) error {
+	return r.db.Where("expires_at <= ?", before).Delete(&domain.MFAChallenge{}).Error
+}
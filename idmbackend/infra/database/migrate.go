@@ -0,0 +1,229 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+// schemaMigration 记录已执行的一次性数据迁移
+type schemaMigration struct {
+	Version   string `gorm:"primaryKey;type:varchar(64)"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// dataMigration 一次性的数据迁移，按 Version 记录，成功执行后不再重复执行
+type dataMigration struct {
+	Version string
+	Run     func(db *gorm.DB) error
+}
+
+// preMigrations 在 AutoMigrate 之前执行，处理会导致表结构变更失败的旧数据
+var preMigrations = []dataMigration{
+	{Version: "20240601_sessions_token_hash", Run: clearLegacySessions},
+	{Version: "20240801_users_email_unique", Run: dedupeUserEmails},
+}
+
+// postMigrations 在 AutoMigrate 之后执行
+var postMigrations = []dataMigration{
+	{Version: "20240601_default_org_tenants", Run: migrateTenants},
+	{Version: "20240801_role_read_permissions", Run: grantOrgReadPermissions},
+}
+
+// AutoMigrate 创建或更新由后端维护的表结构
+// water_quality 等由 SQL 脚本导入的表不在此处迁移
+func AutoMigrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	if err := runMigrations(db, preMigrations); err != nil {
+		return err
+	}
+
+	err := db.AutoMigrate(
+		&domain.Organization{},
+		&domain.Membership{},
+		&domain.User{},
+		&domain.Session{},
+		&domain.UserIdentity{},
+		&domain.APIKey{},
+		&domain.PasswordResetToken{},
+		&domain.LoginThrottle{},
+		&domain.TOTPEnrollment{},
+		&domain.RecoveryCode{},
+		&domain.MFAChallenge{},
+		&domain.AuditEntry{},
+		&domain.RoleDefinition{},
+		&domain.Taxon{},
+		&domain.Species{},
+		&domain.SpeciesName{},
+		&domain.SpeciesImage{},
+		&domain.SpeciesImageThumbnail{},
+		&domain.Observation{},
+		&domain.Recognition{},
+		&domain.RecognitionJob{},
+		&domain.RecognitionJobItem{},
+		&domain.Video{},
+		&domain.Annotation{},
+		&domain.Dataset{},
+		&domain.DatasetCategory{},
+		&domain.DatasetFrame{},
+		&domain.BehaviorEvent{},
+		&domain.Alert{},
+		&domain.Camera{},
+		&domain.Snapshot{},
+		&domain.Station{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := migrateWaterQualityOrg(db); err != nil {
+		return err
+	}
+	if _, err := ensureDefaultOrg(db); err != nil {
+		return err
+	}
+	return runMigrations(db, postMigrations)
+}
+
+// tenantTables 按组织隔离的表
+var tenantTables = []string{"stations", "water_quality", "observations", "api_keys", "recognitions", "recognition_jobs", "videos", "datasets", "behavior_events", "alerts", "cameras", "snapshots"}
+
+// migrateWaterQualityOrg water_quality 由 SQL 脚本导入，需要单独补充 org_id 列。
+// 表可能在首次启动之后才导入，因此每次启动都检查
+func migrateWaterQualityOrg(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&domain.WaterQuality{}) || db.Migrator().HasColumn(&domain.WaterQuality{}, "OrgID") {
+		return nil
+	}
+	if err := db.Migrator().AddColumn(&domain.WaterQuality{}, "OrgID"); err != nil {
+		return err
+	}
+	return db.Migrator().CreateIndex(&domain.WaterQuality{}, "OrgID")
+}
+
+// ensureDefaultOrg 确保默认组织存在，单点登录等首次登录的用户会加入默认组织
+func ensureDefaultOrg(db *gorm.DB) (*domain.Organization, error) {
+	var org domain.Organization
+	err := db.Where("slug = ?", domain.DefaultOrgSlug).First(&org).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		org = domain.Organization{Slug: domain.DefaultOrgSlug, Name: "默认组织", Kind: domain.OrgAgency}
+		err = db.Create(&org).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// migrateTenants 将引入组织之前的数据和用户归入默认组织。
+// 只在升级时执行一次：之后被移出默认组织的用户不会被重新加入，未归属组织的新数据也不会被归入默认组织
+func migrateTenants(db *gorm.DB) error {
+	org, err := ensureDefaultOrg(db)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range tenantTables {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+			if err := tx.Table(table).Where("org_id IS NULL OR org_id = 0").Update("org_id", org.ID).Error; err != nil {
+				return err
+			}
+		}
+		// 尚未加入任何组织的用户以全局角色加入默认组织
+		return tx.Exec(`INSERT INTO memberships (org_id, user_id, role, created_at)
+			SELECT ?, u.id, u.role, NOW() FROM users u
+			WHERE NOT EXISTS (SELECT 1 FROM memberships m WHERE m.user_id = u.id)`, org.ID).Error
+	})
+}
+
+// grantOrgReadPermissions 为已有的自定义角色补充组织数据的查询权限，
+// 这些接口原先只要求登录，补充后自定义角色的用户仍可查询。
+// 识别等写入权限不在此补充，需要管理员按需授予
+func grantOrgReadPermissions(db *gorm.DB) error {
+	var roles []domain.RoleDefinition
+	if err := db.Find(&roles).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range roles {
+			role := &roles[i]
+			for _, p := range domain.OrgReadPermissions {
+				if !role.HasPermission(p) {
+					role.Permissions = append(role.Permissions, p)
+				}
+			}
+			if err := tx.Save(role).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runMigrations 依次执行尚未执行过的数据迁移
+func runMigrations(db *gorm.DB, migrations []dataMigration) error {
+	for _, m := range migrations {
+		var count int64
+		if err := db.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := m.Run(db); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Version, err)
+		}
+		if err := db.Create(&schemaMigration{Version: m.Version, AppliedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearLegacySessions 清空引入刷新令牌轮换之前的会话。旧记录的 token 列保存的是令牌原文，
+// 既无法按摘要查找，也可能超出新的 varchar(64) 长度导致变更列类型失败，相关用户需要重新登录
+func clearLegacySessions(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&domain.Session{}) || db.Migrator().HasColumn(&domain.Session{}, "FamilyID") {
+		return nil
+	}
+	return db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&domain.Session{}).Error
+}
+
+// dedupeUserEmails 为 users.email 改用唯一索引做准备：空邮箱改为 NULL，
+// 重复的邮箱只保留给最早注册的用户，其余用户的邮箱被清除，需要本人重新设置。
+// 原来的普通索引与唯一索引同名，需要先删除，AutoMigrate 才会重新创建
+func dedupeUserEmails(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&domain.User{}) || !db.Migrator().HasColumn(&domain.User{}, "Email") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE users SET email = NULL WHERE email = ''").Error; err != nil {
+			return err
+		}
+		result := tx.Exec(`UPDATE users u JOIN (
+				SELECT email, MIN(id) AS keep_id FROM users WHERE email IS NOT NULL GROUP BY email HAVING COUNT(*) > 1
+			) d ON u.email = d.email AND u.id <> d.keep_id
+			SET u.email = NULL`)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("已清除 %d 个用户的重复邮箱", result.RowsAffected)
+		}
+		if tx.Migrator().HasIndex(&domain.User{}, "idx_users_email") {
+			return tx.Migrator().DropIndex(&domain.User{}, "idx_users_email")
+		}
+		return nil
+	})
+}
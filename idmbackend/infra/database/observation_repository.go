@@ -0,0 +1,116 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMObservationRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMObservationRepository(db *gorm.DB) *GORMObservationRepository {
+	return &GORMObservationRepository{db: db}
+}
+
+// Create 保存观测记录，记录归属 scope 所在的组织
+func (r *GORMObservationRepository) Create(scope domain.TenantScope, observation *domain.Observation) error {
+	observation.OrgID = scope.OrgID
+	return r.db.Create(observation).Error
+}
+
+func (r *GORMObservationRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Observation, error) {
+	var observation domain.Observation
+	err := scoped(r.db, scope).Preload("Species").First(&observation, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &observation, nil
+}
+
+// Find 按条件分页查询观测记录，返回当前页数据和满足条件的总数
+func (r *GORMObservationRepository) Find(scope domain.TenantScope, filter domain.ObservationFilter) ([]*domain.Observation, int64, error) {
+	query := r.filtered(scope, filter)
+
+	var total int64
+	if err := query.Model(&domain.Observation{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var observations []*domain.Observation
+	query = r.filtered(scope, filter).Preload("Species").Order("observed_at DESC").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&observations).Error; err != nil {
+		return nil, 0, err
+	}
+	return observations, total, nil
+}
+
+// Update 更新观测记录，只能修改 scope 所在组织的记录
+func (r *GORMObservationRepository) Update(scope domain.TenantScope, observation *domain.Observation) error {
+	observation.OrgID = scope.OrgID
+	return scoped(r.db, scope).Where("id = ?", observation.ID).Omit("Species").Select("*").Updates(observation).Error
+}
+
+func (r *GORMObservationRepository) Delete(scope domain.TenantScope, id uint) error {
+	return scoped(r.db, scope).Delete(&domain.Observation{}, id).Error
+}
+
+// CountBySpecies 统计区域内各物种的观测次数和个体总数
+func (r *GORMObservationRepository) CountBySpecies(scope domain.TenantScope, areaID string, from, to *time.Time) ([]domain.SpeciesCount, int64, error) {
+	query := r.filtered(scope, domain.ObservationFilter{AreaID: areaID, From: from, To: to})
+
+	var observations int64
+	if err := query.Model(&domain.Observation{}).Count(&observations).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var counts []domain.SpeciesCount
+	err := r.filtered(scope, domain.ObservationFilter{AreaID: areaID, From: from, To: to}).
+		Model(&domain.Observation{}).
+		Select("species_id, SUM(count) AS count").
+		Group("species_id").
+		Order("count DESC").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return counts, observations, nil
+}
+
+// FindAreaIDs 返回组织内有观测记录的所有区域
+func (r *GORMObservationRepository) FindAreaIDs(scope domain.TenantScope) ([]string, error) {
+	var areaIDs []string
+	err := scoped(r.db, scope).Model(&domain.Observation{}).Distinct().Order("area_id").Pluck("area_id", &areaIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return areaIDs, nil
+}
+
+func (r *GORMObservationRepository) filtered(scope domain.TenantScope, filter domain.ObservationFilter) *gorm.DB {
+	query := scoped(r.db, scope)
+	if filter.SpeciesID != 0 {
+		query = query.Where("species_id = ?", filter.SpeciesID)
+	}
+	if filter.AreaID != "" {
+		query = query.Where("area_id = ?", filter.AreaID)
+	}
+	if len(filter.AreaIDs) > 0 {
+		query = query.Where("area_id IN ?", filter.AreaIDs)
+	}
+	if filter.From != nil {
+		query = query.Where("observed_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("observed_at <= ?", *filter.To)
+	}
+	return query
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMOrganizationRepository(db *gorm.DB) *GORMOrganizationRepository {
+	return &GORMOrganizationRepository{db: db}
+}
+
+// FindAll 获取全部组织
+func (r *GORMOrganizationRepository) FindAll() ([]*domain.Organization, error) {
+	var orgs []*domain.Organization
+	if err := r.db.Order("id").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// FindByID 按ID查找组织，不存在时返回 nil
+func (r *GORMOrganizationRepository) FindByID(id uint) (*domain.Organization, error) {
+	var org domain.Organization
+	err := r.db.First(&org, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// FindBySlug 按标识查找组织，不存在时返回 nil
+func (r *GORMOrganizationRepository) FindBySlug(slug string) (*domain.Organization, error) {
+	var org domain.Organization
+	err := r.db.Where("slug = ?", slug).First(&org).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *GORMOrganizationRepository) Create(org *domain.Organization) error {
+	return r.db.Create(org).Error
+}
+
+// FindMembership 查找用户在组织中的成员身份，不存在时返回 nil
+func (r *GORMOrganizationRepository) FindMembership(orgID, userID uint) (*domain.Membership, error) {
+	var membership domain.Membership
+	err := r.db.Where("org_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// FindMembershipsByUser 获取用户加入的全部组织，按加入顺序排列
+func (r *GORMOrganizationRepository) FindMembershipsByUser(userID uint) ([]*domain.Membership, error) {
+	var memberships []*domain.Membership
+	if err := r.db.Preload("Organization").Where("user_id = ?", userID).Order("id").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// FindMembers 按条件分页查询组织成员，返回当前页数据和满足条件的总数
+func (r *GORMOrganizationRepository) FindMembers(orgID uint, filter domain.UserFilter) ([]*domain.Membership, int64, error) {
+	var total int64
+	if err := r.members(orgID, filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var memberships []*domain.Membership
+	query := r.members(orgID, filter).Preload("User").Order("memberships.user_id").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&memberships).Error; err != nil {
+		return nil, 0, err
+	}
+	return memberships, total, nil
+}
+
+func (r *GORMOrganizationRepository) members(orgID uint, filter domain.UserFilter) *gorm.DB {
+	query := r.db.Model(&domain.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.org_id = ?", orgID)
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		query = query.Where("users.username LIKE ? OR users.display_name LIKE ? OR users.email LIKE ?", like, like, like)
+	}
+	if filter.Role != "" {
+		query = query.Where("memberships.role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case domain.UserStatusActive:
+		query = query.Where("users.disabled_at IS NULL")
+	case domain.UserStatusDisabled:
+		query = query.Where("users.disabled_at IS NOT NULL")
+	}
+	return query
+}
+
+// SaveMembership 创建或更新成员身份
+func (r *GORMOrganizationRepository) SaveMembership(membership *domain.Membership) error {
+	return r.db.Omit("Organization", "User").Save(membership).Error
+}
+
+func (r *GORMOrganizationRepository) DeleteMembership(orgID, userID uint) error {
+	return r.db.Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&domain.Membership{}).Error
+}
+
+// CountByRole 统计在任一组织中使用该角色的成员数
+func (r *GORMOrganizationRepository) CountByRole(role domain.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Membership{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+// CountActiveMembersByRole 统计组织中使用该角色且账号未停用的成员数
+func (r *GORMOrganizationRepository) CountActiveMembersByRole(orgID uint, role domain.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.org_id = ? AND memberships.role = ? AND users.disabled_at IS NULL", orgID, role).
+		Count(&count).Error
+	return count, err
+}
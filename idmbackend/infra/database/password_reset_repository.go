@@ -0,0 +1,54 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMPasswordResetRepository(db *gorm.DB) *GORMPasswordResetRepository {
+	return &GORMPasswordResetRepository{db: db}
+}
+
+func (r *GORMPasswordResetRepository) Create(token *domain.PasswordResetToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindByHash 按令牌摘要查找，不存在时返回 nil
+func (r *GORMPasswordResetRepository) FindByHash(tokenHash string) (*domain.PasswordResetToken, error) {
+	var token domain.PasswordResetToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed 将令牌标记为已使用，仅当其尚未使用时成功，保证令牌只能使用一次
+func (r *GORMPasswordResetRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&domain.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateForUser 使用户所有未使用的重置令牌失效，并清理过期记录
+func (r *GORMPasswordResetRepository) InvalidateForUser(userID uint, at time.Time) error {
+	if err := r.db.Model(&domain.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", at).Error; err != nil {
+		return err
+	}
+	return r.db.Where("expires_at < ?", at.Add(-24*time.Hour)).Delete(&domain.PasswordResetToken{}).Error
+}
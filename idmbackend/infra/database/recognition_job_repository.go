@@ -0,0 +1,216 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMRecognitionJobRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMRecognitionJobRepository(db *gorm.DB) *GORMRecognitionJobRepository {
+	return &GORMRecognitionJobRepository{db: db}
+}
+
+// CreateJob 在同一事务中保存任务及其全部图片，任务归属 scope 所在的组织
+func (r *GORMRecognitionJobRepository) CreateJob(scope domain.TenantScope, job *domain.RecognitionJob, items []*domain.RecognitionJobItem) error {
+	job.OrgID = scope.OrgID
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			item.JobID = job.ID
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(items, 100).Error
+	})
+}
+
+// FindJob 查找组织内的任务，不存在时返回 nil
+func (r *GORMRecognitionJobRepository) FindJob(scope domain.TenantScope, id uint) (*domain.RecognitionJob, error) {
+	var job domain.RecognitionJob
+	err := scoped(r.db, scope).First(&job, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindJobs 分页查询组织内的任务，userID 为 0 时不按提交人过滤
+func (r *GORMRecognitionJobRepository) FindJobs(scope domain.TenantScope, userID uint, offset, limit int) ([]*domain.RecognitionJob, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.RecognitionJob{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []*domain.RecognitionJob
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// FindItems 分页查询任务中的图片，status 为空时返回全部，limit 为 0 时不分页
+func (r *GORMRecognitionJobRepository) FindItems(jobID uint, status domain.JobItemStatus, offset, limit int) ([]*domain.RecognitionJobItem, int64, error) {
+	query := r.db.Model(&domain.RecognitionJobItem{}).Where("job_id = ?", jobID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []*domain.RecognitionJobItem
+	query = query.Order("id").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// CountLabels 按标签统计任务中识别成功的图片数量，数量多的在前
+func (r *GORMRecognitionJobRepository) CountLabels(jobID uint) ([]domain.LabelCount, error) {
+	var counts []domain.LabelCount
+	err := r.db.Model(&domain.RecognitionJobItem{}).
+		Select("label, species_id, COUNT(*) AS count").
+		Where("job_id = ? AND status = ?", jobID, domain.JobItemSucceeded).
+		Group("label, species_id").
+		Order("count DESC, label").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// NextJobs 返回每个组织最早提交且尚未完成的任务，按提交顺序排列
+func (r *GORMRecognitionJobRepository) NextJobs() ([]*domain.RecognitionJob, error) {
+	oldest := r.db.Model(&domain.RecognitionJob{}).Select("MIN(id)").
+		Where("status IN ?", []domain.RecognitionJobStatus{domain.JobQueued, domain.JobRunning}).
+		Group("org_id")
+	var jobs []*domain.RecognitionJob
+	if err := r.db.Where("id IN (?)", oldest).Order("id").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// StartJob 将排队中的任务标记为处理中
+func (r *GORMRecognitionJobRepository) StartJob(jobID uint, at time.Time) error {
+	return r.db.Model(&domain.RecognitionJob{}).
+		Where("id = ? AND status = ?", jobID, domain.JobQueued).
+		Updates(map[string]interface{}{"status": domain.JobRunning, "started_at": at}).Error
+}
+
+// UpdateItem 更新图片的处理状态和尝试次数
+func (r *GORMRecognitionJobRepository) UpdateItem(item *domain.RecognitionJobItem) error {
+	return r.db.Model(item).Select("status", "attempts", "error").Updates(item).Error
+}
+
+// CompleteItem 保存图片的最终结果，并在同一事务中累加任务的成功或失败计数
+func (r *GORMRecognitionJobRepository) CompleteItem(item *domain.RecognitionJobItem) error {
+	counter := "failed"
+	if item.Status == domain.JobItemSucceeded {
+		counter = "succeeded"
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(item).
+			Select("status", "attempts", "error", "recognition_id", "label", "species_id", "score").
+			Updates(item).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&domain.RecognitionJob{}).Where("id = ?", item.JobID).
+			UpdateColumn(counter, gorm.Expr(counter+" + 1")).Error
+	})
+}
+
+// FinishJob 按图片状态重新统计计数，所有图片都处理完毕时将任务标记为完成
+func (r *GORMRecognitionJobRepository) FinishJob(jobID uint, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			Status domain.JobItemStatus
+			Count  int
+		}
+		err := tx.Model(&domain.RecognitionJobItem{}).Select("status, COUNT(*) AS count").
+			Where("job_id = ?", jobID).Group("status").Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"succeeded": 0, "failed": 0}
+		finished := true
+		for _, row := range rows {
+			switch row.Status {
+			case domain.JobItemSucceeded:
+				updates["succeeded"] = row.Count
+			case domain.JobItemFailed:
+				updates["failed"] = row.Count
+			default:
+				finished = false
+			}
+		}
+		if finished {
+			updates["status"] = domain.JobCompleted
+			updates["finished_at"] = at
+		}
+		return tx.Model(&domain.RecognitionJob{}).Where("id = ?", jobID).Updates(updates).Error
+	})
+}
+
+// ResetRunningItems 将上次退出时处理中的图片恢复为待处理，返回恢复的数量
+func (r *GORMRecognitionJobRepository) ResetRunningItems() (int64, error) {
+	result := r.db.Model(&domain.RecognitionJobItem{}).
+		Where("status = ?", domain.JobItemRunning).
+		Update("status", domain.JobItemPending)
+	return result.RowsAffected, result.Error
+}
+
+// FindItemsByJobs 查询多个任务中的全部图片
+func (r *GORMRecognitionJobRepository) FindItemsByJobs(jobIDs []uint) ([]*domain.RecognitionJobItem, error) {
+	var items []*domain.RecognitionJobItem
+	if len(jobIDs) == 0 {
+		return items, nil
+	}
+	if err := r.db.Where("job_id IN ?", jobIDs).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// DeleteJobs 在同一事务中删除任务及其全部图片记录
+func (r *GORMRecognitionJobRepository) DeleteJobs(jobIDs []uint) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id IN ?", jobIDs).Delete(&domain.RecognitionJobItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", jobIDs).Delete(&domain.RecognitionJob{}).Error
+	})
+}
+
+// CountItemsByImageKey 统计引用同一张识别图片的任务图片数，不区分组织
+func (r *GORMRecognitionJobRepository) CountItemsByImageKey(key string) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.RecognitionJobItem{}).Where("image_key = ?", key).Count(&count).Error
+	return count, err
+}
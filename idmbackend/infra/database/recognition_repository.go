@@ -0,0 +1,103 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMRecognitionRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMRecognitionRepository(db *gorm.DB) *GORMRecognitionRepository {
+	return &GORMRecognitionRepository{db: db}
+}
+
+// Create 保存识别记录，记录归属 scope 所在的组织
+func (r *GORMRecognitionRepository) Create(scope domain.TenantScope, recognition *domain.Recognition) error {
+	recognition.OrgID = scope.OrgID
+	return r.db.Create(recognition).Error
+}
+
+// FindByID 查找组织内的识别记录，不存在时返回 nil
+func (r *GORMRecognitionRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Recognition, error) {
+	var recognition domain.Recognition
+	err := scoped(r.db, scope).First(&recognition, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &recognition, nil
+}
+
+// Find 按条件分页查询识别记录，按时间倒序，返回当前页数据和满足条件的总数
+func (r *GORMRecognitionRepository) Find(scope domain.TenantScope, filter domain.RecognitionFilter) ([]*domain.Recognition, int64, error) {
+	var total int64
+	if err := r.filtered(scope, filter).Model(&domain.Recognition{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var recognitions []*domain.Recognition
+	query := r.filtered(scope, filter).Order("id DESC").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&recognitions).Error; err != nil {
+		return nil, 0, err
+	}
+	return recognitions, total, nil
+}
+
+// FindAfter 按写入顺序获取 ID 大于 afterID 的记录，用于分批导出
+func (r *GORMRecognitionRepository) FindAfter(scope domain.TenantScope, filter domain.RecognitionFilter, afterID uint, limit int) ([]*domain.Recognition, error) {
+	var recognitions []*domain.Recognition
+	err := r.filtered(scope, filter).Where("id > ?", afterID).Order("id").Limit(limit).Find(&recognitions).Error
+	if err != nil {
+		return nil, err
+	}
+	return recognitions, nil
+}
+
+// Update 更新识别记录的标注和审核字段，只能修改 scope 所在组织的记录
+func (r *GORMRecognitionRepository) Update(scope domain.TenantScope, recognition *domain.Recognition) error {
+	return scoped(r.db, scope).Model(&domain.Recognition{}).Where("id = ?", recognition.ID).
+		Select("label", "species_id", "status", "feedback_at", "reviewer_id", "reviewed_at", "review_note").
+		Updates(recognition).Error
+}
+
+// DeletePending 删除指定的识别记录中用户尚未反馈的记录，已确认或已审核的记录保留
+func (r *GORMRecognitionRepository) DeletePending(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Where("id IN ? AND status = ?", ids, domain.RecognitionPending).Delete(&domain.Recognition{}).Error
+}
+
+// CountByImageKey 统计引用同一张识别图片的记录数，不区分组织
+func (r *GORMRecognitionRepository) CountByImageKey(key string) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Recognition{}).Where("image_key = ?", key).Count(&count).Error
+	return count, err
+}
+
+func (r *GORMRecognitionRepository) filtered(scope domain.TenantScope, filter domain.RecognitionFilter) *gorm.DB {
+	query := scoped(r.db, scope)
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.Label != "" {
+		query = query.Where("label = ?", filter.Label)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	return query
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMRoleRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMRoleRepository(db *gorm.DB) *GORMRoleRepository {
+	return &GORMRoleRepository{db: db}
+}
+
+// FindAll 获取全部自定义角色
+func (r *GORMRoleRepository) FindAll() ([]*domain.RoleDefinition, error) {
+	var roles []*domain.RoleDefinition
+	if err := r.db.Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// FindByName 按名称查找自定义角色，不存在时返回 nil
+func (r *GORMRoleRepository) FindByName(name domain.Role) (*domain.RoleDefinition, error) {
+	var role domain.RoleDefinition
+	err := r.db.Where("name = ?", name).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Save 创建或更新自定义角色
+func (r *GORMRoleRepository) Save(role *domain.RoleDefinition) error {
+	return r.db.Save(role).Error
+}
+
+func (r *GORMRoleRepository) Delete(name domain.Role) error {
+	return r.db.Where("name = ?", name).Delete(&domain.RoleDefinition{}).Error
+}
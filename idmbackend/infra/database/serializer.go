@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("empty_null", emptyAsNullSerializer{})
+}
+
+// emptyAsNullSerializer 空字符串保存为 NULL，读取时 NULL 还原为空字符串。
+// 用于可选且唯一的列：MySQL 唯一索引允许多个 NULL，但不允许多个空字符串
+type emptyAsNullSerializer struct{}
+
+func (emptyAsNullSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported value %T for %s", dbValue, field.Name)
+	}
+	return field.Set(ctx, dst, value)
+}
+
+func (emptyAsNullSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	return emptyAsNull(fieldValue.(string)), nil
+}
+
+// emptyAsNull 按 empty_null 序列化器的规则转换，用于按列名更新的场景
+func emptyAsNull(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
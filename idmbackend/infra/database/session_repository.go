@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"github.com/MoyInGxing/idm/domain"
 	"gorm.io/gorm"
 )
@@ -17,15 +19,78 @@ func (r *GORMSessionRepository) Create(session *domain.Session) error {
 	return r.db.Create(session).Error
 }
 
-func (r *GORMSessionRepository) FindByToken(token string) (*domain.Session, error) {
+// FindByTokenHash 按刷新令牌摘要查找会话，不存在时返回 nil
+func (r *GORMSessionRepository) FindByTokenHash(tokenHash string) (*domain.Session, error) {
+	var session domain.Session
+	err := r.db.Where("token = ?", tokenHash).First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Rotate 在一个事务中将会话标记为已轮换并保存同一会话族的下一条刷新令牌。
+// 仅当会话尚未被轮换或吊销时成功，避免并发刷新同一令牌；失败时不会留下已轮换但没有后继的会话
+func (r *GORMSessionRepository) Rotate(id uint, at time.Time, next *domain.Session) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.Session{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+			Update("rotated_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		rotated = true
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+// RevokeFamily 吊销同一会话族下的全部刷新令牌
+func (r *GORMSessionRepository) RevokeFamily(familyID string, at time.Time) error {
+	return r.db.Model(&domain.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
+
+// RevokeUser 吊销用户的全部会话
+func (r *GORMSessionRepository) RevokeUser(userID uint, at time.Time) error {
+	return r.db.Model(&domain.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
+
+// FindActiveFamily 返回会话族中未轮换、未吊销且未过期的刷新令牌，会话族已失效时返回 nil
+func (r *GORMSessionRepository) FindActiveFamily(familyID string, now time.Time) (*domain.Session, error) {
 	var session domain.Session
-	err := r.db.Where("token = ?", token).First(&session).Error
+	err := r.db.Where("family_id = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expiry > ?", familyID, now).
+		Order("id DESC").First(&session).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &session, nil
 }
 
-func (r *GORMSessionRepository) Delete(session *domain.Session) error {
-	return r.db.Delete(session).Error
+// UpdateFamilyOrg 切换会话族的组织上下文，已签发的访问令牌随即生效
+func (r *GORMSessionRepository) UpdateFamilyOrg(familyID string, orgID uint) error {
+	return r.db.Model(&domain.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("org_id", orgID).Error
+}
+
+// DeleteExpired 清理过期的会话记录
+func (r *GORMSessionRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expiry < ?", before).Delete(&domain.Session{}).Error
 }
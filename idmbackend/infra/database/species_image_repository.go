@@ -0,0 +1,134 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMSpeciesImageRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMSpeciesImageRepository(db *gorm.DB) *GORMSpeciesImageRepository {
+	return &GORMSpeciesImageRepository{db: db}
+}
+
+func (r *GORMSpeciesImageRepository) FindBySpeciesID(speciesID uint) ([]*domain.SpeciesImage, error) {
+	var images []*domain.SpeciesImage
+	err := r.db.Preload("Thumbnails").
+		Where("species_id = ?", speciesID).
+		Order("is_primary DESC, created_at").
+		Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// FindAll 获取所有物种的图片，用于构建离线识别的参考图库
+func (r *GORMSpeciesImageRepository) FindAll() ([]*domain.SpeciesImage, error) {
+	var images []*domain.SpeciesImage
+	err := r.db.Preload("Thumbnails").Order("species_id, id").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *GORMSpeciesImageRepository) FindByID(speciesID, imageID uint) (*domain.SpeciesImage, error) {
+	var image domain.SpeciesImage
+	err := r.db.Preload("Thumbnails").
+		Where("id = ? AND species_id = ?", imageID, speciesID).
+		First(&image).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (r *GORMSpeciesImageRepository) FindByHash(speciesID uint, hash string) (*domain.SpeciesImage, error) {
+	var image domain.SpeciesImage
+	err := r.db.Preload("Thumbnails").
+		Where("species_id = ? AND content_hash = ?", speciesID, hash).
+		First(&image).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+// Create 保存图片及缩略图；物种还没有主图时新图片自动成为主图，
+// 同一物种下内容哈希重复时返回 domain.ErrDuplicateImage
+func (r *GORMSpeciesImageRepository) Create(image *domain.SpeciesImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&domain.SpeciesImage{}).
+			Where("species_id = ? AND is_primary = ?", image.SpeciesID, true).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		image.IsPrimary = count == 0
+		err := tx.Create(image).Error
+		if translator, ok := tx.Dialector.(gorm.ErrorTranslator); ok {
+			err = translator.Translate(err)
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrDuplicateImage
+		}
+		return err
+	})
+}
+
+// SetPrimary 将指定图片设为主图，同一物种的其他图片取消主图标记
+func (r *GORMSpeciesImageRepository) SetPrimary(speciesID, imageID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.SpeciesImage{}).
+			Where("species_id = ?", speciesID).
+			Update("is_primary", false).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&domain.SpeciesImage{}).
+			Where("id = ? AND species_id = ?", imageID, speciesID).
+			Update("is_primary", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrImageNotFound
+		}
+		return nil
+	})
+}
+
+// Delete 删除图片记录；被删除的是主图时由最早上传的剩余图片接替
+func (r *GORMSpeciesImageRepository) Delete(image *domain.SpeciesImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", image.ID).Delete(&domain.SpeciesImageThumbnail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&domain.SpeciesImage{}, image.ID).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+
+		var next domain.SpeciesImage
+		err := tx.Where("species_id = ?", image.SpeciesID).Order("created_at").First(&next).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_primary", true).Error
+	})
+}
@@ -1,6 +1,9 @@
 package database
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/MoyInGxing/idm/domain"
 	"gorm.io/gorm"
 )
@@ -24,8 +27,11 @@ func (r *GORMSpeciesRepository) FindAll() ([]*domain.Species, error) {
 
 func (r *GORMSpeciesRepository) FindByID(id uint) (*domain.Species, error) {
 	var species domain.Species
-	err := r.db.First(&species, id).Error
+	err := r.db.Preload("Names").First(&species, id).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &species, nil
@@ -42,3 +48,130 @@ func (r *GORMSpeciesRepository) Update(species *domain.Species) error {
 func (r *GORMSpeciesRepository) Delete(id uint) error {
 	return r.db.Delete(&domain.Species{}, id).Error
 }
+
+// FindExistingScientificNames 返回给定学名中已存在于物种库的部分，不区分大小写
+func (r *GORMSpeciesRepository) FindExistingScientificNames(names []string) ([]string, error) {
+	var existing []string
+	err := r.db.Model(&domain.Species{}).
+		Where("LOWER(scientific_name) IN ?", lowerAll(names)).
+		Pluck("scientific_name", &existing).Error
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// FindExistingNames 返回给定名称中已被物种名、学名或俗名/异名占用的部分，不区分大小写
+func (r *GORMSpeciesRepository) FindExistingNames(names []string) ([]string, error) {
+	lowered := lowerAll(names)
+	var species []*domain.Species
+	err := r.db.Select("species_name", "scientific_name").
+		Where("LOWER(species_name) IN ? OR LOWER(scientific_name) IN ?", lowered, lowered).
+		Find(&species).Error
+	if err != nil {
+		return nil, err
+	}
+	var existing []string
+	err = r.db.Model(&domain.SpeciesName{}).
+		Where("LOWER(name) IN ?", lowered).
+		Pluck("name", &existing).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range species {
+		existing = append(existing, s.SpeciesName, s.ScientificName)
+	}
+	return existing, nil
+}
+
+func lowerAll(names []string) []string {
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(name)
+	}
+	return lowered
+}
+
+// ImportRecords 在一个事务中写入物种、俗名及其分类路径，任意一条失败时全部回滚
+func (r *GORMSpeciesRepository) ImportRecords(records []*domain.SpeciesRecord) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			var parentID *uint
+			for i := range record.Lineage {
+				taxon, err := findOrCreateTaxon(tx, record.Lineage[i], parentID)
+				if err != nil {
+					return err
+				}
+				record.Lineage[i] = *taxon
+				parentID = &taxon.ID
+			}
+			if len(record.Lineage) > 0 {
+				record.Species.TaxonID = parentID
+			}
+
+			if err := tx.Create(record.Species).Error; err != nil {
+				return fmt.Errorf("failed to create species %s: %w", record.Species.ScientificName, err)
+			}
+		}
+		return nil
+	})
+}
+
+// findOrCreateTaxon 按阶元、学名和父节点查找分类单元，不存在时创建
+func findOrCreateTaxon(tx *gorm.DB, taxon domain.Taxon, parentID *uint) (*domain.Taxon, error) {
+	query := tx.Where("`rank` = ? AND scientific_name = ?", taxon.Rank, taxon.ScientificName)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var existing domain.Taxon
+	err := query.First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	taxon.ID = 0
+	taxon.ParentID = parentID
+	if err := tx.Create(&taxon).Error; err != nil {
+		return nil, err
+	}
+	return &taxon, nil
+}
+
+// FindAllRecords 返回全部物种及其俗名和分类路径
+func (r *GORMSpeciesRepository) FindAllRecords() ([]*domain.SpeciesRecord, error) {
+	var species []*domain.Species
+	if err := r.db.Preload("Names").Order("id").Find(&species).Error; err != nil {
+		return nil, err
+	}
+
+	var taxa []*domain.Taxon
+	if err := r.db.Find(&taxa).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*domain.Taxon, len(taxa))
+	for _, t := range taxa {
+		byID[t.ID] = t
+	}
+
+	records := make([]*domain.SpeciesRecord, len(species))
+	for i, s := range species {
+		record := &domain.SpeciesRecord{Species: s}
+		next := s.TaxonID
+		for depth := 0; next != nil && depth < len(domain.TaxonRanks)*4; depth++ {
+			taxon, ok := byID[*next]
+			if !ok {
+				break
+			}
+			record.Lineage = append([]domain.Taxon{*taxon}, record.Lineage...)
+			next = taxon.ParentID
+		}
+		records[i] = record
+	}
+	return records, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMTaxonomyRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMTaxonomyRepository(db *gorm.DB) *GORMTaxonomyRepository {
+	return &GORMTaxonomyRepository{db: db}
+}
+
+func (r *GORMTaxonomyRepository) CreateTaxon(taxon *domain.Taxon) error {
+	return r.db.Create(taxon).Error
+}
+
+func (r *GORMTaxonomyRepository) FindTaxonByID(id uint) (*domain.Taxon, error) {
+	var taxon domain.Taxon
+	err := r.db.First(&taxon, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &taxon, nil
+}
+
+func (r *GORMTaxonomyRepository) FindChildTaxa(parentID uint) ([]*domain.Taxon, error) {
+	var taxa []*domain.Taxon
+	err := r.db.Where("parent_id = ?", parentID).Order("scientific_name").Find(&taxa).Error
+	if err != nil {
+		return nil, err
+	}
+	return taxa, nil
+}
+
+// FindSpeciesByName 依次按物种名、学名、俗名/异名、种级分类单元学名查找物种
+func (r *GORMTaxonomyRepository) FindSpeciesByName(name string) (*domain.Species, error) {
+	var species domain.Species
+
+	err := r.db.Preload("Names").
+		Where("species_name = ? OR scientific_name = ?", name, name).
+		First(&species).Error
+	if err == nil {
+		return &species, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	err = r.db.Preload("Names").
+		Where("id IN (?)", r.db.Model(&domain.SpeciesName{}).Select("species_id").Where("name = ?", name)).
+		First(&species).Error
+	if err == nil {
+		return &species, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	err = r.db.Preload("Names").
+		Where("taxon_id IN (?)", r.db.Model(&domain.Taxon{}).Select("id").
+			Where("`rank` = ? AND scientific_name = ?", domain.RankSpecies, name)).
+		First(&species).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &species, nil
+}
+
+func (r *GORMTaxonomyRepository) FindSpeciesNames(speciesID uint) ([]*domain.SpeciesName, error) {
+	var names []*domain.SpeciesName
+	err := r.db.Where("species_id = ?", speciesID).Order("preferred DESC, language, name").Find(&names).Error
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (r *GORMTaxonomyRepository) AddSpeciesName(name *domain.SpeciesName) error {
+	return r.db.Create(name).Error
+}
+
+// DeleteSpeciesName 返回是否删除了名称
+func (r *GORMTaxonomyRepository) DeleteSpeciesName(speciesID, nameID uint) (bool, error) {
+	result := r.db.Where("id = ? AND species_id = ?", nameID, speciesID).Delete(&domain.SpeciesName{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
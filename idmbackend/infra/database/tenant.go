@@ -0,0 +1,11 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+// scoped 为查询加上租户条件。OrgID 为 0 时匹配不到任何记录，未确定组织的请求看不到数据
+func scoped(db *gorm.DB, scope domain.TenantScope) *gorm.DB {
+	return db.Where("org_id = ?", scope.OrgID)
+}
@@ -1,7 +1,7 @@
 package database
 
 import (
-	"log"
+	"time"
 
 	"github.com/MoyInGxing/idm/domain"
 	"gorm.io/gorm"
@@ -15,15 +15,22 @@ func NewGORMUserRepository(db *gorm.DB) *GORMUserRepository {
 	return &GORMUserRepository{db: db}
 }
 
-func (r *GORMUserRepository) Create(user *domain.User) error {
-	log.Printf("正在创建用户: %+v", user)
-	err := r.db.Create(user).Error
-	if err != nil {
-		log.Printf("创建用户失败: %v", err)
+// CreateWithMembership 在同一事务中创建用户及其组织成员身份，membership 可以为 nil
+func (r *GORMUserRepository) CreateWithMembership(user *domain.User, membership *domain.Membership) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createUserWithMembership(tx, user, membership)
+	})
+}
+
+func createUserWithMembership(tx *gorm.DB, user *domain.User, membership *domain.Membership) error {
+	if err := tx.Create(user).Error; err != nil {
 		return err
 	}
-	log.Printf("用户创建成功，ID: %d", user.ID)
-	return nil
+	if membership == nil {
+		return nil
+	}
+	membership.UserID = user.ID
+	return tx.Create(membership).Error
 }
 
 func (r *GORMUserRepository) FindByUsername(username string) (*domain.User, error) {
@@ -38,31 +45,77 @@ func (r *GORMUserRepository) FindByUsername(username string) (*domain.User, erro
 	return &user, nil
 }
 
+// FindByID 按ID查找用户，不存在时返回 nil
 func (r *GORMUserRepository) FindByID(id uint) (*domain.User, error) {
 	var user domain.User
 	err := r.db.First(&user, id).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-// FindAll 获取所有用户
-func (r *GORMUserRepository) FindAll() ([]*domain.User, error) {
-	var users []*domain.User
-	err := r.db.Find(&users).Error
+// UpdateRole 更新用户角色
+func (r *GORMUserRepository) UpdateRole(userID string, role domain.Role) error {
+	return r.db.Model(&domain.User{}).Where("id = ?", userID).Update("role", role).Error
+}
+
+// CountByRole 统计拥有指定角色的用户数
+func (r *GORMUserRepository) CountByRole(role domain.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+// CountActiveByRole 统计拥有指定角色且未停用的用户数
+func (r *GORMUserRepository) CountActiveByRole(role domain.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.User{}).Where("role = ? AND disabled_at IS NULL", role).Count(&count).Error
+	return count, err
+}
+
+// FindByEmail 按邮箱查找用户，不存在时返回 nil
+func (r *GORMUserRepository) FindByEmail(email string) (*domain.User, error) {
+	var user domain.User
+	err := r.db.Where("email = ?", email).First(&user).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
-	return users, nil
+	return &user, nil
 }
 
-// Delete 删除用户
-func (r *GORMUserRepository) Delete(userID string) error {
-	return r.db.Delete(&domain.User{}, userID).Error
+// UpdatePassword 更新密码哈希和修改时间
+func (r *GORMUserRepository) UpdatePassword(user *domain.User) error {
+	return r.db.Model(&domain.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"password": user.Password, "password_changed_at": user.PasswordChangedAt}).Error
 }
 
-// UpdateRole 更新用户角色
-func (r *GORMUserRepository) UpdateRole(userID string, role domain.Role) error {
-	return r.db.Model(&domain.User{}).Where("id = ?", userID).Update("role", role).Error
+// UpdateProfile 更新用户可自行维护的资料字段
+func (r *GORMUserRepository) UpdateProfile(user *domain.User) error {
+	return r.db.Model(&domain.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"display_name": user.DisplayName,
+			"email":        emptyAsNull(user.Email),
+			"phone":        user.Phone,
+			"locale":       user.Locale,
+			"timezone":     user.Timezone,
+			"avatar_key":   user.AvatarKey,
+		}).Error
+}
+
+// SetDisabled 停用或启用账号，at 为 nil 时启用
+func (r *GORMUserRepository) SetDisabled(id uint, at *time.Time) error {
+	return r.db.Model(&domain.User{}).Where("id = ?", id).Update("disabled_at", at).Error
+}
+
+// TouchLastLogin 记录最近一次登录的时间和来源地址
+func (r *GORMUserRepository) TouchLastLogin(id uint, at time.Time, ip string) error {
+	return r.db.Model(&domain.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_login_at": at, "last_login_ip": ip}).Error
 }
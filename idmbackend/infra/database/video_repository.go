@@ -0,0 +1,166 @@
+package database
+
+import (
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type GORMVideoRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMVideoRepository(db *gorm.DB) *GORMVideoRepository {
+	return &GORMVideoRepository{db: db}
+}
+
+// Create 保存视频记录，视频归属 scope 所在的组织
+func (r *GORMVideoRepository) Create(scope domain.TenantScope, video *domain.Video) error {
+	video.OrgID = scope.OrgID
+	return r.db.Create(video).Error
+}
+
+// FindByID 查找组织内的视频，不存在时返回 nil
+func (r *GORMVideoRepository) FindByID(scope domain.TenantScope, id uint) (*domain.Video, error) {
+	var video domain.Video
+	err := scoped(r.db, scope).First(&video, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &video, nil
+}
+
+// Find 按名称关键字分页查询视频，按上传时间倒序
+func (r *GORMVideoRepository) Find(scope domain.TenantScope, keyword string, offset, limit int) ([]*domain.Video, int64, error) {
+	query := scoped(r.db, scope).Model(&domain.Video{})
+	if keyword != "" {
+		query = query.Where("name LIKE ?", "%"+keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var videos []*domain.Video
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&videos).Error; err != nil {
+		return nil, 0, err
+	}
+	return videos, total, nil
+}
+
+// Update 更新视频的描述信息
+func (r *GORMVideoRepository) Update(scope domain.TenantScope, video *domain.Video) error {
+	return scoped(r.db, scope).Model(&domain.Video{}).Where("id = ?", video.ID).
+		Select("name", "description", "source_url", "duration", "width", "height", "frame_rate").
+		Updates(video).Error
+}
+
+// Delete 在同一事务中删除视频及其全部标注
+func (r *GORMVideoRepository) Delete(scope domain.TenantScope, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := scoped(tx, scope).Where("video_id = ?", id).Delete(&domain.Annotation{}).Error; err != nil {
+			return err
+		}
+		return scoped(tx, scope).Delete(&domain.Video{}, id).Error
+	})
+}
+
+// CreateAnnotations 批量保存同一视频的标注
+func (r *GORMVideoRepository) CreateAnnotations(scope domain.TenantScope, annotations []*domain.Annotation) error {
+	for _, a := range annotations {
+		a.OrgID = scope.OrgID
+	}
+	return r.db.CreateInBatches(annotations, 200).Error
+}
+
+// FindAnnotation 查找视频中的一条标注，不存在时返回 nil
+func (r *GORMVideoRepository) FindAnnotation(scope domain.TenantScope, videoID, id uint) (*domain.Annotation, error) {
+	var annotation domain.Annotation
+	err := scoped(r.db, scope).Where("video_id = ?", videoID).First(&annotation, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// FindAnnotations 按时间范围和行为分页查询视频的标注，按视频时间排序
+func (r *GORMVideoRepository) FindAnnotations(scope domain.TenantScope, videoID uint, filter domain.AnnotationFilter) ([]*domain.Annotation, int64, error) {
+	query := r.annotations(scope, videoID, filter.From, filter.To)
+	if filter.Behavior != "" {
+		query = query.Where("behavior = ?", filter.Behavior)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var annotations []*domain.Annotation
+	query = query.Order("time_offset, id").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&annotations).Error; err != nil {
+		return nil, 0, err
+	}
+	return annotations, total, nil
+}
+
+// UpdateAnnotation 更新标注内容
+func (r *GORMVideoRepository) UpdateAnnotation(scope domain.TenantScope, annotation *domain.Annotation) error {
+	return scoped(r.db, scope).Model(&domain.Annotation{}).
+		Where("id = ? AND video_id = ?", annotation.ID, annotation.VideoID).
+		Select("time_offset", "fish_count", "behavior", "confidence", "detections", "source").
+		Updates(annotation).Error
+}
+
+func (r *GORMVideoRepository) DeleteAnnotation(scope domain.TenantScope, videoID, id uint) error {
+	return scoped(r.db, scope).Where("video_id = ?", videoID).Delete(&domain.Annotation{}, id).Error
+}
+
+// FishCountSeries 按 interval 秒分段统计鱼群数量，只返回有标注的区间
+func (r *GORMVideoRepository) FishCountSeries(scope domain.TenantScope, videoID uint, from, to *float64, interval float64) ([]domain.FishCountPoint, error) {
+	var rows []struct {
+		Bucket  int64
+		Samples int
+		Mean    float64
+		Min     int
+		Max     int
+	}
+	err := r.annotations(scope, videoID, from, to).
+		Select("FLOOR(time_offset / ?) AS bucket, COUNT(*) AS samples, AVG(fish_count) AS mean, MIN(fish_count) AS min, MAX(fish_count) AS max", interval).
+		Group("bucket").Order("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]domain.FishCountPoint, 0, len(rows))
+	for _, row := range rows {
+		start := float64(row.Bucket) * interval
+		points = append(points, domain.FishCountPoint{
+			Start:   start,
+			End:     start + interval,
+			Samples: row.Samples,
+			Mean:    row.Mean,
+			Min:     row.Min,
+			Max:     row.Max,
+		})
+	}
+	return points, nil
+}
+
+func (r *GORMVideoRepository) annotations(scope domain.TenantScope, videoID uint, from, to *float64) *gorm.DB {
+	query := scoped(r.db, scope).Model(&domain.Annotation{}).Where("video_id = ?", videoID)
+	if from != nil {
+		query = query.Where("time_offset >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("time_offset <= ?", *to)
+	}
+	return query
+}
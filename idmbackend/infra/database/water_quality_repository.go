@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"github.com/MoyInGxing/idm/domain"
 	"gorm.io/gorm"
 )
@@ -13,18 +15,22 @@ func NewGORMWaterQualityRepository(db *gorm.DB) *GORMWaterQualityRepository {
 	return &GORMWaterQualityRepository{db: db}
 }
 
-func (r *GORMWaterQualityRepository) FindAll() ([]*domain.WaterQuality, error) {
+func (r *GORMWaterQualityRepository) FindAll(scope domain.TenantScope, areaIDs []string) ([]*domain.WaterQuality, error) {
 	var waterQuality []*domain.WaterQuality
-	err := r.db.Order("record_time DESC").Find(&waterQuality).Error
+	query := scoped(r.db, scope)
+	if len(areaIDs) > 0 {
+		query = query.Where("area_id IN ?", areaIDs)
+	}
+	err := query.Order("record_time DESC").Find(&waterQuality).Error
 	if err != nil {
 		return nil, err
 	}
 	return waterQuality, nil
 }
 
-func (r *GORMWaterQualityRepository) FindByRecordID(recordID string) (*domain.WaterQuality, error) {
+func (r *GORMWaterQualityRepository) FindByRecordID(scope domain.TenantScope, recordID string) (*domain.WaterQuality, error) {
 	var waterQuality domain.WaterQuality
-	err := r.db.Where("record_id = ?", recordID).First(&waterQuality).Error
+	err := scoped(r.db, scope).Where("record_id = ?", recordID).First(&waterQuality).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
@@ -34,18 +40,18 @@ func (r *GORMWaterQualityRepository) FindByRecordID(recordID string) (*domain.Wa
 	return &waterQuality, nil
 }
 
-func (r *GORMWaterQualityRepository) FindByAreaID(areaID string) ([]*domain.WaterQuality, error) {
+func (r *GORMWaterQualityRepository) FindByAreaID(scope domain.TenantScope, areaID string) ([]*domain.WaterQuality, error) {
 	var waterQuality []*domain.WaterQuality
-	err := r.db.Where("area_id = ?", areaID).Order("record_time DESC").Find(&waterQuality).Error
+	err := scoped(r.db, scope).Where("area_id = ?", areaID).Order("record_time DESC").Find(&waterQuality).Error
 	if err != nil {
 		return nil, err
 	}
 	return waterQuality, nil
 }
 
-func (r *GORMWaterQualityRepository) FindByAreaIDWithPagination(areaID string, offset, limit int) ([]*domain.WaterQuality, error) {
+func (r *GORMWaterQualityRepository) FindByAreaIDWithPagination(scope domain.TenantScope, areaID string, offset, limit int) ([]*domain.WaterQuality, error) {
 	var waterQuality []*domain.WaterQuality
-	err := r.db.Where("area_id = ?", areaID).
+	err := scoped(r.db, scope).Where("area_id = ?", areaID).
 		Order("record_time DESC").
 		Offset(offset).
 		Limit(limit).
@@ -56,21 +62,25 @@ func (r *GORMWaterQualityRepository) FindByAreaIDWithPagination(areaID string, o
 	return waterQuality, nil
 }
 
-func (r *GORMWaterQualityRepository) Create(waterQuality *domain.WaterQuality) error {
+// Create 记录归属于 scope 所在的组织
+func (r *GORMWaterQualityRepository) Create(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	waterQuality.OrgID = scope.OrgID
 	return r.db.Create(waterQuality).Error
 }
 
-func (r *GORMWaterQualityRepository) Update(waterQuality *domain.WaterQuality) error {
-	return r.db.Save(waterQuality).Error
+// Update 只更新属于 scope 所在组织的记录
+func (r *GORMWaterQualityRepository) Update(scope domain.TenantScope, waterQuality *domain.WaterQuality) error {
+	waterQuality.OrgID = scope.OrgID
+	return scoped(r.db, scope).Where("record_id = ?", waterQuality.RecordID).Select("*").Updates(waterQuality).Error
 }
 
-func (r *GORMWaterQualityRepository) Delete(recordID string) error {
-	return r.db.Where("record_id = ?", recordID).Delete(&domain.WaterQuality{}).Error
+func (r *GORMWaterQualityRepository) Delete(scope domain.TenantScope, recordID string) error {
+	return scoped(r.db, scope).Where("record_id = ?", recordID).Delete(&domain.WaterQuality{}).Error
 }
 
-func (r *GORMWaterQualityRepository) GetLatestByAreaID(areaID string) (*domain.WaterQuality, error) {
+func (r *GORMWaterQualityRepository) GetLatestByAreaID(scope domain.TenantScope, areaID string) (*domain.WaterQuality, error) {
 	var waterQuality domain.WaterQuality
-	err := r.db.Where("area_id = ? AND record_time IS NOT NULL", areaID).
+	err := scoped(r.db, scope).Where("area_id = ? AND record_time IS NOT NULL", areaID).
 		Order("record_time DESC").
 		First(&waterQuality).Error
 	if err != nil {
@@ -80,4 +90,13 @@ func (r *GORMWaterQualityRepository) GetLatestByAreaID(areaID string) (*domain.W
 		return nil, err
 	}
 	return &waterQuality, nil
-}
\ No newline at end of file
+}
+
+// FindByAreaIDBetween 区域在 [from, to) 内的水质记录，按记录时间排序
+func (r *GORMWaterQualityRepository) FindByAreaIDBetween(scope domain.TenantScope, areaID string, from, to time.Time) ([]*domain.WaterQuality, error) {
+	var waterQuality []*domain.WaterQuality
+	err := scoped(r.db, scope).Where("area_id = ? AND record_time >= ? AND record_time < ?", areaID, from, to).
+		Order("record_time").
+		Find(&waterQuality).Error
+	return waterQuality, err
+}
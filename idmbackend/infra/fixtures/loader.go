@@ -0,0 +1,292 @@
+package fixtures
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Profiles 支持的种子数据环境，每个环境对应 fixtures 目录下的一个子目录
+var Profiles = []string{"dev", "demo", "test"}
+
+// Kind 种子文件的数据类型
+type Kind string
+
+const (
+	KindOrganizations Kind = "organizations"
+	KindStations      Kind = "stations"
+	KindSpecies       Kind = "species"
+	KindUsers         Kind = "users"
+	KindWaterQuality  Kind = "water_quality"
+)
+
+// kindOrder 决定不同类型文件的加载顺序，组织需先于其他数据写入，站点需先于水质数据写入
+var kindOrder = map[Kind]int{
+	KindOrganizations: 0,
+	KindStations:      1,
+	KindSpecies:       2,
+	KindUsers:         3,
+	KindWaterQuality:  4,
+}
+
+// File 一个已解析的种子文件
+type File struct {
+	Name     string
+	Version  int
+	Kind     Kind
+	Checksum string
+	Items    []json.RawMessage
+}
+
+// Result 单个种子文件的加载结果
+type Result struct {
+	File      string `json:"file"`
+	Kind      Kind   `json:"kind"`
+	Version   int    `json:"version"`
+	Skipped   bool   `json:"skipped"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// fixtureVersion 记录每个环境下各种子文件已应用的版本
+type fixtureVersion struct {
+	ID        uint      `gorm:"column:id;primaryKey;autoIncrement"`
+	Profile   string    `gorm:"column:profile;type:varchar(16);not null;uniqueIndex:idx_fixture_file"`
+	File      string    `gorm:"column:file;type:varchar(128);not null;uniqueIndex:idx_fixture_file"`
+	Kind      string    `gorm:"column:kind;type:varchar(32);not null"`
+	Version   int       `gorm:"column:version;not null"`
+	Checksum  string    `gorm:"column:checksum;type:varchar(64);not null"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (fixtureVersion) TableName() string {
+	return "fixture_versions"
+}
+
+type Loader struct {
+	db     *gorm.DB
+	dir    string
+	policy *app.PasswordPolicy
+}
+
+// NewLoader policy 用于校验种子文件中新用户的密码，为空时不校验
+func NewLoader(db *gorm.DB, dir string, policy *app.PasswordPolicy) *Loader {
+	return &Loader{
+		db:     db,
+		dir:    dir,
+		policy: policy,
+	}
+}
+
+// Load 按顺序应用指定环境下的全部种子文件。
+// 已应用且版本和内容均未变化的文件会被跳过，force 为 true 时强制重新应用。
+// 每个文件在独立事务中按自然键写入，重复执行不会产生重复数据。
+func (l *Loader) Load(profile string, force bool) ([]Result, error) {
+	if !isKnownProfile(profile) {
+		return nil, fmt.Errorf("unknown fixture profile %q (expected one of %s)", profile, strings.Join(Profiles, ", "))
+	}
+	files, err := l.ReadProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.db.AutoMigrate(&fixtureVersion{}); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(files))
+	for _, file := range files {
+		result, err := l.apply(profile, file, force)
+		if err != nil {
+			return results, fmt.Errorf("%s/%s: %w", profile, file.Name, err)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// ReadProfile 读取并校验环境目录下的全部 .yaml/.yml/.json 文件，按加载顺序返回
+func (l *Loader) ReadProfile(profile string) ([]*File, error) {
+	dir := filepath.Join(l.dir, profile)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture directory: %w", err)
+	}
+
+	var files []*File
+	for _, entry := range entries {
+		if entry.IsDir() || !isFixtureFile(entry.Name()) {
+			continue
+		}
+		file, err := readFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", profile, entry.Name(), err)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no fixture files found in %s", dir)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if kindOrder[files[i].Kind] != kindOrder[files[j].Kind] {
+			return kindOrder[files[i].Kind] < kindOrder[files[j].Kind]
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+func (l *Loader) apply(profile string, file *File, force bool) (*Result, error) {
+	result := &Result{File: file.Name, Kind: file.Kind, Version: file.Version}
+
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		var applied fixtureVersion
+		err := tx.Where("profile = ? AND file = ?", profile, file.Name).First(&applied).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			applied = fixtureVersion{Profile: profile, File: file.Name}
+		case err != nil:
+			return err
+		case !force && applied.Version > file.Version:
+			return fmt.Errorf("version %d is older than applied version %d", file.Version, applied.Version)
+		case !force && applied.Version == file.Version && applied.Checksum != file.Checksum:
+			return fmt.Errorf("content changed but version is still %d; bump the version to re-apply", file.Version)
+		case !force && applied.Version == file.Version:
+			result.Skipped = true
+			return nil
+		}
+
+		if err := l.applyItems(tx, file, result, force); err != nil {
+			return err
+		}
+
+		applied.Kind = string(file.Kind)
+		applied.Version = file.Version
+		applied.Checksum = file.Checksum
+		applied.AppliedAt = time.Now()
+		return tx.Save(&applied).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (l *Loader) applyItems(tx *gorm.DB, file *File, result *Result, force bool) error {
+	var apply func(tx *gorm.DB, raw json.RawMessage) (outcome, error)
+	switch file.Kind {
+	case KindOrganizations:
+		apply = upsertOrganization
+	case KindStations:
+		apply = upsertStation
+	case KindSpecies:
+		apply = upsertSpecies
+	case KindUsers:
+		apply = func(tx *gorm.DB, raw json.RawMessage) (outcome, error) {
+			return upsertUser(tx, raw, l.policy, force)
+		}
+	case KindWaterQuality:
+		if !tx.Migrator().HasTable("water_quality") {
+			return errors.New("water_quality table does not exist; import the SQL schema first")
+		}
+		apply = upsertWaterQuality
+	}
+
+	for i, raw := range file.Items {
+		o, err := apply(tx, raw)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", i+1, err)
+		}
+		switch o {
+		case created:
+			result.Created++
+		case updated:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+	return nil
+}
+
+// fileHeader 种子文件的公共结构
+type fileHeader struct {
+	Version int    `yaml:"version" json:"version"`
+	Kind    Kind   `yaml:"kind" json:"kind"`
+	Items   []any  `yaml:"items" json:"items"`
+	Notes   string `yaml:"notes" json:"notes"`
+}
+
+// readFile 解析种子文件，条目统一转换为 JSON 以便按领域模型的 json 标签解码
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var header fileHeader
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&header)
+	} else {
+		err = yaml.Unmarshal(data, &header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	if header.Version < 1 {
+		return nil, errors.New("version must be a positive integer")
+	}
+	if _, ok := kindOrder[header.Kind]; !ok {
+		return nil, fmt.Errorf("unknown kind %q", header.Kind)
+	}
+
+	sum := sha256.Sum256(data)
+	file := &File{
+		Name:     filepath.Base(path),
+		Version:  header.Version,
+		Kind:     header.Kind,
+		Checksum: hex.EncodeToString(sum[:]),
+		Items:    make([]json.RawMessage, 0, len(header.Items)),
+	}
+	for i, item := range header.Items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i+1, err)
+		}
+		file.Items = append(file.Items, raw)
+	}
+	return file, nil
+}
+
+func isFixtureFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func isKnownProfile(profile string) bool {
+	for _, p := range Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFixture(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 仓库自带的各环境种子文件都必须能被解析
+func TestShippedProfilesAreReadable(t *testing.T) {
+	loader := NewLoader(nil, filepath.Join("..", "..", "fixtures"), nil)
+	for _, profile := range Profiles {
+		t.Run(profile, func(t *testing.T) {
+			files, err := loader.ReadProfile(profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				if len(file.Items) == 0 {
+					t.Errorf("%s has no items", file.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestReadProfileOrdersByKind(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "dev")
+	writeFixture(t, dir, "a_water.yaml", "version: 1\nkind: water_quality\nitems:\n  - record_id: 1\n")
+	writeFixture(t, dir, "b_users.json", `{"version": 1, "kind": "users", "items": [{"username": "demo"}]}`)
+	writeFixture(t, dir, "c_stations.yml", "version: 2\nkind: stations\nitems:\n  - name: 东湖\n")
+	writeFixture(t, dir, "z_orgs.yaml", "version: 1\nkind: organizations\nitems:\n  - slug: lab\n")
+	writeFixture(t, dir, "README.md", "not a fixture")
+
+	files, err := NewLoader(nil, root, nil).ReadProfile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, file := range files {
+		kinds = append(kinds, string(file.Kind))
+	}
+	if got := strings.Join(kinds, ","); got != "organizations,stations,users,water_quality" {
+		t.Fatalf("load order = %s", got)
+	}
+	if files[1].Version != 2 || string(files[1].Items[0]) != `{"name":"东湖"}` {
+		t.Errorf("stations file = version %d, item %s", files[1].Version, files[1].Items[0])
+	}
+}
+
+func TestReadFileValidatesHeader(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing version", "kind: species\nitems: []\n", "version must be a positive integer"},
+		{"unknown kind", "version: 1\nkind: fish\nitems: []\n", `unknown kind "fish"`},
+		{"invalid yaml", "version: [1\n", "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFixture(t, dir, "species.yaml", tt.content)
+			_, err := readFile(filepath.Join(dir, "species.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("readFile = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// 内容变化时校验和随之变化，加载器据此拒绝未升级版本号的修改
+func TestReadFileChecksumTracksContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "species.yaml")
+	writeFixture(t, dir, "species.yaml", "version: 1\nkind: species\nitems:\n  - species_name: 鲤鱼\n")
+	first, err := readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFixture(t, dir, "species.yaml", "version: 1\nkind: species\nitems:\n  - species_name: 草鱼\n")
+	second, err := readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Checksum == second.Checksum {
+		t.Error("checksum unchanged after editing the file")
+	}
+}
+
+func TestLoadRejectsUnknownProfile(t *testing.T) {
+	_, err := NewLoader(nil, t.TempDir(), nil).Load("prod", false)
+	if err == nil || !strings.Contains(err.Error(), "unknown fixture profile") {
+		t.Fatalf("Load = %v, want unknown profile error", err)
+	}
+}
@@ -0,0 +1,352 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"gorm.io/gorm"
+)
+
+type outcome int
+
+const (
+	unchanged outcome = iota
+	created
+	updated
+)
+
+// decodeItem 严格解码条目，未知字段视为错误以尽早发现拼写问题
+func decodeItem(raw json.RawMessage, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// takeOrg 取出条目中的 org 字段并解析为组织ID，未填写时归属默认组织。
+// 返回去掉 org 字段后的条目，以便继续按领域模型严格解码。
+func takeOrg(tx *gorm.DB, raw json.RawMessage) (uint, json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return 0, nil, err
+	}
+	slug := domain.DefaultOrgSlug
+	if value, ok := fields["org"]; ok {
+		if err := json.Unmarshal(value, &slug); err != nil {
+			return 0, nil, fmt.Errorf("org: %w", err)
+		}
+		delete(fields, "org")
+		var err error
+		if raw, err = json.Marshal(fields); err != nil {
+			return 0, nil, err
+		}
+	}
+	orgID, err := findOrgID(tx, slug)
+	return orgID, raw, err
+}
+
+// findOrgID 按 slug 查找组织，组织需在 organizations 种子文件中定义或已存在
+func findOrgID(tx *gorm.DB, slug string) (uint, error) {
+	var org domain.Organization
+	err := tx.Where("slug = ?", strings.TrimSpace(slug)).First(&org).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("unknown organization %q", slug)
+	}
+	return org.ID, err
+}
+
+// upsertOrganization 按 slug 写入组织
+func upsertOrganization(tx *gorm.DB, raw json.RawMessage) (outcome, error) {
+	var item struct {
+		Slug string         `json:"slug"`
+		Name string         `json:"name"`
+		Kind domain.OrgKind `json:"kind"`
+	}
+	if err := decodeItem(raw, &item); err != nil {
+		return unchanged, err
+	}
+	item.Slug = strings.TrimSpace(item.Slug)
+	if item.Slug == "" || strings.TrimSpace(item.Name) == "" {
+		return unchanged, errors.New("slug and name are required")
+	}
+	if item.Kind == "" {
+		item.Kind = domain.OrgCompany
+	}
+	if !item.Kind.IsValid() {
+		return unchanged, fmt.Errorf("unknown organization kind %q", item.Kind)
+	}
+
+	var existing domain.Organization
+	err := tx.Where("slug = ?", item.Slug).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return created, tx.Create(&domain.Organization{Slug: item.Slug, Name: item.Name, Kind: item.Kind}).Error
+	}
+	if err != nil {
+		return unchanged, err
+	}
+	if existing.Name == item.Name && existing.Kind == item.Kind {
+		return unchanged, nil
+	}
+	existing.Name = item.Name
+	existing.Kind = item.Kind
+	return updated, tx.Save(&existing).Error
+}
+
+// upsertStation 按 area_id 写入站点，未提供名称时从 "省份-流域-站点" 格式的 area_id 中解析
+func upsertStation(tx *gorm.DB, raw json.RawMessage) (outcome, error) {
+	orgID, raw, err := takeOrg(tx, raw)
+	if err != nil {
+		return unchanged, err
+	}
+	var station domain.Station
+	if err := decodeItem(raw, &station); err != nil {
+		return unchanged, err
+	}
+	station.OrgID = orgID
+	station.AreaID = strings.TrimSpace(station.AreaID)
+	if station.AreaID == "" {
+		return unchanged, errors.New("area_id is required")
+	}
+	if station.Name == "" {
+		station.Province, station.Basin, station.Name = domain.ParseStationLocation(station.AreaID)
+	}
+
+	var existing domain.Station
+	err = tx.Where("area_id = ?", station.AreaID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return created, tx.Create(&station).Error
+	}
+	if err != nil {
+		return unchanged, err
+	}
+	if reflect.DeepEqual(existing, station) {
+		return unchanged, nil
+	}
+	return updated, tx.Save(&station).Error
+}
+
+// upsertSpecies 按学名（不区分大小写）写入物种，并补充缺失的别名
+func upsertSpecies(tx *gorm.DB, raw json.RawMessage) (outcome, error) {
+	var species domain.Species
+	if err := decodeItem(raw, &species); err != nil {
+		return unchanged, err
+	}
+	species.ScientificName = strings.TrimSpace(species.ScientificName)
+	species.SpeciesName = strings.TrimSpace(species.SpeciesName)
+	if species.ScientificName == "" || species.SpeciesName == "" {
+		return unchanged, errors.New("species_name and scientific_name are required")
+	}
+	names := species.Names
+	species.Names = nil
+	species.ID = 0
+
+	var existing domain.Species
+	err := tx.Where("LOWER(scientific_name) = ?", strings.ToLower(species.ScientificName)).First(&existing).Error
+	result := updated
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := tx.Create(&species).Error; err != nil {
+			return unchanged, err
+		}
+		result = created
+	case err != nil:
+		return unchanged, err
+	default:
+		species.ID = existing.ID
+		if species.TaxonID == nil {
+			species.TaxonID = existing.TaxonID
+		}
+		if reflect.DeepEqual(existing, species) {
+			result = unchanged
+		} else if err := tx.Save(&species).Error; err != nil {
+			return unchanged, err
+		}
+	}
+
+	for _, name := range names {
+		name.Name = strings.TrimSpace(name.Name)
+		if name.Name == "" {
+			return unchanged, errors.New("species name entries require a name")
+		}
+		if name.Language == "" {
+			name.Language = "zh"
+		}
+		if name.Kind == "" {
+			name.Kind = domain.NameKindCommon
+		}
+
+		var count int64
+		if err := tx.Model(&domain.SpeciesName{}).
+			Where("species_id = ? AND name = ? AND language = ?", species.ID, name.Name, name.Language).
+			Count(&count).Error; err != nil {
+			return unchanged, err
+		}
+		if count > 0 {
+			continue
+		}
+		name.ID = 0
+		name.SpeciesID = species.ID
+		if err := tx.Create(&name).Error; err != nil {
+			return unchanged, err
+		}
+		if result == unchanged {
+			result = updated
+		}
+	}
+	return result, nil
+}
+
+// userFixture 用户种子条目，密码为明文，写入前进行哈希。Orgs 为加入的组织，未填写时加入默认组织
+type userFixture struct {
+	Username string      `json:"username"`
+	Password string      `json:"password"`
+	Role     domain.Role `json:"role"`
+	Orgs     []string    `json:"orgs"`
+}
+
+// upsertUser 按用户名写入用户，已有用户仅在角色与种子不一致时更新角色。
+// 密码只在创建用户时设置，避免覆盖用户修改过的密码；resetPassword 为 true（seed --force）时
+// 才把已有用户的密码重置为种子中的密码。
+// 用户以同一角色加入 Orgs 中尚未加入的组织，已有的成员身份保持不变。
+func upsertUser(tx *gorm.DB, raw json.RawMessage, policy *app.PasswordPolicy, resetPassword bool) (outcome, error) {
+	var item userFixture
+	if err := decodeItem(raw, &item); err != nil {
+		return unchanged, err
+	}
+	item.Username = strings.TrimSpace(item.Username)
+	if item.Username == "" || item.Password == "" {
+		return unchanged, errors.New("username and password are required")
+	}
+	if item.Role == "" {
+		item.Role = domain.RoleUser
+	}
+	if domain.FindBuiltInRole(item.Role) == nil {
+		var count int64
+		if err := tx.Model(&domain.RoleDefinition{}).Where("name = ?", item.Role).Count(&count).Error; err != nil {
+			return unchanged, err
+		}
+		if count == 0 {
+			return unchanged, fmt.Errorf("unknown role %q", item.Role)
+		}
+	}
+
+	if len(item.Orgs) == 0 {
+		item.Orgs = []string{domain.DefaultOrgSlug}
+	}
+
+	result := unchanged
+	var user domain.User
+	err := tx.Where("username = ?", item.Username).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := validatePassword(policy, item.Password, item.Username); err != nil {
+			return unchanged, err
+		}
+		user = domain.User{Username: item.Username, Role: item.Role}
+		if err := user.SetPassword(item.Password); err != nil {
+			return unchanged, err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return unchanged, err
+		}
+		result = created
+	case err != nil:
+		return unchanged, err
+	default:
+		resetting := resetPassword && user.ComparePassword(item.Password) != nil
+		if user.Role == item.Role && !resetting {
+			break
+		}
+		if user.Role != item.Role {
+			// 访问令牌中带有全局角色，角色变化后吊销用户已有的会话
+			err := tx.Model(&domain.Session{}).
+				Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", time.Now()).Error
+			if err != nil {
+				return unchanged, err
+			}
+		}
+		user.Role = item.Role
+		if resetting {
+			if err := validatePassword(policy, item.Password, item.Username); err != nil {
+				return unchanged, err
+			}
+			if err := user.SetPassword(item.Password); err != nil {
+				return unchanged, err
+			}
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return unchanged, err
+		}
+		result = updated
+	}
+
+	for _, slug := range item.Orgs {
+		orgID, err := findOrgID(tx, slug)
+		if err != nil {
+			return unchanged, err
+		}
+		var count int64
+		if err := tx.Model(&domain.Membership{}).Where("org_id = ? AND user_id = ?", orgID, user.ID).Count(&count).Error; err != nil {
+			return unchanged, err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Create(&domain.Membership{OrgID: orgID, UserID: user.ID, Role: item.Role}).Error; err != nil {
+			return unchanged, err
+		}
+		if result == unchanged {
+			result = updated
+		}
+	}
+	return result, nil
+}
+
+func validatePassword(policy *app.PasswordPolicy, password, username string) error {
+	if policy == nil {
+		return nil
+	}
+	return policy.Validate(password, username)
+}
+
+// upsertWaterQuality 按 record_id 写入水质样例数据
+func upsertWaterQuality(tx *gorm.DB, raw json.RawMessage) (outcome, error) {
+	orgID, raw, err := takeOrg(tx, raw)
+	if err != nil {
+		return unchanged, err
+	}
+	var record domain.WaterQuality
+	if err := decodeItem(raw, &record); err != nil {
+		return unchanged, err
+	}
+	record.OrgID = orgID
+	record.RecordID = strings.TrimSpace(record.RecordID)
+	if record.RecordID == "" || strings.TrimSpace(record.AreaID) == "" {
+		return unchanged, errors.New("record_id and area_id are required")
+	}
+
+	var existing domain.WaterQuality
+	err = tx.Where("record_id = ?", record.RecordID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return created, tx.Create(&record).Error
+	}
+	if err != nil {
+		return unchanged, err
+	}
+
+	// 数据库返回的时间带有本地时区，比较前统一为同一实例
+	if record.RecordTime != nil && existing.RecordTime != nil && record.RecordTime.Equal(*existing.RecordTime) {
+		record.RecordTime = existing.RecordTime
+	}
+	if reflect.DeepEqual(existing, record) {
+		return unchanged, nil
+	}
+	return updated, tx.Save(&record).Error
+}
@@ -0,0 +1,109 @@
+package imageproc
+
+import "image"
+
+const claheTiles = 8 // 每个方向划分的块数
+
+// CLAHE 限制对比度的自适应直方图均衡：在亮度通道上按块均衡，
+// 超过 clipLimit 倍平均值的直方图计数均匀分配到其他灰度，块之间双线性插值避免边界。
+// 只调整亮度，各像素按亮度变化等比例缩放 RGB 以保持色相
+func CLAHE(img *image.NRGBA, clipLimit float64) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+	if clipLimit < 1 {
+		clipLimit = 1
+	}
+
+	luma := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			p := row[x*4:]
+			luma[y*w+x] = clamp8(0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2]))
+		}
+	}
+
+	tilesX, tilesY := minInt(claheTiles, w), minInt(claheTiles, h)
+	tileW, tileH := float64(w)/float64(tilesX), float64(h)/float64(tilesY)
+	luts := make([][256]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, x1 := int(float64(tx)*tileW), int(float64(tx+1)*tileW)
+			y0, y1 := int(float64(ty)*tileH), int(float64(ty+1)*tileH)
+			luts[ty*tilesX+tx] = tileMapping(luma, w, x0, y0, x1, y1, clipLimit)
+		}
+	}
+
+	out := image.NewNRGBA(img.Rect)
+	for y := 0; y < h; y++ {
+		// 像素相对块中心的位置，决定参与插值的四个块及权重
+		fy := clampFloat((float64(y)+0.5)/tileH-0.5, 0, float64(tilesY-1))
+		ty0 := int(fy)
+		ty1 := minInt(ty0+1, tilesY-1)
+		wy := fy - float64(ty0)
+		for x := 0; x < w; x++ {
+			fx := clampFloat((float64(x)+0.5)/tileW-0.5, 0, float64(tilesX-1))
+			tx0 := int(fx)
+			tx1 := minInt(tx0+1, tilesX-1)
+			wx := fx - float64(tx0)
+
+			l := luma[y*w+x]
+			top := (1-wx)*float64(luts[ty0*tilesX+tx0][l]) + wx*float64(luts[ty0*tilesX+tx1][l])
+			bottom := (1-wx)*float64(luts[ty1*tilesX+tx0][l]) + wx*float64(luts[ty1*tilesX+tx1][l])
+			mapped := (1-wy)*top + wy*bottom
+
+			i := y*img.Stride + x*4
+			scale := (mapped + 1) / (float64(l) + 1)
+			out.Pix[i] = clamp8(float64(img.Pix[i]) * scale)
+			out.Pix[i+1] = clamp8(float64(img.Pix[i+1]) * scale)
+			out.Pix[i+2] = clamp8(float64(img.Pix[i+2]) * scale)
+			out.Pix[i+3] = img.Pix[i+3]
+		}
+	}
+	return out
+}
+
+// tileMapping 计算一个块的截断直方图均衡映射表
+func tileMapping(luma []uint8, stride, x0, y0, x1, y1 int, clipLimit float64) [256]uint8 {
+	var hist [256]float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			hist[luma[y*stride+x]]++
+		}
+	}
+	total := float64((x1 - x0) * (y1 - y0))
+
+	var lut [256]uint8
+	if total == 0 {
+		for v := range lut {
+			lut[v] = uint8(v)
+		}
+		return lut
+	}
+
+	limit := clipLimit * total / 256
+	var excess float64
+	for v := range hist {
+		if hist[v] > limit {
+			excess += hist[v] - limit
+			hist[v] = limit
+		}
+	}
+	bonus := excess / 256
+
+	var cdf float64
+	for v := range hist {
+		cdf += hist[v] + bonus
+		lut[v] = clamp8(cdf / total * 255)
+	}
+	return lut
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+package imageproc
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	saliencySize   = 128  // 计算显著性前缩小到的最长边
+	minSalientArea = 0.02 // 显著区域小于画面该比例时视为噪声，不裁剪
+	maxSalientArea = 0.9  // 显著区域接近整幅画面时不必裁剪
+	salientPadding = 0.1  // 裁剪框向外扩展的比例，保留鱼鳍和尾部
+	saliencyFactor = 2.0  // 显著性超过平均值该倍数的像素视为前景
+)
+
+// CropSalient 裁剪到最大的显著区域。显著性为模糊后每个像素与画面平均颜色的距离，
+// 超过平均显著性两倍的像素构成前景，取最大的四连通区域并适当外扩；找不到合适区域时原样返回
+func CropSalient(img *image.NRGBA) *image.NRGBA {
+	bounds, ok := salientBounds(img)
+	if !ok {
+		return img
+	}
+	return imaging.Crop(img, bounds)
+}
+
+func salientBounds(img *image.NRGBA) (image.Rectangle, bool) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w == 0 || h == 0 {
+		return image.Rectangle{}, false
+	}
+	small := imaging.Blur(imaging.Fit(img, saliencySize, saliencySize, imaging.Box), 1.5)
+	sw, sh := small.Rect.Dx(), small.Rect.Dy()
+
+	var mean [3]float64
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			mean[c] += float64(small.Pix[i+c])
+		}
+	}
+	for c := range mean {
+		mean[c] /= float64(sw * sh)
+	}
+
+	saliency := make([]float64, sw*sh)
+	var avg float64
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			p := small.Pix[y*small.Stride+x*4:]
+			dr, dg, db := float64(p[0])-mean[0], float64(p[1])-mean[1], float64(p[2])-mean[2]
+			s := math.Sqrt(dr*dr + dg*dg + db*db)
+			saliency[y*sw+x] = s
+			avg += s
+		}
+	}
+	avg /= float64(sw * sh)
+	if avg == 0 {
+		return image.Rectangle{}, false
+	}
+
+	threshold := avg * saliencyFactor
+	box, area := largestRegion(saliency, sw, sh, threshold)
+	total := float64(sw * sh)
+	if float64(area) < total*minSalientArea || float64(box.Dx()*box.Dy()) > total*maxSalientArea {
+		return image.Rectangle{}, false
+	}
+
+	// 映射回原图坐标并外扩
+	sx, sy := float64(w)/float64(sw), float64(h)/float64(sh)
+	padX, padY := float64(box.Dx())*sx*salientPadding, float64(box.Dy())*sy*salientPadding
+	rect := image.Rect(
+		int(float64(box.Min.X)*sx-padX), int(float64(box.Min.Y)*sy-padY),
+		int(math.Ceil(float64(box.Max.X)*sx+padX)), int(math.Ceil(float64(box.Max.Y)*sy+padY)),
+	).Add(img.Rect.Min).Intersect(img.Rect)
+	return rect, !rect.Empty()
+}
+
+// largestRegion 返回显著性超过阈值的最大四连通区域的外接矩形及像素数
+func largestRegion(saliency []float64, w, h int, threshold float64) (image.Rectangle, int) {
+	visited := make([]bool, len(saliency))
+	var best image.Rectangle
+	bestArea := 0
+	stack := make([]int, 0, 256)
+
+	for start := range saliency {
+		if visited[start] || saliency[start] < threshold {
+			continue
+		}
+		visited[start] = true
+		stack = append(stack[:0], start)
+		rect := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		area := 0
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			area++
+			x, y := idx%w, idx/w
+			rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			for _, n := range [4]int{idx - 1, idx + 1, idx - w, idx + w} {
+				if n < 0 || n >= len(saliency) || visited[n] || saliency[n] < threshold {
+					continue
+				}
+				if (n == idx-1 && x == 0) || (n == idx+1 && x == w-1) {
+					continue
+				}
+				visited[n] = true
+				stack = append(stack, n)
+			}
+		}
+		if area > bestArea {
+			best, bestArea = rect, area
+		}
+	}
+	return best, bestArea
+}
@@ -0,0 +1,159 @@
+package imageproc
+
+import (
+	"image"
+	"sort"
+)
+
+const (
+	dehazePatch      = 7    // 暗通道最小值滤波的半径
+	dehazeOmega      = 0.95 // 保留少量雾气，远处景物不至于失真
+	dehazeMinTrans   = 0.1  // 透射率下限，避免暗部噪声被放大
+	atmosphereSample = 0.001
+)
+
+// Dehaze 基于暗通道先验的去雾：无雾图像的局部区域总有某个颜色通道接近 0，
+// 据此估计大气光和透射率，按散射模型 I = J·t + A·(1-t) 还原 J。透射率经过均值平滑以减轻块效应
+func Dehaze(img *image.NRGBA) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+
+	minRGB := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := img.Pix[y*img.Stride+x*4:]
+			minRGB[y*w+x] = float64(minUint8(p[0], minUint8(p[1], p[2])))
+		}
+	}
+	dark := minFilter(minRGB, w, h, dehazePatch)
+	atmosphere := estimateAtmosphere(img, dark)
+
+	normalized := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := img.Pix[y*img.Stride+x*4:]
+			v := float64(p[0]) / atmosphere[0]
+			if g := float64(p[1]) / atmosphere[1]; g < v {
+				v = g
+			}
+			if b := float64(p[2]) / atmosphere[2]; b < v {
+				v = b
+			}
+			normalized[y*w+x] = v
+		}
+	}
+	trans := boxFilter(minFilter(normalized, w, h, dehazePatch), w, h, dehazePatch*2)
+
+	out := image.NewNRGBA(img.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t := 1 - dehazeOmega*trans[y*w+x]
+			if t < dehazeMinTrans {
+				t = dehazeMinTrans
+			}
+			i := y*img.Stride + x*4
+			for c := 0; c < 3; c++ {
+				out.Pix[i+c] = clamp8((float64(img.Pix[i+c])-atmosphere[c])/t + atmosphere[c])
+			}
+			out.Pix[i+3] = img.Pix[i+3]
+		}
+	}
+	return out
+}
+
+// estimateAtmosphere 取暗通道最亮的 0.1% 像素，以其颜色均值作为大气光
+func estimateAtmosphere(img *image.NRGBA, dark []float64) [3]float64 {
+	w := img.Rect.Dx()
+	indices := make([]int, len(dark))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Slice(indices, func(a, b int) bool { return dark[indices[a]] > dark[indices[b]] })
+	n := int(float64(len(dark)) * atmosphereSample)
+	if n < 1 {
+		n = 1
+	}
+
+	var atmosphere [3]float64
+	for _, idx := range indices[:n] {
+		p := img.Pix[(idx/w)*img.Stride+(idx%w)*4:]
+		for c := 0; c < 3; c++ {
+			atmosphere[c] += float64(p[c])
+		}
+	}
+	for c := range atmosphere {
+		atmosphere[c] /= float64(n)
+		if atmosphere[c] < 1 {
+			atmosphere[c] = 1
+		}
+	}
+	return atmosphere
+}
+
+// minFilter 半径为 r 的方形最小值滤波，先横向后纵向
+func minFilter(src []float64, w, h, r int) []float64 {
+	tmp := make([]float64, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := src[y*w+x]
+			for k := maxInt(0, x-r); k <= minInt(w-1, x+r); k++ {
+				if s := src[y*w+k]; s < v {
+					v = s
+				}
+			}
+			tmp[y*w+x] = v
+		}
+	}
+	out := make([]float64, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := tmp[y*w+x]
+			for k := maxInt(0, y-r); k <= minInt(h-1, y+r); k++ {
+				if s := tmp[k*w+x]; s < v {
+					v = s
+				}
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
+
+// boxFilter 半径为 r 的均值滤波，使用前缀和，边缘按实际覆盖的像素数取平均
+func boxFilter(src []float64, w, h, r int) []float64 {
+	integral := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row float64
+		for x := 0; x < w; x++ {
+			row += src[y*w+x]
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + row
+		}
+	}
+
+	out := make([]float64, len(src))
+	for y := 0; y < h; y++ {
+		y0, y1 := maxInt(0, y-r), minInt(h, y+r+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := maxInt(0, x-r), minInt(w, x+r+1)
+			sum := integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+			out[y*w+x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return out
+}
+
+func minUint8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
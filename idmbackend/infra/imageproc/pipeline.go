@@ -0,0 +1,139 @@
+// Package imageproc 水下照片预处理：颜色校正、对比度增强、去雾、显著区域裁剪和缩放
+package imageproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+// Step 预处理步骤名称
+type Step string
+
+const (
+	StepWhiteBalance Step = "white_balance"
+	StepCLAHE        Step = "clahe"
+	StepDehaze       Step = "dehaze"
+	StepCrop         Step = "crop"
+	StepResize       Step = "resize"
+)
+
+// stepOrder 各步骤的执行顺序。先校正颜色再增强对比度，去雾依赖校正后的颜色估计大气光，
+// 最后裁剪和缩放，保证显著性检测在完整画面上进行
+var stepOrder = []Step{StepWhiteBalance, StepCLAHE, StepDehaze, StepCrop, StepResize}
+
+const (
+	defaultClipLimit = 2.0
+	defaultMaxSize   = 1024
+	jpegQuality      = 92
+)
+
+// Config 预处理配置，零值字段使用默认值
+type Config struct {
+	DefaultSteps []Step  // 未指定步骤时执行的步骤，默认全部
+	ClipLimit    float64 // CLAHE 直方图截断倍数，默认 2
+	MaxSize      int     // 缩放后最长边的像素数，默认 1024
+}
+
+// Pipeline 可配置的预处理流水线
+type Pipeline struct {
+	cfg Config
+}
+
+func NewPipeline(cfg Config) *Pipeline {
+	if len(cfg.DefaultSteps) == 0 {
+		cfg.DefaultSteps = stepOrder
+	}
+	if cfg.ClipLimit <= 0 {
+		cfg.ClipLimit = defaultClipLimit
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultMaxSize
+	}
+	return &Pipeline{cfg: cfg}
+}
+
+// ParseSteps 解析逗号分隔的步骤列表，包含未知步骤时返回错误
+func ParseSteps(spec string) ([]Step, error) {
+	var steps []Step
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isStep(Step(name)) {
+			return nil, fmt.Errorf("unknown preprocessing step %q", name)
+		}
+		steps = append(steps, Step(name))
+	}
+	return steps, nil
+}
+
+// Process 按固定顺序执行选中的步骤，steps 为空时执行默认步骤。
+// 超大图片先缩小到最长边的两倍，控制去雾和 CLAHE 的计算量
+func (p *Pipeline) Process(img image.Image, steps []Step) *image.NRGBA {
+	if len(steps) == 0 {
+		steps = p.cfg.DefaultSteps
+	}
+	selected := map[Step]bool{}
+	for _, s := range steps {
+		selected[s] = true
+	}
+
+	out := imaging.Clone(img)
+	if limit := p.cfg.MaxSize * 2; out.Rect.Dx() > limit || out.Rect.Dy() > limit {
+		out = imaging.Fit(out, limit, limit, imaging.Lanczos)
+	}
+	for _, step := range stepOrder {
+		if !selected[step] {
+			continue
+		}
+		switch step {
+		case StepWhiteBalance:
+			out = WhiteBalance(out)
+		case StepCLAHE:
+			out = CLAHE(out, p.cfg.ClipLimit)
+		case StepDehaze:
+			out = Dehaze(out)
+		case StepCrop:
+			out = CropSalient(out)
+		case StepResize:
+			if out.Rect.Dx() > p.cfg.MaxSize || out.Rect.Dy() > p.cfg.MaxSize {
+				out = imaging.Fit(out, p.cfg.MaxSize, p.cfg.MaxSize, imaging.Lanczos)
+			}
+		}
+	}
+	return out
+}
+
+// Enhance 解码图片（按 EXIF 方向校正）并执行预处理，结果编码为 JPEG。
+// steps 为空时执行默认步骤，包含未知步骤时返回 domain.ErrInvalidInput
+func (p *Pipeline) Enhance(data []byte, steps []string) ([]byte, error) {
+	parsed, err := ParseSteps(strings.Join(steps, ","))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidInput, err.Error())
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, p.Process(img, parsed), imaging.JPEG, imaging.JPEGQuality(jpegQuality)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isStep(s Step) bool {
+	for _, step := range stepOrder {
+		if step == s {
+			return true
+		}
+	}
+	return false
+}
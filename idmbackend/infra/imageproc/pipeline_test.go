@@ -0,0 +1,159 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+// scene 明暗相间的测试画面，每个像素的 RGB 按 tint 缩放，模拟水下偏色
+func scene(w, h int, tint [3]float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 60 + float64((x/10+y/10)%4)*50
+			img.SetNRGBA(x, y, color.NRGBA{clamp8(v * tint[0]), clamp8(v * tint[1]), clamp8(v * tint[2]), 255})
+		}
+	}
+	return img
+}
+
+// stats 返回各通道均值和亮度标准差
+func stats(img *image.NRGBA) (mean [3]float64, lumaStd float64) {
+	var sum, sumSq float64
+	n := float64(len(img.Pix) / 4)
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			mean[c] += float64(img.Pix[i+c]) / n
+		}
+		l := 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+		sum += l
+		sumSq += l * l
+	}
+	return mean, math.Sqrt(sumSq/n - (sum/n)*(sum/n))
+}
+
+func spread(mean [3]float64) float64 {
+	return math.Max(mean[0], math.Max(mean[1], mean[2])) - math.Min(mean[0], math.Min(mean[1], mean[2]))
+}
+
+func TestParseSteps(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"white_balance, clahe", 2, false},
+		{"crop,,resize,", 2, false},
+		{"clahe,sharpen", 0, true},
+	}
+	for _, tt := range tests {
+		steps, err := ParseSteps(tt.spec)
+		if (err != nil) != tt.wantErr || len(steps) != tt.want {
+			t.Errorf("ParseSteps(%q) = %v, %v", tt.spec, steps, err)
+		}
+	}
+}
+
+func TestWhiteBalanceRemovesColorCast(t *testing.T) {
+	img := scene(80, 60, [3]float64{0.4, 0.9, 1})
+	before, _ := stats(img)
+	after, _ := stats(WhiteBalance(img))
+	if spread(after) > spread(before)/4 {
+		t.Errorf("channel means %v -> %v, want the cast mostly removed", before, after)
+	}
+}
+
+func TestCLAHEIncreasesContrast(t *testing.T) {
+	// 亮度集中在很窄范围内的低对比度画面
+	img := image.NewNRGBA(image.Rect(0, 0, 96, 96))
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 96; x++ {
+			v := uint8(110 + (x+y)%20)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	_, before := stats(img)
+	_, after := stats(CLAHE(img, 2))
+	if after < before*2 {
+		t.Errorf("luma std %v -> %v, want contrast stretched", before, after)
+	}
+}
+
+func TestDehazeIncreasesContrast(t *testing.T) {
+	// 按散射模型 I = J·t + A·(1-t) 在清晰画面上叠加灰白色的雾
+	img := scene(120, 90, [3]float64{1, 1, 1})
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = clamp8(float64(img.Pix[i+c])*0.4 + 220*0.6)
+		}
+	}
+	_, before := stats(img)
+	_, after := stats(Dehaze(img))
+	if after < before*1.5 {
+		t.Errorf("luma std %v -> %v, want haze removed", before, after)
+	}
+}
+
+func TestCropSalient(t *testing.T) {
+	img := imaging.New(200, 150, color.NRGBA{20, 60, 140, 255})
+	fish := image.Rect(120, 50, 160, 90)
+	for y := fish.Min.Y; y < fish.Max.Y; y++ {
+		for x := fish.Min.X; x < fish.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{240, 130, 30, 255})
+		}
+	}
+	cropped := CropSalient(img)
+	if w, h := cropped.Rect.Dx(), cropped.Rect.Dy(); w < fish.Dx() || h < fish.Dy() || w > 100 || h > 100 {
+		t.Errorf("cropped to %dx%d, want around the %dx%d object", w, h, fish.Dx(), fish.Dy())
+	}
+
+	// 没有显著区域的画面原样返回
+	plain := imaging.New(200, 150, color.NRGBA{20, 60, 140, 255})
+	if got := CropSalient(plain); got.Rect.Dx() != 200 || got.Rect.Dy() != 150 {
+		t.Errorf("plain image cropped to %v", got.Rect)
+	}
+}
+
+func TestProcessResizesToMaxSize(t *testing.T) {
+	img := scene(1200, 800, [3]float64{1, 1, 1})
+	out := NewPipeline(Config{MaxSize: 300}).Process(img, []Step{StepResize})
+	if out.Rect.Dx() != 300 || out.Rect.Dy() != 200 {
+		t.Errorf("resized to %v, want 300x200", out.Rect)
+	}
+	// 不选缩放时超大图片只缩小到最长边的两倍
+	out = NewPipeline(Config{MaxSize: 300}).Process(img, []Step{StepWhiteBalance})
+	if out.Rect.Dx() != 600 {
+		t.Errorf("processed to %v, want 600 wide", out.Rect)
+	}
+}
+
+func TestEnhance(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scene(80, 60, [3]float64{0.4, 0.9, 1})); err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewPipeline(Config{})
+
+	out, err := pipeline.Enhance(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) < 2 || out[0] != 0xFF || out[1] != 0xD8 {
+		t.Error("enhanced image is not a JPEG")
+	}
+	if _, err := pipeline.Enhance(buf.Bytes(), []string{"sharpen"}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("unknown step: err = %v, want ErrInvalidInput", err)
+	}
+	if _, err := pipeline.Enhance([]byte("not an image"), nil); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid image: err = %v, want ErrInvalidInput", err)
+	}
+}
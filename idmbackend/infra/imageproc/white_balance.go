@@ -0,0 +1,66 @@
+package imageproc
+
+import "image"
+
+// 灰度世界假设下单个通道增益的上下限，避免大面积单色画面被过度校正
+const (
+	minChannelGain = 0.5
+	maxChannelGain = 3.0
+)
+
+// WhiteBalance 灰度世界白平衡：假设画面平均颜色为中性灰，按各通道均值缩放。
+// 水下照片红色通道衰减严重，校正后偏蓝绿的色调会明显减轻
+func WhiteBalance(img *image.NRGBA) *image.NRGBA {
+	var sum [3]float64
+	var n float64
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		sum[0] += float64(img.Pix[i])
+		sum[1] += float64(img.Pix[i+1])
+		sum[2] += float64(img.Pix[i+2])
+		n++
+	}
+	if n == 0 {
+		return img
+	}
+	gray := (sum[0] + sum[1] + sum[2]) / 3 / n
+
+	var lut [3][256]uint8
+	for c := 0; c < 3; c++ {
+		gain := maxChannelGain
+		if sum[c] > 0 {
+			gain = clampFloat(gray/(sum[c]/n), minChannelGain, maxChannelGain)
+		}
+		for v := 0; v < 256; v++ {
+			lut[c][v] = clamp8(float64(v) * gain)
+		}
+	}
+
+	out := image.NewNRGBA(img.Rect)
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		out.Pix[i] = lut[0][img.Pix[i]]
+		out.Pix[i+1] = lut[1][img.Pix[i+1]]
+		out.Pix[i+2] = lut[2][img.Pix[i+2]]
+		out.Pix[i+3] = img.Pix[i+3]
+	}
+	return out
+}
+
+func clamp8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func clampFloat(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+)
+
+const (
+	defaultBaseURL = "https://api.deepseek.com"
+	defaultModel   = "deepseek-chat"
+
+	// maxRetryAfter 服务端要求的重试等待超过该时长时按该时长等待
+	maxRetryAfter = 30 * time.Second
+	// maxErrorBody 错误信息中最多保留的响应内容
+	maxErrorBody = 512
+)
+
+// OpenAIConfig OpenAI 兼容接口的配置，DeepSeek、通义千问、本地 vLLM/Ollama 等均可使用
+type OpenAIConfig struct {
+	BaseURL     string // 不含 /chat/completions，默认 DeepSeek
+	APIKey      string
+	Model       string        // 默认 deepseek-chat
+	Timeout     time.Duration // 单次请求的超时，默认 60s
+	MaxAttempts int           // 遇到 429、5xx 或网络错误时的最多尝试次数，默认 3
+	RetryDelay  time.Duration // 第 n 次重试前等待 2^(n-1) 倍的该时长，默认 1s
+	HTTPClient  *http.Client
+}
+
+type chatCompletionRequest struct {
+	Model       string           `json:"model"`
+	Messages    []app.LLMMessage `json:"messages"`
+	MaxTokens   int              `json:"max_tokens,omitempty"`
+	Temperature *float64         `json:"temperature,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage app.LLMUsage `json:"usage"`
+}
+
+// OpenAIProvider 调用 OpenAI 兼容的 /chat/completions 接口，限流和服务端错误时退避重试
+type OpenAIProvider struct {
+	cfg    OpenAIConfig
+	client *http.Client
+}
+
+func NewOpenAIProvider(cfg OpenAIConfig) (*OpenAIProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("openai provider requires api key")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Model == "" {
+		cfg.Model = defaultModel
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &OpenAIProvider{cfg: cfg, client: client}, nil
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req app.LLMRequest) (*app.LLMResponse, error) {
+	body, err := json.Marshal(chatCompletionRequest{
+		Model:       p.cfg.Model,
+		Messages:    req.Messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= p.cfg.MaxAttempts; attempt++ {
+		resp, wait, err := p.call(ctx, body)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if wait < 0 || attempt == p.cfg.MaxAttempts {
+			break
+		}
+		if wait == 0 {
+			wait = p.cfg.RetryDelay << (attempt - 1)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return nil, lastErr
+}
+
+// call 发送一次请求。失败时 wait 为下次重试前的等待时长：0 表示按退避策略等待，负数表示不应重试
+func (p *OpenAIProvider) call(ctx context.Context, body []byte) (*app.LLMResponse, time.Duration, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, ctx.Err()
+		}
+		return nil, 0, fmt.Errorf("%w: %v", domain.ErrLLMFailed, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		errorBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBody))
+		err := fmt.Errorf("%w: %s %s", domain.ErrLLMFailed, httpResp.Status, strings.TrimSpace(string(errorBody)))
+		if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode >= 500 {
+			return nil, retryAfter(httpResp.Header.Get("Retry-After")), err
+		}
+		return nil, -1, err
+	}
+
+	var result chatCompletionResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&result); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, -1, err
+		}
+		return nil, 0, fmt.Errorf("%w: invalid response: %v", domain.ErrLLMFailed, err)
+	}
+	if len(result.Choices) == 0 {
+		return nil, -1, fmt.Errorf("%w: no choices in response", domain.ErrLLMFailed)
+	}
+	model := result.Model
+	if model == "" {
+		model = p.cfg.Model
+	}
+	return &app.LLMResponse{
+		Content:      result.Choices[0].Message.Content,
+		Model:        model,
+		FinishReason: result.Choices[0].FinishReason,
+		Usage:        result.Usage,
+	}, 0, nil
+}
+
+// retryAfter 解析以秒为单位的 Retry-After 响应头，未提供或无法解析时返回 0
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
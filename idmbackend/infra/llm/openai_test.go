@@ -0,0 +1,239 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+)
+
+const okBody = `{"model":"deepseek-chat-0601","choices":[{"message":{"content":"鲤鱼属于鲤科"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":8,"total_tokens":20}}`
+
+// scriptedServer 依次返回预设的状态码，最后一个状态码重复使用
+type scriptedServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	headers  map[int]http.Header // 按请求序号附加的响应头
+	requests []*chatCompletionRequest
+	auth     []string
+	times    []time.Time
+}
+
+func newScriptedServer(t *testing.T, statuses ...int) *scriptedServer {
+	t.Helper()
+	s := &scriptedServer{statuses: statuses, headers: map[int]http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.requests)
+		var body chatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		s.requests = append(s.requests, &body)
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		s.times = append(s.times, time.Now())
+		status := s.statuses[min(n, len(s.statuses)-1)]
+		for k, v := range s.headers[n] {
+			w.Header()[k] = v
+		}
+		s.mu.Unlock()
+
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(okBody))
+		} else {
+			w.Write([]byte(`{"error":{"message":"busy"}}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scriptedServer) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newTestProvider(t *testing.T, server *scriptedServer) *OpenAIProvider {
+	t.Helper()
+	provider, err := NewOpenAIProvider(OpenAIConfig{
+		BaseURL:    server.URL + "/v1/",
+		APIKey:     "sk-test",
+		RetryDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+var testRequest = app.LLMRequest{Messages: []app.LLMMessage{{Role: "user", Content: "鲤鱼是什么科"}}, MaxTokens: 256}
+
+func TestOpenAIProviderRequiresAPIKey(t *testing.T) {
+	if _, err := NewOpenAIProvider(OpenAIConfig{}); err == nil {
+		t.Error("provider without api key was created")
+	}
+}
+
+func TestOpenAIProviderComplete(t *testing.T) {
+	server := newScriptedServer(t, http.StatusOK)
+	provider := newTestProvider(t, server)
+
+	resp, err := provider.Complete(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Content != "鲤鱼属于鲤科" || resp.Model != "deepseek-chat-0601" || resp.FinishReason != "stop" {
+		t.Errorf("response = %+v", resp)
+	}
+	if want := (app.LLMUsage{PromptTokens: 12, CompletionTokens: 8, TotalTokens: 20}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	sent := server.requests[0]
+	if sent.Model != defaultModel || sent.MaxTokens != 256 || len(sent.Messages) != 1 || sent.Messages[0].Content != "鲤鱼是什么科" {
+		t.Errorf("request = %+v", sent)
+	}
+	if server.auth[0] != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", server.auth[0])
+	}
+}
+
+func TestOpenAIProviderRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int
+		wantErr  bool
+	}{
+		{"rate limited then ok", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"server errors then ok", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, 3, false},
+		{"server errors exhaust attempts", []int{http.StatusInternalServerError}, 3, true},
+		{"bad request is not retried", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+		{"unauthorized is not retried", []int{http.StatusUnauthorized, http.StatusOK}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newScriptedServer(t, tt.statuses...)
+			_, err := newTestProvider(t, server).Complete(context.Background(), testRequest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, domain.ErrLLMFailed) {
+				t.Errorf("err = %v, want ErrLLMFailed", err)
+			}
+			if got := server.calls(); got != tt.calls {
+				t.Errorf("calls = %d, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderBackoff(t *testing.T) {
+	server := newScriptedServer(t, http.StatusServiceUnavailable)
+	newTestProvider(t, server).Complete(context.Background(), testRequest)
+
+	// 第 n 次重试前等待 2^(n-1) 倍的 RetryDelay
+	for i, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond} {
+		if gap := server.times[i+1].Sub(server.times[i]); gap < want {
+			t.Errorf("wait before retry %d = %s, want at least %s", i+1, gap, want)
+		}
+	}
+}
+
+func TestOpenAIProviderHonorsRetryAfter(t *testing.T) {
+	server := newScriptedServer(t, http.StatusTooManyRequests, http.StatusOK)
+	server.headers[0] = http.Header{"Retry-After": []string{"1"}}
+
+	if _, err := newTestProvider(t, server).Complete(context.Background(), testRequest); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if gap := server.times[1].Sub(server.times[0]); gap < time.Second {
+		t.Errorf("retried after %s, want at least the 1s from Retry-After", gap)
+	}
+}
+
+func TestOpenAIProviderStopsWhenContextEnds(t *testing.T) {
+	server := newScriptedServer(t, http.StatusTooManyRequests)
+	server.headers[0] = http.Header{"Retry-After": []string{"10"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newTestProvider(t, server).Complete(ctx, testRequest)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	if got := server.calls(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+		{"3600", maxRetryAfter},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestScriptedProvider(t *testing.T) {
+	failure := errors.New("quota exceeded")
+	provider := NewScriptedProvider(
+		ScriptStep{Reply: "第一次", Usage: app.LLMUsage{TotalTokens: 3}},
+		Fail(failure),
+		Reply("最后一步"),
+	)
+
+	tests := []struct {
+		reply string
+		err   error
+	}{
+		{"第一次", nil},
+		{"", failure},
+		{"最后一步", nil},
+		{"最后一步", nil}, // 脚本执行完后重复最后一步
+	}
+	for i, tt := range tests {
+		resp, err := provider.Complete(context.Background(), testRequest)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("call %d: err = %v, want %v", i, err, tt.err)
+		}
+		if err == nil && resp.Content != tt.reply {
+			t.Errorf("call %d: reply = %q, want %q", i, resp.Content, tt.reply)
+		}
+		if i == 0 && resp.Usage.TotalTokens != 3 {
+			t.Errorf("usage = %+v", resp.Usage)
+		}
+	}
+	if got := len(provider.Requests()); got != len(tests) {
+		t.Errorf("recorded %d requests, want %d", got, len(tests))
+	}
+
+	if _, err := NewScriptedProvider().Complete(context.Background(), testRequest); !errors.Is(err, domain.ErrLLMFailed) {
+		t.Errorf("empty script: err = %v, want ErrLLMFailed", err)
+	}
+}
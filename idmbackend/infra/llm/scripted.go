@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// ScriptStep 脚本中的一次调用结果，Err 不为空时返回该错误
+type ScriptStep struct {
+	Reply string
+	Usage app.LLMUsage
+	Err   error
+}
+
+// Reply 返回固定回答的脚本步骤
+func Reply(content string) ScriptStep {
+	return ScriptStep{Reply: content}
+}
+
+// Fail 返回错误的脚本步骤
+func Fail(err error) ScriptStep {
+	return ScriptStep{Err: err}
+}
+
+// ScriptedProvider 按预设脚本依次返回结果的大模型，不依赖外部服务，用于测试和离线演示。
+// 脚本执行完后重复最后一步；收到的请求都会记录下来，便于测试检查发送的消息
+type ScriptedProvider struct {
+	mu       sync.Mutex
+	steps    []ScriptStep
+	next     int
+	requests []app.LLMRequest
+}
+
+func NewScriptedProvider(steps ...ScriptStep) *ScriptedProvider {
+	return &ScriptedProvider{steps: steps}
+}
+
+func (p *ScriptedProvider) Complete(ctx context.Context, req app.LLMRequest) (*app.LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	if len(p.steps) == 0 {
+		return nil, fmt.Errorf("%w: empty script", domain.ErrLLMFailed)
+	}
+	step := p.steps[min(p.next, len(p.steps)-1)]
+	p.next++
+	if step.Err != nil {
+		return nil, step.Err
+	}
+	return &app.LLMResponse{Content: step.Reply, Model: "scripted", FinishReason: "stop", Usage: step.Usage}, nil
+}
+
+// Requests 目前为止收到的全部请求
+func (p *ScriptedProvider) Requests() []app.LLMRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]app.LLMRequest(nil), p.requests...)
+}
@@ -0,0 +1,198 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/MoyInGxing/idm/infra/oidc"
+	"github.com/MoyInGxing/idm/infra/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testVerifier  = "test-code-verifier-0123456789-abcdefghijklmnopqrstuvwxyz"
+	testChallenge = "AIRl9shPdxE8iTnvt5Wu4yLc0onNbESB8j4EHexHjAk"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	idp := oidctest.NewServer("idm", "secret")
+	t.Cleanup(idp.Close)
+	return idp, oidc.NewProvider(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://idm.test/callback",
+	})
+}
+
+func authorize(t *testing.T, idp *oidctest.Server, p *oidc.Provider, nonce, challenge string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return code
+}
+
+func TestExchange(t *testing.T) {
+	idp, p := newProvider(t)
+	idp.SetUser(map[string]interface{}{
+		"sub":    "alice-sub",
+		"email":  "alice@example.com",
+		"groups": "lab, fish-admins",
+	})
+	code := authorize(t, idp, p, "nonce-1", testChallenge)
+
+	identity, err := p.Exchange(context.Background(), code, testVerifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Issuer != idp.URL || identity.Subject != "alice-sub" {
+		t.Errorf("identity = %+v", identity)
+	}
+	// 没有 preferred_username 时取邮箱的本地部分
+	if identity.Username != "alice" {
+		t.Errorf("username = %q, want alice", identity.Username)
+	}
+	if len(identity.Groups) != 2 || identity.Groups[0] != "lab" || identity.Groups[1] != "fish-admins" {
+		t.Errorf("groups = %v", identity.Groups)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp, p := newProvider(t)
+	code := authorize(t, idp, p, "nonce-1", testChallenge)
+
+	_, err := p.Exchange(context.Background(), code, "another-verifier-0123456789-abcdefghijklmnopqrstuvwxyz", "nonce-1")
+	if !errors.Is(err, domain.ErrInvalidSSOToken) {
+		t.Errorf("err = %v, want ErrInvalidSSOToken", err)
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	idp, p := newProvider(t)
+	code := authorize(t, idp, p, "nonce-1", testChallenge)
+
+	_, err := p.Exchange(context.Background(), code, testVerifier, "nonce-2")
+	if !errors.Is(err, domain.ErrInvalidSSOToken) {
+		t.Errorf("err = %v, want ErrInvalidSSOToken", err)
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	idp, p := newProvider(t)
+	code := authorize(t, idp, p, "nonce-1", testChallenge)
+
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "nonce-1"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "nonce-1"); !errors.Is(err, domain.ErrInvalidSSOToken) {
+		t.Errorf("reused code: err = %v, want ErrInvalidSSOToken", err)
+	}
+}
+
+func TestAuthCodeURLRequiresPKCE(t *testing.T) {
+	idp, p := newProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if _, _, err := idp.Authorize(authURL); err == nil {
+		t.Error("authorization without code_challenge succeeded")
+	}
+
+	parsed, _ := url.Parse(authURL)
+	if got := parsed.Query().Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp, p := newProvider(t)
+	now := time.Now()
+	valid := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   idp.ClientID,
+		"sub":   "alice-sub",
+		"nonce": "nonce-1",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+		ok     bool
+	}{
+		{"valid", valid, "nonce-1", true},
+		{"nonce mismatch", valid, "nonce-2", false},
+		{"missing nonce", with("nonce", nil), "", false},
+		{"wrong issuer", with("iss", "https://evil.example.com"), "nonce-1", false},
+		{"wrong audience", with("aud", "other-client"), "nonce-1", false},
+		{"expired", with("exp", now.Add(-time.Hour).Unix()), "nonce-1", false},
+		{"missing sub", with("sub", nil), "nonce-1", false},
+		{"multiple audiences without azp", with("aud", []string{idp.ClientID, "other"}), "nonce-1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := idp.SignIDToken(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.VerifyIDToken(context.Background(), token, tt.nonce)
+			if tt.ok && err != nil {
+				t.Errorf("VerifyIDToken: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, domain.ErrInvalidSSOToken) {
+				t.Errorf("err = %v, want ErrInvalidSSOToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAfterKeyRotation(t *testing.T) {
+	idp, _ := newProvider(t)
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:              idp.URL,
+		ClientID:            idp.ClientID,
+		RedirectURL:         "http://idm.test/callback",
+		JWKSRefreshInterval: time.Nanosecond,
+	})
+	claims := jwt.MapClaims{
+		"iss": idp.URL, "aud": idp.ClientID, "sub": "alice-sub", "nonce": "n",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	}
+	token, _ := idp.SignIDToken(claims)
+	if _, err := p.VerifyIDToken(context.Background(), token, "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	// 新 kid 触发重新拉取 JWKS
+	idp.RotateKey()
+	rotated, _ := idp.SignIDToken(claims)
+	if _, err := p.VerifyIDToken(context.Background(), rotated, "n"); err != nil {
+		t.Errorf("VerifyIDToken after rotation: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package passwords 提供密码策略使用的泄露密码列表
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"io"
+	"os"
+	"strings"
+)
+
+//go:embed breached.txt
+var bundled []byte
+
+// LoadBreachedList 读取泄露密码列表，path 为空时使用内置列表。
+// 空行和以 # 开头的行会被忽略，密码统一转换为小写。
+func LoadBreachedList(path string) (map[string]struct{}, error) {
+	if path == "" {
+		return parse(bytes.NewReader(bundled))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+func parse(r io.Reader) (map[string]struct{}, error) {
+	list := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
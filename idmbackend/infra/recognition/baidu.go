@@ -0,0 +1,191 @@
+package recognition
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	defaultBaiduTokenURL = "https://aip.baidubce.com/oauth/2.0/token"
+	defaultBaiduEndpoint = "https://aip.baidubce.com/rest/2.0/image-classify/v1/animal"
+
+	// 百度开放平台访问令牌无效或过期的错误码
+	baiduInvalidToken = 110
+	baiduExpiredToken = 111
+)
+
+// BaiduConfig 百度动物识别接口配置
+type BaiduConfig struct {
+	APIKey     string
+	SecretKey  string
+	TokenURL   string // 默认使用百度开放平台地址，测试时可指向本地服务
+	Endpoint   string
+	TopNum     int // 返回的候选数量，默认 6
+	HTTPClient *http.Client
+}
+
+type baiduRecognitionResponse struct {
+	LogID  int64 `json:"log_id"`
+	Result []struct {
+		Name      string `json:"name"`
+		Score     string `json:"score"`
+		BaikeInfo struct {
+			BaikeURL    string `json:"baike_url"`
+			ImageURL    string `json:"image_url"`
+			Description string `json:"description"`
+		} `json:"baike_info"`
+	} `json:"result"`
+	ErrorCode int    `json:"error_code"`
+	ErrorMsg  string `json:"error_msg"`
+}
+
+// BaiduRecognizer 调用百度动物识别接口。访问令牌在有效期内复用，令牌失效时刷新后重试一次
+type BaiduRecognizer struct {
+	cfg    BaiduConfig
+	client *http.Client
+	tokens *TokenProvider
+}
+
+func NewBaiduRecognizer(cfg BaiduConfig) (*BaiduRecognizer, error) {
+	if cfg.APIKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("baidu recognizer requires api key and secret key")
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = defaultBaiduTokenURL
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultBaiduEndpoint
+	}
+	if cfg.TopNum <= 0 {
+		cfg.TopNum = 6
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	r := &BaiduRecognizer{cfg: cfg, client: client}
+	r.tokens = NewTokenProvider(r.fetchToken, nil)
+	return r, nil
+}
+
+// Recognize 将图片统一转为 JPEG 后提交识别
+func (r *BaiduRecognizer) Recognize(ctx context.Context, data []byte) ([]domain.RecognitionCandidate, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	result, err := r.call(ctx, encoded)
+	if err == nil && (result.ErrorCode == baiduInvalidToken || result.ErrorCode == baiduExpiredToken) {
+		r.tokens.Invalidate()
+		result, err = r.call(ctx, encoded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.ErrorCode != 0 {
+		return nil, fmt.Errorf("%w: %s (错误码: %d)", domain.ErrRecognitionFailed, result.ErrorMsg, result.ErrorCode)
+	}
+
+	candidates := make([]domain.RecognitionCandidate, 0, len(result.Result))
+	for _, item := range result.Result {
+		score, _ := strconv.ParseFloat(item.Score, 64)
+		candidates = append(candidates, domain.RecognitionCandidate{
+			Name:        item.Name,
+			Score:       score,
+			Description: item.BaikeInfo.Description,
+			BaikeURL:    item.BaikeInfo.BaikeURL,
+			ImageURL:    item.BaikeInfo.ImageURL,
+		})
+	}
+	return candidates, nil
+}
+
+func (r *BaiduRecognizer) call(ctx context.Context, encodedImage string) (*baiduRecognitionResponse, error) {
+	token, err := r.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("image", encodedImage)
+	form.Set("top_num", strconv.Itoa(r.cfg.TopNum))
+	form.Set("baike_num", "1")
+
+	endpoint := r.cfg.Endpoint + "?access_token=" + url.QueryEscape(token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result baiduRecognitionResponse
+	if err := r.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// fetchToken 使用 client_credentials 换取访问令牌
+func (r *BaiduRecognizer) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", r.cfg.APIKey)
+	form.Set("client_secret", r.cfg.SecretKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := r.doJSON(req, &resp); err != nil {
+		return "", 0, err
+	}
+	if resp.Error != "" || resp.AccessToken == "" {
+		return "", 0, fmt.Errorf("%w: 获取访问令牌失败: %s %s", domain.ErrRecognitionFailed, resp.Error, resp.ErrorDescription)
+	}
+	return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+}
+
+func (r *BaiduRecognizer) doJSON(req *http.Request, out interface{}) error {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrRecognitionFailed, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrRecognitionFailed, err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w: 无法解析响应 (HTTP %d)", domain.ErrRecognitionFailed, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package recognition
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	histBins    = 4  // 每个颜色通道的分桶数
+	hashSize    = 8  // 感知哈希取 DCT 低频的 8x8 系数
+	dctSize     = 32 // 计算 DCT 前缩放到的边长
+	hogSize     = 64 // 计算方向梯度直方图前缩放到的边长
+	hogCell     = 8  // 每个单元格的边长
+	hogBins     = 9  // 0~180 度的方向分桶数
+	hogCells    = hogSize / hogCell
+	hogFeatures = hogCells * hogCells * hogBins
+
+	// 各特征在综合相似度中的权重：形状（HOG）最能区分鱼类，颜色和整体结构作为补充
+	weightHOG  = 0.4
+	weightHist = 0.3
+	weightHash = 0.3
+)
+
+// descriptor 一张图片的感知特征
+type descriptor struct {
+	hist  [histBins * histBins * histBins]float64 // 归一化的 RGB 颜色直方图
+	phash uint64                                  // 基于 DCT 的感知哈希
+	hog   [hogFeatures]float64                    // L2 归一化的方向梯度直方图
+}
+
+// describe 计算图片的颜色直方图、感知哈希和方向梯度直方图
+func describe(img image.Image) *descriptor {
+	d := &descriptor{}
+	d.colorHistogram(imaging.Resize(img, 64, 64, imaging.Box))
+	gray := imaging.Grayscale(img)
+	d.perceptualHash(imaging.Resize(gray, dctSize, dctSize, imaging.Lanczos))
+	d.orientedGradients(imaging.Resize(gray, hogSize, hogSize, imaging.Linear))
+	return d
+}
+
+func (d *descriptor) colorHistogram(img *image.NRGBA) {
+	var total float64
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		if img.Pix[i+3] == 0 {
+			continue
+		}
+		r := int(img.Pix[i]) * histBins / 256
+		g := int(img.Pix[i+1]) * histBins / 256
+		b := int(img.Pix[i+2]) * histBins / 256
+		d.hist[(r*histBins+g)*histBins+b]++
+		total++
+	}
+	if total == 0 {
+		return
+	}
+	for i := range d.hist {
+		d.hist[i] /= total
+	}
+}
+
+// perceptualHash 对灰度图做二维 DCT，低频系数高于中位数的位置 1，不含直流分量
+func (d *descriptor) perceptualHash(img *image.NRGBA) {
+	var pixels [dctSize][dctSize]float64
+	for y := 0; y < dctSize; y++ {
+		for x := 0; x < dctSize; x++ {
+			pixels[y][x] = float64(img.Pix[y*img.Stride+x*4])
+		}
+	}
+
+	var coeffs [hashSize * hashSize]float64
+	for v := 0; v < hashSize; v++ {
+		for u := 0; u < hashSize; u++ {
+			var sum float64
+			for y := 0; y < dctSize; y++ {
+				cy := dctCos[v][y]
+				for x := 0; x < dctSize; x++ {
+					sum += pixels[y][x] * dctCos[u][x] * cy
+				}
+			}
+			coeffs[v*hashSize+u] = sum
+		}
+	}
+
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	for i := 1; i < len(coeffs); i++ {
+		if coeffs[i] > median {
+			d.phash |= 1 << uint(i)
+		}
+	}
+}
+
+// orientedGradients 按单元格统计梯度方向直方图，类似 HOG 但不做块重叠归一化
+func (d *descriptor) orientedGradients(img *image.NRGBA) {
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		} else if x >= hogSize {
+			x = hogSize - 1
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= hogSize {
+			y = hogSize - 1
+		}
+		return float64(img.Pix[y*img.Stride+x*4])
+	}
+
+	for y := 0; y < hogSize; y++ {
+		for x := 0; x < hogSize; x++ {
+			gx := at(x+1, y) - at(x-1, y)
+			gy := at(x, y+1) - at(x, y-1)
+			magnitude := math.Hypot(gx, gy)
+			if magnitude == 0 {
+				continue
+			}
+			angle := math.Atan2(gy, gx)
+			if angle < 0 {
+				angle += math.Pi
+			}
+			bin := int(angle / math.Pi * hogBins)
+			if bin >= hogBins {
+				bin = hogBins - 1
+			}
+			cell := (y/hogCell)*hogCells + x/hogCell
+			d.hog[cell*hogBins+bin] += magnitude
+		}
+	}
+
+	var norm float64
+	for _, v := range d.hog {
+		norm += v * v
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range d.hog {
+		d.hog[i] /= norm
+	}
+}
+
+// similarity 综合三种特征的相似度，取值 0~1
+func (d *descriptor) similarity(other *descriptor) float64 {
+	var hist float64
+	for i := range d.hist {
+		hist += math.Min(d.hist[i], other.hist[i])
+	}
+	hash := 1 - float64(bits.OnesCount64(d.phash^other.phash))/float64(hashSize*hashSize-1)
+	var hog float64
+	for i := range d.hog {
+		hog += d.hog[i] * other.hog[i]
+	}
+	return weightHOG*hog + weightHist*hist + weightHash*hash
+}
+
+// dctCos 预先计算的 DCT-II 余弦系数，dctCos[k][n] = cos((2n+1)kπ / 2N)
+var dctCos = func() [hashSize][dctSize]float64 {
+	var table [hashSize][dctSize]float64
+	for k := 0; k < hashSize; k++ {
+		for n := 0; n < dctSize; n++ {
+			table[k][n] = math.Cos(float64(2*n+1) * float64(k) * math.Pi / (2 * dctSize))
+		}
+	}
+	return table
+}()
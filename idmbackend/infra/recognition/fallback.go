@@ -0,0 +1,34 @@
+package recognition
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/MoyInGxing/idm/domain"
+)
+
+// Recognizer 与 app.Recognizer 相同，在本包内声明以免基础设施层依赖应用层
+type Recognizer interface {
+	Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error)
+}
+
+// FallbackRecognizer 优先调用在线识别，在线服务不可用时改用离线识别。
+// 图片无效等非服务故障的错误直接返回，不做降级
+type FallbackRecognizer struct {
+	primary  Recognizer
+	fallback Recognizer
+}
+
+func NewFallbackRecognizer(primary, fallback Recognizer) *FallbackRecognizer {
+	return &FallbackRecognizer{primary: primary, fallback: fallback}
+}
+
+func (r *FallbackRecognizer) Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+	candidates, err := r.primary.Recognize(ctx, image)
+	if err == nil || !errors.Is(err, domain.ErrRecognitionFailed) || ctx.Err() != nil {
+		return candidates, err
+	}
+	log.Printf("图像识别 - 在线识别不可用，改用离线识别: %v", err)
+	return r.fallback.Recognize(ctx, image)
+}
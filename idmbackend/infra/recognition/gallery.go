@@ -0,0 +1,179 @@
+package recognition
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+// GalleryImage 参考图库中一张已标注物种的图片
+type GalleryImage struct {
+	Label string
+	Data  []byte
+}
+
+// GalleryLoader 读取参考图库的全部图片
+type GalleryLoader func(ctx context.Context) ([]GalleryImage, error)
+
+// GalleryConfig 图库比对参数，零值字段使用默认值
+type GalleryConfig struct {
+	Refresh  time.Duration // 索引超过该时长后在后台重新加载，默认 1 小时
+	TopNum   int           // 返回的候选数量，默认 5
+	MinScore float64       // 最相似物种低于该相似度时视为未识别，默认 0.5
+}
+
+type galleryEntry struct {
+	label string
+	desc  *descriptor
+}
+
+// GalleryRecognizer 不依赖网络的图库比对识别：计算上传图片的感知特征，
+// 与参考图库逐一比较，按物种取最高相似度排序。参考图片同时以水平翻转后的特征入库，鱼头朝向不影响结果
+type GalleryRecognizer struct {
+	load GalleryLoader
+	cfg  GalleryConfig
+
+	mu       sync.RWMutex
+	entries  []galleryEntry
+	loadedAt time.Time
+
+	reloadMu  sync.Mutex
+	reloading bool
+}
+
+func NewGalleryRecognizer(load GalleryLoader, cfg GalleryConfig) *GalleryRecognizer {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = time.Hour
+	}
+	if cfg.TopNum <= 0 {
+		cfg.TopNum = 5
+	}
+	if cfg.MinScore <= 0 {
+		cfg.MinScore = 0.5
+	}
+	return &GalleryRecognizer{load: load, cfg: cfg}
+}
+
+// Reload 重新加载参考图库并重建索引，无法解码的图片跳过
+func (r *GalleryRecognizer) Reload(ctx context.Context) error {
+	images, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]galleryEntry, 0, len(images)*2)
+	for _, gi := range images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		img, _, err := image.Decode(bytes.NewReader(gi.Data))
+		if err != nil {
+			log.Printf("图库比对 - 跳过无法解码的参考图片（%s）: %v", gi.Label, err)
+			continue
+		}
+		entries = append(entries,
+			galleryEntry{label: gi.Label, desc: describe(img)},
+			galleryEntry{label: gi.Label, desc: describe(imaging.FlipH(img))},
+		)
+	}
+
+	r.mu.Lock()
+	r.entries = entries
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	log.Printf("图库比对 - 已加载 %d 张参考图片", len(entries)/2)
+	return nil
+}
+
+// Recognize 返回与上传图片最相似的物种。首次调用时同步加载图库，之后索引过期时在后台刷新
+func (r *GalleryRecognizer) Recognize(ctx context.Context, data []byte) ([]domain.RecognitionCandidate, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的图片格式", domain.ErrInvalidInput)
+	}
+	entries, err := r.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: 参考图库为空", domain.ErrRecognitionFailed)
+	}
+
+	query := describe(img)
+	best := map[string]float64{}
+	for _, e := range entries {
+		if score := query.similarity(e.desc); score > best[e.label] {
+			best[e.label] = score
+		}
+	}
+
+	candidates := make([]domain.RecognitionCandidate, 0, len(best))
+	for label, score := range best {
+		candidates = append(candidates, domain.RecognitionCandidate{
+			Name:        label,
+			Score:       score,
+			Description: "离线图库比对结果，相似度仅供参考。",
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	if candidates[0].Score < r.cfg.MinScore {
+		return nil, nil
+	}
+	if len(candidates) > r.cfg.TopNum {
+		candidates = candidates[:r.cfg.TopNum]
+	}
+	return candidates, nil
+}
+
+func (r *GalleryRecognizer) index(ctx context.Context) ([]galleryEntry, error) {
+	r.mu.RLock()
+	entries, loadedAt := r.entries, r.loadedAt
+	r.mu.RUnlock()
+
+	if loadedAt.IsZero() {
+		if err := r.Reload(ctx); err != nil {
+			return nil, fmt.Errorf("%w: 加载参考图库失败: %v", domain.ErrRecognitionFailed, err)
+		}
+		r.mu.RLock()
+		entries = r.entries
+		r.mu.RUnlock()
+	} else if time.Since(loadedAt) > r.cfg.Refresh {
+		r.reloadInBackground()
+	}
+	return entries, nil
+}
+
+// reloadInBackground 刷新过期的索引，刷新期间继续使用旧索引，同一时间只有一次刷新
+func (r *GalleryRecognizer) reloadInBackground() {
+	r.reloadMu.Lock()
+	if r.reloading {
+		r.reloadMu.Unlock()
+		return
+	}
+	r.reloading = true
+	r.reloadMu.Unlock()
+
+	go func() {
+		defer func() {
+			r.reloadMu.Lock()
+			r.reloading = false
+			r.reloadMu.Unlock()
+		}()
+		if err := r.Reload(context.Background()); err != nil {
+			log.Printf("图库比对 - 刷新参考图库失败: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,177 @@
+package recognition
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/disintegration/imaging"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fishImage 蓝色背景上头朝右的橙色鱼形
+func fishImage() *image.NRGBA {
+	img := imaging.New(128, 96, color.NRGBA{20, 60, 140, 255})
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			dx, dy := float64(x-70)/40, float64(y-48)/20
+			body := dx*dx+dy*dy <= 1
+			tail := x >= 10 && x < 32 && abs(y-48) <= (32-x)
+			if body || tail {
+				img.Set(x, y, color.NRGBA{240, 130, 30, 255})
+			}
+		}
+	}
+	return img
+}
+
+// stripeImage 绿黑相间的竖条纹
+func stripeImage() *image.NRGBA {
+	img := imaging.New(128, 96, color.NRGBA{0, 0, 0, 255})
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			if x/8%2 == 0 {
+				img.Set(x, y, color.NRGBA{40, 200, 60, 255})
+			}
+		}
+	}
+	return img
+}
+
+func noiseImage(seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := imaging.New(128, 96, color.NRGBA{})
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func newTestGallery(t *testing.T, cfg GalleryConfig) (*GalleryRecognizer, *int) {
+	loads := 0
+	images := []GalleryImage{
+		{Label: "鲤鱼", Data: encodePNG(t, fishImage())},
+		{Label: "草鱼", Data: encodePNG(t, stripeImage())},
+		{Label: "鲢鱼", Data: []byte("not an image")},
+	}
+	return NewGalleryRecognizer(func(ctx context.Context) ([]GalleryImage, error) {
+		loads++
+		return images, nil
+	}, cfg), &loads
+}
+
+func TestGalleryMatchesFlippedImage(t *testing.T) {
+	gallery, loads := newTestGallery(t, GalleryConfig{})
+	// 鱼头朝向相反的同一张图片仍然匹配到对应物种
+	query := encodePNG(t, imaging.FlipH(fishImage()))
+	candidates, err := gallery.Recognize(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].Name != "鲤鱼" || candidates[0].Score <= candidates[1].Score {
+		t.Fatalf("candidates = %+v, want 鲤鱼 first", candidates)
+	}
+	if candidates[0].Score < 0.99 {
+		t.Errorf("score of the flipped reference = %v, want about 1", candidates[0].Score)
+	}
+
+	if _, err := gallery.Recognize(context.Background(), encodePNG(t, stripeImage())); err != nil {
+		t.Fatal(err)
+	}
+	if *loads != 1 {
+		t.Errorf("gallery loaded %d times, want once", *loads)
+	}
+}
+
+func TestGalleryBelowMinScore(t *testing.T) {
+	gallery, _ := newTestGallery(t, GalleryConfig{MinScore: 0.95, TopNum: 1})
+	candidates, err := gallery.Recognize(context.Background(), encodePNG(t, noiseImage(1)))
+	if err != nil || candidates != nil {
+		t.Fatalf("noise image = %+v, %v, want no candidates", candidates, err)
+	}
+	candidates, err = gallery.Recognize(context.Background(), encodePNG(t, fishImage()))
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("reference image = %+v, %v, want one candidate", candidates, err)
+	}
+}
+
+func TestGalleryErrors(t *testing.T) {
+	gallery, _ := newTestGallery(t, GalleryConfig{})
+	if _, err := gallery.Recognize(context.Background(), []byte("not an image")); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("invalid image: err = %v, want ErrInvalidInput", err)
+	}
+
+	empty := NewGalleryRecognizer(func(ctx context.Context) ([]GalleryImage, error) { return nil, nil }, GalleryConfig{})
+	if _, err := empty.Recognize(context.Background(), encodePNG(t, fishImage())); !errors.Is(err, domain.ErrRecognitionFailed) {
+		t.Errorf("empty gallery: err = %v, want ErrRecognitionFailed", err)
+	}
+	broken := NewGalleryRecognizer(func(ctx context.Context) ([]GalleryImage, error) { return nil, errors.New("disk error") }, GalleryConfig{})
+	if _, err := broken.Recognize(context.Background(), encodePNG(t, fishImage())); !errors.Is(err, domain.ErrRecognitionFailed) {
+		t.Errorf("load failure: err = %v, want ErrRecognitionFailed", err)
+	}
+}
+
+type stubRecognizer struct {
+	candidates []domain.RecognitionCandidate
+	err        error
+	calls      int
+}
+
+func (r *stubRecognizer) Recognize(ctx context.Context, image []byte) ([]domain.RecognitionCandidate, error) {
+	r.calls++
+	return r.candidates, r.err
+}
+
+func TestFallbackRecognizer(t *testing.T) {
+	offline := []domain.RecognitionCandidate{{Name: "鲤鱼", Score: 0.7}}
+	tests := []struct {
+		name         string
+		primaryErr   error
+		wantFallback bool
+		wantErr      error
+	}{
+		{"online succeeds", nil, false, nil},
+		{"online unavailable", domain.ErrRecognitionFailed, true, nil},
+		{"invalid image is not retried offline", domain.ErrInvalidInput, false, domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &stubRecognizer{candidates: []domain.RecognitionCandidate{{Name: "草鱼", Score: 0.9}}, err: tt.primaryErr}
+			fallback := &stubRecognizer{candidates: offline}
+			candidates, err := NewFallbackRecognizer(primary, fallback).Recognize(context.Background(), nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if (fallback.calls == 1) != tt.wantFallback {
+				t.Errorf("fallback calls = %d, want fallback %v", fallback.calls, tt.wantFallback)
+			}
+			if tt.wantFallback && candidates[0].Name != "鲤鱼" {
+				t.Errorf("candidates = %+v, want offline result", candidates)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package recognition
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin 令牌到期前提前刷新的时间，避免请求途中过期
+const tokenRefreshMargin = 5 * time.Minute
+
+// FetchTokenFunc 获取新的访问令牌及其有效期
+type FetchTokenFunc func(ctx context.Context) (token string, expiresIn time.Duration, err error)
+
+// TokenProvider 缓存访问令牌，到期前自动刷新。并发请求共用同一次刷新
+type TokenProvider struct {
+	fetch FetchTokenFunc
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewTokenProvider now 为空时使用系统时间
+func NewTokenProvider(fetch FetchTokenFunc, now func() time.Time) *TokenProvider {
+	if now == nil {
+		now = time.Now
+	}
+	return &TokenProvider{fetch: fetch, now: now}
+}
+
+// Token 返回有效的访问令牌，缓存为空或即将过期时重新获取
+func (p *TokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && p.now().Add(tokenRefreshMargin).Before(p.expiresAt) {
+		return p.token, nil
+	}
+	token, expiresIn, err := p.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.token = token
+	p.expiresAt = p.now().Add(expiresIn)
+	return token, nil
+}
+
+// Invalidate 丢弃缓存的令牌，下次调用 Token 时重新获取
+func (p *TokenProvider) Invalidate() {
+	p.mu.Lock()
+	p.token = ""
+	p.mu.Unlock()
+}
@@ -3,27 +3,54 @@ package myrouter
 import (
 	"time"
 
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/MoyInGxing/idm/handler"
 	"github.com/MoyInGxing/idm/middleware"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// SetupRouter 注册全部路由。每个路由要么标注为公开，要么通过 require 声明所需权限；
+// 仅需登录、不需要特定权限的路由使用 authMiddleware。
+// 需要认证的路由同时接受 Bearer 访问令牌和 X-API-Key 请求头。
 func SetupRouter(
 	userHandler *handler.UserHandler,
+	passwordHandler *handler.PasswordHandler,
+	mfaHandler *handler.MFAHandler,
+	roleHandler *handler.RoleHandler,
+	orgHandler *handler.OrgHandler,
+	ssoHandler *handler.SSOHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	auditHandler *handler.AuditHandler,
 	speciesHandler *handler.SpeciesHandler,
 	waterQualityHandler *handler.WaterQualityHandler,
-	fishRecognitionHandler gin.HandlerFunc, // 新增鱼类识别处理函数
+	taxonomyHandler *handler.TaxonomyHandler,
+	speciesMediaHandler *handler.SpeciesMediaHandler,
+	observationHandler *handler.ObservationHandler,
+	fishRecognitionHandler *handler.FishRecognitionHandler,
+	recognitionJobHandler *handler.RecognitionJobHandler,
+	imageHandler *handler.ImageHandler,
+	videoHandler *handler.VideoHandler,
+	datasetHandler *handler.DatasetHandler,
+	behaviorHandler *handler.BehaviorHandler,
+	cameraHandler *handler.CameraHandler,
+	chatHandler *handler.ChatHandler,
 	authMiddleware *middleware.AuthMiddleware,
-	adminAuthMiddleware *middleware.AdminAuthMiddleware,
+	permissionMiddleware *middleware.PermissionMiddleware,
+	mfaMiddleware *middleware.MFAMiddleware,
+	orgMiddleware *middleware.OrgMiddleware,
+	auditMiddleware *middleware.AuditMiddleware,
 ) *gin.Engine {
 	r := gin.Default()
+	require := permissionMiddleware.RequirePermission
+	member := orgMiddleware.RequireMember
+	platformAdmin := permissionMiddleware.RequirePlatformAdmin()
 
 	// 配置 CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3001", "http://localhost:3000"}, // 允许前端开发地址
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-API-Key"},
 		ExposeHeaders:    []string{"X-Total-Count"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -37,64 +64,264 @@ func SetupRouter(
 	// API 路由组
 	api := r.Group("/api")
 	{
-		// 注册路由
+		// 公开: 注册、登录、刷新令牌与登出
 		api.POST("/register", userHandler.Register)
-		api.POST("/chat", handler.Chat)
-		// 登录路由
 		api.POST("/login", userHandler.Login)
+		api.POST("/login/mfa", mfaHandler.VerifyLogin)
+		api.POST("/token/refresh", userHandler.RefreshToken)
+		api.POST("/logout", userHandler.Logout)
+		// 公开: 忘记密码与使用重置令牌设置新密码
+		api.POST("/password/forgot", passwordHandler.ForgotPassword)
+		api.POST("/password/reset", passwordHandler.ResetPassword)
+		// 公开: OIDC 单点登录
+		api.GET("/sso/login", ssoHandler.Login)
+		api.GET("/sso/callback", ssoHandler.Callback)
+		// 登录用户: 登出所有设备
+		api.POST("/logout/all", authMiddleware.Handle(), userHandler.LogoutAll)
 
-		// 添加鱼类识别路由 - 不需要认证
-		api.POST("/fish-recognition", fishRecognitionHandler) // 使用传入的 handler
+		// 登录用户: 智能问答，调用按次计费的大模型，按用户限制提问次数
+		api.POST("/chat", authMiddleware.Handle(), chatHandler.Chat)
 
-		// 物种数据路由
+		// 鱼类识别，每次识别的图片和候选结果都会保存到当前组织的识别历史
+		api.POST("/fish-recognition", require(domain.PermRecognitionsWrite), fishRecognitionHandler.Recognize)
+		// 将确认后的识别结果保存为观测记录
+		api.POST("/fish-recognition/confirm", require(domain.PermObservationsWrite), observationHandler.ConfirmRecognition)
+
+		// 物种数据路由，查询公开
 		species := api.Group("/species")
 		{
 			species.GET("", speciesHandler.GetAllSpecies)
-			species.POST("", speciesHandler.CreateSpecies)
+			species.POST("", require(domain.PermSpeciesWrite), speciesHandler.CreateSpecies)
+			// 物种数据导入导出（CSV、XLSX、Darwin Core Archive）
+			species.POST("/import", require(domain.PermSpeciesAdmin), speciesHandler.ImportSpecies)
+			species.GET("/export", speciesHandler.ExportSpecies)
+			// 将俗名、异名或学名解析为规范物种
+			species.GET("/resolve", taxonomyHandler.ResolveSpecies)
+			species.PUT("/:id/taxon", require(domain.PermTaxonomyWrite), taxonomyHandler.LinkSpeciesTaxon)
+			species.GET("/:id/names", taxonomyHandler.GetSpeciesNames)
+			species.POST("/:id/names", require(domain.PermSpeciesWrite), taxonomyHandler.AddSpeciesName)
+			species.DELETE("/:id/names/:name_id", require(domain.PermSpeciesAdmin), taxonomyHandler.DeleteSpeciesName)
+			// 物种图库
+			species.GET("/:id/images", speciesMediaHandler.ListImages)
+			species.POST("/:id/images", require(domain.PermSpeciesWrite), speciesMediaHandler.UploadImage)
+			species.GET("/:id/images/:image_id", speciesMediaHandler.GetImageContent)
+			species.PUT("/:id/images/:image_id/primary", require(domain.PermSpeciesWrite), speciesMediaHandler.SetPrimaryImage)
+			species.DELETE("/:id/images/:image_id", require(domain.PermSpeciesAdmin), speciesMediaHandler.DeleteImage)
 		}
 
-		// 水质数据路由
+		// 分类学路由，查询公开
+		taxonomy := api.Group("/taxonomy")
+		{
+			taxonomy.POST("", require(domain.PermTaxonomyWrite), taxonomyHandler.CreateTaxon)
+			taxonomy.GET("/:id", taxonomyHandler.GetTaxon)
+			taxonomy.GET("/:id/children", taxonomyHandler.GetChildTaxa)
+		}
+
+		// 水质数据路由，按组织隔离，查询需要读取权限，限定区域的 API 密钥只能查询这些区域
 		waterQuality := api.Group("/water-quality")
+		waterQuality.Use(authMiddleware.Handle())
 		{
 			// 获取所有水质数据
-			waterQuality.GET("", waterQualityHandler.GetAllWaterQuality)
+			waterQuality.GET("", require(domain.PermWaterQualityRead), waterQualityHandler.GetAllWaterQuality)
 			// 根据记录ID获取水质数据
-			waterQuality.GET("/record/:record_id", waterQualityHandler.GetWaterQualityByRecordID)
+			waterQuality.GET("/record/:record_id", require(domain.PermWaterQualityRead), waterQualityHandler.GetWaterQualityByRecordID)
 			// 根据区域ID获取水质数据（支持分页）
-			waterQuality.GET("/area/:area_id", waterQualityHandler.GetWaterQualityByAreaID)
+			waterQuality.GET("/area/:area_id", require(domain.PermWaterQualityRead), waterQualityHandler.GetWaterQualityByAreaID)
 			// 获取指定区域的最新水质数据
-			waterQuality.GET("/area/:area_id/latest", waterQualityHandler.GetLatestWaterQualityByAreaID)
+			waterQuality.GET("/area/:area_id/latest", require(domain.PermWaterQualityRead), waterQualityHandler.GetLatestWaterQualityByAreaID)
 			// 根据区域ID获取温度和pH值数据
-			waterQuality.GET("/area/:area_id/temp-ph", waterQualityHandler.GetTemperatureAndPHByAreaID)
+			waterQuality.GET("/area/:area_id/temp-ph", require(domain.PermWaterQualityRead), waterQualityHandler.GetTemperatureAndPHByAreaID)
 			// 创建水质记录
-			waterQuality.POST("", waterQualityHandler.CreateWaterQuality)
+			waterQuality.POST("", require(domain.PermWaterQualityWrite), waterQualityHandler.CreateWaterQuality)
 			// 更新水质记录
-			waterQuality.PUT("/record/:record_id", waterQualityHandler.UpdateWaterQuality)
+			waterQuality.PUT("/record/:record_id", require(domain.PermWaterQualityWrite), waterQualityHandler.UpdateWaterQuality)
 			// 删除水质记录
-			waterQuality.DELETE("/record/:record_id", waterQualityHandler.DeleteWaterQuality)
+			waterQuality.DELETE("/record/:record_id", require(domain.PermWaterQualityWrite), waterQualityHandler.DeleteWaterQuality)
+		}
+
+		// 野外观测记录路由，按组织隔离。
+		// 以下组织数据的查询都需要对应的读取权限，限定区域的 API 密钥只能查询这些区域
+		observations := api.Group("/observations")
+		observations.Use(authMiddleware.Handle())
+		{
+			observations.GET("", require(domain.PermObservationsRead), observationHandler.ListObservations)
+			observations.GET("/diversity", require(domain.PermObservationsRead), observationHandler.GetDiversity)
+			observations.GET("/:id", require(domain.PermObservationsRead), observationHandler.GetObservation)
+			observations.GET("/:id/photo", require(domain.PermObservationsRead), observationHandler.GetPhoto)
+			observations.POST("", require(domain.PermObservationsWrite), observationHandler.CreateObservation)
+			observations.PUT("/:id", require(domain.PermObservationsWrite), observationHandler.UpdateObservation)
+			observations.DELETE("/:id", require(domain.PermObservationsWrite), observationHandler.DeleteObservation)
+			observations.POST("/:id/photo", require(domain.PermObservationsWrite), observationHandler.UploadPhoto)
+		}
+
+		// 识别历史、用户反馈和专家审核，按组织隔离
+		recognitions := api.Group("/recognitions")
+		recognitions.Use(authMiddleware.Handle())
+		{
+			recognitions.GET("", require(domain.PermRecognitionsRead), fishRecognitionHandler.ListRecognitions)
+			recognitions.GET("/review", require(domain.PermRecognitionReview), fishRecognitionHandler.ReviewQueue)
+			recognitions.GET("/dataset", require(domain.PermRecognitionReview), fishRecognitionHandler.ExportDataset)
+			recognitions.GET("/:id", require(domain.PermRecognitionsRead), fishRecognitionHandler.GetRecognition)
+			recognitions.GET("/:id/image", require(domain.PermRecognitionsRead), fishRecognitionHandler.GetImage)
+			recognitions.PUT("/:id/label", require(domain.PermRecognitionsWrite), fishRecognitionHandler.SubmitFeedback)
+			recognitions.POST("/:id/review", require(domain.PermRecognitionReview), fishRecognitionHandler.Review)
+		}
+
+		// 水下照片预处理，便于比较预处理前后的识别效果
+		api.POST("/images/enhance", require(domain.PermRecognitionsWrite), imageHandler.Enhance)
+
+		// 批量识别任务，上传后在后台异步处理
+		recognitionJobs := api.Group("/recognition-jobs")
+		recognitionJobs.Use(authMiddleware.Handle())
+		{
+			recognitionJobs.POST("", require(domain.PermRecognitionsWrite), recognitionJobHandler.CreateJob)
+			recognitionJobs.GET("", require(domain.PermRecognitionsRead), recognitionJobHandler.ListJobs)
+			recognitionJobs.GET("/:id", require(domain.PermRecognitionsRead), recognitionJobHandler.GetJob)
+			recognitionJobs.GET("/:id/results", require(domain.PermRecognitionsRead), recognitionJobHandler.GetResults)
+			recognitionJobs.GET("/:id/summary.csv", require(domain.PermRecognitionsRead), recognitionJobHandler.ExportSummary)
+		}
+
+		// 水下视频数据集与时间轴标注，按组织隔离
+		videos := api.Group("/videos")
+		videos.Use(authMiddleware.Handle())
+		{
+			videos.GET("", require(domain.PermVideosRead), videoHandler.ListVideos)
+			videos.POST("", require(domain.PermVideosWrite), videoHandler.CreateVideo)
+			videos.GET("/:id", require(domain.PermVideosRead), videoHandler.GetVideo)
+			videos.PUT("/:id", require(domain.PermVideosWrite), videoHandler.UpdateVideo)
+			videos.DELETE("/:id", require(domain.PermVideosWrite), videoHandler.DeleteVideo)
+			videos.GET("/:id/content", require(domain.PermVideosRead), videoHandler.GetContent)
+			videos.GET("/:id/annotations", require(domain.PermVideosRead), videoHandler.ListAnnotations)
+			videos.POST("/:id/annotations", require(domain.PermVideosWrite), videoHandler.CreateAnnotations)
+			videos.PUT("/:id/annotations/:annotationId", require(domain.PermVideosWrite), videoHandler.UpdateAnnotation)
+			videos.DELETE("/:id/annotations/:annotationId", require(domain.PermVideosWrite), videoHandler.DeleteAnnotation)
+			videos.GET("/:id/fish-counts", require(domain.PermVideosRead), videoHandler.FishCountSeries)
+		}
+
+		// 目标检测数据集：帧级标注框、类别映射、数据集划分及 COCO/YOLO/VOC 导入导出
+		datasets := api.Group("/datasets")
+		datasets.Use(authMiddleware.Handle())
+		{
+			datasets.GET("", require(domain.PermDatasetsRead), datasetHandler.ListDatasets)
+			datasets.POST("", require(domain.PermDatasetsWrite), datasetHandler.CreateDataset)
+			datasets.GET("/:id", require(domain.PermDatasetsRead), datasetHandler.GetDataset)
+			datasets.PUT("/:id", require(domain.PermDatasetsWrite), datasetHandler.UpdateDataset)
+			datasets.DELETE("/:id", require(domain.PermDatasetsWrite), datasetHandler.DeleteDataset)
+			datasets.GET("/:id/categories", require(domain.PermDatasetsRead), datasetHandler.ListCategories)
+			datasets.PUT("/:id/categories/:categoryId", require(domain.PermDatasetsWrite), datasetHandler.MapCategory)
+			datasets.GET("/:id/frames", require(domain.PermDatasetsRead), datasetHandler.ListFrames)
+			datasets.POST("/:id/frames", require(domain.PermDatasetsWrite), datasetHandler.CreateFrame)
+			datasets.POST("/:id/video-frames", require(domain.PermDatasetsWrite), datasetHandler.AddVideoFrames)
+			datasets.GET("/:id/frames/:frameId", require(domain.PermDatasetsRead), datasetHandler.GetFrame)
+			datasets.GET("/:id/frames/:frameId/image", require(domain.PermDatasetsRead), datasetHandler.GetFrameImage)
+			datasets.PUT("/:id/frames/:frameId", require(domain.PermDatasetsWrite), datasetHandler.UpdateFrame)
+			datasets.DELETE("/:id/frames/:frameId", require(domain.PermDatasetsWrite), datasetHandler.DeleteFrame)
+			datasets.POST("/:id/split", require(domain.PermDatasetsWrite), datasetHandler.AssignSplits)
+			datasets.POST("/:id/import", require(domain.PermDatasetsWrite), datasetHandler.Import)
+			datasets.GET("/:id/export", require(domain.PermDatasetsRead), datasetHandler.Export)
+		}
+
+		// 鱼类行为事件及其与水质的关联分析
+		behaviors := api.Group("/behaviors")
+		behaviors.Use(authMiddleware.Handle())
+		{
+			behaviors.GET("", require(domain.PermBehaviorsRead), behaviorHandler.ListEvents)
+			behaviors.POST("", require(domain.PermBehaviorsWrite), behaviorHandler.IngestEvents)
+			behaviors.GET("/summary", require(domain.PermBehaviorsRead), behaviorHandler.Summary)
+			behaviors.GET("/correlation", require(domain.PermBehaviorsRead), behaviorHandler.Correlation)
+		}
+
+		alerts := api.Group("/alerts")
+		alerts.Use(authMiddleware.Handle())
+		{
+			alerts.GET("", require(domain.PermAlertsRead), behaviorHandler.ListAlerts)
+			alerts.GET("/:id", require(domain.PermAlertsRead), behaviorHandler.GetAlert)
+			alerts.POST("/:id/ack", require(domain.PermAlertsAck), behaviorHandler.AcknowledgeAlert)
+		}
+
+		// 监测摄像头及其定时快照
+		cameras := api.Group("/cameras")
+		cameras.Use(authMiddleware.Handle())
+		{
+			cameras.GET("", require(domain.PermCamerasRead), cameraHandler.ListCameras)
+			cameras.POST("", require(domain.PermDevicesManage), cameraHandler.CreateCamera)
+			cameras.GET("/:id", require(domain.PermCamerasRead), cameraHandler.GetCamera)
+			cameras.PUT("/:id", require(domain.PermDevicesManage), cameraHandler.UpdateCamera)
+			cameras.DELETE("/:id", require(domain.PermDevicesManage), cameraHandler.DeleteCamera)
+			cameras.GET("/:id/snapshots", require(domain.PermCamerasRead), cameraHandler.ListSnapshots)
+			cameras.POST("/:id/snapshots", require(domain.PermSnapshotsWrite), cameraHandler.PushSnapshot)
+			cameras.GET("/:id/snapshots/latest", require(domain.PermCamerasRead), cameraHandler.LatestSnapshot)
+			cameras.GET("/:id/snapshots/:snapshotId/image", require(domain.PermCamerasRead), cameraHandler.GetSnapshotImage)
 		}
 
 		// 数据库路由
 		database := api.Group("/database")
 		{
-			database.GET("/schema", speciesHandler.ExportDatabaseSchema)
+			database.GET("/schema", require(domain.PermDatabaseSchema), speciesHandler.ExportDatabaseSchema)
 		}
 
-		// 需要认证的路由
+		// 登录用户: 个人信息与权限
 		authorized := api.Group("/users")
 		authorized.Use(authMiddleware.Handle())
 		{
 			authorized.GET("/profile", userHandler.GetProfile)
+			authorized.PUT("/profile", userHandler.UpdateProfile)
+			authorized.PUT("/profile/avatar", userHandler.UploadAvatar)
+			authorized.GET("/:id/avatar", userHandler.GetAvatar)
+			authorized.GET("/permissions", roleHandler.GetMyPermissions)
+			authorized.PUT("/password", passwordHandler.ChangePassword)
+			// 两步验证绑定与恢复码
+			authorized.GET("/mfa", mfaHandler.GetStatus)
+			authorized.POST("/mfa/totp", mfaHandler.BeginEnrollment)
+			authorized.POST("/mfa/totp/confirm", mfaHandler.ConfirmEnrollment)
+			authorized.DELETE("/mfa/totp", mfaHandler.Disable)
+			authorized.POST("/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		}
+
+		// 登录用户: 查看可进入的组织并切换当前组织
+		orgs := api.Group("/orgs")
+		orgs.Use(authMiddleware.Handle())
+		{
+			orgs.GET("", orgHandler.ListOrganizations)
+			orgs.POST("/switch", orgHandler.SwitchOrganization)
 		}
 
-		// 需要管理员权限的路由
+		// 管理路由，策略要求的角色必须使用通过两步验证的会话。
+		// 用户管理作用于当前组织，:id 指定的用户必须是本组织成员（平台管理员除外），
+		// 将已有用户加入组织和管理全局角色仅平台管理员可用。
+		// 修改操作和被拒绝的请求都会写入审计日志
 		admin := api.Group("/admin")
-		admin.Use(authMiddleware.Handle(), adminAuthMiddleware.Handle())
+		admin.Use(auditMiddleware.Handle(), authMiddleware.Handle(), mfaMiddleware.Handle())
 		{
-			admin.GET("/dashboard", userHandler.GetAdminDashboard)
-			admin.GET("/users", userHandler.GetAllUsers)
-			admin.DELETE("/users/:id", userHandler.DeleteUser)
-			admin.PUT("/users/:id/role", userHandler.UpdateUserRole)
+			admin.GET("/dashboard", require(domain.PermDashboardView), userHandler.GetAdminDashboard)
+			admin.GET("/users", require(domain.PermUsersManage), userHandler.GetAllUsers)
+			admin.GET("/users/:id", require(domain.PermUsersManage), userHandler.GetUser)
+			admin.POST("/users/:id/disable", require(domain.PermUsersManage), member("id"), userHandler.DisableUser)
+			admin.POST("/users/:id/enable", require(domain.PermUsersManage), member("id"), userHandler.EnableUser)
+			admin.PUT("/users/:id/role", require(domain.PermUsersManage), member("id"), orgHandler.SetMemberRole)
+			admin.PUT("/users/:id/platform-role", platformAdmin, roleHandler.AssignUserRole)
+			admin.POST("/users/:id/membership", platformAdmin, orgHandler.AddMember)
+			admin.DELETE("/users/:id/membership", require(domain.PermUsersManage), member("id"), orgHandler.RemoveMember)
+			admin.POST("/users/:id/password-reset", require(domain.PermUsersManage), member("id"), passwordHandler.AdminResetPassword)
+			admin.POST("/users/:id/unlock", require(domain.PermUsersManage), member("id"), userHandler.UnlockUser)
+			admin.DELETE("/users/:id/mfa", require(domain.PermUsersManage), member("id"), mfaHandler.AdminReset)
+
+			admin.POST("/orgs", platformAdmin, orgHandler.CreateOrganization)
+
+			admin.GET("/permissions", require(domain.PermRolesManage), roleHandler.ListPermissions)
+			admin.GET("/roles", require(domain.PermRolesManage), roleHandler.ListRoles)
+			admin.POST("/roles", platformAdmin, roleHandler.CreateRole)
+			admin.PUT("/roles/:name", platformAdmin, roleHandler.UpdateRole)
+			admin.DELETE("/roles/:name", platformAdmin, roleHandler.DeleteRole)
+
+			admin.GET("/api-keys", require(domain.PermAPIKeysManage), apiKeyHandler.ListKeys)
+			admin.POST("/api-keys", require(domain.PermAPIKeysManage), apiKeyHandler.CreateKey)
+			admin.GET("/api-keys/:id", require(domain.PermAPIKeysManage), apiKeyHandler.GetKey)
+			admin.DELETE("/api-keys/:id", require(domain.PermAPIKeysManage), apiKeyHandler.RevokeKey)
+
+			admin.GET("/audit", require(domain.PermAuditView), auditHandler.ListEntries)
+			admin.GET("/audit/export", require(domain.PermAuditView), auditHandler.ExportEntries)
+			admin.GET("/audit/verify", platformAdmin, auditHandler.VerifyChain)
 		}
 	}
 
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/MoyInGxing/idm/app"
 	"github.com/MoyInGxing/idm/config"
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/MoyInGxing/idm/handler"
 	"github.com/MoyInGxing/idm/infra/database"
+	"github.com/MoyInGxing/idm/infra/imageproc"
+	"github.com/MoyInGxing/idm/infra/llm"
+	"github.com/MoyInGxing/idm/infra/notify"
+	"github.com/MoyInGxing/idm/infra/oidc"
+	"github.com/MoyInGxing/idm/infra/passwords"
+	"github.com/MoyInGxing/idm/infra/recognition"
+	"github.com/MoyInGxing/idm/infra/storage"
 	"github.com/MoyInGxing/idm/internal/myrouter"
 	"github.com/MoyInGxing/idm/middleware"
 )
@@ -23,24 +34,152 @@ func main() {
 	}
 	db := database.GetDB()
 
+	if err := database.AutoMigrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// 子命令: idm seed --profile dev
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		if err := runSeed(db, cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Failed to load fixtures: %v", err)
+		}
+		return
+	}
+
 	userRepo := database.NewGORMUserRepository(db)
 	sessionRepo := database.NewGORMSessionRepository(db)
 	speciesRepo := database.NewGORMSpeciesRepository(db)
 	waterQualityRepo := database.NewGORMWaterQualityRepository(db)
+	taxonomyRepo := database.NewGORMTaxonomyRepository(db)
+	speciesImageRepo := database.NewGORMSpeciesImageRepository(db)
+	observationRepo := database.NewGORMObservationRepository(db)
+	roleRepo := database.NewGORMRoleRepository(db)
+	identityRepo := database.NewGORMIdentityRepository(db)
+	apiKeyRepo := database.NewGORMAPIKeyRepository(db)
+	passwordResetRepo := database.NewGORMPasswordResetRepository(db)
+	loginThrottleRepo := database.NewGORMLoginThrottleRepository(db)
+	mfaRepo := database.NewGORMMFARepository(db)
+	orgRepo := database.NewGORMOrganizationRepository(db)
+	auditRepo := database.NewGORMAuditRepository(db)
+	recognitionRepo := database.NewGORMRecognitionRepository(db)
+	recognitionJobRepo := database.NewGORMRecognitionJobRepository(db)
+	videoRepo := database.NewGORMVideoRepository(db)
+	datasetRepo := database.NewGORMDatasetRepository(db)
+	behaviorRepo := database.NewGORMBehaviorRepository(db)
+	alertRepo := database.NewGORMAlertRepository(db)
+	cameraRepo := database.NewGORMCameraRepository(db)
+
+	blobStore, err := storage.NewLocalBlobStore(cfg.BlobDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
 
-	userService := app.NewUserService(userRepo)
-	authService := app.NewAuthService(userRepo, sessionRepo, cfg)
+	breached, err := passwords.LoadBreachedList(cfg.BreachedPasswordFile)
+	if err != nil {
+		log.Fatalf("Failed to load breached password list: %v", err)
+	}
+	notifier, err := notify.NewFileNotifier(cfg.NotifyFile)
+	if err != nil {
+		log.Fatalf("Failed to initialize notifier: %v", err)
+	}
+	passwordPolicy := app.NewPasswordPolicy(cfg.PasswordMinLength, breached)
+
+	loginThrottler := app.NewLoginThrottler(loginThrottleRepo, app.SystemClock, app.LoginThrottlePolicy{
+		MaxAccountFailures: cfg.LoginMaxFailures,
+		LockoutDuration:    cfg.LoginLockout,
+		BackoffBase:        cfg.LoginBackoffBase,
+		MaxIPFailures:      cfg.LoginIPMaxFailures,
+		FailureWindow:      cfg.LoginFailureWindow,
+	})
+	auditService := app.NewAuditService(auditRepo)
+	auditService.Start(context.Background())
+	authService := app.NewAuthService(userRepo, sessionRepo, orgRepo, apiKeyRepo, loginThrottler, auditService, cfg)
+	roleService := app.NewRoleService(roleRepo, userRepo, orgRepo, authService)
+	orgService := app.NewOrgService(orgRepo, userRepo, roleService, authService)
+	userService := app.NewUserService(userRepo, passwordPolicy, orgService, authService, blobStore)
+	mfaService := app.NewMFAService(mfaRepo, userRepo, authService, app.SystemClock, cfg.MFAIssuer, parseRoles(cfg.MFARequiredRoles))
+	resetAccountLimiter := app.NewRateLimiter(loginThrottleRepo, app.SystemClock, "reset:account:", app.RateLimitPolicy{Limit: cfg.PasswordResetLimit, Window: cfg.PasswordResetWindow})
+	resetIPLimiter := app.NewRateLimiter(loginThrottleRepo, app.SystemClock, "reset:ip:", app.RateLimitPolicy{Limit: cfg.PasswordResetIPLimit, Window: cfg.PasswordResetWindow})
+	passwordService := app.NewPasswordService(userRepo, passwordResetRepo, authService, notifier, passwordPolicy, cfg.PasswordResetTTL, cfg.PasswordResetURL, resetAccountLimiter, resetIPLimiter)
+	apiKeyService := app.NewAPIKeyService(apiKeyRepo, roleService)
+	ssoService, err := newSSOService(cfg, identityRepo, userRepo, authService, mfaService, roleService, orgService)
+	if err != nil {
+		log.Fatalf("Failed to configure SSO: %v", err)
+	}
 	speciesService := app.NewSpeciesService(speciesRepo)
 	waterQualityService := app.NewWaterQualityService(waterQualityRepo)
+	taxonomyService := app.NewTaxonomyService(taxonomyRepo, speciesRepo)
+	speciesMediaService := app.NewSpeciesMediaService(speciesImageRepo, speciesRepo, blobStore)
+	observationService := app.NewObservationService(observationRepo, speciesRepo, taxonomyService, blobStore)
+	recognizer, err := newRecognizer(cfg, speciesMediaService)
+	if err != nil {
+		log.Fatalf("Failed to configure recognizer: %v", err)
+	}
+	enhanceSteps, err := imageproc.ParseSteps(cfg.ImageEnhanceSteps)
+	if err != nil {
+		log.Fatalf("Failed to configure image preprocessing: %v", err)
+	}
+	imageService := app.NewImageService(imageproc.NewPipeline(imageproc.Config{
+		DefaultSteps: enhanceSteps,
+		ClipLimit:    cfg.ImageClipLimit,
+		MaxSize:      cfg.ImageMaxSize,
+	}))
+	recognitionService := app.NewRecognitionService(recognizer, taxonomyService, recognitionRepo, blobStore, imageService, cfg.RecognitionEnhance)
+	recognitionJobService := app.NewRecognitionJobService(recognitionJobRepo, recognitionService, app.RecognitionJobPolicy{
+		Workers:       cfg.RecognitionWorkers,
+		RatePerSecond: cfg.RecognitionRateLimit,
+		MaxAttempts:   cfg.RecognitionMaxAttempts,
+		RetryDelay:    cfg.RecognitionRetryDelay,
+	})
+	recognitionJobService.Start(context.Background())
+	videoService := app.NewVideoService(videoRepo, blobStore)
+	datasetService := app.NewDatasetService(datasetRepo, blobStore, taxonomyService, videoService)
+	behaviorService := app.NewBehaviorService(behaviorRepo, alertRepo, waterQualityRepo, videoService, app.BehaviorAlertPolicy{
+		DOThreshold:   cfg.BehaviorDOThreshold,
+		MinConfidence: cfg.BehaviorAlertConfidence,
+		Window:        cfg.BehaviorCorrelationWindow,
+		Cooldown:      cfg.BehaviorAlertCooldown,
+	})
+	cameraService := app.NewCameraService(cameraRepo, blobStore, recognitionJobService, app.SnapshotPolicy{
+		RetentionDays: cfg.SnapshotRetentionDays,
+		SweepInterval: cfg.SnapshotSweepInterval,
+	})
+	cameraService.Start(context.Background())
+	llmProvider, err := newLLMProvider(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure LLM provider: %v", err)
+	}
+	chatLimiter := app.NewRateLimiter(loginThrottleRepo, app.SystemClock, "chat:", app.RateLimitPolicy{Limit: cfg.LLMRateLimit, Window: cfg.LLMRateWindow})
+	chatService := app.NewChatService(llmProvider, cfg.LLMSystemPrompt, chatLimiter)
 
-	userHandler := handler.NewUserHandler(userService, authService)
+	userHandler := handler.NewUserHandler(userService, authService, mfaService, orgService, auditService)
+	mfaHandler := handler.NewMFAHandler(mfaService)
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	roleHandler := handler.NewRoleHandler(roleService)
+	orgHandler := handler.NewOrgHandler(orgService)
+	ssoHandler := handler.NewSSOHandler(ssoService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	auditHandler := handler.NewAuditHandler(auditService)
 	speciesHandler := handler.NewSpeciesHandler(speciesService)
 	waterQualityHandler := handler.NewWaterQualityHandler(waterQualityService)
-	fishRecognitionHandler := handler.FishRecognitionHandler // 创建处理器
-	authMiddleware := middleware.NewAuthMiddleware(authService)
-	adminAuthMiddleware := middleware.NewAdminAuthMiddleware(authService)
+	taxonomyHandler := handler.NewTaxonomyHandler(taxonomyService)
+	speciesMediaHandler := handler.NewSpeciesMediaHandler(speciesMediaService)
+	observationHandler := handler.NewObservationHandler(observationService)
+	fishRecognitionHandler := handler.NewFishRecognitionHandler(recognitionService)
+	recognitionJobHandler := handler.NewRecognitionJobHandler(recognitionJobService)
+	imageHandler := handler.NewImageHandler(imageService)
+	videoHandler := handler.NewVideoHandler(videoService)
+	datasetHandler := handler.NewDatasetHandler(datasetService)
+	behaviorHandler := handler.NewBehaviorHandler(behaviorService)
+	cameraHandler := handler.NewCameraHandler(cameraService)
+	chatHandler := handler.NewChatHandler(chatService)
+	authMiddleware := middleware.NewAuthMiddleware(authService, apiKeyService, orgService)
+	permissionMiddleware := middleware.NewPermissionMiddleware(authMiddleware, roleService)
+	mfaMiddleware := middleware.NewMFAMiddleware(mfaService)
+	orgMiddleware := middleware.NewOrgMiddleware(orgService)
+	auditMiddleware := middleware.NewAuditMiddleware(auditService)
 
-	r := myrouter.SetupRouter(userHandler, speciesHandler, waterQualityHandler, fishRecognitionHandler, authMiddleware, adminAuthMiddleware)
+	r := myrouter.SetupRouter(userHandler, passwordHandler, mfaHandler, roleHandler, orgHandler, ssoHandler, apiKeyHandler, auditHandler, speciesHandler, waterQualityHandler, taxonomyHandler, speciesMediaHandler, observationHandler, fishRecognitionHandler, recognitionJobHandler, imageHandler, videoHandler, datasetHandler, behaviorHandler, cameraHandler, chatHandler, authMiddleware, permissionMiddleware, mfaMiddleware, orgMiddleware, auditMiddleware)
 
 	// 添加这段调试代码
 	fmt.Println("=== 注册的路由 ===")
@@ -53,3 +192,121 @@ func main() {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
+
+// parseRoles 解析逗号分隔的角色列表
+func parseRoles(s string) []domain.Role {
+	var roles []domain.Role
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, domain.Role(r))
+		}
+	}
+	return roles
+}
+
+// newSSOService 根据配置创建单点登录服务，未配置 oidc_issuer 时返回未启用的服务
+func newSSOService(cfg *config.Config, identityRepo app.IdentityRepository, userRepo app.UserRepository, authService *app.AuthService, mfaService *app.MFAService, roleService *app.RoleService, orgService *app.OrgService) (*app.SSOService, error) {
+	mappings, err := app.ParseGroupRoleMapping(cfg.OIDCRoleMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var provider app.SSOProvider
+	if cfg.OIDCIssuer != "" {
+		provider = oidc.NewProvider(oidc.Config{
+			Issuer:        cfg.OIDCIssuer,
+			ClientID:      cfg.OIDCClientID,
+			ClientSecret:  cfg.OIDCClientSecret,
+			RedirectURL:   cfg.OIDCRedirectURL,
+			Scopes:        strings.Fields(cfg.OIDCScopes),
+			UsernameClaim: cfg.OIDCUsernameClaim,
+			GroupsClaim:   cfg.OIDCGroupsClaim,
+		})
+	}
+	return app.NewSSOService(provider, identityRepo, userRepo, authService, mfaService, roleService, orgService, mappings, domain.Role(cfg.OIDCDefaultRole)), nil
+}
+
+// newRecognizer 按配置选择图像识别后端，在线后端按 recognition_fallback 配置离线降级。
+// 默认使用百度接口，未配置密钥时启动失败，不会静默退回返回固定结果的 mock
+func newRecognizer(cfg *config.Config, speciesMediaService *app.SpeciesMediaService) (app.Recognizer, error) {
+	switch cfg.RecognitionBackend {
+	case "mock":
+		var labels []string
+		for _, l := range strings.Split(cfg.RecognitionLabels, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				labels = append(labels, l)
+			}
+		}
+		return recognition.NewMockRecognizer(labels), nil
+	case "gallery":
+		return newGalleryRecognizer(cfg, speciesMediaService), nil
+	case "", "baidu":
+		if cfg.BaiduAPIKey == "" || cfg.BaiduSecretKey == "" {
+			return nil, fmt.Errorf("recognition backend baidu requires baidu_api_key and baidu_secret_key; set recognition_backend to gallery or mock for offline use")
+		}
+		baidu, err := recognition.NewBaiduRecognizer(recognition.BaiduConfig{
+			APIKey:    cfg.BaiduAPIKey,
+			SecretKey: cfg.BaiduSecretKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch cfg.RecognitionFallback {
+		case "":
+			return baidu, nil
+		case "gallery":
+			return recognition.NewFallbackRecognizer(baidu, newGalleryRecognizer(cfg, speciesMediaService)), nil
+		default:
+			return nil, fmt.Errorf("unknown recognition fallback %q", cfg.RecognitionFallback)
+		}
+	default:
+		return nil, fmt.Errorf("unknown recognition backend %q", cfg.RecognitionBackend)
+	}
+}
+
+// newLLMProvider 按配置选择智能问答使用的大模型，openai 未配置密钥时智能问答不可用
+func newLLMProvider(cfg *config.Config) (app.LLMProvider, error) {
+	switch cfg.LLMProvider {
+	case "", "openai":
+		if cfg.LLMAPIKey == "" {
+			log.Printf("LLM API key not configured, chat is disabled")
+			return nil, nil
+		}
+		return llm.NewOpenAIProvider(llm.OpenAIConfig{
+			BaseURL:     cfg.LLMBaseURL,
+			APIKey:      cfg.LLMAPIKey,
+			Model:       cfg.LLMModel,
+			Timeout:     cfg.LLMTimeout,
+			MaxAttempts: cfg.LLMMaxAttempts,
+			RetryDelay:  cfg.LLMRetryDelay,
+		})
+	case "mock":
+		return llm.NewScriptedProvider(llm.Reply("当前为离线演示模式，智能问答未连接大模型。")), nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", cfg.LLMProvider)
+	}
+}
+
+// newGalleryRecognizer 以物种图库为参考图库，启动时在后台预先建立索引
+func newGalleryRecognizer(cfg *config.Config, speciesMediaService *app.SpeciesMediaService) *recognition.GalleryRecognizer {
+	gallery := recognition.NewGalleryRecognizer(func(ctx context.Context) ([]recognition.GalleryImage, error) {
+		refs, err := speciesMediaService.ReferenceImages()
+		if err != nil {
+			return nil, err
+		}
+		images := make([]recognition.GalleryImage, 0, len(refs))
+		for _, ref := range refs {
+			images = append(images, recognition.GalleryImage{Label: ref.Label, Data: ref.Data})
+		}
+		return images, nil
+	}, recognition.GalleryConfig{
+		Refresh:  cfg.GalleryRefresh,
+		MinScore: cfg.GalleryMinScore,
+	})
+	go func() {
+		if err := gallery.Reload(context.Background()); err != nil {
+			log.Printf("Failed to load recognition gallery: %v", err)
+		}
+	}()
+	return gallery
+}
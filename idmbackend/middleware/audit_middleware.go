@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware 为管理接口写入审计日志，需放在认证中间件之前，以便同时记录被拒绝的请求
+type AuditMiddleware struct {
+	auditService *app.AuditService
+}
+
+func NewAuditMiddleware(auditService *app.AuditService) *AuditMiddleware {
+	return &AuditMiddleware{auditService: auditService}
+}
+
+// Handle 记录全部修改操作，以及未通过认证或权限校验的查询
+func (m *AuditMiddleware) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		outcome := domain.AuditSuccess
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			outcome = domain.AuditDenied
+		case status >= http.StatusBadRequest:
+			outcome = domain.AuditFailure
+		}
+		if c.Request.Method == http.MethodGet && outcome != domain.AuditDenied {
+			return
+		}
+
+		route := c.FullPath()
+		entry := &domain.AuditEntry{
+			Action:     "admin:" + c.Request.Method + " " + route,
+			TargetType: adminTargetType(route),
+			TargetID:   c.Param("id"),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			Outcome:    outcome,
+			Detail:     fmt.Sprintf("status=%d", status),
+		}
+		if entry.TargetID == "" {
+			entry.TargetID = c.Param("name")
+		}
+		if value, ok := c.Get("principal"); ok {
+			if principal, ok := value.(*domain.Principal); ok && principal != nil {
+				entry.OrgID = principal.OrgID
+				entry.ActorKind = string(principal.Kind)
+				entry.ActorID = principal.UserID
+				entry.ActorName = principal.Name
+				if principal.Kind == domain.PrincipalAPIKey {
+					entry.ActorID = principal.APIKeyID
+				}
+			}
+		}
+		m.auditService.Record(entry)
+	}
+}
+
+// adminTargetType 取管理路由 /api/admin/<资源>/... 中的资源名
+func adminTargetType(route string) string {
+	_, rest, ok := strings.Cut(route, "/admin/")
+	if !ok {
+		return ""
+	}
+	resource, _, _ := strings.Cut(rest, "/")
+	return resource
+}
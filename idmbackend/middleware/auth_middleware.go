@@ -4,61 +4,117 @@ import (
 	"strings"
 
 	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
 	"github.com/gin-gonic/gin"
 )
 
 type AuthMiddleware struct {
-	authService *app.AuthService
+	authService   *app.AuthService
+	apiKeyService *app.APIKeyService
+	orgService    *app.OrgService
 }
 
-func NewAuthMiddleware(authService *app.AuthService) *AuthMiddleware {
+func NewAuthMiddleware(authService *app.AuthService, apiKeyService *app.APIKeyService, orgService *app.OrgService) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
+		authService:   authService,
+		apiKeyService: apiKeyService,
+		orgService:    orgService,
 	}
 }
 
 func (m *AuthMiddleware) Handle() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "未提供认证信息"})
-			c.Abort()
-			return
-		}
-
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
-			c.JSON(401, gin.H{"error": "无效的认证格式"})
-			c.Abort()
+		if !m.authenticate(c) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		tokenString := tokenParts[1]
-		token, err := m.authService.VerifyToken(tokenString)
+// authenticate 校验 X-API-Key 或 Bearer 访问令牌，并将请求主体写入上下文，失败时写入401响应并中止请求
+func (m *AuthMiddleware) authenticate(c *gin.Context) bool {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		principal, err := m.apiKeyService.Authenticate(apiKey, c.ClientIP())
 		if err != nil {
-			c.JSON(401, gin.H{"error": "无效的token"})
+			c.JSON(401, gin.H{"error": "无效的API密钥"})
 			c.Abort()
-			return
+			return false
 		}
+		c.Set("principal", principal)
+		return true
+	}
 
-		userID, err := m.authService.GetUserIDFromToken(token)
-		if err != nil {
-			c.JSON(401, gin.H{"error": "无效的token信息"})
-			c.Abort()
-			return
-		}
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(401, gin.H{"error": "未提供认证信息"})
+		c.Abort()
+		return false
+	}
 
-		role, err := m.authService.GetUserRoleFromToken(token)
-		if err != nil {
-			c.JSON(401, gin.H{"error": "无效的token信息"})
-			c.Abort()
-			return
-		}
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
+		c.JSON(401, gin.H{"error": "无效的认证格式"})
+		c.Abort()
+		return false
+	}
 
-		// 将用户信息存储在上下文中
-		c.Set("userID", userID)
-		c.Set("userRole", role)
+	tokenString := tokenParts[1]
+	token, err := m.authService.VerifyToken(tokenString)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "无效的token"})
+		c.Abort()
+		return false
+	}
 
-		c.Next()
+	userID, err := m.authService.GetUserIDFromToken(token)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "无效的token信息"})
+		c.Abort()
+		return false
 	}
+
+	role, err := m.authService.GetUserRoleFromToken(token)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "无效的token信息"})
+		c.Abort()
+		return false
+	}
+
+	// 已登出或被吊销的会话签发的访问令牌不再有效
+	sessionID, err := m.authService.GetSessionIDFromToken(token)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "无效的token信息"})
+		c.Abort()
+		return false
+	}
+	session, err := m.authService.CheckSession(sessionID)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "会话已失效，请重新登录"})
+		c.Abort()
+		return false
+	}
+
+	// 权限取决于用户在会话当前组织中的角色，令牌中的角色为全局角色
+	orgRole, orgID, err := m.orgService.Resolve(userID, role, session.OrgID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "获取组织信息失败"})
+		c.Abort()
+		return false
+	}
+
+	// 将用户信息存储在上下文中
+	c.Set("principal", &domain.Principal{
+		Kind:          domain.PrincipalUser,
+		UserID:        userID,
+		Role:          orgRole,
+		SessionID:     sessionID,
+		OrgID:         orgID,
+		PlatformAdmin: role == domain.RoleAdmin,
+		MFA:           m.authService.GetMFAFromToken(token),
+		Name:          m.authService.GetUsernameFromToken(token),
+	})
+	c.Set("userID", userID)
+	c.Set("userRole", orgRole)
+	c.Set("sessionID", sessionID)
+	return true
 }
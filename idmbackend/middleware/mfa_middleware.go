@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// MFAMiddleware 按策略要求特定角色使用通过两步验证的会话，需放在认证中间件之后
+type MFAMiddleware struct {
+	mfaService *app.MFAService
+}
+
+func NewMFAMiddleware(mfaService *app.MFAService) *MFAMiddleware {
+	return &MFAMiddleware{mfaService: mfaService}
+}
+
+// Handle API 密钥无法完成两步验证，管理接口只接受用户会话
+func (m *MFAMiddleware) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("principal")
+		principal, ok := value.(*domain.Principal)
+		if !ok || principal == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+
+		if principal.Kind != domain.PrincipalUser {
+			c.JSON(http.StatusForbidden, gin.H{"error": "管理功能不接受API密钥，请使用账号登录"})
+			c.Abort()
+			return
+		}
+		if !principal.MFA && m.mfaService.RequiresMFA(principal.Role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "该账号必须启用两步验证并使用验证码登录后才能访问管理功能",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMFAMiddlewareRejectsAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		want      int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized},
+		// API 密钥即使持有全部权限也无法完成两步验证
+		{"api key", &domain.Principal{Kind: domain.PrincipalAPIKey, APIKeyID: 1, OrgID: 1, Permissions: []domain.Permission{domain.PermAll}}, http.StatusForbidden},
+		{"user with mfa", &domain.Principal{Kind: domain.PrincipalUser, UserID: 1, Role: domain.RoleAdmin, MFA: true, OrgID: 1}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.principal != nil {
+					c.Set("principal", tt.principal)
+				}
+			})
+			// 被测分支在查询两步验证策略之前返回，不需要 MFAService
+			r.GET("/admin", NewMFAMiddleware(nil).Handle(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// OrgMiddleware 限制组织管理员只能操作本组织的用户，需放在认证中间件之后
+type OrgMiddleware struct {
+	orgService *app.OrgService
+}
+
+func NewOrgMiddleware(orgService *app.OrgService) *OrgMiddleware {
+	return &OrgMiddleware{orgService: orgService}
+}
+
+// RequireMember 要求路径参数 param 指定的用户属于当前组织，平台管理员不受限制
+func (m *OrgMiddleware) RequireMember(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("principal")
+		principal, ok := value.(*domain.Principal)
+		if !ok || principal == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+
+		userID, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+			c.Abort()
+			return
+		}
+
+		if err := m.orgService.EnsureMember(principal, uint(userID)); err != nil {
+			if err == domain.ErrNotOrgMember {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到指定的用户"})
+			} else {
+				log.Printf("校验组织成员失败: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "校验组织成员失败"})
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/MoyInGxing/idm/app"
+	"github.com/MoyInGxing/idm/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionMiddleware struct {
+	authMiddleware *AuthMiddleware
+	roleService    *app.RoleService
+}
+
+func NewPermissionMiddleware(authMiddleware *AuthMiddleware, roleService *app.RoleService) *PermissionMiddleware {
+	return &PermissionMiddleware{
+		authMiddleware: authMiddleware,
+		roleService:    roleService,
+	}
+}
+
+// RequirePermission 要求当前请求主体（用户角色或 API 密钥）拥有全部指定权限。
+// 若请求尚未经过认证中间件，会先完成认证。
+func (m *PermissionMiddleware) RequirePermission(permissions ...domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("principal"); !exists && !m.authMiddleware.authenticate(c) {
+			return
+		}
+
+		value, _ := c.Get("principal")
+		principal, _ := value.(*domain.Principal)
+		if principal == nil {
+			c.JSON(401, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+		for _, p := range permissions {
+			ok, err := m.hasPermission(principal, p)
+			if err != nil {
+				log.Printf("权限检查失败: %v", err)
+				c.JSON(500, gin.H{"error": "权限检查失败"})
+				c.Abort()
+				return
+			}
+			if !ok {
+				c.JSON(403, gin.H{"error": "权限不足", "required": p})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin 要求当前请求主体是平台管理员，用于跨组织的全局操作。
+// 组织管理员虽然拥有组织内的全部权限，也不能访问这些接口
+func (m *PermissionMiddleware) RequirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("principal"); !exists && !m.authMiddleware.authenticate(c) {
+			return
+		}
+
+		value, _ := c.Get("principal")
+		principal, _ := value.(*domain.Principal)
+		if principal == nil {
+			c.JSON(401, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+		if principal.Kind != domain.PrincipalUser || !principal.PlatformAdmin {
+			c.JSON(403, gin.H{"error": "仅平台管理员可用"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hasPermission API 密钥使用自身的权限，用户使用角色的权限
+func (m *PermissionMiddleware) hasPermission(principal *domain.Principal, p domain.Permission) (bool, error) {
+	if principal.Kind == domain.PrincipalAPIKey {
+		return principal.HasScopedPermission(p), nil
+	}
+	return m.roleService.HasPermission(principal.Role, p)
+}